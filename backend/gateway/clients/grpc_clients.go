@@ -1,14 +1,25 @@
 package clients
 
 import (
+	"context"
 	"fmt"
 	"log"
 
 	authpb "github.com/aashiq-04/session-management-system/backend/gateway/proto/auth"
 	auditpb "github.com/aashiq-04/session-management-system/backend/gateway/proto/audit"
 	sessionpb "github.com/aashiq-04/session-management-system/backend/gateway/proto/session"
+	"github.com/aashiq-04/session-management-system/backend/gateway/identity"
+	"github.com/aashiq-04/session-management-system/backend/gateway/middleware"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+)
+
+// Service names, as in the services' certificates and identity token audiences
+const (
+	authService    = "auth-service"
+	sessionService = "session-service"
+	auditService   = "audit-service"
 )
 
 // GRPCClients holds all gRPC client connections
@@ -18,24 +29,26 @@ type GRPCClients struct {
 	AuditClient   auditpb.AuditServiceClient
 }
 
-// NewGRPCClients creates and initializes all gRPC clients
-func NewGRPCClients(authURL, sessionURL, auditURL string) (*GRPCClients, error) {
+// NewGRPCClients creates and initializes all gRPC clients. Connections use
+// creds for mTLS, and calls made while a user is signed in carry an identity
+// token from signer.
+func NewGRPCClients(authURL, sessionURL, auditURL string, creds credentials.TransportCredentials, signer *identity.Signer) (*GRPCClients, error) {
 	// Connect to Auth Service
-	authConn, err := grpc.Dial(authURL, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	authConn, err := dial(authURL, authService, creds, signer)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to auth service: %w", err)
 	}
 	log.Printf("Connected to Auth Service at %s", authURL)
 
 	// Connect to Session Service
-	sessionConn, err := grpc.Dial(sessionURL, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	sessionConn, err := dial(sessionURL, sessionService, creds, signer)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to session service: %w", err)
 	}
 	log.Printf("Connected to Session Service at %s", sessionURL)
 
 	// Connect to Audit Service
-	auditConn, err := grpc.Dial(auditURL, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	auditConn, err := dial(auditURL, auditService, creds, signer)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to audit service: %w", err)
 	}
@@ -46,4 +59,40 @@ func NewGRPCClients(authURL, sessionURL, auditURL string) (*GRPCClients, error)
 		SessionClient: sessionpb.NewSessionServiceClient(sessionConn),
 		AuditClient:   auditpb.NewAuditServiceClient(auditConn),
 	}, nil
-}
\ No newline at end of file
+}
+
+func dial(url, service string, creds credentials.TransportCredentials, signer *identity.Signer) (*grpc.ClientConn, error) {
+	return grpc.Dial(url,
+		grpc.WithTransportCredentials(creds),
+		grpc.WithUnaryInterceptor(func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+			ctx, err := withIdentity(ctx, signer, service)
+			if err != nil {
+				return err
+			}
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}),
+		grpc.WithStreamInterceptor(func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+			ctx, err := withIdentity(ctx, signer, service)
+			if err != nil {
+				return nil, err
+			}
+			return streamer(ctx, desc, cc, method, opts...)
+		}),
+	)
+}
+
+// withIdentity attaches an identity token for the signed-in user, if any,
+// carrying their organization and permissions
+func withIdentity(ctx context.Context, signer *identity.Signer, service string) (context.Context, error) {
+	user, ok := middleware.GetUserFromContext(ctx)
+	if !ok {
+		return ctx, nil
+	}
+
+	token, err := signer.Sign(user.UserID, user.OrganizationID, service, user.Permissions)
+	if err != nil {
+		return ctx, fmt.Errorf("failed to sign identity token: %w", err)
+	}
+
+	return metadata.AppendToOutgoingContext(ctx, identity.TokenHeader, token), nil
+}
@@ -6,13 +6,16 @@ import (
 	"net/http"
 	"os"
 	"context"
+	"time"
 	"github.com/99designs/gqlgen/graphql/handler"
 	"github.com/99designs/gqlgen/graphql/playground"
 	"github.com/rs/cors"
 	"github.com/joho/godotenv"
 	"github.com/aashiq-04/session-management-system/backend/gateway/clients"
+	"github.com/aashiq-04/session-management-system/backend/gateway/export"
 	"github.com/aashiq-04/session-management-system/backend/gateway/graph"
 	"github.com/aashiq-04/session-management-system/backend/gateway/graph/generated"
+	"github.com/aashiq-04/session-management-system/backend/gateway/identity"
 	"github.com/aashiq-04/session-management-system/backend/gateway/middleware"
 )
 
@@ -24,11 +27,24 @@ func main() {
 	// Load configuration
 	config := loadConfig()
 
+	// Calls to the services use mTLS and carry a signed identity token for
+	// the signed-in user
+	creds, err := identity.ClientCredentials(config.TLSCertFile, config.TLSKeyFile, config.TLSCAFile)
+	if err != nil {
+		log.Fatalf("Failed to load TLS credentials: %v", err)
+	}
+	signingKey, err := identity.LoadSigningKey(config.IdentitySigningKeyFile)
+	if err != nil {
+		log.Fatalf("Failed to load identity signing key: %v", err)
+	}
+
 	// Initialize gRPC clients
 	grpcClients, err := clients.NewGRPCClients(
 		config.AuthServiceURL,
 		config.SessionServiceURL,
 		config.AuditServiceURL,
+		creds,
+		identity.NewSigner(signingKey, config.IdentityTokenTTL),
 	)
 	if err != nil {
 		log.Fatalf("Failed to initialize gRPC clients: %v", err)
@@ -40,7 +56,12 @@ func main() {
 	// Create GraphQL server
 	srv := handler.NewDefaultServer(generated.NewExecutableSchema(generated.Config{
 		Resolvers: resolver,
+		Directives: generated.DirectiveRoot{
+			RequiresRecentAuth: resolver.RequiresRecentAuth,
+		},
 	}))
+	srv.SetErrorPresenter(graph.ErrorPresenter)
+	srv.AroundOperations(graph.RequireTokenScopes)
 
 	// Setup CORS
 	corsHandler := cors.New(cors.Options{
@@ -53,14 +74,28 @@ func main() {
 	// Setup routes
 	mux := http.NewServeMux()
 
+	// Access tokens are checked here; API tokens by the auth service
+	authMiddleware := middleware.AuthMiddleware(config.JWTSecret, grpcClients.AuthClient, getRealIP)
+
 	// GraphQL endpoint with auth middleware
 	// mux.Handle("/graphql", middleware.AuthMiddleware(config.JWTSecret)(srv))
 	mux.Handle("/graphql", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		ctx := context.WithValue(r.Context(), "httpRequest", r)
-		middleware.AuthMiddleware(config.JWTSecret)(srv).ServeHTTP(w, r.WithContext(ctx))
+		authMiddleware(srv).ServeHTTP(w, r.WithContext(ctx))
 	}))
 	
 
+	// Audit log downloads, authenticated with the same JWT as /graphql, or
+	// an API token with the read scope
+	mux.Handle("/export/audit-logs", authMiddleware(middleware.RequireScope(middleware.ScopeRead)(
+		export.NewAuditLogHandler(grpcClients.AuditClient, getRealIP),
+	)))
+
+	// Everything held about the signed-in user, as a zip archive
+	mux.Handle("/export/my-data", authMiddleware(middleware.RequireScope(middleware.ScopeRead)(
+		export.NewMyDataHandler(grpcClients.AuthClient, grpcClients.SessionClient, grpcClients.AuditClient, getRealIP),
+	)))
+
 	// GraphQL playground (development only)
 	if config.Environment == "development" {
 		mux.Handle("/playground", playground.Handler("GraphQL Playground", "/graphql"))
@@ -93,6 +128,12 @@ type Config struct {
 	SessionServiceURL string
 	AuditServiceURL   string
 	JWTSecret         string
+
+	TLSCertFile            string
+	TLSKeyFile             string
+	TLSCAFile              string
+	IdentitySigningKeyFile string
+	IdentityTokenTTL       time.Duration
 }
 
 // loadConfig loads configuration from environment variables
@@ -104,6 +145,11 @@ func loadConfig() Config {
 		SessionServiceURL: getEnv("SESSION_SERVICE_URL", "localhost:50052"),
 		AuditServiceURL:   getEnv("AUDIT_SERVICE_URL", "localhost:50053"),
 		JWTSecret:         getEnv("JWT_SECRET", ""),
+
+		TLSCertFile:            getEnv("TLS_CERT_FILE", ""),
+		TLSKeyFile:             getEnv("TLS_KEY_FILE", ""),
+		TLSCAFile:              getEnv("TLS_CA_FILE", ""),
+		IdentitySigningKeyFile: getEnv("IDENTITY_SIGNING_KEY_FILE", ""),
 	}
 
 	// Validate required config
@@ -111,6 +157,21 @@ func loadConfig() Config {
 		log.Fatal("JWT_SECRET environment variable is required")
 	}
 
+	// Certificates and keys are made by scripts/dev-certs.sh in development
+	if config.TLSCertFile == "" || config.TLSKeyFile == "" || config.TLSCAFile == "" {
+		log.Fatal("TLS_CERT_FILE, TLS_KEY_FILE and TLS_CA_FILE environment variables are required")
+	}
+	if config.IdentitySigningKeyFile == "" {
+		log.Fatal("IDENTITY_SIGNING_KEY_FILE environment variable is required")
+	}
+
+	// Tokens are made per call, so they only need to outlive one request
+	ttl, err := time.ParseDuration(getEnv("IDENTITY_TOKEN_TTL", "1m"))
+	if err != nil || ttl <= 0 {
+		log.Fatalf("Invalid IDENTITY_TOKEN_TTL: %s", getEnv("IDENTITY_TOKEN_TTL", "1m"))
+	}
+	config.IdentityTokenTTL = ttl
+
 	return config
 }
 
@@ -0,0 +1,155 @@
+// Package export serves file downloads that don't fit GraphQL, such as audit
+// log and personal data exports
+package export
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/aashiq-04/session-management-system/backend/gateway/middleware"
+	auditpb "github.com/aashiq-04/session-management-system/backend/gateway/proto/audit"
+)
+
+// fileTypes maps export formats to their content type and file extension
+var fileTypes = map[string]struct{ contentType, extension string }{
+	"csv":    {"text/csv; charset=utf-8", "csv"},
+	"ndjson": {"application/x-ndjson", "ndjson"},
+	"cef":    {"text/plain; charset=utf-8", "cef"},
+}
+
+// AuditLogHandler streams the signed-in user's audit logs as a file download.
+// It must sit behind middleware.AuthMiddleware, which checks the same JWT as
+// the GraphQL endpoint.
+type AuditLogHandler struct {
+	auditClient auditpb.AuditServiceClient
+	clientIP    func(*http.Request) string
+}
+
+// NewAuditLogHandler creates an audit log export handler
+func NewAuditLogHandler(auditClient auditpb.AuditServiceClient, clientIP func(*http.Request) string) *AuditLogHandler {
+	return &AuditLogHandler{auditClient: auditClient, clientIP: clientIP}
+}
+
+// ServeHTTP handles GET /export/audit-logs?format=csv|ndjson|cef with optional
+// start_time, end_time, event_types (comma-separated), ip, session_id,
+// device_id, success and query parameters
+func (h *AuditLogHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	params := r.URL.Query()
+	format := params.Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	fileType, ok := fileTypes[format]
+	if !ok {
+		http.Error(w, "format must be csv, ndjson or cef", http.StatusBadRequest)
+		return
+	}
+
+	filter := &auditpb.AuditLogFilter{
+		StartTime: params.Get("start_time"),
+		EndTime:   params.Get("end_time"),
+		IpAddress: params.Get("ip"),
+		SessionId: params.Get("session_id"),
+		DeviceId:  params.Get("device_id"),
+	}
+	if eventTypes := params.Get("event_types"); eventTypes != "" {
+		filter.EventTypes = strings.Split(eventTypes, ",")
+	}
+	if success := params.Get("success"); success != "" {
+		value := success == "true"
+		if !value && success != "false" {
+			http.Error(w, "success must be true or false", http.StatusBadRequest)
+			return
+		}
+		filter.Success = &value
+	}
+
+	stream, err := h.auditClient.ExportAuditLogs(r.Context(), &auditpb.ExportAuditLogsRequest{
+		UserId:      user.UserID,
+		Format:      format,
+		Filter:      filter,
+		Query:       params.Get("query"),
+		RequestedBy: user.UserID,
+		IpAddress:   h.clientIP(r),
+	})
+	if err != nil {
+		writeGRPCError(w, err, "audit logs")
+		return
+	}
+
+	// Validation errors arrive with the first message, so wait for it before
+	// committing to a 200 and the download headers
+	chunk, err := stream.Recv()
+	if err != nil && !errors.Is(err, io.EOF) {
+		writeGRPCError(w, err, "audit logs")
+		return
+	}
+
+	filename := fmt.Sprintf("audit-logs-%s.%s", time.Now().UTC().Format("20060102-150405"), fileType.extension)
+	w.Header().Set("Content-Type", fileType.contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+
+	flusher, _ := w.(http.Flusher)
+	for err == nil {
+		if _, writeErr := w.Write(chunk.Data); writeErr != nil {
+			// Client went away; cancelling the request context stops the stream
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		chunk, err = stream.Recv()
+	}
+
+	if !errors.Is(err, io.EOF) {
+		// Headers are already sent, so all we can do is cut the download short
+		log.Printf("Audit log export for user %s ended early: %v", user.UserID, err)
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// writeGRPCError maps a service error to an HTTP response, naming what
+// was being exported
+func writeGRPCError(w http.ResponseWriter, err error, what string) {
+	st, _ := status.FromError(err)
+	switch st.Code() {
+	case codes.InvalidArgument:
+		http.Error(w, st.Message(), http.StatusBadRequest)
+	case codes.Unauthenticated:
+		http.Error(w, st.Message(), http.StatusUnauthorized)
+	case codes.PermissionDenied:
+		http.Error(w, st.Message(), http.StatusForbidden)
+	case codes.NotFound:
+		http.Error(w, st.Message(), http.StatusNotFound)
+	case codes.Unavailable:
+		http.Error(w, "service temporarily unavailable", http.StatusServiceUnavailable)
+	case codes.Canceled, codes.DeadlineExceeded:
+		http.Error(w, "export cancelled", http.StatusGatewayTimeout)
+	default:
+		log.Printf("Export of %s failed: %v", what, err)
+		http.Error(w, "failed to export "+what, http.StatusBadGateway)
+	}
+}
@@ -0,0 +1,155 @@
+package export
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/aashiq-04/session-management-system/backend/gateway/middleware"
+	auditpb "github.com/aashiq-04/session-management-system/backend/gateway/proto/audit"
+	authpb "github.com/aashiq-04/session-management-system/backend/gateway/proto/auth"
+	sessionpb "github.com/aashiq-04/session-management-system/backend/gateway/proto/session"
+)
+
+// exportJSON formats the JSON files of a personal data export
+var exportJSON = protojson.MarshalOptions{Multiline: true, Indent: "  ", UseProtoNames: true}
+
+// MyDataHandler streams everything held about the signed-in user as a zip
+// archive: their account from the auth service, sessions and devices from
+// the session service, and alerts, settings and audit logs from the audit
+// service. It must sit behind middleware.AuthMiddleware.
+type MyDataHandler struct {
+	authClient    authpb.AuthServiceClient
+	sessionClient sessionpb.SessionServiceClient
+	auditClient   auditpb.AuditServiceClient
+	clientIP      func(*http.Request) string
+}
+
+// NewMyDataHandler creates a personal data export handler
+func NewMyDataHandler(authClient authpb.AuthServiceClient, sessionClient sessionpb.SessionServiceClient, auditClient auditpb.AuditServiceClient, clientIP func(*http.Request) string) *MyDataHandler {
+	return &MyDataHandler{
+		authClient:    authClient,
+		sessionClient: sessionClient,
+		auditClient:   auditClient,
+		clientIP:      clientIP,
+	}
+}
+
+// ServeHTTP handles GET /export/my-data. The archive holds account.json,
+// sessions.json, security.json and audit-logs.ndjson.
+func (h *MyDataHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	ctx := r.Context()
+	ip := h.clientIP(r)
+
+	// The small parts are fetched up front, so a failing service is reported
+	// before committing to a 200
+	account, err := h.authClient.ExportUserData(ctx, &authpb.ExportUserDataRequest{UserId: user.UserID, IpAddress: ip})
+	if err != nil {
+		writeGRPCError(w, err, "account data")
+		return
+	}
+	account.Success, account.Message = false, ""
+
+	sessions, err := h.sessionClient.ExportUserData(ctx, &sessionpb.ExportUserDataRequest{UserId: user.UserID})
+	if err != nil {
+		writeGRPCError(w, err, "sessions")
+		return
+	}
+	sessions.Success, sessions.Message = false, ""
+
+	security, err := h.auditClient.ExportUserData(ctx, &auditpb.ExportUserDataRequest{UserId: user.UserID})
+	if err != nil {
+		writeGRPCError(w, err, "security data")
+		return
+	}
+	security.Success, security.Message = false, ""
+
+	stream, err := h.auditClient.ExportAuditLogs(ctx, &auditpb.ExportAuditLogsRequest{
+		UserId:      user.UserID,
+		Format:      "ndjson",
+		RequestedBy: user.UserID,
+		IpAddress:   ip,
+	})
+	if err != nil {
+		writeGRPCError(w, err, "audit logs")
+		return
+	}
+	chunk, err := stream.Recv()
+	if err != nil && !errors.Is(err, io.EOF) {
+		writeGRPCError(w, err, "audit logs")
+		return
+	}
+
+	filename := fmt.Sprintf("my-data-%s.zip", time.Now().UTC().Format("20060102-150405"))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+
+	archive := zip.NewWriter(w)
+	for _, file := range []struct {
+		name    string
+		message proto.Message
+	}{
+		{"account.json", account},
+		{"sessions.json", sessions},
+		{"security.json", security},
+	} {
+		if err := writeJSONFile(archive, file.name, file.message); err != nil {
+			log.Printf("Personal data export for user %s failed: %v", user.UserID, err)
+			panic(http.ErrAbortHandler)
+		}
+	}
+
+	auditLogs, err := archive.Create("audit-logs.ndjson")
+	for err == nil {
+		if _, err = auditLogs.Write(chunk.Data); err != nil {
+			break
+		}
+		chunk, err = stream.Recv()
+	}
+	if errors.Is(err, io.EOF) {
+		err = archive.Close()
+	}
+
+	if err != nil {
+		// Headers are already sent; cutting the download short leaves an
+		// archive without its directory, which unzip tools reject
+		log.Printf("Personal data export for user %s ended early: %v", user.UserID, err)
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// writeJSONFile adds a message to an archive as a JSON file
+func writeJSONFile(archive *zip.Writer, name string, message proto.Message) error {
+	data, err := exportJSON.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", name, err)
+	}
+
+	file, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(append(data, '\n'))
+	return err
+}
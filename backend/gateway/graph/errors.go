@@ -0,0 +1,175 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"math"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// errUnauthorized is returned by resolvers that need a signed-in user
+var errUnauthorized = status.Error(codes.Unauthenticated, "unauthorized")
+
+// errMissingPermission is returned by admin resolvers when the user's roles
+// don't grant permission. It carries the same reason as the services' check.
+func errMissingPermission(permission string) error {
+	return permissionDenied("Missing permission "+permission, "PERMISSION_MISSING")
+}
+
+// errMissingScope is returned for operations the scopes of the API token
+// they were made with don't allow
+func errMissingScope(scope string) error {
+	return permissionDenied("API token lacks the "+scope+" scope", "SCOPE_MISSING")
+}
+
+// errAPITokenNotAllowed is returned for things that can't be done with an
+// API token, such as managing API tokens
+var errAPITokenNotAllowed = permissionDenied("Not allowed with an API token; sign in instead", "API_TOKEN_NOT_ALLOWED")
+
+// errReauthenticationRequired is returned for fields marked with
+// @requiresRecentAuth when the access token's sign-in is too old or lacks a
+// factor. The client reauthenticates and retries.
+var errReauthenticationRequired = statusWithReason(codes.Unauthenticated, "Reauthenticate to continue", "REAUTHENTICATION_REQUIRED")
+
+// errImpersonating is returned for things an admin signed in as a user can't
+// do, since they can't prove they are the user
+var errImpersonating = permissionDenied("Not allowed while impersonating", "IMPERSONATION_SESSION")
+
+// invalidArgument returns an InvalidArgument status naming the offending
+// argument, like the services' field violations
+func invalidArgument(field, description string) error {
+	st, err := status.New(codes.InvalidArgument, field+" "+description).WithDetails(&errdetails.BadRequest{
+		FieldViolations: []*errdetails.BadRequest_FieldViolation{{Field: field, Description: description}},
+	})
+	if err != nil {
+		return status.Error(codes.InvalidArgument, field+" "+description)
+	}
+	return st.Err()
+}
+
+// requireNonNegative rejects a negative page size or offset argument
+func requireNonNegative(field string, value *int) error {
+	if value != nil && *value < 0 {
+		return invalidArgument(field, "must not be negative")
+	}
+	return nil
+}
+
+// permissionDenied returns a PermissionDenied status with an ErrorInfo reason
+func permissionDenied(message, reason string) error {
+	return statusWithReason(codes.PermissionDenied, message, reason)
+}
+
+// statusWithReason returns a status with an ErrorInfo reason
+func statusWithReason(code codes.Code, message, reason string) error {
+	st, err := status.New(code, message).WithDetails(&errdetails.ErrorInfo{
+		Reason: reason,
+		Domain: "session-management-system",
+	})
+	if err != nil {
+		return status.Error(code, message)
+	}
+	return st.Err()
+}
+
+// errorCodes maps gRPC codes to the extensions.code clients branch on
+var errorCodes = map[codes.Code]string{
+	codes.InvalidArgument:    "BAD_USER_INPUT",
+	codes.OutOfRange:         "BAD_USER_INPUT",
+	codes.Unauthenticated:    "UNAUTHENTICATED",
+	codes.PermissionDenied:   "FORBIDDEN",
+	codes.NotFound:           "NOT_FOUND",
+	codes.AlreadyExists:      "ALREADY_EXISTS",
+	codes.FailedPrecondition: "FAILED_PRECONDITION",
+	codes.Aborted:            "CONFLICT",
+	codes.ResourceExhausted:  "RATE_LIMITED",
+	codes.Unavailable:        "SERVICE_UNAVAILABLE",
+	codes.DeadlineExceeded:   "TIMEOUT",
+	codes.Canceled:           "CANCELLED",
+	codes.Unimplemented:      "NOT_IMPLEMENTED",
+}
+
+// genericMessages replace messages that come from the transport rather than
+// a service, since those describe internals such as connection addresses
+var genericMessages = map[codes.Code]string{
+	codes.Unavailable:      "service temporarily unavailable",
+	codes.DeadlineExceeded: "request timed out",
+	codes.Unknown:          "internal server error",
+}
+
+// ErrorPresenter turns gRPC status errors returned by the services into
+// GraphQL errors. The status message becomes the error message, and the code
+// and details are exposed as extensions:
+//
+//	code               stable error code, see errorCodes
+//	reason             ErrorInfo reason, e.g. INVALID_CREDENTIALS
+//	fieldViolations    [{field, description}] from BadRequest
+//	retryAfterSeconds  RetryInfo delay
+//	resource           {type, name} from ResourceInfo
+//
+// Errors that aren't gRPC statuses keep their message and get the code
+// INTERNAL_SERVER_ERROR.
+func ErrorPresenter(ctx context.Context, err error) *gqlerror.Error {
+	gqlErr := graphql.DefaultErrorPresenter(ctx, err)
+
+	// Errors raised by gqlgen itself, such as validation failures, already
+	// carry a code
+	if _, ok := gqlErr.Extensions["code"]; ok {
+		return gqlErr
+	}
+
+	var grpcErr interface{ GRPCStatus() *status.Status }
+	if !errors.As(err, &grpcErr) {
+		setExtension(gqlErr, "code", "INTERNAL_SERVER_ERROR")
+		return gqlErr
+	}
+
+	st := grpcErr.GRPCStatus()
+	gqlErr.Message = st.Message()
+	if msg, ok := genericMessages[st.Code()]; ok {
+		gqlErr.Message = msg
+	}
+
+	code, ok := errorCodes[st.Code()]
+	if !ok {
+		code = "INTERNAL_SERVER_ERROR"
+	}
+	setExtension(gqlErr, "code", code)
+
+	for _, detail := range st.Details() {
+		switch d := detail.(type) {
+		case *errdetails.ErrorInfo:
+			setExtension(gqlErr, "reason", d.Reason)
+		case *errdetails.BadRequest:
+			violations := make([]map[string]string, 0, len(d.FieldViolations))
+			for _, v := range d.FieldViolations {
+				violations = append(violations, map[string]string{
+					"field":       v.Field,
+					"description": v.Description,
+				})
+			}
+			setExtension(gqlErr, "fieldViolations", violations)
+		case *errdetails.RetryInfo:
+			setExtension(gqlErr, "retryAfterSeconds", int(math.Ceil(d.RetryDelay.AsDuration().Seconds())))
+		case *errdetails.ResourceInfo:
+			setExtension(gqlErr, "resource", map[string]string{
+				"type": d.ResourceType,
+				"name": d.ResourceName,
+			})
+		}
+	}
+
+	return gqlErr
+}
+
+func setExtension(gqlErr *gqlerror.Error, key string, value interface{}) {
+	if gqlErr.Extensions == nil {
+		gqlErr.Extensions = map[string]interface{}{}
+	}
+	gqlErr.Extensions[key] = value
+}
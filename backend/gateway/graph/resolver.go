@@ -2,9 +2,21 @@ package graph
 
 import (
 	"context"
+	"fmt"
+	"math"
 	"net/http"
 	"net"
+	"slices"
+	"time"
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
 	"github.com/aashiq-04/session-management-system/backend/gateway/clients"
+	"github.com/aashiq-04/session-management-system/backend/gateway/graph/model"
+	"github.com/aashiq-04/session-management-system/backend/gateway/middleware"
+	auditpb "github.com/aashiq-04/session-management-system/backend/gateway/proto/audit"
+	authpb "github.com/aashiq-04/session-management-system/backend/gateway/proto/auth"
+	sessionpb "github.com/aashiq-04/session-management-system/backend/gateway/proto/session"
 )
 func extractRealIP(r *http.Request) string {
     // X-Forwarded-For (proxy)
@@ -37,6 +49,448 @@ func getIPFromContext(ctx context.Context) string {
     return extractRealIP(req)
 }
 
+// notificationPreferencesFromProto maps audit service notification preferences to the GraphQL model
+func notificationPreferencesFromProto(p *auditpb.NotificationPreferences) *model.NotificationPreferences {
+	if p == nil {
+		return nil
+	}
+
+	prefs := &model.NotificationPreferences{
+		EmailEnabled:   p.EmailEnabled,
+		WebhookEnabled: p.WebhookEnabled,
+	}
+	if p.WebhookUrl != "" {
+		prefs.WebhookURL = &p.WebhookUrl
+	}
+	if p.MinSeverity != "" {
+		prefs.MinSeverity = &p.MinSeverity
+	}
+	if p.UpdatedAt != "" {
+		prefs.UpdatedAt = &p.UpdatedAt
+	}
+
+	return prefs
+}
+
+// webhookSubscriptionFromProto maps an audit service webhook subscription to the GraphQL model
+func webhookSubscriptionFromProto(sub *auditpb.WebhookSubscription) *model.WebhookSubscription {
+	if sub == nil {
+		return nil
+	}
+
+	result := &model.WebhookSubscription{
+		ID:              sub.Id,
+		URL:             sub.Url,
+		EventTypes:      sub.EventTypes,
+		EventCategories: sub.EventCategories,
+		IsActive:        sub.IsActive,
+		CreatedAt:       sub.CreatedAt,
+		UpdatedAt:       sub.UpdatedAt,
+	}
+	if result.EventTypes == nil {
+		result.EventTypes = []string{}
+	}
+	if result.EventCategories == nil {
+		result.EventCategories = []string{}
+	}
+	if sub.MinSeverity != "" {
+		result.MinSeverity = &sub.MinSeverity
+	}
+	if sub.Description != "" {
+		result.Description = &sub.Description
+	}
+
+	return result
+}
+
+// auditLogFromProto maps an audit service log entry to the GraphQL model
+func auditLogFromProto(l *auditpb.AuditLog) *model.AuditLog {
+	return &model.AuditLog{
+		ID:              l.Id,
+		UserID:          &l.UserId,
+		SessionID:       &l.SessionId,
+		DeviceID:        &l.DeviceId,
+		EventType:       l.EventType,
+		EventCategory:   l.EventCategory,
+		Severity:        l.Severity,
+		IPAddress:       &l.IpAddress,
+		UserAgent:       &l.UserAgent,
+		LocationCountry: &l.LocationCountry,
+		LocationCity:    &l.LocationCity,
+		Metadata:        &l.Metadata,
+		Success:         l.Success,
+		FailureReason:   &l.FailureReason,
+		CreatedAt:       l.CreatedAt,
+	}
+}
+
+// auditLogFilterToProto maps the GraphQL audit log filter to the audit service filter.
+// Event category and severity are separate request fields, so they're left to the caller.
+func auditLogFilterToProto(filter *model.AuditLogFilter) *auditpb.AuditLogFilter {
+	result := &auditpb.AuditLogFilter{
+		EventTypes: filter.EventTypes,
+		Success:    filter.Success,
+	}
+	if filter.StartTime != nil {
+		result.StartTime = *filter.StartTime
+	}
+	if filter.EndTime != nil {
+		result.EndTime = *filter.EndTime
+	}
+	if filter.IPAddress != nil {
+		result.IpAddress = *filter.IPAddress
+	}
+	if filter.SessionID != nil {
+		result.SessionId = *filter.SessionID
+	}
+	if filter.DeviceID != nil {
+		result.DeviceId = *filter.DeviceID
+	}
+
+	return result
+}
+
+// requirePermission returns the signed-in user if their roles grant
+// permission. The services check the permission again.
+func requirePermission(ctx context.Context, permission string) (*middleware.UserContext, error) {
+	user, ok := middleware.GetUserFromContext(ctx)
+	if !ok {
+		return nil, errUnauthorized
+	}
+	if !user.HasPermission(permission) {
+		return nil, errMissingPermission(permission)
+	}
+	return user, nil
+}
+
+// requireSignedIn returns the signed-in user, refusing requests made with an
+// API token, for things only a person should do
+func requireSignedIn(ctx context.Context) (*middleware.UserContext, error) {
+	user, ok := middleware.GetUserFromContext(ctx)
+	if !ok {
+		return nil, errUnauthorized
+	}
+	if user.TokenID != "" {
+		return nil, errAPITokenNotAllowed
+	}
+	return user, nil
+}
+
+// RequireTokenScopes refuses operations the scopes of the API token they
+// were made with don't allow: queries need read and mutations write
+func RequireTokenScopes(ctx context.Context, next graphql.OperationHandler) graphql.ResponseHandler {
+	user, ok := middleware.GetUserFromContext(ctx)
+	if !ok {
+		return next(ctx)
+	}
+
+	scope := middleware.ScopeRead
+	if op := graphql.GetOperationContext(ctx).Operation; op != nil && op.Operation == ast.Mutation {
+		scope = middleware.ScopeWrite
+	}
+	if !user.HasScope(scope) {
+		return graphql.OneShot(&graphql.Response{
+			Errors: gqlerror.List{ErrorPresenter(ctx, errMissingScope(scope))},
+		})
+	}
+
+	return next(ctx)
+}
+
+// authFactorMethods maps the factors @requiresRecentAuth asks for to the
+// amr values of access tokens that show them
+var authFactorMethods = map[model.AuthFactor]string{
+	model.AuthFactorPassword: middleware.AMRPassword,
+	model.AuthFactorMfa:      middleware.AMRMFA,
+}
+
+// RequiresRecentAuth implements @requiresRecentAuth: the field resolves only
+// for access tokens from a sign-in at most maxAge seconds ago, made with each
+// of factors. Refreshed tokens keep the time of the sign-in, so users who
+// signed in long ago reauthenticate first. MFA is only asked of users who
+// enabled it, as others have no code to give. API tokens and impersonation
+// sessions never qualify.
+func (r *Resolver) RequiresRecentAuth(ctx context.Context, obj any, next graphql.Resolver, maxAge int, factors []model.AuthFactor) (any, error) {
+	user, err := requireSignedIn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if user.ImpersonatorID != "" {
+		return nil, errImpersonating
+	}
+
+	if user.AuthTime.IsZero() || time.Since(user.AuthTime) > time.Duration(maxAge)*time.Second {
+		return nil, errReauthenticationRequired
+	}
+	for _, factor := range factors {
+		if slices.Contains(user.AMR, authFactorMethods[factor]) {
+			continue
+		}
+		if factor == model.AuthFactorMfa {
+			enabled, err := r.mfaEnabled(ctx, user.UserID)
+			if err != nil {
+				return nil, err
+			}
+			if !enabled {
+				continue
+			}
+		}
+		return nil, errReauthenticationRequired
+	}
+
+	return next(ctx)
+}
+
+// mfaEnabled tells whether a user has MFA enabled now, rather than when
+// their token was issued
+func (r *Resolver) mfaEnabled(ctx context.Context, userID string) (bool, error) {
+	resp, err := r.Clients.AuthClient.GetUserProfile(ctx, &authpb.GetUserProfileRequest{UserId: userID})
+	if err != nil {
+		return false, fmt.Errorf("failed to get user profile: %w", err)
+	}
+	return resp.Profile.GetMfaEnabled(), nil
+}
+
+// reauthenticate asks the auth service for a reauthenticated access token
+// for the signed-in user, who proves who they are as req says
+func (r *Resolver) reauthenticate(ctx context.Context, req *authpb.ReauthenticateRequest) (*model.ReauthenticatePayload, error) {
+	user, err := requireSignedIn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if user.ImpersonatorID != "" {
+		return nil, errImpersonating
+	}
+
+	req.UserId = user.UserID
+	req.IpAddress = getIPFromContext(ctx)
+	if httpReq, ok := ctx.Value("httpRequest").(*http.Request); ok && httpReq != nil {
+		req.UserAgent = httpReq.UserAgent()
+	}
+
+	resp, err := r.Clients.AuthClient.Reauthenticate(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reauthenticate: %w", err)
+	}
+
+	return &model.ReauthenticatePayload{
+		Success:     resp.Success,
+		Message:     resp.Message,
+		AccessToken: resp.AccessToken,
+		ExpiresAt:   resp.ExpiresAt,
+		Factors:     authFactorsFromAMR(resp.Amr),
+	}, nil
+}
+
+// authFactorsFromAMR maps amr values to the factors they show, skipping
+// those with no factor such as fed
+func authFactorsFromAMR(amr []string) []model.AuthFactor {
+	factors := make([]model.AuthFactor, 0, len(amr))
+	for _, factor := range model.AllAuthFactor {
+		if slices.Contains(amr, authFactorMethods[factor]) {
+			factors = append(factors, factor)
+		}
+	}
+	return factors
+}
+
+// userFromProto maps an auth service user profile to the GraphQL model
+func userFromProto(p *authpb.UserProfile) *model.User {
+	user := &model.User{
+		ID:          p.Id,
+		Email:       p.Email,
+		FullName:    p.FullName,
+		IsActive:    p.IsActive,
+		MfaEnabled:  p.MfaEnabled,
+		CreatedAt:   p.CreatedAt,
+		UpdatedAt:   p.UpdatedAt,
+		Roles:       p.Roles,
+		Permissions: p.Permissions,
+		DeletedAt:   optionalString(p.DeletedAt),
+
+		DeletionScheduledAt: optionalString(p.DeletionScheduledAt),
+		OrganizationID:      p.OrganizationId,
+	}
+	if user.Roles == nil {
+		user.Roles = []string{}
+	}
+	if user.Permissions == nil {
+		user.Permissions = []string{}
+	}
+
+	return user
+}
+
+// organizationFromProto maps an auth service organization to the GraphQL
+// model
+func organizationFromProto(p *authpb.Organization) *model.Organization {
+	if p == nil {
+		return nil
+	}
+
+	org := &model.Organization{
+		ID:               p.Id,
+		Name:             p.Name,
+		Slug:             p.Slug,
+		MfaRequired:      p.MfaRequired,
+		AllowedCountries: p.AllowedCountries,
+		IPAllowlist:      p.IpAllowlist,
+		CreatedAt:        p.CreatedAt,
+		UpdatedAt:        p.UpdatedAt,
+	}
+	if p.SessionLifetimeSeconds > 0 {
+		lifetime := int(p.SessionLifetimeSeconds)
+		org.SessionLifetimeSeconds = &lifetime
+	}
+	if org.AllowedCountries == nil {
+		org.AllowedCountries = []string{}
+	}
+	if org.IPAllowlist == nil {
+		org.IPAllowlist = []string{}
+	}
+
+	return org
+}
+
+// accessPolicyFromProto maps an auth service access policy to the GraphQL
+// model
+func accessPolicyFromProto(p *authpb.AccessPolicy) *model.AccessPolicy {
+	if p == nil {
+		return nil
+	}
+
+	policy := &model.AccessPolicy{
+		ID:               p.Id,
+		UserID:           optionalString(p.UserId),
+		Name:             p.Name,
+		IPAllowlist:      p.IpAllowlist,
+		IPDenylist:       p.IpDenylist,
+		CountryAllowlist: p.CountryAllowlist,
+		CountryDenylist:  p.CountryDenylist,
+		Action:           p.Action,
+		CreatedBy:        optionalString(p.CreatedBy),
+		CreatedAt:        p.CreatedAt,
+		UpdatedAt:        p.UpdatedAt,
+	}
+	if policy.IPAllowlist == nil {
+		policy.IPAllowlist = []string{}
+	}
+	if policy.IPDenylist == nil {
+		policy.IPDenylist = []string{}
+	}
+	if policy.CountryAllowlist == nil {
+		policy.CountryAllowlist = []string{}
+	}
+	if policy.CountryDenylist == nil {
+		policy.CountryDenylist = []string{}
+	}
+
+	return policy
+}
+
+// sessionFromProto maps a session service session to the GraphQL model
+func sessionFromProto(s *sessionpb.Session) *model.Session {
+	return &model.Session{
+		ID:              s.Id,
+		UserID:          s.UserId,
+		DeviceID:        s.DeviceId,
+		DeviceName:      s.DeviceName,
+		DeviceType:      s.DeviceType,
+		IPAddress:       s.IpAddress,
+		UserAgent:       &s.UserAgent,
+		LocationCountry: &s.LocationCountry,
+		LocationCity:    &s.LocationCity,
+		Latitude:        &s.Latitude,
+		Longitude:       &s.Longitude,
+		IsActive:        s.IsActive,
+		CreatedAt:       s.CreatedAt,
+		LastSeenAt:      s.LastSeenAt,
+		ExpiresAt:       s.ExpiresAt,
+		IsCurrent:       s.IsCurrent,
+		ImpersonatedBy:  optionalString(s.ImpersonatorId),
+	}
+}
+
+// optionalString maps an unset proto string to null
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// oauthClientFromProto maps an auth service OAuth client to the GraphQL model
+func oauthClientFromProto(c *authpb.OAuthClient) *model.OAuthClient {
+	if c == nil {
+		return nil
+	}
+
+	client := &model.OAuthClient{
+		ClientID:             c.ClientId,
+		Name:                 c.Name,
+		RedirectUris:         c.RedirectUris,
+		BackchannelLogoutURI: optionalString(c.BackchannelLogoutUri),
+		Scopes:               c.Scopes,
+		Public:               c.Public,
+		CreatedBy:            optionalString(c.CreatedBy),
+		CreatedAt:            c.CreatedAt,
+	}
+	if client.RedirectUris == nil {
+		client.RedirectUris = []string{}
+	}
+	if client.Scopes == nil {
+		client.Scopes = []string{}
+	}
+
+	return client
+}
+
+// samlConnectionResponseFromProto maps an auth service SAML connection
+// response to the GraphQL model
+func samlConnectionResponseFromProto(resp *authpb.SAMLConnectionResponse) *model.SAMLConnectionResponse {
+	result := &model.SAMLConnectionResponse{
+		Success:       resp.Success,
+		Message:       resp.Message,
+		SpEntityID:    resp.SpEntityId,
+		SpAcsURL:      resp.SpAcsUrl,
+		SpMetadataURL: resp.SpMetadataUrl,
+	}
+	if c := resp.Connection; c != nil {
+		result.Connection = &model.SAMLConnection{
+			IdpEntityID:     c.IdpEntityId,
+			IdpSsoURL:       c.IdpSsoUrl,
+			IdpCertificate:  c.IdpCertificate,
+			EmailAttribute:  optionalString(c.EmailAttribute),
+			NameAttribute:   optionalString(c.NameAttribute),
+			JitProvisioning: c.JitProvisioning,
+			Enabled:         c.Enabled,
+			CreatedBy:       optionalString(c.CreatedBy),
+			CreatedAt:       c.CreatedAt,
+			UpdatedAt:       c.UpdatedAt,
+		}
+	}
+
+	return result
+}
+
+// securityAlertFromProto maps an audit service security alert to the GraphQL model
+func securityAlertFromProto(a *auditpb.SecurityAlert) *model.SecurityAlert {
+	return &model.SecurityAlert{
+		ID:              a.Id,
+		UserID:          a.UserId,
+		AlertType:       a.AlertType,
+		Severity:        a.Severity,
+		Description:     a.Description,
+		Metadata:        &a.Metadata,
+		IPAddress:       &a.IpAddress,
+		LocationCountry: &a.LocationCountry,
+		LocationCity:    &a.LocationCity,
+		IsResolved:      a.IsResolved,
+		ResolvedAt:      &a.ResolvedAt,
+		CreatedAt:       a.CreatedAt,
+	}
+}
+
 // Resolver is the main resolver that holds all dependencies
 type Resolver struct {
 	Clients   *clients.GRPCClients
@@ -49,4 +503,57 @@ func NewResolver(clients *clients.GRPCClients, jwtSecret string) *Resolver {
 		Clients:   clients,
 		JWTSecret: jwtSecret,
 	}
-}
\ No newline at end of file
+}
+
+// expiresInDays maps an optional API token lifetime, where zero takes the
+// default. Values that don't fit are passed as -1 for the service to refuse.
+func expiresInDays(days *int) int32 {
+	if days == nil {
+		return 0
+	}
+	if *days < math.MinInt32 || *days > math.MaxInt32 {
+		return -1
+	}
+	return int32(*days)
+}
+
+// apiTokenFromProto maps an auth service API token to the GraphQL model
+func apiTokenFromProto(t *authpb.APIToken) *model.APIToken {
+	if t == nil {
+		return nil
+	}
+
+	token := &model.APIToken{
+		ID:         t.Id,
+		Kind:       t.Kind,
+		UserID:     t.UserId,
+		Name:       t.Name,
+		Prefix:     t.Prefix,
+		Scopes:     t.Scopes,
+		ExpiresAt:  t.ExpiresAt,
+		LastUsedAt: optionalString(t.LastUsedAt),
+		LastUsedIP: optionalString(t.LastUsedIp),
+		RevokedAt:  optionalString(t.RevokedAt),
+		CreatedAt:  t.CreatedAt,
+	}
+	if token.Scopes == nil {
+		token.Scopes = []string{}
+	}
+
+	return token
+}
+
+// apiTokensResponseFromProto maps an auth service API token listing to the
+// GraphQL model
+func apiTokensResponseFromProto(resp *authpb.ListAPITokensResponse) *model.APITokensResponse {
+	tokens := make([]*model.APIToken, len(resp.Tokens))
+	for i, t := range resp.Tokens {
+		tokens[i] = apiTokenFromProto(t)
+	}
+
+	return &model.APITokensResponse{
+		Success: resp.Success,
+		Message: resp.Message,
+		Tokens:  tokens,
+	}
+}
@@ -0,0 +1,277 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"github.com/aashiq-04/session-management-system/backend/gateway/clients"
+	"github.com/aashiq-04/session-management-system/backend/gateway/graph/generated"
+	"github.com/aashiq-04/session-management-system/backend/gateway/graph/model"
+	"github.com/aashiq-04/session-management-system/backend/gateway/middleware"
+	authpb "github.com/aashiq-04/session-management-system/backend/gateway/proto/auth"
+)
+
+// fakeAuthClient answers the auth service calls made by the step-up
+// resolvers and records them
+type fakeAuthClient struct {
+	authpb.AuthServiceClient
+
+	mfaEnabled   bool
+	profileErr   error
+	profileCalls int
+
+	reauthenticate *authpb.ReauthenticateRequest
+	startReauth    *authpb.StartFederatedReauthenticationRequest
+}
+
+func (c *fakeAuthClient) GetUserProfile(ctx context.Context, req *authpb.GetUserProfileRequest, opts ...grpc.CallOption) (*authpb.GetUserProfileResponse, error) {
+	c.profileCalls++
+	if c.profileErr != nil {
+		return nil, c.profileErr
+	}
+	return &authpb.GetUserProfileResponse{Success: true, Profile: &authpb.UserProfile{Id: req.UserId, MfaEnabled: c.mfaEnabled}}, nil
+}
+
+func (c *fakeAuthClient) Reauthenticate(ctx context.Context, req *authpb.ReauthenticateRequest, opts ...grpc.CallOption) (*authpb.ReauthenticateResponse, error) {
+	c.reauthenticate = req
+	return &authpb.ReauthenticateResponse{Success: true, AccessToken: "token", Amr: []string{middleware.AMRFederated}}, nil
+}
+
+func (c *fakeAuthClient) StartFederatedReauthentication(ctx context.Context, req *authpb.StartFederatedReauthenticationRequest, opts ...grpc.CallOption) (*authpb.StartFederatedReauthenticationResponse, error) {
+	c.startReauth = req
+	return &authpb.StartFederatedReauthenticationResponse{Success: true, AuthorizationUrl: "https://idp.example.com/authorize", State: "state-1"}, nil
+}
+
+func newTestResolver(auth *fakeAuthClient) *Resolver {
+	return NewResolver(&clients.GRPCClients{AuthClient: auth}, "secret")
+}
+
+func withUser(user *middleware.UserContext) context.Context {
+	return context.WithValue(context.Background(), middleware.UserContextKey, user)
+}
+
+func TestRequiresRecentAuth(t *testing.T) {
+	recent := time.Now().Add(-time.Minute)
+	stale := time.Now().Add(-10 * time.Minute)
+	mfa := []model.AuthFactor{model.AuthFactorMfa}
+
+	tests := []struct {
+		name         string
+		user         *middleware.UserContext // nil when signed out
+		factors      []model.AuthFactor
+		mfaEnabled   bool
+		want         error // nil when the field resolves
+		profileCalls int
+	}{
+		{
+			name: "signed out",
+			want: errUnauthorized,
+		},
+		{
+			name: "API token",
+			user: &middleware.UserContext{UserID: "user-1", TokenID: "token-1"},
+			want: errAPITokenNotAllowed,
+		},
+		{
+			name: "impersonation",
+			user: &middleware.UserContext{UserID: "user-1", ImpersonatorID: "admin-1"},
+			want: errImpersonating,
+		},
+		{
+			name: "recent password sign-in",
+			user: &middleware.UserContext{UserID: "user-1", AuthTime: recent, AMR: []string{middleware.AMRPassword}},
+		},
+		{
+			name: "stale sign-in",
+			user: &middleware.UserContext{UserID: "user-1", AuthTime: stale, AMR: []string{middleware.AMRPassword, middleware.AMRMFA}},
+			want: errReauthenticationRequired,
+		},
+		{
+			name: "no auth time",
+			user: &middleware.UserContext{UserID: "user-1", AMR: []string{middleware.AMRPassword}},
+			want: errReauthenticationRequired,
+		},
+		{
+			name:    "MFA given",
+			user:    &middleware.UserContext{UserID: "user-1", AuthTime: recent, AMR: []string{middleware.AMRPassword, middleware.AMRMFA}},
+			factors: mfa,
+		},
+		{
+			name:         "MFA not enabled",
+			user:         &middleware.UserContext{UserID: "user-1", AuthTime: recent, AMR: []string{middleware.AMRPassword}},
+			factors:      mfa,
+			profileCalls: 1,
+		},
+		{
+			name:         "MFA enabled but not given",
+			user:         &middleware.UserContext{UserID: "user-1", AuthTime: recent, AMR: []string{middleware.AMRPassword}},
+			factors:      mfa,
+			mfaEnabled:   true,
+			want:         errReauthenticationRequired,
+			profileCalls: 1,
+		},
+		{
+			name:         "federated sign-in without MFA",
+			user:         &middleware.UserContext{UserID: "user-1", AuthTime: recent, AMR: []string{middleware.AMRFederated}},
+			factors:      mfa,
+			profileCalls: 1,
+		},
+		{
+			name:         "federated sign-in, MFA enabled but not given",
+			user:         &middleware.UserContext{UserID: "user-1", AuthTime: recent, AMR: []string{middleware.AMRFederated}},
+			factors:      mfa,
+			mfaEnabled:   true,
+			want:         errReauthenticationRequired,
+			profileCalls: 1,
+		},
+		{
+			name:       "federated sign-in with MFA",
+			user:       &middleware.UserContext{UserID: "user-1", AuthTime: recent, AMR: []string{middleware.AMRFederated, middleware.AMRMFA}},
+			factors:    mfa,
+			mfaEnabled: true,
+		},
+		{
+			name:    "stale federated sign-in",
+			user:    &middleware.UserContext{UserID: "user-1", AuthTime: stale, AMR: []string{middleware.AMRFederated}},
+			factors: mfa,
+			want:    errReauthenticationRequired,
+		},
+		{
+			// MFA doesn't stand in for the password
+			name:         "password factor after a federated sign-in",
+			user:         &middleware.UserContext{UserID: "user-1", AuthTime: recent, AMR: []string{middleware.AMRFederated, middleware.AMRMFA}},
+			factors:      []model.AuthFactor{model.AuthFactorPassword},
+			mfaEnabled:   true,
+			want:         errReauthenticationRequired,
+			profileCalls: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth := &fakeAuthClient{mfaEnabled: tt.mfaEnabled}
+			r := newTestResolver(auth)
+
+			ctx := context.Background()
+			if tt.user != nil {
+				ctx = withUser(tt.user)
+			}
+			resolved := false
+			_, err := r.RequiresRecentAuth(ctx, nil, func(ctx context.Context) (any, error) {
+				resolved = true
+				return "ok", nil
+			}, 300, tt.factors)
+
+			if !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+			if resolved != (tt.want == nil) {
+				t.Errorf("field resolved = %v, want %v", resolved, tt.want == nil)
+			}
+			if auth.profileCalls != tt.profileCalls {
+				t.Errorf("profile looked up %d times, want %d", auth.profileCalls, tt.profileCalls)
+			}
+		})
+	}
+}
+
+// Whether MFA is enabled can't be told, so the field doesn't resolve
+func TestRequiresRecentAuthProfileUnavailable(t *testing.T) {
+	auth := &fakeAuthClient{profileErr: errors.New("unavailable")}
+	r := newTestResolver(auth)
+	ctx := withUser(&middleware.UserContext{UserID: "user-1", AuthTime: time.Now(), AMR: []string{middleware.AMRPassword}})
+
+	_, err := r.RequiresRecentAuth(ctx, nil, func(ctx context.Context) (any, error) {
+		t.Error("field resolved")
+		return nil, nil
+	}, 300, []model.AuthFactor{model.AuthFactorMfa})
+	if err == nil {
+		t.Error("no error when the profile couldn't be looked up")
+	}
+}
+
+func TestFederatedReauthentication(t *testing.T) {
+	auth := &fakeAuthClient{}
+	r := &mutationResolver{newTestResolver(auth)}
+	ctx := withUser(&middleware.UserContext{UserID: "user-1", AuthTime: time.Now().Add(-time.Hour), AMR: []string{middleware.AMRFederated}})
+
+	start, err := r.StartFederatedReauthentication(ctx, "corp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if auth.startReauth.UserId != "user-1" || auth.startReauth.Provider != "corp" {
+		t.Errorf("started reauthentication with %+v", auth.startReauth)
+	}
+	if *start.AuthorizationURL != "https://idp.example.com/authorize" || *start.State != "state-1" {
+		t.Errorf("unexpected start %+v", start)
+	}
+
+	code := "code-1"
+	payload, err := r.CompleteFederatedReauthentication(ctx, "corp", "state-1", &code, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := auth.reauthenticate
+	if req.UserId != "user-1" || req.Provider != "corp" || req.State != "state-1" || req.Code != "code-1" || req.Password != "" {
+		t.Errorf("reauthenticated with %+v", req)
+	}
+	if payload.AccessToken != "token" {
+		t.Errorf("access token = %q, want token", payload.AccessToken)
+	}
+
+	// An admin signed in as the user can't prove they are the user
+	impersonating := withUser(&middleware.UserContext{UserID: "user-1", ImpersonatorID: "admin-1"})
+	if _, err := r.StartFederatedReauthentication(impersonating, "corp"); !errors.Is(err, errImpersonating) {
+		t.Errorf("start while impersonating: err = %v, want %v", err, errImpersonating)
+	}
+	if _, err := r.CompleteFederatedReauthentication(impersonating, "corp", "state-1", &code, nil); !errors.Is(err, errImpersonating) {
+		t.Errorf("complete while impersonating: err = %v, want %v", err, errImpersonating)
+	}
+}
+
+// Mutations that mint credentials, change who can sign in, or take over or
+// remove an account need a recent sign-in
+func TestSensitiveMutationsRequireRecentAuth(t *testing.T) {
+	want := map[string][]string{
+		"enableMFA":            nil,
+		"revokeAllSessions":    nil,
+		"adminDisableUser":     nil,
+		"adminDeleteUser":      nil,
+		"adminImpersonateUser": nil,
+		"trustDevice":          {"MFA"},
+		"createAPIToken":       {"MFA"},
+		"createAPIKey":         {"MFA"},
+		"createOAuthClient":    {"MFA"},
+		"updateSAMLConnection": {"MFA"},
+	}
+
+	schema := generated.NewExecutableSchema(generated.Config{Resolvers: &Resolver{}}).Schema()
+	for name, factors := range want {
+		field := schema.Mutation.Fields.ForName(name)
+		if field == nil {
+			t.Errorf("mutation %s not found", name)
+			continue
+		}
+		directive := field.Directives.ForName("requiresRecentAuth")
+		if directive == nil {
+			t.Errorf("%s has no @requiresRecentAuth", name)
+			continue
+		}
+		if maxAge := directive.Arguments.ForName("maxAge"); maxAge == nil || maxAge.Value.Raw != "300" {
+			t.Errorf("%s: maxAge isn't 300", name)
+		}
+		var got []string
+		if arg := directive.Arguments.ForName("factors"); arg != nil {
+			for _, child := range arg.Value.Children {
+				got = append(got, child.Value.Raw)
+			}
+		}
+		if !slices.Equal(got, factors) {
+			t.Errorf("%s: factors = %v, want %v", name, got, factors)
+		}
+	}
+}
@@ -121,11 +121,23 @@ func (r *mutationResolver) Login(ctx context.Context, input model.LoginInput) (*
 		mfaCode = *input.MfaCode
 	}
 
+	rememberDevice := false
+	if input.RememberDevice != nil {
+		rememberDevice = *input.RememberDevice
+	}
+
+	deviceTrustToken := ""
+	if input.DeviceTrustToken != nil {
+		deviceTrustToken = *input.DeviceTrustToken
+	}
+
 	resp, err := r.Clients.AuthClient.Login(ctx, &authpb.LoginRequest{
-		Email:      input.Email,
-		Password:   input.Password,
-		DeviceInfo: deviceInfo,
-		MfaCode:    mfaCode,
+		Email:            input.Email,
+		Password:         input.Password,
+		DeviceInfo:       deviceInfo,
+		MfaCode:          mfaCode,
+		RememberDevice:   rememberDevice,
+		DeviceTrustToken: deviceTrustToken,
 	})
 
 	if err != nil {
@@ -135,13 +147,14 @@ func (r *mutationResolver) Login(ctx context.Context, input model.LoginInput) (*
 	mfaRequired := resp.MfaRequired
 
 	return &model.AuthPayload{
-		Success:      resp.Success,
-		Message:      resp.Message,
-		UserID:       &resp.UserId,
-		AccessToken:  &resp.AccessToken,
-		RefreshToken: &resp.RefreshToken,
-		MfaRequired:  &mfaRequired,
-		SessionID:    &resp.SessionId,
+		Success:          resp.Success,
+		Message:          resp.Message,
+		UserID:           &resp.UserId,
+		AccessToken:      &resp.AccessToken,
+		RefreshToken:     &resp.RefreshToken,
+		MfaRequired:      &mfaRequired,
+		SessionID:        &resp.SessionId,
+		DeviceTrustToken: &resp.DeviceTrustToken,
 	}, nil
 }
 
@@ -149,6 +162,7 @@ func (r *mutationResolver) Login(ctx context.Context, input model.LoginInput) (*
 func (r *mutationResolver) RefreshToken(ctx context.Context, refreshToken string) (*model.AuthPayload, error) {
 	resp, err := r.Clients.AuthClient.RefreshToken(ctx, &authpb.RefreshTokenRequest{
 		RefreshToken: refreshToken,
+		IpAddress:    getIPFromContext(ctx),
 	})
 
 	if err != nil {
@@ -163,6 +177,134 @@ func (r *mutationResolver) RefreshToken(ctx context.Context, refreshToken string
 	}, nil
 }
 
+// StartFederatedLogin starts signing in with an identity provider
+func (r *mutationResolver) StartFederatedLogin(ctx context.Context, provider string) (*model.FederatedLoginStart, error) {
+	resp, err := r.Clients.AuthClient.StartFederatedLogin(ctx, &authpb.StartFederatedLoginRequest{
+		Provider: provider,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to start federated login: %w", err)
+	}
+
+	return &model.FederatedLoginStart{
+		Success:          resp.Success,
+		Message:          resp.Message,
+		AuthorizationURL: &resp.AuthorizationUrl,
+		State:            &resp.State,
+	}, nil
+}
+
+// CompleteFederatedLogin finishes signing in with an identity provider
+func (r *mutationResolver) CompleteFederatedLogin(ctx context.Context, input model.CompleteFederatedLoginInput) (*model.AuthPayload, error) {
+	deviceInfo := &authpb.DeviceInfo{
+		DeviceFingerprint: input.DeviceInfo.DeviceFingerprint,
+		DeviceName:        input.DeviceInfo.DeviceName,
+		DeviceType:        input.DeviceInfo.DeviceType,
+		Os:                input.DeviceInfo.Os,
+		Browser:           input.DeviceInfo.Browser,
+		IpAddress:         getIPFromContext(ctx),
+		UserAgent:         input.DeviceInfo.UserAgent,
+		LocationCountry:   strPtrToVal(input.DeviceInfo.LocationCountry),
+		LocationCity:      strPtrToVal(input.DeviceInfo.LocationCity),
+		Latitude:          floatPtrToVal(input.DeviceInfo.Latitude),
+		Longitude:         floatPtrToVal(input.DeviceInfo.Longitude),
+	}
+
+	rememberDevice := false
+	if input.RememberDevice != nil {
+		rememberDevice = *input.RememberDevice
+	}
+
+	resp, err := r.Clients.AuthClient.CompleteFederatedLogin(ctx, &authpb.CompleteFederatedLoginRequest{
+		Provider:         input.Provider,
+		State:            input.State,
+		Code:             strPtrToVal(input.Code),
+		DeviceInfo:       deviceInfo,
+		MfaCode:          strPtrToVal(input.MfaCode),
+		RememberDevice:   rememberDevice,
+		DeviceTrustToken: strPtrToVal(input.DeviceTrustToken),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to complete federated login: %w", err)
+	}
+
+	mfaRequired := resp.MfaRequired
+
+	return &model.AuthPayload{
+		Success:          resp.Success,
+		Message:          resp.Message,
+		UserID:           &resp.UserId,
+		AccessToken:      &resp.AccessToken,
+		RefreshToken:     &resp.RefreshToken,
+		MfaRequired:      &mfaRequired,
+		SessionID:        &resp.SessionId,
+		DeviceTrustToken: &resp.DeviceTrustToken,
+	}, nil
+}
+
+// StartSAMLLogin returns the URL that sends the user to their
+// organization's SAML identity provider
+func (r *mutationResolver) StartSAMLLogin(ctx context.Context, organization string) (*model.SAMLLoginStart, error) {
+	resp, err := r.Clients.AuthClient.StartSAMLLogin(ctx, &authpb.StartSAMLLoginRequest{
+		Organization: organization,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to start SAML login: %w", err)
+	}
+
+	return &model.SAMLLoginStart{
+		Success:     resp.Success,
+		Message:     resp.Message,
+		RedirectURL: &resp.RedirectUrl,
+		Provider:    &resp.Provider,
+		State:       &resp.State,
+	}, nil
+}
+
+// Reauthenticate confirms the current user's password, and MFA code if enabled, for a short-lived access token that allows mutations marked with @requiresRecentAuth
+func (r *mutationResolver) Reauthenticate(ctx context.Context, password string, mfaCode *string) (*model.ReauthenticatePayload, error) {
+	return r.reauthenticate(ctx, &authpb.ReauthenticateRequest{
+		Password: password,
+		MfaCode:  strPtrToVal(mfaCode),
+	})
+}
+
+// StartFederatedReauthentication sends the current user back to their identity provider to sign in again
+func (r *mutationResolver) StartFederatedReauthentication(ctx context.Context, provider string) (*model.FederatedLoginStart, error) {
+	user, err := requireSignedIn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if user.ImpersonatorID != "" {
+		return nil, errImpersonating
+	}
+
+	resp, err := r.Clients.AuthClient.StartFederatedReauthentication(ctx, &authpb.StartFederatedReauthenticationRequest{
+		UserId:   user.UserID,
+		Provider: provider,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to start reauthentication: %w", err)
+	}
+
+	return &model.FederatedLoginStart{
+		Success:          resp.Success,
+		Message:          resp.Message,
+		AuthorizationURL: &resp.AuthorizationUrl,
+		State:            &resp.State,
+	}, nil
+}
+
+// CompleteFederatedReauthentication confirms the current user signed in again with their identity provider, and their MFA code if enabled, for a short-lived access token that allows mutations marked with @requiresRecentAuth
+func (r *mutationResolver) CompleteFederatedReauthentication(ctx context.Context, provider string, state string, code *string, mfaCode *string) (*model.ReauthenticatePayload, error) {
+	return r.reauthenticate(ctx, &authpb.ReauthenticateRequest{
+		Provider: provider,
+		State:    state,
+		Code:     strPtrToVal(code),
+		MfaCode:  strPtrToVal(mfaCode),
+	})
+}
+
 // EnableMfa is the resolver for the enableMFA field.
 func (r *mutationResolver) EnableMfa(ctx context.Context) (*model.MFASetup, error) {
 	panic(fmt.Errorf("not implemented: EnableMfa - enableMFA"))
@@ -177,7 +319,7 @@ func (r *mutationResolver) VerifyMfa(ctx context.Context, code string) (*model.G
 func (r *mutationResolver) RevokeSession(ctx context.Context, sessionID string) (*model.GenericResponse, error) {
 	user, ok := middleware.GetUserFromContext(ctx)
 	if !ok {
-		return nil, fmt.Errorf("unauthorized")
+		return nil, errUnauthorized
 	}
 
 	resp, err := r.Clients.SessionClient.RevokeSession(ctx, &sessionpb.RevokeSessionRequest{
@@ -201,7 +343,7 @@ func (r *mutationResolver) RevokeSession(ctx context.Context, sessionID string)
 func (r *mutationResolver) RevokeAllSessions(ctx context.Context, exceptCurrent *bool) (*model.GenericResponse, error) {
 	user, ok := middleware.GetUserFromContext(ctx)
 	if !ok {
-		return nil, fmt.Errorf("unauthorized")
+		return nil, errUnauthorized
 	}
 
 	exceptCurrentValue := false
@@ -238,7 +380,7 @@ func (r *mutationResolver) RevokeAllSessions(ctx context.Context, exceptCurrent
 func (r *mutationResolver) TrustDevice(ctx context.Context, deviceID string) (*model.GenericResponse, error) {
 	user, ok := middleware.GetUserFromContext(ctx)
 	if !ok {
-		return nil, fmt.Errorf("unauthorized")
+		return nil, errUnauthorized
 	}
 
 	resp, err := r.Clients.SessionClient.TrustDevice(ctx, &sessionpb.TrustDeviceRequest{
@@ -256,20 +398,20 @@ func (r *mutationResolver) TrustDevice(ctx context.Context, deviceID string) (*m
 	}, nil
 }
 
-// ResolveSecurityAlert marks a security alert as resolved
-func (r *mutationResolver) ResolveSecurityAlert(ctx context.Context, alertID string) (*model.GenericResponse, error) {
+// UntrustDevice removes trust from a device
+func (r *mutationResolver) UntrustDevice(ctx context.Context, deviceID string) (*model.GenericResponse, error) {
 	user, ok := middleware.GetUserFromContext(ctx)
 	if !ok {
-		return nil, fmt.Errorf("unauthorized")
+		return nil, errUnauthorized
 	}
 
-	resp, err := r.Clients.AuditClient.ResolveSecurityAlert(ctx, &auditpb.ResolveSecurityAlertRequest{
-		AlertId: alertID,
-		UserId:  user.UserID,
+	resp, err := r.Clients.SessionClient.UntrustDevice(ctx, &sessionpb.UntrustDeviceRequest{
+		DeviceId: deviceID,
+		UserId:   user.UserID,
 	})
 
 	if err != nil {
-		return nil, fmt.Errorf("failed to resolve security alert: %w", err)
+		return nil, fmt.Errorf("failed to untrust device: %w", err)
 	}
 
 	return &model.GenericResponse{
@@ -278,306 +420,1156 @@ func (r *mutationResolver) ResolveSecurityAlert(ctx context.Context, alertID str
 	}, nil
 }
 
-// Me returns the current user's profile
-func (r *queryResolver) Me(ctx context.Context) (*model.User, error) {
+// RenameDevice changes the display name of a device
+func (r *mutationResolver) RenameDevice(ctx context.Context, deviceID string, name string) (*model.GenericResponse, error) {
 	user, ok := middleware.GetUserFromContext(ctx)
 	if !ok {
-		return nil, fmt.Errorf("unauthorized")
+		return nil, errUnauthorized
 	}
 
-	resp, err := r.Clients.AuthClient.GetUserProfile(ctx, &authpb.GetUserProfileRequest{
-		UserId: user.UserID,
+	resp, err := r.Clients.SessionClient.RenameDevice(ctx, &sessionpb.RenameDeviceRequest{
+		DeviceId:   deviceID,
+		UserId:     user.UserID,
+		DeviceName: name,
 	})
 
 	if err != nil {
-		return nil, fmt.Errorf("failed to get user profile: %w", err)
+		return nil, fmt.Errorf("failed to rename device: %w", err)
 	}
 
-	if !resp.Success {
-		return nil, fmt.Errorf(resp.Message)
-	}
-
-	return &model.User{
-		ID:         resp.Profile.Id,
-		Email:      resp.Profile.Email,
-		FullName:   resp.Profile.FullName,
-		IsActive:   resp.Profile.IsActive,
-		MfaEnabled: resp.Profile.MfaEnabled,
-		CreatedAt:  resp.Profile.CreatedAt,
-		UpdatedAt:  resp.Profile.UpdatedAt,
+	return &model.GenericResponse{
+		Success: resp.Success,
+		Message: resp.Message,
 	}, nil
 }
 
-// ValidateToken validates a JWT token
-func (r *queryResolver) ValidateToken(ctx context.Context, token string) (*model.TokenValidationResponse, error) {
-	resp, err := r.Clients.AuthClient.ValidateToken(ctx, &authpb.ValidateTokenRequest{
-		Token: token,
+// RemoveDevice forgets a device and revokes all of its sessions
+func (r *mutationResolver) RemoveDevice(ctx context.Context, deviceID string) (*model.GenericResponse, error) {
+	user, ok := middleware.GetUserFromContext(ctx)
+	if !ok {
+		return nil, errUnauthorized
+	}
+
+	resp, err := r.Clients.SessionClient.RemoveDevice(ctx, &sessionpb.RemoveDeviceRequest{
+		DeviceId:    deviceID,
+		UserId:      user.UserID,
+		RevokedByIp: getIPFromContext(ctx),
 	})
 
 	if err != nil {
-		return nil, fmt.Errorf("failed to validate token: %w", err)
+		return nil, fmt.Errorf("failed to remove device: %w", err)
 	}
 
-	return &model.TokenValidationResponse{
-		Valid:   resp.Valid,
-		UserID:  &resp.UserId,
-		Email:   &resp.Email,
+	return &model.GenericResponse{
+		Success: resp.Success,
 		Message: resp.Message,
 	}, nil
 }
 
-// Sessions returns all sessions for the current user
-func (r *queryResolver) Sessions(ctx context.Context, includeInactive *bool) (*model.SessionsResponse, error) {
+// ResolveSecurityAlert marks a security alert as resolved
+func (r *mutationResolver) ResolveSecurityAlert(ctx context.Context, alertID string) (*model.GenericResponse, error) {
 	user, ok := middleware.GetUserFromContext(ctx)
 	if !ok {
-		return nil, fmt.Errorf("unauthorized")
-	}
-
-	includeInactiveValue := false
-	if includeInactive != nil {
-		includeInactiveValue = *includeInactive
+		return nil, errUnauthorized
 	}
 
-	resp, err := r.Clients.SessionClient.GetUserSessions(ctx, &sessionpb.GetUserSessionsRequest{
-		UserId:          user.UserID,
-		IncludeInactive: includeInactiveValue,
+	resp, err := r.Clients.AuditClient.ResolveSecurityAlert(ctx, &auditpb.ResolveSecurityAlertRequest{
+		AlertId: alertID,
+		UserId:  user.UserID,
 	})
 
 	if err != nil {
-		return nil, fmt.Errorf("failed to get sessions: %w", err)
-	}
-
-	sessions := make([]*model.Session, len(resp.Sessions))
-	for i, s := range resp.Sessions {
-		sessions[i] = &model.Session{
-			ID:              s.Id,
-			UserID:          s.UserId,
-			DeviceID:        s.DeviceId,
-			DeviceName:      s.DeviceName,
-			DeviceType:      s.DeviceType,
-			IPAddress:       s.IpAddress,
-			UserAgent:       &s.UserAgent,
-			LocationCountry: &s.LocationCountry,
-			LocationCity:    &s.LocationCity,
-			Latitude:        &s.Latitude,
-			Longitude:       &s.Longitude,
-			IsActive:        s.IsActive,
-			CreatedAt:       s.CreatedAt,
-			LastSeenAt:      s.LastSeenAt,
-			ExpiresAt:       s.ExpiresAt,
-			IsCurrent:       s.IsCurrent,
-		}
+		return nil, fmt.Errorf("failed to resolve security alert: %w", err)
 	}
 
-	totalCount := int(resp.TotalCount)
-	activeCount := int(resp.ActiveCount)
-
-	return &model.SessionsResponse{
-		Success:     resp.Success,
-		Message:     resp.Message,
-		Sessions:    sessions,
-		TotalCount:  totalCount,
-		ActiveCount: activeCount,
+	return &model.GenericResponse{
+		Success: resp.Success,
+		Message: resp.Message,
 	}, nil
 }
 
-// SessionDetails returns details of a specific session
-func (r *queryResolver) SessionDetails(ctx context.Context, sessionID string) (*model.Session, error) {
+// UpdateNotificationPreferences saves how the current user is notified about security alerts
+func (r *mutationResolver) UpdateNotificationPreferences(ctx context.Context, input model.NotificationPreferencesInput) (*model.NotificationPreferencesResponse, error) {
 	user, ok := middleware.GetUserFromContext(ctx)
 	if !ok {
-		return nil, fmt.Errorf("unauthorized")
+		return nil, errUnauthorized
 	}
 
-	resp, err := r.Clients.SessionClient.GetSessionDetails(ctx, &sessionpb.GetSessionDetailsRequest{
-		SessionId: sessionID,
-		UserId:    user.UserID,
-	})
-
-	if err != nil {
-		return nil, fmt.Errorf("failed to get session details: %w", err)
+	webhookURL := ""
+	if input.WebhookURL != nil {
+		webhookURL = *input.WebhookURL
 	}
 
-	if !resp.Success || resp.Session == nil {
-		return nil, fmt.Errorf(resp.Message)
+	webhookSecret := ""
+	if input.WebhookSecret != nil {
+		webhookSecret = *input.WebhookSecret
 	}
 
-	s := resp.Session
-	return &model.Session{
-		ID:              s.Id,
-		UserID:          s.UserId,
-		DeviceID:        s.DeviceId,
-		DeviceName:      s.DeviceName,
-		DeviceType:      s.DeviceType,
-		IPAddress:       s.IpAddress,
-		UserAgent:       &s.UserAgent,
-		LocationCountry: &s.LocationCountry,
-		LocationCity:    &s.LocationCity,
-		Latitude:        &s.Latitude,
-		Longitude:       &s.Longitude,
-		IsActive:        s.IsActive,
-		CreatedAt:       s.CreatedAt,
-		LastSeenAt:      s.LastSeenAt,
-		ExpiresAt:       s.ExpiresAt,
-		IsCurrent:       s.IsCurrent,
-	}, nil
-}
-
-// SessionStats returns session statistics
-func (r *queryResolver) SessionStats(ctx context.Context) (*model.SessionStats, error) {
-	user, ok := middleware.GetUserFromContext(ctx)
-	if !ok {
-		return nil, fmt.Errorf("unauthorized")
+	minSeverity := ""
+	if input.MinSeverity != nil {
+		minSeverity = *input.MinSeverity
 	}
 
-	resp, err := r.Clients.SessionClient.GetSessionStats(ctx, &sessionpb.GetSessionStatsRequest{
-		UserId: user.UserID,
+	resp, err := r.Clients.AuditClient.UpdateNotificationPreferences(ctx, &auditpb.UpdateNotificationPreferencesRequest{
+		UserId:         user.UserID,
+		EmailEnabled:   input.EmailEnabled,
+		WebhookEnabled: input.WebhookEnabled,
+		WebhookUrl:     webhookURL,
+		WebhookSecret:  webhookSecret,
+		MinSeverity:    minSeverity,
 	})
 
 	if err != nil {
-		return nil, fmt.Errorf("failed to get session stats: %w", err)
+		return nil, fmt.Errorf("failed to update notification preferences: %w", err)
 	}
 
-	return &model.SessionStats{
-		TotalSessions:     int(resp.TotalSessions),
-		ActiveSessions:    int(resp.ActiveSessions),
-		TotalDevices:      int(resp.TotalDevices),
-		TrustedDevices:    int(resp.TrustedDevices),
-		LastLogin:         &resp.LastLogin,
-		LastLoginLocation: &resp.LastLoginLocation,
-		RecentLocations:   resp.RecentLocations,
-	}, nil
+	result := &model.NotificationPreferencesResponse{
+		Success:     resp.Success,
+		Message:     resp.Message,
+		Preferences: notificationPreferencesFromProto(resp.Preferences),
+	}
+	if resp.WebhookSecret != "" {
+		result.WebhookSecret = &resp.WebhookSecret
+	}
+
+	return result, nil
 }
 
-// Devices returns all devices for the current user
-func (r *queryResolver) Devices(ctx context.Context) (*model.DevicesResponse, error) {
+// CreateWebhookSubscription subscribes a URL to the current user's audit events
+func (r *mutationResolver) CreateWebhookSubscription(ctx context.Context, input model.WebhookSubscriptionInput) (*model.WebhookSubscriptionResponse, error) {
 	user, ok := middleware.GetUserFromContext(ctx)
 	if !ok {
-		return nil, fmt.Errorf("unauthorized")
+		return nil, errUnauthorized
 	}
 
-	resp, err := r.Clients.SessionClient.GetUserDevices(ctx, &sessionpb.GetUserDevicesRequest{
-		UserId: user.UserID,
-	})
-
-	if err != nil {
-		return nil, fmt.Errorf("failed to get devices: %w", err)
+	minSeverity := ""
+	if input.MinSeverity != nil {
+		minSeverity = *input.MinSeverity
 	}
 
-	devices := make([]*model.Device, len(resp.Devices))
-	for i, d := range resp.Devices {
-		devices[i] = &model.Device{
-			ID:                d.Id,
-			UserID:            d.UserId,
-			DeviceFingerprint: d.DeviceFingerprint,
-			DeviceName:        d.DeviceName,
-			DeviceType:        d.DeviceType,
-			Os:                d.Os,
-			Browser:           d.Browser,
-			IsTrusted:         d.IsTrusted,
-			FirstSeenAt:       d.FirstSeenAt,
-			LastSeenAt:        d.LastSeenAt,
-			SessionCount:      int(d.SessionCount),
-		}
+	description := ""
+	if input.Description != nil {
+		description = *input.Description
 	}
 
-	totalCount := int(resp.TotalCount)
-	trustedCount := int(resp.TrustedCount)
+	resp, err := r.Clients.AuditClient.CreateWebhookSubscription(ctx, &auditpb.CreateWebhookSubscriptionRequest{
+		UserId:          user.UserID,
+		Url:             input.URL,
+		EventTypes:      input.EventTypes,
+		EventCategories: input.EventCategories,
+		MinSeverity:     minSeverity,
+		Description:     description,
+	})
 
-	return &model.DevicesResponse{
+	if err != nil {
+		return nil, fmt.Errorf("failed to create webhook subscription: %w", err)
+	}
+
+	result := &model.WebhookSubscriptionResponse{
 		Success:      resp.Success,
 		Message:      resp.Message,
-		Devices:      devices,
-		TotalCount:   totalCount,
-		TrustedCount: trustedCount,
-	}, nil
+		Subscription: webhookSubscriptionFromProto(resp.Subscription),
+	}
+	if resp.Secret != "" {
+		result.Secret = &resp.Secret
+	}
+
+	return result, nil
 }
 
-// AuditLogs returns audit logs for the current user
-func (r *queryResolver) AuditLogs(ctx context.Context, limit *int, offset *int, eventCategory *string, severity *string, successOnly *bool) (*model.AuditLogsResponse, error) {
+// UpdateWebhookSubscription changes one of the current user's webhook subscriptions
+func (r *mutationResolver) UpdateWebhookSubscription(ctx context.Context, subscriptionID string, input model.WebhookSubscriptionInput, rotateSecret *bool) (*model.WebhookSubscriptionResponse, error) {
 	user, ok := middleware.GetUserFromContext(ctx)
 	if !ok {
-		return nil, fmt.Errorf("unauthorized")
+		return nil, errUnauthorized
 	}
 
-	limitValue := int32(50)
-	if limit != nil {
-		limitValue = int32(*limit)
-	}
-
-	offsetValue := int32(0)
-	if offset != nil {
-		offsetValue = int32(*offset)
+	minSeverity := ""
+	if input.MinSeverity != nil {
+		minSeverity = *input.MinSeverity
 	}
 
-	categoryValue := ""
-	if eventCategory != nil {
-		categoryValue = *eventCategory
+	description := ""
+	if input.Description != nil {
+		description = *input.Description
 	}
 
-	severityValue := ""
-	if severity != nil {
-		severityValue = *severity
+	isActive := true
+	if input.IsActive != nil {
+		isActive = *input.IsActive
 	}
 
-	successOnlyValue := false
-	if successOnly != nil {
-		successOnlyValue = *successOnly
+	rotateSecretValue := false
+	if rotateSecret != nil {
+		rotateSecretValue = *rotateSecret
 	}
 
-	resp, err := r.Clients.AuditClient.GetUserAuditLogs(ctx, &auditpb.GetUserAuditLogsRequest{
-		UserId:        user.UserID,
-		Limit:         limitValue,
-		Offset:        offsetValue,
-		EventCategory: categoryValue,
-		Severity:      severityValue,
-		SuccessOnly:   successOnlyValue,
+	resp, err := r.Clients.AuditClient.UpdateWebhookSubscription(ctx, &auditpb.UpdateWebhookSubscriptionRequest{
+		SubscriptionId:  subscriptionID,
+		UserId:          user.UserID,
+		Url:             input.URL,
+		EventTypes:      input.EventTypes,
+		EventCategories: input.EventCategories,
+		MinSeverity:     minSeverity,
+		Description:     description,
+		IsActive:        isActive,
+		RotateSecret:    rotateSecretValue,
 	})
 
 	if err != nil {
-		return nil, fmt.Errorf("failed to get audit logs: %w", err)
+		return nil, fmt.Errorf("failed to update webhook subscription: %w", err)
 	}
 
-	logs := make([]*model.AuditLog, len(resp.Logs))
-	for i, l := range resp.Logs {
-		logs[i] = &model.AuditLog{
-			ID:              l.Id,
-			UserID:          &l.UserId,
-			SessionID:       &l.SessionId,
-			DeviceID:        &l.DeviceId,
-			EventType:       l.EventType,
-			EventCategory:   l.EventCategory,
-			Severity:        l.Severity,
-			IPAddress:       &l.IpAddress,
-			UserAgent:       &l.UserAgent,
-			LocationCountry: &l.LocationCountry,
-			LocationCity:    &l.LocationCity,
-			Metadata:        &l.Metadata,
-			Success:         l.Success,
-			FailureReason:   &l.FailureReason,
-			CreatedAt:       l.CreatedAt,
-		}
+	result := &model.WebhookSubscriptionResponse{
+		Success:      resp.Success,
+		Message:      resp.Message,
+		Subscription: webhookSubscriptionFromProto(resp.Subscription),
+	}
+	if resp.Secret != "" {
+		result.Secret = &resp.Secret
 	}
 
-	totalCount := int(resp.TotalCount)
-
-	return &model.AuditLogsResponse{
-		Success:    resp.Success,
-		Message:    resp.Message,
-		Logs:       logs,
-		TotalCount: totalCount,
-	}, nil
+	return result, nil
 }
 
-// SecurityAlerts returns security alerts for the current user
-func (r *queryResolver) SecurityAlerts(ctx context.Context, includeResolved *bool, severity *string) (*model.SecurityAlertsResponse, error) {
+// DeleteWebhookSubscription removes one of the current user's webhook subscriptions
+func (r *mutationResolver) DeleteWebhookSubscription(ctx context.Context, subscriptionID string) (*model.GenericResponse, error) {
 	user, ok := middleware.GetUserFromContext(ctx)
 	if !ok {
-		return nil, fmt.Errorf("unauthorized")
+		return nil, errUnauthorized
 	}
 
-	includeResolvedValue := false
-	if includeResolved != nil {
-		includeResolvedValue = *includeResolved
+	resp, err := r.Clients.AuditClient.DeleteWebhookSubscription(ctx, &auditpb.DeleteWebhookSubscriptionRequest{
+		SubscriptionId: subscriptionID,
+		UserId:         user.UserID,
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete webhook subscription: %w", err)
+	}
+
+	return &model.GenericResponse{
+		Success: resp.Success,
+		Message: resp.Message,
+	}, nil
+}
+
+// ReplayWebhookDeliveries queues webhook deliveries to be sent again
+func (r *mutationResolver) ReplayWebhookDeliveries(ctx context.Context, subscriptionID string, deliveryIds []string) (*model.ReplayWebhookDeliveriesResponse, error) {
+	user, ok := middleware.GetUserFromContext(ctx)
+	if !ok {
+		return nil, errUnauthorized
+	}
+
+	resp, err := r.Clients.AuditClient.ReplayWebhookDeliveries(ctx, &auditpb.ReplayWebhookDeliveriesRequest{
+		SubscriptionId: subscriptionID,
+		UserId:         user.UserID,
+		DeliveryIds:    deliveryIds,
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to replay webhook deliveries: %w", err)
+	}
+
+	return &model.ReplayWebhookDeliveriesResponse{
+		Success:       resp.Success,
+		Message:       resp.Message,
+		ReplayedCount: int(resp.ReplayedCount),
+	}, nil
+}
+
+// DeleteMyAccount schedules the deletion of the current user's account
+func (r *mutationResolver) DeleteMyAccount(ctx context.Context, password string) (*model.AccountDeletionResponse, error) {
+	user, ok := middleware.GetUserFromContext(ctx)
+	if !ok {
+		return nil, errUnauthorized
+	}
+
+	resp, err := r.Clients.AuthClient.RequestAccountDeletion(ctx, &authpb.RequestAccountDeletionRequest{
+		UserId:    user.UserID,
+		Password:  password,
+		IpAddress: getIPFromContext(ctx),
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete account: %w", err)
+	}
+
+	return &model.AccountDeletionResponse{
+		Success:             resp.Success,
+		Message:             resp.Message,
+		DeletionScheduledAt: resp.DeletionScheduledAt,
+	}, nil
+}
+
+// CancelAccountDeletion cancels a pending deletion of the current user's account
+func (r *mutationResolver) CancelAccountDeletion(ctx context.Context) (*model.GenericResponse, error) {
+	user, ok := middleware.GetUserFromContext(ctx)
+	if !ok {
+		return nil, errUnauthorized
+	}
+
+	resp, err := r.Clients.AuthClient.CancelAccountDeletion(ctx, &authpb.CancelAccountDeletionRequest{
+		UserId:    user.UserID,
+		IpAddress: getIPFromContext(ctx),
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to cancel account deletion: %w", err)
+	}
+
+	return &model.GenericResponse{
+		Success: resp.Success,
+		Message: resp.Message,
+	}, nil
+}
+
+// AuthorizeOAuthClient answers an app's authorization request for the signed-in user, from the consent page
+func (r *mutationResolver) AuthorizeOAuthClient(ctx context.Context, input model.OAuthAuthorizeInput) (*model.OAuthAuthorization, error) {
+	user, ok := middleware.GetUserFromContext(ctx)
+	if !ok {
+		return nil, errUnauthorized
+	}
+
+	resp, err := r.Clients.AuthClient.AuthorizeOAuthClient(ctx, &authpb.AuthorizeOAuthClientRequest{
+		UserId:              user.UserID,
+		SessionId:           input.SessionID,
+		ClientId:            input.ClientID,
+		RedirectUri:         input.RedirectURI,
+		ResponseType:        input.ResponseType,
+		Scope:               input.Scope,
+		State:               strPtrToVal(input.State),
+		Nonce:               strPtrToVal(input.Nonce),
+		CodeChallenge:       strPtrToVal(input.CodeChallenge),
+		CodeChallengeMethod: strPtrToVal(input.CodeChallengeMethod),
+		Prompt:              strPtrToVal(input.Prompt),
+		Decision:            strPtrToVal(input.Decision),
+		IpAddress:           getIPFromContext(ctx),
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to authorize app: %w", err)
+	}
+
+	scopes := resp.Scopes
+	if scopes == nil {
+		scopes = []string{}
+	}
+
+	return &model.OAuthAuthorization{
+		Success:         resp.Success,
+		Message:         resp.Message,
+		RedirectURL:     optionalString(resp.RedirectUrl),
+		ConsentRequired: resp.ConsentRequired,
+		ClientName:      optionalString(resp.ClientName),
+		Scopes:          scopes,
+	}, nil
+}
+
+// RevokeOAuthConsent withdraws the user's consent for an app
+func (r *mutationResolver) RevokeOAuthConsent(ctx context.Context, clientID string) (*model.GenericResponse, error) {
+	user, ok := middleware.GetUserFromContext(ctx)
+	if !ok {
+		return nil, errUnauthorized
+	}
+
+	resp, err := r.Clients.AuthClient.RevokeOAuthConsent(ctx, &authpb.RevokeOAuthConsentRequest{
+		UserId:    user.UserID,
+		ClientId:  clientID,
+		IpAddress: getIPFromContext(ctx),
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to revoke consent: %w", err)
+	}
+
+	return &model.GenericResponse{
+		Success: resp.Success,
+		Message: resp.Message,
+	}, nil
+}
+
+// CreateAPIToken makes a personal access token for the user
+func (r *mutationResolver) CreateAPIToken(ctx context.Context, input model.APITokenInput) (*model.APITokenResponse, error) {
+	user, err := requireSignedIn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := r.Clients.AuthClient.CreateAPIToken(ctx, &authpb.CreateAPITokenRequest{
+		UserId:        user.UserID,
+		Name:          input.Name,
+		Scopes:        input.Scopes,
+		ExpiresInDays: expiresInDays(input.ExpiresInDays),
+		IpAddress:     getIPFromContext(ctx),
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create API token: %w", err)
+	}
+
+	return &model.APITokenResponse{
+		Success: resp.Success,
+		Message: resp.Message,
+		Token:   apiTokenFromProto(resp.Token),
+		Secret:  optionalString(resp.Secret),
+	}, nil
+}
+
+// RevokeAPIToken revokes one of the user's personal access tokens
+func (r *mutationResolver) RevokeAPIToken(ctx context.Context, tokenID string) (*model.GenericResponse, error) {
+	user, err := requireSignedIn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := r.Clients.AuthClient.RevokeAPIToken(ctx, &authpb.RevokeAPITokenRequest{
+		UserId:    user.UserID,
+		TokenId:   tokenID,
+		IpAddress: getIPFromContext(ctx),
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to revoke API token: %w", err)
+	}
+
+	return &model.GenericResponse{
+		Success: resp.Success,
+		Message: resp.Message,
+	}, nil
+}
+
+// AdminRevokeSession revokes any user's session, for users with the sessions:revoke permission
+func (r *mutationResolver) AdminRevokeSession(ctx context.Context, sessionID string, reason *string) (*model.GenericResponse, error) {
+	user, err := requirePermission(ctx, middleware.PermissionSessionsRevoke)
+	if err != nil {
+		return nil, err
+	}
+
+	reasonValue := "admin_revoked"
+	if reason != nil && *reason != "" {
+		reasonValue = *reason
+	}
+
+	// The request is made as the admin; the session service lets the
+	// permission stand in for owning the session
+	resp, err := r.Clients.SessionClient.RevokeSession(ctx, &sessionpb.RevokeSessionRequest{
+		SessionId:   sessionID,
+		UserId:      user.UserID,
+		RevokedByIp: getIPFromContext(ctx),
+		Reason:      reasonValue,
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to revoke session: %w", err)
+	}
+
+	return &model.GenericResponse{
+		Success: resp.Success,
+		Message: resp.Message,
+	}, nil
+}
+
+// AdminDisableUser disables an account and revokes its sessions, for users with the users:disable permission
+func (r *mutationResolver) AdminDisableUser(ctx context.Context, userID string, reason *string) (*model.DisableUserResponse, error) {
+	if _, err := requirePermission(ctx, middleware.PermissionUsersDisable); err != nil {
+		return nil, err
+	}
+
+	resp, err := r.Clients.AuthClient.DisableUser(ctx, &authpb.DisableUserRequest{
+		TargetUserId: userID,
+		Reason:       strPtrToVal(reason),
+		DisabledByIp: getIPFromContext(ctx),
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to disable user: %w", err)
+	}
+
+	return &model.DisableUserResponse{
+		Success:         resp.Success,
+		Message:         resp.Message,
+		RevokedSessions: int(resp.RevokedSessions),
+	}, nil
+}
+
+// AdminReactivateUser lets a disabled user sign in again, for users with the users:disable permission
+func (r *mutationResolver) AdminReactivateUser(ctx context.Context, userID string, reason *string) (*model.GenericResponse, error) {
+	if _, err := requirePermission(ctx, middleware.PermissionUsersDisable); err != nil {
+		return nil, err
+	}
+
+	resp, err := r.Clients.AuthClient.ReactivateUser(ctx, &authpb.ReactivateUserRequest{
+		TargetUserId:    userID,
+		Reason:          strPtrToVal(reason),
+		ReactivatedByIp: getIPFromContext(ctx),
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to reactivate user: %w", err)
+	}
+
+	return &model.GenericResponse{
+		Success: resp.Success,
+		Message: resp.Message,
+	}, nil
+}
+
+// AdminDeleteUser deletes any user's account and erases their personal data, for users with the users:delete permission
+func (r *mutationResolver) AdminDeleteUser(ctx context.Context, userID string, hard *bool, reason *string) (*model.DeleteUserResponse, error) {
+	if _, err := requirePermission(ctx, middleware.PermissionUsersDelete); err != nil {
+		return nil, err
+	}
+
+	resp, err := r.Clients.AuthClient.DeleteUser(ctx, &authpb.DeleteUserRequest{
+		TargetUserId: userID,
+		Hard:         hard != nil && *hard,
+		Reason:       strPtrToVal(reason),
+		DeletedByIp:  getIPFromContext(ctx),
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete user: %w", err)
+	}
+
+	return &model.DeleteUserResponse{
+		Success:           resp.Success,
+		Message:           resp.Message,
+		RedactedAuditLogs: int(resp.RedactedAuditLogs),
+	}, nil
+}
+
+// AdminImpersonateUser opens a session as another user, for users with the users:impersonate permission
+func (r *mutationResolver) AdminImpersonateUser(ctx context.Context, userID string, reason string) (*model.ImpersonationPayload, error) {
+	if _, err := requirePermission(ctx, middleware.PermissionUsersImpersonate); err != nil {
+		return nil, err
+	}
+
+	userAgent := ""
+	if req, ok := ctx.Value("httpRequest").(*http.Request); ok && req != nil {
+		userAgent = req.UserAgent()
+	}
+
+	resp, err := r.Clients.AuthClient.ImpersonateUser(ctx, &authpb.ImpersonateUserRequest{
+		TargetUserId: userID,
+		Reason:       reason,
+		IpAddress:    getIPFromContext(ctx),
+		UserAgent:    userAgent,
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to impersonate user: %w", err)
+	}
+
+	return &model.ImpersonationPayload{
+		Success:      resp.Success,
+		Message:      resp.Message,
+		AccessToken:  resp.AccessToken,
+		RefreshToken: resp.RefreshToken,
+		SessionID:    resp.SessionId,
+		ExpiresAt:    resp.ExpiresAt,
+	}, nil
+}
+
+// AdminResolveSecurityAlert resolves any user's security alert, for users with the alerts:resolve permission
+func (r *mutationResolver) AdminResolveSecurityAlert(ctx context.Context, alertID string) (*model.GenericResponse, error) {
+	user, err := requirePermission(ctx, middleware.PermissionAlertsResolve)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := r.Clients.AuditClient.ResolveSecurityAlert(ctx, &auditpb.ResolveSecurityAlertRequest{
+		AlertId: alertID,
+		UserId:  user.UserID,
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve security alert: %w", err)
+	}
+
+	return &model.GenericResponse{
+		Success: resp.Success,
+		Message: resp.Message,
+	}, nil
+}
+
+// UpdateOrganizationPolicy replaces the sign-in policy of the user's organization, for users with the organizations:manage permission
+func (r *mutationResolver) UpdateOrganizationPolicy(ctx context.Context, input model.OrganizationPolicyInput) (*model.OrganizationResponse, error) {
+	user, err := requirePermission(ctx, middleware.PermissionOrgsManage)
+	if err != nil {
+		return nil, err
+	}
+
+	var lifetime int32
+	if input.SessionLifetimeSeconds != nil {
+		lifetime = int32(*input.SessionLifetimeSeconds)
+	}
+
+	resp, err := r.Clients.AuthClient.UpdateOrganizationPolicy(ctx, &authpb.UpdateOrganizationPolicyRequest{
+		OrganizationId:         user.OrganizationID,
+		MfaRequired:            input.MfaRequired,
+		SessionLifetimeSeconds: lifetime,
+		AllowedCountries:       input.AllowedCountries,
+		IpAllowlist:            input.IPAllowlist,
+		IpAddress:              getIPFromContext(ctx),
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to update organization policy: %w", err)
+	}
+
+	return &model.OrganizationResponse{
+		Success:      resp.Success,
+		Message:      resp.Message,
+		Organization: organizationFromProto(resp.Organization),
+	}, nil
+}
+
+// CreateAccessPolicy restricts where the members of the user's organization, or one member, may sign in from, for users with the organizations:manage permission
+func (r *mutationResolver) CreateAccessPolicy(ctx context.Context, input model.AccessPolicyInput) (*model.AccessPolicyResponse, error) {
+	user, err := requirePermission(ctx, middleware.PermissionOrgsManage)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := r.Clients.AuthClient.CreateAccessPolicy(ctx, &authpb.CreateAccessPolicyRequest{
+		OrganizationId:   user.OrganizationID,
+		UserId:           strPtrToVal(input.UserID),
+		Name:             input.Name,
+		IpAllowlist:      input.IPAllowlist,
+		IpDenylist:       input.IPDenylist,
+		CountryAllowlist: input.CountryAllowlist,
+		CountryDenylist:  input.CountryDenylist,
+		Action:           strPtrToVal(input.Action),
+		IpAddress:        getIPFromContext(ctx),
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create access policy: %w", err)
+	}
+
+	return &model.AccessPolicyResponse{
+		Success: resp.Success,
+		Message: resp.Message,
+		Policy:  accessPolicyFromProto(resp.Policy),
+	}, nil
+}
+
+// DeleteAccessPolicy deletes an access policy of the user's organization, for users with the organizations:manage permission
+func (r *mutationResolver) DeleteAccessPolicy(ctx context.Context, policyID string) (*model.GenericResponse, error) {
+	user, err := requirePermission(ctx, middleware.PermissionOrgsManage)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := r.Clients.AuthClient.DeleteAccessPolicy(ctx, &authpb.DeleteAccessPolicyRequest{
+		OrganizationId: user.OrganizationID,
+		PolicyId:       policyID,
+		IpAddress:      getIPFromContext(ctx),
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete access policy: %w", err)
+	}
+
+	return &model.GenericResponse{
+		Success: resp.Success,
+		Message: resp.Message,
+	}, nil
+}
+
+// CreateOAuthClient registers an app in the user's organization, for users with the organizations:manage permission
+func (r *mutationResolver) CreateOAuthClient(ctx context.Context, input model.OAuthClientInput) (*model.OAuthClientResponse, error) {
+	user, err := requirePermission(ctx, middleware.PermissionOrgsManage)
+	if err != nil {
+		return nil, err
+	}
+
+	public := false
+	if input.Public != nil {
+		public = *input.Public
+	}
+
+	resp, err := r.Clients.AuthClient.CreateOAuthClient(ctx, &authpb.CreateOAuthClientRequest{
+		OrganizationId:       user.OrganizationID,
+		Name:                 input.Name,
+		RedirectUris:         input.RedirectUris,
+		BackchannelLogoutUri: strPtrToVal(input.BackchannelLogoutURI),
+		Scopes:               input.Scopes,
+		Public:               public,
+		IpAddress:            getIPFromContext(ctx),
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OAuth client: %w", err)
+	}
+
+	return &model.OAuthClientResponse{
+		Success:      resp.Success,
+		Message:      resp.Message,
+		Client:       oauthClientFromProto(resp.Client),
+		ClientSecret: optionalString(resp.ClientSecret),
+	}, nil
+}
+
+// DeleteOAuthClient removes an app from the user's organization, for users with the organizations:manage permission
+func (r *mutationResolver) DeleteOAuthClient(ctx context.Context, clientID string) (*model.GenericResponse, error) {
+	user, err := requirePermission(ctx, middleware.PermissionOrgsManage)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := r.Clients.AuthClient.DeleteOAuthClient(ctx, &authpb.DeleteOAuthClientRequest{
+		OrganizationId: user.OrganizationID,
+		ClientId:       clientID,
+		IpAddress:      getIPFromContext(ctx),
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete OAuth client: %w", err)
+	}
+
+	return &model.GenericResponse{
+		Success: resp.Success,
+		Message: resp.Message,
+	}, nil
+}
+
+// UpdateSAMLConnection connects the user's organization to its SAML
+// identity provider
+func (r *mutationResolver) UpdateSAMLConnection(ctx context.Context, input model.SAMLConnectionInput) (*model.SAMLConnectionResponse, error) {
+	user, err := requirePermission(ctx, middleware.PermissionOrgsManage)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := r.Clients.AuthClient.UpdateSAMLConnection(ctx, &authpb.UpdateSAMLConnectionRequest{
+		OrganizationId:  user.OrganizationID,
+		IdpEntityId:     input.IdpEntityID,
+		IdpSsoUrl:       input.IdpSsoURL,
+		IdpCertificate:  input.IdpCertificate,
+		EmailAttribute:  strPtrToVal(input.EmailAttribute),
+		NameAttribute:   strPtrToVal(input.NameAttribute),
+		JitProvisioning: input.JitProvisioning,
+		Enabled:         input.Enabled,
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to update SAML connection: %w", err)
+	}
+
+	return samlConnectionResponseFromProto(resp), nil
+}
+
+// CreateAPIKey makes an API key for the user's organization, acting as the user, for users with the organizations:manage permission
+func (r *mutationResolver) CreateAPIKey(ctx context.Context, input model.APITokenInput) (*model.APITokenResponse, error) {
+	user, err := requireSignedIn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !user.HasPermission(middleware.PermissionOrgsManage) {
+		return nil, errMissingPermission(middleware.PermissionOrgsManage)
+	}
+
+	resp, err := r.Clients.AuthClient.CreateAPIKey(ctx, &authpb.CreateAPIKeyRequest{
+		OrganizationId: user.OrganizationID,
+		Name:           input.Name,
+		Scopes:         input.Scopes,
+		ExpiresInDays:  expiresInDays(input.ExpiresInDays),
+		IpAddress:      getIPFromContext(ctx),
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create API key: %w", err)
+	}
+
+	return &model.APITokenResponse{
+		Success: resp.Success,
+		Message: resp.Message,
+		Token:   apiTokenFromProto(resp.Token),
+		Secret:  optionalString(resp.Secret),
+	}, nil
+}
+
+// RevokeAPIKey revokes one of the API keys of the user's organization, for users with the organizations:manage permission
+func (r *mutationResolver) RevokeAPIKey(ctx context.Context, keyID string) (*model.GenericResponse, error) {
+	user, err := requireSignedIn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !user.HasPermission(middleware.PermissionOrgsManage) {
+		return nil, errMissingPermission(middleware.PermissionOrgsManage)
+	}
+
+	resp, err := r.Clients.AuthClient.RevokeAPIKey(ctx, &authpb.RevokeAPIKeyRequest{
+		OrganizationId: user.OrganizationID,
+		KeyId:          keyID,
+		IpAddress:      getIPFromContext(ctx),
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to revoke API key: %w", err)
+	}
+
+	return &model.GenericResponse{
+		Success: resp.Success,
+		Message: resp.Message,
+	}, nil
+}
+
+// Me returns the current user's profile
+func (r *queryResolver) Me(ctx context.Context) (*model.User, error) {
+	user, ok := middleware.GetUserFromContext(ctx)
+	if !ok {
+		return nil, errUnauthorized
+	}
+
+	resp, err := r.Clients.AuthClient.GetUserProfile(ctx, &authpb.GetUserProfileRequest{
+		UserId: user.UserID,
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user profile: %w", err)
+	}
+
+	return userFromProto(resp.Profile), nil
+}
+
+// ValidateToken validates a JWT token
+func (r *queryResolver) ValidateToken(ctx context.Context, token string) (*model.TokenValidationResponse, error) {
+	resp, err := r.Clients.AuthClient.ValidateToken(ctx, &authpb.ValidateTokenRequest{
+		Token: token,
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to validate token: %w", err)
+	}
+
+	return &model.TokenValidationResponse{
+		Valid:          resp.Valid,
+		UserID:         &resp.UserId,
+		Email:          &resp.Email,
+		Message:        resp.Message,
+		Roles:          resp.Roles,
+		Permissions:    resp.Permissions,
+		ImpersonatedBy: optionalString(resp.ImpersonatorId),
+	}, nil
+}
+
+// IdentityProviders returns the identity providers users can sign in with
+func (r *queryResolver) IdentityProviders(ctx context.Context) ([]string, error) {
+	resp, err := r.Clients.AuthClient.ListIdentityProviders(ctx, &authpb.ListIdentityProvidersRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list identity providers: %w", err)
+	}
+
+	return resp.Providers, nil
+}
+
+// Sessions returns all sessions for the current user
+func (r *queryResolver) Sessions(ctx context.Context, includeInactive *bool) (*model.SessionsResponse, error) {
+	user, ok := middleware.GetUserFromContext(ctx)
+	if !ok {
+		return nil, errUnauthorized
+	}
+
+	includeInactiveValue := false
+	if includeInactive != nil {
+		includeInactiveValue = *includeInactive
+	}
+
+	resp, err := r.Clients.SessionClient.GetUserSessions(ctx, &sessionpb.GetUserSessionsRequest{
+		UserId:          user.UserID,
+		IncludeInactive: includeInactiveValue,
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sessions: %w", err)
+	}
+
+	sessions := make([]*model.Session, len(resp.Sessions))
+	for i, s := range resp.Sessions {
+		sessions[i] = sessionFromProto(s)
+	}
+
+	totalCount := int(resp.TotalCount)
+	activeCount := int(resp.ActiveCount)
+
+	return &model.SessionsResponse{
+		Success:     resp.Success,
+		Message:     resp.Message,
+		Sessions:    sessions,
+		TotalCount:  totalCount,
+		ActiveCount: activeCount,
+	}, nil
+}
+
+// SessionDetails returns details of a specific session
+func (r *queryResolver) SessionDetails(ctx context.Context, sessionID string) (*model.Session, error) {
+	user, ok := middleware.GetUserFromContext(ctx)
+	if !ok {
+		return nil, errUnauthorized
+	}
+
+	resp, err := r.Clients.SessionClient.GetSessionDetails(ctx, &sessionpb.GetSessionDetailsRequest{
+		SessionId: sessionID,
+		UserId:    user.UserID,
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session details: %w", err)
+	}
+
+	if resp.Session == nil {
+		return nil, fmt.Errorf("failed to get session details: empty response")
+	}
+
+	return sessionFromProto(resp.Session), nil
+}
+
+// SessionStats returns session statistics
+func (r *queryResolver) SessionStats(ctx context.Context) (*model.SessionStats, error) {
+	user, ok := middleware.GetUserFromContext(ctx)
+	if !ok {
+		return nil, errUnauthorized
+	}
+
+	resp, err := r.Clients.SessionClient.GetSessionStats(ctx, &sessionpb.GetSessionStatsRequest{
+		UserId: user.UserID,
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session stats: %w", err)
+	}
+
+	return &model.SessionStats{
+		TotalSessions:     int(resp.TotalSessions),
+		ActiveSessions:    int(resp.ActiveSessions),
+		TotalDevices:      int(resp.TotalDevices),
+		TrustedDevices:    int(resp.TrustedDevices),
+		LastLogin:         &resp.LastLogin,
+		LastLoginLocation: &resp.LastLoginLocation,
+		RecentLocations:   resp.RecentLocations,
+	}, nil
+}
+
+// Devices returns all devices for the current user
+func (r *queryResolver) Devices(ctx context.Context) (*model.DevicesResponse, error) {
+	user, ok := middleware.GetUserFromContext(ctx)
+	if !ok {
+		return nil, errUnauthorized
+	}
+
+	resp, err := r.Clients.SessionClient.GetUserDevices(ctx, &sessionpb.GetUserDevicesRequest{
+		UserId: user.UserID,
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get devices: %w", err)
+	}
+
+	devices := make([]*model.Device, len(resp.Devices))
+	for i, d := range resp.Devices {
+		devices[i] = &model.Device{
+			ID:                d.Id,
+			UserID:            d.UserId,
+			DeviceFingerprint: d.DeviceFingerprint,
+			DeviceName:        d.DeviceName,
+			DeviceType:        d.DeviceType,
+			Os:                d.Os,
+			Browser:           d.Browser,
+			IsTrusted:         d.IsTrusted,
+			FirstSeenAt:       d.FirstSeenAt,
+			LastSeenAt:        d.LastSeenAt,
+			SessionCount:      int(d.SessionCount),
+			TrustedUntil:      &d.TrustedUntil,
+		}
+	}
+
+	totalCount := int(resp.TotalCount)
+	trustedCount := int(resp.TrustedCount)
+
+	return &model.DevicesResponse{
+		Success:      resp.Success,
+		Message:      resp.Message,
+		Devices:      devices,
+		TotalCount:   totalCount,
+		TrustedCount: trustedCount,
+	}, nil
+}
+
+// AuditLogs returns audit logs for the current user
+func (r *queryResolver) AuditLogs(ctx context.Context, limit *int, offset *int, eventCategory *string, severity *string, successOnly *bool, first *int, after *string, filter *model.AuditLogFilter) (*model.AuditLogsResponse, error) {
+	user, ok := middleware.GetUserFromContext(ctx)
+	if !ok {
+		return nil, errUnauthorized
+	}
+	if err := requireNonNegative("limit", limit); err != nil {
+		return nil, err
+	}
+	if err := requireNonNegative("first", first); err != nil {
+		return nil, err
+	}
+	if err := requireNonNegative("offset", offset); err != nil {
+		return nil, err
+	}
+
+	limitValue := int32(50)
+	if limit != nil {
+		limitValue = int32(*limit)
+	}
+	if first != nil {
+		limitValue = int32(*first)
+	}
+
+	offsetValue := int32(0)
+	if offset != nil {
+		offsetValue = int32(*offset)
+	}
+
+	afterValue := ""
+	if after != nil {
+		afterValue = *after
+	}
+
+	categoryValue := ""
+	if eventCategory != nil {
+		categoryValue = *eventCategory
+	}
+
+	severityValue := ""
+	if severity != nil {
+		severityValue = *severity
+	}
+
+	successOnlyValue := false
+	if successOnly != nil {
+		successOnlyValue = *successOnly
+	}
+
+	var filterValue *auditpb.AuditLogFilter
+	if filter != nil {
+		filterValue = auditLogFilterToProto(filter)
+		if filter.EventCategory != nil {
+			categoryValue = *filter.EventCategory
+		}
+		if filter.Severity != nil {
+			severityValue = *filter.Severity
+		}
+	}
+
+	resp, err := r.Clients.AuditClient.GetUserAuditLogs(ctx, &auditpb.GetUserAuditLogsRequest{
+		UserId:        user.UserID,
+		Limit:         limitValue,
+		Offset:        offsetValue,
+		EventCategory: categoryValue,
+		Severity:      severityValue,
+		SuccessOnly:   successOnlyValue,
+		Cursor:        afterValue,
+		Filter:        filterValue,
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get audit logs: %w", err)
+	}
+
+	logs := make([]*model.AuditLog, len(resp.Logs))
+	edges := make([]*model.AuditLogEdge, len(resp.Logs))
+	for i, l := range resp.Logs {
+		logs[i] = auditLogFromProto(l)
+		edges[i] = &model.AuditLogEdge{
+			Cursor: l.Cursor,
+			Node:   logs[i],
+		}
+	}
+
+	pageInfo := &model.PageInfo{
+		HasNextPage:     resp.HasMore,
+		HasPreviousPage: afterValue != "" || offsetValue > 0,
+	}
+	if len(edges) > 0 {
+		pageInfo.StartCursor = &edges[0].Cursor
+		pageInfo.EndCursor = &edges[len(edges)-1].Cursor
+	}
+
+	totalCount := int(resp.TotalCount)
+
+	return &model.AuditLogsResponse{
+		Success:    resp.Success,
+		Message:    resp.Message,
+		Logs:       logs,
+		TotalCount: totalCount,
+		Edges:      edges,
+		PageInfo:   pageInfo,
+	}, nil
+}
+
+// SearchAuditLogs searches the current user's audit logs
+func (r *queryResolver) SearchAuditLogs(ctx context.Context, query string, first *int, after *string) (*model.AuditLogSearchResponse, error) {
+	user, ok := middleware.GetUserFromContext(ctx)
+	if !ok {
+		return nil, errUnauthorized
+	}
+	if err := requireNonNegative("first", first); err != nil {
+		return nil, err
+	}
+
+	limitValue := int32(50)
+	if first != nil {
+		limitValue = int32(*first)
+	}
+
+	afterValue := ""
+	if after != nil {
+		afterValue = *after
+	}
+
+	resp, err := r.Clients.AuditClient.SearchAuditLogs(ctx, &auditpb.SearchAuditLogsRequest{
+		UserId: user.UserID,
+		Query:  query,
+		Limit:  limitValue,
+		Cursor: afterValue,
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to search audit logs: %w", err)
+	}
+
+	edges := make([]*model.AuditLogEdge, len(resp.Logs))
+	for i, l := range resp.Logs {
+		edges[i] = &model.AuditLogEdge{
+			Cursor: l.Cursor,
+			Node:   auditLogFromProto(l),
+		}
+	}
+
+	pageInfo := &model.PageInfo{
+		HasNextPage:     resp.HasMore,
+		HasPreviousPage: afterValue != "",
+	}
+	if len(edges) > 0 {
+		pageInfo.StartCursor = &edges[0].Cursor
+		pageInfo.EndCursor = &edges[len(edges)-1].Cursor
+	}
+
+	return &model.AuditLogSearchResponse{
+		Success:  resp.Success,
+		Message:  resp.Message,
+		Edges:    edges,
+		PageInfo: pageInfo,
+	}, nil
+}
+
+// SecurityAlerts returns security alerts for the current user
+func (r *queryResolver) SecurityAlerts(ctx context.Context, includeResolved *bool, severity *string) (*model.SecurityAlertsResponse, error) {
+	user, ok := middleware.GetUserFromContext(ctx)
+	if !ok {
+		return nil, errUnauthorized
+	}
+
+	includeResolvedValue := false
+	if includeResolved != nil {
+		includeResolvedValue = *includeResolved
 	}
 
 	severityValue := ""
@@ -629,7 +1621,7 @@ func (r *queryResolver) SecurityAlerts(ctx context.Context, includeResolved *boo
 func (r *queryResolver) ComplianceReport(ctx context.Context, startDate *string, endDate *string) (*model.ComplianceReport, error) {
 	user, ok := middleware.GetUserFromContext(ctx)
 	if !ok {
-		return nil, fmt.Errorf("unauthorized")
+		return nil, errUnauthorized
 	}
 
 	startDateValue := ""
@@ -676,7 +1668,7 @@ func (r *queryResolver) ComplianceReport(ctx context.Context, startDate *string,
 func (r *queryResolver) ActivitySummary(ctx context.Context, days *int) (*model.ActivitySummary, error) {
 	user, ok := middleware.GetUserFromContext(ctx)
 	if !ok {
-		return nil, fmt.Errorf("unauthorized")
+		return nil, errUnauthorized
 	}
 
 	daysValue := int32(30)
@@ -711,6 +1703,414 @@ func (r *queryResolver) ActivitySummary(ctx context.Context, days *int) (*model.
 	}, nil
 }
 
+// NotificationPreferences returns how the current user is notified about security alerts
+func (r *queryResolver) NotificationPreferences(ctx context.Context) (*model.NotificationPreferencesResponse, error) {
+	user, ok := middleware.GetUserFromContext(ctx)
+	if !ok {
+		return nil, errUnauthorized
+	}
+
+	resp, err := r.Clients.AuditClient.GetNotificationPreferences(ctx, &auditpb.GetNotificationPreferencesRequest{
+		UserId: user.UserID,
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get notification preferences: %w", err)
+	}
+
+	return &model.NotificationPreferencesResponse{
+		Success:     resp.Success,
+		Message:     resp.Message,
+		Preferences: notificationPreferencesFromProto(resp.Preferences),
+	}, nil
+}
+
+// WebhookSubscriptions returns the current user's webhook subscriptions
+func (r *queryResolver) WebhookSubscriptions(ctx context.Context) (*model.WebhookSubscriptionsResponse, error) {
+	user, ok := middleware.GetUserFromContext(ctx)
+	if !ok {
+		return nil, errUnauthorized
+	}
+
+	resp, err := r.Clients.AuditClient.ListWebhookSubscriptions(ctx, &auditpb.ListWebhookSubscriptionsRequest{
+		UserId: user.UserID,
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook subscriptions: %w", err)
+	}
+
+	subscriptions := make([]*model.WebhookSubscription, len(resp.Subscriptions))
+	for i, sub := range resp.Subscriptions {
+		subscriptions[i] = webhookSubscriptionFromProto(sub)
+	}
+
+	return &model.WebhookSubscriptionsResponse{
+		Success:       resp.Success,
+		Message:       resp.Message,
+		Subscriptions: subscriptions,
+	}, nil
+}
+
+// WebhookDeliveries returns the delivery log of one of the current user's webhook subscriptions
+func (r *queryResolver) WebhookDeliveries(ctx context.Context, subscriptionID string, status *string, limit *int, offset *int) (*model.WebhookDeliveriesResponse, error) {
+	user, ok := middleware.GetUserFromContext(ctx)
+	if !ok {
+		return nil, errUnauthorized
+	}
+
+	statusValue := ""
+	if status != nil {
+		statusValue = *status
+	}
+
+	limitValue := int32(50)
+	if limit != nil {
+		limitValue = int32(*limit)
+	}
+
+	offsetValue := int32(0)
+	if offset != nil {
+		offsetValue = int32(*offset)
+	}
+
+	resp, err := r.Clients.AuditClient.ListWebhookDeliveries(ctx, &auditpb.ListWebhookDeliveriesRequest{
+		SubscriptionId: subscriptionID,
+		UserId:         user.UserID,
+		Status:         statusValue,
+		Limit:          limitValue,
+		Offset:         offsetValue,
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook deliveries: %w", err)
+	}
+
+	deliveries := make([]*model.WebhookDelivery, len(resp.Deliveries))
+	for i, d := range resp.Deliveries {
+		delivery := &model.WebhookDelivery{
+			ID:             d.Id,
+			SubscriptionID: d.SubscriptionId,
+			AuditLogID:     d.AuditLogId,
+			EventType:      d.EventType,
+			Status:         d.Status,
+			Attempts:       int(d.Attempts),
+			CreatedAt:      d.CreatedAt,
+		}
+		if d.LastError != "" {
+			delivery.LastError = &d.LastError
+		}
+		if d.ResponseStatus != 0 {
+			responseStatus := int(d.ResponseStatus)
+			delivery.ResponseStatus = &responseStatus
+		}
+		if d.NextAttemptAt != "" {
+			delivery.NextAttemptAt = &d.NextAttemptAt
+		}
+		if d.DeliveredAt != "" {
+			delivery.DeliveredAt = &d.DeliveredAt
+		}
+		deliveries[i] = delivery
+	}
+
+	return &model.WebhookDeliveriesResponse{
+		Success:    resp.Success,
+		Message:    resp.Message,
+		Deliveries: deliveries,
+		TotalCount: int(resp.TotalCount),
+	}, nil
+}
+
+// AdminUsers lists user accounts, for users with the users:read permission
+func (r *queryResolver) AdminUsers(ctx context.Context, query *string, limit *int, offset *int) (*model.AdminUsersResponse, error) {
+	if _, err := requirePermission(ctx, middleware.PermissionUsersRead); err != nil {
+		return nil, err
+	}
+
+	limitValue := int32(50)
+	if limit != nil {
+		limitValue = int32(*limit)
+	}
+
+	offsetValue := int32(0)
+	if offset != nil {
+		offsetValue = int32(*offset)
+	}
+
+	resp, err := r.Clients.AuthClient.ListUsers(ctx, &authpb.ListUsersRequest{
+		Query:  strPtrToVal(query),
+		Limit:  limitValue,
+		Offset: offsetValue,
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+
+	users := make([]*model.User, len(resp.Users))
+	for i, u := range resp.Users {
+		users[i] = userFromProto(u)
+	}
+
+	return &model.AdminUsersResponse{
+		Success:    resp.Success,
+		Message:    resp.Message,
+		Users:      users,
+		TotalCount: int(resp.TotalCount),
+	}, nil
+}
+
+// AdminSessions searches the sessions of all users, for users with the sessions:read permission
+func (r *queryResolver) AdminSessions(ctx context.Context, filter *model.AdminSessionFilter, limit *int, offset *int) (*model.AdminSessionsResponse, error) {
+	if _, err := requirePermission(ctx, middleware.PermissionSessionsRead); err != nil {
+		return nil, err
+	}
+
+	req := &sessionpb.SearchSessionsRequest{
+		Limit: 50,
+	}
+	if filter != nil {
+		req.UserId = strPtrToVal(filter.UserID)
+		req.IpAddress = strPtrToVal(filter.IPAddress)
+		req.ActiveOnly = filter.ActiveOnly != nil && *filter.ActiveOnly
+	}
+	if limit != nil {
+		req.Limit = int32(*limit)
+	}
+	if offset != nil {
+		req.Offset = int32(*offset)
+	}
+
+	resp, err := r.Clients.SessionClient.SearchSessions(ctx, req)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to search sessions: %w", err)
+	}
+
+	sessions := make([]*model.Session, len(resp.Sessions))
+	for i, s := range resp.Sessions {
+		sessions[i] = sessionFromProto(s)
+	}
+
+	return &model.AdminSessionsResponse{
+		Success:    resp.Success,
+		Message:    resp.Message,
+		Sessions:   sessions,
+		TotalCount: int(resp.TotalCount),
+	}, nil
+}
+
+// AdminSecurityAlerts lists security alerts across all users, for users with the alerts:read permission
+func (r *queryResolver) AdminSecurityAlerts(ctx context.Context, userID *string, includeResolved *bool, severity *string, limit *int, offset *int) (*model.AdminSecurityAlertsResponse, error) {
+	if _, err := requirePermission(ctx, middleware.PermissionAlertsRead); err != nil {
+		return nil, err
+	}
+
+	limitValue := int32(50)
+	if limit != nil {
+		limitValue = int32(*limit)
+	}
+
+	offsetValue := int32(0)
+	if offset != nil {
+		offsetValue = int32(*offset)
+	}
+
+	resp, err := r.Clients.AuditClient.ListSecurityAlerts(ctx, &auditpb.ListSecurityAlertsRequest{
+		UserId:          strPtrToVal(userID),
+		IncludeResolved: includeResolved != nil && *includeResolved,
+		Severity:        strPtrToVal(severity),
+		Limit:           limitValue,
+		Offset:          offsetValue,
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list security alerts: %w", err)
+	}
+
+	alerts := make([]*model.SecurityAlert, len(resp.Alerts))
+	for i, a := range resp.Alerts {
+		alerts[i] = securityAlertFromProto(a)
+	}
+
+	return &model.AdminSecurityAlertsResponse{
+		Success:    resp.Success,
+		Message:    resp.Message,
+		Alerts:     alerts,
+		TotalCount: int(resp.TotalCount),
+	}, nil
+}
+
+// Organization returns the user's organization and its sign-in policy, for users with the organizations:manage permission
+func (r *queryResolver) Organization(ctx context.Context) (*model.OrganizationResponse, error) {
+	user, err := requirePermission(ctx, middleware.PermissionOrgsManage)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := r.Clients.AuthClient.GetOrganization(ctx, &authpb.GetOrganizationRequest{
+		OrganizationId: user.OrganizationID,
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get organization: %w", err)
+	}
+
+	return &model.OrganizationResponse{
+		Success:      resp.Success,
+		Message:      resp.Message,
+		Organization: organizationFromProto(resp.Organization),
+	}, nil
+}
+
+// AccessPolicies lists the access policies of the user's organization, for users with the organizations:manage permission
+func (r *queryResolver) AccessPolicies(ctx context.Context, userID *string) (*model.AccessPoliciesResponse, error) {
+	user, err := requirePermission(ctx, middleware.PermissionOrgsManage)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := r.Clients.AuthClient.ListAccessPolicies(ctx, &authpb.ListAccessPoliciesRequest{
+		OrganizationId: user.OrganizationID,
+		UserId:         strPtrToVal(userID),
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list access policies: %w", err)
+	}
+
+	policies := make([]*model.AccessPolicy, len(resp.Policies))
+	for i, p := range resp.Policies {
+		policies[i] = accessPolicyFromProto(p)
+	}
+
+	return &model.AccessPoliciesResponse{
+		Success:  resp.Success,
+		Message:  resp.Message,
+		Policies: policies,
+	}, nil
+}
+
+// OauthClients lists the apps registered in the user's organization, for users with the organizations:manage permission
+func (r *queryResolver) OauthClients(ctx context.Context) (*model.OAuthClientsResponse, error) {
+	user, err := requirePermission(ctx, middleware.PermissionOrgsManage)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := r.Clients.AuthClient.ListOAuthClients(ctx, &authpb.ListOAuthClientsRequest{
+		OrganizationId: user.OrganizationID,
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list OAuth clients: %w", err)
+	}
+
+	clients := make([]*model.OAuthClient, len(resp.Clients))
+	for i, c := range resp.Clients {
+		clients[i] = oauthClientFromProto(c)
+	}
+
+	return &model.OAuthClientsResponse{
+		Success: resp.Success,
+		Message: resp.Message,
+		Clients: clients,
+	}, nil
+}
+
+// SamlConnection returns the SAML connection of the user's organization
+func (r *queryResolver) SamlConnection(ctx context.Context) (*model.SAMLConnectionResponse, error) {
+	user, err := requirePermission(ctx, middleware.PermissionOrgsManage)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := r.Clients.AuthClient.GetSAMLConnection(ctx, &authpb.GetSAMLConnectionRequest{
+		OrganizationId: user.OrganizationID,
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get SAML connection: %w", err)
+	}
+
+	return samlConnectionResponseFromProto(resp), nil
+}
+
+// OauthConsents lists the apps the user agreed to share their account with
+func (r *queryResolver) OauthConsents(ctx context.Context) (*model.OAuthConsentsResponse, error) {
+	user, ok := middleware.GetUserFromContext(ctx)
+	if !ok {
+		return nil, errUnauthorized
+	}
+
+	resp, err := r.Clients.AuthClient.ListOAuthConsents(ctx, &authpb.ListOAuthConsentsRequest{
+		UserId: user.UserID,
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list consents: %w", err)
+	}
+
+	consents := make([]*model.OAuthConsent, len(resp.Consents))
+	for i, c := range resp.Consents {
+		consents[i] = &model.OAuthConsent{
+			ClientID:   c.ClientId,
+			ClientName: c.ClientName,
+			Scopes:     c.Scopes,
+			CreatedAt:  c.CreatedAt,
+			UpdatedAt:  c.UpdatedAt,
+		}
+		if consents[i].Scopes == nil {
+			consents[i].Scopes = []string{}
+		}
+	}
+
+	return &model.OAuthConsentsResponse{
+		Success:  resp.Success,
+		Message:  resp.Message,
+		Consents: consents,
+	}, nil
+}
+
+// APITokens lists the user's personal access tokens
+func (r *queryResolver) APITokens(ctx context.Context) (*model.APITokensResponse, error) {
+	user, err := requireSignedIn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := r.Clients.AuthClient.ListAPITokens(ctx, &authpb.ListAPITokensRequest{
+		UserId: user.UserID,
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list API tokens: %w", err)
+	}
+
+	return apiTokensResponseFromProto(resp), nil
+}
+
+// APIKeys lists the API keys of the user's organization, for users with the organizations:manage permission
+func (r *queryResolver) APIKeys(ctx context.Context) (*model.APITokensResponse, error) {
+	user, err := requireSignedIn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !user.HasPermission(middleware.PermissionOrgsManage) {
+		return nil, errMissingPermission(middleware.PermissionOrgsManage)
+	}
+
+	resp, err := r.Clients.AuthClient.ListAPIKeys(ctx, &authpb.ListAPIKeysRequest{
+		OrganizationId: user.OrganizationID,
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to list API keys: %w", err)
+	}
+
+	return apiTokensResponseFromProto(resp), nil
+}
+
 // Mutation returns generated.MutationResolver implementation.
 func (r *Resolver) Mutation() generated.MutationResolver { return &mutationResolver{r} }
 
@@ -730,7 +2130,7 @@ type queryResolver struct{ *Resolver }
 	func (r *mutationResolver) EnableMFA(ctx context.Context) (*model.MFASetup, error) {
 	user, ok := middleware.GetUserFromContext(ctx)
 	if !ok {
-		return nil, fmt.Errorf("unauthorized")
+		return nil, errUnauthorized
 	}
 
 	resp, err := r.Clients.AuthClient.EnableMFA(ctx, &authpb.EnableMFARequest{
@@ -752,7 +2152,7 @@ type queryResolver struct{ *Resolver }
 func (r *mutationResolver) VerifyMFA(ctx context.Context, code string) (*model.GenericResponse, error) {
 	user, ok := middleware.GetUserFromContext(ctx)
 	if !ok {
-		return nil, fmt.Errorf("unauthorized")
+		return nil, errUnauthorized
 	}
 
 	resp, err := r.Clients.AuthClient.VerifyMFA(ctx, &authpb.VerifyMFARequest{
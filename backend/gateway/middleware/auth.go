@@ -2,10 +2,18 @@ package middleware
 
 import (
 	"context"
+	"errors"
+	"log"
 	"net/http"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	authpb "github.com/aashiq-04/session-management-system/backend/gateway/proto/auth"
 )
 
 // ContextKey is the type for context keys
@@ -13,21 +21,90 @@ type ContextKey string
 
 const UserContextKey ContextKey = "user"
 
+// Permissions granted by roles, as named in the permissions table
+const (
+	PermissionUsersRead        = "users:read"
+	PermissionUsersDisable     = "users:disable"
+	PermissionUsersDelete      = "users:delete"
+	PermissionUsersImpersonate = "users:impersonate"
+	PermissionSessionsRead     = "sessions:read"
+	PermissionSessionsRevoke   = "sessions:revoke"
+	PermissionAlertsRead       = "alerts:read"
+	PermissionAlertsResolve    = "alerts:resolve"
+	PermissionOrgsManage       = "organizations:manage"
+)
+
+// APITokenPrefix starts personal access tokens and API keys, which the
+// auth service checks, unlike access tokens
+const APITokenPrefix = "sms_"
+
+// Scopes an API token needs for each kind of request. Its other scopes name
+// the permissions it keeps.
+const (
+	ScopeRead  = "read"  // GraphQL queries and downloads
+	ScopeWrite = "write" // GraphQL mutations
+)
+
 // UserContext represents the authenticated user
 type UserContext struct {
-	UserID string
-	Email  string
+	UserID         string
+	Email          string
+	OrganizationID string
+	Roles          []string
+	Permissions    []string
+
+	// Set when the request was made with an API token. Permissions are
+	// already narrowed to its scopes.
+	TokenID string
+	Scopes  []string
+
+	// When and how the user last proved who they are, from the access
+	// token. Zero for API tokens and impersonation.
+	AuthTime time.Time
+	AMR      []string
+
+	// ImpersonatorID is the admin signed in as the user, if any
+	ImpersonatorID string
+}
+
+// HasPermission reports whether the user's roles grant permission
+func (u *UserContext) HasPermission(permission string) bool {
+	return slices.Contains(u.Permissions, permission)
+}
+
+// HasScope reports whether the request may do what scope allows. Requests
+// made with an access token rather than an API token are not limited.
+func (u *UserContext) HasScope(scope string) bool {
+	return u.TokenID == "" || slices.Contains(u.Scopes, scope)
 }
 
 // JWTClaims represents JWT token claims
 type JWTClaims struct {
-	UserID string `json:"user_id"`
-	Email  string `json:"email"`
+	UserID         string   `json:"user_id"`
+	Email          string   `json:"email"`
+	OrganizationID string   `json:"organization_id"`
+	Roles          []string `json:"roles,omitempty"`
+	Permissions    []string `json:"permissions,omitempty"`
+	ImpersonatorID string   `json:"impersonator_id,omitempty"`
+	AuthTime       int64    `json:"auth_time,omitempty"`
+	AMR            []string `json:"amr,omitempty"`
 	jwt.RegisteredClaims
 }
 
-// AuthMiddleware validates JWT tokens and adds user context
-func AuthMiddleware(jwtSecret string) func(http.Handler) http.Handler {
+// Authentication methods in the amr claim of access tokens
+const (
+	AMRPassword  = "pwd"
+	AMRMFA       = "mfa"
+	AMRFederated = "fed"
+)
+
+// errInvalidAPIToken is returned for unknown, revoked and expired API tokens
+var errInvalidAPIToken = errors.New("invalid API token")
+
+// AuthMiddleware validates JWT tokens and adds user context. API tokens are
+// checked with the auth service, which records each use; clientIP gives the
+// address the organization's policies are checked against.
+func AuthMiddleware(jwtSecret string, authClient authpb.AuthServiceClient, clientIP func(*http.Request) string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// Get token from Authorization header
@@ -47,6 +124,19 @@ func AuthMiddleware(jwtSecret string) func(http.Handler) http.Handler {
 				return
 			}
 
+			// Unlike a bad access token, a bad API token fails the request,
+			// so scripts see why
+			if strings.HasPrefix(tokenString, APITokenPrefix) {
+				userCtx, err := validateAPIToken(r, authClient, tokenString, clientIP(r))
+				if err != nil {
+					writeAPITokenError(w, err)
+					return
+				}
+				ctx := context.WithValue(r.Context(), UserContextKey, userCtx)
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
+
 			// Parse and validate token
 			token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
 				return []byte(jwtSecret), nil
@@ -58,12 +148,21 @@ func AuthMiddleware(jwtSecret string) func(http.Handler) http.Handler {
 				return
 			}
 
-			// Extract claims
-			if claims, ok := token.Claims.(*JWTClaims); ok {
+			// Extract claims. Tokens issued before organizations existed
+			// carry none and are treated as invalid; they expire soon anyway.
+			if claims, ok := token.Claims.(*JWTClaims); ok && claims.OrganizationID != "" {
 				// Add user to context
 				userCtx := &UserContext{
-					UserID: claims.UserID,
-					Email:  claims.Email,
+					UserID:         claims.UserID,
+					Email:          claims.Email,
+					OrganizationID: claims.OrganizationID,
+					Roles:          claims.Roles,
+					Permissions:    claims.Permissions,
+					AMR:            claims.AMR,
+					ImpersonatorID: claims.ImpersonatorID,
+				}
+				if claims.AuthTime != 0 {
+					userCtx.AuthTime = time.Unix(claims.AuthTime, 0)
 				}
 				ctx := context.WithValue(r.Context(), UserContextKey, userCtx)
 				next.ServeHTTP(w, r.WithContext(ctx))
@@ -75,6 +174,60 @@ func AuthMiddleware(jwtSecret string) func(http.Handler) http.Handler {
 	}
 }
 
+// RequireScope refuses requests made with an API token that lacks scope
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if user, ok := GetUserFromContext(r.Context()); ok && !user.HasScope(scope) {
+				http.Error(w, "API token lacks the "+scope+" scope", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// validateAPIToken checks an API token with the auth service and returns
+// the user it acts as
+func validateAPIToken(r *http.Request, authClient authpb.AuthServiceClient, token, ip string) (*UserContext, error) {
+	resp, err := authClient.ValidateAPIToken(r.Context(), &authpb.ValidateAPITokenRequest{
+		Token:     token,
+		IpAddress: ip,
+		UserAgent: r.UserAgent(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !resp.Valid {
+		return nil, errInvalidAPIToken
+	}
+
+	return &UserContext{
+		UserID:         resp.UserId,
+		Email:          resp.Email,
+		OrganizationID: resp.OrganizationId,
+		Roles:          resp.Roles,
+		Permissions:    resp.Permissions,
+		TokenID:        resp.TokenId,
+		Scopes:         resp.Scopes,
+	}, nil
+}
+
+// writeAPITokenError answers a request whose API token was refused
+func writeAPITokenError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errInvalidAPIToken):
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		http.Error(w, "invalid API token", http.StatusUnauthorized)
+	case status.Code(err) == codes.PermissionDenied:
+		// The organization's policies don't allow calls from here
+		http.Error(w, status.Convert(err).Message(), http.StatusForbidden)
+	default:
+		log.Printf("Failed to validate API token: %v", err)
+		http.Error(w, "failed to validate API token", http.StatusServiceUnavailable)
+	}
+}
+
 // GetUserFromContext retrieves the user from context
 func GetUserFromContext(ctx context.Context) (*UserContext, bool) {
 	user, ok := ctx.Value(UserContextKey).(*UserContext)
@@ -1,12 +1,18 @@
 package main
 
 import (
+	"context"
+	"crypto/ed25519"
+	"crypto/tls"
+	"crypto/x509"
 	"database/sql"
 	"fmt"
 	"log"
 	"net"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
@@ -14,7 +20,13 @@ import (
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/reflection"
 	"github.com/joho/godotenv"
+	"github.com/aashiq-04/session-management-system/backend/services/audit-service/internal/chain"
+	"github.com/aashiq-04/session-management-system/backend/services/audit-service/internal/forwarding"
 	"github.com/aashiq-04/session-management-system/backend/services/audit-service/internal/handlers"
+	"github.com/aashiq-04/session-management-system/backend/services/audit-service/internal/identity"
+	"github.com/aashiq-04/session-management-system/backend/services/audit-service/internal/notifications"
+	"github.com/aashiq-04/session-management-system/backend/services/audit-service/internal/partitions"
+	"github.com/aashiq-04/session-management-system/backend/services/audit-service/internal/webhooks"
 	pb "github.com/aashiq-04/session-management-system/backend/services/audit-service/proto"
 )
 
@@ -33,13 +45,66 @@ func main() {
 
 	log.Println("Successfully connected to database")
 
-	// Create gRPC server
-	grpcServer := grpc.NewServer()
+	// Make sure this month's audit_logs partition exists before accepting writes
+	partitionManager := partitions.NewManager(db, partitions.Config{
+		PremakeMonths:   config.PartitionPremakeMonths,
+		RetentionMonths: config.RetentionMonths,
+		DropExpired:     config.RetentionDrop,
+		Interval:        config.PartitionInterval,
+		SigningKey:      config.ChainSigningKey,
+	})
+	partitionManager.Maintain()
+
+	// Callers are authenticated with mTLS, and calls made on behalf of a user
+	// carry an identity token signed by the gateway
+	serverCreds, err := identity.ServerCredentials(config.TLSCertFile, config.TLSKeyFile, config.TLSCAFile)
+	if err != nil {
+		log.Fatalf("Failed to load TLS credentials: %v", err)
+	}
+	identityKey, err := identity.LoadPublicKey(config.IdentityPublicKeyFile)
+	if err != nil {
+		log.Fatalf("Failed to load identity public key: %v", err)
+	}
+
+	// Open the disk buffers of the syslog/OTLP forwarding sinks
+	forwarder, err := newForwarder(config)
+	if err != nil {
+		log.Fatalf("Failed to set up audit forwarding: %v", err)
+	}
+
+	auditHandler := handlers.NewAuditHandler(db, chain.NewVerifier(db, config.ChainPublicKeys...), forwarder)
+
+	// Create gRPC server; refused calls are recorded as audit events
+	authenticator := identity.NewAuthenticator(handlers.Policy, identity.NewVerifier(identityKey, identity.AuditService), auditHandler.RecordDenial)
+	grpcServer := grpc.NewServer(
+		grpc.Creds(serverCreds),
+		grpc.UnaryInterceptor(authenticator.UnaryInterceptor()),
+		grpc.StreamInterceptor(authenticator.StreamInterceptor()),
+	)
 
 	// Register audit service
-	auditHandler := handlers.NewAuditHandler(db)
 	pb.RegisterAuditServiceServer(grpcServer, auditHandler)
 
+	// Start background workers for alert notifications, audit event webhooks,
+	// chain checkpoints, forwarding and partition maintenance
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	go forwarder.Run(workerCtx)
+	go partitionManager.Run(workerCtx)
+	go newNotificationDispatcher(db, config).Run(workerCtx)
+	go webhooks.NewDispatcher(db, webhooks.Config{
+		PollInterval: config.WebhookPollInterval,
+		BatchSize:    100,
+		MaxAttempts:  config.WebhookMaxAttempts,
+		RetryBackoff: config.WebhookRetryBackoff,
+		Timeout:      config.WebhookTimeout,
+	}).Run(workerCtx)
+	if config.ChainSigningKey != nil {
+		go chain.NewCheckpointer(db, config.ChainSigningKey, config.ChainCheckpointInterval).Run(workerCtx)
+	} else {
+		log.Println("AUDIT_CHECKPOINT_KEY not set, audit chain checkpoints are disabled")
+	}
+
 	// Enable reflection for grpcurl/grpc-ui
 	reflection.Register(grpcServer)
 
@@ -58,6 +123,7 @@ func main() {
 		<-sigChan
 
 		log.Println("Shutting down Audit Service...")
+		stopWorkers()
 		grpcServer.GracefulStop()
 		log.Println("Audit Service stopped")
 	}()
@@ -76,6 +142,44 @@ type Config struct {
 	DBPassword string
 	DBName     string
 	GRPCPort   string
+
+	TLSCertFile           string
+	TLSKeyFile            string
+	TLSCAFile             string
+	IdentityPublicKeyFile string
+
+	NotifyMinSeverity  string
+	NotifyPollInterval time.Duration
+	NotifyMaxAttempts  int
+	NotifyRetryBackoff time.Duration
+	NotifyLogSink      bool
+	NotifySendTimeout  time.Duration
+	SMTP               notifications.SMTPConfig
+
+	WebhookPollInterval time.Duration
+	WebhookMaxAttempts  int
+	WebhookRetryBackoff time.Duration
+	WebhookTimeout      time.Duration
+
+	ChainSigningKey         ed25519.PrivateKey
+	ChainPublicKeys         []ed25519.PublicKey
+	ChainCheckpointInterval time.Duration
+
+	PartitionPremakeMonths int
+	PartitionInterval      time.Duration
+	RetentionMonths        int
+	RetentionDrop          bool
+
+	ForwardBufferDir    string
+	ForwardMaxBufferMB  int
+	ForwardRetryBackoff time.Duration
+	ForwardTimeout      time.Duration
+	SyslogAddr          string
+	SyslogTLS           bool
+	SyslogTLSCAFile     string
+	SyslogTLSServerName string
+	OTLPLogsEndpoint    string
+	OTLPHeaders         map[string]string
 }
 
 // loadConfig loads configuration from environment variables
@@ -87,11 +191,214 @@ func loadConfig() Config {
 		DBPassword: getEnv("DB_PASSWORD", "admin123"),
 		DBName:     getEnv("DB_NAME", "session_management"),
 		GRPCPort:   getEnv("GRPC_PORT", "50053"),
+
+		TLSCertFile:           getEnv("TLS_CERT_FILE", ""),
+		TLSKeyFile:            getEnv("TLS_KEY_FILE", ""),
+		TLSCAFile:             getEnv("TLS_CA_FILE", ""),
+		IdentityPublicKeyFile: getEnv("IDENTITY_PUBLIC_KEY_FILE", ""),
+
+		RetentionDrop: getEnv("AUDIT_RETENTION_DROP", "false") == "true",
+
+		ForwardBufferDir:    getEnv("FORWARD_BUFFER_DIR", "./data/forwarding"),
+		SyslogAddr:          getEnv("SYSLOG_ADDR", ""),
+		SyslogTLS:           getEnv("SYSLOG_TLS", "false") == "true",
+		SyslogTLSCAFile:     getEnv("SYSLOG_TLS_CA_FILE", ""),
+		SyslogTLSServerName: getEnv("SYSLOG_TLS_SERVER_NAME", ""),
+		OTLPLogsEndpoint:    getEnv("OTLP_LOGS_ENDPOINT", ""),
+
+		NotifyMinSeverity: getEnv("NOTIFY_MIN_SEVERITY", "high"),
+		NotifyLogSink:     getEnv("NOTIFY_LOG_SINK", "true") == "true",
+		SMTP: notifications.SMTPConfig{
+			Host:     getEnv("SMTP_HOST", ""),
+			Port:     getEnv("SMTP_PORT", "587"),
+			Username: getEnv("SMTP_USERNAME", ""),
+			Password: getEnv("SMTP_PASSWORD", ""),
+			From:     getEnv("SMTP_FROM", "security@localhost"),
+		},
+	}
+
+	// Certificates and keys are made by scripts/dev-certs.sh in development
+	if config.TLSCertFile == "" || config.TLSKeyFile == "" || config.TLSCAFile == "" {
+		log.Fatal("TLS_CERT_FILE, TLS_KEY_FILE and TLS_CA_FILE environment variables are required")
+	}
+	if config.IdentityPublicKeyFile == "" {
+		log.Fatal("IDENTITY_PUBLIC_KEY_FILE environment variable is required")
+	}
+
+	if !notifications.ValidSeverity(config.NotifyMinSeverity) {
+		log.Fatalf("Invalid NOTIFY_MIN_SEVERITY: %s", config.NotifyMinSeverity)
+	}
+
+	var err error
+	config.NotifyPollInterval, err = time.ParseDuration(getEnv("NOTIFY_POLL_INTERVAL", "10s"))
+	if err != nil {
+		log.Fatalf("Invalid NOTIFY_POLL_INTERVAL: %v", err)
+	}
+
+	config.NotifyRetryBackoff, err = time.ParseDuration(getEnv("NOTIFY_RETRY_BACKOFF", "30s"))
+	if err != nil {
+		log.Fatalf("Invalid NOTIFY_RETRY_BACKOFF: %v", err)
+	}
+
+	config.NotifySendTimeout, err = time.ParseDuration(getEnv("NOTIFY_SEND_TIMEOUT", "10s"))
+	if err != nil {
+		log.Fatalf("Invalid NOTIFY_SEND_TIMEOUT: %v", err)
+	}
+
+	config.NotifyMaxAttempts, err = strconv.Atoi(getEnv("NOTIFY_MAX_ATTEMPTS", "5"))
+	if err != nil || config.NotifyMaxAttempts < 1 {
+		log.Fatalf("Invalid NOTIFY_MAX_ATTEMPTS: %s", getEnv("NOTIFY_MAX_ATTEMPTS", "5"))
+	}
+
+	config.WebhookPollInterval, err = time.ParseDuration(getEnv("WEBHOOK_POLL_INTERVAL", "5s"))
+	if err != nil {
+		log.Fatalf("Invalid WEBHOOK_POLL_INTERVAL: %v", err)
+	}
+
+	config.WebhookRetryBackoff, err = time.ParseDuration(getEnv("WEBHOOK_RETRY_BACKOFF", "30s"))
+	if err != nil {
+		log.Fatalf("Invalid WEBHOOK_RETRY_BACKOFF: %v", err)
+	}
+
+	config.WebhookTimeout, err = time.ParseDuration(getEnv("WEBHOOK_TIMEOUT", "10s"))
+	if err != nil {
+		log.Fatalf("Invalid WEBHOOK_TIMEOUT: %v", err)
+	}
+
+	config.WebhookMaxAttempts, err = strconv.Atoi(getEnv("WEBHOOK_MAX_ATTEMPTS", "8"))
+	if err != nil || config.WebhookMaxAttempts < 1 {
+		log.Fatalf("Invalid WEBHOOK_MAX_ATTEMPTS: %s", getEnv("WEBHOOK_MAX_ATTEMPTS", "8"))
+	}
+
+	config.ChainSigningKey, config.ChainPublicKeys, err = chain.LoadKeys(getEnv("AUDIT_CHECKPOINT_KEY", ""), getEnv("AUDIT_CHECKPOINT_PUBLIC_KEYS", ""))
+	if err != nil {
+		log.Fatalf("Invalid audit checkpoint keys: %v", err)
+	}
+
+	config.ChainCheckpointInterval, err = time.ParseDuration(getEnv("AUDIT_CHECKPOINT_INTERVAL", "1h"))
+	if err != nil {
+		log.Fatalf("Invalid AUDIT_CHECKPOINT_INTERVAL: %v", err)
+	}
+
+	config.PartitionPremakeMonths, err = strconv.Atoi(getEnv("AUDIT_PARTITION_PREMAKE_MONTHS", "3"))
+	if err != nil || config.PartitionPremakeMonths < 1 {
+		log.Fatalf("Invalid AUDIT_PARTITION_PREMAKE_MONTHS: %s", getEnv("AUDIT_PARTITION_PREMAKE_MONTHS", "3"))
+	}
+
+	config.PartitionInterval, err = time.ParseDuration(getEnv("AUDIT_PARTITION_INTERVAL", "1h"))
+	if err != nil {
+		log.Fatalf("Invalid AUDIT_PARTITION_INTERVAL: %v", err)
+	}
+
+	config.RetentionMonths, err = strconv.Atoi(getEnv("AUDIT_RETENTION_MONTHS", "0"))
+	if err != nil || config.RetentionMonths < 0 {
+		log.Fatalf("Invalid AUDIT_RETENTION_MONTHS: %s", getEnv("AUDIT_RETENTION_MONTHS", "0"))
+	}
+
+	config.ForwardMaxBufferMB, err = strconv.Atoi(getEnv("FORWARD_MAX_BUFFER_MB", "256"))
+	if err != nil || config.ForwardMaxBufferMB < 1 {
+		log.Fatalf("Invalid FORWARD_MAX_BUFFER_MB: %s", getEnv("FORWARD_MAX_BUFFER_MB", "256"))
+	}
+
+	config.ForwardRetryBackoff, err = time.ParseDuration(getEnv("FORWARD_RETRY_BACKOFF", "1s"))
+	if err != nil {
+		log.Fatalf("Invalid FORWARD_RETRY_BACKOFF: %v", err)
+	}
+
+	config.ForwardTimeout, err = time.ParseDuration(getEnv("FORWARD_TIMEOUT", "10s"))
+	if err != nil {
+		log.Fatalf("Invalid FORWARD_TIMEOUT: %v", err)
+	}
+
+	config.OTLPHeaders = make(map[string]string)
+	for _, pair := range strings.Split(getEnv("OTLP_HEADERS", ""), ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			log.Fatalf("Invalid OTLP_HEADERS: expected key=value pairs")
+		}
+		config.OTLPHeaders[strings.TrimSpace(key)] = strings.TrimSpace(value)
 	}
 
 	return config
 }
 
+// newNotificationDispatcher wires up the notification channels enabled in config
+func newNotificationDispatcher(db *sql.DB, config Config) *notifications.Dispatcher {
+	channels := []notifications.Channel{
+		notifications.NewWebhookChannel(config.NotifySendTimeout),
+	}
+
+	if config.SMTP.Host != "" {
+		channels = append(channels, notifications.NewEmailChannel(config.SMTP))
+	} else {
+		log.Println("SMTP_HOST not set, email notifications are disabled")
+	}
+
+	if config.NotifyLogSink {
+		channels = append(channels, notifications.NewLogChannel())
+	}
+
+	return notifications.NewDispatcher(db, notifications.Config{
+		MinSeverity:  config.NotifyMinSeverity,
+		PollInterval: config.NotifyPollInterval,
+		BatchSize:    100,
+		MaxAttempts:  config.NotifyMaxAttempts,
+		RetryBackoff: config.NotifyRetryBackoff,
+		SendTimeout:  config.NotifySendTimeout,
+	}, channels...)
+}
+
+// newForwarder sets up the syslog and OTLP sinks enabled in config
+func newForwarder(config Config) (*forwarding.Forwarder, error) {
+	var sinks []forwarding.Sink
+
+	if config.SyslogAddr != "" {
+		syslogConfig := forwarding.SyslogConfig{
+			Address: config.SyslogAddr,
+			AppName: "audit-service",
+			Timeout: config.ForwardTimeout,
+		}
+		if config.SyslogTLS {
+			tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12, ServerName: config.SyslogTLSServerName}
+			if config.SyslogTLSCAFile != "" {
+				pem, err := os.ReadFile(config.SyslogTLSCAFile)
+				if err != nil {
+					return nil, fmt.Errorf("failed to read SYSLOG_TLS_CA_FILE: %w", err)
+				}
+				tlsConfig.RootCAs = x509.NewCertPool()
+				if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+					return nil, fmt.Errorf("no certificates found in SYSLOG_TLS_CA_FILE")
+				}
+			}
+			syslogConfig.TLS = tlsConfig
+		}
+		sinks = append(sinks, forwarding.NewSyslogSink(syslogConfig))
+	}
+
+	if config.OTLPLogsEndpoint != "" {
+		sinks = append(sinks, forwarding.NewOTLPSink(forwarding.OTLPConfig{
+			Endpoint: config.OTLPLogsEndpoint,
+			Headers:  config.OTLPHeaders,
+			Timeout:  config.ForwardTimeout,
+		}))
+	}
+
+	if len(sinks) == 0 {
+		log.Println("SYSLOG_ADDR and OTLP_LOGS_ENDPOINT not set, audit forwarding is disabled")
+	}
+
+	return forwarding.New(forwarding.Config{
+		BufferDir:       config.ForwardBufferDir,
+		MaxBufferBytes:  int64(config.ForwardMaxBufferMB) << 20,
+		BatchSize:       100,
+		RetryBackoff:    config.ForwardRetryBackoff,
+		MaxRetryBackoff: 5 * time.Minute,
+	}, sinks...)
+}
+
 // getEnv gets an environment variable or returns a default value
 func getEnv(key, defaultValue string) string {
 	value := os.Getenv(key)
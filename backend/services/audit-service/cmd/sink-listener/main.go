@@ -0,0 +1,122 @@
+// Command sink-listener is a local syslog and OTLP receiver that prints what
+// the audit service forwards, for trying out forwarding without a SIEM.
+// Point SYSLOG_ADDR at -syslog and OTLP_LOGS_ENDPOINT at http://<-otlp>.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+func main() {
+	syslogAddr := flag.String("syslog", "localhost:6514", "Address to accept syslog over TCP on, empty to disable")
+	otlpAddr := flag.String("otlp", "localhost:4318", "Address to accept OTLP/HTTP logs on, empty to disable")
+	otlpStatus := flag.Int("otlp-status", http.StatusOK, "Status code to answer OTLP requests with, to simulate collector errors")
+	flag.Parse()
+
+	if *syslogAddr != "" {
+		listener, err := net.Listen("tcp", *syslogAddr)
+		if err != nil {
+			log.Fatalf("Failed to listen for syslog: %v", err)
+		}
+		log.Printf("Listening for syslog on %s", *syslogAddr)
+		go acceptSyslog(listener)
+	}
+
+	if *otlpAddr == "" {
+		select {}
+	}
+
+	http.HandleFunc("/v1/logs", func(w http.ResponseWriter, r *http.Request) {
+		printOTLP(r.Body)
+		w.WriteHeader(*otlpStatus)
+	})
+	log.Printf("Listening for OTLP logs on http://%s/v1/logs", *otlpAddr)
+	log.Fatal(http.ListenAndServe(*otlpAddr, nil))
+}
+
+func acceptSyslog(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			log.Printf("Failed to accept syslog connection: %v", err)
+			continue
+		}
+		go readSyslog(conn)
+	}
+}
+
+// readSyslog prints octet-counted (RFC 6587) syslog frames
+func readSyslog(conn net.Conn) {
+	defer conn.Close()
+	log.Printf("syslog: connection from %s", conn.RemoteAddr())
+
+	reader := bufio.NewReader(conn)
+	for {
+		length, err := reader.ReadString(' ')
+		if err != nil {
+			if err != io.EOF {
+				log.Printf("syslog: %v", err)
+			}
+			return
+		}
+
+		n, err := strconv.Atoi(strings.TrimSpace(length))
+		if err != nil || n <= 0 {
+			log.Printf("syslog: bad frame length %q, closing", length)
+			return
+		}
+
+		msg := make([]byte, n)
+		if _, err := io.ReadFull(reader, msg); err != nil {
+			log.Printf("syslog: %v", err)
+			return
+		}
+		fmt.Printf("syslog: %s\n", msg)
+	}
+}
+
+// printOTLP prints the body and attributes of each log record in a request
+func printOTLP(body io.Reader) {
+	var req struct {
+		ResourceLogs []struct {
+			ScopeLogs []struct {
+				LogRecords []struct {
+					SeverityText string `json:"severityText"`
+					Body         struct {
+						StringValue string `json:"stringValue"`
+					} `json:"body"`
+					Attributes []struct {
+						Key   string                 `json:"key"`
+						Value map[string]interface{} `json:"value"`
+					} `json:"attributes"`
+				} `json:"logRecords"`
+			} `json:"scopeLogs"`
+		} `json:"resourceLogs"`
+	}
+	if err := json.NewDecoder(body).Decode(&req); err != nil {
+		log.Printf("otlp: invalid request: %v", err)
+		return
+	}
+
+	for _, resource := range req.ResourceLogs {
+		for _, scope := range resource.ScopeLogs {
+			for _, record := range scope.LogRecords {
+				fmt.Printf("otlp: [%s] %s\n", record.SeverityText, record.Body.StringValue)
+				for _, attribute := range record.Attributes {
+					for _, value := range attribute.Value {
+						fmt.Printf("      %s=%v\n", attribute.Key, value)
+					}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,68 @@
+// Package authz decides whether the authenticated caller may act on a
+// resource. Users may act on their own resources, users whose role grants
+// the action's permission on those of their organization's members, and
+// admins on anyone's; every refusal is recorded in the audit log.
+package authz
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"google.golang.org/grpc"
+
+	"github.com/aashiq-04/session-management-system/backend/services/audit-service/internal/grpcerr"
+	"github.com/aashiq-04/session-management-system/backend/services/audit-service/internal/identity"
+)
+
+// ReasonNotOwner is attached to errors for resources of another user
+const ReasonNotOwner = "NOT_OWNER"
+
+// Authorizer checks access to resources
+type Authorizer struct {
+	record identity.DenialRecorder
+}
+
+// New creates an authorizer passing every refusal to record
+func New(record identity.DenialRecorder) *Authorizer {
+	return &Authorizer{record: record}
+}
+
+// IsAdmin reports whether the caller may act on any user's resources.
+// Operators calling with the ops certificate, on no user's behalf, can.
+func IsAdmin(ctx context.Context) bool {
+	caller, _ := identity.CallerFromContext(ctx)
+	_, hasSubject := identity.SubjectFromContext(ctx)
+	return caller == identity.Ops && !hasSubject
+}
+
+// RequireOwner returns a PermissionDenied error unless the caller acts for
+// ownerID, holds permission in the owner's organization or is an admin. An
+// empty permission leaves the resource to its owner and admins.
+func (a *Authorizer) RequireOwner(ctx context.Context, resourceType, resourceID, ownerID, ownerOrganizationID, permission string) error {
+	subject, ok := identity.SubjectFromContext(ctx)
+	if ok && subject == ownerID {
+		return nil
+	}
+	if permission != "" && identity.HasPermission(ctx, permission) && identity.InTenant(ctx, ownerOrganizationID) {
+		return nil
+	}
+	if IsAdmin(ctx) {
+		return nil
+	}
+
+	method, _ := grpc.Method(ctx)
+	caller, _ := identity.CallerFromContext(ctx)
+	log.Printf("Refused %s from %q for user %q: %s %s belongs to another user", method, caller, subject, resourceType, resourceID)
+	a.record(identity.Denial{
+		Method:       method,
+		Caller:       caller,
+		Subject:      subject,
+		Reason:       ReasonNotOwner,
+		ResourceType: resourceType,
+		ResourceID:   resourceID,
+	})
+
+	name := strings.ReplaceAll(resourceType, "_", " ")
+	return grpcerr.PermissionDenied(strings.ToUpper(name[:1])+name[1:]+" belongs to another user", ReasonNotOwner)
+}
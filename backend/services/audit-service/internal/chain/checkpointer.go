@@ -0,0 +1,83 @@
+package chain
+
+import (
+	"context"
+	"crypto/ed25519"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/aashiq-04/session-management-system/backend/services/audit-service/internal/models"
+	"github.com/aashiq-04/session-management-system/backend/services/audit-service/internal/repository"
+)
+
+// Checkpointer periodically signs the audit chain head, so rewriting the chain
+// from some point onwards can't go unnoticed even by someone who can recompute hashes
+type Checkpointer struct {
+	repo     *repository.AuditRepository
+	key      ed25519.PrivateKey
+	interval time.Duration
+}
+
+// NewCheckpointer creates a new checkpointer
+func NewCheckpointer(db *sql.DB, key ed25519.PrivateKey, interval time.Duration) *Checkpointer {
+	return &Checkpointer{
+		repo:     repository.NewAuditRepository(db),
+		key:      key,
+		interval: interval,
+	}
+}
+
+// Run signs a checkpoint every interval until ctx is cancelled
+func (c *Checkpointer) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := c.checkpoint(); err != nil {
+			log.Printf("Failed to checkpoint audit chain: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkpoint signs the current chain head if it moved since the last checkpoint
+func (c *Checkpointer) checkpoint() error {
+	sequence, entryHash, err := c.repo.GetAuditChainHead()
+	if err != nil {
+		return err
+	}
+	if sequence == 0 {
+		return nil
+	}
+
+	latest, err := c.repo.GetLatestAuditChainCheckpoint()
+	if err != nil {
+		return err
+	}
+	if latest != nil && latest.Sequence >= sequence {
+		return nil
+	}
+
+	checkpoint := &models.AuditChainCheckpoint{
+		ID:        uuid.New().String(),
+		Sequence:  sequence,
+		EntryHash: entryHash,
+		CreatedAt: time.Now().Truncate(time.Second),
+	}
+	signCheckpoint(c.key, checkpoint)
+
+	if err := c.repo.CreateAuditChainCheckpoint(checkpoint); err != nil {
+		return err
+	}
+
+	log.Printf("Signed audit chain checkpoint at sequence %d", sequence)
+	return nil
+}
@@ -0,0 +1,53 @@
+package chain
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+
+	"github.com/aashiq-04/session-management-system/backend/services/audit-service/internal/models"
+)
+
+func TestTombstoneSignature(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPublic, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signed := func() *models.AuditLogTombstone {
+		tombstone := &models.AuditLogTombstone{
+			FirstSequence: 10,
+			Sequence:      20,
+			EntryHash:     "ab",
+			PartitionName: "audit_logs_y2026m01",
+		}
+		SignTombstone(private, tombstone)
+		return tombstone
+	}
+
+	if tombstone := signed(); tombstone.KeyID != KeyID(public) || !verifyTombstone(public, tombstone) {
+		t.Fatal("signed tombstone does not verify")
+	}
+	if verifyTombstone(otherPublic, signed()) {
+		t.Error("tombstone verifies with another key")
+	}
+
+	tampered := map[string]func(*models.AuditLogTombstone){
+		"first sequence": func(tombstone *models.AuditLogTombstone) { tombstone.FirstSequence = 1 },
+		"sequence":       func(tombstone *models.AuditLogTombstone) { tombstone.Sequence = 30 },
+		"entry hash":     func(tombstone *models.AuditLogTombstone) { tombstone.EntryHash = "cd" },
+		"partition":      func(tombstone *models.AuditLogTombstone) { tombstone.PartitionName = "audit_logs_y2026m02" },
+		"unsigned":       func(tombstone *models.AuditLogTombstone) { tombstone.Signature = "" },
+	}
+	for name, tamper := range tampered {
+		tombstone := signed()
+		tamper(tombstone)
+		if verifyTombstone(public, tombstone) {
+			t.Errorf("tombstone with a changed %s still verifies", name)
+		}
+	}
+}
@@ -0,0 +1,264 @@
+package chain
+
+import (
+	"crypto/ed25519"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aashiq-04/session-management-system/backend/services/audit-service/internal/models"
+	"github.com/aashiq-04/session-management-system/backend/services/audit-service/internal/repository"
+)
+
+// errStopWalk ends a chain walk once a break is found
+var errStopWalk = errors.New("stop walk")
+
+// Break describes the first point where the chain doesn't verify
+type Break struct {
+	Sequence   int64
+	AuditLogID string // empty when the entry is missing
+	Reason     string
+}
+
+// Report is the outcome of verifying part of the chain
+type Report struct {
+	FirstSequence      int64
+	LastSequence       int64
+	EntriesChecked     int
+	EntriesRedacted    int // entries whose personal data was erased since they were chained
+	CheckpointsChecked int
+	Break              *Break // nil when the range verified
+}
+
+// Verifier checks audit log entries against their hashes, links and signed checkpoints
+type Verifier struct {
+	repo *repository.AuditRepository
+	keys map[string]ed25519.PublicKey
+}
+
+// NewVerifier creates a verifier that accepts checkpoints signed by any of keys
+func NewVerifier(db *sql.DB, keys ...ed25519.PublicKey) *Verifier {
+	byID := make(map[string]ed25519.PublicKey, len(keys))
+	for _, key := range keys {
+		byID[KeyID(key)] = key
+	}
+
+	return &Verifier{
+		repo: repository.NewAuditRepository(db),
+		keys: byID,
+	}
+}
+
+// Verify walks the entries created within the time range in chain order and
+// reports the first break. Checkpoint signatures are only checked when the
+// verifier has keys, and gaps left by retention only verify with them.
+func (v *Verifier) Verify(startTime, endTime time.Time) (*Report, error) {
+	first, last, err := v.repo.GetAuditChainBounds(startTime, endTime)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{FirstSequence: first, LastSequence: last}
+	if first == 0 {
+		return report, nil
+	}
+
+	// Anchor the walk on the entry before the range, or its tombstone if
+	// retention dropped it
+	prevHash := repository.GenesisHash
+	if first > 1 {
+		prev, err := v.repo.GetAuditLogBySequence(first - 1)
+		if err != nil {
+			return nil, err
+		}
+		if prev != nil {
+			prevHash = prev.EntryHash
+		} else {
+			tombstone, reason, err := v.bridge(first-1, first-1)
+			if err != nil {
+				return nil, err
+			}
+			if reason != "" {
+				report.Break = &Break{Sequence: first - 1, Reason: reason}
+				return report, nil
+			}
+			prevHash = tombstone
+		}
+	}
+
+	checkpoints, err := v.repo.GetAuditChainCheckpoints(first, last)
+	if err != nil {
+		return nil, err
+	}
+	bySequence := make(map[int64][]models.AuditChainCheckpoint)
+	for _, checkpoint := range checkpoints {
+		bySequence[checkpoint.Sequence] = append(bySequence[checkpoint.Sequence], checkpoint)
+	}
+
+	expected := first
+	err = v.repo.WalkAuditChain(first, last, func(entry *models.AuditLog) error {
+		if entry.Sequence != expected {
+			// A gap is only allowed where retention dropped partitions, which
+			// leaves signed tombstones covering every missing entry
+			tombstone, reason, err := v.bridge(expected, entry.Sequence-1)
+			if err != nil {
+				return err
+			}
+			if reason != "" {
+				report.Break = &Break{Sequence: expected, Reason: reason}
+				return errStopWalk
+			}
+			prevHash = tombstone
+			expected = entry.Sequence
+		}
+		if entry.PrevHash != prevHash {
+			report.Break = &Break{Sequence: entry.Sequence, AuditLogID: entry.ID, Reason: "previous hash does not match the previous entry"}
+			return errStopWalk
+		}
+		if repository.AuditLogHash(entry) != entry.EntryHash {
+			redacted, err := v.redacted(entry)
+			if err != nil {
+				return err
+			}
+			if !redacted {
+				report.Break = &Break{Sequence: entry.Sequence, AuditLogID: entry.ID, Reason: "entry contents do not match its hash"}
+				return errStopWalk
+			}
+			report.EntriesRedacted++
+		}
+
+		for i := range bySequence[entry.Sequence] {
+			if reason := v.checkCheckpoint(&bySequence[entry.Sequence][i], entry.EntryHash); reason != "" {
+				report.Break = &Break{Sequence: entry.Sequence, AuditLogID: entry.ID, Reason: reason}
+				return errStopWalk
+			}
+			report.CheckpointsChecked++
+		}
+
+		report.EntriesChecked++
+		prevHash = entry.EntryHash
+		expected++
+		return nil
+	})
+	if err != nil && err != errStopWalk {
+		return nil, err
+	}
+	if report.Break != nil {
+		return report, nil
+	}
+
+	if expected <= last {
+		report.Break = &Break{Sequence: expected, Reason: "entry is missing"}
+		return report, nil
+	}
+
+	// Entries removed from the end of the chain leave no gap, so compare the
+	// stored tail against the latest checkpoint and the chain head. They are
+	// read before the tail so concurrent writes can't look like truncation.
+	latest, err := v.repo.GetLatestAuditChainCheckpoint()
+	if err != nil {
+		return nil, err
+	}
+	headSequence, headHash, err := v.repo.GetAuditChainHead()
+	if err != nil {
+		return nil, err
+	}
+	stored, err := v.repo.GetLastAuditLogSequence()
+	if err != nil {
+		return nil, err
+	}
+
+	if stored == last {
+		if latest != nil && latest.Sequence > last {
+			report.Break = &Break{Sequence: last + 1, Reason: fmt.Sprintf("checkpoint covers sequence %d but the last stored entry is %d", latest.Sequence, last)}
+			return report, nil
+		}
+		if (headSequence != last || headHash != prevHash) && !v.headExpired(headSequence, headHash) {
+			report.Break = &Break{Sequence: last + 1, Reason: fmt.Sprintf("chain head is at sequence %d but the last stored entry is %d", headSequence, last)}
+			return report, nil
+		}
+	}
+
+	return report, nil
+}
+
+// redacted reports whether an entry that no longer matches its hash had its
+// personal data erased, and nothing else changed since. The entry hash
+// commits to the personal data separately, so an entry with the personal
+// data hash recorded by the redaction matches its hash only if every other
+// field is unchanged.
+func (v *Verifier) redacted(entry *models.AuditLog) (bool, error) {
+	if !repository.IsScrubbed(entry) {
+		return false, nil
+	}
+
+	personalDataHash, err := v.repo.GetAuditLogRedaction(entry.Sequence)
+	if err != nil {
+		return false, err
+	}
+
+	return personalDataHash != "" && repository.AuditLogHashWithPersonalData(entry, personalDataHash) == entry.EntryHash, nil
+}
+
+// bridge returns the hash of the entry at last if retention dropped every
+// entry from first through last, or why the gap can't be bridged. Each
+// expired partition leaves a signed tombstone per run of entries, so the
+// gap is walked back from last one run at a time.
+func (v *Verifier) bridge(first, last int64) (string, string, error) {
+	var entryHash string
+	for end := last; end >= first; {
+		tombstone, err := v.repo.GetAuditLogTombstone(end)
+		if err != nil {
+			return "", "", err
+		}
+		if tombstone == nil {
+			return "", "entry is missing", nil
+		}
+		if !v.tombstoneSigned(tombstone) {
+			return "", fmt.Sprintf("tombstone for sequence %d is not signed by a known key", end), nil
+		}
+
+		if entryHash == "" {
+			entryHash = tombstone.EntryHash
+		}
+		end = tombstone.FirstSequence - 1
+	}
+
+	return entryHash, "", nil
+}
+
+// tombstoneSigned reports whether a tombstone was signed by one of the
+// verifier's keys. Unlike checkpoints, tombstones never verify without keys,
+// since anyone who can delete entries can also record a tombstone.
+func (v *Verifier) tombstoneSigned(tombstone *models.AuditLogTombstone) bool {
+	key, ok := v.keys[tombstone.KeyID]
+	return ok && tombstone.FirstSequence > 0 && tombstone.FirstSequence <= tombstone.Sequence && verifyTombstone(key, tombstone)
+}
+
+// headExpired reports whether the chain head entry was dropped by retention,
+// which happens when its timestamp put it in an old partition
+func (v *Verifier) headExpired(headSequence int64, headHash string) bool {
+	tombstone, err := v.repo.GetAuditLogTombstone(headSequence)
+	return err == nil && tombstone != nil && tombstone.EntryHash == headHash && v.tombstoneSigned(tombstone)
+}
+
+// checkCheckpoint returns why a checkpoint doesn't match the entry hash, or "" if it does
+func (v *Verifier) checkCheckpoint(checkpoint *models.AuditChainCheckpoint, entryHash string) string {
+	if checkpoint.EntryHash != entryHash {
+		return fmt.Sprintf("entry does not match checkpoint %s", checkpoint.ID)
+	}
+	if len(v.keys) == 0 {
+		return ""
+	}
+
+	key, ok := v.keys[checkpoint.KeyID]
+	if !ok {
+		return fmt.Sprintf("checkpoint %s is signed with unknown key %s", checkpoint.ID, checkpoint.KeyID)
+	}
+	if !verifyCheckpoint(key, checkpoint) {
+		return fmt.Sprintf("checkpoint %s has an invalid signature", checkpoint.ID)
+	}
+
+	return ""
+}
@@ -0,0 +1,562 @@
+package chain
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"fmt"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"github.com/aashiq-04/session-management-system/backend/services/audit-service/internal/models"
+	"github.com/aashiq-04/session-management-system/backend/services/audit-service/internal/repository"
+)
+
+var chainStart = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+// newTestChain returns entries 1 through n, each linked to the one before
+func newTestChain(n int) []models.AuditLog {
+	entries := make([]models.AuditLog, n)
+	prevHash := repository.GenesisHash
+	for i := range entries {
+		userID, ip, userAgent, city := "user-1", "203.0.113.7", "Firefox", "Paris"
+		metadata := fmt.Sprintf(`{"attempt":%d}`, i+1)
+		entries[i] = models.AuditLog{
+			ID:            fmt.Sprintf("log-%d", i+1),
+			UserID:        &userID,
+			EventType:     "login_success",
+			EventCategory: "authentication",
+			Severity:      "info",
+			IPAddress:     &ip,
+			UserAgent:     &userAgent,
+			LocationCity:  &city,
+			Metadata:      &metadata,
+			Success:       true,
+			CreatedAt:     chainStart.Add(time.Duration(i) * time.Minute),
+			Sequence:      int64(i + 1),
+			PrevHash:      prevHash,
+		}
+		entries[i].EntryHash = repository.AuditLogHash(&entries[i])
+		prevHash = entries[i].EntryHash
+	}
+	return entries
+}
+
+// newTestVerifier returns a verifier trusting keys, reading from a mock
+// database which fails the test on any statement not expected of it
+func newTestVerifier(t *testing.T, keys ...ed25519.PublicKey) (*Verifier, sqlmock.Sqlmock) {
+	t.Helper()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+		db.Close()
+	})
+
+	return NewVerifier(db, keys...), mock
+}
+
+func newTestKey(t *testing.T) (ed25519.PublicKey, ed25519.PrivateKey) {
+	t.Helper()
+
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return public, private
+}
+
+// testCheckpoint returns a checkpoint of entry signed with key
+func testCheckpoint(key ed25519.PrivateKey, entry models.AuditLog) models.AuditChainCheckpoint {
+	checkpoint := models.AuditChainCheckpoint{
+		ID:        fmt.Sprintf("checkpoint-%d", entry.Sequence),
+		Sequence:  entry.Sequence,
+		EntryHash: entry.EntryHash,
+		CreatedAt: entry.CreatedAt.Add(time.Second),
+	}
+	signCheckpoint(key, &checkpoint)
+	return checkpoint
+}
+
+var checkpointColumns = []string{"id", "sequence", "entry_hash", "key_id", "signature", "created_at"}
+
+func checkpointRows(checkpoints ...models.AuditChainCheckpoint) *sqlmock.Rows {
+	rows := sqlmock.NewRows(checkpointColumns)
+	for _, c := range checkpoints {
+		rows.AddRow(c.ID, c.Sequence, c.EntryHash, c.KeyID, c.Signature, c.CreatedAt)
+	}
+	return rows
+}
+
+func expectBounds(mock sqlmock.Sqlmock, first, last int64) {
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT MIN(sequence), MAX(sequence)")).
+		WillReturnRows(sqlmock.NewRows([]string{"min", "max"}).AddRow(first, last))
+}
+
+func expectCheckpoints(mock sqlmock.Sqlmock, first, last int64, checkpoints ...models.AuditChainCheckpoint) {
+	mock.ExpectQuery(regexp.QuoteMeta("ORDER BY sequence, created_at")).
+		WithArgs(first, last).
+		WillReturnRows(checkpointRows(checkpoints...))
+}
+
+// expectEntries expects a read of the stored entries between two sequences
+func expectEntries(mock sqlmock.Sqlmock, from, to int64, limit int, entries ...models.AuditLog) {
+	rows := sqlmock.NewRows([]string{
+		"id", "user_id", "session_id", "device_id", "event_type", "event_category",
+		"severity", "ip_address", "user_agent", "location_country", "location_city",
+		"metadata", "success", "failure_reason", "created_at",
+		"sequence", "prev_hash", "entry_hash",
+	})
+	for _, e := range entries {
+		rows.AddRow(e.ID, e.UserID, e.SessionID, e.DeviceID, e.EventType, e.EventCategory,
+			e.Severity, e.IPAddress, e.UserAgent, e.LocationCountry, e.LocationCity,
+			e.Metadata, e.Success, e.FailureReason, e.CreatedAt,
+			e.Sequence, e.PrevHash, e.EntryHash)
+	}
+	mock.ExpectQuery(regexp.QuoteMeta("sequence, prev_hash, entry_hash")).
+		WithArgs(from, to, limit).
+		WillReturnRows(rows)
+}
+
+// expectTail expects the reads comparing the end of the walk with the
+// latest checkpoint, the chain head and the last stored entry
+func expectTail(mock sqlmock.Sqlmock, latest *models.AuditChainCheckpoint, head models.AuditLog, stored int64) {
+	if latest != nil {
+		mock.ExpectQuery(regexp.QuoteMeta("ORDER BY sequence DESC, created_at DESC")).
+			WillReturnRows(checkpointRows(*latest))
+	} else {
+		mock.ExpectQuery(regexp.QuoteMeta("ORDER BY sequence DESC, created_at DESC")).
+			WillReturnRows(checkpointRows())
+	}
+	mock.ExpectQuery(regexp.QuoteMeta("FROM audit_chain_head")).
+		WillReturnRows(sqlmock.NewRows([]string{"sequence", "entry_hash"}).AddRow(head.Sequence, head.EntryHash))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT MAX(sequence) FROM audit_logs")).
+		WillReturnRows(sqlmock.NewRows([]string{"max"}).AddRow(stored))
+}
+
+// expectTombstone expects a lookup of the tombstone ending at sequence, nil
+// for none
+func expectTombstone(mock sqlmock.Sqlmock, sequence int64, tombstone *models.AuditLogTombstone) {
+	rows := sqlmock.NewRows([]string{"first_sequence", "sequence", "entry_hash", "partition_name", "key_id", "signature"})
+	if tombstone != nil {
+		rows.AddRow(tombstone.FirstSequence, tombstone.Sequence, tombstone.EntryHash, tombstone.PartitionName, tombstone.KeyID, tombstone.Signature)
+	}
+	mock.ExpectQuery(regexp.QuoteMeta("FROM audit_log_tombstones")).
+		WithArgs(sequence).
+		WillReturnRows(rows)
+}
+
+func expectRedaction(mock sqlmock.Sqlmock, sequence int64, personalDataHash string) {
+	rows := sqlmock.NewRows([]string{"personal_data_hash"})
+	if personalDataHash != "" {
+		rows.AddRow(personalDataHash)
+	}
+	mock.ExpectQuery(regexp.QuoteMeta("FROM audit_log_redactions")).
+		WithArgs(sequence).
+		WillReturnRows(rows)
+}
+
+// verify verifies the whole chain
+func verify(t *testing.T, verifier *Verifier) *Report {
+	t.Helper()
+
+	report, err := verifier.Verify(chainStart, chainStart.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return report
+}
+
+func checkBreak(t *testing.T, report *Report, want Break) {
+	t.Helper()
+
+	if report.Break == nil {
+		t.Fatalf("chain verified, want a break at sequence %d: %s", want.Sequence, want.Reason)
+	}
+	if *report.Break != want {
+		t.Errorf("break = %+v, want %+v", *report.Break, want)
+	}
+}
+
+func TestVerifyIntactChain(t *testing.T) {
+	public, private := newTestKey(t)
+	entries := newTestChain(5)
+	checkpoint := testCheckpoint(private, entries[2])
+	latest := testCheckpoint(private, entries[4])
+
+	verifier, mock := newTestVerifier(t, public)
+	expectBounds(mock, 1, 5)
+	expectCheckpoints(mock, 1, 5, checkpoint, latest)
+	expectEntries(mock, 1, 5, 1000, entries...)
+	expectTail(mock, &latest, entries[4], 5)
+
+	report := verify(t, verifier)
+
+	if report.Break != nil {
+		t.Fatalf("unexpected break %+v", *report.Break)
+	}
+	if report.FirstSequence != 1 || report.LastSequence != 5 || report.EntriesChecked != 5 ||
+		report.CheckpointsChecked != 2 || report.EntriesRedacted != 0 {
+		t.Errorf("unexpected report %+v", report)
+	}
+}
+
+// A range after the start of the chain is anchored on the entry before it
+func TestVerifyRangeAnchoredOnPreviousEntry(t *testing.T) {
+	entries := newTestChain(5)
+
+	t.Run("intact", func(t *testing.T) {
+		verifier, mock := newTestVerifier(t)
+		expectBounds(mock, 3, 5)
+		expectEntries(mock, 2, 2, 1, entries[1])
+		expectCheckpoints(mock, 3, 5)
+		expectEntries(mock, 3, 5, 1000, entries[2:]...)
+		expectTail(mock, nil, entries[4], 5)
+
+		if report := verify(t, verifier); report.Break != nil || report.EntriesChecked != 3 {
+			t.Errorf("unexpected report %+v", report)
+		}
+	})
+
+	t.Run("previous entry changed", func(t *testing.T) {
+		previous := entries[1]
+		previous.EntryHash = repository.AuditLogHash(&models.AuditLog{ID: "other"})
+
+		verifier, mock := newTestVerifier(t)
+		expectBounds(mock, 3, 5)
+		expectEntries(mock, 2, 2, 1, previous)
+		expectCheckpoints(mock, 3, 5)
+		expectEntries(mock, 3, 5, 1000, entries[2:]...)
+
+		checkBreak(t, verify(t, verifier), Break{Sequence: 3, AuditLogID: "log-3", Reason: "previous hash does not match the previous entry"})
+	})
+}
+
+func TestVerifyModifiedEntry(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*models.AuditLog)
+		reason string
+	}{
+		{
+			name:   "event type",
+			modify: func(e *models.AuditLog) { e.EventType = "login_failed" },
+			reason: "entry contents do not match its hash",
+		},
+		{
+			name:   "personal data",
+			modify: func(e *models.AuditLog) { ip := "198.51.100.1"; e.IPAddress = &ip },
+			reason: "entry contents do not match its hash",
+		},
+		{
+			// Recomputing the hash doesn't help, as the next entry links to the old one
+			name: "rehashed",
+			modify: func(e *models.AuditLog) {
+				e.Success = false
+				e.EntryHash = repository.AuditLogHash(e)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries := newTestChain(5)
+			tt.modify(&entries[2])
+
+			verifier, mock := newTestVerifier(t)
+			expectBounds(mock, 1, 5)
+			expectCheckpoints(mock, 1, 5)
+			expectEntries(mock, 1, 5, 1000, entries...)
+
+			want := Break{Sequence: 3, AuditLogID: "log-3", Reason: tt.reason}
+			if tt.reason == "" {
+				want = Break{Sequence: 4, AuditLogID: "log-4", Reason: "previous hash does not match the previous entry"}
+			}
+			checkBreak(t, verify(t, verifier), want)
+		})
+	}
+}
+
+func TestVerifyDeletedEntry(t *testing.T) {
+	public, private := newTestKey(t)
+	entries := newTestChain(5)
+	remaining := append(append([]models.AuditLog{}, entries[:2]...), entries[3:]...)
+
+	t.Run("no tombstone", func(t *testing.T) {
+		verifier, mock := newTestVerifier(t, public)
+		expectBounds(mock, 1, 5)
+		expectCheckpoints(mock, 1, 5)
+		expectEntries(mock, 1, 5, 1000, remaining...)
+		expectTombstone(mock, 3, nil)
+
+		checkBreak(t, verify(t, verifier), Break{Sequence: 3, Reason: "entry is missing"})
+	})
+
+	// Anyone who can delete entries can also record a tombstone, so only a
+	// signed one bridges the gap
+	t.Run("unsigned tombstone", func(t *testing.T) {
+		tombstone := &models.AuditLogTombstone{FirstSequence: 3, Sequence: 3, EntryHash: entries[2].EntryHash, PartitionName: "audit_logs_y2026m03"}
+
+		verifier, mock := newTestVerifier(t, public)
+		expectBounds(mock, 1, 5)
+		expectCheckpoints(mock, 1, 5)
+		expectEntries(mock, 1, 5, 1000, remaining...)
+		expectTombstone(mock, 3, tombstone)
+
+		checkBreak(t, verify(t, verifier), Break{Sequence: 3, Reason: "tombstone for sequence 3 is not signed by a known key"})
+	})
+
+	t.Run("tombstone signed by another key", func(t *testing.T) {
+		_, otherPrivate := newTestKey(t)
+		tombstone := &models.AuditLogTombstone{FirstSequence: 3, Sequence: 3, EntryHash: entries[2].EntryHash, PartitionName: "audit_logs_y2026m03"}
+		SignTombstone(otherPrivate, tombstone)
+
+		verifier, mock := newTestVerifier(t, public)
+		expectBounds(mock, 1, 5)
+		expectCheckpoints(mock, 1, 5)
+		expectEntries(mock, 1, 5, 1000, remaining...)
+		expectTombstone(mock, 3, tombstone)
+
+		checkBreak(t, verify(t, verifier), Break{Sequence: 3, Reason: "tombstone for sequence 3 is not signed by a known key"})
+	})
+
+	// Retention drops whole runs of entries and signs a tombstone for each
+	t.Run("signed tombstone", func(t *testing.T) {
+		tombstone := &models.AuditLogTombstone{FirstSequence: 2, Sequence: 3, EntryHash: entries[2].EntryHash, PartitionName: "audit_logs_y2026m03"}
+		SignTombstone(private, tombstone)
+
+		verifier, mock := newTestVerifier(t, public)
+		expectBounds(mock, 1, 5)
+		expectCheckpoints(mock, 1, 5)
+		expectEntries(mock, 1, 5, 1000, entries[0], entries[3], entries[4])
+		expectTombstone(mock, 3, tombstone)
+		expectTail(mock, nil, entries[4], 5)
+
+		report := verify(t, verifier)
+		if report.Break != nil || report.EntriesChecked != 3 {
+			t.Errorf("unexpected report %+v", report)
+		}
+	})
+
+	t.Run("tombstone short of the gap", func(t *testing.T) {
+		tombstone := &models.AuditLogTombstone{FirstSequence: 3, Sequence: 3, EntryHash: entries[2].EntryHash, PartitionName: "audit_logs_y2026m03"}
+		SignTombstone(private, tombstone)
+
+		verifier, mock := newTestVerifier(t, public)
+		expectBounds(mock, 1, 5)
+		expectCheckpoints(mock, 1, 5)
+		expectEntries(mock, 1, 5, 1000, entries[0], entries[3], entries[4])
+		expectTombstone(mock, 3, tombstone)
+		expectTombstone(mock, 2, nil)
+
+		checkBreak(t, verify(t, verifier), Break{Sequence: 2, Reason: "entry is missing"})
+	})
+}
+
+// Entries deleted from the end of the chain leave no gap; the checkpoint and
+// chain head still remember them
+func TestVerifyTruncatedChain(t *testing.T) {
+	public, private := newTestKey(t)
+	entries := newTestChain(5)
+
+	t.Run("before the last checkpoint", func(t *testing.T) {
+		latest := testCheckpoint(private, entries[4])
+
+		verifier, mock := newTestVerifier(t, public)
+		expectBounds(mock, 1, 3)
+		expectCheckpoints(mock, 1, 3)
+		expectEntries(mock, 1, 3, 1000, entries[:3]...)
+		expectTail(mock, &latest, entries[4], 3)
+
+		checkBreak(t, verify(t, verifier), Break{Sequence: 4, Reason: "checkpoint covers sequence 5 but the last stored entry is 3"})
+	})
+
+	t.Run("after the last checkpoint", func(t *testing.T) {
+		latest := testCheckpoint(private, entries[2])
+
+		verifier, mock := newTestVerifier(t, public)
+		expectBounds(mock, 1, 4)
+		expectCheckpoints(mock, 1, 4, latest)
+		expectEntries(mock, 1, 4, 1000, entries[:4]...)
+		expectTail(mock, &latest, entries[4], 4)
+		expectTombstone(mock, 5, nil)
+
+		checkBreak(t, verify(t, verifier), Break{Sequence: 5, Reason: "chain head is at sequence 5 but the last stored entry is 4"})
+	})
+
+	t.Run("head dropped by retention", func(t *testing.T) {
+		tombstone := &models.AuditLogTombstone{FirstSequence: 5, Sequence: 5, EntryHash: entries[4].EntryHash, PartitionName: "audit_logs_y2026m03"}
+		SignTombstone(private, tombstone)
+
+		verifier, mock := newTestVerifier(t, public)
+		expectBounds(mock, 1, 4)
+		expectCheckpoints(mock, 1, 4)
+		expectEntries(mock, 1, 4, 1000, entries[:4]...)
+		expectTail(mock, nil, entries[4], 4)
+		expectTombstone(mock, 5, tombstone)
+
+		if report := verify(t, verifier); report.Break != nil {
+			t.Errorf("unexpected break %+v", *report.Break)
+		}
+	})
+
+	// Entries after the time range are out of scope
+	t.Run("range before the end", func(t *testing.T) {
+		verifier, mock := newTestVerifier(t, public)
+		expectBounds(mock, 1, 3)
+		expectCheckpoints(mock, 1, 3)
+		expectEntries(mock, 1, 3, 1000, entries[:3]...)
+		expectTail(mock, nil, entries[4], 5)
+
+		if report := verify(t, verifier); report.Break != nil {
+			t.Errorf("unexpected break %+v", *report.Break)
+		}
+	})
+}
+
+// An erasure scrubs the personal data of entries and records the hash of
+// what they held, so they still verify as long as nothing else changed
+func TestVerifyRedactedEntry(t *testing.T) {
+	tests := []struct {
+		name         string
+		modify       func(*models.AuditLog)
+		recordedHash func(original *models.AuditLog) string
+		ok           bool
+	}{
+		{
+			name:         "redaction recorded",
+			recordedHash: repository.PersonalDataHash,
+			ok:           true,
+		},
+		{
+			name:         "no redaction recorded",
+			recordedHash: func(*models.AuditLog) string { return "" },
+		},
+		{
+			name:         "other personal data recorded",
+			recordedHash: func(*models.AuditLog) string { return repository.PersonalDataHash(&models.AuditLog{}) },
+		},
+		{
+			name:         "other field changed too",
+			modify:       func(e *models.AuditLog) { e.Severity = "critical" },
+			recordedHash: repository.PersonalDataHash,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries := newTestChain(3)
+			personalDataHash := tt.recordedHash(&entries[1])
+			repository.ScrubAuditLog(&entries[1])
+			if tt.modify != nil {
+				tt.modify(&entries[1])
+			}
+
+			verifier, mock := newTestVerifier(t)
+			expectBounds(mock, 1, 3)
+			expectCheckpoints(mock, 1, 3)
+			expectEntries(mock, 1, 3, 1000, entries...)
+			expectRedaction(mock, 2, personalDataHash)
+			if tt.ok {
+				expectTail(mock, nil, entries[2], 3)
+			}
+
+			report := verify(t, verifier)
+			if !tt.ok {
+				checkBreak(t, report, Break{Sequence: 2, AuditLogID: "log-2", Reason: "entry contents do not match its hash"})
+				return
+			}
+			if report.Break != nil || report.EntriesChecked != 3 || report.EntriesRedacted != 1 {
+				t.Errorf("unexpected report %+v", report)
+			}
+		})
+	}
+}
+
+func TestVerifyCheckpoint(t *testing.T) {
+	public, private := newTestKey(t)
+	_, otherPrivate := newTestKey(t)
+	entries := newTestChain(3)
+
+	forged := testCheckpoint(otherPrivate, entries[1])
+	forged.KeyID = KeyID(public)
+	tampered := testCheckpoint(private, entries[1])
+	tampered.CreatedAt = tampered.CreatedAt.Add(time.Hour)
+
+	tests := []struct {
+		name       string
+		keys       []ed25519.PublicKey
+		checkpoint models.AuditChainCheckpoint
+		reason     string // empty when the chain verifies
+	}{
+		{"signed", []ed25519.PublicKey{public}, testCheckpoint(private, entries[1]), ""},
+		{"signed by another key", []ed25519.PublicKey{public}, forged, "checkpoint checkpoint-2 has an invalid signature"},
+		{"changed after signing", []ed25519.PublicKey{public}, tampered, "checkpoint checkpoint-2 has an invalid signature"},
+		{"unknown key", []ed25519.PublicKey{public}, testCheckpoint(otherPrivate, entries[1]), "checkpoint checkpoint-2 is signed with unknown key " + KeyID(otherPrivate.Public().(ed25519.PublicKey))},
+		{"not base64", []ed25519.PublicKey{public}, func() models.AuditChainCheckpoint {
+			c := testCheckpoint(private, entries[1])
+			c.Signature = "not base64!"
+			return c
+		}(), "checkpoint checkpoint-2 has an invalid signature"},
+		// Without keys, only the hash a checkpoint records is compared
+		{"no keys", nil, forged, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifier, mock := newTestVerifier(t, tt.keys...)
+			expectBounds(mock, 1, 3)
+			expectCheckpoints(mock, 1, 3, tt.checkpoint)
+			expectEntries(mock, 1, 3, 1000, entries...)
+			if tt.reason == "" {
+				expectTail(mock, &tt.checkpoint, entries[2], 3)
+			}
+
+			report := verify(t, verifier)
+			if tt.reason != "" {
+				checkBreak(t, report, Break{Sequence: 2, AuditLogID: "log-2", Reason: tt.reason})
+				return
+			}
+			if report.Break != nil || report.CheckpointsChecked != 1 {
+				t.Errorf("unexpected report %+v", report)
+			}
+		})
+	}
+}
+
+// Someone able to recompute hashes can rewrite the chain from an entry
+// onwards, but not the checkpoint signed before
+func TestVerifyRewrittenChain(t *testing.T) {
+	public, private := newTestKey(t)
+	entries := newTestChain(3)
+	checkpoint := testCheckpoint(private, entries[1])
+
+	rewritten := newTestChain(3)
+	rewritten[1].Success = false
+	for i := 1; i < len(rewritten); i++ {
+		rewritten[i].PrevHash = rewritten[i-1].EntryHash
+		rewritten[i].EntryHash = repository.AuditLogHash(&rewritten[i])
+	}
+
+	verifier, mock := newTestVerifier(t, public)
+	expectBounds(mock, 1, 3)
+	expectCheckpoints(mock, 1, 3, checkpoint)
+	expectEntries(mock, 1, 3, 1000, rewritten...)
+
+	checkBreak(t, verify(t, verifier), Break{Sequence: 2, AuditLogID: "log-2", Reason: "entry does not match checkpoint checkpoint-2"})
+}
+
+func TestVerifyEmptyRange(t *testing.T) {
+	verifier, mock := newTestVerifier(t)
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT MIN(sequence), MAX(sequence)")).
+		WillReturnRows(sqlmock.NewRows([]string{"min", "max"}).AddRow(nil, nil))
+
+	report := verify(t, verifier)
+	if report.Break != nil || report.EntriesChecked != 0 {
+		t.Errorf("unexpected report %+v", report)
+	}
+}
@@ -0,0 +1,151 @@
+package export
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/aashiq-04/session-management-system/backend/services/audit-service/internal/models"
+)
+
+// Device fields in the CEF header
+const (
+	cefVendor  = "SessionManagementSystem"
+	cefProduct = "AuditService"
+	cefVersion = "1.0"
+)
+
+// cefSeverities maps audit severities to the CEF 0-10 scale
+var cefSeverities = map[string]int{
+	"info":     3,
+	"warning":  6,
+	"critical": 9,
+}
+
+// cefAlertSeverities maps security alert severities to the CEF 0-10 scale
+var cefAlertSeverities = map[string]int{
+	"low":      3,
+	"medium":   5,
+	"high":     8,
+	"critical": 10,
+}
+
+var (
+	cefHeaderEscaper    = strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\r", " ", "\n", " ")
+	cefExtensionEscaper = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\r", `\r`, "\n", `\n`)
+)
+
+type cefWriter struct {
+	w *bufio.Writer
+}
+
+func newCEFWriter(w io.Writer) *cefWriter {
+	return &cefWriter{w: bufio.NewWriter(w)}
+}
+
+func (c *cefWriter) Write(log *models.AuditLog) error {
+	if _, err := c.w.WriteString(CEFLine(log)); err != nil {
+		return err
+	}
+	return c.w.WriteByte('\n')
+}
+
+func (c *cefWriter) Flush() error {
+	return c.w.Flush()
+}
+
+// CEFLine renders an audit log as an ArcSight CEF line, without a trailing newline
+func CEFLine(log *models.AuditLog) string {
+	severity, ok := cefSeverities[log.Severity]
+	if !ok {
+		severity = 5
+	}
+
+	outcome := "success"
+	if !log.Success {
+		outcome = "failure"
+	}
+
+	return cefLine(log.EventType, log.EventType, severity, [][2]string{
+		{"rt", strconv.FormatInt(log.CreatedAt.UnixMilli(), 10)},
+		{"externalId", log.ID},
+		{"cat", log.EventCategory},
+		{"outcome", outcome},
+		{"suid", deref(log.UserID)},
+		{"src", deref(log.IPAddress)},
+		{"requestClientApplication", deref(log.UserAgent)},
+		{"reason", deref(log.FailureReason)},
+		{"cs1Label", "sessionId"}, {"cs1", deref(log.SessionID)},
+		{"cs2Label", "deviceId"}, {"cs2", deref(log.DeviceID)},
+		{"cs3Label", "metadata"}, {"cs3", deref(log.Metadata)},
+		{"cs4Label", "location"}, {"cs4", location(log.LocationCity, log.LocationCountry)},
+	})
+}
+
+// AlertCEFLine renders a security alert as an ArcSight CEF line, without a trailing newline
+func AlertCEFLine(alert *models.SecurityAlert) string {
+	severity, ok := cefAlertSeverities[alert.Severity]
+	if !ok {
+		severity = 5
+	}
+
+	return cefLine(alert.AlertType, alert.Description, severity, [][2]string{
+		{"rt", strconv.FormatInt(alert.CreatedAt.UnixMilli(), 10)},
+		{"externalId", alert.ID},
+		{"cat", "security_alert"},
+		{"suid", alert.UserID},
+		{"src", deref(alert.IPAddress)},
+		{"msg", alert.Description},
+		{"cs3Label", "metadata"}, {"cs3", deref(alert.Metadata)},
+		{"cs4Label", "location"}, {"cs4", location(alert.LocationCity, alert.LocationCountry)},
+	})
+}
+
+// cefLine writes the CEF header and the non-empty extension fields. A
+// custom string label is skipped along with its value when the value is empty.
+func cefLine(classID, name string, severity int, extension [][2]string) string {
+	var b strings.Builder
+	b.WriteString("CEF:0|")
+	for _, field := range []string{cefVendor, cefProduct, cefVersion, classID, name} {
+		b.WriteString(cefHeaderEscaper.Replace(field))
+		b.WriteByte('|')
+	}
+	b.WriteString(strconv.Itoa(severity))
+	b.WriteByte('|')
+
+	first := true
+	for i := 0; i < len(extension); i++ {
+		key, value := extension[i][0], extension[i][1]
+		if strings.HasSuffix(key, "Label") {
+			if i+1 < len(extension) && extension[i+1][1] == "" {
+				i++
+				continue
+			}
+		} else if value == "" {
+			continue
+		}
+
+		if !first {
+			b.WriteByte(' ')
+		}
+		first = false
+		b.WriteString(key)
+		b.WriteByte('=')
+		b.WriteString(cefExtensionEscaper.Replace(value))
+	}
+
+	return b.String()
+}
+
+// location joins the city and country, whichever are known
+func location(city, country *string) string {
+	var parts []string
+	if deref(city) != "" {
+		parts = append(parts, *city)
+	}
+	if deref(country) != "" {
+		parts = append(parts, *country)
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,105 @@
+package export
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aashiq-04/session-management-system/backend/services/audit-service/internal/models"
+)
+
+func TestCEFHeaderEscaping(t *testing.T) {
+	tests := []struct {
+		eventType string
+		want      string
+	}{
+		{"login_success", "|login_success|login_success|"},
+		{"a|b", `|a\|b|a\|b|`},
+		{`a\b`, `|a\\b|a\\b|`},
+		{`a\|b`, `|a\\\|b|a\\\|b|`},
+		// Newlines would end the record, so they become spaces
+		{"a\nb\rc", "|a b c|a b c|"},
+		// = needs no escaping in the header
+		{"a=b", "|a=b|a=b|"},
+	}
+	for _, tt := range tests {
+		line := CEFLine(&models.AuditLog{EventType: tt.eventType, Severity: "info", CreatedAt: time.Unix(0, 0)})
+		if !strings.HasPrefix(line, "CEF:0|SessionManagementSystem|AuditService|1.0"+tt.want+"3|") {
+			t.Errorf("event type %q: header of %q, want %q", tt.eventType, line, tt.want)
+		}
+	}
+}
+
+func TestCEFExtensionEscaping(t *testing.T) {
+	tests := []struct {
+		reason string
+		want   string
+	}{
+		{"a=b", `reason=a\=b`},
+		{`a\b`, `reason=a\\b`},
+		{"a\nb", `reason=a\nb`},
+		{"a\r\nb", `reason=a\r\nb`},
+		// | needs no escaping in extensions
+		{"a|b", "reason=a|b"},
+		{`\=`, `reason=\\\=`},
+	}
+	for _, tt := range tests {
+		line := CEFLine(&models.AuditLog{EventType: "login_failed", FailureReason: &tt.reason, CreatedAt: time.Unix(0, 0)})
+		if !strings.HasSuffix(line, " "+tt.want) {
+			t.Errorf("reason %q: got %q, want it to end with %q", tt.reason, line, tt.want)
+		}
+	}
+}
+
+// Empty fields are left out, and a custom string label goes with its value
+func TestCEFSkipsEmptyFields(t *testing.T) {
+	line := CEFLine(&models.AuditLog{
+		ID:        "log-1",
+		EventType: "logout",
+		Severity:  "info",
+		Success:   true,
+		SessionID: strPtr("session-1"),
+		CreatedAt: time.UnixMilli(1772368245123),
+	})
+
+	want := "CEF:0|SessionManagementSystem|AuditService|1.0|logout|logout|3|" +
+		"rt=1772368245123 externalId=log-1 outcome=success cs1Label=sessionId cs1=session-1"
+	if line != want {
+		t.Errorf("got  %q\nwant %q", line, want)
+	}
+}
+
+func TestCEFOneRecordPerLine(t *testing.T) {
+	data := exportLogs(t, FormatCEF)
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(lines) != len(testLogs()) {
+		t.Fatalf("got %d lines, want %d", len(lines), len(testLogs()))
+	}
+	for i, line := range lines {
+		if !strings.HasPrefix(line, "CEF:0|") || strings.ContainsRune(line, '\r') {
+			t.Errorf("line %d is not a CEF record: %q", i+1, line)
+		}
+	}
+	if !bytes.HasSuffix(data, []byte("\n")) {
+		t.Error("export doesn't end with a newline")
+	}
+}
+
+func TestAlertCEFLine(t *testing.T) {
+	line := AlertCEFLine(&models.SecurityAlert{
+		ID:              "alert-1",
+		UserID:          "user-1",
+		AlertType:       "impossible_travel",
+		Severity:        "high",
+		Description:     "Login from FR|US = suspicious",
+		LocationCountry: strPtr("US"),
+		CreatedAt:       time.UnixMilli(1772368245123),
+	})
+
+	want := `CEF:0|SessionManagementSystem|AuditService|1.0|impossible_travel|Login from FR\|US = suspicious|8|` +
+		`rt=1772368245123 externalId=alert-1 cat=security_alert suid=user-1 msg=Login from FR|US \= suspicious cs4Label=location cs4=US`
+	if line != want {
+		t.Errorf("got  %q\nwant %q", line, want)
+	}
+}
@@ -0,0 +1,63 @@
+package export
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aashiq-04/session-management-system/backend/services/audit-service/internal/models"
+)
+
+var csvHeader = []string{
+	"id", "created_at", "user_id", "session_id", "device_id",
+	"event_type", "event_category", "severity", "success", "failure_reason",
+	"ip_address", "user_agent", "location_country", "location_city", "metadata",
+}
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func newCSVWriter(w io.Writer) (*csvWriter, error) {
+	cw := &csvWriter{w: csv.NewWriter(w)}
+	if err := cw.w.Write(csvHeader); err != nil {
+		return nil, err
+	}
+	return cw, nil
+}
+
+func (c *csvWriter) Write(log *models.AuditLog) error {
+	return c.w.Write([]string{
+		log.ID,
+		log.CreatedAt.UTC().Format(time.RFC3339Nano),
+		deref(log.UserID),
+		deref(log.SessionID),
+		deref(log.DeviceID),
+		log.EventType,
+		log.EventCategory,
+		log.Severity,
+		strconv.FormatBool(log.Success),
+		csvSafe(deref(log.FailureReason)),
+		deref(log.IPAddress),
+		csvSafe(deref(log.UserAgent)),
+		csvSafe(deref(log.LocationCountry)),
+		csvSafe(deref(log.LocationCity)),
+		csvSafe(deref(log.Metadata)),
+	})
+}
+
+func (c *csvWriter) Flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// csvSafe keeps client-supplied text from being run as a formula when the
+// export is opened in a spreadsheet
+func csvSafe(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
@@ -0,0 +1,60 @@
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"testing"
+)
+
+func TestCSVSafe(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"=1+1", "'=1+1"},
+		{"+SUM(A1)", "'+SUM(A1)"},
+		{"-2", "'-2"},
+		{"@SUM(A1)", "'@SUM(A1)"},
+		{"\tTabbed", "'\tTabbed"},
+		{"\rReturn", "'\rReturn"},
+		{"", ""},
+		{"Paris", "Paris"},
+		{"a=b", "a=b"},
+		{" =1", " =1"},
+		{"'quoted", "'quoted"},
+	}
+	for _, tt := range tests {
+		if got := csvSafe(tt.value); got != tt.want {
+			t.Errorf("csvSafe(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+// Every field a client can influence is escaped, and the export reads back
+// as one record per log
+func TestCSVEscapesClientText(t *testing.T) {
+	records, err := csv.NewReader(bytes.NewReader(exportLogs(t, FormatCSV))).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	logs := testLogs()
+	if len(records) != len(logs)+1 {
+		t.Fatalf("got %d records, want a header and %d logs", len(records), len(logs))
+	}
+
+	column := make(map[string]int, len(csvHeader))
+	for i, name := range records[0] {
+		column[name] = i
+	}
+	escaped := records[2]
+	for name, want := range map[string]string{
+		"failure_reason":   "'-1+2\nsecond line\nthird=line",
+		"user_agent":       `'=HYPERLINK("https://evil.example","click")`,
+		"location_country": "'@FR",
+		"location_city":    "'+Saint-Denis, \"Nord\"",
+	} {
+		if got := escaped[column[name]]; got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+}
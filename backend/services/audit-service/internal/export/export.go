@@ -0,0 +1,56 @@
+// Package export writes audit logs out in formats other tools can ingest
+package export
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/aashiq-04/session-management-system/backend/services/audit-service/internal/models"
+)
+
+// Supported export formats
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+	FormatCEF    = "cef"
+)
+
+// Writer encodes audit logs one at a time, so exports never hold more than one in memory
+type Writer interface {
+	Write(log *models.AuditLog) error
+	// Flush writes anything still buffered; call it once after the last log
+	Flush() error
+}
+
+// NewWriter returns a writer for the given format
+func NewWriter(format string, w io.Writer) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVWriter(w)
+	case FormatNDJSON:
+		return newNDJSONWriter(w), nil
+	case FormatCEF:
+		return newCEFWriter(w), nil
+	}
+
+	return nil, fmt.Errorf("unsupported export format %q, expected csv, ndjson or cef", format)
+}
+
+// ContentType returns the MIME type of an export format
+func ContentType(format string) string {
+	switch format {
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	case FormatNDJSON:
+		return "application/x-ndjson"
+	default:
+		return "text/plain; charset=utf-8"
+	}
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
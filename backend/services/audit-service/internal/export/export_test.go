@@ -0,0 +1,143 @@
+package export
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aashiq-04/session-management-system/backend/services/audit-service/internal/models"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+func strPtr(s string) *string {
+	return &s
+}
+
+// testLogs covers a fully populated log, values a spreadsheet or SIEM would
+// misread, and a log with only the required fields
+func testLogs() []models.AuditLog {
+	createdAt := time.Date(2026, 3, 1, 12, 30, 45, 123456000, time.UTC)
+	return []models.AuditLog{
+		{
+			ID:              "6f1c1d8e-3b7a-4c7e-9d55-0a6f1e2b3c4d",
+			UserID:          strPtr("9b2d6a3e-1f4c-4e8a-b6d7-2c3e4f5a6b7c"),
+			SessionID:       strPtr("1d2e3f4a-5b6c-4d7e-8f9a-0b1c2d3e4f5a"),
+			DeviceID:        strPtr("2e3f4a5b-6c7d-4e8f-9a0b-1c2d3e4f5a6b"),
+			EventType:       "login_failed",
+			EventCategory:   "authentication",
+			Severity:        "warning",
+			IPAddress:       strPtr("203.0.113.7"),
+			UserAgent:       strPtr("Mozilla/5.0 (X11; Linux x86_64) Firefox/128.0"),
+			LocationCountry: strPtr("FR"),
+			LocationCity:    strPtr("Paris"),
+			Metadata:        strPtr(`{"attempt":3,"method":"password"}`),
+			Success:         false,
+			FailureReason:   strPtr("invalid_password"),
+			CreatedAt:       createdAt,
+		},
+		{
+			ID:              "7a2b3c4d-5e6f-4a7b-8c9d-0e1f2a3b4c5d",
+			UserID:          strPtr("9b2d6a3e-1f4c-4e8a-b6d7-2c3e4f5a6b7c"),
+			EventType:       `custom|event\type`,
+			EventCategory:   "security",
+			Severity:        "critical",
+			IPAddress:       strPtr("2001:db8::1"),
+			UserAgent:       strPtr(`=HYPERLINK("https://evil.example","click")`),
+			LocationCountry: strPtr("@FR"),
+			LocationCity:    strPtr("+Saint-Denis, \"Nord\""),
+			Metadata:        strPtr(`{"query":"a=b","note":"two\nlines"}`),
+			Success:         true,
+			FailureReason:   strPtr("-1+2\nsecond line\nthird=line"),
+			CreatedAt:       createdAt.Add(time.Second),
+		},
+		{
+			ID:            "8b3c4d5e-6f7a-4b8c-9d0e-1f2a3b4c5d6e",
+			EventType:     "token_refreshed",
+			EventCategory: "session",
+			Severity:      "debug",
+			UserAgent:     strPtr("\tTabbed"),
+			LocationCity:  strPtr("\rReturn"),
+			Metadata:      strPtr("not json"),
+			Success:       true,
+			CreatedAt:     createdAt.Add(2 * time.Second),
+		},
+	}
+}
+
+// exportLogs writes the test logs in format
+func exportLogs(t *testing.T, format string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	writer, err := NewWriter(format, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logs := testLogs()
+	for i := range logs {
+		if err := writer.Write(&logs[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// checkGolden compares got with testdata/name, rewriting it with -update
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+
+	file := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(file, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s differs from the golden file; rerun with -update if the change is intended\ngot:\n%s\nwant:\n%s", name, got, want)
+	}
+}
+
+func TestGolden(t *testing.T) {
+	for _, format := range []string{FormatCSV, FormatNDJSON, FormatCEF} {
+		t.Run(format, func(t *testing.T) {
+			checkGolden(t, "audit_logs."+format, exportLogs(t, format))
+		})
+	}
+}
+
+func TestNewWriterRejectsUnknownFormat(t *testing.T) {
+	for _, format := range []string{"", "xml", "CSV", "json", "cef "} {
+		var buf bytes.Buffer
+		if writer, err := NewWriter(format, &buf); err == nil {
+			t.Errorf("NewWriter(%q) = %T, want an error", format, writer)
+		}
+		if buf.Len() != 0 {
+			t.Errorf("NewWriter(%q) wrote %q", format, buf.String())
+		}
+	}
+}
+
+func TestContentType(t *testing.T) {
+	tests := map[string]string{
+		FormatCSV:    "text/csv; charset=utf-8",
+		FormatNDJSON: "application/x-ndjson",
+		FormatCEF:    "text/plain; charset=utf-8",
+	}
+	for format, want := range tests {
+		if got := ContentType(format); got != want {
+			t.Errorf("ContentType(%q) = %q, want %q", format, got, want)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package export
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/aashiq-04/session-management-system/backend/services/audit-service/internal/models"
+)
+
+// ndjsonLog is one line of an NDJSON export
+type ndjsonLog struct {
+	ID              string          `json:"id"`
+	CreatedAt       string          `json:"created_at"`
+	UserID          *string         `json:"user_id"`
+	SessionID       *string         `json:"session_id"`
+	DeviceID        *string         `json:"device_id"`
+	EventType       string          `json:"event_type"`
+	EventCategory   string          `json:"event_category"`
+	Severity        string          `json:"severity"`
+	Success         bool            `json:"success"`
+	FailureReason   *string         `json:"failure_reason"`
+	IPAddress       *string         `json:"ip_address"`
+	UserAgent       *string         `json:"user_agent"`
+	LocationCountry *string         `json:"location_country"`
+	LocationCity    *string         `json:"location_city"`
+	Metadata        json.RawMessage `json:"metadata"`
+}
+
+type ndjsonWriter struct {
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+func newNDJSONWriter(w io.Writer) *ndjsonWriter {
+	buf := bufio.NewWriter(w)
+	return &ndjsonWriter{w: buf, enc: json.NewEncoder(buf)}
+}
+
+func (n *ndjsonWriter) Write(log *models.AuditLog) error {
+	var metadata json.RawMessage
+	if log.Metadata != nil && json.Valid([]byte(*log.Metadata)) {
+		metadata = json.RawMessage(*log.Metadata)
+	}
+
+	// Encode terminates each value with a newline
+	return n.enc.Encode(ndjsonLog{
+		ID:              log.ID,
+		CreatedAt:       log.CreatedAt.UTC().Format(time.RFC3339Nano),
+		UserID:          log.UserID,
+		SessionID:       log.SessionID,
+		DeviceID:        log.DeviceID,
+		EventType:       log.EventType,
+		EventCategory:   log.EventCategory,
+		Severity:        log.Severity,
+		Success:         log.Success,
+		FailureReason:   log.FailureReason,
+		IPAddress:       log.IPAddress,
+		UserAgent:       log.UserAgent,
+		LocationCountry: log.LocationCountry,
+		LocationCity:    log.LocationCity,
+		Metadata:        metadata,
+	})
+}
+
+func (n *ndjsonWriter) Flush() error {
+	return n.w.Flush()
+}
@@ -0,0 +1,44 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestNDJSONOneObjectPerLine(t *testing.T) {
+	data := exportLogs(t, FormatNDJSON)
+	if !bytes.HasSuffix(data, []byte("\n")) {
+		t.Error("export doesn't end with a newline")
+	}
+
+	lines := bytes.Split(bytes.TrimSuffix(data, []byte("\n")), []byte("\n"))
+	logs := testLogs()
+	if len(lines) != len(logs) {
+		t.Fatalf("got %d lines, want %d", len(lines), len(logs))
+	}
+	for i, line := range lines {
+		var object map[string]json.RawMessage
+		if err := json.Unmarshal(line, &object); err != nil {
+			t.Fatalf("line %d is not a JSON object: %v", i+1, err)
+		}
+		var id string
+		if err := json.Unmarshal(object["id"], &id); err != nil || id != logs[i].ID {
+			t.Errorf("line %d has id %s, want %s", i+1, object["id"], logs[i].ID)
+		}
+	}
+
+	// Metadata stays structured; what isn't JSON is left out rather than
+	// breaking the line
+	var first, last struct {
+		Metadata map[string]interface{} `json:"metadata"`
+	}
+	json.Unmarshal(lines[0], &first)
+	json.Unmarshal(lines[len(lines)-1], &last)
+	if first.Metadata["method"] != "password" {
+		t.Errorf("metadata = %v, want it as an object", first.Metadata)
+	}
+	if last.Metadata != nil {
+		t.Errorf("invalid metadata exported as %v", last.Metadata)
+	}
+}
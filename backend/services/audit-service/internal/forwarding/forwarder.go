@@ -0,0 +1,306 @@
+// Package forwarding mirrors audit logs and security alerts to external log
+// collectors such as a SIEM's syslog receiver or an OpenTelemetry collector
+package forwarding
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/aashiq-04/session-management-system/backend/services/audit-service/internal/models"
+)
+
+// Event kinds
+const (
+	KindAuditLog      = "audit_log"
+	KindSecurityAlert = "security_alert"
+)
+
+// Event is one audit log or security alert on its way to the sinks
+type Event struct {
+	Kind       string                `json:"kind"`
+	AuditLog   *models.AuditLog      `json:"audit_log,omitempty"`
+	Alert      *models.SecurityAlert `json:"alert,omitempty"`
+	EnqueuedAt time.Time             `json:"enqueued_at"`
+}
+
+// Sink delivers batches of events to one external collector
+type Sink interface {
+	Name() string
+	// Send delivers every event or returns an error, in which case the whole
+	// batch is retried. Events may be delivered more than once.
+	Send(ctx context.Context, events []Event) error
+	Close() error
+}
+
+// permanentError marks a batch the collector will never accept, so retrying is pointless
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Config holds forwarding settings shared by all sinks
+type Config struct {
+	BufferDir       string // Each sink buffers in its own subdirectory
+	MaxBufferBytes  int64  // Per sink; the oldest events are dropped beyond this
+	BatchSize       int
+	RetryBackoff    time.Duration
+	MaxRetryBackoff time.Duration
+}
+
+// SinkStatus reports how far behind a sink is
+type SinkStatus struct {
+	Name          string
+	Pending       int
+	Lag           time.Duration // Age of the oldest event not yet delivered
+	Sent          int64
+	Failures      int64
+	Dropped       int64 // Lost to a full buffer or unreadable
+	Parked        int64 // Rejected by the collector and set aside in the buffer's parked file
+	LastError     string
+	LastErrorAt   time.Time
+	LastSuccessAt time.Time
+}
+
+// Forwarder writes every event to a disk buffer per sink, and a worker per
+// sink drains its buffer, so events survive collector outages and restarts
+type Forwarder struct {
+	workers []*worker
+}
+
+// New opens the disk buffers for the given sinks. With no sinks, forwarding is
+// a no-op and nothing is written to disk.
+func New(config Config, sinks ...Sink) (*Forwarder, error) {
+	f := &Forwarder{}
+	for _, sink := range sinks {
+		queue, err := openDiskQueue(filepath.Join(config.BufferDir, sink.Name()), config.MaxBufferBytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s buffer: %w", sink.Name(), err)
+		}
+
+		w := &worker{
+			sink:   sink,
+			queue:  queue,
+			config: config,
+			notify: make(chan struct{}, 1),
+		}
+		w.status.Name = sink.Name()
+		f.workers = append(f.workers, w)
+	}
+	return f, nil
+}
+
+// AuditLog queues an audit log for every sink
+func (f *Forwarder) AuditLog(auditLog *models.AuditLog) {
+	f.enqueue(Event{Kind: KindAuditLog, AuditLog: auditLog})
+}
+
+// SecurityAlert queues a security alert for every sink
+func (f *Forwarder) SecurityAlert(alert *models.SecurityAlert) {
+	f.enqueue(Event{Kind: KindSecurityAlert, Alert: alert})
+}
+
+// enqueue buffers an event. Postgres stays the system of record, so buffer
+// errors are logged rather than failing the request.
+func (f *Forwarder) enqueue(event Event) {
+	if len(f.workers) == 0 {
+		return
+	}
+
+	event.EnqueuedAt = time.Now()
+	record, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Failed to encode %s for forwarding: %v", event.Kind, err)
+		return
+	}
+
+	for _, w := range f.workers {
+		dropped, err := w.queue.Append(record)
+		if dropped > 0 {
+			w.addDropped(dropped)
+			log.Printf("Forwarding buffer for %s is full, dropped %d oldest events", w.sink.Name(), dropped)
+		}
+		if err != nil {
+			log.Printf("Failed to buffer %s for %s: %v", event.Kind, w.sink.Name(), err)
+			continue
+		}
+
+		select {
+		case w.notify <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Run drains the buffers until ctx is cancelled, then closes the sinks
+func (f *Forwarder) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, w := range f.workers {
+		log.Printf("Forwarding audit events to %s (%d buffered)", w.sink.Name(), w.queue.Pending())
+		wg.Add(1)
+		go func(w *worker) {
+			defer wg.Done()
+			w.run(ctx)
+		}(w)
+	}
+	wg.Wait()
+}
+
+// Status returns the state of every sink
+func (f *Forwarder) Status() []SinkStatus {
+	statuses := make([]SinkStatus, 0, len(f.workers))
+	for _, w := range f.workers {
+		statuses = append(statuses, w.snapshot())
+	}
+	return statuses
+}
+
+// worker delivers one sink's buffered events in order
+type worker struct {
+	sink   Sink
+	queue  *diskQueue
+	config Config
+	notify chan struct{}
+
+	mu     sync.Mutex
+	status SinkStatus
+	oldest time.Time // Enqueue time of the oldest undelivered event, zero when caught up
+}
+
+func (w *worker) run(ctx context.Context) {
+	defer w.queue.Close()
+	defer w.sink.Close()
+
+	backoff := w.config.RetryBackoff
+	for {
+		sent, err := w.deliverBatch(ctx)
+
+		var wait <-chan time.Time
+		switch {
+		case err != nil:
+			log.Printf("Failed to forward audit events to %s (%d pending, %s behind), retrying in %s: %v",
+				w.sink.Name(), w.queue.Pending(), w.snapshot().Lag.Round(time.Second), backoff, err)
+			wait = time.After(backoff)
+			backoff = min(backoff*2, w.config.MaxRetryBackoff)
+		case sent > 0:
+			backoff = w.config.RetryBackoff
+			continue
+		default:
+			// Caught up; also wake periodically in case a notification was missed
+			wait = time.After(time.Minute)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-w.notify:
+		case <-wait:
+		}
+	}
+}
+
+// deliverBatch sends the next batch and returns how many buffered records it took off the queue
+func (w *worker) deliverBatch(ctx context.Context) (int, error) {
+	records, next, err := w.queue.Peek(w.config.BatchSize)
+	if err != nil {
+		w.recordFailure(err)
+		return 0, err
+	}
+	if len(records) == 0 {
+		w.setOldest(time.Time{})
+		return 0, nil
+	}
+
+	events := make([]Event, 0, len(records))
+	readable := make([][]byte, 0, len(records))
+	skipped := 0
+	for _, record := range records {
+		var event Event
+		if err := json.Unmarshal(record, &event); err != nil {
+			skipped++
+			continue
+		}
+		events = append(events, event)
+		readable = append(readable, record)
+	}
+	if skipped > 0 {
+		log.Printf("Skipped %d unreadable events in the %s buffer", skipped, w.sink.Name())
+		w.addDropped(skipped)
+	}
+	if len(events) > 0 {
+		w.setOldest(events[0].EnqueuedAt)
+
+		if err := w.sink.Send(ctx, events); err != nil {
+			var permanent *permanentError
+			if !errors.As(err, &permanent) {
+				w.recordFailure(err)
+				return 0, err
+			}
+			// Retrying can't help, but audit events mustn't be lost either
+			if err := w.queue.Park(readable); err != nil {
+				w.recordFailure(err)
+				return 0, err
+			}
+			log.Printf("%s rejected %d events, parked them in %s: %v", w.sink.Name(), len(events), parkedFile, err)
+			w.mu.Lock()
+			w.status.Parked += int64(len(events))
+			w.mu.Unlock()
+			w.recordFailure(err)
+			events = nil
+		}
+	}
+
+	if err := w.queue.Commit(next, len(records)); err != nil {
+		w.recordFailure(err)
+		return 0, err
+	}
+
+	w.mu.Lock()
+	w.status.Sent += int64(len(events))
+	if len(events) > 0 {
+		w.status.LastSuccessAt = time.Now()
+	}
+	w.mu.Unlock()
+
+	return len(records), nil
+}
+
+func (w *worker) snapshot() SinkStatus {
+	w.mu.Lock()
+	status := w.status
+	oldest := w.oldest
+	w.mu.Unlock()
+
+	status.Pending = w.queue.Pending()
+	if status.Pending > 0 && !oldest.IsZero() {
+		status.Lag = time.Since(oldest)
+	}
+	return status
+}
+
+func (w *worker) setOldest(t time.Time) {
+	w.mu.Lock()
+	w.oldest = t
+	w.mu.Unlock()
+}
+
+func (w *worker) addDropped(n int) {
+	w.mu.Lock()
+	w.status.Dropped += int64(n)
+	w.mu.Unlock()
+}
+
+func (w *worker) recordFailure(err error) {
+	w.mu.Lock()
+	w.status.Failures++
+	w.status.LastError = err.Error()
+	w.status.LastErrorAt = time.Now()
+	w.mu.Unlock()
+}
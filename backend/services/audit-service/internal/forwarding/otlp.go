@@ -0,0 +1,219 @@
+package forwarding
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aashiq-04/session-management-system/backend/services/audit-service/internal/export"
+)
+
+// SinkOTLP is the name of the OpenTelemetry logs sink
+const SinkOTLP = "otlp"
+
+// OpenTelemetry severity numbers and names for audit log and alert severities
+var (
+	otlpSeverities = map[string]otlpSeverity{
+		"info":     {9, "INFO"},
+		"warning":  {13, "WARN"},
+		"critical": {17, "ERROR"},
+	}
+	otlpAlertSeverities = map[string]otlpSeverity{
+		"low":      {9, "INFO"},
+		"medium":   {13, "WARN"},
+		"high":     {17, "ERROR"},
+		"critical": {21, "FATAL"},
+	}
+)
+
+type otlpSeverity struct {
+	number int
+	text   string
+}
+
+// OTLPConfig configures the OpenTelemetry logs sink
+type OTLPConfig struct {
+	Endpoint string            // Collector base URL, e.g. http://otel-collector:4318
+	Headers  map[string]string // Sent with every request, e.g. for authentication
+	Timeout  time.Duration
+}
+
+// OTLPSink exports events as OpenTelemetry log records over OTLP/HTTP with
+// JSON encoding. Each record's body is the event as a CEF line, and its fields
+// are also attached as attributes.
+type OTLPSink struct {
+	config   OTLPConfig
+	url      string
+	client   *http.Client
+	resource map[string]interface{}
+}
+
+// NewOTLPSink creates an OTLP sink
+func NewOTLPSink(config OTLPConfig) *OTLPSink {
+	url := strings.TrimSuffix(config.Endpoint, "/")
+	if !strings.HasSuffix(url, "/v1/logs") {
+		url += "/v1/logs"
+	}
+
+	resource := []interface{}{stringAttribute("service.name", "audit-service")}
+	if hostname, err := os.Hostname(); err == nil {
+		resource = append(resource, stringAttribute("host.name", hostname))
+	}
+
+	return &OTLPSink{
+		config:   config,
+		url:      url,
+		client:   &http.Client{Timeout: config.Timeout},
+		resource: map[string]interface{}{"attributes": resource},
+	}
+}
+
+// Name returns the sink name
+func (s *OTLPSink) Name() string {
+	return SinkOTLP
+}
+
+// Send posts the batch as one ExportLogsServiceRequest. Collectors answer 429
+// or 5xx when they want a retry; other client errors mean the batch itself was
+// refused, so it is not retried.
+func (s *OTLPSink) Send(ctx context.Context, events []Event) error {
+	records := make([]interface{}, 0, len(events))
+	observed := strconv.FormatInt(time.Now().UnixNano(), 10)
+	for i := range events {
+		records = append(records, s.logRecord(&events[i], observed))
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"resourceLogs": []interface{}{map[string]interface{}{
+			"resource": s.resource,
+			"scopeLogs": []interface{}{map[string]interface{}{
+				"scope":      map[string]interface{}{"name": "audit-service/forwarding"},
+				"logRecords": records,
+			}},
+		}},
+	})
+	if err != nil {
+		return &permanentError{fmt.Errorf("failed to encode OTLP request: %w", err)}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return &permanentError{fmt.Errorf("failed to create OTLP request: %w", err)}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range s.config.Headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send OTLP request: %w", err)
+	}
+	defer resp.Body.Close()
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return fmt.Errorf("OTLP collector returned %d: %s", resp.StatusCode, bytes.TrimSpace(detail))
+	default:
+		return &permanentError{fmt.Errorf("OTLP collector returned %d: %s", resp.StatusCode, bytes.TrimSpace(detail))}
+	}
+}
+
+// Close releases idle connections
+func (s *OTLPSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+// logRecord converts an event to an OTLP JSON log record
+func (s *OTLPSink) logRecord(event *Event, observed string) map[string]interface{} {
+	var (
+		severity   otlpSeverity
+		timestamp  time.Time
+		body       string
+		attributes []interface{}
+	)
+
+	switch event.Kind {
+	case KindAuditLog:
+		l := event.AuditLog
+		severity = otlpSeverityOr(otlpSeverities, l.Severity)
+		timestamp, body = l.CreatedAt, export.CEFLine(l)
+		attributes = []interface{}{
+			stringAttribute("event.name", l.EventType),
+			stringAttribute("audit.id", l.ID),
+			map[string]interface{}{"key": "audit.sequence", "value": map[string]interface{}{"intValue": strconv.FormatInt(l.Sequence, 10)}},
+			stringAttribute("audit.entry_hash", l.EntryHash),
+			stringAttribute("audit.event_category", l.EventCategory),
+			map[string]interface{}{"key": "audit.success", "value": map[string]interface{}{"boolValue": l.Success}},
+		}
+		attributes = appendOptional(attributes,
+			[2]string{"user.id", deref(l.UserID)},
+			[2]string{"session.id", deref(l.SessionID)},
+			[2]string{"audit.device_id", deref(l.DeviceID)},
+			[2]string{"client.address", deref(l.IPAddress)},
+			[2]string{"user_agent.original", deref(l.UserAgent)},
+			[2]string{"geo.country", deref(l.LocationCountry)},
+			[2]string{"geo.locality.name", deref(l.LocationCity)},
+			[2]string{"audit.failure_reason", deref(l.FailureReason)},
+			[2]string{"audit.metadata", deref(l.Metadata)},
+		)
+	case KindSecurityAlert:
+		a := event.Alert
+		severity = otlpSeverityOr(otlpAlertSeverities, a.Severity)
+		timestamp, body = a.CreatedAt, export.AlertCEFLine(a)
+		attributes = []interface{}{
+			stringAttribute("event.name", "security_alert"),
+			stringAttribute("alert.id", a.ID),
+			stringAttribute("alert.type", a.AlertType),
+			stringAttribute("alert.description", a.Description),
+		}
+		attributes = appendOptional(attributes,
+			[2]string{"user.id", a.UserID},
+			[2]string{"client.address", deref(a.IPAddress)},
+			[2]string{"geo.country", deref(a.LocationCountry)},
+			[2]string{"geo.locality.name", deref(a.LocationCity)},
+			[2]string{"alert.metadata", deref(a.Metadata)},
+		)
+	}
+
+	return map[string]interface{}{
+		"timeUnixNano":         strconv.FormatInt(timestamp.UnixNano(), 10),
+		"observedTimeUnixNano": observed,
+		"severityNumber":       severity.number,
+		"severityText":         severity.text,
+		"body":                 map[string]interface{}{"stringValue": body},
+		"attributes":           attributes,
+	}
+}
+
+func otlpSeverityOr(severities map[string]otlpSeverity, severity string) otlpSeverity {
+	if value, ok := severities[severity]; ok {
+		return value
+	}
+	return otlpSeverity{0, ""}
+}
+
+func stringAttribute(key, value string) map[string]interface{} {
+	return map[string]interface{}{"key": key, "value": map[string]interface{}{"stringValue": value}}
+}
+
+// appendOptional adds string attributes that have a value
+func appendOptional(attributes []interface{}, pairs ...[2]string) []interface{} {
+	for _, p := range pairs {
+		if p[1] != "" {
+			attributes = append(attributes, stringAttribute(p[0], p[1]))
+		}
+	}
+	return attributes
+}
@@ -0,0 +1,216 @@
+package forwarding
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aashiq-04/session-management-system/backend/services/audit-service/internal/export"
+)
+
+// otlpCollector is an OTLP/HTTP endpoint answering each request with the
+// status respond picks for its body
+type otlpCollector struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	requests []otlpRequest
+}
+
+type otlpRequest struct {
+	header http.Header
+	path   string
+	body   []byte
+	at     time.Time
+}
+
+func newOTLPCollector(t *testing.T, respond func(body []byte) int) *otlpCollector {
+	t.Helper()
+
+	c := &otlpCollector{}
+	c.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		c.mu.Lock()
+		c.requests = append(c.requests, otlpRequest{header: r.Header, path: r.URL.Path, body: body, at: time.Now()})
+		c.mu.Unlock()
+		w.WriteHeader(respond(body))
+	}))
+	t.Cleanup(c.Close)
+	return c
+}
+
+func (c *otlpCollector) received() []otlpRequest {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]otlpRequest(nil), c.requests...)
+}
+
+func accept([]byte) int { return http.StatusOK }
+
+func TestOTLPSend(t *testing.T) {
+	collector := newOTLPCollector(t, accept)
+	f := startTestForwarder(t, NewOTLPSink(OTLPConfig{
+		Endpoint: collector.URL + "/",
+		Headers:  map[string]string{"Authorization": "Bearer collector-token"},
+		Timeout:  5 * time.Second,
+	}))
+
+	auditLog := testAuditLog("log-1")
+	f.AuditLog(auditLog)
+	waitFor(t, "the export request", func() bool { return len(collector.received()) == 1 })
+
+	req := collector.received()[0]
+	if req.path != "/v1/logs" || req.header.Get("Content-Type") != "application/json" ||
+		req.header.Get("Authorization") != "Bearer collector-token" {
+		t.Errorf("request to %s with headers %v", req.path, req.header)
+	}
+
+	var request struct {
+		ResourceLogs []struct {
+			ScopeLogs []struct {
+				LogRecords []struct {
+					TimeUnixNano   string `json:"timeUnixNano"`
+					SeverityNumber int    `json:"severityNumber"`
+					SeverityText   string `json:"severityText"`
+					Body           struct {
+						StringValue string `json:"stringValue"`
+					} `json:"body"`
+					Attributes []struct {
+						Key   string                 `json:"key"`
+						Value map[string]interface{} `json:"value"`
+					} `json:"attributes"`
+				} `json:"logRecords"`
+			} `json:"scopeLogs"`
+		} `json:"resourceLogs"`
+	}
+	if err := json.Unmarshal(req.body, &request); err != nil {
+		t.Fatal(err)
+	}
+	if len(request.ResourceLogs) != 1 || len(request.ResourceLogs[0].ScopeLogs) != 1 || len(request.ResourceLogs[0].ScopeLogs[0].LogRecords) != 1 {
+		t.Fatalf("unexpected export request %s", req.body)
+	}
+
+	record := request.ResourceLogs[0].ScopeLogs[0].LogRecords[0]
+	if record.TimeUnixNano != "1772366400000000000" || record.SeverityNumber != 13 || record.SeverityText != "WARN" {
+		t.Errorf("record time %s, severity %d %s", record.TimeUnixNano, record.SeverityNumber, record.SeverityText)
+	}
+	if record.Body.StringValue != export.CEFLine(auditLog) {
+		t.Errorf("body %q isn't the CEF line", record.Body.StringValue)
+	}
+
+	attributes := map[string]interface{}{}
+	for _, a := range record.Attributes {
+		for _, v := range a.Value {
+			attributes[a.Key] = v
+		}
+	}
+	want := map[string]interface{}{
+		"event.name":           "access_denied",
+		"audit.id":             "log-1",
+		"audit.sequence":       "7",
+		"audit.success":        false,
+		"user.id":              `usér-"1]\`,
+		"audit.failure_reason": "SUBJECT_MISMATCH",
+	}
+	for key, value := range want {
+		if attributes[key] != value {
+			t.Errorf("attribute %s = %v, want %v", key, attributes[key], value)
+		}
+	}
+	if _, ok := attributes["client.address"]; ok {
+		t.Error("attribute client.address sent without a value")
+	}
+}
+
+// 429 and 5xx mean the collector wants the batch again later, with the wait
+// doubling after each failure
+func TestOTLPRetriesWithBackoff(t *testing.T) {
+	responses := []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusBadGateway, http.StatusOK}
+	var mu sync.Mutex
+	collector := newOTLPCollector(t, func([]byte) int {
+		mu.Lock()
+		defer mu.Unlock()
+		status := responses[0]
+		if len(responses) > 1 {
+			responses = responses[1:]
+		}
+		return status
+	})
+	f := startTestForwarder(t, NewOTLPSink(OTLPConfig{Endpoint: collector.URL, Timeout: 5 * time.Second}))
+
+	f.AuditLog(testAuditLog("log-1"))
+	waitFor(t, "delivery", func() bool { return f.Status()[0].Sent == 1 })
+
+	requests := collector.received()
+	if len(requests) != 4 {
+		t.Fatalf("%d requests, want 3 failures and a success", len(requests))
+	}
+	for _, req := range requests {
+		if !strings.Contains(string(req.body), `"log-1"`) {
+			t.Fatalf("retry without the batch: %s", req.body)
+		}
+	}
+
+	// The first retry may come straight away when the notification of the
+	// enqueue is still pending; after that the backoff doubles from 20ms
+	for i, min := range map[int]time.Duration{2: 40 * time.Millisecond, 3: 80 * time.Millisecond} {
+		if gap := requests[i].at.Sub(requests[i-1].at); gap < min {
+			t.Errorf("retry %d after %s, want at least %s", i, gap, min)
+		}
+	}
+
+	status := f.Status()[0]
+	if status.Failures != 3 || status.Parked != 0 || status.Pending != 0 {
+		t.Errorf("status %+v, want 3 failures and nothing parked or pending", status)
+	}
+}
+
+// Other client errors mean the collector refuses the batch itself. It isn't
+// retried, but parked on disk rather than lost, and later events still go out.
+func TestOTLPParksRejectedBatch(t *testing.T) {
+	collector := newOTLPCollector(t, func(body []byte) int {
+		if strings.Contains(string(body), `"log-rejected"`) {
+			return http.StatusBadRequest
+		}
+		return http.StatusOK
+	})
+	config := testForwardingConfig(t)
+	f, err := New(config, NewOTLPSink(OTLPConfig{Endpoint: collector.URL, Timeout: 5 * time.Second}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	runTestForwarder(t, f)
+
+	f.AuditLog(testAuditLog("log-rejected"))
+	waitFor(t, "the batch to be parked", func() bool { return f.Status()[0].Parked == 1 })
+
+	f.AuditLog(testAuditLog("log-2"))
+	waitFor(t, "the next event", func() bool { return f.Status()[0].Sent == 1 })
+
+	if n := len(collector.received()); n != 2 {
+		t.Errorf("%d requests, want the rejected batch sent once and the next event", n)
+	}
+	status := f.Status()[0]
+	if status.Dropped != 0 || status.Pending != 0 {
+		t.Errorf("status %+v, want nothing dropped or pending", status)
+	}
+
+	parked, err := os.ReadFile(filepath.Join(config.BufferDir, SinkOTLP, parkedFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var event Event
+	if err := json.Unmarshal([]byte(strings.TrimSuffix(string(parked), "\n")), &event); err != nil {
+		t.Fatalf("parked file %q: %v", parked, err)
+	}
+	if event.Kind != KindAuditLog || event.AuditLog.ID != "log-rejected" {
+		t.Errorf("parked %+v, want log-rejected", event)
+	}
+}
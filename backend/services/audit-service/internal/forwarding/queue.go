@@ -0,0 +1,382 @@
+package forwarding
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	segmentSuffix  = ".seg"
+	cursorFile     = "cursor"
+	parkedFile     = "parked.ndjson"
+	maxSegmentSize = 8 << 20
+)
+
+// position points into a queue: a segment and a byte offset within it
+type position struct {
+	Segment int64 `json:"segment"`
+	Offset  int64 `json:"offset"`
+}
+
+// diskQueue is an append-only queue of newline-terminated records, stored as
+// numbered segment files plus a cursor file that marks how far the reader has
+// committed. Records survive restarts until committed; when the queue grows past
+// maxBytes the oldest segments are dropped.
+type diskQueue struct {
+	mu       sync.Mutex
+	dir      string
+	maxBytes int64
+
+	segments []int64 // Segment IDs, oldest first; the last one is being written
+	sizes    map[int64]int64
+	head     position
+	pending  int
+
+	file *os.File // Open for appending to the last segment
+}
+
+// openDiskQueue opens or creates a queue in dir
+func openDiskQueue(dir string, maxBytes int64) (*diskQueue, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create buffer directory: %w", err)
+	}
+
+	q := &diskQueue{dir: dir, maxBytes: maxBytes, sizes: make(map[int64]int64)}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read buffer directory: %w", err)
+	}
+	for _, entry := range entries {
+		id, err := strconv.ParseInt(strings.TrimSuffix(entry.Name(), segmentSuffix), 10, 64)
+		if err != nil || !strings.HasSuffix(entry.Name(), segmentSuffix) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat buffer segment: %w", err)
+		}
+		q.segments = append(q.segments, id)
+		q.sizes[id] = info.Size()
+	}
+	sort.Slice(q.segments, func(i, j int) bool { return q.segments[i] < q.segments[j] })
+
+	if len(q.segments) == 0 {
+		q.segments = []int64{1}
+		q.sizes[1] = 0
+	}
+
+	// A crash mid-append can leave a partial record at the end of the last segment
+	if err := q.truncatePartial(q.segments[len(q.segments)-1]); err != nil {
+		return nil, err
+	}
+
+	q.head = position{Segment: q.segments[0]}
+	if data, err := os.ReadFile(filepath.Join(dir, cursorFile)); err == nil {
+		var saved position
+		if json.Unmarshal(data, &saved) == nil && saved.Segment >= q.segments[0] {
+			if size, ok := q.sizes[saved.Segment]; ok && saved.Offset <= size {
+				q.head = saved
+			}
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read buffer cursor: %w", err)
+	}
+
+	if err := q.countPending(); err != nil {
+		return nil, err
+	}
+
+	last := q.segments[len(q.segments)-1]
+	q.file, err = os.OpenFile(q.segmentPath(last), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open buffer segment: %w", err)
+	}
+
+	return q, nil
+}
+
+// Append adds a record, which must not contain a newline. It returns how many
+// unsent records were dropped to stay under the size limit.
+func (q *diskQueue) Append(record []byte) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	last := q.segments[len(q.segments)-1]
+	if q.sizes[last] >= maxSegmentSize {
+		if err := q.rotate(); err != nil {
+			return 0, err
+		}
+		last = q.segments[len(q.segments)-1]
+	}
+
+	n, err := q.file.Write(append(record, '\n'))
+	q.sizes[last] += int64(n)
+	if err != nil {
+		return 0, fmt.Errorf("failed to write buffer segment: %w", err)
+	}
+	q.pending++
+
+	return q.enforceLimit()
+}
+
+// Peek returns up to n records from the head of the queue and the position
+// just after the last one, to pass to Commit once they have been handled
+func (q *diskQueue) Peek(n int) ([][]byte, position, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var records [][]byte
+	pos := q.head
+
+	for _, id := range q.segments {
+		if id < pos.Segment || len(records) >= n {
+			continue
+		}
+		if id > pos.Segment {
+			pos = position{Segment: id}
+		}
+		if pos.Offset >= q.sizes[id] {
+			continue
+		}
+
+		f, err := os.Open(q.segmentPath(id))
+		if err != nil {
+			return nil, q.head, fmt.Errorf("failed to open buffer segment: %w", err)
+		}
+		// Only read what was appended before Peek took the lock
+		reader := bufio.NewReader(io.NewSectionReader(f, pos.Offset, q.sizes[id]-pos.Offset))
+		for len(records) < n {
+			line, err := reader.ReadBytes('\n')
+			if err != nil {
+				break
+			}
+			pos.Offset += int64(len(line))
+			records = append(records, bytes.TrimSuffix(line, []byte{'\n'}))
+		}
+		f.Close()
+	}
+
+	return records, pos, nil
+}
+
+// Commit marks the n records before pos as handled and removes segments that
+// no longer hold unsent records
+func (q *diskQueue) Commit(pos position, n int) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	// Records may have been dropped by the size limit since Peek
+	if pos.Segment < q.head.Segment || (pos.Segment == q.head.Segment && pos.Offset <= q.head.Offset) {
+		return nil
+	}
+
+	q.head = pos
+	q.pending -= n
+	if q.pending < 0 {
+		q.pending = 0
+	}
+
+	for len(q.segments) > 1 {
+		oldest := q.segments[0]
+		if oldest == q.head.Segment && q.head.Offset < q.sizes[oldest] {
+			break
+		}
+		if err := q.removeOldest(); err != nil {
+			return err
+		}
+		if q.head.Segment <= oldest {
+			q.head = position{Segment: q.segments[0]}
+		}
+	}
+
+	return q.saveCursor()
+}
+
+// Park sets aside records the sink refused, appending them to the parked
+// file for an operator to inspect or replay
+func (q *diskQueue) Park(records [][]byte) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	f, err := os.OpenFile(filepath.Join(q.dir, parkedFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open parked events: %w", err)
+	}
+	defer f.Close()
+
+	var buf bytes.Buffer
+	for _, record := range records {
+		buf.Write(record)
+		buf.WriteByte('\n')
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to write parked events: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("failed to write parked events: %w", err)
+	}
+	return nil
+}
+
+// Pending returns how many records are waiting to be sent
+func (q *diskQueue) Pending() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.pending
+}
+
+// Close closes the segment being written
+func (q *diskQueue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.file.Close()
+}
+
+// rotate starts a new segment
+func (q *diskQueue) rotate() error {
+	next := q.segments[len(q.segments)-1] + 1
+	f, err := os.OpenFile(q.segmentPath(next), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to create buffer segment: %w", err)
+	}
+
+	q.file.Close()
+	q.file = f
+	q.segments = append(q.segments, next)
+	q.sizes[next] = 0
+	return nil
+}
+
+// enforceLimit drops the oldest segments while the queue is over maxBytes
+func (q *diskQueue) enforceLimit() (int, error) {
+	total := int64(0)
+	for _, id := range q.segments {
+		total += q.sizes[id]
+	}
+
+	dropped := 0
+	for total > q.maxBytes && len(q.segments) > 1 {
+		oldest := q.segments[0]
+		from := int64(0)
+		if q.head.Segment == oldest {
+			from = q.head.Offset
+		}
+
+		n, err := q.countRecords(oldest, from)
+		if err != nil {
+			return dropped, err
+		}
+		dropped += n
+		q.pending -= n
+		total -= q.sizes[oldest]
+
+		if err := q.removeOldest(); err != nil {
+			return dropped, err
+		}
+		if q.head.Segment <= oldest {
+			q.head = position{Segment: q.segments[0]}
+		}
+	}
+
+	if dropped > 0 {
+		return dropped, q.saveCursor()
+	}
+	return 0, nil
+}
+
+// removeOldest deletes the oldest segment, which must not be the one being written
+func (q *diskQueue) removeOldest() error {
+	oldest := q.segments[0]
+	if err := os.Remove(q.segmentPath(oldest)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove buffer segment: %w", err)
+	}
+	q.segments = q.segments[1:]
+	delete(q.sizes, oldest)
+	return nil
+}
+
+// countPending counts the records from the head to the end of the queue
+func (q *diskQueue) countPending() error {
+	q.pending = 0
+	for _, id := range q.segments {
+		if id < q.head.Segment {
+			continue
+		}
+		from := int64(0)
+		if id == q.head.Segment {
+			from = q.head.Offset
+		}
+		n, err := q.countRecords(id, from)
+		if err != nil {
+			return err
+		}
+		q.pending += n
+	}
+	return nil
+}
+
+// countRecords counts the records in a segment from a byte offset
+func (q *diskQueue) countRecords(id, from int64) (int, error) {
+	f, err := os.Open(q.segmentPath(id))
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to open buffer segment: %w", err)
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.NewSectionReader(f, from, q.sizes[id]-from))
+	if err != nil {
+		return 0, fmt.Errorf("failed to read buffer segment: %w", err)
+	}
+	return bytes.Count(data, []byte{'\n'}), nil
+}
+
+// truncatePartial cuts a segment back to its last complete record
+func (q *diskQueue) truncatePartial(id int64) error {
+	data, err := os.ReadFile(q.segmentPath(id))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read buffer segment: %w", err)
+	}
+
+	end := int64(bytes.LastIndexByte(data, '\n') + 1)
+	if end == int64(len(data)) {
+		return nil
+	}
+	if err := os.Truncate(q.segmentPath(id), end); err != nil {
+		return fmt.Errorf("failed to truncate buffer segment: %w", err)
+	}
+	q.sizes[id] = end
+	return nil
+}
+
+// saveCursor persists the head position, replacing the file atomically
+func (q *diskQueue) saveCursor() error {
+	data, _ := json.Marshal(q.head)
+	tmp := filepath.Join(q.dir, cursorFile+".tmp")
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write buffer cursor: %w", err)
+	}
+	if err := os.Rename(tmp, filepath.Join(q.dir, cursorFile)); err != nil {
+		return fmt.Errorf("failed to write buffer cursor: %w", err)
+	}
+	return nil
+}
+
+func (q *diskQueue) segmentPath(id int64) string {
+	return filepath.Join(q.dir, fmt.Sprintf("%016d%s", id, segmentSuffix))
+}
@@ -0,0 +1,155 @@
+package forwarding
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func openTestQueue(t *testing.T, dir string, maxBytes int64) *diskQueue {
+	t.Helper()
+
+	q, err := openDiskQueue(dir, maxBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { q.Close() })
+	return q
+}
+
+func appendRecords(t *testing.T, q *diskQueue, records ...string) {
+	t.Helper()
+
+	for _, record := range records {
+		if dropped, err := q.Append([]byte(record)); err != nil || dropped != 0 {
+			t.Fatalf("Append(%s) = %d, %v", record, dropped, err)
+		}
+	}
+}
+
+func peekRecords(t *testing.T, q *diskQueue, n int) ([]string, position) {
+	t.Helper()
+
+	records, next, err := q.Peek(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, record := range records {
+		got = append(got, string(record))
+	}
+	return got, next
+}
+
+func TestDiskQueue(t *testing.T) {
+	dir := t.TempDir()
+	q := openTestQueue(t, dir, 1<<20)
+	appendRecords(t, q, "a", "b", "c")
+
+	got, next := peekRecords(t, q, 2)
+	if !slices.Equal(got, []string{"a", "b"}) {
+		t.Fatalf("Peek = %q, want a and b", got)
+	}
+	// Peeking again without committing starts over
+	if got, _ := peekRecords(t, q, 2); !slices.Equal(got, []string{"a", "b"}) {
+		t.Fatalf("second Peek = %q, want a and b", got)
+	}
+
+	if err := q.Commit(next, len(got)); err != nil {
+		t.Fatal(err)
+	}
+	if q.Pending() != 1 {
+		t.Errorf("Pending = %d after committing two of three, want 1", q.Pending())
+	}
+	if got, _ := peekRecords(t, q, 10); !slices.Equal(got, []string{"c"}) {
+		t.Errorf("Peek after Commit = %q, want c", got)
+	}
+}
+
+// Records stay buffered until committed, so a restart redelivers whatever
+// was peeked but not committed
+func TestDiskQueueSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	q := openTestQueue(t, dir, 1<<20)
+	appendRecords(t, q, "a", "b", "c")
+	got, next := peekRecords(t, q, 1)
+	if err := q.Commit(next, len(got)); err != nil {
+		t.Fatal(err)
+	}
+	peekRecords(t, q, 10)
+	q.Close()
+
+	q = openTestQueue(t, dir, 1<<20)
+	if q.Pending() != 2 {
+		t.Errorf("Pending = %d after restart, want 2", q.Pending())
+	}
+	if got, _ := peekRecords(t, q, 10); !slices.Equal(got, []string{"b", "c"}) {
+		t.Errorf("Peek after restart = %q, want b and c", got)
+	}
+}
+
+func TestDiskQueueTruncatesPartialRecord(t *testing.T) {
+	dir := t.TempDir()
+	q := openTestQueue(t, dir, 1<<20)
+	appendRecords(t, q, "a")
+	q.Close()
+
+	// A crash in the middle of an append
+	f, err := os.OpenFile(q.segmentPath(1), os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"kind":"aud`)
+	f.Close()
+
+	q = openTestQueue(t, dir, 1<<20)
+	appendRecords(t, q, "b")
+	if got, _ := peekRecords(t, q, 10); !slices.Equal(got, []string{"a", "b"}) {
+		t.Errorf("Peek = %q, want a and b without the partial record", got)
+	}
+}
+
+func TestDiskQueueDropsOldestOverLimit(t *testing.T) {
+	q := openTestQueue(t, t.TempDir(), maxSegmentSize)
+	appendRecords(t, q, string(bytes.Repeat([]byte("a"), maxSegmentSize)))
+
+	// The full segment is rotated out, taking the queue over its limit
+	dropped, err := q.Append([]byte("b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dropped != 1 {
+		t.Errorf("dropped %d records, want the oldest one", dropped)
+	}
+	if got, _ := peekRecords(t, q, 10); !slices.Equal(got, []string{"b"}) {
+		t.Errorf("Peek = %q, want b", got)
+	}
+}
+
+func TestDiskQueuePark(t *testing.T) {
+	dir := t.TempDir()
+	q := openTestQueue(t, dir, 1<<20)
+
+	if err := q.Park([][]byte{[]byte("a"), []byte("b")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Park([][]byte{[]byte("c")}); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, parkedFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "a\nb\nc\n" {
+		t.Errorf("parked file = %q", data)
+	}
+
+	// Parked events aren't part of the queue, also after a restart
+	q.Close()
+	if q = openTestQueue(t, dir, 1<<20); q.Pending() != 0 {
+		t.Errorf("Pending = %d, want 0", q.Pending())
+	}
+}
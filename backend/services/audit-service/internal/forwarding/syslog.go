@@ -0,0 +1,231 @@
+package forwarding
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aashiq-04/session-management-system/backend/services/audit-service/internal/export"
+)
+
+// SinkSyslog is the name of the syslog sink
+const SinkSyslog = "syslog"
+
+// facilityLogAudit is the RFC 5424 "log audit" facility
+const facilityLogAudit = 13
+
+// sdID names the structured data element; 32473 is the enterprise number
+// RFC 5612 reserves for documentation and private use
+const sdID = "audit@32473"
+
+// Syslog severities for audit log and alert severities
+var (
+	syslogSeverities = map[string]int{
+		"info":     6, // Informational
+		"warning":  4, // Warning
+		"critical": 2, // Critical
+	}
+	syslogAlertSeverities = map[string]int{
+		"low":      5, // Notice
+		"medium":   4, // Warning
+		"high":     3, // Error
+		"critical": 2, // Critical
+	}
+)
+
+var sdValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+
+// SyslogConfig configures the syslog sink
+type SyslogConfig struct {
+	Address string      // host:port of the receiver
+	TLS     *tls.Config // Nil for plain TCP
+	AppName string
+	Timeout time.Duration
+}
+
+// SyslogSink sends RFC 5424 messages over TCP or TLS, with RFC 6587
+// octet-counting framing. The message text is the event as a CEF line.
+type SyslogSink struct {
+	config   SyslogConfig
+	hostname string
+	procID   string
+	conn     net.Conn
+}
+
+// NewSyslogSink creates a syslog sink; it connects on the first send
+func NewSyslogSink(config SyslogConfig) *SyslogSink {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+
+	return &SyslogSink{
+		config:   config,
+		hostname: truncate(hostname, 255),
+		procID:   strconv.Itoa(os.Getpid()),
+	}
+}
+
+// Name returns the sink name
+func (s *SyslogSink) Name() string {
+	return SinkSyslog
+}
+
+// Send writes the batch in one write, reconnecting first if needed. A failed
+// write drops the connection so the retry starts on a fresh one.
+func (s *SyslogSink) Send(ctx context.Context, events []Event) error {
+	var buf bytes.Buffer
+	for i := range events {
+		msg := s.format(&events[i])
+		buf.WriteString(strconv.Itoa(len(msg)))
+		buf.WriteByte(' ')
+		buf.WriteString(msg)
+	}
+
+	if s.conn != nil && !s.connected() {
+		s.conn.Close()
+		s.conn = nil
+	}
+	if s.conn == nil {
+		conn, err := s.dial(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to connect to syslog receiver: %w", err)
+		}
+		s.conn = conn
+	}
+
+	s.conn.SetWriteDeadline(time.Now().Add(s.config.Timeout))
+	if _, err := s.conn.Write(buf.Bytes()); err != nil {
+		s.conn.Close()
+		s.conn = nil
+		return fmt.Errorf("failed to write to syslog receiver: %w", err)
+	}
+
+	return nil
+}
+
+// Close closes the connection
+func (s *SyslogSink) Close() error {
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+// connected reports whether the receiver still has the connection open.
+// Receivers never send anything, so a read that doesn't time out means the
+// receiver closed it, e.g. when it restarted; a write would still succeed,
+// and the batch would be lost.
+func (s *SyslogSink) connected() bool {
+	s.conn.SetReadDeadline(time.Now().Add(time.Millisecond))
+	defer s.conn.SetReadDeadline(time.Time{})
+
+	var b [1]byte
+	_, err := s.conn.Read(b[:])
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+func (s *SyslogSink) dial(ctx context.Context) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: s.config.Timeout}
+	if s.config.TLS != nil {
+		return (&tls.Dialer{NetDialer: dialer, Config: s.config.TLS}).DialContext(ctx, "tcp", s.config.Address)
+	}
+	return dialer.DialContext(ctx, "tcp", s.config.Address)
+}
+
+// format renders one event as an RFC 5424 message
+func (s *SyslogSink) format(event *Event) string {
+	var (
+		severity  int
+		timestamp time.Time
+		msgID     string
+		params    [][2]string
+		text      string
+	)
+
+	switch event.Kind {
+	case KindAuditLog:
+		l := event.AuditLog
+		severity = severityOr(syslogSeverities, l.Severity, 5)
+		timestamp, msgID, text = l.CreatedAt, l.EventType, export.CEFLine(l)
+		params = [][2]string{
+			{"id", l.ID},
+			{"sequence", strconv.FormatInt(l.Sequence, 10)},
+			{"entryHash", l.EntryHash},
+			{"userId", deref(l.UserID)},
+			{"category", l.EventCategory},
+			{"severity", l.Severity},
+			{"success", strconv.FormatBool(l.Success)},
+		}
+	case KindSecurityAlert:
+		a := event.Alert
+		severity = severityOr(syslogAlertSeverities, a.Severity, 5)
+		timestamp, msgID, text = a.CreatedAt, a.AlertType, export.AlertCEFLine(a)
+		params = [][2]string{
+			{"id", a.ID},
+			{"userId", a.UserID},
+			{"category", "security_alert"},
+			{"severity", a.Severity},
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "<%d>1 %s %s %s %s %s [%s",
+		facilityLogAudit*8+severity,
+		timestamp.UTC().Format("2006-01-02T15:04:05.000000Z07:00"),
+		s.hostname,
+		orNil(truncate(s.config.AppName, 48)),
+		s.procID,
+		orNil(truncate(msgID, 32)),
+		sdID,
+	)
+	for _, p := range params {
+		if p[1] != "" {
+			fmt.Fprintf(&b, ` %s="%s"`, p[0], sdValueEscaper.Replace(p[1]))
+		}
+	}
+	b.WriteString("] ")
+	b.WriteString(text)
+
+	return b.String()
+}
+
+// severityOr looks up a severity, falling back for unknown values
+func severityOr(severities map[string]int, severity string, fallback int) int {
+	if value, ok := severities[severity]; ok {
+		return value
+	}
+	return fallback
+}
+
+// orNil returns the RFC 5424 nil value for empty header fields
+func orNil(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,297 @@
+package forwarding
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aashiq-04/session-management-system/backend/services/audit-service/internal/export"
+	"github.com/aashiq-04/session-management-system/backend/services/audit-service/internal/models"
+)
+
+var testTime = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func testAuditLog(id string) *models.AuditLog {
+	userID := `usér-"1]\`
+	metadata := `{"method":"/audit.AuditService/GetUserAuditLogs"}`
+	reason := "SUBJECT_MISMATCH"
+	return &models.AuditLog{
+		ID:            id,
+		UserID:        &userID,
+		EventType:     "access_denied",
+		EventCategory: "authorization",
+		Severity:      "warning",
+		Metadata:      &metadata,
+		FailureReason: &reason,
+		CreatedAt:     testTime,
+		Sequence:      7,
+		EntryHash:     "abc123",
+	}
+}
+
+func testAlert() *models.SecurityAlert {
+	return &models.SecurityAlert{
+		ID:          "alert-1",
+		UserID:      "user-1",
+		AlertType:   "impossible_travel",
+		Severity:    "high",
+		Description: "Login from two countries within an hour",
+		CreatedAt:   testTime,
+	}
+}
+
+// syslogListener is a syslog receiver reading RFC 6587 octet-counted frames
+type syslogListener struct {
+	t        *testing.T
+	addr     string
+	config   *tls.Config
+	messages chan string
+
+	mu       sync.Mutex
+	listener net.Listener
+	conns    []net.Conn
+}
+
+// newSyslogListener listens on a free local port, with TLS unless config is nil
+func newSyslogListener(t *testing.T, config *tls.Config) *syslogListener {
+	t.Helper()
+
+	l := &syslogListener{t: t, addr: "127.0.0.1:0", config: config, messages: make(chan string, 100)}
+	l.start()
+	t.Cleanup(l.stop)
+	return l
+}
+
+func (l *syslogListener) start() {
+	l.t.Helper()
+
+	var listener net.Listener
+	var err error
+	if l.config != nil {
+		listener, err = tls.Listen("tcp", l.addr, l.config)
+	} else {
+		listener, err = net.Listen("tcp", l.addr)
+	}
+	if err != nil {
+		l.t.Fatal(err)
+	}
+	l.addr = listener.Addr().String()
+
+	l.mu.Lock()
+	l.listener = listener
+	l.mu.Unlock()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			l.mu.Lock()
+			l.conns = append(l.conns, conn)
+			l.mu.Unlock()
+			go l.read(conn)
+		}
+	}()
+}
+
+func (l *syslogListener) read(conn net.Conn) {
+	reader := bufio.NewReader(conn)
+	for {
+		length, err := reader.ReadString(' ')
+		if err != nil {
+			return
+		}
+		n, err := strconv.Atoi(strings.TrimSuffix(length, " "))
+		if err != nil {
+			l.t.Errorf("bad frame length %q", length)
+			return
+		}
+		msg := make([]byte, n)
+		if _, err := io.ReadFull(reader, msg); err != nil {
+			l.t.Errorf("frame shorter than its length %d: %v", n, err)
+			return
+		}
+		l.messages <- string(msg)
+	}
+}
+
+// stop closes the listener and every connection, as a restarting receiver does
+func (l *syslogListener) stop() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.listener.Close()
+	for _, conn := range l.conns {
+		conn.Close()
+	}
+	l.conns = nil
+}
+
+func (l *syslogListener) next(t *testing.T) string {
+	t.Helper()
+
+	select {
+	case msg := <-l.messages:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("no syslog message received")
+		return ""
+	}
+}
+
+// testTLSConfigs returns a server config with a certificate for 127.0.0.1,
+// and a client config trusting it
+func testTLSConfigs(t *testing.T) (server, client *tls.Config) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "syslog.test"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	return &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}},
+		&tls.Config{RootCAs: roots}
+}
+
+func TestSyslogFraming(t *testing.T) {
+	serverTLS, clientTLS := testTLSConfigs(t)
+
+	for name, configs := range map[string][2]*tls.Config{"tcp": {nil, nil}, "tls": {serverTLS, clientTLS}} {
+		t.Run(name, func(t *testing.T) {
+			listener := newSyslogListener(t, configs[0])
+			sink := NewSyslogSink(SyslogConfig{Address: listener.addr, TLS: configs[1], AppName: "audit-service", Timeout: 5 * time.Second})
+			defer sink.Close()
+
+			auditLog, alert := testAuditLog("log-1"), testAlert()
+			err := sink.Send(context.Background(), []Event{
+				{Kind: KindAuditLog, AuditLog: auditLog},
+				{Kind: KindSecurityAlert, Alert: alert},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// <13*8+4>: log audit facility, warning severity
+			want := `<108>1 2026-03-01T12:00:00.000000Z ` + sink.hostname + ` audit-service ` + sink.procID + ` access_denied ` +
+				`[audit@32473 id="log-1" sequence="7" entryHash="abc123" userId="usér-\"1\]\\" category="authorization" severity="warning" success="false"] ` +
+				export.CEFLine(auditLog)
+			if got := listener.next(t); got != want {
+				t.Errorf("audit log message:\n%s\nwant:\n%s", got, want)
+			}
+
+			// <13*8+3>: log audit facility, error severity for a high alert
+			want = `<107>1 2026-03-01T12:00:00.000000Z ` + sink.hostname + ` audit-service ` + sink.procID + ` impossible_travel ` +
+				`[audit@32473 id="alert-1" userId="user-1" category="security_alert" severity="high"] ` +
+				export.AlertCEFLine(alert)
+			if got := listener.next(t); got != want {
+				t.Errorf("alert message:\n%s\nwant:\n%s", got, want)
+			}
+		})
+	}
+}
+
+// A receiver restart closes the sink's connection. Events forwarded while it
+// is down stay buffered and are delivered once it is back.
+func TestSyslogRedeliversAfterRestart(t *testing.T) {
+	listener := newSyslogListener(t, nil)
+	f := startTestForwarder(t, NewSyslogSink(SyslogConfig{Address: listener.addr, Timeout: time.Second}))
+
+	f.AuditLog(testAuditLog("log-1"))
+	if msg := listener.next(t); !strings.Contains(msg, `id="log-1"`) {
+		t.Fatalf("first message %q isn't log-1", msg)
+	}
+
+	listener.stop()
+	f.AuditLog(testAuditLog("log-2"))
+	waitFor(t, "a failed delivery", func() bool { return f.Status()[0].Failures > 0 })
+	if pending := f.Status()[0].Pending; pending != 1 {
+		t.Fatalf("%d events pending while the receiver is down, want 1", pending)
+	}
+
+	listener.start()
+	if msg := listener.next(t); !strings.Contains(msg, `id="log-2"`) {
+		t.Fatalf("message after the restart %q isn't log-2", msg)
+	}
+	waitFor(t, "an empty buffer", func() bool { return f.Status()[0].Pending == 0 })
+}
+
+// testForwardingConfig buffers in a temporary directory and retries quickly
+func testForwardingConfig(t *testing.T) Config {
+	return Config{
+		BufferDir:       t.TempDir(),
+		MaxBufferBytes:  1 << 20,
+		BatchSize:       10,
+		RetryBackoff:    20 * time.Millisecond,
+		MaxRetryBackoff: 200 * time.Millisecond,
+	}
+}
+
+// startTestForwarder runs a forwarder to sink with testForwardingConfig
+func startTestForwarder(t *testing.T, sink Sink) *Forwarder {
+	t.Helper()
+
+	f, err := New(testForwardingConfig(t), sink)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runTestForwarder(t, f)
+	return f
+}
+
+// runTestForwarder runs f until the test ends
+func runTestForwarder(t *testing.T, f *Forwarder) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		f.Run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+func waitFor(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
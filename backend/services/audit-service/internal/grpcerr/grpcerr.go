@@ -0,0 +1,126 @@
+// Package grpcerr builds gRPC status errors with structured details, so
+// callers can branch on the code and details instead of parsing messages
+package grpcerr
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// Domain identifies this system in ErrorInfo details
+const Domain = "session-management-system"
+
+// storageRetryDelay is the retry hint sent when the database is unreachable
+const storageRetryDelay = time.Second
+
+// Field describes one invalid request field
+func Field(field, description string) *errdetails.BadRequest_FieldViolation {
+	return &errdetails.BadRequest_FieldViolation{Field: field, Description: description}
+}
+
+// InvalidArgument reports a malformed request, listing the offending fields
+func InvalidArgument(message string, violations ...*errdetails.BadRequest_FieldViolation) error {
+	if len(violations) == 0 {
+		return status.Error(codes.InvalidArgument, message)
+	}
+	return withDetails(codes.InvalidArgument, message, &errdetails.BadRequest{FieldViolations: violations})
+}
+
+// NotFound reports a missing resource, e.g. NotFound("Session not found", "session", id)
+func NotFound(message, resourceType, resourceName string) error {
+	return withDetails(codes.NotFound, message, &errdetails.ResourceInfo{
+		ResourceType: resourceType,
+		ResourceName: resourceName,
+	})
+}
+
+// AlreadyExists reports a resource that can't be created twice
+func AlreadyExists(message, resourceType, resourceName string) error {
+	return withDetails(codes.AlreadyExists, message, &errdetails.ResourceInfo{
+		ResourceType: resourceType,
+		ResourceName: resourceName,
+	})
+}
+
+// Unauthenticated reports missing or invalid credentials. reason is a stable
+// UPPER_SNAKE_CASE identifier clients can branch on.
+func Unauthenticated(message, reason string) error {
+	return withDetails(codes.Unauthenticated, message, errorInfo(reason))
+}
+
+// PermissionDenied reports a caller that may not act on a resource
+func PermissionDenied(message, reason string) error {
+	return withDetails(codes.PermissionDenied, message, errorInfo(reason))
+}
+
+// FailedPrecondition reports a request the resource isn't in a state to serve
+func FailedPrecondition(message, reason string) error {
+	return withDetails(codes.FailedPrecondition, message, errorInfo(reason))
+}
+
+// Unavailable reports a temporary failure, suggesting when to retry
+func Unavailable(message string, retryAfter time.Duration) error {
+	return withDetails(codes.Unavailable, message, &errdetails.RetryInfo{RetryDelay: durationpb.New(retryAfter)})
+}
+
+// Internal reports an unexpected failure. message is sent to the caller, so
+// it must not include the underlying error.
+func Internal(message string) error {
+	return status.Error(codes.Internal, message)
+}
+
+// Storage reports a failed database call: Unavailable with a retry hint when
+// the database couldn't be reached, Internal otherwise
+func Storage(message string, err error) error {
+	if isConnectionError(err) {
+		return Unavailable(message, storageRetryDelay)
+	}
+	return Internal(message)
+}
+
+// isConnectionError reports whether err means the database was unreachable
+// rather than that the query itself failed
+func isConnectionError(err error) bool {
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+
+	// Class 08 is connection exceptions, 57P0x is the server shutting down
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		code := string(pqErr.Code)
+		return strings.HasPrefix(code, "08") || strings.HasPrefix(code, "57P0")
+	}
+
+	return false
+}
+
+func errorInfo(reason string) *errdetails.ErrorInfo {
+	return &errdetails.ErrorInfo{Reason: reason, Domain: Domain}
+}
+
+// withDetails builds a status error, falling back to a bare one if the
+// details can't be attached
+func withDetails(code codes.Code, message string, details ...protoadapt.MessageV1) error {
+	st, err := status.New(code, message).WithDetails(details...)
+	if err != nil {
+		return status.Error(code, message)
+	}
+	return st.Err()
+}
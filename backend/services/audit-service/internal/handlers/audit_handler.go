@@ -3,33 +3,71 @@ package handlers
 import (
 	"context"
 	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"net"
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	pb "github.com/aashiq-04/session-management-system/backend/services/audit-service/proto"
+	"github.com/aashiq-04/session-management-system/backend/services/audit-service/internal/authz"
+	"github.com/aashiq-04/session-management-system/backend/services/audit-service/internal/chain"
+	"github.com/aashiq-04/session-management-system/backend/services/audit-service/internal/forwarding"
+	"github.com/aashiq-04/session-management-system/backend/services/audit-service/internal/grpcerr"
+	"github.com/aashiq-04/session-management-system/backend/services/audit-service/internal/identity"
 	"github.com/aashiq-04/session-management-system/backend/services/audit-service/internal/models"
+	"github.com/aashiq-04/session-management-system/backend/services/audit-service/internal/notifications"
 	"github.com/aashiq-04/session-management-system/backend/services/audit-service/internal/repository"
+	"github.com/aashiq-04/session-management-system/backend/services/audit-service/internal/search"
 )
 
 // AuditHandler implements the AuditService gRPC service
 type AuditHandler struct {
 	pb.UnimplementedAuditServiceServer
-	repo *repository.AuditRepository
+	repo          *repository.AuditRepository
+	notifications *repository.NotificationRepository
+	webhooks      *repository.WebhookRepository
+	chain         *chain.Verifier
+	forwarder     *forwarding.Forwarder
+	authz         *authz.Authorizer
 }
 
 // NewAuditHandler creates a new audit handler
-func NewAuditHandler(db *sql.DB) *AuditHandler {
-	return &AuditHandler{
-		repo: repository.NewAuditRepository(db),
+func NewAuditHandler(db *sql.DB, chainVerifier *chain.Verifier, forwarder *forwarding.Forwarder) *AuditHandler {
+	h := &AuditHandler{
+		repo:          repository.NewAuditRepository(db),
+		notifications: repository.NewNotificationRepository(db),
+		webhooks:      repository.NewWebhookRepository(db),
+		chain:         chainVerifier,
+		forwarder:     forwarder,
 	}
+	h.authz = authz.New(h.RecordDenial)
+	return h
 }
 
 // CreateAuditLog creates a new audit log entry
 func (h *AuditHandler) CreateAuditLog(ctx context.Context, req *pb.CreateAuditLogRequest) (*pb.CreateAuditLogResponse, error) {
 	log.Printf("CreateAuditLog request received for event: %s", req.EventType)
 
-	logID := uuid.New().String()
+	if err := validateAuditEvent(req); err != nil {
+		log.Printf("Rejected audit event %s: %v", req.EventType, err)
+		return nil, err
+	}
+
+	logID := req.Id
+	if logID == "" {
+		logID = uuid.New().String()
+	}
+
+	createdAt := time.Now()
+	if req.CreatedAt != "" {
+		createdAt, _ = time.Parse(time.RFC3339Nano, req.CreatedAt)
+	}
 	
 	auditLog := &models.AuditLog{
 		ID:              logID,
@@ -46,16 +84,13 @@ func (h *AuditHandler) CreateAuditLog(ctx context.Context, req *pb.CreateAuditLo
 		Metadata:        stringToPointer(req.Metadata),
 		Success:         req.Success,
 		FailureReason:   stringToPointer(req.FailureReason),
-		CreatedAt:       time.Now(),
+		CreatedAt:       createdAt,
 	}
 
-	err := h.repo.CreateAuditLog(auditLog)
+	err := h.createAuditLog(auditLog)
 	if err != nil {
 		log.Printf("Failed to create audit log: %v", err)
-		return &pb.CreateAuditLogResponse{
-			Success: false,
-			Message: "Failed to create audit log",
-		}, nil
+		return nil, grpcerr.Storage("Failed to create audit log", err)
 	}
 
 	return &pb.CreateAuditLogResponse{
@@ -70,57 +105,49 @@ func (h *AuditHandler) GetUserAuditLogs(ctx context.Context, req *pb.GetUserAudi
 	log.Printf("GetUserAuditLogs request received for user: %s", req.UserId)
 
 	limit := int(req.Limit)
-	if limit == 0 {
+	if limit <= 0 {
 		limit = 50 // Default limit
 	}
+	if limit > maxAuditLogPageSize {
+		limit = maxAuditLogPageSize
+	}
 
 	offset := int(req.Offset)
+	if offset < 0 {
+		return nil, grpcerr.InvalidArgument("Offset must not be negative", grpcerr.Field("offset", "must not be negative"))
+	}
 
-	logs, totalCount, err := h.repo.GetUserAuditLogs(
-		req.UserId,
-		limit,
-		offset,
-		req.EventCategory,
-		req.Severity,
-		req.SuccessOnly,
-	)
+	filter, err := auditLogFilterFromProto(req.Filter)
+	if err != nil {
+		return nil, err
+	}
+	filter.EventCategory = req.EventCategory
+	filter.Severity = req.Severity
+	if req.SuccessOnly {
+		success := true
+		filter.Success = &success
+	}
 
+	after, err := decodeAuditLogCursor(req.Cursor)
 	if err != nil {
-		log.Printf("Failed to get user audit logs: %v", err)
-		return &pb.GetUserAuditLogsResponse{
-			Success: false,
-			Message: "Failed to retrieve audit logs",
-		}, nil
+		return nil, errInvalidCursor
 	}
 
-	// Convert to protobuf format
-	pbLogs := make([]*pb.AuditLog, 0, len(logs))
-	for _, l := range logs {
-		pbLog := &pb.AuditLog{
-			Id:              l.ID,
-			UserId:          pointerToString(l.UserID),
-			SessionId:       pointerToString(l.SessionID),
-			DeviceId:        pointerToString(l.DeviceID),
-			EventType:       l.EventType,
-			EventCategory:   l.EventCategory,
-			Severity:        l.Severity,
-			IpAddress:       pointerToString(l.IPAddress),
-			UserAgent:       pointerToString(l.UserAgent),
-			LocationCountry: pointerToString(l.LocationCountry),
-			LocationCity:    pointerToString(l.LocationCity),
-			Metadata:        pointerToString(l.Metadata),
-			Success:         l.Success,
-			FailureReason:   pointerToString(l.FailureReason),
-			CreatedAt:       l.CreatedAt.Format(time.RFC3339),
-		}
-		pbLogs = append(pbLogs, pbLog)
+	logs, totalCount, hasMore, err := h.repo.GetUserAuditLogs(req.UserId, filter, after, limit, offset)
+	if err != nil {
+		log.Printf("Failed to get user audit logs: %v", err)
+		return nil, grpcerr.Storage("Failed to retrieve audit logs", err)
 	}
 
+	pbLogs, nextCursor := auditLogsToProto(logs, hasMore)
+
 	return &pb.GetUserAuditLogsResponse{
 		Success:    true,
 		Message:    "Audit logs retrieved successfully",
 		Logs:       pbLogs,
 		TotalCount: int32(totalCount),
+		NextCursor: nextCursor,
+		HasMore:    hasMore,
 	}, nil
 }
 
@@ -129,66 +156,105 @@ func (h *AuditHandler) GetAuditLogsByEvent(ctx context.Context, req *pb.GetAudit
 	log.Printf("GetAuditLogsByEvent request received for event: %s", req.EventType)
 
 	limit := int(req.Limit)
-	if limit == 0 {
+	if limit <= 0 {
 		limit = 50
 	}
+	if limit > maxAuditLogPageSize {
+		limit = maxAuditLogPageSize
+	}
 
 	offset := int(req.Offset)
+	if offset < 0 {
+		return nil, grpcerr.InvalidArgument("Offset must not be negative", grpcerr.Field("offset", "must not be negative"))
+	}
 
-	// Parse dates
-	startDate := time.Now().AddDate(0, 0, -30) // Default: 30 days ago
-	if req.StartDate != "" {
-		parsed, err := time.Parse(time.RFC3339, req.StartDate)
-		if err == nil {
-			startDate = parsed
+	filter, err := auditLogFilterFromProto(req.Filter)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse dates, unless the filter already has them
+	if filter.StartTime == nil {
+		startDate := time.Now().AddDate(0, 0, -30) // Default: 30 days ago
+		if req.StartDate != "" {
+			parsed, err := time.Parse(time.RFC3339, req.StartDate)
+			if err == nil {
+				startDate = parsed
+			}
 		}
+		filter.StartTime = &startDate
 	}
 
-	endDate := time.Now()
-	if req.EndDate != "" {
-		parsed, err := time.Parse(time.RFC3339, req.EndDate)
-		if err == nil {
-			endDate = parsed
+	if filter.EndTime == nil {
+		endDate := time.Now()
+		if req.EndDate != "" {
+			parsed, err := time.Parse(time.RFC3339, req.EndDate)
+			if err == nil {
+				endDate = parsed
+			}
 		}
+		filter.EndTime = &endDate
 	}
 
-	logs, totalCount, err := h.repo.GetAuditLogsByEvent(req.EventType, limit, offset, startDate, endDate)
+	after, err := decodeAuditLogCursor(req.Cursor)
 	if err != nil {
-		log.Printf("Failed to get audit logs by event: %v", err)
-		return &pb.GetAuditLogsByEventResponse{
-			Success: false,
-			Message: "Failed to retrieve audit logs",
-		}, nil
+		return nil, errInvalidCursor
 	}
 
-	// Convert to protobuf format
-	pbLogs := make([]*pb.AuditLog, 0, len(logs))
-	for _, l := range logs {
-		pbLog := &pb.AuditLog{
-			Id:              l.ID,
-			UserId:          pointerToString(l.UserID),
-			SessionId:       pointerToString(l.SessionID),
-			DeviceId:        pointerToString(l.DeviceID),
-			EventType:       l.EventType,
-			EventCategory:   l.EventCategory,
-			Severity:        l.Severity,
-			IpAddress:       pointerToString(l.IPAddress),
-			UserAgent:       pointerToString(l.UserAgent),
-			LocationCountry: pointerToString(l.LocationCountry),
-			LocationCity:    pointerToString(l.LocationCity),
-			Metadata:        pointerToString(l.Metadata),
-			Success:         l.Success,
-			FailureReason:   pointerToString(l.FailureReason),
-			CreatedAt:       l.CreatedAt.Format(time.RFC3339),
-		}
-		pbLogs = append(pbLogs, pbLog)
+	logs, totalCount, hasMore, err := h.repo.GetAuditLogsByEvent(req.EventType, filter, after, limit, offset)
+	if err != nil {
+		log.Printf("Failed to get audit logs by event: %v", err)
+		return nil, grpcerr.Storage("Failed to retrieve audit logs", err)
 	}
 
+	pbLogs, nextCursor := auditLogsToProto(logs, hasMore)
+
 	return &pb.GetAuditLogsByEventResponse{
 		Success:    true,
 		Message:    "Audit logs retrieved successfully",
 		Logs:       pbLogs,
 		TotalCount: int32(totalCount),
+		NextCursor: nextCursor,
+		HasMore:    hasMore,
+	}, nil
+}
+
+// SearchAuditLogs retrieves audit logs matching a search query
+func (h *AuditHandler) SearchAuditLogs(ctx context.Context, req *pb.SearchAuditLogsRequest) (*pb.SearchAuditLogsResponse, error) {
+	log.Printf("SearchAuditLogs request received for user: %s", req.UserId)
+
+	limit := int(req.Limit)
+	if limit <= 0 {
+		limit = 50
+	}
+	if limit > maxAuditLogPageSize {
+		limit = maxAuditLogPageSize
+	}
+
+	query, err := search.Parse(req.Query)
+	if err != nil {
+		return nil, invalidQuery(err)
+	}
+
+	after, err := decodeAuditLogCursor(req.Cursor)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+
+	logs, hasMore, err := h.repo.SearchAuditLogs(req.UserId, query, after, limit)
+	if err != nil {
+		log.Printf("Failed to search audit logs: %v", err)
+		return nil, grpcerr.Storage("Failed to search audit logs", err)
+	}
+
+	pbLogs, nextCursor := auditLogsToProto(logs, hasMore)
+
+	return &pb.SearchAuditLogsResponse{
+		Success:    true,
+		Message:    "Audit logs retrieved successfully",
+		Logs:       pbLogs,
+		NextCursor: nextCursor,
+		HasMore:    hasMore,
 	}, nil
 }
 
@@ -199,10 +265,7 @@ func (h *AuditHandler) GetSecurityAlerts(ctx context.Context, req *pb.GetSecurit
 	alerts, err := h.repo.GetSecurityAlerts(req.UserId, req.IncludeResolved, req.Severity)
 	if err != nil {
 		log.Printf("Failed to get security alerts: %v", err)
-		return &pb.GetSecurityAlertsResponse{
-			Success: false,
-			Message: "Failed to retrieve security alerts",
-		}, nil
+		return nil, grpcerr.Storage("Failed to retrieve security alerts", err)
 	}
 
 	// Convert to protobuf format
@@ -214,26 +277,7 @@ func (h *AuditHandler) GetSecurityAlerts(ctx context.Context, req *pb.GetSecurit
 			unresolvedCount++
 		}
 
-		resolvedAt := ""
-		if a.ResolvedAt != nil {
-			resolvedAt = a.ResolvedAt.Format(time.RFC3339)
-		}
-
-		pbAlert := &pb.SecurityAlert{
-			Id:              a.ID,
-			UserId:          a.UserID,
-			AlertType:       a.AlertType,
-			Severity:        a.Severity,
-			Description:     a.Description,
-			Metadata:        pointerToString(a.Metadata),
-			IpAddress:       pointerToString(a.IPAddress),
-			LocationCountry: pointerToString(a.LocationCountry),
-			LocationCity:    pointerToString(a.LocationCity),
-			IsResolved:      a.IsResolved,
-			ResolvedAt:      resolvedAt,
-			CreatedAt:       a.CreatedAt.Format(time.RFC3339),
-		}
-		pbAlerts = append(pbAlerts, pbAlert)
+		pbAlerts = append(pbAlerts, securityAlertToProto(&a))
 	}
 
 	return &pb.GetSecurityAlertsResponse{
@@ -245,11 +289,143 @@ func (h *AuditHandler) GetSecurityAlerts(ctx context.Context, req *pb.GetSecurit
 	}, nil
 }
 
+// ListSecurityAlerts lists security alerts across all users, for users with
+// the alerts:read permission. They only see their own organization's alerts;
+// operators see all.
+func (h *AuditHandler) ListSecurityAlerts(ctx context.Context, req *pb.ListSecurityAlertsRequest) (*pb.ListSecurityAlertsResponse, error) {
+	log.Printf("ListSecurityAlerts request received from %s", identity.ActorFromContext(ctx))
+
+	if req.UserId != "" {
+		if _, err := uuid.Parse(req.UserId); err != nil {
+			return nil, grpcerr.InvalidArgument("Invalid user ID", grpcerr.Field("user_id", "must be a UUID"))
+		}
+	}
+
+	limit := int(req.Limit)
+	if limit <= 0 || limit > 100 {
+		limit = 50
+	}
+
+	tenant, _ := identity.TenantFromContext(ctx)
+	alerts, totalCount, err := h.repo.ListSecurityAlerts(tenant, req.UserId, req.IncludeResolved, req.Severity, limit, int(req.Offset))
+	if err != nil {
+		log.Printf("Failed to list security alerts: %v", err)
+		return nil, grpcerr.Storage("Failed to retrieve security alerts", err)
+	}
+
+	pbAlerts := make([]*pb.SecurityAlert, 0, len(alerts))
+	for i := range alerts {
+		pbAlerts = append(pbAlerts, securityAlertToProto(&alerts[i]))
+	}
+
+	return &pb.ListSecurityAlertsResponse{
+		Success:    true,
+		Message:    "Security alerts retrieved successfully",
+		Alerts:     pbAlerts,
+		TotalCount: int32(totalCount),
+	}, nil
+}
+
+// AnonymizeUserAuditLogs erases a user's personal data from the audit trail,
+// when the auth service deletes their account
+func (h *AuditHandler) AnonymizeUserAuditLogs(ctx context.Context, req *pb.AnonymizeUserAuditLogsRequest) (*pb.AnonymizeUserAuditLogsResponse, error) {
+	log.Printf("AnonymizeUserAuditLogs request received for user %s from %s", req.UserId, identity.ActorFromContext(ctx))
+
+	if req.UserId == "" {
+		return nil, grpcerr.InvalidArgument("User ID is required", grpcerr.Field("user_id", "is required"))
+	}
+	if _, err := uuid.Parse(req.UserId); err != nil {
+		return nil, grpcerr.InvalidArgument("Invalid user ID", grpcerr.Field("user_id", "must be a UUID"))
+	}
+
+	erasedBy := req.ErasedBy
+	if erasedBy == "" {
+		erasedBy = identity.ActorFromContext(ctx)
+	}
+
+	redacted, err := h.repo.AnonymizeUserAuditLogs(req.UserId, erasedBy)
+	if err != nil {
+		log.Printf("Failed to anonymize audit logs: %v", err)
+		return nil, grpcerr.Storage("Failed to anonymize audit logs", err)
+	}
+
+	// Not recorded under the user, whose events no longer keep metadata
+	h.recordAuditEvent("", "audit_logs_anonymized", map[string]interface{}{
+		"user_id":          req.UserId,
+		"erased_by":        erasedBy,
+		"redacted_entries": redacted,
+	})
+
+	return &pb.AnonymizeUserAuditLogsResponse{
+		Success:         true,
+		Message:         fmt.Sprintf("Redacted %d audit log entries", redacted),
+		RedactedEntries: int32(redacted),
+	}, nil
+}
+
+// ExportUserData returns everything else the audit service holds about a
+// user for their data export: security alerts, notification preferences and
+// webhook subscriptions. Webhook secrets are left out.
+func (h *AuditHandler) ExportUserData(ctx context.Context, req *pb.ExportUserDataRequest) (*pb.ExportUserDataResponse, error) {
+	log.Printf("ExportUserData request received for user: %s", req.UserId)
+
+	alerts, err := h.repo.GetSecurityAlerts(req.UserId, true, "")
+	if err != nil {
+		log.Printf("Failed to get security alerts: %v", err)
+		return nil, grpcerr.Storage("Failed to retrieve security alerts", err)
+	}
+	pbAlerts := make([]*pb.SecurityAlert, 0, len(alerts))
+	for i := range alerts {
+		pbAlerts = append(pbAlerts, securityAlertToProto(&alerts[i]))
+	}
+
+	prefs, err := h.notifications.GetNotificationPreferences(req.UserId)
+	if err != nil {
+		log.Printf("Failed to get notification preferences: %v", err)
+		return nil, grpcerr.Storage("Failed to retrieve notification preferences", err)
+	}
+	var pbPrefs *pb.NotificationPreferences
+	if prefs != nil {
+		pbPrefs = notificationPreferencesToProto(prefs)
+	}
+
+	subs, err := h.webhooks.ListWebhookSubscriptions(stringToPointer(req.UserId))
+	if err != nil {
+		log.Printf("Failed to list webhook subscriptions: %v", err)
+		return nil, grpcerr.Storage("Failed to retrieve webhook subscriptions", err)
+	}
+	pbSubs := make([]*pb.WebhookSubscription, 0, len(subs))
+	for i := range subs {
+		pbSubs = append(pbSubs, webhookSubscriptionToProto(&subs[i]))
+	}
+
+	return &pb.ExportUserDataResponse{
+		Success:                 true,
+		Message:                 "User data exported successfully",
+		SecurityAlerts:          pbAlerts,
+		NotificationPreferences: pbPrefs,
+		WebhookSubscriptions:    pbSubs,
+	}, nil
+}
+
 // CreateSecurityAlert creates a new security alert
 func (h *AuditHandler) CreateSecurityAlert(ctx context.Context, req *pb.CreateSecurityAlertRequest) (*pb.CreateSecurityAlertResponse, error) {
 	log.Printf("CreateSecurityAlert request received: %s", req.AlertType)
 
-	alertID := uuid.New().String()
+	if err := validateSecurityAlert(req); err != nil {
+		log.Printf("Rejected security alert %s: %v", req.AlertType, err)
+		return nil, err
+	}
+
+	alertID := req.Id
+	if alertID == "" {
+		alertID = uuid.New().String()
+	}
+
+	createdAt := time.Now()
+	if req.CreatedAt != "" {
+		createdAt, _ = time.Parse(time.RFC3339Nano, req.CreatedAt)
+	}
 
 	alert := &models.SecurityAlert{
 		ID:              alertID,
@@ -262,16 +438,17 @@ func (h *AuditHandler) CreateSecurityAlert(ctx context.Context, req *pb.CreateSe
 		LocationCountry: stringToPointer(req.LocationCountry),
 		LocationCity:    stringToPointer(req.LocationCity),
 		IsResolved:      false,
-		CreatedAt:       time.Now(),
+		CreatedAt:       createdAt,
 	}
 
-	err := h.repo.CreateSecurityAlert(alert)
+	created, err := h.repo.CreateSecurityAlert(alert)
 	if err != nil {
 		log.Printf("Failed to create security alert: %v", err)
-		return &pb.CreateSecurityAlertResponse{
-			Success: false,
-			Message: "Failed to create security alert",
-		}, nil
+		return nil, grpcerr.Storage("Failed to create security alert", err)
+	}
+	// A retry of an alert that was already stored has already been forwarded
+	if created {
+		h.forwarder.SecurityAlert(alert)
 	}
 
 	return &pb.CreateSecurityAlertResponse{
@@ -285,15 +462,38 @@ func (h *AuditHandler) CreateSecurityAlert(ctx context.Context, req *pb.CreateSe
 func (h *AuditHandler) ResolveSecurityAlert(ctx context.Context, req *pb.ResolveSecurityAlertRequest) (*pb.ResolveSecurityAlertResponse, error) {
 	log.Printf("ResolveSecurityAlert request received: %s", req.AlertId)
 
-	err := h.repo.ResolveSecurityAlert(req.AlertId)
+	notFound := grpcerr.NotFound("Security alert not found", "security_alert", req.AlertId)
+	if _, err := uuid.Parse(req.AlertId); err != nil {
+		return nil, notFound
+	}
+
+	alert, err := h.repo.GetSecurityAlertByID(req.AlertId)
+	if errors.Is(err, repository.ErrSecurityAlertNotFound) {
+		return nil, notFound
+	}
+	if err != nil {
+		log.Printf("Failed to get security alert: %v", err)
+		return nil, grpcerr.Storage("Failed to get security alert", err)
+	}
+
+	if err := h.authz.RequireOwner(ctx, "security_alert", req.AlertId, alert.UserID, alert.OrganizationID, identity.PermissionAlertsResolve); err != nil {
+		return nil, err
+	}
+
+	err = h.repo.ResolveSecurityAlert(req.AlertId)
+	if errors.Is(err, repository.ErrSecurityAlertNotFound) {
+		return nil, notFound
+	}
 	if err != nil {
 		log.Printf("Failed to resolve security alert: %v", err)
-		return &pb.ResolveSecurityAlertResponse{
-			Success: false,
-			Message: "Failed to resolve security alert",
-		}, nil
+		return nil, grpcerr.Storage("Failed to resolve security alert", err)
 	}
 
+	h.recordAuditEvent(alert.UserID, "security_alert_resolved", map[string]interface{}{
+		"alert_id":    req.AlertId,
+		"resolved_by": identity.ActorFromContext(ctx),
+	})
+
 	return &pb.ResolveSecurityAlertResponse{
 		Success: true,
 		Message: "Security alert resolved successfully",
@@ -324,10 +524,7 @@ func (h *AuditHandler) GetComplianceReport(ctx context.Context, req *pb.GetCompl
 	report, err := h.repo.GetComplianceReport(req.UserId, startDate, endDate)
 	if err != nil {
 		log.Printf("Failed to get compliance report: %v", err)
-		return &pb.GetComplianceReportResponse{
-			Success: false,
-			Message: "Failed to generate compliance report",
-		}, nil
+		return nil, grpcerr.Storage("Failed to generate compliance report", err)
 	}
 
 	// Convert event breakdown
@@ -365,10 +562,7 @@ func (h *AuditHandler) GetActivitySummary(ctx context.Context, req *pb.GetActivi
 	summary, err := h.repo.GetActivitySummary(req.UserId, days)
 	if err != nil {
 		log.Printf("Failed to get activity summary: %v", err)
-		return &pb.GetActivitySummaryResponse{
-			Success: false,
-			Message: "Failed to retrieve activity summary",
-		}, nil
+		return nil, grpcerr.Storage("Failed to retrieve activity summary", err)
 	}
 
 	// Convert daily activity
@@ -392,7 +586,416 @@ func (h *AuditHandler) GetActivitySummary(ctx context.Context, req *pb.GetActivi
 	}, nil
 }
 
+// GetNotificationPreferences retrieves a user's security alert notification preferences
+func (h *AuditHandler) GetNotificationPreferences(ctx context.Context, req *pb.GetNotificationPreferencesRequest) (*pb.GetNotificationPreferencesResponse, error) {
+	log.Printf("GetNotificationPreferences request received for user: %s", req.UserId)
+
+	prefs, err := h.notifications.GetNotificationPreferences(req.UserId)
+	if err != nil {
+		log.Printf("Failed to get notification preferences: %v", err)
+		return nil, grpcerr.Storage("Failed to retrieve notification preferences", err)
+	}
+
+	// Users who never saved preferences get email notifications only
+	if prefs == nil {
+		prefs = &models.NotificationPreferences{
+			UserID:       req.UserId,
+			EmailEnabled: true,
+		}
+	}
+
+	return &pb.GetNotificationPreferencesResponse{
+		Success:     true,
+		Message:     "Notification preferences retrieved successfully",
+		Preferences: notificationPreferencesToProto(prefs),
+	}, nil
+}
+
+// UpdateNotificationPreferences saves a user's security alert notification preferences
+func (h *AuditHandler) UpdateNotificationPreferences(ctx context.Context, req *pb.UpdateNotificationPreferencesRequest) (*pb.UpdateNotificationPreferencesResponse, error) {
+	log.Printf("UpdateNotificationPreferences request received for user: %s", req.UserId)
+
+	if req.MinSeverity != "" && !notifications.ValidSeverity(req.MinSeverity) {
+		return nil, grpcerr.InvalidArgument("Minimum severity must be one of low, medium, high or critical",
+			grpcerr.Field("min_severity", "must be one of low, medium, high or critical"))
+	}
+
+	if req.WebhookUrl != "" {
+		if err := notifications.ValidateWebhookURL(req.WebhookUrl); err != nil {
+			return nil, grpcerr.InvalidArgument("Webhook URL must be an absolute https URL on a public host",
+				grpcerr.Field("webhook_url", err.Error()))
+		}
+	}
+
+	if req.WebhookEnabled && req.WebhookUrl == "" {
+		return nil, grpcerr.InvalidArgument("Webhook URL is required to enable webhook notifications",
+			grpcerr.Field("webhook_url", "is required to enable webhook notifications"))
+	}
+
+	existing, err := h.notifications.GetNotificationPreferences(req.UserId)
+	if err != nil {
+		log.Printf("Failed to get notification preferences: %v", err)
+		return nil, grpcerr.Storage("Failed to update notification preferences", err)
+	}
+
+	// Keep the current signing secret unless a new one is supplied, and only
+	// generate one (returned once) when the webhook is enabled without any
+	webhookSecret := stringToPointer(req.WebhookSecret)
+	if webhookSecret == nil && existing != nil {
+		webhookSecret = existing.WebhookSecret
+	}
+
+	generatedSecret := ""
+	if req.WebhookEnabled && webhookSecret == nil {
+		generatedSecret, err = notifications.GenerateWebhookSecret()
+		if err != nil {
+			log.Printf("Failed to generate webhook secret: %v", err)
+			return nil, grpcerr.Internal("Failed to update notification preferences")
+		}
+		webhookSecret = &generatedSecret
+	}
+
+	prefs := &models.NotificationPreferences{
+		UserID:         req.UserId,
+		EmailEnabled:   req.EmailEnabled,
+		WebhookEnabled: req.WebhookEnabled,
+		WebhookURL:     stringToPointer(req.WebhookUrl),
+		WebhookSecret:  webhookSecret,
+		MinSeverity:    stringToPointer(req.MinSeverity),
+	}
+
+	if err := h.notifications.UpsertNotificationPreferences(prefs); err != nil {
+		log.Printf("Failed to save notification preferences: %v", err)
+		return nil, grpcerr.Storage("Failed to update notification preferences", err)
+	}
+
+	h.recordAuditEvent(req.UserId, "notification_preferences_updated", map[string]interface{}{
+		"email_enabled":   prefs.EmailEnabled,
+		"webhook_enabled": prefs.WebhookEnabled,
+		"webhook_url":     req.WebhookUrl,
+		"min_severity":    req.MinSeverity,
+		"secret_rotated":  req.WebhookSecret != "" || generatedSecret != "",
+	})
+
+	return &pb.UpdateNotificationPreferencesResponse{
+		Success:       true,
+		Message:       "Notification preferences updated successfully",
+		Preferences:   notificationPreferencesToProto(prefs),
+		WebhookSecret: generatedSecret,
+	}, nil
+}
+
+// Audit event schema shared by every service that writes audit logs
+var (
+	eventTypePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,49}$`)
+
+	eventCategories = map[string]bool{
+		"authentication":     true,
+		"authorization":      true,
+		"session_management": true,
+		"security":           true,
+	}
+
+	eventSeverities = map[string]bool{
+		"info":     true,
+		"warning":  true,
+		"critical": true,
+	}
+)
+
+// maxEventClockSkew is how far in the future a client-supplied event time may be
+const maxEventClockSkew = 5 * time.Minute
+
+// maxAuditLogPageSize caps how many audit logs a single listing returns
+const maxAuditLogPageSize = 500
+
+// validateAuditEvent returns an InvalidArgument error describing what's wrong
+// with an audit event, or nil if it can be stored
+func validateAuditEvent(req *pb.CreateAuditLogRequest) error {
+	invalid := func(field, description string) error {
+		return grpcerr.InvalidArgument("Invalid audit event: "+field+" "+description, grpcerr.Field(field, description))
+	}
+
+	if !eventTypePattern.MatchString(req.EventType) {
+		return invalid("event_type", "must be lower snake_case and at most 50 characters")
+	}
+
+	if !eventCategories[req.EventCategory] {
+		return invalid("event_category", "is not a known category: "+req.EventCategory)
+	}
+
+	if !eventSeverities[req.Severity] {
+		return invalid("severity", "must be one of info, warning or critical")
+	}
+
+	for _, field := range []struct{ name, value string }{
+		{"id", req.Id},
+		{"user_id", req.UserId},
+		{"session_id", req.SessionId},
+		{"device_id", req.DeviceId},
+	} {
+		if field.value == "" {
+			continue
+		}
+		if _, err := uuid.Parse(field.value); err != nil {
+			return invalid(field.name, "must be a UUID")
+		}
+	}
+
+	if req.IpAddress != "" && net.ParseIP(req.IpAddress) == nil {
+		return invalid("ip_address", "is not a valid IP address")
+	}
+
+	if len(req.LocationCountry) > 100 {
+		return invalid("location_country", "is longer than 100 characters")
+	}
+	if len(req.LocationCity) > 100 {
+		return invalid("location_city", "is longer than 100 characters")
+	}
+
+	if req.Metadata != "" && !json.Valid([]byte(req.Metadata)) {
+		return invalid("metadata", "must be valid JSON")
+	}
+
+	if req.CreatedAt != "" {
+		createdAt, err := time.Parse(time.RFC3339Nano, req.CreatedAt)
+		if err != nil {
+			return invalid("created_at", "must be an RFC 3339 timestamp")
+		}
+		if createdAt.After(time.Now().Add(maxEventClockSkew)) {
+			return invalid("created_at", "is in the future")
+		}
+	}
+
+	return nil
+}
+
+// validateSecurityAlert returns an InvalidArgument error if a security alert's
+// client-supplied ID or time can't be stored
+func validateSecurityAlert(req *pb.CreateSecurityAlertRequest) error {
+	invalid := func(field, description string) error {
+		return grpcerr.InvalidArgument("Invalid security alert: "+field+" "+description, grpcerr.Field(field, description))
+	}
+
+	if req.Id != "" {
+		if _, err := uuid.Parse(req.Id); err != nil {
+			return invalid("id", "must be a UUID")
+		}
+	}
+
+	if req.CreatedAt != "" {
+		createdAt, err := time.Parse(time.RFC3339Nano, req.CreatedAt)
+		if err != nil {
+			return invalid("created_at", "must be an RFC 3339 timestamp")
+		}
+		if createdAt.After(time.Now().Add(maxEventClockSkew)) {
+			return invalid("created_at", "is in the future")
+		}
+	}
+
+	return nil
+}
+
 // Helper functions
+
+// createAuditLog stores an audit log and mirrors it to the forwarding sinks
+func (h *AuditHandler) createAuditLog(auditLog *models.AuditLog) error {
+	if err := h.repo.CreateAuditLog(auditLog); err != nil {
+		return err
+	}
+
+	// A zero sequence means a retry of an event that was already stored and forwarded
+	if auditLog.Sequence != 0 {
+		h.forwarder.AuditLog(auditLog)
+	}
+	return nil
+}
+
+// recordAuditEvent logs a security configuration change made through this service
+func (h *AuditHandler) recordAuditEvent(userID, eventType string, metadata map[string]interface{}) {
+	metadataJSON, _ := json.Marshal(metadata)
+	metadataStr := string(metadataJSON)
+
+	err := h.createAuditLog(&models.AuditLog{
+		ID:            uuid.New().String(),
+		UserID:        stringToPointer(userID),
+		EventType:     eventType,
+		EventCategory: "security",
+		Severity:      "info",
+		Metadata:      &metadataStr,
+		Success:       true,
+		CreatedAt:     time.Now(),
+	})
+	if err != nil {
+		log.Printf("Failed to create audit log: %v", err)
+	}
+}
+
+func securityAlertToProto(alert *models.SecurityAlert) *pb.SecurityAlert {
+	resolvedAt := ""
+	if alert.ResolvedAt != nil {
+		resolvedAt = alert.ResolvedAt.Format(time.RFC3339)
+	}
+
+	return &pb.SecurityAlert{
+		Id:              alert.ID,
+		UserId:          alert.UserID,
+		AlertType:       alert.AlertType,
+		Severity:        alert.Severity,
+		Description:     alert.Description,
+		Metadata:        pointerToString(alert.Metadata),
+		IpAddress:       pointerToString(alert.IPAddress),
+		LocationCountry: pointerToString(alert.LocationCountry),
+		LocationCity:    pointerToString(alert.LocationCity),
+		IsResolved:      alert.IsResolved,
+		ResolvedAt:      resolvedAt,
+		CreatedAt:       alert.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+func notificationPreferencesToProto(prefs *models.NotificationPreferences) *pb.NotificationPreferences {
+	updatedAt := ""
+	if !prefs.UpdatedAt.IsZero() {
+		updatedAt = prefs.UpdatedAt.Format(time.RFC3339)
+	}
+
+	return &pb.NotificationPreferences{
+		EmailEnabled:   prefs.EmailEnabled,
+		WebhookEnabled: prefs.WebhookEnabled,
+		WebhookUrl:     pointerToString(prefs.WebhookURL),
+		MinSeverity:    pointerToString(prefs.MinSeverity),
+		UpdatedAt:      updatedAt,
+	}
+}
+
+// auditLogFilterFromProto validates a listing filter, returning an
+// InvalidArgument error if it's invalid
+func auditLogFilterFromProto(req *pb.AuditLogFilter) (models.AuditLogFilter, error) {
+	var filter models.AuditLogFilter
+	if req == nil {
+		return filter, nil
+	}
+
+	invalid := func(field, description string) error {
+		return grpcerr.InvalidArgument(field+" "+description, grpcerr.Field("filter."+field, description))
+	}
+
+	if req.StartTime != "" {
+		parsed, err := time.Parse(time.RFC3339, req.StartTime)
+		if err != nil {
+			return filter, invalid("start_time", "must be an RFC 3339 timestamp")
+		}
+		filter.StartTime = &parsed
+	}
+
+	if req.EndTime != "" {
+		parsed, err := time.Parse(time.RFC3339, req.EndTime)
+		if err != nil {
+			return filter, invalid("end_time", "must be an RFC 3339 timestamp")
+		}
+		filter.EndTime = &parsed
+	}
+
+	if req.IpAddress != "" {
+		if _, _, err := net.ParseCIDR(req.IpAddress); err != nil && net.ParseIP(req.IpAddress) == nil {
+			return filter, invalid("ip_address", "must be an IP address or CIDR range")
+		}
+		filter.IPNetwork = req.IpAddress
+	}
+
+	if req.SessionId != "" {
+		if _, err := uuid.Parse(req.SessionId); err != nil {
+			return filter, invalid("session_id", "must be a UUID")
+		}
+		filter.SessionID = req.SessionId
+	}
+
+	if req.DeviceId != "" {
+		if _, err := uuid.Parse(req.DeviceId); err != nil {
+			return filter, invalid("device_id", "must be a UUID")
+		}
+		filter.DeviceID = req.DeviceId
+	}
+
+	filter.EventTypes = req.EventTypes
+	filter.Success = req.Success
+
+	return filter, nil
+}
+
+// errInvalidCursor is returned for a cursor that decodeAuditLogCursor rejects
+var errInvalidCursor = grpcerr.InvalidArgument("Invalid cursor", grpcerr.Field("cursor", "is not a cursor returned by a previous page"))
+
+// invalidQuery reports a search query that doesn't parse
+func invalidQuery(err error) error {
+	return grpcerr.InvalidArgument("Invalid query: "+err.Error(), grpcerr.Field("query", err.Error()))
+}
+
+// encodeAuditLogCursor returns the opaque cursor pointing just after an entry
+func encodeAuditLogCursor(l *models.AuditLog) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(l.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + l.ID))
+}
+
+// decodeAuditLogCursor parses a cursor from encodeAuditLogCursor; empty means the first page
+func decodeAuditLogCursor(cursor string) (*models.AuditLogCursor, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	createdAt, id, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return nil, fmt.Errorf("malformed cursor")
+	}
+
+	parsed, err := time.Parse(time.RFC3339Nano, createdAt)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, err
+	}
+
+	return &models.AuditLogCursor{CreatedAt: parsed, ID: id}, nil
+}
+
+// auditLogsToProto converts a page of logs, returning the cursor for the next page if there is one
+func auditLogsToProto(logs []models.AuditLog, hasMore bool) ([]*pb.AuditLog, string) {
+	pbLogs := make([]*pb.AuditLog, 0, len(logs))
+	for i := range logs {
+		l := &logs[i]
+		pbLogs = append(pbLogs, &pb.AuditLog{
+			Id:              l.ID,
+			UserId:          pointerToString(l.UserID),
+			SessionId:       pointerToString(l.SessionID),
+			DeviceId:        pointerToString(l.DeviceID),
+			EventType:       l.EventType,
+			EventCategory:   l.EventCategory,
+			Severity:        l.Severity,
+			IpAddress:       pointerToString(l.IPAddress),
+			UserAgent:       pointerToString(l.UserAgent),
+			LocationCountry: pointerToString(l.LocationCountry),
+			LocationCity:    pointerToString(l.LocationCity),
+			Metadata:        pointerToString(l.Metadata),
+			Success:         l.Success,
+			FailureReason:   pointerToString(l.FailureReason),
+			CreatedAt:       l.CreatedAt.Format(time.RFC3339),
+			Cursor:          encodeAuditLogCursor(l),
+		})
+	}
+
+	nextCursor := ""
+	if hasMore && len(pbLogs) > 0 {
+		nextCursor = pbLogs[len(pbLogs)-1].Cursor
+	}
+
+	return pbLogs, nextCursor
+}
+
 func stringToPointer(s string) *string {
 	if s == "" {
 		return nil
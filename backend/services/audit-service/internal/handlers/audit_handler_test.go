@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"context"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/aashiq-04/session-management-system/backend/services/audit-service/internal/forwarding"
+	pb "github.com/aashiq-04/session-management-system/backend/services/audit-service/proto"
+)
+
+// recordingSink is a forwarding sink that keeps what it is sent
+type recordingSink struct {
+	mu     sync.Mutex
+	events []forwarding.Event
+}
+
+func (s *recordingSink) Name() string { return "recording" }
+func (s *recordingSink) Close() error { return nil }
+
+func (s *recordingSink) Send(ctx context.Context, events []forwarding.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, events...)
+	return nil
+}
+
+func (s *recordingSink) received() []forwarding.Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]forwarding.Event(nil), s.events...)
+}
+
+// newForwardingTestHandler returns a handler on a mock database forwarding to sink
+func newForwardingTestHandler(t *testing.T, sink forwarding.Sink) (*AuditHandler, sqlmock.Sqlmock) {
+	t.Helper()
+
+	h, mock := newPolicyTestHandler(t)
+
+	forwarder, err := forwarding.New(forwarding.Config{
+		BufferDir:       t.TempDir(),
+		MaxBufferBytes:  1 << 20,
+		BatchSize:       10,
+		RetryBackoff:    20 * time.Millisecond,
+		MaxRetryBackoff: 200 * time.Millisecond,
+	}, sink)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		forwarder.Run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	h.forwarder = forwarder
+	return h, mock
+}
+
+// The auth service relays its alerts from an outbox, with the alert's ID and
+// time, and may send one more than once. The alert reaches the sinks once.
+func TestCreateSecurityAlertForwardsAuthServiceAlert(t *testing.T) {
+	sink := &recordingSink{}
+	h, mock := newForwardingTestHandler(t, sink)
+
+	const alertID = "6f1c1d8e-3b7a-4c7e-9d55-0a6f1e2b3c4d"
+	raisedAt := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	req := &pb.CreateSecurityAlertRequest{
+		Id:              alertID,
+		UserId:          "9b2d6a3e-1f4c-4e8a-b6d7-2c3e4f5a6b7c",
+		AlertType:       "impossible_travel",
+		Severity:        "high",
+		Description:     "Login from two countries within an hour",
+		IpAddress:       "203.0.113.7",
+		LocationCountry: "FR",
+		CreatedAt:       raisedAt.Format(time.RFC3339Nano),
+	}
+
+	insert := regexp.QuoteMeta("INSERT INTO security_alerts")
+	mock.ExpectExec(insert).
+		WithArgs(alertID, req.UserId, "impossible_travel", "high", req.Description, nil, req.IpAddress, req.LocationCountry, nil, false, raisedAt).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// The redelivery finds the alert already stored
+	mock.ExpectExec(insert).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	for attempt := 1; attempt <= 2; attempt++ {
+		resp, err := h.CreateSecurityAlert(context.Background(), req)
+		if err != nil {
+			t.Fatalf("attempt %d: %v", attempt, err)
+		}
+		if resp.AlertId != alertID {
+			t.Errorf("attempt %d: alert ID = %q, want %q", attempt, resp.AlertId, alertID)
+		}
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(sink.received()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the alert to reach the sink")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	// Give a second, wrongly forwarded copy time to arrive
+	time.Sleep(100 * time.Millisecond)
+
+	events := sink.received()
+	if len(events) != 1 {
+		t.Fatalf("sink received %d events, want 1", len(events))
+	}
+	event := events[0]
+	if event.Kind != forwarding.KindSecurityAlert || event.Alert == nil {
+		t.Fatalf("sink received %+v, want a security alert", event)
+	}
+	if event.Alert.ID != alertID || event.Alert.AlertType != "impossible_travel" || !event.Alert.CreatedAt.Equal(raisedAt) {
+		t.Errorf("sink received alert %+v", event.Alert)
+	}
+}
+
+func TestCreateSecurityAlertRejectsInvalidAlert(t *testing.T) {
+	tests := []struct {
+		name string
+		req  *pb.CreateSecurityAlertRequest
+	}{
+		{"ID not a UUID", &pb.CreateSecurityAlertRequest{Id: "alert-1", AlertType: "new_device"}},
+		{"time not RFC 3339", &pb.CreateSecurityAlertRequest{AlertType: "new_device", CreatedAt: "yesterday"}},
+		{"time in the future", &pb.CreateSecurityAlertRequest{AlertType: "new_device", CreatedAt: time.Now().Add(time.Hour).Format(time.RFC3339Nano)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The mock fails the test if anything is stored
+			h, _ := newPolicyTestHandler(t)
+			_, err := h.CreateSecurityAlert(context.Background(), tt.req)
+			if status.Code(err) != codes.InvalidArgument {
+				t.Errorf("err = %v, want InvalidArgument", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/aashiq-04/session-management-system/backend/services/audit-service/proto"
+)
+
+// exportStream collects the chunks of an export, failing Send with err
+type exportStream struct {
+	grpc.ServerStream
+	ctx  context.Context
+	err  error
+	data bytes.Buffer
+}
+
+func (s *exportStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *exportStream) Send(chunk *pb.ExportAuditLogsChunk) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.data.Write(chunk.Data)
+	return nil
+}
+
+var auditLogColumns = []string{
+	"id", "user_id", "session_id", "device_id", "event_type", "event_category",
+	"severity", "ip_address", "user_agent", "location_country", "location_city",
+	"metadata", "success", "failure_reason", "created_at",
+}
+
+// expectExportQuery expects the export to read rows for user-1's logs
+func expectExportQuery(mock sqlmock.Sqlmock, rows int) {
+	result := sqlmock.NewRows(auditLogColumns)
+	for i := 0; i < rows; i++ {
+		result.AddRow(fmt.Sprintf("00000000-0000-0000-0000-%012d", i+1), "user-1", nil, nil,
+			"login_success", "authentication", "info", nil, nil, nil, nil, "{}", true, nil,
+			time.Date(2026, 3, 1, 12, 0, i, 0, time.UTC))
+	}
+	mock.ExpectQuery(regexp.QuoteMeta("ORDER BY created_at DESC, id DESC")).
+		WithArgs("user-1", 1001).
+		WillReturnRows(result)
+}
+
+// exportMetadata matches the metadata of an audit_logs_exported event
+type exportMetadata struct {
+	completed bool
+	rowCount  int
+}
+
+func (m exportMetadata) Match(v driver.Value) bool {
+	s, ok := v.(string)
+	if !ok {
+		return false
+	}
+	var metadata struct {
+		Format    string `json:"format"`
+		RowCount  int    `json:"row_count"`
+		Completed bool   `json:"completed"`
+	}
+	if err := json.Unmarshal([]byte(s), &metadata); err != nil {
+		return false
+	}
+	return metadata.Format == "csv" && metadata.Completed == m.completed && metadata.RowCount == m.rowCount
+}
+
+// expectExportRecorded expects an audit_logs_exported event for admin-1,
+// marked as failed unless the export completed
+func expectExportRecorded(mock sqlmock.Sqlmock, metadata exportMetadata) {
+	anyArgs := func(n int) []driver.Value {
+		args := make([]driver.Value, n)
+		for i := range args {
+			args[i] = sqlmock.AnyArg()
+		}
+		return args
+	}
+
+	normalizeArgs := anyArgs(7)
+	normalizeArgs[1] = "admin-1"
+	normalizeArgs[5] = metadata
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT $1::uuid")).
+		WithArgs(normalizeArgs...).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "session_id", "device_id", "ip_address", "metadata", "created_at"}).
+			AddRow("00000000-0000-0000-0000-000000000001", "admin-1", nil, nil, nil, "{}", time.Now()))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM audit_chain_head FOR UPDATE")).
+		WillReturnRows(sqlmock.NewRows([]string{"sequence", "entry_hash"}).AddRow(0, ""))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM audit_log_erasures")).
+		WithArgs("admin-1").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+
+	insertArgs := anyArgs(18)
+	insertArgs[4] = "audit_logs_exported"
+	insertArgs[12] = metadata.completed
+	if metadata.completed {
+		insertArgs[6] = "info"
+		insertArgs[13] = nil
+	} else {
+		insertArgs[6] = "warning"
+		insertArgs[13] = "export did not complete"
+	}
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO audit_logs")).
+		WithArgs(insertArgs...).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE audit_chain_head")).
+		WithArgs(anyArgs(2)...).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+}
+
+func exportRequest(format string) *pb.ExportAuditLogsRequest {
+	return &pb.ExportAuditLogsRequest{UserId: "user-1", Format: format, RequestedBy: "admin-1"}
+}
+
+func TestExportAuditLogs(t *testing.T) {
+	h, mock := newPolicyTestHandler(t)
+	expectExportQuery(mock, 2)
+	expectExportRecorded(mock, exportMetadata{completed: true, rowCount: 2})
+
+	stream := &exportStream{ctx: context.Background()}
+	if err := h.ExportAuditLogs(exportRequest("csv"), stream); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(stream.data.String(), "\n"), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "id,created_at,") {
+		t.Errorf("exported %q, want a header and 2 rows", stream.data.String())
+	}
+}
+
+// An export that stops part way is still recorded, as incomplete
+func TestExportAuditLogsRecordsFailedExport(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		sendErr  error
+		rows     int
+		queryErr error
+		exported int
+		code     codes.Code
+	}{
+		{"query fails", context.Background(), nil, 0, errors.New("relation audit_logs is locked"), 0, codes.Internal},
+		{"send fails", context.Background(), errors.New("transport is closing"), 1, nil, 1, codes.Internal},
+		{"client cancels", cancelled, nil, 1, nil, 0, codes.Canceled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, mock := newPolicyTestHandler(t)
+			if tt.queryErr != nil {
+				mock.ExpectQuery(regexp.QuoteMeta("ORDER BY created_at DESC, id DESC")).WillReturnError(tt.queryErr)
+			} else {
+				expectExportQuery(mock, tt.rows)
+			}
+			expectExportRecorded(mock, exportMetadata{completed: false, rowCount: tt.exported})
+
+			stream := &exportStream{ctx: tt.ctx, err: tt.sendErr}
+			err := h.ExportAuditLogs(exportRequest("csv"), stream)
+			if status.Code(err) != tt.code {
+				t.Errorf("got %v, want %v", err, tt.code)
+			}
+		})
+	}
+}
+
+// Bad requests are refused before anything is exported or recorded
+func TestExportAuditLogsRejectsUnknownFormat(t *testing.T) {
+	for _, format := range []string{"", "xml", "CSV"} {
+		h, _ := newPolicyTestHandler(t)
+
+		stream := &exportStream{ctx: context.Background()}
+		err := h.ExportAuditLogs(exportRequest(format), stream)
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("format %q: got %v, want InvalidArgument", format, err)
+		}
+		if stream.data.Len() != 0 {
+			t.Errorf("format %q: exported %q", format, stream.data.String())
+		}
+	}
+}
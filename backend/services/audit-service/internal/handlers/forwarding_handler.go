@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"context"
+	"time"
+
+	pb "github.com/aashiq-04/session-management-system/backend/services/audit-service/proto"
+)
+
+// GetForwardingStatus reports the backlog and lag of each forwarding sink
+func (h *AuditHandler) GetForwardingStatus(ctx context.Context, req *pb.GetForwardingStatusRequest) (*pb.GetForwardingStatusResponse, error) {
+	var sinks []*pb.ForwardingSinkStatus
+	for _, status := range h.forwarder.Status() {
+		sinks = append(sinks, &pb.ForwardingSinkStatus{
+			Name:          status.Name,
+			Pending:       int64(status.Pending),
+			LagSeconds:    status.Lag.Seconds(),
+			Sent:          status.Sent,
+			Failures:      status.Failures,
+			Dropped:       status.Dropped,
+			Parked:        status.Parked,
+			LastError:     status.LastError,
+			LastErrorAt:   formatOptionalTime(status.LastErrorAt),
+			LastSuccessAt: formatOptionalTime(status.LastSuccessAt),
+		})
+	}
+
+	return &pb.GetForwardingStatusResponse{
+		Success: true,
+		Message: "Forwarding status retrieved successfully",
+		Sinks:   sinks,
+	}, nil
+}
+
+// formatOptionalTime formats t as RFC 3339, or returns "" for the zero time
+func formatOptionalTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/aashiq-04/session-management-system/backend/services/audit-service/internal/identity"
+	"github.com/aashiq-04/session-management-system/backend/services/audit-service/internal/models"
+	pb "github.com/aashiq-04/session-management-system/backend/services/audit-service/proto"
+)
+
+// userRule lets the gateway call a method on behalf of the user in its
+// identity token, and operators call it for any user
+var userRule = identity.Rule{Callers: []string{identity.Gateway, identity.Ops}, User: true}
+
+// Policy says who may call each method. The auth and session services write
+// events for any user, and the auth service erases deleted users' data;
+// everything a user reads or changes goes through the gateway with their
+// identity token; methods spanning all users are for operators, or users
+// whose role grants the permission.
+var Policy = identity.Policy{
+	pb.AuditService_CreateAuditLog_FullMethodName:         {Callers: []string{identity.AuthService, identity.SessionService}},
+	pb.AuditService_CreateSecurityAlert_FullMethodName:    {Callers: []string{identity.AuthService, identity.SessionService, identity.Ops}},
+	pb.AuditService_AnonymizeUserAuditLogs_FullMethodName: {Callers: []string{identity.AuthService, identity.Ops}},
+
+	pb.AuditService_GetUserAuditLogs_FullMethodName:              userRule,
+	pb.AuditService_SearchAuditLogs_FullMethodName:               userRule,
+	pb.AuditService_ExportAuditLogs_FullMethodName:               userRule,
+	pb.AuditService_GetSecurityAlerts_FullMethodName:             userRule,
+	pb.AuditService_ResolveSecurityAlert_FullMethodName:          userRule,
+	pb.AuditService_GetComplianceReport_FullMethodName:           userRule,
+	pb.AuditService_GetActivitySummary_FullMethodName:            userRule,
+	pb.AuditService_GetNotificationPreferences_FullMethodName:    userRule,
+	pb.AuditService_UpdateNotificationPreferences_FullMethodName: userRule,
+	pb.AuditService_CreateWebhookSubscription_FullMethodName:     userRule,
+	pb.AuditService_ListWebhookSubscriptions_FullMethodName:      userRule,
+	pb.AuditService_UpdateWebhookSubscription_FullMethodName:     userRule,
+	pb.AuditService_DeleteWebhookSubscription_FullMethodName:     userRule,
+	pb.AuditService_ListWebhookDeliveries_FullMethodName:         userRule,
+	pb.AuditService_ReplayWebhookDeliveries_FullMethodName:       userRule,
+	pb.AuditService_ExportUserData_FullMethodName:                userRule,
+
+	pb.AuditService_ListSecurityAlerts_FullMethodName: {Callers: []string{identity.Gateway, identity.Ops}, Permission: identity.PermissionAlertsRead},
+
+	pb.AuditService_GetAuditLogsByEvent_FullMethodName: {Callers: []string{identity.Ops}},
+	pb.AuditService_VerifyAuditChain_FullMethodName:    {Callers: []string{identity.Ops}},
+	pb.AuditService_GetForwardingStatus_FullMethodName: {Callers: []string{identity.Ops}},
+}.WithReflection(identity.Ops)
+
+// RecordDenial records a refused call as an access_denied audit event. The
+// event belongs to the user the call was made for, if any.
+func (h *AuditHandler) RecordDenial(denial identity.Denial) {
+	metadata, _ := json.Marshal(map[string]string{
+		"method":        denial.Method,
+		"caller":        denial.Caller,
+		"resource_type": denial.ResourceType,
+		"resource_id":   denial.ResourceID,
+	})
+	metadataStr := string(metadata)
+
+	var userID *string
+	if denial.Subject != "" {
+		userID = &denial.Subject
+	}
+
+	err := h.createAuditLog(&models.AuditLog{
+		ID:            uuid.New().String(),
+		UserID:        userID,
+		EventType:     "access_denied",
+		EventCategory: "authorization",
+		Severity:      "warning",
+		Metadata:      &metadataStr,
+		Success:       false,
+		FailureReason: &denial.Reason,
+		CreatedAt:     time.Now(),
+	})
+	if err != nil {
+		log.Printf("Failed to record access denial: %v", err)
+	}
+}
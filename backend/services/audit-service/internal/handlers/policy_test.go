@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"context"
+	"database/sql/driver"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+
+	"github.com/aashiq-04/session-management-system/backend/services/audit-service/internal/forwarding"
+	"github.com/aashiq-04/session-management-system/backend/services/audit-service/internal/identity"
+	"github.com/aashiq-04/session-management-system/backend/services/audit-service/internal/identity/identitytest"
+	"github.com/aashiq-04/session-management-system/backend/services/audit-service/internal/repository"
+	pb "github.com/aashiq-04/session-management-system/backend/services/audit-service/proto"
+)
+
+// access says which of the test callers may call a method. Every call is for
+// user-1 of org-1.
+type access struct {
+	owner       bool // the gateway for user-1, whose roles grant no permissions
+	sameTenant  bool // the gateway for user-2 of org-1, whose roles grant every permission
+	otherTenant bool // the gateway for user-3 of org-2, whose roles grant every permission
+	ops         bool // the ops certificate, on no user's behalf
+	service     bool // the auth service
+}
+
+var (
+	userAccess       = access{owner: true, ops: true}
+	permissionAccess = access{sameTenant: true, otherTenant: true, ops: true}
+	opsAccess        = access{ops: true}
+)
+
+// The interceptor only checks who may call a method. Which users'
+// resources a permission reaches is up to the handler, through
+// authz.RequireOwner for single resources, so permission holders of other
+// organizations get through here.
+var policyTests = map[string]access{
+	pb.AuditService_CreateAuditLog_FullMethodName:         {service: true},
+	pb.AuditService_CreateSecurityAlert_FullMethodName:    {ops: true, service: true},
+	pb.AuditService_AnonymizeUserAuditLogs_FullMethodName: {ops: true, service: true},
+
+	pb.AuditService_GetUserAuditLogs_FullMethodName:              userAccess,
+	pb.AuditService_SearchAuditLogs_FullMethodName:               userAccess,
+	pb.AuditService_ExportAuditLogs_FullMethodName:               userAccess,
+	pb.AuditService_GetSecurityAlerts_FullMethodName:             userAccess,
+	pb.AuditService_ResolveSecurityAlert_FullMethodName:          userAccess,
+	pb.AuditService_GetComplianceReport_FullMethodName:           userAccess,
+	pb.AuditService_GetActivitySummary_FullMethodName:            userAccess,
+	pb.AuditService_GetNotificationPreferences_FullMethodName:    userAccess,
+	pb.AuditService_UpdateNotificationPreferences_FullMethodName: userAccess,
+	pb.AuditService_CreateWebhookSubscription_FullMethodName:     userAccess,
+	pb.AuditService_ListWebhookSubscriptions_FullMethodName:      userAccess,
+	pb.AuditService_UpdateWebhookSubscription_FullMethodName:     userAccess,
+	pb.AuditService_DeleteWebhookSubscription_FullMethodName:     userAccess,
+	pb.AuditService_ListWebhookDeliveries_FullMethodName:         userAccess,
+	pb.AuditService_ReplayWebhookDeliveries_FullMethodName:       userAccess,
+	pb.AuditService_ExportUserData_FullMethodName:                userAccess,
+
+	pb.AuditService_ListSecurityAlerts_FullMethodName: permissionAccess,
+
+	pb.AuditService_GetAuditLogsByEvent_FullMethodName: opsAccess,
+	pb.AuditService_VerifyAuditChain_FullMethodName:    opsAccess,
+	pb.AuditService_GetForwardingStatus_FullMethodName: opsAccess,
+}
+
+var allPermissions = []string{
+	identity.PermissionUsersRead, identity.PermissionUsersDisable, identity.PermissionUsersDelete,
+	identity.PermissionUsersImpersonate, identity.PermissionSessionsRead, identity.PermissionSessionsRevoke,
+	identity.PermissionAlertsRead, identity.PermissionAlertsResolve, identity.PermissionOrgsManage,
+}
+
+func TestPolicy(t *testing.T) {
+	gateway := identitytest.NewGateway(t, identity.AuditService)
+
+	type caller struct {
+		name string
+		ctx  context.Context
+		may  func(access) bool
+	}
+	callers := []caller{
+		{"owner", identitytest.Incoming(identity.Gateway, gateway.Token(t, "user-1", "org-1")),
+			func(a access) bool { return a.owner }},
+		{"same-tenant permission holder", identitytest.Incoming(identity.Gateway, gateway.Token(t, "user-2", "org-1", allPermissions...)),
+			func(a access) bool { return a.sameTenant }},
+		{"other-tenant permission holder", identitytest.Incoming(identity.Gateway, gateway.Token(t, "user-3", "org-2", allPermissions...)),
+			func(a access) bool { return a.otherTenant }},
+		{"ops", identitytest.Incoming(identity.Ops, ""),
+			func(a access) bool { return a.ops }},
+		{"auth service", identitytest.Incoming(identity.AuthService, ""),
+			func(a access) bool { return a.service }},
+	}
+
+	for method := range Policy {
+		if _, ok := policyTests[method]; !ok && !strings.HasPrefix(method, "/grpc.reflection.") {
+			t.Errorf("no policy test for %s", method)
+		}
+	}
+
+	for method, want := range policyTests {
+		for _, c := range callers {
+			t.Run(method+"/"+c.name, func(t *testing.T) {
+				h, mock := newPolicyTestHandler(t)
+				interceptor := identity.NewAuthenticator(Policy, gateway.Verifier(), h.RecordDenial).UnaryInterceptor()
+
+				allowed := c.may(want)
+				if !allowed {
+					expectAccessDenied(mock)
+				}
+
+				called := false
+				_, err := interceptor(c.ctx, requestFor(t, method, "user-1"), &grpc.UnaryServerInfo{FullMethod: method},
+					func(ctx context.Context, req interface{}) (interface{}, error) {
+						called = true
+						return nil, nil
+					})
+
+				if allowed && (err != nil || !called) {
+					t.Errorf("refused: %v", err)
+				}
+				if !allowed {
+					if code := status.Code(err); called || (code != codes.PermissionDenied && code != codes.Unauthenticated) {
+						t.Errorf("allowed: %v", err)
+					}
+				}
+			})
+		}
+	}
+}
+
+// newPolicyTestHandler returns a handler recording denials in a mock
+// database, which fails the test on any statement not expected of it
+func newPolicyTestHandler(t *testing.T) (*AuditHandler, sqlmock.Sqlmock) {
+	t.Helper()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+		db.Close()
+	})
+
+	return &AuditHandler{repo: repository.NewAuditRepository(db), forwarder: &forwarding.Forwarder{}}, mock
+}
+
+// expectAccessDenied expects an access_denied event to be appended to the
+// audit chain
+func expectAccessDenied(mock sqlmock.Sqlmock) {
+	anyArgs := func(n int) []driver.Value {
+		args := make([]driver.Value, n)
+		for i := range args {
+			args[i] = sqlmock.AnyArg()
+		}
+		return args
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT $1::uuid")).
+		WithArgs(anyArgs(7)...).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "session_id", "device_id", "ip_address", "metadata", "created_at"}).
+			AddRow("00000000-0000-0000-0000-000000000001", nil, nil, nil, nil, "{}", time.Now()))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM audit_chain_head FOR UPDATE")).
+		WillReturnRows(sqlmock.NewRows([]string{"sequence", "entry_hash"}).AddRow(0, ""))
+
+	insertArgs := anyArgs(18)
+	insertArgs[4] = "access_denied"
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO audit_logs")).
+		WithArgs(insertArgs...).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE audit_chain_head")).
+		WithArgs(anyArgs(2)...).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+}
+
+// requestFor returns an empty request message of method, for userID if it
+// has a user_id field
+func requestFor(t *testing.T, method, userID string) interface{} {
+	t.Helper()
+
+	name := protoreflect.FullName(strings.ReplaceAll(strings.TrimPrefix(method, "/"), "/", "."))
+	descriptor, err := protoregistry.GlobalFiles.FindDescriptorByName(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	messageType, err := protoregistry.GlobalTypes.FindMessageByName(descriptor.(protoreflect.MethodDescriptor).Input().FullName())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	message := messageType.New()
+	if field := message.Descriptor().Fields().ByName("user_id"); field != nil {
+		message.Set(field, protoreflect.ValueOfString(userID))
+	}
+	return message.Interface()
+}
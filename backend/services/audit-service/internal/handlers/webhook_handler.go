@@ -0,0 +1,307 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/aashiq-04/session-management-system/backend/services/audit-service/internal/grpcerr"
+	"github.com/aashiq-04/session-management-system/backend/services/audit-service/internal/models"
+	"github.com/aashiq-04/session-management-system/backend/services/audit-service/internal/notifications"
+	"github.com/aashiq-04/session-management-system/backend/services/audit-service/internal/repository"
+	"github.com/aashiq-04/session-management-system/backend/services/audit-service/internal/webhooks"
+	pb "github.com/aashiq-04/session-management-system/backend/services/audit-service/proto"
+)
+
+// CreateWebhookSubscription subscribes a URL to audit events
+func (h *AuditHandler) CreateWebhookSubscription(ctx context.Context, req *pb.CreateWebhookSubscriptionRequest) (*pb.CreateWebhookSubscriptionResponse, error) {
+	log.Printf("CreateWebhookSubscription request received for user: %s", req.UserId)
+
+	if err := validateWebhookSubscription(req.Url, req.MinSeverity); err != nil {
+		return nil, err
+	}
+
+	secret, err := notifications.GenerateWebhookSecret()
+	if err != nil {
+		log.Printf("Failed to generate webhook secret: %v", err)
+		return nil, grpcerr.Internal("Failed to create webhook subscription")
+	}
+
+	sub := &models.WebhookSubscription{
+		ID:              uuid.New().String(),
+		UserID:          stringToPointer(req.UserId),
+		URL:             req.Url,
+		Secret:          secret,
+		EventTypes:      req.EventTypes,
+		EventCategories: req.EventCategories,
+		MinSeverity:     stringToPointer(req.MinSeverity),
+		Description:     stringToPointer(req.Description),
+		IsActive:        true,
+	}
+
+	if err := h.webhooks.CreateWebhookSubscription(sub); err != nil {
+		log.Printf("Failed to create webhook subscription: %v", err)
+		return nil, grpcerr.Storage("Failed to create webhook subscription", err)
+	}
+
+	h.recordAuditEvent(req.UserId, "webhook_subscription_created", map[string]interface{}{
+		"subscription_id":  sub.ID,
+		"url":              sub.URL,
+		"event_types":      sub.EventTypes,
+		"event_categories": sub.EventCategories,
+		"min_severity":     req.MinSeverity,
+	})
+
+	return &pb.CreateWebhookSubscriptionResponse{
+		Success:      true,
+		Message:      "Webhook subscription created successfully",
+		Subscription: webhookSubscriptionToProto(sub),
+		Secret:       secret,
+	}, nil
+}
+
+// ListWebhookSubscriptions lists a user's webhook subscriptions
+func (h *AuditHandler) ListWebhookSubscriptions(ctx context.Context, req *pb.ListWebhookSubscriptionsRequest) (*pb.ListWebhookSubscriptionsResponse, error) {
+	log.Printf("ListWebhookSubscriptions request received for user: %s", req.UserId)
+
+	subs, err := h.webhooks.ListWebhookSubscriptions(stringToPointer(req.UserId))
+	if err != nil {
+		log.Printf("Failed to list webhook subscriptions: %v", err)
+		return nil, grpcerr.Storage("Failed to retrieve webhook subscriptions", err)
+	}
+
+	pbSubs := make([]*pb.WebhookSubscription, 0, len(subs))
+	for i := range subs {
+		pbSubs = append(pbSubs, webhookSubscriptionToProto(&subs[i]))
+	}
+
+	return &pb.ListWebhookSubscriptionsResponse{
+		Success:       true,
+		Message:       "Webhook subscriptions retrieved successfully",
+		Subscriptions: pbSubs,
+	}, nil
+}
+
+// UpdateWebhookSubscription changes a webhook subscription's URL, filters or state
+func (h *AuditHandler) UpdateWebhookSubscription(ctx context.Context, req *pb.UpdateWebhookSubscriptionRequest) (*pb.UpdateWebhookSubscriptionResponse, error) {
+	log.Printf("UpdateWebhookSubscription request received: %s", req.SubscriptionId)
+
+	sub, err := h.getOwnedWebhookSubscription(ctx, req.SubscriptionId)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateWebhookSubscription(req.Url, req.MinSeverity); err != nil {
+		return nil, err
+	}
+
+	secret := ""
+	if req.RotateSecret {
+		var err error
+		secret, err = notifications.GenerateWebhookSecret()
+		if err != nil {
+			log.Printf("Failed to generate webhook secret: %v", err)
+			return nil, grpcerr.Internal("Failed to update webhook subscription")
+		}
+		sub.Secret = secret
+	}
+
+	sub.URL = req.Url
+	sub.EventTypes = req.EventTypes
+	sub.EventCategories = req.EventCategories
+	sub.MinSeverity = stringToPointer(req.MinSeverity)
+	sub.Description = stringToPointer(req.Description)
+	sub.IsActive = req.IsActive
+
+	if err := h.webhooks.UpdateWebhookSubscription(sub); err != nil {
+		log.Printf("Failed to update webhook subscription: %v", err)
+		return nil, grpcerr.Storage("Failed to update webhook subscription", err)
+	}
+
+	h.recordAuditEvent(req.UserId, "webhook_subscription_updated", map[string]interface{}{
+		"subscription_id":  sub.ID,
+		"url":              sub.URL,
+		"event_types":      sub.EventTypes,
+		"event_categories": sub.EventCategories,
+		"min_severity":     req.MinSeverity,
+		"is_active":        sub.IsActive,
+		"secret_rotated":   req.RotateSecret,
+	})
+
+	return &pb.UpdateWebhookSubscriptionResponse{
+		Success:      true,
+		Message:      "Webhook subscription updated successfully",
+		Subscription: webhookSubscriptionToProto(sub),
+		Secret:       secret,
+	}, nil
+}
+
+// DeleteWebhookSubscription removes a webhook subscription along with its delivery history
+func (h *AuditHandler) DeleteWebhookSubscription(ctx context.Context, req *pb.DeleteWebhookSubscriptionRequest) (*pb.DeleteWebhookSubscriptionResponse, error) {
+	log.Printf("DeleteWebhookSubscription request received: %s", req.SubscriptionId)
+
+	sub, err := h.getOwnedWebhookSubscription(ctx, req.SubscriptionId)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := h.webhooks.DeleteWebhookSubscription(sub.ID); err != nil {
+		log.Printf("Failed to delete webhook subscription: %v", err)
+		return nil, grpcerr.Storage("Failed to delete webhook subscription", err)
+	}
+
+	h.recordAuditEvent(req.UserId, "webhook_subscription_deleted", map[string]interface{}{
+		"subscription_id": sub.ID,
+		"url":             sub.URL,
+	})
+
+	return &pb.DeleteWebhookSubscriptionResponse{
+		Success: true,
+		Message: "Webhook subscription deleted successfully",
+	}, nil
+}
+
+// ListWebhookDeliveries lists the delivery log of a webhook subscription
+func (h *AuditHandler) ListWebhookDeliveries(ctx context.Context, req *pb.ListWebhookDeliveriesRequest) (*pb.ListWebhookDeliveriesResponse, error) {
+	log.Printf("ListWebhookDeliveries request received: %s", req.SubscriptionId)
+
+	if _, err := h.getOwnedWebhookSubscription(ctx, req.SubscriptionId); err != nil {
+		return nil, err
+	}
+
+	limit := int(req.Limit)
+	if limit == 0 {
+		limit = 50
+	}
+
+	deliveries, totalCount, err := h.webhooks.ListWebhookDeliveries(req.SubscriptionId, req.Status, limit, int(req.Offset))
+	if err != nil {
+		log.Printf("Failed to list webhook deliveries: %v", err)
+		return nil, grpcerr.Storage("Failed to retrieve webhook deliveries", err)
+	}
+
+	pbDeliveries := make([]*pb.WebhookDelivery, 0, len(deliveries))
+	for _, d := range deliveries {
+		pbDelivery := &pb.WebhookDelivery{
+			Id:             d.ID,
+			SubscriptionId: d.SubscriptionID,
+			AuditLogId:     d.AuditLogID,
+			EventType:      d.EventType,
+			Status:         d.Status,
+			Attempts:       int32(d.Attempts),
+			LastError:      pointerToString(d.LastError),
+			CreatedAt:      d.CreatedAt.Format(time.RFC3339),
+		}
+		if d.ResponseStatus != nil {
+			pbDelivery.ResponseStatus = int32(*d.ResponseStatus)
+		}
+		if d.Status == "pending" {
+			pbDelivery.NextAttemptAt = d.NextAttemptAt.Format(time.RFC3339)
+		}
+		if d.DeliveredAt != nil {
+			pbDelivery.DeliveredAt = d.DeliveredAt.Format(time.RFC3339)
+		}
+		pbDeliveries = append(pbDeliveries, pbDelivery)
+	}
+
+	return &pb.ListWebhookDeliveriesResponse{
+		Success:    true,
+		Message:    "Webhook deliveries retrieved successfully",
+		Deliveries: pbDeliveries,
+		TotalCount: int32(totalCount),
+	}, nil
+}
+
+// ReplayWebhookDeliveries queues deliveries to be sent again
+func (h *AuditHandler) ReplayWebhookDeliveries(ctx context.Context, req *pb.ReplayWebhookDeliveriesRequest) (*pb.ReplayWebhookDeliveriesResponse, error) {
+	log.Printf("ReplayWebhookDeliveries request received: %s", req.SubscriptionId)
+
+	if _, err := h.getOwnedWebhookSubscription(ctx, req.SubscriptionId); err != nil {
+		return nil, err
+	}
+
+	for _, id := range req.DeliveryIds {
+		if _, err := uuid.Parse(id); err != nil {
+			return nil, grpcerr.InvalidArgument("Invalid delivery ID: "+id,
+				grpcerr.Field("delivery_ids", "must be UUIDs"))
+		}
+	}
+
+	count, err := h.webhooks.ReplayWebhookDeliveries(req.SubscriptionId, req.DeliveryIds)
+	if err != nil {
+		log.Printf("Failed to replay webhook deliveries: %v", err)
+		return nil, grpcerr.Storage("Failed to replay webhook deliveries", err)
+	}
+
+	h.recordAuditEvent(req.UserId, "webhook_deliveries_replayed", map[string]interface{}{
+		"subscription_id": req.SubscriptionId,
+		"delivery_ids":    req.DeliveryIds,
+		"replayed_count":  count,
+	})
+
+	return &pb.ReplayWebhookDeliveriesResponse{
+		Success:       true,
+		Message:       "Webhook deliveries queued for replay",
+		ReplayedCount: int32(count),
+	}, nil
+}
+
+// getOwnedWebhookSubscription loads a subscription if the caller may act on
+// it. Subscriptions of other users are reported as not found, so their IDs
+// can't be probed, but the refusal is still audited.
+func (h *AuditHandler) getOwnedWebhookSubscription(ctx context.Context, subscriptionID string) (*models.WebhookSubscription, error) {
+	notFound := grpcerr.NotFound("Webhook subscription not found", "webhook_subscription", subscriptionID)
+	if _, err := uuid.Parse(subscriptionID); err != nil {
+		return nil, notFound
+	}
+
+	sub, err := h.webhooks.GetWebhookSubscription(subscriptionID)
+	if errors.Is(err, repository.ErrWebhookSubscriptionNotFound) {
+		return nil, notFound
+	}
+	if err != nil {
+		log.Printf("Failed to get webhook subscription: %v", err)
+		return nil, grpcerr.Storage("Failed to get webhook subscription", err)
+	}
+
+	// System-wide subscriptions have no owner, so only admins match them
+	if err := h.authz.RequireOwner(ctx, "webhook_subscription", subscriptionID, pointerToString(sub.UserID), "", ""); err != nil {
+		return nil, notFound
+	}
+
+	return sub, nil
+}
+
+// validateWebhookSubscription returns an InvalidArgument error describing
+// what's wrong with the subscription settings, or nil if they're fine
+func validateWebhookSubscription(rawURL, minSeverity string) error {
+	if err := notifications.ValidateWebhookURL(rawURL); err != nil {
+		return grpcerr.InvalidArgument("Webhook URL must be an absolute https URL on a public host",
+			grpcerr.Field("url", err.Error()))
+	}
+
+	if minSeverity != "" && !webhooks.ValidSeverity(minSeverity) {
+		return grpcerr.InvalidArgument("Minimum severity must be one of info, warning or critical",
+			grpcerr.Field("min_severity", "must be one of info, warning or critical"))
+	}
+
+	return nil
+}
+
+func webhookSubscriptionToProto(sub *models.WebhookSubscription) *pb.WebhookSubscription {
+	return &pb.WebhookSubscription{
+		Id:              sub.ID,
+		UserId:          pointerToString(sub.UserID),
+		Url:             sub.URL,
+		EventTypes:      sub.EventTypes,
+		EventCategories: sub.EventCategories,
+		MinSeverity:     pointerToString(sub.MinSeverity),
+		Description:     pointerToString(sub.Description),
+		IsActive:        sub.IsActive,
+		CreatedAt:       sub.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:       sub.UpdatedAt.Format(time.RFC3339),
+	}
+}
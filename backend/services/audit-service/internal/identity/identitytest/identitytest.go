@@ -0,0 +1,105 @@
+// Package identitytest makes the credentials callers present to the
+// identity interceptor in tests: the client certificate of the calling
+// service and the identity token the gateway signs for the end user
+package identitytest
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+
+	"github.com/aashiq-04/session-management-system/backend/services/audit-service/internal/identity"
+)
+
+// Gateway signs identity tokens for one service the way the gateway does
+type Gateway struct {
+	key      ed25519.PrivateKey
+	audience string
+	verifier *identity.Verifier
+}
+
+// NewGateway creates a gateway signing tokens for audience, the name of the
+// service under test
+func NewGateway(t *testing.T, audience string) *Gateway {
+	t.Helper()
+
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Gateway{key: private, audience: audience, verifier: identity.NewVerifier(public, audience)}
+}
+
+// Verifier returns a verifier accepting the gateway's tokens
+func (g *Gateway) Verifier() *identity.Verifier {
+	return g.verifier
+}
+
+// Token returns an identity token for subject, a member of organization whose
+// roles grant permissions
+func (g *Gateway) Token(t *testing.T, subject, organization string, permissions ...string) string {
+	t.Helper()
+
+	now := time.Now()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodEdDSA, &identity.Claims{
+		Permissions:  permissions,
+		Organization: organization,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    identity.Gateway,
+			Subject:   subject,
+			Audience:  jwt.ClaimStrings{g.audience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+		},
+	}).SignedString(g.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// Authenticate returns the context a handler sees for a call from caller, on
+// behalf of the subject of token unless token is empty
+func (g *Gateway) Authenticate(t *testing.T, caller, token string) context.Context {
+	t.Helper()
+
+	const method = "/identitytest.Service/Call"
+	policy := identity.Policy{method: {Callers: []string{caller}, User: token != ""}}
+	interceptor := identity.NewAuthenticator(policy, g.verifier, nil).UnaryInterceptor()
+
+	var ctx context.Context
+	_, err := interceptor(Incoming(caller, token), nil, &grpc.UnaryServerInfo{FullMethod: method},
+		func(handlerCtx context.Context, req interface{}) (interface{}, error) {
+			ctx = handlerCtx
+			return nil, nil
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ctx
+}
+
+// Incoming returns the context of a call made with caller's client
+// certificate, sending token in the metadata unless it is empty
+func Incoming(caller, token string) context.Context {
+	ctx := peer.NewContext(context.Background(), &peer.Peer{
+		AuthInfo: credentials.TLSInfo{State: tls.ConnectionState{
+			VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: caller}}}},
+		}},
+	})
+	if token == "" {
+		return ctx
+	}
+	return metadata.NewIncomingContext(ctx, metadata.Pairs(identity.TokenHeader, token))
+}
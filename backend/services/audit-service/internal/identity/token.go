@@ -0,0 +1,89 @@
+package identity
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// tokenLeeway tolerates clock skew between the gateway and the services
+const tokenLeeway = 5 * time.Second
+
+// Claims are the claims of an identity token
+type Claims struct {
+	// Permissions are the end user's permissions, granted by their roles
+	Permissions []string `json:"permissions,omitempty"`
+	// Organization is the end user's organization, which scopes what
+	// their permissions reach
+	Organization string `json:"org"`
+	jwt.RegisteredClaims
+}
+
+// Verifier checks identity tokens signed by the gateway for this service
+type Verifier struct {
+	key      ed25519.PublicKey
+	audience string
+}
+
+// NewVerifier creates a verifier accepting tokens signed with key and
+// addressed to audience, the name of this service
+func NewVerifier(key ed25519.PublicKey, audience string) *Verifier {
+	return &Verifier{key: key, audience: audience}
+}
+
+// Verify returns the claims of a valid token
+func (v *Verifier) Verify(token string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(*jwt.Token) (interface{}, error) {
+		return v.key, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodEdDSA.Alg()}),
+		jwt.WithIssuer(Gateway),
+		jwt.WithAudience(v.audience),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(tokenLeeway),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.Subject == "" {
+		return nil, errors.New("token has no subject")
+	}
+	if claims.Organization == "" {
+		return nil, errors.New("token has no organization")
+	}
+
+	return claims, nil
+}
+
+// LoadPublicKey reads the gateway's Ed25519 public key from a PEM file
+func LoadPublicKey(file string) (ed25519.PublicKey, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read public key: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in %s", file)
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key: %w", err)
+	}
+
+	edKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an Ed25519 public key", file)
+	}
+
+	return edKey, nil
+}
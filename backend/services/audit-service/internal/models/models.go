@@ -21,6 +21,52 @@ type AuditLog struct {
 	Success         bool       `db:"success"`
 	FailureReason   *string    `db:"failure_reason"`
 	CreatedAt       time.Time  `db:"created_at"`
+
+	// Hash chain fields, set by CreateAuditLog and read back by chain queries
+	Sequence  int64  `db:"sequence"`
+	PrevHash  string `db:"prev_hash"`
+	EntryHash string `db:"entry_hash"`
+}
+
+// AuditLogFilter narrows an audit log listing; zero values don't filter
+type AuditLogFilter struct {
+	UserID        string
+	EventTypes    []string
+	EventCategory string
+	Severity      string
+	StartTime     *time.Time
+	EndTime       *time.Time
+	IPNetwork     string // Address or CIDR range
+	SessionID     string
+	DeviceID      string
+	Success       *bool
+}
+
+// AuditLogCursor is the keyset position of an entry in a listing ordered by (created_at, id) descending
+type AuditLogCursor struct {
+	CreatedAt time.Time
+	ID        string
+}
+
+// AuditChainCheckpoint is a signed snapshot of the audit log hash chain head
+type AuditChainCheckpoint struct {
+	ID        string    `db:"id"`
+	Sequence  int64     `db:"sequence"`
+	EntryHash string    `db:"entry_hash"`
+	KeyID     string    `db:"key_id"`
+	Signature string    `db:"signature"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+// AuditLogTombstone is a signed record of a run of consecutive chain entries
+// dropped by retention, ending at Sequence
+type AuditLogTombstone struct {
+	FirstSequence int64  `db:"first_sequence"`
+	Sequence      int64  `db:"sequence"`
+	EntryHash     string `db:"entry_hash"` // hash of the entry at Sequence
+	PartitionName string `db:"partition_name"`
+	KeyID         string `db:"key_id"`
+	Signature     string `db:"signature"`
 }
 
 // SecurityAlert represents a detected security anomaly
@@ -37,6 +83,7 @@ type SecurityAlert struct {
 	IsResolved      bool       `db:"is_resolved"`
 	ResolvedAt      *time.Time `db:"resolved_at"`
 	CreatedAt       time.Time  `db:"created_at"`
+	OrganizationID  string     `db:"organization_id"`
 }
 
 // EventCount represents count of events by type
@@ -71,4 +118,68 @@ type ActivitySummary struct {
 	UniqueDevices       int
 	UniqueLocations     int
 	DailyActivity       []DailyActivity
-}
\ No newline at end of file
+}
+
+// NotificationPreferences represents a user's security alert notification settings
+type NotificationPreferences struct {
+	UserID         string    `db:"user_id"`
+	EmailEnabled   bool      `db:"email_enabled"`
+	WebhookEnabled bool      `db:"webhook_enabled"`
+	WebhookURL     *string   `db:"webhook_url"`
+	WebhookSecret  *string   `db:"webhook_secret"`
+	MinSeverity    *string   `db:"min_severity"`
+	CreatedAt      time.Time `db:"created_at"`
+	UpdatedAt      time.Time `db:"updated_at"`
+}
+
+// AlertRecipient is a newly raised security alert together with who should hear about it
+type AlertRecipient struct {
+	Alert       SecurityAlert
+	Email       string
+	Preferences NotificationPreferences
+}
+
+// NotificationDelivery represents one attempt-tracked notification of an alert over a channel
+type NotificationDelivery struct {
+	ID            string     `db:"id"`
+	AlertID       string     `db:"alert_id"`
+	UserID        string     `db:"user_id"`
+	Channel       string     `db:"channel"` // email, webhook, log
+	Recipient     *string    `db:"recipient"`
+	Status        string     `db:"status"` // pending, sent, failed
+	Attempts      int        `db:"attempts"`
+	LastError     *string    `db:"last_error"`
+	NextAttemptAt time.Time  `db:"next_attempt_at"`
+	SentAt        *time.Time `db:"sent_at"`
+	CreatedAt     time.Time  `db:"created_at"`
+}
+
+// WebhookSubscription represents an outbound webhook for audit events
+type WebhookSubscription struct {
+	ID              string    `db:"id"`
+	UserID          *string   `db:"user_id"` // nil for system-wide subscriptions
+	URL             string    `db:"url"`
+	Secret          string    `db:"secret"`
+	EventTypes      []string  `db:"event_types"`
+	EventCategories []string  `db:"event_categories"`
+	MinSeverity     *string   `db:"min_severity"`
+	Description     *string   `db:"description"`
+	IsActive        bool      `db:"is_active"`
+	CreatedAt       time.Time `db:"created_at"`
+	UpdatedAt       time.Time `db:"updated_at"`
+}
+
+// WebhookDelivery represents one audit event queued for one webhook subscription
+type WebhookDelivery struct {
+	ID             string     `db:"id"`
+	SubscriptionID string     `db:"subscription_id"`
+	AuditLogID     string     `db:"audit_log_id"`
+	EventType      string     `db:"event_type"`
+	Status         string     `db:"status"` // pending, delivered, dead
+	Attempts       int        `db:"attempts"`
+	LastError      *string    `db:"last_error"`
+	ResponseStatus *int       `db:"response_status"`
+	NextAttemptAt  time.Time  `db:"next_attempt_at"`
+	DeliveredAt    *time.Time `db:"delivered_at"`
+	CreatedAt      time.Time  `db:"created_at"`
+}
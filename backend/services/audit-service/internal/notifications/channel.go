@@ -0,0 +1,63 @@
+// Package notifications delivers security alert notifications over pluggable channels
+package notifications
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/aashiq-04/session-management-system/backend/services/audit-service/internal/models"
+)
+
+// Channel names, as stored in notification_deliveries.channel
+const (
+	ChannelEmail   = "email"
+	ChannelWebhook = "webhook"
+	ChannelLog     = "log"
+)
+
+// Notification is a single alert addressed to one recipient over one channel
+type Notification struct {
+	DeliveryID string
+	Alert      *models.SecurityAlert
+	Recipient  string // Email address or webhook URL, empty for the log sink
+	Secret     string // Webhook signing secret
+}
+
+// Channel sends notifications over one transport
+type Channel interface {
+	Name() string
+	Send(ctx context.Context, n *Notification) error
+}
+
+var severityRank = map[string]int{
+	"low":      1,
+	"medium":   2,
+	"high":     3,
+	"critical": 4,
+}
+
+// ValidSeverity reports whether s is a known alert severity
+func ValidSeverity(s string) bool {
+	_, ok := severityRank[s]
+	return ok
+}
+
+// MeetsSeverity reports whether severity is at or above threshold
+func MeetsSeverity(severity, threshold string) bool {
+	rank, ok := severityRank[severity]
+	if !ok {
+		return false
+	}
+	return rank >= severityRank[threshold]
+}
+
+// GenerateWebhookSecret creates a random secret for signing webhook payloads
+func GenerateWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
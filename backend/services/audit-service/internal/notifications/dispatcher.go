@@ -0,0 +1,210 @@
+package notifications
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aashiq-04/session-management-system/backend/services/audit-service/internal/models"
+	"github.com/aashiq-04/session-management-system/backend/services/audit-service/internal/repository"
+)
+
+const (
+	// alertLookback bounds how far back unnotified alerts are picked up, so
+	// enabling notifications doesn't flood users with historical alerts
+	alertLookback = 24 * time.Hour
+
+	// deliveryLease is how long a claimed delivery is hidden from other instances
+	deliveryLease = 2 * time.Minute
+
+	// maxRetryBackoff caps the exponential backoff between attempts
+	maxRetryBackoff = time.Hour
+)
+
+// errDropped marks deliveries that can no longer be sent and shouldn't be retried
+var errDropped = errors.New("notification dropped")
+
+// Config holds the dispatcher settings
+type Config struct {
+	MinSeverity  string        // Default threshold when a user hasn't chosen one
+	PollInterval time.Duration // How often to look for new alerts and due deliveries
+	BatchSize    int           // Maximum alerts and deliveries handled per poll
+	MaxAttempts  int           // Attempts before a delivery is marked failed
+	RetryBackoff time.Duration // Delay before the first retry, doubled after each failure
+	SendTimeout  time.Duration // Timeout for a single delivery attempt
+}
+
+// Dispatcher turns new security alerts into notification deliveries and sends them
+type Dispatcher struct {
+	alerts   *repository.AuditRepository
+	repo     *repository.NotificationRepository
+	channels map[string]Channel
+	config   Config
+}
+
+// NewDispatcher creates a new notification dispatcher sending over the given channels
+func NewDispatcher(db *sql.DB, config Config, channels ...Channel) *Dispatcher {
+	d := &Dispatcher{
+		alerts:   repository.NewAuditRepository(db),
+		repo:     repository.NewNotificationRepository(db),
+		channels: make(map[string]Channel),
+		config:   config,
+	}
+
+	for _, c := range channels {
+		d.channels[c.Name()] = c
+	}
+
+	return d
+}
+
+// Run polls for alerts and due deliveries until ctx is cancelled
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		d.poll(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll queues deliveries for new alerts and sends whatever is due
+func (d *Dispatcher) poll(ctx context.Context) {
+	queued, err := d.repo.QueueAlertNotifications(time.Now().Add(-alertLookback), d.config.BatchSize, d.plan)
+	if err != nil {
+		log.Printf("Failed to queue alert notifications: %v", err)
+	} else if queued > 0 {
+		log.Printf("Queued notifications for %d security alerts", queued)
+	}
+
+	deliveries, err := d.repo.ClaimDueDeliveries(d.config.BatchSize, deliveryLease)
+	if err != nil {
+		log.Printf("Failed to claim notification deliveries: %v", err)
+		return
+	}
+
+	for i := range deliveries {
+		if ctx.Err() != nil {
+			return
+		}
+		d.deliver(ctx, &deliveries[i])
+	}
+}
+
+// plan decides which channels an alert should go out on
+func (d *Dispatcher) plan(rcpt *models.AlertRecipient) []models.NotificationDelivery {
+	var deliveries []models.NotificationDelivery
+
+	// The log sink is for operators, so it ignores user preferences
+	if _, ok := d.channels[ChannelLog]; ok && MeetsSeverity(rcpt.Alert.Severity, d.config.MinSeverity) {
+		deliveries = append(deliveries, models.NotificationDelivery{Channel: ChannelLog})
+	}
+
+	threshold := d.config.MinSeverity
+	if rcpt.Preferences.MinSeverity != nil {
+		threshold = *rcpt.Preferences.MinSeverity
+	}
+	if !MeetsSeverity(rcpt.Alert.Severity, threshold) {
+		return deliveries
+	}
+
+	if _, ok := d.channels[ChannelEmail]; ok && rcpt.Preferences.EmailEnabled && rcpt.Email != "" {
+		email := rcpt.Email
+		deliveries = append(deliveries, models.NotificationDelivery{Channel: ChannelEmail, Recipient: &email})
+	}
+
+	if _, ok := d.channels[ChannelWebhook]; ok && rcpt.Preferences.WebhookEnabled && rcpt.Preferences.WebhookURL != nil {
+		deliveries = append(deliveries, models.NotificationDelivery{Channel: ChannelWebhook, Recipient: rcpt.Preferences.WebhookURL})
+	}
+
+	return deliveries
+}
+
+// deliver makes one attempt at a delivery and records the outcome
+func (d *Dispatcher) deliver(ctx context.Context, delivery *models.NotificationDelivery) {
+	sendCtx, cancel := context.WithTimeout(ctx, d.config.SendTimeout)
+	defer cancel()
+
+	err := d.send(sendCtx, delivery)
+	if err == nil {
+		if err := d.repo.MarkDeliverySent(delivery.ID); err != nil {
+			log.Printf("Failed to record notification delivery %s: %v", delivery.ID, err)
+		}
+		return
+	}
+
+	attempts := delivery.Attempts + 1
+	var nextAttemptAt *time.Time
+	if !errors.Is(err, errDropped) && attempts < d.config.MaxAttempts {
+		next := time.Now().Add(d.backoff(attempts))
+		nextAttemptAt = &next
+	}
+
+	if nextAttemptAt != nil {
+		log.Printf("Notification delivery %s via %s failed (attempt %d/%d): %v", delivery.ID, delivery.Channel, attempts, d.config.MaxAttempts, err)
+	} else {
+		log.Printf("Notification delivery %s via %s failed permanently: %v", delivery.ID, delivery.Channel, err)
+	}
+
+	if err := d.repo.MarkDeliveryFailed(delivery.ID, err.Error(), nextAttemptAt); err != nil {
+		log.Printf("Failed to record notification delivery %s: %v", delivery.ID, err)
+	}
+}
+
+// send builds the notification for a delivery and hands it to its channel
+func (d *Dispatcher) send(ctx context.Context, delivery *models.NotificationDelivery) error {
+	channel, ok := d.channels[delivery.Channel]
+	if !ok {
+		return fmt.Errorf("%w: channel %s is not configured", errDropped, delivery.Channel)
+	}
+
+	alert, err := d.alerts.GetSecurityAlertByID(delivery.AlertID)
+	if err != nil {
+		return err
+	}
+
+	n := &Notification{
+		DeliveryID: delivery.ID,
+		Alert:      alert,
+	}
+	if delivery.Recipient != nil {
+		n.Recipient = *delivery.Recipient
+	}
+
+	if delivery.Channel == ChannelWebhook {
+		// Sign with the current secret, and stop if the user has since turned the webhook off or moved it
+		prefs, err := d.repo.GetNotificationPreferences(delivery.UserID)
+		if err != nil {
+			return err
+		}
+		if prefs == nil || !prefs.WebhookEnabled || prefs.WebhookURL == nil || *prefs.WebhookURL != n.Recipient {
+			return fmt.Errorf("%w: webhook is no longer enabled for this URL", errDropped)
+		}
+		if prefs.WebhookSecret != nil {
+			n.Secret = *prefs.WebhookSecret
+		}
+	}
+
+	return channel.Send(ctx, n)
+}
+
+// backoff returns the delay before the next attempt after the given number of failures
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.config.RetryBackoff
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= maxRetryBackoff {
+			return maxRetryBackoff
+		}
+	}
+	return delay
+}
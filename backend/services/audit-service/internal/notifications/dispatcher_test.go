@@ -0,0 +1,260 @@
+package notifications
+
+import (
+	"context"
+	"database/sql/driver"
+	"io"
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"github.com/aashiq-04/session-management-system/backend/services/audit-service/internal/models"
+)
+
+// retryArg matches the next_attempt_at argument of MarkDeliveryFailed:
+// a time when the delivery will be retried, NULL when it was given up on
+type retryArg bool
+
+func (retry retryArg) Match(v driver.Value) bool {
+	_, isTime := v.(time.Time)
+	return isTime == bool(retry)
+}
+
+func newTestDispatcher(t *testing.T, channels ...Channel) (*Dispatcher, sqlmock.Sqlmock) {
+	t.Helper()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+		db.Close()
+	})
+
+	return NewDispatcher(db, Config{
+		MinSeverity:  "medium",
+		MaxAttempts:  3,
+		RetryBackoff: time.Minute,
+		SendTimeout:  5 * time.Second,
+	}, channels...), mock
+}
+
+func expectAlert(mock sqlmock.Sqlmock) {
+	alert := testAlert()
+	mock.ExpectQuery(regexp.QuoteMeta("FROM security_alerts")).
+		WithArgs(alert.ID).
+		WillReturnRows(sqlmock.NewRows([]string{
+			"id", "user_id", "alert_type", "severity", "description", "metadata",
+			"ip_address", "location_country", "location_city",
+			"is_resolved", "resolved_at", "created_at", "organization_id",
+		}).AddRow(
+			alert.ID, alert.UserID, alert.AlertType, alert.Severity, alert.Description, nil,
+			*alert.IPAddress, *alert.LocationCountry, nil,
+			false, nil, alert.CreatedAt, "org-1",
+		))
+}
+
+func expectPreferences(mock sqlmock.Sqlmock, webhookEnabled bool, webhookURL string) {
+	now := time.Now()
+	mock.ExpectQuery(regexp.QuoteMeta("FROM notification_preferences")).
+		WithArgs("user-1").
+		WillReturnRows(sqlmock.NewRows([]string{
+			"user_id", "email_enabled", "webhook_enabled", "webhook_url", "webhook_secret",
+			"min_severity", "created_at", "updated_at",
+		}).AddRow("user-1", true, webhookEnabled, webhookURL, "secret", nil, now, now))
+}
+
+func expectSent(mock sqlmock.Sqlmock, deliveryID string) {
+	mock.ExpectExec(regexp.QuoteMeta("SET status = 'sent'")).
+		WithArgs(sqlmock.AnyArg(), deliveryID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+func expectFailed(mock sqlmock.Sqlmock, deliveryID string, retry bool) {
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE notification_deliveries")).
+		WithArgs(sqlmock.AnyArg(), retryArg(retry), deliveryID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+func delivery(channel, recipient string, attempts int) *models.NotificationDelivery {
+	return &models.NotificationDelivery{
+		ID:        "delivery-1",
+		AlertID:   "alert-1",
+		UserID:    "user-1",
+		Channel:   channel,
+		Recipient: &recipient,
+		Status:    "pending",
+		Attempts:  attempts,
+	}
+}
+
+func TestDispatcherDeliversWebhook(t *testing.T) {
+	received := 0
+	webhook := newReceiver(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if want := "sha256=" + SignWebhookPayload("secret", r.Header.Get(WebhookTimestampHeader), body); r.Header.Get(WebhookSignatureHeader) != want {
+			t.Error("webhook not signed with the user's current secret")
+		}
+		received++
+	})
+	d, mock := newTestDispatcher(t, webhook)
+
+	expectAlert(mock)
+	expectPreferences(mock, true, receiverURL)
+	expectSent(mock, "delivery-1")
+
+	d.deliver(context.Background(), delivery(ChannelWebhook, receiverURL, 0))
+
+	if received != 1 {
+		t.Errorf("receiver got %d requests, want 1", received)
+	}
+}
+
+func TestDispatcherDeliversEmail(t *testing.T) {
+	stub := startSMTPStub(t, false)
+	d, mock := newTestDispatcher(t, NewEmailChannel(SMTPConfig{Host: stub.host, Port: stub.port, From: "security@example.com"}))
+
+	expectAlert(mock)
+	expectSent(mock, "delivery-1")
+
+	d.deliver(context.Background(), delivery(ChannelEmail, "user@example.com", 0))
+
+	stub.mu.Lock()
+	defer stub.mu.Unlock()
+	if len(stub.rcpts) != 1 || stub.data == "" {
+		t.Errorf("SMTP stub got recipients %q and %d bytes", stub.rcpts, len(stub.data))
+	}
+}
+
+func TestDispatcherDeliveryFailures(t *testing.T) {
+	tests := []struct {
+		name     string
+		attempts int
+		status   int
+		prefs    func(sqlmock.Sqlmock)
+		url      string
+		retry    bool
+		requests int
+	}{
+		{
+			name:     "receiver error is retried",
+			status:   http.StatusServiceUnavailable,
+			prefs:    func(mock sqlmock.Sqlmock) { expectPreferences(mock, true, receiverURL) },
+			url:      receiverURL,
+			retry:    true,
+			requests: 1,
+		},
+		{
+			name:     "last attempt fails for good",
+			attempts: 2,
+			status:   http.StatusServiceUnavailable,
+			prefs:    func(mock sqlmock.Sqlmock) { expectPreferences(mock, true, receiverURL) },
+			url:      receiverURL,
+			requests: 1,
+		},
+		{
+			name:  "webhook since disabled",
+			prefs: func(mock sqlmock.Sqlmock) { expectPreferences(mock, false, receiverURL) },
+			url:   receiverURL,
+		},
+		{
+			name:  "webhook since moved",
+			prefs: func(mock sqlmock.Sqlmock) { expectPreferences(mock, true, "https://example.org/hooks") },
+			url:   receiverURL,
+		},
+		{
+			name:  "plain http URL saved before https was required",
+			prefs: func(mock sqlmock.Sqlmock) { expectPreferences(mock, true, "http://example.com/hooks/alerts") },
+			url:   "http://example.com/hooks/alerts",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := 0
+			webhook := newReceiver(t, func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				w.WriteHeader(tt.status)
+			})
+			d, mock := newTestDispatcher(t, webhook)
+
+			expectAlert(mock)
+			tt.prefs(mock)
+			expectFailed(mock, "delivery-1", tt.retry)
+
+			d.deliver(context.Background(), delivery(ChannelWebhook, tt.url, tt.attempts))
+
+			if requests != tt.requests {
+				t.Errorf("receiver got %d requests, want %d", requests, tt.requests)
+			}
+		})
+	}
+}
+
+func TestDispatcherDropsUnconfiguredChannel(t *testing.T) {
+	d, mock := newTestDispatcher(t)
+	expectFailed(mock, "delivery-1", false)
+
+	d.deliver(context.Background(), delivery(ChannelEmail, "user@example.com", 0))
+}
+
+func TestDispatcherPlan(t *testing.T) {
+	stub := startSMTPStub(t, false)
+	d, _ := newTestDispatcher(t,
+		NewEmailChannel(SMTPConfig{Host: stub.host, Port: stub.port}),
+		NewWebhookChannel(time.Second),
+	)
+
+	webhookURL := receiverURL
+	critical := "critical"
+	tests := []struct {
+		name     string
+		severity string
+		prefs    models.NotificationPreferences
+		want     []string
+	}{
+		{"email only", "high", models.NotificationPreferences{EmailEnabled: true}, []string{ChannelEmail}},
+		{"email and webhook", "high", models.NotificationPreferences{EmailEnabled: true, WebhookEnabled: true, WebhookURL: &webhookURL}, []string{ChannelEmail, ChannelWebhook}},
+		{"below default threshold", "low", models.NotificationPreferences{EmailEnabled: true}, nil},
+		{"below user threshold", "high", models.NotificationPreferences{EmailEnabled: true, MinSeverity: &critical}, nil},
+		{"webhook without URL", "high", models.NotificationPreferences{WebhookEnabled: true}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			alert := testAlert()
+			alert.Severity = tt.severity
+
+			deliveries := d.plan(&models.AlertRecipient{Alert: *alert, Email: "user@example.com", Preferences: tt.prefs})
+
+			var got []string
+			for _, delivery := range deliveries {
+				got = append(got, delivery.Channel)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("plan = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("plan = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestDispatcherBackoff(t *testing.T) {
+	d := &Dispatcher{config: Config{RetryBackoff: time.Minute}}
+
+	for attempts, want := range map[int]time.Duration{1: time.Minute, 2: 2 * time.Minute, 3: 4 * time.Minute, 10: maxRetryBackoff} {
+		if got := d.backoff(attempts); got != want {
+			t.Errorf("backoff(%d) = %v, want %v", attempts, got, want)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package notifications
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// webhookDialTimeout bounds connecting to a webhook receiver
+const webhookDialTimeout = 10 * time.Second
+
+// ErrForbiddenAddress is returned for webhook URLs and connections that would
+// reach this network rather than the internet
+var ErrForbiddenAddress = errors.New("address is not public")
+
+// ValidateWebhookURL checks that raw is an absolute https URL. A host given
+// as an IP address must be public; hostnames are checked when connecting,
+// after DNS resolution, since what they resolve to can change.
+func ValidateWebhookURL(raw string) error {
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid URL: %w", err)
+	}
+	if parsed.Scheme != "https" || parsed.Hostname() == "" {
+		return errors.New("URL must be an absolute https URL")
+	}
+	if ip := net.ParseIP(parsed.Hostname()); ip != nil && !publicIP(ip) {
+		return fmt.Errorf("%w: %s", ErrForbiddenAddress, ip)
+	}
+
+	return nil
+}
+
+// NewWebhookClient returns an HTTP client for user-configured webhook URLs.
+// It doesn't follow redirects, since the signed payload is meant for the
+// configured URL only, ignores proxy settings, and refuses to connect to
+// loopback, private, link-local and unspecified addresses.
+func NewWebhookClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: webhookDialTimeout,
+		// Control runs for every address DNS returned, right before connecting
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+				return fmt.Errorf("%w: %s", ErrForbiddenAddress, host)
+			}
+			return nil
+		},
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// publicIP reports whether ip can be reached over the internet rather than
+// only from this host or network
+func publicIP(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsUnspecified() &&
+		!ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() && !ip.IsMulticast()
+}
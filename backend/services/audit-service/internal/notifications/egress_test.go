@@ -0,0 +1,63 @@
+package notifications
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateWebhookURL(t *testing.T) {
+	tests := []struct {
+		url   string
+		valid bool
+	}{
+		{"https://hooks.example.com/alerts", true},
+		{"https://203.0.113.10:8443/alerts", true},
+		{"http://hooks.example.com/alerts", false},
+		{"ftp://hooks.example.com/alerts", false},
+		{"https:///alerts", false},
+		{"hooks.example.com/alerts", false},
+		{"https://127.0.0.1/alerts", false},
+		{"https://[::1]/alerts", false},
+		{"https://10.0.0.5/alerts", false},
+		{"https://172.16.0.1/alerts", false},
+		{"https://192.168.1.1/alerts", false},
+		{"https://169.254.169.254/latest/meta-data", false},
+		{"https://[fe80::1]/alerts", false},
+		{"https://[fd00::1]/alerts", false},
+		{"https://0.0.0.0/alerts", false},
+		{"https://[::]/alerts", false},
+	}
+
+	for _, tt := range tests {
+		if err := ValidateWebhookURL(tt.url); (err == nil) != tt.valid {
+			t.Errorf("ValidateWebhookURL(%q) = %v, want valid %v", tt.url, err, tt.valid)
+		}
+	}
+}
+
+func TestWebhookClientRefusesInternalAddresses(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("webhook client reached a loopback receiver")
+	}))
+	defer server.Close()
+
+	client := NewWebhookClient(5 * time.Second)
+	port := server.URL[strings.LastIndex(server.URL, ":"):]
+
+	// localhost is only known to be loopback once it has been resolved
+	for _, url := range []string{server.URL, "https://localhost" + port} {
+		resp, err := client.Get(url)
+		if err == nil {
+			resp.Body.Close()
+			t.Errorf("GET %s succeeded", url)
+			continue
+		}
+		if !errors.Is(err, ErrForbiddenAddress) {
+			t.Errorf("GET %s failed with %v, want ErrForbiddenAddress", url, err)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package notifications
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// SMTPConfig holds the settings for sending email notifications
+type SMTPConfig struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// EmailChannel sends alerts by email over SMTP
+type EmailChannel struct {
+	config SMTPConfig
+}
+
+// NewEmailChannel creates a new SMTP email channel
+func NewEmailChannel(config SMTPConfig) *EmailChannel {
+	return &EmailChannel{config: config}
+}
+
+// Name returns the channel name
+func (c *EmailChannel) Name() string {
+	return ChannelEmail
+}
+
+// Send emails the alert to the recipient
+func (c *EmailChannel) Send(ctx context.Context, n *Notification) error {
+	if n.Recipient == "" {
+		return fmt.Errorf("no email address for user %s", n.Alert.UserID)
+	}
+
+	var auth smtp.Auth
+	if c.config.Username != "" {
+		auth = smtp.PlainAuth("", c.config.Username, c.config.Password, c.config.Host)
+	}
+
+	if err := c.sendMail(ctx, auth, n.Recipient, c.buildMessage(n)); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+
+	return nil
+}
+
+// sendMail is smtp.SendMail with the connection bounded by ctx, so a stuck
+// mail server can't hold up the dispatcher
+func (c *EmailChannel) sendMail(ctx context.Context, auth smtp.Auth, to string, msg []byte) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(c.config.Host, c.config.Port))
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, c.config.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: c.config.Host}); err != nil {
+			return err
+		}
+	}
+
+	if auth != nil {
+		if err := client.Auth(auth); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(c.config.From); err != nil {
+		return err
+	}
+	if err := client.Rcpt(to); err != nil {
+		return err
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
+
+// buildMessage renders the alert as a plain text email
+func (c *EmailChannel) buildMessage(n *Notification) []byte {
+	alert := n.Alert
+	subject := fmt.Sprintf("[%s] Security alert: %s", strings.ToUpper(alert.Severity), alert.AlertType)
+
+	var body bytes.Buffer
+	fmt.Fprintf(&body, "We detected activity on your account that needs your attention.\r\n\r\n")
+	fmt.Fprintf(&body, "%s\r\n\r\n", alert.Description)
+	fmt.Fprintf(&body, "Alert:    %s\r\n", alert.AlertType)
+	fmt.Fprintf(&body, "Severity: %s\r\n", alert.Severity)
+	if alert.IPAddress != nil {
+		fmt.Fprintf(&body, "IP:       %s\r\n", *alert.IPAddress)
+	}
+	if location := formatLocation(alert.LocationCity, alert.LocationCountry); location != "" {
+		fmt.Fprintf(&body, "Location: %s\r\n", location)
+	}
+	fmt.Fprintf(&body, "Time:     %s\r\n\r\n", alert.CreatedAt.UTC().Format(time.RFC1123))
+	fmt.Fprintf(&body, "If this wasn't you, revoke your active sessions and change your password.\r\n")
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", sanitizeHeader(c.config.From))
+	fmt.Fprintf(&msg, "To: %s\r\n", sanitizeHeader(n.Recipient))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", sanitizeHeader(subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&msg, "Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	msg.Write(body.Bytes())
+
+	return msg.Bytes()
+}
+
+// sanitizeHeader strips line breaks so values can't inject extra headers
+func sanitizeHeader(value string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(value)
+}
+
+func formatLocation(city, country *string) string {
+	switch {
+	case city != nil && country != nil:
+		return *city + ", " + *country
+	case country != nil:
+		return *country
+	default:
+		return ""
+	}
+}
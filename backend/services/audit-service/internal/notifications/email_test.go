@@ -0,0 +1,194 @@
+package notifications
+
+import (
+	"context"
+	"encoding/base64"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// smtpStub is an in-process SMTP server that accepts every message, or
+// rejects every recipient when rejectRcpt is set
+type smtpStub struct {
+	host, port string
+	rejectRcpt bool
+
+	mu    sync.Mutex
+	auth  string
+	from  string
+	rcpts []string
+	data  string
+}
+
+func startSMTPStub(t *testing.T, rejectRcpt bool) *smtpStub {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	stub := &smtpStub{rejectRcpt: rejectRcpt}
+	stub.host, stub.port, _ = net.SplitHostPort(listener.Addr().String())
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go stub.serve(conn)
+		}
+	}()
+
+	return stub
+}
+
+func (s *smtpStub) serve(conn net.Conn) {
+	defer conn.Close()
+	text := textproto.NewConn(conn)
+	text.PrintfLine("220 stub ESMTP")
+
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+
+		s.mu.Lock()
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			text.PrintfLine("250-stub\r\n250 AUTH PLAIN")
+		case "AUTH":
+			s.auth = arg
+			text.PrintfLine("235 authenticated")
+		case "MAIL":
+			s.from = arg
+			text.PrintfLine("250 ok")
+		case "RCPT":
+			if s.rejectRcpt {
+				text.PrintfLine("550 no such user")
+				break
+			}
+			s.rcpts = append(s.rcpts, arg)
+			text.PrintfLine("250 ok")
+		case "DATA":
+			text.PrintfLine("354 go ahead")
+			data, err := text.ReadDotBytes()
+			if err != nil {
+				s.mu.Unlock()
+				return
+			}
+			s.data = string(data)
+			text.PrintfLine("250 queued")
+		case "QUIT":
+			text.PrintfLine("221 bye")
+			s.mu.Unlock()
+			return
+		default:
+			text.PrintfLine("502 not implemented")
+		}
+		s.mu.Unlock()
+	}
+}
+
+func TestEmailChannelSend(t *testing.T) {
+	stub := startSMTPStub(t, false)
+	channel := NewEmailChannel(SMTPConfig{
+		Host:     stub.host,
+		Port:     stub.port,
+		Username: "alerts",
+		Password: "hunter2",
+		From:     "security@example.com",
+	})
+
+	alert := testAlert()
+	alert.AlertType = "impossible_travel\r\nBcc: attacker@example.com"
+
+	err := channel.Send(context.Background(), &Notification{
+		DeliveryID: "delivery-1",
+		Alert:      alert,
+		Recipient:  "user@example.com",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stub.mu.Lock()
+	defer stub.mu.Unlock()
+
+	if want := "PLAIN " + base64.StdEncoding.EncodeToString([]byte("\x00alerts\x00hunter2")); stub.auth != want {
+		t.Errorf("AUTH = %q, want %q", stub.auth, want)
+	}
+	if stub.from != "FROM:<security@example.com>" {
+		t.Errorf("MAIL = %q", stub.from)
+	}
+	if len(stub.rcpts) != 1 || stub.rcpts[0] != "TO:<user@example.com>" {
+		t.Errorf("RCPT = %q", stub.rcpts)
+	}
+
+	headers, body, _ := strings.Cut(stub.data, "\n\n")
+	if !strings.Contains(headers, "Subject: [HIGH] Security alert: impossible_travelBcc: attacker@example.com\n") {
+		t.Errorf("unexpected headers:\n%s", headers)
+	}
+	if strings.Contains(headers, "\nBcc:") {
+		t.Error("alert type injected a header")
+	}
+	if !strings.Contains(body, "Login from two countries within an hour") || !strings.Contains(body, "IP:       203.0.113.7") {
+		t.Errorf("unexpected body:\n%s", body)
+	}
+}
+
+func TestEmailChannelSendFailures(t *testing.T) {
+	t.Run("rejected recipient", func(t *testing.T) {
+		stub := startSMTPStub(t, true)
+		channel := NewEmailChannel(SMTPConfig{Host: stub.host, Port: stub.port, From: "security@example.com"})
+
+		err := channel.Send(context.Background(), &Notification{Alert: testAlert(), Recipient: "user@example.com"})
+		if err == nil || !strings.Contains(err.Error(), "550") {
+			t.Errorf("Send error = %v, want the 550 reply", err)
+		}
+	})
+
+	t.Run("server never greets", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer listener.Close()
+		go func() {
+			conn, err := listener.Accept()
+			if err == nil {
+				defer conn.Close()
+				time.Sleep(5 * time.Second)
+			}
+		}()
+
+		host, port, _ := net.SplitHostPort(listener.Addr().String())
+		channel := NewEmailChannel(SMTPConfig{Host: host, Port: port, From: "security@example.com"})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+
+		start := time.Now()
+		if err := channel.Send(ctx, &Notification{Alert: testAlert(), Recipient: "user@example.com"}); err == nil {
+			t.Error("Send succeeded")
+		}
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Errorf("Send took %v, want it bounded by the context", elapsed)
+		}
+	})
+
+	t.Run("no recipient", func(t *testing.T) {
+		channel := NewEmailChannel(SMTPConfig{Host: "127.0.0.1", Port: "1", From: "security@example.com"})
+		if err := channel.Send(context.Background(), &Notification{Alert: testAlert()}); err == nil {
+			t.Error("Send succeeded")
+		}
+	})
+}
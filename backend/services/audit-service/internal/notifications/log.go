@@ -0,0 +1,26 @@
+package notifications
+
+import (
+	"context"
+	"log"
+)
+
+// LogChannel writes alerts to the service log, for operators or a log shipper to pick up
+type LogChannel struct{}
+
+// NewLogChannel creates a new log sink channel
+func NewLogChannel() *LogChannel {
+	return &LogChannel{}
+}
+
+// Name returns the channel name
+func (c *LogChannel) Name() string {
+	return ChannelLog
+}
+
+// Send logs the alert
+func (c *LogChannel) Send(ctx context.Context, n *Notification) error {
+	log.Printf("Security alert %s: user=%s type=%s severity=%s description=%q",
+		n.Alert.ID, n.Alert.UserID, n.Alert.AlertType, n.Alert.Severity, n.Alert.Description)
+	return nil
+}
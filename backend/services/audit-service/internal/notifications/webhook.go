@@ -0,0 +1,118 @@
+package notifications
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Headers set on every webhook request. Receivers verify the signature by
+// computing HMAC-SHA256 over "<timestamp>.<body>" with their webhook secret.
+const (
+	WebhookSignatureHeader = "X-Webhook-Signature"
+	WebhookTimestampHeader = "X-Webhook-Timestamp"
+	WebhookDeliveryHeader  = "X-Webhook-Delivery"
+)
+
+// WebhookChannel posts alerts as signed JSON to a user-configured URL
+type WebhookChannel struct {
+	client *http.Client
+}
+
+// NewWebhookChannel creates a new webhook channel
+func NewWebhookChannel(timeout time.Duration) *WebhookChannel {
+	return &WebhookChannel{client: NewWebhookClient(timeout)}
+}
+
+// Name returns the channel name
+func (c *WebhookChannel) Name() string {
+	return ChannelWebhook
+}
+
+// webhookPayload is the JSON body sent to webhook receivers
+type webhookPayload struct {
+	Event string       `json:"event"`
+	Alert webhookAlert `json:"alert"`
+}
+
+type webhookAlert struct {
+	ID              string  `json:"id"`
+	UserID          string  `json:"user_id"`
+	AlertType       string  `json:"alert_type"`
+	Severity        string  `json:"severity"`
+	Description     string  `json:"description"`
+	IPAddress       *string `json:"ip_address,omitempty"`
+	LocationCountry *string `json:"location_country,omitempty"`
+	LocationCity    *string `json:"location_city,omitempty"`
+	CreatedAt       string  `json:"created_at"`
+}
+
+// Send posts the alert to the recipient URL
+func (c *WebhookChannel) Send(ctx context.Context, n *Notification) error {
+	if n.Recipient == "" {
+		return fmt.Errorf("no webhook URL for user %s", n.Alert.UserID)
+	}
+	// URLs saved before they had to be https are dropped rather than retried
+	if err := ValidateWebhookURL(n.Recipient); err != nil {
+		return fmt.Errorf("%w: %v", errDropped, err)
+	}
+
+	body, err := json.Marshal(webhookPayload{
+		Event: "security_alert",
+		Alert: webhookAlert{
+			ID:              n.Alert.ID,
+			UserID:          n.Alert.UserID,
+			AlertType:       n.Alert.AlertType,
+			Severity:        n.Alert.Severity,
+			Description:     n.Alert.Description,
+			IPAddress:       n.Alert.IPAddress,
+			LocationCountry: n.Alert.LocationCountry,
+			LocationCity:    n.Alert.LocationCity,
+			CreatedAt:       n.Alert.CreatedAt.Format(time.RFC3339),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.Recipient, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %w", err)
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+	req.Header.Set(WebhookDeliveryHeader, n.DeliveryID)
+	req.Header.Set(WebhookSignatureHeader, "sha256="+SignWebhookPayload(n.Secret, timestamp, body))
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// SignWebhookPayload computes the hex HMAC-SHA256 signature of a webhook body
+func SignWebhookPayload(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
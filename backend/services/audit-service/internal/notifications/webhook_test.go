@@ -0,0 +1,134 @@
+package notifications
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aashiq-04/session-management-system/backend/services/audit-service/internal/models"
+)
+
+// receiverURL is the webhook URL used in tests. It is a public name, and one
+// the httptest certificate is valid for, so it passes ValidateWebhookURL;
+// the test client routes it to the local receiver.
+const receiverURL = "https://example.com/hooks/alerts"
+
+// newReceiver starts a TLS webhook receiver and returns a webhook channel
+// whose connections all go to it. The restricted dialer would refuse the
+// receiver's loopback address, so the channel gets the server's own client.
+func newReceiver(t *testing.T, handler http.HandlerFunc) *WebhookChannel {
+	t.Helper()
+
+	server := httptest.NewTLSServer(handler)
+	t.Cleanup(server.Close)
+
+	client := server.Client()
+	client.Timeout = 5 * time.Second
+	client.CheckRedirect = NewWebhookClient(0).CheckRedirect
+	transport := client.Transport.(*http.Transport)
+	transport.DialContext = func(ctx context.Context, network, _ string) (net.Conn, error) {
+		var dialer net.Dialer
+		return dialer.DialContext(ctx, network, server.Listener.Addr().String())
+	}
+
+	return &WebhookChannel{client: client}
+}
+
+func testAlert() *models.SecurityAlert {
+	ip := "203.0.113.7"
+	country := "NL"
+	return &models.SecurityAlert{
+		ID:              "alert-1",
+		UserID:          "user-1",
+		AlertType:       "impossible_travel",
+		Severity:        "high",
+		Description:     "Login from two countries within an hour",
+		IPAddress:       &ip,
+		LocationCountry: &country,
+		CreatedAt:       time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+}
+
+func TestWebhookChannelSend(t *testing.T) {
+	var got webhookPayload
+	channel := newReceiver(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		timestamp := r.Header.Get(WebhookTimestampHeader)
+		if want := "sha256=" + SignWebhookPayload("secret", timestamp, body); r.Header.Get(WebhookSignatureHeader) != want {
+			t.Errorf("signature = %q, want %q", r.Header.Get(WebhookSignatureHeader), want)
+		}
+		if r.Header.Get(WebhookDeliveryHeader) != "delivery-1" {
+			t.Errorf("delivery header = %q, want delivery-1", r.Header.Get(WebhookDeliveryHeader))
+		}
+		if err := json.Unmarshal(body, &got); err != nil {
+			t.Errorf("invalid payload: %v", err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	err := channel.Send(context.Background(), &Notification{
+		DeliveryID: "delivery-1",
+		Alert:      testAlert(),
+		Recipient:  receiverURL,
+		Secret:     "secret",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Event != "security_alert" || got.Alert.ID != "alert-1" || got.Alert.Severity != "high" ||
+		got.Alert.CreatedAt != "2026-01-02T03:04:05Z" {
+		t.Errorf("unexpected payload %+v", got)
+	}
+}
+
+func TestWebhookChannelSendFailures(t *testing.T) {
+	tests := []struct {
+		name      string
+		url       string
+		status    int
+		location  string
+		dropped   bool
+		delivered bool
+	}{
+		{name: "server error", url: receiverURL, status: http.StatusInternalServerError, delivered: true},
+		{name: "redirect is not followed", url: receiverURL, status: http.StatusFound, location: "https://example.com/elsewhere", delivered: true},
+		{name: "plain http", url: "http://example.com/hooks/alerts", dropped: true},
+		{name: "internal address", url: "https://169.254.169.254/latest/meta-data", dropped: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := 0
+			channel := newReceiver(t, func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				if tt.location != "" {
+					w.Header().Set("Location", tt.location)
+				}
+				w.WriteHeader(tt.status)
+			})
+
+			err := channel.Send(context.Background(), &Notification{
+				DeliveryID: "delivery-1",
+				Alert:      testAlert(),
+				Recipient:  tt.url,
+				Secret:     "secret",
+			})
+			if err == nil {
+				t.Fatal("Send succeeded")
+			}
+			if errors.Is(err, errDropped) != tt.dropped {
+				t.Errorf("Send error %v, want dropped %v", err, tt.dropped)
+			}
+			if want := map[bool]int{true: 1, false: 0}[tt.delivered]; requests != want {
+				t.Errorf("receiver got %d requests, want %d", requests, want)
+			}
+		})
+	}
+}
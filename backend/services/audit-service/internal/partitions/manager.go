@@ -0,0 +1,165 @@
+// Package partitions maintains the monthly partitions of audit_logs
+package partitions
+
+import (
+	"context"
+	"crypto/ed25519"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/aashiq-04/session-management-system/backend/services/audit-service/internal/chain"
+	"github.com/aashiq-04/session-management-system/backend/services/audit-service/internal/models"
+	"github.com/aashiq-04/session-management-system/backend/services/audit-service/internal/repository"
+)
+
+// Config holds partition management settings
+type Config struct {
+	PremakeMonths   int                // Future months to keep partitions ready for
+	RetentionMonths int                // Full months to keep before the current one; 0 keeps everything
+	DropExpired     bool               // Drop expired partitions instead of only detaching them
+	Interval        time.Duration      // How often to check partitions
+	SigningKey      ed25519.PrivateKey // Signs the tombstones of expired partitions; nothing expires without it
+}
+
+// Manager creates upcoming audit_logs partitions and expires old ones
+type Manager struct {
+	repo   *repository.AuditRepository
+	config Config
+}
+
+// NewManager creates a new partition manager
+func NewManager(db *sql.DB, config Config) *Manager {
+	return &Manager{
+		repo:   repository.NewAuditRepository(db),
+		config: config,
+	}
+}
+
+// Run maintains partitions every interval until ctx is cancelled
+func (m *Manager) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.Maintain()
+		}
+	}
+}
+
+// Maintain creates missing partitions from the current month through the
+// premade ones, then expires partitions past retention. Errors are logged so
+// one bad partition doesn't hold up the rest.
+func (m *Manager) Maintain() {
+	now := time.Now().UTC()
+	current := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	existing, err := m.repo.ListAuditLogPartitions()
+	if err != nil {
+		log.Printf("Failed to list audit log partitions: %v", err)
+		return
+	}
+	attached := make(map[string]bool, len(existing))
+	for _, name := range existing {
+		attached[name] = true
+	}
+
+	for i := 0; i <= m.config.PremakeMonths; i++ {
+		month := current.AddDate(0, i, 0)
+		name := repository.AuditLogPartitionName(month)
+		if attached[name] {
+			continue
+		}
+
+		// Fails if the default partition already holds rows for this month;
+		// they stay there and are still queried through audit_logs
+		if err := m.repo.CreateAuditLogPartition(month); err != nil {
+			log.Printf("Failed to create audit log partition %s: %v", name, err)
+			continue
+		}
+		log.Printf("Created audit log partition %s", name)
+	}
+
+	if hasRows, err := m.repo.HasDefaultPartitionRows(); err != nil {
+		log.Printf("Failed to check default audit log partition: %v", err)
+	} else if hasRows {
+		log.Println("audit_logs_default holds rows outside the monthly partitions; they are never expired")
+	}
+
+	if m.config.RetentionMonths > 0 {
+		if m.config.SigningKey == nil {
+			log.Println("AUDIT_CHECKPOINT_KEY not set, expired audit log partitions are kept")
+			return
+		}
+		m.expire(existing, current.AddDate(0, -m.config.RetentionMonths, 0))
+	}
+}
+
+// expire detaches or drops the monthly partitions that end on or before
+// cutoff, oldest first
+func (m *Manager) expire(partitions []string, cutoff time.Time) {
+	var expired []string
+	for _, name := range partitions {
+		month, err := time.Parse("audit_logs_y2006m01", name)
+		if err != nil {
+			continue // Not a monthly partition, e.g. the default one
+		}
+		if !month.AddDate(0, 1, 0).After(cutoff) {
+			expired = append(expired, name)
+		}
+	}
+	sort.Strings(expired)
+
+	for _, name := range expired {
+		rows, err := m.repo.ExpireAuditLogPartition(name, m.config.DropExpired, m.signTombstone)
+		if err != nil {
+			log.Printf("Failed to expire audit log partition %s: %v", name, err)
+			return
+		}
+
+		action := "detached"
+		if m.config.DropExpired {
+			action = "dropped"
+		}
+		log.Printf("Expired audit log partition %s (%d rows, %s)", name, rows, action)
+		m.recordExpiry(name, rows, action)
+	}
+}
+
+// signTombstone signs the tombstone of a run of expired entries with the checkpoint key
+func (m *Manager) signTombstone(tombstone *models.AuditLogTombstone) {
+	chain.SignTombstone(m.config.SigningKey, tombstone)
+}
+
+// recordExpiry adds an audit event for an expired partition, so retention
+// itself leaves a trail
+func (m *Manager) recordExpiry(name string, rows int64, action string) {
+	metadataJSON, _ := json.Marshal(map[string]interface{}{
+		"partition":        name,
+		"rows":             rows,
+		"action":           action,
+		"retention_months": m.config.RetentionMonths,
+	})
+	metadata := string(metadataJSON)
+
+	err := m.repo.CreateAuditLog(&models.AuditLog{
+		ID:            uuid.New().String(),
+		EventType:     "audit_partition_expired",
+		EventCategory: "security",
+		Severity:      "info",
+		Metadata:      &metadata,
+		Success:       true,
+		CreatedAt:     time.Now(),
+	})
+	if err != nil {
+		log.Printf("Failed to create audit log: %v", err)
+	}
+}
@@ -2,10 +2,21 @@ package repository
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
+	"github.com/lib/pq"
+
 	"github.com/aashiq-04/session-management-system/backend/services/audit-service/internal/models"
+	"github.com/aashiq-04/session-management-system/backend/services/audit-service/internal/search"
+)
+
+// Errors returned when a lookup or update matches nothing
+var (
+	ErrAuditLogNotFound      = errors.New("audit log not found")
+	ErrSecurityAlertNotFound = errors.New("security alert not found")
 )
 
 // AuditRepository handles database operations for audit logs
@@ -18,16 +29,56 @@ func NewAuditRepository(db *sql.DB) *AuditRepository {
 	return &AuditRepository{db: db}
 }
 
-// CreateAuditLog creates a new audit log entry
+// CreateAuditLog appends a new audit log entry to the hash chain
+// Writing the same ID and timestamp twice is a no-op, so callers can safely retry
 func (r *AuditRepository) CreateAuditLog(log *models.AuditLog) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Let Postgres normalize the values it would rewrite on storage (UUID case,
+	// INET and JSONB formatting, timestamp precision), so the hash computed here
+	// matches the one recomputed from the stored row
+	err = tx.QueryRow(
+		`SELECT $1::uuid, $2::uuid, $3::uuid, $4::uuid, $5::inet, $6::jsonb, $7::timestamptz`,
+		log.ID, log.UserID, log.SessionID, log.DeviceID, log.IPAddress, log.Metadata, log.CreatedAt,
+	).Scan(&log.ID, &log.UserID, &log.SessionID, &log.DeviceID, &log.IPAddress, &log.Metadata, &log.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to normalize audit log: %w", err)
+	}
+
+	// Locking the head row serializes writers, keeping the chain linear
+	err = tx.QueryRow(`SELECT sequence, entry_hash FROM audit_chain_head FOR UPDATE`).Scan(&log.Sequence, &log.PrevHash)
+	if err != nil {
+		return fmt.Errorf("failed to lock audit chain head: %w", err)
+	}
+
+	// Events for a user erased from the audit trail keep no personal data
+	if log.UserID != nil {
+		erased, err := isErased(tx, *log.UserID)
+		if err != nil {
+			return err
+		}
+		if erased {
+			ScrubAuditLog(log)
+		}
+	}
+
+	log.Sequence++
+	log.EntryHash = AuditLogHash(log)
+
 	query := `
 		INSERT INTO audit_logs (id, user_id, session_id, device_id, event_type, event_category,
 		                        severity, ip_address, user_agent, location_country, location_city,
-		                        metadata, success, failure_reason, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+		                        metadata, success, failure_reason, created_at,
+		                        sequence, prev_hash, entry_hash)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18)
+		ON CONFLICT (id, created_at) DO NOTHING
 	`
 	
-	_, err := r.db.Exec(
+	result, err := tx.Exec(
 		query,
 		log.ID,
 		log.UserID,
@@ -44,120 +95,193 @@ func (r *AuditRepository) CreateAuditLog(log *models.AuditLog) error {
 		log.Success,
 		log.FailureReason,
 		log.CreatedAt,
+		log.Sequence,
+		log.PrevHash,
+		log.EntryHash,
 	)
 	
 	if err != nil {
 		return fmt.Errorf("failed to create audit log: %w", err)
 	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to create audit log: %w", err)
+	}
+	if rows == 0 {
+		// Already recorded by an earlier attempt; leave the chain head alone, and
+		// clear the chain fields computed above since they were never stored
+		log.Sequence, log.PrevHash, log.EntryHash = 0, "", ""
+		return nil
+	}
+
+	_, err = tx.Exec(
+		`UPDATE audit_chain_head SET sequence = $1, entry_hash = $2, updated_at = CURRENT_TIMESTAMP`,
+		log.Sequence, log.EntryHash,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to advance audit chain head: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit audit log: %w", err)
+	}
 	
 	return nil
 }
 
-// GetUserAuditLogs retrieves audit logs for a specific user
-func (r *AuditRepository) GetUserAuditLogs(userID string, limit, offset int, eventCategory, severity string, successOnly bool) ([]models.AuditLog, int, error) {
-	// Build query with filters
+// GetAuditLogByID retrieves an audit log entry by its ID
+func (r *AuditRepository) GetAuditLogByID(logID string) (*models.AuditLog, error) {
 	query := `
 		SELECT id, user_id, session_id, device_id, event_type, event_category,
 		       severity, ip_address, user_agent, location_country, location_city,
 		       metadata, success, failure_reason, created_at
 		FROM audit_logs
-		WHERE user_id = $1
+		WHERE id = $1
 	`
 	
-	countQuery := `SELECT COUNT(*) FROM audit_logs WHERE user_id = $1`
-	
-	args := []interface{}{userID}
-	argIndex := 2
+	log := &models.AuditLog{}
+	err := r.db.QueryRow(query, logID).Scan(
+		&log.ID, &log.UserID, &log.SessionID, &log.DeviceID,
+		&log.EventType, &log.EventCategory, &log.Severity,
+		&log.IPAddress, &log.UserAgent, &log.LocationCountry, &log.LocationCity,
+		&log.Metadata, &log.Success, &log.FailureReason, &log.CreatedAt,
+	)
 	
-	if eventCategory != "" {
-		query += fmt.Sprintf(" AND event_category = $%d", argIndex)
-		countQuery += fmt.Sprintf(" AND event_category = $%d", argIndex)
-		args = append(args, eventCategory)
-		argIndex++
+	if err == sql.ErrNoRows {
+		return nil, ErrAuditLogNotFound
 	}
-	
-	if severity != "" {
-		query += fmt.Sprintf(" AND severity = $%d", argIndex)
-		countQuery += fmt.Sprintf(" AND severity = $%d", argIndex)
-		args = append(args, severity)
-		argIndex++
-	}
-	
-	if successOnly {
-		query += fmt.Sprintf(" AND success = $%d", argIndex)
-		countQuery += fmt.Sprintf(" AND success = $%d", argIndex)
-		args = append(args, true)
-		argIndex++
+	if err != nil {
+		return nil, fmt.Errorf("failed to get audit log: %w", err)
 	}
 	
-	query += " ORDER BY created_at DESC"
-	
-	if limit > 0 {
-		query += fmt.Sprintf(" LIMIT $%d OFFSET $%d", argIndex, argIndex+1)
-		args = append(args, limit, offset)
+	return log, nil
+}
+
+// GetUserAuditLogs retrieves a page of audit logs for a specific user, newest first
+func (r *AuditRepository) GetUserAuditLogs(userID string, filter models.AuditLogFilter, after *models.AuditLogCursor, limit, offset int) ([]models.AuditLog, int, bool, error) {
+	filter.UserID = userID
+	return r.listAuditLogs(filter, after, limit, offset)
+}
+
+// GetAuditLogsByEvent retrieves a page of audit logs with an event type, newest first
+func (r *AuditRepository) GetAuditLogsByEvent(eventType string, filter models.AuditLogFilter, after *models.AuditLogCursor, limit, offset int) ([]models.AuditLog, int, bool, error) {
+	if len(filter.EventTypes) > 0 && !containsString(filter.EventTypes, eventType) {
+		return nil, 0, false, nil
 	}
-	
-	// Get total count
+	filter.EventTypes = []string{eventType}
+	return r.listAuditLogs(filter, after, limit, offset)
+}
+
+// listAuditLogs returns a page of logs matching filter, along with the total
+// matching count and whether more pages follow
+func (r *AuditRepository) listAuditLogs(filter models.AuditLogFilter, after *models.AuditLogCursor, limit, offset int) ([]models.AuditLog, int, bool, error) {
+	conditions, args := auditLogConditions(filter)
+
+	// Get total count, before the cursor and limit add their own args
+	countQuery := `SELECT COUNT(*) FROM audit_logs` + whereClause(conditions)
+
 	var totalCount int
-	err := r.db.QueryRow(countQuery, args[:len(args)-2]...).Scan(&totalCount)
+	err := r.db.QueryRow(countQuery, args...).Scan(&totalCount)
 	if err != nil {
-		return nil, 0, fmt.Errorf("failed to get count: %w", err)
+		return nil, 0, false, fmt.Errorf("failed to get count: %w", err)
 	}
-	
-	// Get logs
-	rows, err := r.db.Query(query, args...)
+
+	logs, hasMore, err := r.queryAuditLogs(conditions, args, after, limit, offset)
 	if err != nil {
-		return nil, 0, fmt.Errorf("failed to query audit logs: %w", err)
+		return nil, 0, false, err
 	}
-	defer rows.Close()
-	
-	var logs []models.AuditLog
-	for rows.Next() {
-		var log models.AuditLog
-		err := rows.Scan(
-			&log.ID, &log.UserID, &log.SessionID, &log.DeviceID,
-			&log.EventType, &log.EventCategory, &log.Severity,
-			&log.IPAddress, &log.UserAgent, &log.LocationCountry, &log.LocationCity,
-			&log.Metadata, &log.Success, &log.FailureReason, &log.CreatedAt,
-		)
+
+	return logs, totalCount, hasMore, nil
+}
+
+// SearchAuditLogs retrieves a page of audit logs matching a search query, newest
+// first. An empty userID searches every user's logs.
+func (r *AuditRepository) SearchAuditLogs(userID string, query *search.Query, after *models.AuditLogCursor, limit int) ([]models.AuditLog, bool, error) {
+	conditions, args := auditLogConditions(models.AuditLogFilter{UserID: userID})
+
+	searchConditions, searchArgs, err := query.SQL(len(args) + 1)
+	if err != nil {
+		return nil, false, err
+	}
+	conditions = append(conditions, searchConditions...)
+	args = append(args, searchArgs...)
+
+	return r.queryAuditLogs(conditions, args, after, limit, 0)
+}
+
+// exportBatchSize is how many rows ExportAuditLogs reads per query
+const exportBatchSize = 1000
+
+// ExportAuditLogs calls fn for every audit log matching the filter and optional
+// search query, newest first, and returns how many were exported. Rows are read
+// in keyset-paginated batches so an export never holds more than one batch.
+func (r *AuditRepository) ExportAuditLogs(filter models.AuditLogFilter, query *search.Query, fn func(*models.AuditLog) error) (int, error) {
+	conditions, args := auditLogConditions(filter)
+	if query != nil {
+		searchConditions, searchArgs, err := query.SQL(len(args) + 1)
 		if err != nil {
-			return nil, 0, fmt.Errorf("failed to scan audit log: %w", err)
+			return 0, err
 		}
-		logs = append(logs, log)
+		conditions = append(conditions, searchConditions...)
+		args = append(args, searchArgs...)
+	}
+
+	count := 0
+	var after *models.AuditLogCursor
+	for {
+		logs, hasMore, err := r.queryAuditLogs(conditions, args, after, exportBatchSize, 0)
+		if err != nil {
+			return count, err
+		}
+
+		for i := range logs {
+			if err := fn(&logs[i]); err != nil {
+				return count, err
+			}
+			count++
+		}
+
+		if !hasMore {
+			return count, nil
+		}
+		last := logs[len(logs)-1]
+		after = &models.AuditLogCursor{CreatedAt: last.CreatedAt, ID: last.ID}
 	}
-	
-	return logs, totalCount, nil
 }
 
-// GetAuditLogsByEvent retrieves audit logs by event type
-func (r *AuditRepository) GetAuditLogsByEvent(eventType string, limit, offset int, startDate, endDate time.Time) ([]models.AuditLog, int, error) {
+// queryAuditLogs returns up to limit logs matching conditions, ordered by
+// (created_at, id) descending, and whether more pages follow. Pages continue
+// after the given cursor; offset is only honoured without one.
+func (r *AuditRepository) queryAuditLogs(conditions []string, args []interface{}, after *models.AuditLogCursor, limit, offset int) ([]models.AuditLog, bool, error) {
+	if after != nil {
+		args = append(args, after.CreatedAt, after.ID)
+		conditions = append(conditions, fmt.Sprintf("(created_at, id) < ($%d, $%d::uuid)", len(args)-1, len(args)))
+	}
+
 	query := `
 		SELECT id, user_id, session_id, device_id, event_type, event_category,
 		       severity, ip_address, user_agent, location_country, location_city,
 		       metadata, success, failure_reason, created_at
 		FROM audit_logs
-		WHERE event_type = $1 AND created_at >= $2 AND created_at <= $3
-		ORDER BY created_at DESC
-		LIMIT $4 OFFSET $5
-	`
-	
-	countQuery := `
-		SELECT COUNT(*)
-		FROM audit_logs
-		WHERE event_type = $1 AND created_at >= $2 AND created_at <= $3
+	` + whereClause(conditions) + `
+		ORDER BY created_at DESC, id DESC
 	`
-	
-	// Get total count
-	var totalCount int
-	err := r.db.QueryRow(countQuery, eventType, startDate, endDate).Scan(&totalCount)
-	if err != nil {
-		return nil, 0, fmt.Errorf("failed to get count: %w", err)
+
+	// Fetch one extra row to find out whether there is another page
+	if limit > 0 {
+		args = append(args, limit+1)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+	if offset > 0 && after == nil {
+		args = append(args, offset)
+		query += fmt.Sprintf(" OFFSET $%d", len(args))
 	}
 	
 	// Get logs
-	rows, err := r.db.Query(query, eventType, startDate, endDate, limit, offset)
+	rows, err := r.db.Query(query, args...)
 	if err != nil {
-		return nil, 0, fmt.Errorf("failed to query audit logs: %w", err)
+		return nil, false, fmt.Errorf("failed to query audit logs: %w", err)
 	}
 	defer rows.Close()
 	
@@ -171,24 +295,94 @@ func (r *AuditRepository) GetAuditLogsByEvent(eventType string, limit, offset in
 			&log.Metadata, &log.Success, &log.FailureReason, &log.CreatedAt,
 		)
 		if err != nil {
-			return nil, 0, fmt.Errorf("failed to scan audit log: %w", err)
+			return nil, false, fmt.Errorf("failed to scan audit log: %w", err)
 		}
 		logs = append(logs, log)
 	}
-	
-	return logs, totalCount, nil
+	if err := rows.Err(); err != nil {
+		return nil, false, fmt.Errorf("failed to query audit logs: %w", err)
+	}
+
+	hasMore := limit > 0 && len(logs) > limit
+	if hasMore {
+		logs = logs[:limit]
+	}
+
+	return logs, hasMore, nil
 }
 
-// CreateSecurityAlert creates a new security alert
-func (r *AuditRepository) CreateSecurityAlert(alert *models.SecurityAlert) error {
+// auditLogConditions turns a filter into SQL conditions and their args
+func auditLogConditions(filter models.AuditLogFilter) ([]string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+
+	add := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.UserID != "" {
+		add("user_id = $%d", filter.UserID)
+	}
+	if len(filter.EventTypes) > 0 {
+		add("event_type = ANY($%d)", pq.Array(filter.EventTypes))
+	}
+	if filter.EventCategory != "" {
+		add("event_category = $%d", filter.EventCategory)
+	}
+	if filter.Severity != "" {
+		add("severity = $%d", filter.Severity)
+	}
+	if filter.StartTime != nil {
+		add("created_at >= $%d", *filter.StartTime)
+	}
+	if filter.EndTime != nil {
+		add("created_at <= $%d", *filter.EndTime)
+	}
+	if filter.IPNetwork != "" {
+		add("ip_address <<= $%d::inet", filter.IPNetwork)
+	}
+	if filter.SessionID != "" {
+		add("session_id = $%d", filter.SessionID)
+	}
+	if filter.DeviceID != "" {
+		add("device_id = $%d", filter.DeviceID)
+	}
+	if filter.Success != nil {
+		add("success = $%d", *filter.Success)
+	}
+
+	return conditions, args
+}
+
+func whereClause(conditions []string) string {
+	if len(conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conditions, " AND ")
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateSecurityAlert creates a new security alert, reporting false if one
+// with the same ID was already stored
+func (r *AuditRepository) CreateSecurityAlert(alert *models.SecurityAlert) (bool, error) {
 	query := `
 		INSERT INTO security_alerts (id, user_id, alert_type, severity, description,
 		                             metadata, ip_address, location_country, location_city,
 		                             is_resolved, created_at)
 		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		ON CONFLICT (id) DO NOTHING
 	`
 	
-	_, err := r.db.Exec(
+	result, err := r.db.Exec(
 		query,
 		alert.ID,
 		alert.UserID,
@@ -204,10 +398,15 @@ func (r *AuditRepository) CreateSecurityAlert(alert *models.SecurityAlert) error
 	)
 	
 	if err != nil {
-		return fmt.Errorf("failed to create security alert: %w", err)
+		return false, fmt.Errorf("failed to create security alert: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to create security alert: %w", err)
 	}
 	
-	return nil
+	return rows > 0, nil
 }
 
 // GetSecurityAlerts retrieves security alerts for a user
@@ -215,7 +414,7 @@ func (r *AuditRepository) GetSecurityAlerts(userID string, includeResolved bool,
 	query := `
 		SELECT id, user_id, alert_type, severity, description, metadata,
 		       ip_address, location_country, location_city,
-		       is_resolved, resolved_at, created_at
+		       is_resolved, resolved_at, created_at, organization_id
 		FROM security_alerts
 		WHERE user_id = $1
 	`
@@ -247,7 +446,7 @@ func (r *AuditRepository) GetSecurityAlerts(userID string, includeResolved bool,
 			&alert.ID, &alert.UserID, &alert.AlertType, &alert.Severity,
 			&alert.Description, &alert.Metadata, &alert.IPAddress,
 			&alert.LocationCountry, &alert.LocationCity,
-			&alert.IsResolved, &alert.ResolvedAt, &alert.CreatedAt,
+			&alert.IsResolved, &alert.ResolvedAt, &alert.CreatedAt, &alert.OrganizationID,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan security alert: %w", err)
@@ -258,6 +457,97 @@ func (r *AuditRepository) GetSecurityAlerts(userID string, includeResolved bool,
 	return alerts, nil
 }
 
+// ListSecurityAlerts returns a page of security alerts of any user, or only
+// of organizationID's members or of userID if set, newest first, and the
+// total number of matches
+func (r *AuditRepository) ListSecurityAlerts(organizationID, userID string, includeResolved bool, severity string, limit, offset int) ([]models.SecurityAlert, int, error) {
+	var conditions []string
+	var args []interface{}
+
+	if organizationID != "" {
+		args = append(args, organizationID)
+		conditions = append(conditions, fmt.Sprintf("organization_id = $%d", len(args)))
+	}
+	if userID != "" {
+		args = append(args, userID)
+		conditions = append(conditions, fmt.Sprintf("user_id = $%d", len(args)))
+	}
+	if !includeResolved {
+		conditions = append(conditions, "is_resolved = false")
+	}
+	if severity != "" {
+		args = append(args, severity)
+		conditions = append(conditions, fmt.Sprintf("severity = $%d", len(args)))
+	}
+
+	where := whereClause(conditions)
+
+	var totalCount int
+	err := r.db.QueryRow(`SELECT COUNT(*) FROM security_alerts`+where, args...).Scan(&totalCount)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get count: %w", err)
+	}
+
+	query := `
+		SELECT id, user_id, alert_type, severity, description, metadata,
+		       ip_address, location_country, location_city,
+		       is_resolved, resolved_at, created_at, organization_id
+		FROM security_alerts` + where +
+		fmt.Sprintf(" ORDER BY created_at DESC LIMIT $%d OFFSET $%d", len(args)+1, len(args)+2)
+	args = append(args, limit, offset)
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to query security alerts: %w", err)
+	}
+	defer rows.Close()
+
+	var alerts []models.SecurityAlert
+	for rows.Next() {
+		var alert models.SecurityAlert
+		err := rows.Scan(
+			&alert.ID, &alert.UserID, &alert.AlertType, &alert.Severity,
+			&alert.Description, &alert.Metadata, &alert.IPAddress,
+			&alert.LocationCountry, &alert.LocationCity,
+			&alert.IsResolved, &alert.ResolvedAt, &alert.CreatedAt, &alert.OrganizationID,
+		)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to scan security alert: %w", err)
+		}
+		alerts = append(alerts, alert)
+	}
+
+	return alerts, totalCount, nil
+}
+
+// GetSecurityAlertByID retrieves a security alert by its ID
+func (r *AuditRepository) GetSecurityAlertByID(alertID string) (*models.SecurityAlert, error) {
+	query := `
+		SELECT id, user_id, alert_type, severity, description, metadata,
+		       ip_address, location_country, location_city,
+		       is_resolved, resolved_at, created_at, organization_id
+		FROM security_alerts
+		WHERE id = $1
+	`
+	
+	alert := &models.SecurityAlert{}
+	err := r.db.QueryRow(query, alertID).Scan(
+		&alert.ID, &alert.UserID, &alert.AlertType, &alert.Severity,
+		&alert.Description, &alert.Metadata, &alert.IPAddress,
+		&alert.LocationCountry, &alert.LocationCity,
+		&alert.IsResolved, &alert.ResolvedAt, &alert.CreatedAt, &alert.OrganizationID,
+	)
+	
+	if err == sql.ErrNoRows {
+		return nil, ErrSecurityAlertNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get security alert: %w", err)
+	}
+	
+	return alert, nil
+}
+
 // ResolveSecurityAlert marks a security alert as resolved
 func (r *AuditRepository) ResolveSecurityAlert(alertID string) error {
 	query := `
@@ -277,7 +567,7 @@ func (r *AuditRepository) ResolveSecurityAlert(alertID string) error {
 	}
 	
 	if rowsAffected == 0 {
-		return fmt.Errorf("security alert not found")
+		return ErrSecurityAlertNotFound
 	}
 	
 	return nil
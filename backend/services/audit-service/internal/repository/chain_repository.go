@@ -0,0 +1,268 @@
+package repository
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/aashiq-04/session-management-system/backend/services/audit-service/internal/models"
+)
+
+// GenesisHash is the prev_hash of the first entry in the audit chain
+const GenesisHash = "0000000000000000000000000000000000000000000000000000000000000000"
+
+// canonicalAuditLog fixes the field order and formatting hashed for each
+// chain entry. The personal data an erasure scrubs is committed to as a
+// separate hash, so a redaction can swap it without touching anything else.
+type canonicalAuditLog struct {
+	Sequence        int64   `json:"sequence"`
+	PrevHash        string  `json:"prev_hash"`
+	ID              string  `json:"id"`
+	UserID          *string `json:"user_id"`
+	SessionID       *string `json:"session_id"`
+	DeviceID        *string `json:"device_id"`
+	EventType       string  `json:"event_type"`
+	EventCategory   string  `json:"event_category"`
+	Severity        string  `json:"severity"`
+	LocationCountry *string `json:"location_country"`
+	Success         bool    `json:"success"`
+	FailureReason   *string `json:"failure_reason"`
+	CreatedAt       string  `json:"created_at"`
+	PersonalData    string  `json:"personal_data"` // PersonalDataHash of the entry
+}
+
+// canonicalPersonalData fixes the field order hashed for the personal data of an entry
+type canonicalPersonalData struct {
+	IPAddress    *string `json:"ip_address"`
+	UserAgent    *string `json:"user_agent"`
+	LocationCity *string `json:"location_city"`
+	Metadata     *string `json:"metadata"`
+}
+
+// AuditLogHash returns the hex SHA-256 of an entry's canonical contents, which
+// include its sequence and the previous entry's hash
+func AuditLogHash(log *models.AuditLog) string {
+	return AuditLogHashWithPersonalData(log, PersonalDataHash(log))
+}
+
+// AuditLogHashWithPersonalData returns the hash of an entry as if its
+// personal data hashed to personalDataHash. Verifying a redacted entry with
+// the hash of the personal data it held before shows nothing else changed.
+func AuditLogHashWithPersonalData(log *models.AuditLog, personalDataHash string) string {
+	canonical, _ := json.Marshal(canonicalAuditLog{
+		Sequence:        log.Sequence,
+		PrevHash:        log.PrevHash,
+		ID:              log.ID,
+		UserID:          log.UserID,
+		SessionID:       log.SessionID,
+		DeviceID:        log.DeviceID,
+		EventType:       log.EventType,
+		EventCategory:   log.EventCategory,
+		Severity:        log.Severity,
+		LocationCountry: log.LocationCountry,
+		Success:         log.Success,
+		FailureReason:   log.FailureReason,
+		// Postgres keeps microseconds, so that's all the hash covers
+		CreatedAt:    log.CreatedAt.UTC().Format("2006-01-02T15:04:05.000000Z"),
+		PersonalData: personalDataHash,
+	})
+
+	sum := sha256.Sum256(canonical)
+	return hex.EncodeToString(sum[:])
+}
+
+// PersonalDataHash returns the hex SHA-256 of the fields of an entry that an
+// erasure scrubs
+func PersonalDataHash(log *models.AuditLog) string {
+	canonical, _ := json.Marshal(canonicalPersonalData{
+		IPAddress:    log.IPAddress,
+		UserAgent:    log.UserAgent,
+		LocationCity: log.LocationCity,
+		Metadata:     log.Metadata,
+	})
+
+	sum := sha256.Sum256(canonical)
+	return hex.EncodeToString(sum[:])
+}
+
+// GetAuditChainHead returns the sequence and hash of the latest chain entry
+func (r *AuditRepository) GetAuditChainHead() (int64, string, error) {
+	var sequence int64
+	var entryHash string
+	err := r.db.QueryRow(`SELECT sequence, entry_hash FROM audit_chain_head`).Scan(&sequence, &entryHash)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to get audit chain head: %w", err)
+	}
+
+	return sequence, entryHash, nil
+}
+
+// GetAuditChainBounds returns the lowest and highest sequence of the entries
+// created within the time range, or zeros if there are none
+func (r *AuditRepository) GetAuditChainBounds(startTime, endTime time.Time) (int64, int64, error) {
+	var first, last sql.NullInt64
+	err := r.db.QueryRow(`
+		SELECT MIN(sequence), MAX(sequence)
+		FROM audit_logs
+		WHERE created_at >= $1 AND created_at <= $2
+	`, startTime, endTime).Scan(&first, &last)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to get audit chain bounds: %w", err)
+	}
+
+	return first.Int64, last.Int64, nil
+}
+
+// GetLastAuditLogSequence returns the highest sequence stored in audit_logs
+func (r *AuditRepository) GetLastAuditLogSequence() (int64, error) {
+	var last sql.NullInt64
+	err := r.db.QueryRow(`SELECT MAX(sequence) FROM audit_logs`).Scan(&last)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get last audit log sequence: %w", err)
+	}
+
+	return last.Int64, nil
+}
+
+// GetAuditLogBySequence retrieves the chain entry at a sequence, or nil if it doesn't exist
+func (r *AuditRepository) GetAuditLogBySequence(sequence int64) (*models.AuditLog, error) {
+	logs, err := r.getAuditChainEntries(sequence, sequence, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(logs) == 0 {
+		return nil, nil
+	}
+
+	return &logs[0], nil
+}
+
+// WalkAuditChain calls fn for every stored entry between two sequences, in chain
+// order, stopping at the first error fn returns
+func (r *AuditRepository) WalkAuditChain(fromSequence, toSequence int64, fn func(log *models.AuditLog) error) error {
+	const batchSize = 1000
+
+	next := fromSequence
+	for next <= toSequence {
+		logs, err := r.getAuditChainEntries(next, toSequence, batchSize)
+		if err != nil {
+			return err
+		}
+		if len(logs) == 0 {
+			return nil
+		}
+
+		for i := range logs {
+			if err := fn(&logs[i]); err != nil {
+				return err
+			}
+		}
+
+		next = logs[len(logs)-1].Sequence + 1
+	}
+
+	return nil
+}
+
+func (r *AuditRepository) getAuditChainEntries(fromSequence, toSequence int64, limit int) ([]models.AuditLog, error) {
+	rows, err := r.db.Query(`
+		SELECT id, user_id, session_id, device_id, event_type, event_category,
+		       severity, ip_address, user_agent, location_country, location_city,
+		       metadata, success, failure_reason, created_at,
+		       sequence, prev_hash, entry_hash
+		FROM audit_logs
+		WHERE sequence >= $1 AND sequence <= $2
+		ORDER BY sequence
+		LIMIT $3
+	`, fromSequence, toSequence, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get audit chain entries: %w", err)
+	}
+	defer rows.Close()
+
+	var logs []models.AuditLog
+	for rows.Next() {
+		var log models.AuditLog
+		err := rows.Scan(
+			&log.ID, &log.UserID, &log.SessionID, &log.DeviceID,
+			&log.EventType, &log.EventCategory, &log.Severity,
+			&log.IPAddress, &log.UserAgent, &log.LocationCountry, &log.LocationCity,
+			&log.Metadata, &log.Success, &log.FailureReason, &log.CreatedAt,
+			&log.Sequence, &log.PrevHash, &log.EntryHash,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan audit chain entry: %w", err)
+		}
+		logs = append(logs, log)
+	}
+
+	return logs, rows.Err()
+}
+
+// CreateAuditChainCheckpoint stores a signed checkpoint
+func (r *AuditRepository) CreateAuditChainCheckpoint(checkpoint *models.AuditChainCheckpoint) error {
+	_, err := r.db.Exec(`
+		INSERT INTO audit_chain_checkpoints (id, sequence, entry_hash, key_id, signature, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, checkpoint.ID, checkpoint.Sequence, checkpoint.EntryHash, checkpoint.KeyID, checkpoint.Signature, checkpoint.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create audit chain checkpoint: %w", err)
+	}
+
+	return nil
+}
+
+// GetLatestAuditChainCheckpoint returns the checkpoint with the highest sequence, or nil if there are none
+func (r *AuditRepository) GetLatestAuditChainCheckpoint() (*models.AuditChainCheckpoint, error) {
+	checkpoint := &models.AuditChainCheckpoint{}
+	err := r.db.QueryRow(`
+		SELECT id, sequence, entry_hash, key_id, signature, created_at
+		FROM audit_chain_checkpoints
+		ORDER BY sequence DESC, created_at DESC
+		LIMIT 1
+	`).Scan(
+		&checkpoint.ID, &checkpoint.Sequence, &checkpoint.EntryHash,
+		&checkpoint.KeyID, &checkpoint.Signature, &checkpoint.CreatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latest audit chain checkpoint: %w", err)
+	}
+
+	return checkpoint, nil
+}
+
+// GetAuditChainCheckpoints returns the checkpoints taken between two sequences
+func (r *AuditRepository) GetAuditChainCheckpoints(fromSequence, toSequence int64) ([]models.AuditChainCheckpoint, error) {
+	rows, err := r.db.Query(`
+		SELECT id, sequence, entry_hash, key_id, signature, created_at
+		FROM audit_chain_checkpoints
+		WHERE sequence >= $1 AND sequence <= $2
+		ORDER BY sequence, created_at
+	`, fromSequence, toSequence)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get audit chain checkpoints: %w", err)
+	}
+	defer rows.Close()
+
+	var checkpoints []models.AuditChainCheckpoint
+	for rows.Next() {
+		var checkpoint models.AuditChainCheckpoint
+		err := rows.Scan(
+			&checkpoint.ID, &checkpoint.Sequence, &checkpoint.EntryHash,
+			&checkpoint.KeyID, &checkpoint.Signature, &checkpoint.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan audit chain checkpoint: %w", err)
+		}
+		checkpoints = append(checkpoints, checkpoint)
+	}
+
+	return checkpoints, rows.Err()
+}
@@ -0,0 +1,187 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"net/netip"
+
+	"github.com/aashiq-04/session-management-system/backend/services/audit-service/internal/models"
+)
+
+// AnonymizeUserAuditLogs erases a user's personal data from the audit trail.
+// The IP addresses of their entries are pseudonymized and the user agent,
+// city and metadata cleared, the hash of the personal data each entry held is
+// recorded as a redaction so the chain still verifies, and entries recorded for them later are scrubbed
+// before they are chained. Their security alerts lose the same details. It
+// returns how many entries were redacted; erasing a user twice redacts
+// nothing new.
+func (r *AuditRepository) AnonymizeUserAuditLogs(userID, erasedBy string) (int, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Holding the chain head keeps writers out until the erasure is visible,
+	// so no entry for the user is chained unscrubbed in between
+	if _, err := tx.Exec(`SELECT 1 FROM audit_chain_head FOR UPDATE`); err != nil {
+		return 0, fmt.Errorf("failed to lock audit chain head: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO audit_log_erasures (user_id, erased_by)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO NOTHING
+	`, userID, erasedBy)
+	if err != nil {
+		return 0, fmt.Errorf("failed to record audit log erasure: %w", err)
+	}
+
+	rows, err := tx.Query(`
+		SELECT id, user_id, session_id, device_id, event_type, event_category,
+		       severity, ip_address, user_agent, location_country, location_city,
+		       metadata, success, failure_reason, created_at,
+		       sequence, prev_hash, entry_hash
+		FROM audit_logs
+		WHERE user_id = $1
+		  AND (ip_address <> pseudonymize_ip(ip_address) OR user_agent IS NOT NULL
+		       OR location_city IS NOT NULL OR metadata IS NOT NULL)
+		ORDER BY sequence
+	`, userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query audit logs: %w", err)
+	}
+
+	var logs []models.AuditLog
+	for rows.Next() {
+		var log models.AuditLog
+		err := rows.Scan(
+			&log.ID, &log.UserID, &log.SessionID, &log.DeviceID,
+			&log.EventType, &log.EventCategory, &log.Severity,
+			&log.IPAddress, &log.UserAgent, &log.LocationCountry, &log.LocationCity,
+			&log.Metadata, &log.Success, &log.FailureReason, &log.CreatedAt,
+			&log.Sequence, &log.PrevHash, &log.EntryHash,
+		)
+		if err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan audit log: %w", err)
+		}
+		logs = append(logs, log)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to query audit logs: %w", err)
+	}
+
+	// The append-only trigger lets this transaction scrub personal data
+	if _, err := tx.Exec(`SET LOCAL audit.redacting = 'on'`); err != nil {
+		return 0, fmt.Errorf("failed to enable redaction: %w", err)
+	}
+
+	for i := range logs {
+		log := &logs[i]
+		personalDataHash := PersonalDataHash(log)
+		ScrubAuditLog(log)
+
+		_, err := tx.Exec(`
+			UPDATE audit_logs
+			SET ip_address = $1, user_agent = NULL, location_city = NULL, metadata = NULL
+			WHERE id = $2 AND created_at = $3
+		`, log.IPAddress, log.ID, log.CreatedAt)
+		if err != nil {
+			return 0, fmt.Errorf("failed to redact audit log: %w", err)
+		}
+
+		_, err = tx.Exec(`
+			INSERT INTO audit_log_redactions (sequence, audit_log_id, personal_data_hash)
+			VALUES ($1, $2, $3)
+		`, log.Sequence, log.ID, personalDataHash)
+		if err != nil {
+			return 0, fmt.Errorf("failed to record audit log redaction: %w", err)
+		}
+	}
+
+	_, err = tx.Exec(`
+		UPDATE security_alerts
+		SET ip_address = pseudonymize_ip(ip_address), location_city = NULL, metadata = NULL
+		WHERE user_id = $1
+	`, userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to anonymize security alerts: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit audit log erasure: %w", err)
+	}
+
+	return len(logs), nil
+}
+
+// ScrubAuditLog removes the personal data of an entry. The IP address is
+// pseudonymized and the country kept, so erased entries still show roughly
+// where activity came from.
+func ScrubAuditLog(log *models.AuditLog) {
+	if log.IPAddress != nil {
+		ip := PseudonymizeIP(*log.IPAddress)
+		log.IPAddress = &ip
+	}
+	log.UserAgent = nil
+	log.LocationCity = nil
+	log.Metadata = nil
+}
+
+// IsScrubbed reports whether an entry holds no personal data. Entries erased
+// before IP addresses were pseudonymized have no IP address or country.
+func IsScrubbed(log *models.AuditLog) bool {
+	if log.IPAddress != nil && PseudonymizeIP(*log.IPAddress) != *log.IPAddress {
+		return false
+	}
+	return log.UserAgent == nil && log.LocationCity == nil && log.Metadata == nil
+}
+
+// PseudonymizeIP keeps only the network of an IP address: the first 24 bits
+// of an IPv4 address or 48 bits of an IPv6 one, as the database's
+// pseudonymize_ip does. Anything that isn't an address is returned as is.
+func PseudonymizeIP(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ip
+	}
+
+	bits := 48
+	if addr.Is4() {
+		bits = 24
+	}
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		return ip
+	}
+	return prefix.Addr().String()
+}
+
+// GetAuditLogRedaction returns the hash of the personal data the entry at a
+// sequence held before it was redacted, or "" if it wasn't redacted
+func (r *AuditRepository) GetAuditLogRedaction(sequence int64) (string, error) {
+	var personalDataHash string
+	err := r.db.QueryRow(`SELECT personal_data_hash FROM audit_log_redactions WHERE sequence = $1`, sequence).Scan(&personalDataHash)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get audit log redaction: %w", err)
+	}
+
+	return personalDataHash, nil
+}
+
+// isErased reports whether a user's personal data has been erased from the
+// audit trail
+func isErased(tx *sql.Tx, userID string) (bool, error) {
+	var erased bool
+	err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM audit_log_erasures WHERE user_id = $1)`, userID).Scan(&erased)
+	if err != nil {
+		return false, fmt.Errorf("failed to look up audit log erasure: %w", err)
+	}
+
+	return erased, nil
+}
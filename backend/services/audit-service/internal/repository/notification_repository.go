@@ -0,0 +1,254 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/aashiq-04/session-management-system/backend/services/audit-service/internal/models"
+)
+
+// NotificationRepository handles database operations for security alert notifications
+type NotificationRepository struct {
+	db *sql.DB
+}
+
+// NewNotificationRepository creates a new notification repository
+func NewNotificationRepository(db *sql.DB) *NotificationRepository {
+	return &NotificationRepository{db: db}
+}
+
+// GetNotificationPreferences retrieves a user's notification preferences
+// Returns nil if the user has never saved any
+func (r *NotificationRepository) GetNotificationPreferences(userID string) (*models.NotificationPreferences, error) {
+	query := `
+		SELECT user_id, email_enabled, webhook_enabled, webhook_url, webhook_secret,
+		       min_severity, created_at, updated_at
+		FROM notification_preferences
+		WHERE user_id = $1
+	`
+
+	prefs := &models.NotificationPreferences{}
+	err := r.db.QueryRow(query, userID).Scan(
+		&prefs.UserID,
+		&prefs.EmailEnabled,
+		&prefs.WebhookEnabled,
+		&prefs.WebhookURL,
+		&prefs.WebhookSecret,
+		&prefs.MinSeverity,
+		&prefs.CreatedAt,
+		&prefs.UpdatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get notification preferences: %w", err)
+	}
+
+	return prefs, nil
+}
+
+// UpsertNotificationPreferences creates or replaces a user's notification preferences
+func (r *NotificationRepository) UpsertNotificationPreferences(prefs *models.NotificationPreferences) error {
+	query := `
+		INSERT INTO notification_preferences (user_id, email_enabled, webhook_enabled,
+		                                      webhook_url, webhook_secret, min_severity)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (user_id) DO UPDATE
+		SET email_enabled = EXCLUDED.email_enabled,
+		    webhook_enabled = EXCLUDED.webhook_enabled,
+		    webhook_url = EXCLUDED.webhook_url,
+		    webhook_secret = EXCLUDED.webhook_secret,
+		    min_severity = EXCLUDED.min_severity
+		RETURNING created_at, updated_at
+	`
+
+	err := r.db.QueryRow(
+		query,
+		prefs.UserID,
+		prefs.EmailEnabled,
+		prefs.WebhookEnabled,
+		prefs.WebhookURL,
+		prefs.WebhookSecret,
+		prefs.MinSeverity,
+	).Scan(&prefs.CreatedAt, &prefs.UpdatedAt)
+
+	if err != nil {
+		return fmt.Errorf("failed to save notification preferences: %w", err)
+	}
+
+	return nil
+}
+
+// QueueAlertNotifications picks up security alerts created since the given time
+// that have not been notified yet, asks plan which deliveries each one needs and
+// stores them, marking the alerts as notified in the same transaction.
+// Locked rows are skipped so several audit service instances can run this concurrently.
+func (r *NotificationRepository) QueueAlertNotifications(since time.Time, limit int, plan func(*models.AlertRecipient) []models.NotificationDelivery) (int, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		SELECT a.id, a.user_id, a.alert_type, a.severity, a.description, a.metadata,
+		       a.ip_address, a.location_country, a.location_city,
+		       a.is_resolved, a.resolved_at, a.created_at,
+		       u.email,
+		       COALESCE(p.email_enabled, true), COALESCE(p.webhook_enabled, false),
+		       p.webhook_url, p.webhook_secret, p.min_severity
+		FROM security_alerts a
+		JOIN users u ON u.id = a.user_id
+		LEFT JOIN notification_preferences p ON p.user_id = a.user_id
+		WHERE a.notified_at IS NULL AND a.created_at >= $1
+		ORDER BY a.created_at
+		LIMIT $2
+		FOR UPDATE OF a SKIP LOCKED
+	`
+
+	rows, err := tx.Query(query, since, limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query pending alerts: %w", err)
+	}
+
+	var recipients []models.AlertRecipient
+	for rows.Next() {
+		var rcpt models.AlertRecipient
+		err := rows.Scan(
+			&rcpt.Alert.ID, &rcpt.Alert.UserID, &rcpt.Alert.AlertType, &rcpt.Alert.Severity,
+			&rcpt.Alert.Description, &rcpt.Alert.Metadata, &rcpt.Alert.IPAddress,
+			&rcpt.Alert.LocationCountry, &rcpt.Alert.LocationCity,
+			&rcpt.Alert.IsResolved, &rcpt.Alert.ResolvedAt, &rcpt.Alert.CreatedAt,
+			&rcpt.Email,
+			&rcpt.Preferences.EmailEnabled, &rcpt.Preferences.WebhookEnabled,
+			&rcpt.Preferences.WebhookURL, &rcpt.Preferences.WebhookSecret, &rcpt.Preferences.MinSeverity,
+		)
+		if err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan pending alert: %w", err)
+		}
+		rcpt.Preferences.UserID = rcpt.Alert.UserID
+		recipients = append(recipients, rcpt)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to read pending alerts: %w", err)
+	}
+
+	insertQuery := `
+		INSERT INTO notification_deliveries (id, alert_id, user_id, channel, recipient,
+		                                     status, attempts, next_attempt_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, 'pending', 0, $6, $6)
+	`
+
+	now := time.Now()
+	for i := range recipients {
+		for _, delivery := range plan(&recipients[i]) {
+			_, err := tx.Exec(
+				insertQuery,
+				uuid.New().String(),
+				recipients[i].Alert.ID,
+				recipients[i].Alert.UserID,
+				delivery.Channel,
+				delivery.Recipient,
+				now,
+			)
+			if err != nil {
+				return 0, fmt.Errorf("failed to queue notification: %w", err)
+			}
+		}
+
+		_, err := tx.Exec(`UPDATE security_alerts SET notified_at = $1 WHERE id = $2`, now, recipients[i].Alert.ID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to mark alert as notified: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return len(recipients), nil
+}
+
+// ClaimDueDeliveries returns pending deliveries whose next attempt is due and
+// pushes their next attempt out by lease, so another instance won't pick them
+// up while they are being sent
+func (r *NotificationRepository) ClaimDueDeliveries(limit int, lease time.Duration) ([]models.NotificationDelivery, error) {
+	query := `
+		UPDATE notification_deliveries
+		SET next_attempt_at = $1
+		WHERE id IN (
+			SELECT id FROM notification_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= $2
+			ORDER BY next_attempt_at
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, alert_id, user_id, channel, recipient, status, attempts,
+		          last_error, next_attempt_at, sent_at, created_at
+	`
+
+	now := time.Now()
+	rows, err := r.db.Query(query, now.Add(lease), now, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim notification deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var deliveries []models.NotificationDelivery
+	for rows.Next() {
+		var d models.NotificationDelivery
+		err := rows.Scan(
+			&d.ID, &d.AlertID, &d.UserID, &d.Channel, &d.Recipient, &d.Status,
+			&d.Attempts, &d.LastError, &d.NextAttemptAt, &d.SentAt, &d.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan notification delivery: %w", err)
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	return deliveries, nil
+}
+
+// MarkDeliverySent records a successful delivery attempt
+func (r *NotificationRepository) MarkDeliverySent(deliveryID string) error {
+	query := `
+		UPDATE notification_deliveries
+		SET status = 'sent', attempts = attempts + 1, last_error = NULL, sent_at = $1
+		WHERE id = $2
+	`
+
+	_, err := r.db.Exec(query, time.Now(), deliveryID)
+	if err != nil {
+		return fmt.Errorf("failed to mark delivery as sent: %w", err)
+	}
+
+	return nil
+}
+
+// MarkDeliveryFailed records a failed delivery attempt. The delivery is retried
+// at nextAttemptAt, or given up on for good when nextAttemptAt is nil
+func (r *NotificationRepository) MarkDeliveryFailed(deliveryID string, lastError string, nextAttemptAt *time.Time) error {
+	query := `
+		UPDATE notification_deliveries
+		SET attempts = attempts + 1,
+		    last_error = $1,
+		    status = CASE WHEN $2::timestamptz IS NULL THEN 'failed' ELSE 'pending' END,
+		    next_attempt_at = COALESCE($2, next_attempt_at)
+		WHERE id = $3
+	`
+
+	_, err := r.db.Exec(query, lastError, nextAttemptAt, deliveryID)
+	if err != nil {
+		return fmt.Errorf("failed to mark delivery as failed: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,179 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/aashiq-04/session-management-system/backend/services/audit-service/internal/models"
+)
+
+// AuditLogPartitionName returns the name of the monthly audit_logs partition
+// starting at month, e.g. audit_logs_y2026m01
+func AuditLogPartitionName(month time.Time) string {
+	return fmt.Sprintf("audit_logs_y%04dm%02d", month.Year(), int(month.Month()))
+}
+
+// ListAuditLogPartitions returns the names of the partitions attached to audit_logs
+func (r *AuditRepository) ListAuditLogPartitions() ([]string, error) {
+	rows, err := r.db.Query(`
+		SELECT c.relname
+		FROM pg_inherits i
+		JOIN pg_class c ON c.oid = i.inhrelid
+		WHERE i.inhparent = 'audit_logs'::regclass
+		ORDER BY c.relname
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit log partitions: %w", err)
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("failed to scan audit log partition: %w", err)
+		}
+		names = append(names, name)
+	}
+
+	return names, rows.Err()
+}
+
+// CreateAuditLogPartition creates the partition for the month starting at
+// month (UTC), if it doesn't exist yet
+func (r *AuditRepository) CreateAuditLogPartition(month time.Time) error {
+	const bound = "2006-01-02 15:04:05+00"
+	from := month.UTC()
+	to := from.AddDate(0, 1, 0)
+
+	// DDL can't take parameters; the name and bounds are generated, not user input
+	_, err := r.db.Exec(fmt.Sprintf(
+		`CREATE TABLE IF NOT EXISTS %s PARTITION OF audit_logs FOR VALUES FROM (%s) TO (%s)`,
+		pq.QuoteIdentifier(AuditLogPartitionName(from)),
+		pq.QuoteLiteral(from.Format(bound)),
+		pq.QuoteLiteral(to.Format(bound)),
+	))
+	if err != nil {
+		return fmt.Errorf("failed to create audit log partition: %w", err)
+	}
+
+	return nil
+}
+
+// ExpireAuditLogPartition detaches a partition from audit_logs, and drops it
+// if drop is set, returning how many rows it held. Before the partition goes,
+// each run of consecutive entries in it is kept as a tombstone signed by sign,
+// so verification can bridge the gap it leaves in the chain.
+func (r *AuditRepository) ExpireAuditLogPartition(name string, drop bool, sign func(*models.AuditLogTombstone)) (int64, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	partition := pq.QuoteIdentifier(name)
+
+	// Keep late writes out while the tombstones are computed
+	if _, err := tx.Exec(`LOCK TABLE ` + partition + ` IN ACCESS EXCLUSIVE MODE`); err != nil {
+		return 0, fmt.Errorf("failed to lock audit log partition: %w", err)
+	}
+
+	// Sequences minus their row number are constant within a run
+	rows, err := tx.Query(`
+		SELECT MIN(sequence), MAX(sequence), (array_agg(entry_hash ORDER BY sequence DESC))[1]
+		FROM (
+			SELECT sequence, entry_hash, sequence - ROW_NUMBER() OVER (ORDER BY sequence) AS run
+			FROM ` + partition + `
+		) p
+		GROUP BY run
+		ORDER BY 1
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get audit log partition runs: %w", err)
+	}
+	var tombstones []models.AuditLogTombstone
+	for rows.Next() {
+		tombstone := models.AuditLogTombstone{PartitionName: name}
+		if err := rows.Scan(&tombstone.FirstSequence, &tombstone.Sequence, &tombstone.EntryHash); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan audit log partition run: %w", err)
+		}
+		tombstones = append(tombstones, tombstone)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to get audit log partition runs: %w", err)
+	}
+
+	for i := range tombstones {
+		sign(&tombstones[i])
+		_, err = tx.Exec(`
+			INSERT INTO audit_log_tombstones (first_sequence, sequence, entry_hash, partition_name, key_id, signature)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			ON CONFLICT (sequence) DO NOTHING
+		`, tombstones[i].FirstSequence, tombstones[i].Sequence, tombstones[i].EntryHash,
+			tombstones[i].PartitionName, tombstones[i].KeyID, tombstones[i].Signature)
+		if err != nil {
+			return 0, fmt.Errorf("failed to record audit log tombstone: %w", err)
+		}
+	}
+
+	var count int64
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM ` + partition).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count audit log partition: %w", err)
+	}
+
+	if _, err := tx.Exec(`ALTER TABLE audit_logs DETACH PARTITION ` + partition); err != nil {
+		return 0, fmt.Errorf("failed to detach audit log partition: %w", err)
+	}
+	if drop {
+		if _, err := tx.Exec(`DROP TABLE ` + partition); err != nil {
+			return 0, fmt.Errorf("failed to drop audit log partition: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit partition expiry: %w", err)
+	}
+
+	return count, nil
+}
+
+// HasDefaultPartitionRows reports whether any audit logs fell outside the monthly partitions
+func (r *AuditRepository) HasDefaultPartitionRows() (bool, error) {
+	var exists bool
+	err := r.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM audit_logs_default)`).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to check default audit log partition: %w", err)
+	}
+
+	return exists, nil
+}
+
+// GetAuditLogTombstone returns the tombstone of the run of entries dropped by
+// retention that ends at sequence, or nil if there is none. Tombstones
+// recorded before they were signed come back without a signature.
+func (r *AuditRepository) GetAuditLogTombstone(sequence int64) (*models.AuditLogTombstone, error) {
+	var tombstone models.AuditLogTombstone
+	var firstSequence sql.NullInt64
+	var keyID, signature sql.NullString
+	err := r.db.QueryRow(`
+		SELECT first_sequence, sequence, entry_hash, partition_name, key_id, signature
+		FROM audit_log_tombstones
+		WHERE sequence = $1
+	`, sequence).Scan(&firstSequence, &tombstone.Sequence, &tombstone.EntryHash, &tombstone.PartitionName, &keyID, &signature)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get audit log tombstone: %w", err)
+	}
+
+	tombstone.FirstSequence = firstSequence.Int64
+	tombstone.KeyID = keyID.String
+	tombstone.Signature = signature.String
+	return &tombstone, nil
+}
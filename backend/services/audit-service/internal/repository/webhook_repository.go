@@ -0,0 +1,448 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+
+	"github.com/aashiq-04/session-management-system/backend/services/audit-service/internal/models"
+)
+
+// ErrWebhookSubscriptionNotFound is returned when a subscription doesn't exist
+var ErrWebhookSubscriptionNotFound = errors.New("webhook subscription not found")
+
+// WebhookRepository handles database operations for audit event webhooks
+type WebhookRepository struct {
+	db *sql.DB
+}
+
+// NewWebhookRepository creates a new webhook repository
+func NewWebhookRepository(db *sql.DB) *WebhookRepository {
+	return &WebhookRepository{db: db}
+}
+
+const webhookSubscriptionColumns = `
+	id, user_id, url, secret, event_types, event_categories,
+	min_severity, description, is_active, created_at, updated_at
+`
+
+func scanWebhookSubscription(row interface{ Scan(...interface{}) error }, sub *models.WebhookSubscription) error {
+	return row.Scan(
+		&sub.ID, &sub.UserID, &sub.URL, &sub.Secret,
+		pq.Array(&sub.EventTypes), pq.Array(&sub.EventCategories),
+		&sub.MinSeverity, &sub.Description, &sub.IsActive,
+		&sub.CreatedAt, &sub.UpdatedAt,
+	)
+}
+
+// emptyIfNil stores an unset filter as an empty array, which matches everything
+func emptyIfNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
+
+// CreateWebhookSubscription creates a new webhook subscription
+func (r *WebhookRepository) CreateWebhookSubscription(sub *models.WebhookSubscription) error {
+	query := `
+		INSERT INTO webhook_subscriptions (id, user_id, url, secret, event_types, event_categories,
+		                                   min_severity, description, is_active)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING created_at, updated_at
+	`
+
+	err := r.db.QueryRow(
+		query,
+		sub.ID,
+		sub.UserID,
+		sub.URL,
+		sub.Secret,
+		pq.Array(emptyIfNil(sub.EventTypes)),
+		pq.Array(emptyIfNil(sub.EventCategories)),
+		sub.MinSeverity,
+		sub.Description,
+		sub.IsActive,
+	).Scan(&sub.CreatedAt, &sub.UpdatedAt)
+
+	if err != nil {
+		return fmt.Errorf("failed to create webhook subscription: %w", err)
+	}
+
+	return nil
+}
+
+// GetWebhookSubscription retrieves a webhook subscription by ID
+func (r *WebhookRepository) GetWebhookSubscription(subscriptionID string) (*models.WebhookSubscription, error) {
+	query := `SELECT ` + webhookSubscriptionColumns + ` FROM webhook_subscriptions WHERE id = $1`
+
+	sub := &models.WebhookSubscription{}
+	err := scanWebhookSubscription(r.db.QueryRow(query, subscriptionID), sub)
+	if err == sql.ErrNoRows {
+		return nil, ErrWebhookSubscriptionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook subscription: %w", err)
+	}
+
+	return sub, nil
+}
+
+// ListWebhookSubscriptions retrieves a user's webhook subscriptions,
+// or the system-wide ones when userID is nil
+func (r *WebhookRepository) ListWebhookSubscriptions(userID *string) ([]models.WebhookSubscription, error) {
+	query := `SELECT ` + webhookSubscriptionColumns + ` FROM webhook_subscriptions`
+
+	var args []interface{}
+	if userID != nil {
+		query += ` WHERE user_id = $1`
+		args = append(args, *userID)
+	} else {
+		query += ` WHERE user_id IS NULL`
+	}
+	query += ` ORDER BY created_at DESC`
+
+	return r.querySubscriptions(query, args...)
+}
+
+// GetActiveWebhookSubscriptions retrieves every active webhook subscription
+func (r *WebhookRepository) GetActiveWebhookSubscriptions() ([]models.WebhookSubscription, error) {
+	query := `SELECT ` + webhookSubscriptionColumns + ` FROM webhook_subscriptions WHERE is_active = true`
+
+	return r.querySubscriptions(query)
+}
+
+func (r *WebhookRepository) querySubscriptions(query string, args ...interface{}) ([]models.WebhookSubscription, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query webhook subscriptions: %w", err)
+	}
+	defer rows.Close()
+
+	var subs []models.WebhookSubscription
+	for rows.Next() {
+		var sub models.WebhookSubscription
+		if err := scanWebhookSubscription(rows, &sub); err != nil {
+			return nil, fmt.Errorf("failed to scan webhook subscription: %w", err)
+		}
+		subs = append(subs, sub)
+	}
+
+	return subs, nil
+}
+
+// UpdateWebhookSubscription saves changes to a webhook subscription
+func (r *WebhookRepository) UpdateWebhookSubscription(sub *models.WebhookSubscription) error {
+	query := `
+		UPDATE webhook_subscriptions
+		SET url = $1, secret = $2, event_types = $3, event_categories = $4,
+		    min_severity = $5, description = $6, is_active = $7
+		WHERE id = $8
+		RETURNING updated_at
+	`
+
+	err := r.db.QueryRow(
+		query,
+		sub.URL,
+		sub.Secret,
+		pq.Array(emptyIfNil(sub.EventTypes)),
+		pq.Array(emptyIfNil(sub.EventCategories)),
+		sub.MinSeverity,
+		sub.Description,
+		sub.IsActive,
+		sub.ID,
+	).Scan(&sub.UpdatedAt)
+
+	if err == sql.ErrNoRows {
+		return ErrWebhookSubscriptionNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update webhook subscription: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteWebhookSubscription deletes a webhook subscription and its deliveries
+func (r *WebhookRepository) DeleteWebhookSubscription(subscriptionID string) error {
+	result, err := r.db.Exec(`DELETE FROM webhook_subscriptions WHERE id = $1`, subscriptionID)
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook subscription: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrWebhookSubscriptionNotFound
+	}
+
+	return nil
+}
+
+// DrainAuditEventOutbox takes audit events off the outbox, asks match which
+// subscriptions want each one and queues a delivery per subscription, all in
+// one transaction. Locked rows are skipped so several audit service instances
+// can drain concurrently.
+func (r *WebhookRepository) DrainAuditEventOutbox(limit int, match func(*models.AuditLog) []string) (int, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		SELECT o.id, l.id, l.user_id, l.session_id, l.device_id, l.event_type, l.event_category,
+		       l.severity, l.ip_address, l.user_agent, l.location_country, l.location_city,
+		       l.metadata, l.success, l.failure_reason, l.created_at
+		FROM audit_event_outbox o
+		LEFT JOIN audit_logs l ON l.id = o.audit_log_id
+		ORDER BY o.id
+		LIMIT $1
+		FOR UPDATE OF o SKIP LOCKED
+	`
+
+	rows, err := tx.Query(query, limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query audit event outbox: %w", err)
+	}
+
+	var outboxIDs []int64
+	var logs []*models.AuditLog
+	for rows.Next() {
+		var outboxID int64
+		var logID, eventType, eventCategory, severity sql.NullString
+		var success sql.NullBool
+		var createdAt sql.NullTime
+		log := &models.AuditLog{}
+
+		err := rows.Scan(
+			&outboxID, &logID, &log.UserID, &log.SessionID, &log.DeviceID,
+			&eventType, &eventCategory, &severity,
+			&log.IPAddress, &log.UserAgent, &log.LocationCountry, &log.LocationCity,
+			&log.Metadata, &success, &log.FailureReason, &createdAt,
+		)
+		if err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan audit event: %w", err)
+		}
+
+		outboxIDs = append(outboxIDs, outboxID)
+
+		// The audit log may have been removed since it was queued; just drop it
+		if !logID.Valid {
+			continue
+		}
+
+		log.ID = logID.String
+		log.EventType = eventType.String
+		log.EventCategory = eventCategory.String
+		log.Severity = severity.String
+		log.Success = success.Bool
+		log.CreatedAt = createdAt.Time
+		logs = append(logs, log)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to read audit event outbox: %w", err)
+	}
+
+	insertQuery := `
+		INSERT INTO webhook_deliveries (id, subscription_id, audit_log_id, status, attempts,
+		                                next_attempt_at, created_at)
+		VALUES ($1, $2, $3, 'pending', 0, $4, $4)
+	`
+
+	now := time.Now()
+	for _, log := range logs {
+		for _, subscriptionID := range match(log) {
+			_, err := tx.Exec(insertQuery, uuid.New().String(), subscriptionID, log.ID, now)
+			if err != nil {
+				return 0, fmt.Errorf("failed to queue webhook delivery: %w", err)
+			}
+		}
+	}
+
+	if len(outboxIDs) > 0 {
+		_, err := tx.Exec(`DELETE FROM audit_event_outbox WHERE id = ANY($1)`, pq.Array(outboxIDs))
+		if err != nil {
+			return 0, fmt.Errorf("failed to clear audit event outbox: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return len(outboxIDs), nil
+}
+
+// ClaimDueWebhookDeliveries returns pending deliveries whose next attempt is
+// due and pushes their next attempt out by lease, so another instance won't
+// pick them up while they are being sent
+func (r *WebhookRepository) ClaimDueWebhookDeliveries(limit int, lease time.Duration) ([]models.WebhookDelivery, error) {
+	query := `
+		UPDATE webhook_deliveries
+		SET next_attempt_at = $1
+		WHERE id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= $2
+			ORDER BY next_attempt_at
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, subscription_id, audit_log_id, status, attempts, last_error,
+		          response_status, next_attempt_at, delivered_at, created_at
+	`
+
+	now := time.Now()
+	rows, err := r.db.Query(query, now.Add(lease), now, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var deliveries []models.WebhookDelivery
+	for rows.Next() {
+		var d models.WebhookDelivery
+		err := rows.Scan(
+			&d.ID, &d.SubscriptionID, &d.AuditLogID, &d.Status, &d.Attempts, &d.LastError,
+			&d.ResponseStatus, &d.NextAttemptAt, &d.DeliveredAt, &d.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery: %w", err)
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	return deliveries, nil
+}
+
+// MarkWebhookDelivered records a successful delivery
+func (r *WebhookRepository) MarkWebhookDelivered(deliveryID string, responseStatus int) error {
+	query := `
+		UPDATE webhook_deliveries
+		SET status = 'delivered', attempts = attempts + 1, last_error = NULL,
+		    response_status = $1, delivered_at = $2
+		WHERE id = $3
+	`
+
+	_, err := r.db.Exec(query, responseStatus, time.Now(), deliveryID)
+	if err != nil {
+		return fmt.Errorf("failed to mark webhook delivery as delivered: %w", err)
+	}
+
+	return nil
+}
+
+// MarkWebhookDeliveryFailed records a failed delivery attempt. The delivery is
+// retried at nextAttemptAt, or dead-lettered when nextAttemptAt is nil
+func (r *WebhookRepository) MarkWebhookDeliveryFailed(deliveryID string, lastError string, responseStatus *int, nextAttemptAt *time.Time) error {
+	query := `
+		UPDATE webhook_deliveries
+		SET attempts = attempts + 1,
+		    last_error = $1,
+		    response_status = $2,
+		    status = CASE WHEN $3::timestamptz IS NULL THEN 'dead' ELSE 'pending' END,
+		    next_attempt_at = COALESCE($3, next_attempt_at)
+		WHERE id = $4
+	`
+
+	_, err := r.db.Exec(query, lastError, responseStatus, nextAttemptAt, deliveryID)
+	if err != nil {
+		return fmt.Errorf("failed to mark webhook delivery as failed: %w", err)
+	}
+
+	return nil
+}
+
+// ListWebhookDeliveries retrieves deliveries for a subscription, newest first
+func (r *WebhookRepository) ListWebhookDeliveries(subscriptionID, status string, limit, offset int) ([]models.WebhookDelivery, int, error) {
+	query := `
+		SELECT d.id, d.subscription_id, d.audit_log_id, COALESCE(l.event_type, ''),
+		       d.status, d.attempts, d.last_error, d.response_status,
+		       d.next_attempt_at, d.delivered_at, d.created_at
+		FROM webhook_deliveries d
+		LEFT JOIN audit_logs l ON l.id = d.audit_log_id
+		WHERE d.subscription_id = $1
+	`
+
+	countQuery := `SELECT COUNT(*) FROM webhook_deliveries d WHERE d.subscription_id = $1`
+
+	args := []interface{}{subscriptionID}
+
+	if status != "" {
+		query += " AND d.status = $2"
+		countQuery += " AND d.status = $2"
+		args = append(args, status)
+	}
+
+	var totalCount int
+	err := r.db.QueryRow(countQuery, args...).Scan(&totalCount)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get count: %w", err)
+	}
+
+	query += fmt.Sprintf(" ORDER BY d.created_at DESC LIMIT $%d OFFSET $%d", len(args)+1, len(args)+2)
+	args = append(args, limit, offset)
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to query webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var deliveries []models.WebhookDelivery
+	for rows.Next() {
+		var d models.WebhookDelivery
+		err := rows.Scan(
+			&d.ID, &d.SubscriptionID, &d.AuditLogID, &d.EventType,
+			&d.Status, &d.Attempts, &d.LastError, &d.ResponseStatus,
+			&d.NextAttemptAt, &d.DeliveredAt, &d.CreatedAt,
+		)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to scan webhook delivery: %w", err)
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	return deliveries, totalCount, nil
+}
+
+// ReplayWebhookDeliveries puts deliveries back on the queue with a fresh set of
+// attempts. With no delivery IDs every dead-lettered delivery of the subscription
+// is replayed; listed deliveries are replayed whatever their status.
+func (r *WebhookRepository) ReplayWebhookDeliveries(subscriptionID string, deliveryIDs []string) (int64, error) {
+	query := `
+		UPDATE webhook_deliveries
+		SET status = 'pending', attempts = 0, last_error = NULL, response_status = NULL,
+		    next_attempt_at = $1, delivered_at = NULL
+		WHERE subscription_id = $2
+	`
+
+	args := []interface{}{time.Now(), subscriptionID}
+	if len(deliveryIDs) > 0 {
+		query += " AND id = ANY($3)"
+		args = append(args, pq.Array(deliveryIDs))
+	} else {
+		query += " AND status = 'dead'"
+	}
+
+	result, err := r.db.Exec(query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to replay webhook deliveries: %w", err)
+	}
+
+	count, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return count, nil
+}
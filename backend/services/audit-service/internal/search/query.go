@@ -0,0 +1,302 @@
+// Package search parses the audit log search language and compiles it to parameterized SQL.
+//
+// A query is a list of terms that must all match, for example:
+//
+//	event_type:login_failed metadata.distance_km>1000 ip:10.0.0.0/8 -success:true "bad password"
+//
+// A term is either field:value, field>value (also >=, <, <=), or bare text that
+// is matched against the failure reason, user agent and event type. A leading
+// "-" negates a term, and values containing spaces can be quoted.
+package search
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	maxQueryLength   = 1000
+	maxTerms         = 20
+	maxValueLength   = 200
+	maxMetadataDepth = 5
+)
+
+// Operators a term can use between its field and value
+const (
+	opMatch        = ":"
+	opGreater      = ">"
+	opGreaterEqual = ">="
+	opLess         = "<"
+	opLessEqual    = "<="
+)
+
+var (
+	fieldPattern       = regexp.MustCompile(`^[a-z_]+(\.[A-Za-z0-9_-]+)*$`)
+	metadataKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+	listValuePattern   = regexp.MustCompile(`^[a-z0-9_]+\*?$`)
+)
+
+// fieldAliases maps the field names accepted in queries to their canonical name
+var fieldAliases = map[string]string{
+	"event_type":     "event_type",
+	"type":           "event_type",
+	"category":       "event_category",
+	"event_category": "event_category",
+	"severity":       "severity",
+	"success":        "success",
+	"ip":             "ip_address",
+	"ip_address":     "ip_address",
+	"user":           "user_id",
+	"user_id":        "user_id",
+	"session":        "session_id",
+	"session_id":     "session_id",
+	"device":         "device_id",
+	"device_id":      "device_id",
+	"country":        "location_country",
+	"city":           "location_city",
+	"ua":             "user_agent",
+	"user_agent":     "user_agent",
+	"reason":         "failure_reason",
+	"failure_reason": "failure_reason",
+	"created":        "created_at",
+	"created_at":     "created_at",
+}
+
+// Query is a parsed, validated search query
+type Query struct {
+	terms []term
+}
+
+// term is a single condition; field is empty for free text
+type term struct {
+	negated bool
+	field   string
+	path    []string // metadata key path, for metadata fields
+	op      string
+	value   string
+	quoted  bool
+	time    time.Time
+	date    bool // time is a whole day rather than an instant
+}
+
+// Parse validates a search query. The error message is safe to show to users.
+func Parse(input string) (*Query, error) {
+	if len(input) > maxQueryLength {
+		return nil, fmt.Errorf("query is longer than %d characters", maxQueryLength)
+	}
+
+	tokens, err := tokenize(input)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("query is empty")
+	}
+	if len(tokens) > maxTerms {
+		return nil, fmt.Errorf("query has more than %d terms", maxTerms)
+	}
+
+	query := &Query{}
+	for _, tok := range tokens {
+		t, err := parseTerm(tok)
+		if err != nil {
+			return nil, err
+		}
+		query.terms = append(query.terms, t)
+	}
+
+	return query, nil
+}
+
+// token is a term as written, before its field and value are checked
+type token struct {
+	negated bool
+	field   string // empty for free text
+	op      string
+	value   string
+	quoted  bool
+}
+
+// tokenize splits a query into terms on whitespace outside quotes
+func tokenize(input string) ([]token, error) {
+	var tokens []token
+	i := 0
+
+	for i < len(input) {
+		if input[i] == ' ' || input[i] == '\t' || input[i] == '\n' {
+			i++
+			continue
+		}
+
+		var tok token
+		if input[i] == '-' {
+			tok.negated = true
+			i++
+		}
+
+		// Field name, if the term has one
+		start := i
+		for i < len(input) && strings.IndexByte(" \t\n\":<>", input[i]) < 0 {
+			i++
+		}
+		if i < len(input) && strings.IndexByte(":<>", input[i]) >= 0 {
+			tok.field = input[start:i]
+			if tok.field == "" {
+				return nil, fmt.Errorf("missing field name at position %d", start+1)
+			}
+
+			tok.op = string(input[i])
+			i++
+			if tok.op != opMatch && i < len(input) && input[i] == '=' {
+				tok.op += "="
+				i++
+			}
+		} else {
+			i = start
+		}
+
+		value, quoted, next, err := readValue(input, i)
+		if err != nil {
+			return nil, err
+		}
+		if value == "" && !quoted {
+			return nil, fmt.Errorf("missing value at position %d", i+1)
+		}
+		if len(value) > maxValueLength {
+			return nil, fmt.Errorf("value is longer than %d characters", maxValueLength)
+		}
+
+		tok.value, tok.quoted = value, quoted
+		tokens = append(tokens, tok)
+		i = next
+	}
+
+	return tokens, nil
+}
+
+// readValue reads a bare or double-quoted value starting at i
+func readValue(input string, i int) (string, bool, int, error) {
+	if i < len(input) && input[i] == '"' {
+		var b strings.Builder
+		for j := i + 1; j < len(input); j++ {
+			switch input[j] {
+			case '\\':
+				if j+1 < len(input) {
+					j++
+					b.WriteByte(input[j])
+				}
+			case '"':
+				return b.String(), true, j + 1, nil
+			default:
+				b.WriteByte(input[j])
+			}
+		}
+		return "", false, 0, fmt.Errorf("unterminated quote at position %d", i+1)
+	}
+
+	start := i
+	for i < len(input) && strings.IndexByte(" \t\n", input[i]) < 0 {
+		if input[i] == '"' {
+			return "", false, 0, fmt.Errorf("unexpected quote at position %d", i+1)
+		}
+		i++
+	}
+
+	return input[start:i], false, i, nil
+}
+
+// parseTerm checks a token's field, operator and value
+func parseTerm(tok token) (term, error) {
+	t := term{negated: tok.negated, op: tok.op, value: tok.value, quoted: tok.quoted}
+	if tok.field == "" {
+		return t, nil
+	}
+
+	if !fieldPattern.MatchString(tok.field) {
+		return t, fmt.Errorf("invalid field %q", tok.field)
+	}
+
+	if tok.field == "metadata" || strings.HasPrefix(tok.field, "metadata.") {
+		path := strings.Split(tok.field, ".")[1:]
+		if len(path) == 0 {
+			return t, fmt.Errorf("metadata needs a key, e.g. metadata.country")
+		}
+		if len(path) > maxMetadataDepth {
+			return t, fmt.Errorf("metadata keys can be at most %d levels deep", maxMetadataDepth)
+		}
+		for _, key := range path {
+			if !metadataKeyPattern.MatchString(key) {
+				return t, fmt.Errorf("invalid metadata key %q", key)
+			}
+		}
+
+		t.field, t.path = "metadata", path
+		if t.op != opMatch {
+			if _, err := strconv.ParseFloat(t.value, 64); err != nil {
+				return t, fmt.Errorf("%s%s needs a number", tok.field, t.op)
+			}
+		}
+		return t, nil
+	}
+
+	field, ok := fieldAliases[tok.field]
+	if !ok {
+		return t, fmt.Errorf("unknown field %q", tok.field)
+	}
+	t.field = field
+
+	if field == "created_at" {
+		parsed, date, err := parseTime(t.value)
+		if err != nil {
+			return t, fmt.Errorf("%s needs an RFC 3339 timestamp or a YYYY-MM-DD date", tok.field)
+		}
+		t.time, t.date = parsed, date
+		return t, nil
+	}
+
+	if t.op != opMatch {
+		return t, fmt.Errorf("%s only supports %s", tok.field, opMatch)
+	}
+
+	switch field {
+	case "event_type", "event_category", "severity":
+		if strings.Contains(t.value, ",") && strings.Contains(t.value, "*") {
+			return t, fmt.Errorf("%s can't mix a list with a * prefix match", tok.field)
+		}
+		for _, v := range strings.Split(t.value, ",") {
+			if !listValuePattern.MatchString(v) {
+				return t, fmt.Errorf("invalid %s %q", tok.field, v)
+			}
+		}
+	case "success":
+		if t.value != "true" && t.value != "false" {
+			return t, fmt.Errorf("success must be true or false")
+		}
+	case "ip_address":
+		if _, _, err := net.ParseCIDR(t.value); err != nil && net.ParseIP(t.value) == nil {
+			return t, fmt.Errorf("ip needs an IP address or CIDR range")
+		}
+	case "user_id", "session_id", "device_id":
+		if _, err := uuid.Parse(t.value); err != nil {
+			return t, fmt.Errorf("%s needs a UUID", tok.field)
+		}
+	}
+
+	return t, nil
+}
+
+// parseTime accepts an RFC 3339 timestamp or a date, which is returned as
+// midnight UTC and reported as a date
+func parseTime(value string) (time.Time, bool, error) {
+	if parsed, err := time.Parse(time.RFC3339, value); err == nil {
+		return parsed, false, nil
+	}
+	parsed, err := time.Parse("2006-01-02", value)
+	return parsed, err == nil, err
+}
@@ -0,0 +1,187 @@
+package search
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"", "query is empty"},
+		{"   \t\n", "query is empty"},
+		{strings.Repeat("a", maxQueryLength+1), "query is longer than 1000 characters"},
+		{strings.Repeat("a ", maxTerms+1), "query has more than 20 terms"},
+		{"type:" + strings.Repeat("a", maxValueLength+1), "value is longer than 200 characters"},
+		{":login", "missing field name at position 1"},
+		{"-:login", "missing field name at position 2"},
+		{"type:", "missing value at position 6"},
+		{"ok type:", "missing value at position 9"},
+		{`"bad password`, "unterminated quote at position 1"},
+		{`reason:"bad`, "unterminated quote at position 8"},
+		{`bad"password`, "unexpected quote at position 4"},
+		{"Type:login", `invalid field "Type"`},
+		{"type..x:login", `invalid field "type..x"`},
+		{"nope:1", `unknown field "nope"`},
+		{"metadata:1", "metadata needs a key, e.g. metadata.country"},
+		{"metadata.a.b.c.d.e.f:1", "metadata keys can be at most 5 levels deep"},
+		{"metadata." + strings.Repeat("k", 65) + ":1", `invalid metadata key "` + strings.Repeat("k", 65) + `"`},
+		{"metadata.distance_km>far", "metadata.distance_km> needs a number"},
+		{"metadata.n<=1e", "metadata.n<= needs a number"},
+		{"created:yesterday", "created needs an RFC 3339 timestamp or a YYYY-MM-DD date"},
+		{"created_at>2026-13-01", "created_at needs an RFC 3339 timestamp or a YYYY-MM-DD date"},
+		{"type>login", "type only supports :"},
+		{"success<=true", "success only supports :"},
+		{"type:login,mfa_*", "type can't mix a list with a * prefix match"},
+		{"type:Login", `invalid type "Login"`},
+		{"category:auth,", `invalid category ""`},
+		{"severity:mfa*x", `invalid severity "mfa*x"`},
+		{"success:yes", "success must be true or false"},
+		{"ip:10.0.0", "ip needs an IP address or CIDR range"},
+		{"ip:10.0.0.0/33", "ip needs an IP address or CIDR range"},
+		{"user:user-1", "user needs a UUID"},
+		{"session_id:1", "session_id needs a UUID"},
+		{"device:x", "device needs a UUID"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			_, err := Parse(tt.query)
+			if err == nil {
+				t.Fatalf("Parse(%q) succeeded, want %q", tt.query, tt.want)
+			}
+			if err.Error() != tt.want {
+				t.Errorf("Parse(%q) = %q, want %q", tt.query, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseFieldAliases(t *testing.T) {
+	values := map[string]string{
+		"event_type":       "login",
+		"event_category":   "authentication",
+		"severity":         "warning",
+		"success":          "true",
+		"ip_address":       "10.0.0.1",
+		"user_id":          "9b2d6a3e-1f4c-4e8a-b6d7-2c3e4f5a6b7c",
+		"session_id":       "9b2d6a3e-1f4c-4e8a-b6d7-2c3e4f5a6b7c",
+		"device_id":        "9b2d6a3e-1f4c-4e8a-b6d7-2c3e4f5a6b7c",
+		"location_country": "FR",
+		"location_city":    "Paris",
+		"user_agent":       "Firefox",
+		"failure_reason":   "bad_password",
+		"created_at":       "2026-03-01",
+	}
+	for alias, field := range fieldAliases {
+		t.Run(alias, func(t *testing.T) {
+			q, err := Parse(alias + ":" + values[field])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := q.terms[0].field; got != field {
+				t.Errorf("field = %q, want %q", got, field)
+			}
+		})
+	}
+}
+
+func TestParseTerms(t *testing.T) {
+	day := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	instant := time.Date(2026, 3, 1, 12, 30, 0, 0, time.FixedZone("", 2*60*60))
+
+	tests := []struct {
+		name  string
+		query string
+		want  []term
+	}{
+		{
+			name:  "free text",
+			query: "password",
+			want:  []term{{value: "password"}},
+		},
+		{
+			name:  "quoted free text",
+			query: `"bad password"`,
+			want:  []term{{value: "bad password", quoted: true}},
+		},
+		{
+			name:  "escaped quote and backslash",
+			query: `reason:"say \"hi\" \\ bye"`,
+			want:  []term{{field: "failure_reason", op: ":", value: `say "hi" \ bye`, quoted: true}},
+		},
+		{
+			name:  "empty quoted value",
+			query: `reason:""`,
+			want:  []term{{field: "failure_reason", op: ":", quoted: true}},
+		},
+		{
+			name:  "negation",
+			query: "-success:true -firefox",
+			want:  []term{{negated: true, field: "success", op: ":", value: "true"}, {negated: true, value: "firefox"}},
+		},
+		{
+			name:  "whitespace between terms",
+			query: " type:login\tcountry:FR\ncity:Paris ",
+			want: []term{
+				{field: "event_type", op: ":", value: "login"},
+				{field: "location_country", op: ":", value: "FR"},
+				{field: "location_city", op: ":", value: "Paris"},
+			},
+		},
+		{
+			name:  "colon in a value",
+			query: "ip:2001:db8::/32",
+			want:  []term{{field: "ip_address", op: ":", value: "2001:db8::/32"}},
+		},
+		{
+			name:  "metadata path",
+			query: "metadata.geo.country:FR",
+			want:  []term{{field: "metadata", path: []string{"geo", "country"}, op: ":", value: "FR"}},
+		},
+		{
+			name:  "every comparison",
+			query: "metadata.n>1 metadata.n>=2 metadata.n<3 metadata.n<=4.5",
+			want: []term{
+				{field: "metadata", path: []string{"n"}, op: ">", value: "1"},
+				{field: "metadata", path: []string{"n"}, op: ">=", value: "2"},
+				{field: "metadata", path: []string{"n"}, op: "<", value: "3"},
+				{field: "metadata", path: []string{"n"}, op: "<=", value: "4.5"},
+			},
+		},
+		{
+			name:  "date",
+			query: "created>=2026-03-01",
+			want:  []term{{field: "created_at", op: ">=", value: "2026-03-01", time: day, date: true}},
+		},
+		{
+			name:  "timestamp",
+			query: "created<2026-03-01T12:30:00+02:00",
+			want:  []term{{field: "created_at", op: "<", value: "2026-03-01T12:30:00+02:00", time: instant}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := Parse(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(q.terms) != len(tt.want) {
+				t.Fatalf("got %d terms %+v, want %d", len(q.terms), q.terms, len(tt.want))
+			}
+			for i, got := range q.terms {
+				want := tt.want[i]
+				if !got.time.Equal(want.time) {
+					t.Errorf("term %d: time = %v, want %v", i, got.time, want.time)
+				}
+				got.time, want.time = time.Time{}, time.Time{}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("term %d = %+v, want %+v", i, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package search
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// SQL compiles the query to conditions over audit_logs that must all hold.
+// Values are only ever passed as args, numbered from $firstArg.
+func (q *Query) SQL(firstArg int) ([]string, []interface{}, error) {
+	c := &compiler{next: firstArg}
+
+	var conditions []string
+	for _, t := range q.terms {
+		condition, err := c.term(t)
+		if err != nil {
+			return nil, nil, err
+		}
+		if t.negated {
+			// COALESCE so rows where the column is NULL count as not matching
+			condition = fmt.Sprintf("NOT COALESCE(%s, false)", condition)
+		}
+		conditions = append(conditions, condition)
+	}
+
+	return conditions, c.args, nil
+}
+
+type compiler struct {
+	next int
+	args []interface{}
+}
+
+// arg adds a parameter and returns its placeholder
+func (c *compiler) arg(value interface{}) string {
+	c.args = append(c.args, value)
+	placeholder := "$" + strconv.Itoa(c.next)
+	c.next++
+	return placeholder
+}
+
+// term compiles one term. Parse only produces the fields handled here, so an
+// error means a term was built some other way.
+func (c *compiler) term(t term) (string, error) {
+	switch t.field {
+	case "":
+		pattern := c.arg(containsPattern(t.value))
+		return fmt.Sprintf("(failure_reason ILIKE %[1]s OR user_agent ILIKE %[1]s OR event_type ILIKE %[1]s)", pattern), nil
+
+	case "metadata":
+		return c.metadata(t), nil
+
+	case "event_type", "event_category", "severity":
+		values := strings.Split(t.value, ",")
+		if len(values) == 1 && strings.HasSuffix(t.value, "*") {
+			return fmt.Sprintf("%s LIKE %s", t.field, c.arg(escapeLike(strings.TrimSuffix(t.value, "*"))+"%")), nil
+		}
+		return fmt.Sprintf("%s = ANY(%s)", t.field, c.arg(pq.Array(values))), nil
+
+	case "success":
+		return fmt.Sprintf("success = %s", c.arg(t.value == "true")), nil
+
+	case "ip_address":
+		return fmt.Sprintf("ip_address <<= %s::inet", c.arg(t.value)), nil
+
+	case "user_id", "session_id", "device_id":
+		return fmt.Sprintf("%s = %s::uuid", t.field, c.arg(t.value)), nil
+
+	case "location_country", "location_city":
+		return fmt.Sprintf("lower(%s) = lower(%s)", t.field, c.arg(t.value)), nil
+
+	case "user_agent", "failure_reason":
+		return fmt.Sprintf("%s ILIKE %s", t.field, c.arg(containsPattern(t.value))), nil
+
+	case "created_at":
+		return c.createdAt(t)
+	}
+
+	return "", fmt.Errorf("search: unhandled field %q", t.field)
+}
+
+// createdAt compiles created_at terms. A date stands for the whole UTC day
+// [day, day+1), so created:2026-03-01 matches every event that day and
+// created>2026-03-01 starts the day after.
+func (c *compiler) createdAt(t term) (string, error) {
+	if !t.date {
+		op := t.op
+		if op == opMatch {
+			op = "="
+		}
+		return fmt.Sprintf("created_at %s %s", op, c.arg(t.time)), nil
+	}
+
+	day, nextDay := t.time, t.time.AddDate(0, 0, 1)
+	switch t.op {
+	case opMatch:
+		return fmt.Sprintf("(created_at >= %s AND created_at < %s)", c.arg(day), c.arg(nextDay)), nil
+	case opGreater:
+		return fmt.Sprintf("created_at >= %s", c.arg(nextDay)), nil
+	case opGreaterEqual:
+		return fmt.Sprintf("created_at >= %s", c.arg(day)), nil
+	case opLess:
+		return fmt.Sprintf("created_at < %s", c.arg(day)), nil
+	case opLessEqual:
+		return fmt.Sprintf("created_at < %s", c.arg(nextDay)), nil
+	}
+
+	return "", fmt.Errorf("search: unhandled operator %q", t.op)
+}
+
+// metadata compiles metadata.<path> terms: containment for ":" so the GIN index
+// applies, "*" for key existence, and guarded numeric comparisons otherwise
+func (c *compiler) metadata(t term) string {
+	if t.op != opMatch {
+		path := c.arg(pq.Array(t.path))
+		return fmt.Sprintf(
+			"CASE WHEN jsonb_typeof(metadata #> %[1]s::text[]) = 'number' THEN (metadata #>> %[1]s::text[])::numeric END %[2]s %[3]s::numeric",
+			path, t.op, c.arg(t.value),
+		)
+	}
+
+	if t.value == "*" && !t.quoted {
+		return fmt.Sprintf("metadata #> %s::text[] IS NOT NULL", c.arg(pq.Array(t.path)))
+	}
+
+	// Build {"a": {"b": value}} for metadata.a.b:value
+	var doc interface{} = jsonValue(t.value, t.quoted)
+	for i := len(t.path) - 1; i >= 0; i-- {
+		doc = map[string]interface{}{t.path[i]: doc}
+	}
+	encoded, _ := json.Marshal(doc)
+
+	return fmt.Sprintf("metadata @> %s::jsonb", c.arg(string(encoded)))
+}
+
+// jsonValue infers the JSON type of an unquoted value; quoted values are always strings
+func jsonValue(value string, quoted bool) interface{} {
+	if quoted {
+		return value
+	}
+
+	switch value {
+	case "true":
+		return true
+	case "false":
+		return false
+	case "null":
+		return nil
+	}
+
+	if _, err := strconv.ParseFloat(value, 64); err == nil && json.Valid([]byte(value)) {
+		return json.Number(value)
+	}
+
+	return value
+}
+
+// containsPattern returns an ILIKE pattern matching value anywhere in the text
+func containsPattern(value string) string {
+	return "%" + escapeLike(value) + "%"
+}
+
+// escapeLike escapes LIKE wildcards so user input only matches literally
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
@@ -0,0 +1,197 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+func TestSQL(t *testing.T) {
+	day := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	nextDay := day.AddDate(0, 0, 1)
+	instant := time.Date(2026, 3, 1, 12, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		query      string
+		conditions []string
+		args       []interface{}
+	}{
+		{
+			`"bad password"`,
+			[]string{"(failure_reason ILIKE $3 OR user_agent ILIKE $3 OR event_type ILIKE $3)"},
+			[]interface{}{"%bad password%"},
+		},
+		{
+			`100%_\done`,
+			[]string{"(failure_reason ILIKE $3 OR user_agent ILIKE $3 OR event_type ILIKE $3)"},
+			[]interface{}{`%100\%\_\\done%`},
+		},
+		{
+			"type:login_failed",
+			[]string{"event_type = ANY($3)"},
+			[]interface{}{pq.Array([]string{"login_failed"})},
+		},
+		{
+			"category:authentication,security",
+			[]string{"event_category = ANY($3)"},
+			[]interface{}{pq.Array([]string{"authentication", "security"})},
+		},
+		{
+			// The _ in the prefix is escaped, * becomes %
+			"severity:mfa_*",
+			[]string{"severity LIKE $3"},
+			[]interface{}{`mfa\_%`},
+		},
+		{
+			"success:false",
+			[]string{"success = $3"},
+			[]interface{}{false},
+		},
+		{
+			"ip:10.0.0.0/8",
+			[]string{"ip_address <<= $3::inet"},
+			[]interface{}{"10.0.0.0/8"},
+		},
+		{
+			"user:9b2d6a3e-1f4c-4e8a-b6d7-2c3e4f5a6b7c session:1d2e3f4a-5b6c-4d7e-8f9a-0b1c2d3e4f5a",
+			[]string{"user_id = $3::uuid", "session_id = $4::uuid"},
+			[]interface{}{"9b2d6a3e-1f4c-4e8a-b6d7-2c3e4f5a6b7c", "1d2e3f4a-5b6c-4d7e-8f9a-0b1c2d3e4f5a"},
+		},
+		{
+			"device:6f1c1d8e-3b7a-4c7e-9d55-0a6f1e2b3c4d",
+			[]string{"device_id = $3::uuid"},
+			[]interface{}{"6f1c1d8e-3b7a-4c7e-9d55-0a6f1e2b3c4d"},
+		},
+		{
+			`country:FR city:"New York"`,
+			[]string{"lower(location_country) = lower($3)", "lower(location_city) = lower($4)"},
+			[]interface{}{"FR", "New York"},
+		},
+		{
+			"ua:Firefox/1%",
+			[]string{"user_agent ILIKE $3"},
+			[]interface{}{`%Firefox/1\%%`},
+		},
+		{
+			"reason:bad_password",
+			[]string{"failure_reason ILIKE $3"},
+			[]interface{}{`%bad\_password%`},
+		},
+		{
+			"metadata.geo.country:FR",
+			[]string{"metadata @> $3::jsonb"},
+			[]interface{}{`{"geo":{"country":"FR"}}`},
+		},
+		{
+			// Unquoted values get their JSON type, quoted ones stay strings
+			`metadata.n:42 metadata.b:true metadata.z:null metadata.s:"42"`,
+			[]string{"metadata @> $3::jsonb", "metadata @> $4::jsonb", "metadata @> $5::jsonb", "metadata @> $6::jsonb"},
+			[]interface{}{`{"n":42}`, `{"b":true}`, `{"z":null}`, `{"s":"42"}`},
+		},
+		{
+			`metadata.a:"x\"y"`,
+			[]string{"metadata @> $3::jsonb"},
+			[]interface{}{`{"a":"x\"y"}`},
+		},
+		{
+			`metadata.key:* metadata.key:"*"`,
+			[]string{"metadata #> $3::text[] IS NOT NULL", "metadata @> $4::jsonb"},
+			[]interface{}{pq.Array([]string{"key"}), `{"key":"*"}`},
+		},
+		{
+			"metadata.geo.distance_km>1000",
+			[]string{"CASE WHEN jsonb_typeof(metadata #> $3::text[]) = 'number' THEN (metadata #>> $3::text[])::numeric END > $4::numeric"},
+			[]interface{}{pq.Array([]string{"geo", "distance_km"}), "1000"},
+		},
+		{
+			"metadata.n>=1 metadata.n<2 metadata.n<=3",
+			[]string{
+				"CASE WHEN jsonb_typeof(metadata #> $3::text[]) = 'number' THEN (metadata #>> $3::text[])::numeric END >= $4::numeric",
+				"CASE WHEN jsonb_typeof(metadata #> $5::text[]) = 'number' THEN (metadata #>> $5::text[])::numeric END < $6::numeric",
+				"CASE WHEN jsonb_typeof(metadata #> $7::text[]) = 'number' THEN (metadata #>> $7::text[])::numeric END <= $8::numeric",
+			},
+			[]interface{}{pq.Array([]string{"n"}), "1", pq.Array([]string{"n"}), "2", pq.Array([]string{"n"}), "3"},
+		},
+		{
+			// A date is the whole day
+			"created:2026-03-01",
+			[]string{"(created_at >= $3 AND created_at < $4)"},
+			[]interface{}{day, nextDay},
+		},
+		{
+			"created>2026-03-01 created>=2026-03-01",
+			[]string{"created_at >= $3", "created_at >= $4"},
+			[]interface{}{nextDay, day},
+		},
+		{
+			"created<2026-03-01 created<=2026-03-01",
+			[]string{"created_at < $3", "created_at < $4"},
+			[]interface{}{day, nextDay},
+		},
+		{
+			// A timestamp is an instant
+			"created:2026-03-01T12:30:00Z created_at>2026-03-01T12:30:00Z created<=2026-03-01T14:30:00+02:00",
+			[]string{"created_at = $3", "created_at > $4", "created_at <= $5"},
+			[]interface{}{instant, instant, instant},
+		},
+		{
+			"-success:true -created:2026-03-01",
+			[]string{"NOT COALESCE(success = $3, false)", "NOT COALESCE((created_at >= $4 AND created_at < $5), false)"},
+			[]interface{}{true, day, nextDay},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q, err := Parse(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Placeholders continue after the caller's own args
+			conditions, args, err := q.SQL(3)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(conditions, tt.conditions) {
+				t.Errorf("conditions:\n%q\nwant:\n%q", conditions, tt.conditions)
+			}
+			if !sameArgs(args, tt.args) {
+				t.Errorf("args = %#v, want %#v", args, tt.args)
+			}
+		})
+	}
+}
+
+// A term Parse wouldn't produce is an error rather than a panic
+func TestSQLRejectsUnhandledTerm(t *testing.T) {
+	for _, q := range []*Query{
+		{terms: []term{{field: "organization_id", op: opMatch, value: "x"}}},
+		{terms: []term{{field: "created_at", op: "!=", date: true}}},
+	} {
+		if conditions, _, err := q.SQL(1); err == nil {
+			t.Errorf("%+v compiled to %q", q.terms[0], conditions)
+		}
+	}
+}
+
+// sameArgs compares args, times by the instant they stand for
+func sameArgs(got, want []interface{}) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if wantTime, ok := want[i].(time.Time); ok {
+			gotTime, ok := got[i].(time.Time)
+			if !ok || !gotTime.Equal(wantTime) {
+				return false
+			}
+			continue
+		}
+		if !reflect.DeepEqual(got[i], want[i]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,213 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aashiq-04/session-management-system/backend/services/audit-service/internal/models"
+	"github.com/aashiq-04/session-management-system/backend/services/audit-service/internal/notifications"
+	"github.com/aashiq-04/session-management-system/backend/services/audit-service/internal/repository"
+)
+
+// EventHeader carries the audit event type, so receivers can route without parsing the body.
+// Signature, timestamp and delivery headers are shared with alert notification webhooks.
+const EventHeader = "X-Webhook-Event"
+
+const (
+	// deliveryLease is how long a claimed delivery is hidden from other instances
+	deliveryLease = 2 * time.Minute
+
+	// maxRetryBackoff caps the exponential backoff between attempts
+	maxRetryBackoff = time.Hour
+)
+
+// errDeadLetter marks deliveries that shouldn't be retried
+var errDeadLetter = errors.New("dead-lettered")
+
+// Config holds the dispatcher settings
+type Config struct {
+	PollInterval time.Duration // How often to drain the outbox and send due deliveries
+	BatchSize    int           // Maximum events and deliveries handled per poll
+	MaxAttempts  int           // Attempts before a delivery is dead-lettered
+	RetryBackoff time.Duration // Delay before the first retry, doubled after each failure
+	Timeout      time.Duration // Timeout for a single HTTP request
+}
+
+// Dispatcher fans audit events out to webhook subscriptions and delivers them
+type Dispatcher struct {
+	logs   *repository.AuditRepository
+	repo   *repository.WebhookRepository
+	client *http.Client
+	config Config
+}
+
+// NewDispatcher creates a new webhook dispatcher
+func NewDispatcher(db *sql.DB, config Config) *Dispatcher {
+	return &Dispatcher{
+		logs:   repository.NewAuditRepository(db),
+		repo:   repository.NewWebhookRepository(db),
+		client: notifications.NewWebhookClient(config.Timeout),
+		config: config,
+	}
+}
+
+// Run polls the outbox and due deliveries until ctx is cancelled
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		d.poll(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll queues deliveries for new audit events and sends whatever is due
+func (d *Dispatcher) poll(ctx context.Context) {
+	if err := d.fanOut(); err != nil {
+		log.Printf("Failed to queue webhook deliveries: %v", err)
+	}
+
+	deliveries, err := d.repo.ClaimDueWebhookDeliveries(d.config.BatchSize, deliveryLease)
+	if err != nil {
+		log.Printf("Failed to claim webhook deliveries: %v", err)
+		return
+	}
+
+	for i := range deliveries {
+		if ctx.Err() != nil {
+			return
+		}
+		d.deliver(ctx, &deliveries[i])
+	}
+}
+
+// fanOut drains the audit event outbox into per-subscription deliveries
+func (d *Dispatcher) fanOut() error {
+	subs, err := d.repo.GetActiveWebhookSubscriptions()
+	if err != nil {
+		return err
+	}
+
+	// Keep draining even without subscribers, so the outbox doesn't grow forever
+	_, err = d.repo.DrainAuditEventOutbox(d.config.BatchSize, func(auditLog *models.AuditLog) []string {
+		var ids []string
+		for i := range subs {
+			if Matches(&subs[i], auditLog) {
+				ids = append(ids, subs[i].ID)
+			}
+		}
+		return ids
+	})
+
+	return err
+}
+
+// deliver makes one attempt at a delivery and records the outcome
+func (d *Dispatcher) deliver(ctx context.Context, delivery *models.WebhookDelivery) {
+	status, err := d.send(ctx, delivery)
+	if err == nil {
+		if err := d.repo.MarkWebhookDelivered(delivery.ID, status); err != nil {
+			log.Printf("Failed to record webhook delivery %s: %v", delivery.ID, err)
+		}
+		return
+	}
+
+	var responseStatus *int
+	if status != 0 {
+		responseStatus = &status
+	}
+
+	attempts := delivery.Attempts + 1
+	var nextAttemptAt *time.Time
+	if !errors.Is(err, errDeadLetter) && attempts < d.config.MaxAttempts {
+		next := time.Now().Add(d.backoff(attempts))
+		nextAttemptAt = &next
+	}
+
+	if nextAttemptAt != nil {
+		log.Printf("Webhook delivery %s failed (attempt %d/%d): %v", delivery.ID, attempts, d.config.MaxAttempts, err)
+	} else {
+		log.Printf("Webhook delivery %s dead-lettered: %v", delivery.ID, err)
+	}
+
+	if err := d.repo.MarkWebhookDeliveryFailed(delivery.ID, err.Error(), responseStatus, nextAttemptAt); err != nil {
+		log.Printf("Failed to record webhook delivery %s: %v", delivery.ID, err)
+	}
+}
+
+// send posts the signed event to the subscription URL and returns the response status
+func (d *Dispatcher) send(ctx context.Context, delivery *models.WebhookDelivery) (int, error) {
+	sub, err := d.repo.GetWebhookSubscription(delivery.SubscriptionID)
+	if err != nil {
+		return 0, err
+	}
+	if !sub.IsActive {
+		return 0, fmt.Errorf("%w: subscription is inactive", errDeadLetter)
+	}
+	// Subscriptions saved before URLs had to be https are dead-lettered rather than retried
+	if err := notifications.ValidateWebhookURL(sub.URL); err != nil {
+		return 0, fmt.Errorf("%w: %v", errDeadLetter, err)
+	}
+
+	auditLog, err := d.logs.GetAuditLogByID(delivery.AuditLogID)
+	if err != nil {
+		return 0, err
+	}
+
+	body, err := json.Marshal(NewEvent(auditLog))
+	if err != nil {
+		return 0, fmt.Errorf("%w: failed to encode event: %v", errDeadLetter, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("%w: failed to create request: %v", errDeadLetter, err)
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, auditLog.EventType)
+	req.Header.Set(notifications.WebhookTimestampHeader, timestamp)
+	req.Header.Set(notifications.WebhookDeliveryHeader, delivery.ID)
+	req.Header.Set(notifications.WebhookSignatureHeader, "sha256="+notifications.SignWebhookPayload(sub.Secret, timestamp, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to call webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+
+	return resp.StatusCode, nil
+}
+
+// backoff returns the delay before the next attempt after the given number of failures
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.config.RetryBackoff
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= maxRetryBackoff {
+			return maxRetryBackoff
+		}
+	}
+	return delay
+}
@@ -0,0 +1,179 @@
+package webhooks
+
+import (
+	"context"
+	"database/sql/driver"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"github.com/aashiq-04/session-management-system/backend/services/audit-service/internal/models"
+	"github.com/aashiq-04/session-management-system/backend/services/audit-service/internal/notifications"
+)
+
+// retryArg matches the next_attempt_at argument of MarkWebhookDeliveryFailed:
+// a time when the delivery will be retried, NULL when it was dead-lettered
+type retryArg bool
+
+func (retry retryArg) Match(v driver.Value) bool {
+	_, isTime := v.(time.Time)
+	return isTime == bool(retry)
+}
+
+// receiverURL passes notifications.ValidateWebhookURL and is covered by the
+// httptest certificate; routeToReceiver sends it to the local receiver
+const receiverURL = "https://example.com/hooks/audit"
+
+func newTestDispatcher(t *testing.T) (*Dispatcher, sqlmock.Sqlmock) {
+	t.Helper()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+		db.Close()
+	})
+
+	return NewDispatcher(db, Config{
+		MaxAttempts:  3,
+		RetryBackoff: time.Minute,
+		Timeout:      5 * time.Second,
+	}), mock
+}
+
+// routeToReceiver points the dispatcher's client at server whatever the
+// host, since the restricted dialer would refuse the loopback receiver
+func routeToReceiver(d *Dispatcher, server *httptest.Server) {
+	client := server.Client()
+	client.CheckRedirect = d.client.CheckRedirect
+	client.Transport.(*http.Transport).DialContext = func(ctx context.Context, network, _ string) (net.Conn, error) {
+		var dialer net.Dialer
+		return dialer.DialContext(ctx, network, server.Listener.Addr().String())
+	}
+	d.client = client
+}
+
+func expectSubscription(mock sqlmock.Sqlmock, url string) {
+	now := time.Now()
+	mock.ExpectQuery(regexp.QuoteMeta("FROM webhook_subscriptions WHERE id = $1")).
+		WithArgs("sub-1").
+		WillReturnRows(sqlmock.NewRows([]string{
+			"id", "user_id", "url", "secret", "event_types", "event_categories",
+			"min_severity", "description", "is_active", "created_at", "updated_at",
+		}).AddRow("sub-1", "user-1", url, "secret", "{}", "{}", nil, nil, true, now, now))
+}
+
+func expectAuditLog(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(regexp.QuoteMeta("FROM audit_logs")).
+		WithArgs("log-1").
+		WillReturnRows(sqlmock.NewRows([]string{
+			"id", "user_id", "session_id", "device_id", "event_type", "event_category",
+			"severity", "ip_address", "user_agent", "location_country", "location_city",
+			"metadata", "success", "failure_reason", "created_at",
+		}).AddRow("log-1", "user-1", nil, nil, "user_login", "authentication",
+			"info", "203.0.113.7", nil, nil, nil, nil, true, nil, time.Now()))
+}
+
+func expectFailed(mock sqlmock.Sqlmock, retry bool) {
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE webhook_deliveries")).
+		WithArgs(sqlmock.AnyArg(), nil, retryArg(retry), "delivery-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+func testDelivery() *models.WebhookDelivery {
+	return &models.WebhookDelivery{
+		ID:             "delivery-1",
+		SubscriptionID: "sub-1",
+		AuditLogID:     "log-1",
+		EventType:      "user_login",
+		Status:         "pending",
+	}
+}
+
+func TestDispatcherDelivers(t *testing.T) {
+	received := 0
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		timestamp := r.Header.Get(notifications.WebhookTimestampHeader)
+		if want := "sha256=" + notifications.SignWebhookPayload("secret", timestamp, body); r.Header.Get(notifications.WebhookSignatureHeader) != want {
+			t.Error("event not signed with the subscription secret")
+		}
+		if r.Header.Get(EventHeader) != "user_login" {
+			t.Errorf("event header = %q, want user_login", r.Header.Get(EventHeader))
+		}
+		received++
+	}))
+	defer server.Close()
+
+	d, mock := newTestDispatcher(t)
+	routeToReceiver(d, server)
+
+	expectSubscription(mock, receiverURL)
+	expectAuditLog(mock)
+	mock.ExpectExec(regexp.QuoteMeta("SET status = 'delivered'")).
+		WithArgs(http.StatusOK, sqlmock.AnyArg(), "delivery-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	d.deliver(context.Background(), testDelivery())
+
+	if received != 1 {
+		t.Errorf("receiver got %d requests, want 1", received)
+	}
+}
+
+func TestDispatcherDeadLettersDisallowedURLs(t *testing.T) {
+	for _, url := range []string{
+		"http://example.com/hooks/audit",
+		"https://127.0.0.1/hooks/audit",
+		"https://169.254.169.254/latest/meta-data",
+		"https://[fd00::1]/hooks/audit",
+	} {
+		t.Run(url, func(t *testing.T) {
+			received := 0
+			server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				received++
+			}))
+			defer server.Close()
+
+			d, mock := newTestDispatcher(t)
+			routeToReceiver(d, server)
+
+			expectSubscription(mock, url)
+			expectFailed(mock, false)
+
+			d.deliver(context.Background(), testDelivery())
+
+			if received != 0 {
+				t.Errorf("receiver got %d requests, want none", received)
+			}
+		})
+	}
+}
+
+func TestDispatcherRefusesHostsResolvingToInternalAddresses(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("dispatcher reached a loopback receiver")
+	}))
+	defer server.Close()
+
+	// The client from NewDispatcher is used as is
+	d, mock := newTestDispatcher(t)
+	port := server.URL[strings.LastIndex(server.URL, ":"):]
+
+	expectSubscription(mock, "https://localhost"+port+"/hooks/audit")
+	expectAuditLog(mock)
+	expectFailed(mock, true)
+
+	d.deliver(context.Background(), testDelivery())
+}
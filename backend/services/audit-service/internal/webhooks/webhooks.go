@@ -0,0 +1,102 @@
+// Package webhooks delivers audit events to subscribed HTTP endpoints
+package webhooks
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/aashiq-04/session-management-system/backend/services/audit-service/internal/models"
+)
+
+var severityRank = map[string]int{
+	"info":     1,
+	"warning":  2,
+	"critical": 3,
+}
+
+// ValidSeverity reports whether s is a known audit log severity
+func ValidSeverity(s string) bool {
+	_, ok := severityRank[s]
+	return ok
+}
+
+// Matches reports whether an audit event passes a subscription's filters
+func Matches(sub *models.WebhookSubscription, log *models.AuditLog) bool {
+	if !sub.IsActive {
+		return false
+	}
+
+	// User subscriptions only see their own user's events
+	if sub.UserID != nil && (log.UserID == nil || *log.UserID != *sub.UserID) {
+		return false
+	}
+
+	if len(sub.EventTypes) > 0 && !contains(sub.EventTypes, log.EventType) {
+		return false
+	}
+
+	if len(sub.EventCategories) > 0 && !contains(sub.EventCategories, log.EventCategory) {
+		return false
+	}
+
+	if sub.MinSeverity != nil && severityRank[log.Severity] < severityRank[*sub.MinSeverity] {
+		return false
+	}
+
+	return true
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Event is the JSON body sent to webhook receivers
+type Event struct {
+	ID              string          `json:"id"`
+	EventType       string          `json:"event_type"`
+	EventCategory   string          `json:"event_category"`
+	Severity        string          `json:"severity"`
+	UserID          *string         `json:"user_id,omitempty"`
+	SessionID       *string         `json:"session_id,omitempty"`
+	DeviceID        *string         `json:"device_id,omitempty"`
+	IPAddress       *string         `json:"ip_address,omitempty"`
+	UserAgent       *string         `json:"user_agent,omitempty"`
+	LocationCountry *string         `json:"location_country,omitempty"`
+	LocationCity    *string         `json:"location_city,omitempty"`
+	Metadata        json.RawMessage `json:"metadata,omitempty"`
+	Success         bool            `json:"success"`
+	FailureReason   *string         `json:"failure_reason,omitempty"`
+	CreatedAt       string          `json:"created_at"`
+}
+
+// NewEvent builds the webhook payload for an audit log entry
+func NewEvent(log *models.AuditLog) *Event {
+	event := &Event{
+		ID:              log.ID,
+		EventType:       log.EventType,
+		EventCategory:   log.EventCategory,
+		Severity:        log.Severity,
+		UserID:          log.UserID,
+		SessionID:       log.SessionID,
+		DeviceID:        log.DeviceID,
+		IPAddress:       log.IPAddress,
+		UserAgent:       log.UserAgent,
+		LocationCountry: log.LocationCountry,
+		LocationCity:    log.LocationCity,
+		Success:         log.Success,
+		FailureReason:   log.FailureReason,
+		CreatedAt:       log.CreatedAt.Format(time.RFC3339Nano),
+	}
+
+	// Metadata is stored as JSON, pass it through as an object rather than a string
+	if log.Metadata != nil && json.Valid([]byte(*log.Metadata)) {
+		event.Metadata = json.RawMessage(*log.Metadata)
+	}
+
+	return event
+}
@@ -0,0 +1,108 @@
+// Command grant-role grants a role to a user, or takes it away, straight in
+// the database. It is how the first admin is made; the change is audited and
+// takes effect the next time the user signs in or refreshes their token.
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/joho/godotenv"
+	_ "github.com/lib/pq"
+
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/audit"
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/models"
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/repository"
+)
+
+func main() {
+	email := flag.String("email", "", "Email of the user")
+	role := flag.String("role", "", "Role to grant, e.g. admin or security_analyst")
+	revoke := flag.Bool("revoke", false, "Take the role away instead of granting it")
+	flag.Parse()
+
+	if *email == "" || *role == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	godotenv.Load()
+
+	db, err := sql.Open("postgres", fmt.Sprintf(
+		"host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
+		getEnv("DB_HOST", "localhost"),
+		getEnv("DB_PORT", "5432"),
+		getEnv("DB_USER", "admin"),
+		getEnv("DB_PASSWORD", "admin123"),
+		getEnv("DB_NAME", "session_management"),
+	))
+	if err != nil {
+		log.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	repo := repository.NewUserRepository(db)
+
+	user, err := repo.GetUserByEmail(*email)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		log.Fatalf("No user with email %s", *email)
+	}
+	if err != nil {
+		log.Fatalf("Failed to look up user: %v", err)
+	}
+
+	eventType := "role_granted"
+	if *revoke {
+		eventType = "role_revoked"
+		held, err := repo.RevokeRole(user.ID, *role)
+		if err != nil {
+			log.Fatalf("Failed to revoke role: %v", err)
+		}
+		if !held {
+			fmt.Printf("%s does not have the %s role\n", *email, *role)
+			return
+		}
+	} else {
+		err := repo.GrantRole(user.ID, *role, "grant-role")
+		if errors.Is(err, repository.ErrRoleNotFound) {
+			log.Fatalf("No role named %s", *role)
+		}
+		if err != nil {
+			log.Fatalf("Failed to grant role: %v", err)
+		}
+	}
+
+	// The event waits in the outbox until the auth service relays it
+	metadata := fmt.Sprintf(`{"role":%q,"changed_by":"grant-role"}`, *role)
+	audit.NewOutbox(db, nil).Record(&models.AuditLog{
+		ID:            uuid.New().String(),
+		UserID:        &user.ID,
+		EventType:     eventType,
+		EventCategory: "authorization",
+		Severity:      "warning",
+		Metadata:      &metadata,
+		Success:       true,
+		CreatedAt:     time.Now(),
+	})
+
+	if *revoke {
+		fmt.Printf("Revoked %s from %s\n", *role, *email)
+	} else {
+		fmt.Printf("Granted %s to %s\n", *role, *email)
+	}
+}
+
+// getEnv gets an environment variable or returns a default value
+func getEnv(key, defaultValue string) string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
@@ -1,12 +1,16 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
 	"net"
+	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
@@ -15,8 +19,14 @@ import (
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/reflection"
 
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/audit"
 	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/handlers"
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/identity"
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/oauthserver"
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/oidc"
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/saml"
 	pb "github.com/aashiq-04/session-management-system/backend/services/auth-service/proto"
+	auditpb "github.com/aashiq-04/session-management-system/backend/services/auth-service/proto/audit"
 )
 
 func main() {
@@ -37,16 +47,125 @@ func main() {
 
 	log.Println("Successfully connected to database")
 
-	// Create gRPC server
-	grpcServer := grpc.NewServer()
+	// Calls between services are authenticated with mTLS, and calls made on
+	// behalf of a user carry an identity token signed by the gateway
+	serverCreds, err := identity.ServerCredentials(config.TLSCertFile, config.TLSKeyFile, config.TLSCAFile)
+	if err != nil {
+		log.Fatalf("Failed to load TLS credentials: %v", err)
+	}
+	clientCreds, err := identity.ClientCredentials(config.TLSCertFile, config.TLSKeyFile, config.TLSCAFile)
+	if err != nil {
+		log.Fatalf("Failed to load TLS credentials: %v", err)
+	}
+	identityKey, err := identity.LoadPublicKey(config.IdentityPublicKeyFile)
+	if err != nil {
+		log.Fatalf("Failed to load identity public key: %v", err)
+	}
+
+	// Audit events are kept in a local outbox and relayed to the audit service,
+	// so they survive the audit service being down
+	auditConn, err := grpc.Dial(config.AuditServiceURL, grpc.WithTransportCredentials(clientCreds))
+	if err != nil {
+		log.Fatalf("Failed to connect to audit service: %v", err)
+	}
+	defer auditConn.Close()
+
+	auditCtx, stopAudit := context.WithCancel(context.Background())
+	defer stopAudit()
+	auditClient := auditpb.NewAuditServiceClient(auditConn)
+	auditOutbox := audit.NewOutbox(db, auditClient)
+	go auditOutbox.Run(auditCtx)
+
+	// Identity providers users can sign in with besides their password
+	var identityProviders []*oidc.Provider
+	for _, providerConfig := range config.IdentityProviders {
+		provider, err := oidc.NewProvider(providerConfig)
+		if err != nil {
+			log.Fatalf("Invalid identity provider: %v", err)
+		}
+		identityProviders = append(identityProviders, provider)
+		log.Printf("Federated login enabled with %s", providerConfig.Name)
+	}
+
+	// With an issuer set, the service is also an OpenID Connect provider
+	// for internal apps
+	var oauthServer *handlers.OAuthServerConfig
+	if config.OAuthIssuer != "" {
+		signingKey, err := oauthserver.LoadSigningKey(config.OAuthSigningKeyFile)
+		if err != nil {
+			log.Fatalf("Failed to load OAuth signing key: %v", err)
+		}
+		oauthServer = &handlers.OAuthServerConfig{
+			Tokens:     oauthserver.NewTokens(config.OAuthIssuer, signingKey),
+			ConsentURL: config.OAuthConsentURL,
+		}
+	}
+
+	// With a base URL set, the service is also a SAML service provider for
+	// organizations that connect their identity provider
+	var samlConfig *handlers.SAMLConfig
+	if config.SAMLBaseURL != "" {
+		samlConfig = &handlers.SAMLConfig{
+			ServiceProvider: saml.ServiceProvider{
+				EntityID: config.SAMLBaseURL + "/saml/metadata",
+				ACSURL:   config.SAMLBaseURL + "/saml/acs",
+			},
+			MetadataURL:      config.SAMLBaseURL + "/saml/metadata",
+			LoginRedirectURL: config.SAMLLoginRedirectURL,
+		}
+	}
+
+	authHandler := handlers.NewAuthHandler(db, auditOutbox, auditClient, config.MFATrustTTL, config.AccountDeletionGracePeriod, identityProviders, oauthServer, samlConfig)
+
+	// Accounts whose owners asked for deletion are deleted once their grace
+	// period is over
+	go authHandler.RunScheduledDeletions(auditCtx, config.AccountDeletionCheckInterval)
+
+	// Create gRPC server; refused calls are recorded as audit events
+	authenticator := identity.NewAuthenticator(handlers.Policy, identity.NewVerifier(identityKey, identity.AuthService), authHandler.RecordDenial)
+	grpcServer := grpc.NewServer(
+		grpc.Creds(serverCreds),
+		grpc.UnaryInterceptor(authenticator.UnaryInterceptor()),
+		grpc.StreamInterceptor(authenticator.StreamInterceptor()),
+	)
 
 	// Register auth service
-	authHandler := handlers.NewAuthHandler(db)
 	pb.RegisterAuthServiceServer(grpcServer, authHandler)
 
 	// Enable reflection for grpcurl/grpc-ui
 	reflection.Register(grpcServer)
 
+	// The OpenID Connect and SAML endpoints are served over HTTP, and apps
+	// are told when a session they signed in with ends
+	httpMux := http.NewServeMux()
+	if oauthServer != nil {
+		httpMux.Handle("/", authHandler.OAuthRoutes())
+		go oauthserver.NewLogoutNotifier(db, oauthServer.Tokens).Run(auditCtx)
+
+		log.Printf("OpenID Connect provider %s enabled", config.OAuthIssuer)
+	}
+	if samlConfig != nil {
+		httpMux.Handle("/saml/", authHandler.SAMLRoutes())
+
+		log.Printf("SAML service provider %s enabled", samlConfig.ServiceProvider.EntityID)
+	}
+
+	var httpServer *http.Server
+	if oauthServer != nil || samlConfig != nil {
+		httpServer = &http.Server{
+			Addr:              fmt.Sprintf(":%s", config.HTTPPort),
+			Handler:           httpMux,
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+		go func() {
+			if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("Failed to serve HTTP endpoints: %v", err)
+			}
+		}()
+
+		log.Printf("HTTP endpoints listening on port %s", config.HTTPPort)
+	}
+
 	// Start listening
 	listener, err := net.Listen("tcp", fmt.Sprintf(":%s", config.GRPCPort))
 	if err != nil {
@@ -63,6 +182,12 @@ func main() {
 
 		log.Println("Shutting down Auth Service...")
 		grpcServer.GracefulStop()
+		if httpServer != nil {
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			httpServer.Shutdown(shutdownCtx)
+			cancel()
+		}
+		stopAudit()
 		log.Println("Auth Service stopped")
 	}()
 
@@ -81,6 +206,21 @@ type Config struct {
 	DBName    string
 	GRPCPort  string
 	JWTSecret string
+	AuditServiceURL string
+	TLSCertFile     string
+	TLSKeyFile      string
+	TLSCAFile       string
+	IdentityPublicKeyFile string
+	MFATrustTTL time.Duration
+	AccountDeletionGracePeriod   time.Duration
+	AccountDeletionCheckInterval time.Duration
+	IdentityProviders            []oidc.Config
+	HTTPPort             string // for the OpenID Connect and SAML endpoints
+	OAuthIssuer          string // empty disables the OpenID Connect provider
+	OAuthSigningKeyFile  string
+	OAuthConsentURL      string
+	SAMLBaseURL          string // empty disables SAML login
+	SAMLLoginRedirectURL string
 }
 
 // loadConfig loads configuration from environment variables
@@ -93,6 +233,19 @@ func loadConfig() Config {
 		DBName:    getEnv("DB_NAME", "session_management"),
 		GRPCPort:  getEnv("GRPC_PORT", "50051"),
 		JWTSecret: getEnv("JWT_SECRET", ""),
+		AuditServiceURL: getEnv("AUDIT_SERVICE_URL", "localhost:50053"),
+		TLSCertFile:     getEnv("TLS_CERT_FILE", ""),
+		TLSKeyFile:      getEnv("TLS_KEY_FILE", ""),
+		TLSCAFile:       getEnv("TLS_CA_FILE", ""),
+		IdentityPublicKeyFile: getEnv("IDENTITY_PUBLIC_KEY_FILE", ""),
+	}
+
+	// Certificates and keys are made by scripts/dev-certs.sh in development
+	if config.TLSCertFile == "" || config.TLSKeyFile == "" || config.TLSCAFile == "" {
+		log.Fatal("TLS_CERT_FILE, TLS_KEY_FILE and TLS_CA_FILE environment variables are required")
+	}
+	if config.IdentityPublicKeyFile == "" {
+		log.Fatal("IDENTITY_PUBLIC_KEY_FILE environment variable is required")
 	}
 
 	// Validate required config
@@ -100,9 +253,98 @@ func loadConfig() Config {
 		log.Fatal("JWT_SECRET environment variable is required")
 	}
 
+	// How long a remembered device may skip MFA; "0" disables the bypass
+	mfaTrustTTL, err := time.ParseDuration(getEnv("MFA_TRUST_TTL", "720h"))
+	if err != nil {
+		log.Fatalf("Invalid MFA_TRUST_TTL: %v", err)
+	}
+	config.MFATrustTTL = mfaTrustTTL
+
+	// How long users can cancel deleting their account, and how often due
+	// deletions are carried out
+	gracePeriod, err := time.ParseDuration(getEnv("ACCOUNT_DELETION_GRACE_PERIOD", "720h"))
+	if err != nil || gracePeriod < 0 {
+		log.Fatalf("Invalid ACCOUNT_DELETION_GRACE_PERIOD: %s", getEnv("ACCOUNT_DELETION_GRACE_PERIOD", "720h"))
+	}
+	config.AccountDeletionGracePeriod = gracePeriod
+
+	checkInterval, err := time.ParseDuration(getEnv("ACCOUNT_DELETION_CHECK_INTERVAL", "1h"))
+	if err != nil || checkInterval <= 0 {
+		log.Fatalf("Invalid ACCOUNT_DELETION_CHECK_INTERVAL: %s", getEnv("ACCOUNT_DELETION_CHECK_INTERVAL", "1h"))
+	}
+	config.AccountDeletionCheckInterval = checkInterval
+
+	config.IdentityProviders = loadIdentityProviders()
+
+	// The OpenID Connect provider signs its tokens with an RSA key made by
+	// scripts/dev-certs.sh in development, and sends users to the
+	// frontend's consent page
+	config.HTTPPort = getEnv("HTTP_PORT", "8081")
+	config.OAuthIssuer = getEnv("OAUTH_ISSUER", "")
+	config.OAuthSigningKeyFile = getEnv("OAUTH_SIGNING_KEY_FILE", "")
+	config.OAuthConsentURL = getEnv("OAUTH_CONSENT_URL", "")
+	if config.OAuthIssuer != "" {
+		if issuer, err := url.Parse(config.OAuthIssuer); err != nil || (issuer.Scheme != "https" && issuer.Scheme != "http") || issuer.Host == "" || issuer.RawQuery != "" || issuer.Fragment != "" {
+			log.Fatalf("Invalid OAUTH_ISSUER: %s", config.OAuthIssuer)
+		}
+		if config.OAuthSigningKeyFile == "" || config.OAuthConsentURL == "" {
+			log.Fatal("OAUTH_SIGNING_KEY_FILE and OAUTH_CONSENT_URL environment variables are required with OAUTH_ISSUER")
+		}
+	}
+
+	// The SAML endpoints are served under the base URL, and users are sent
+	// back to the frontend's login page to finish signing in
+	config.SAMLBaseURL = strings.TrimSuffix(getEnv("SAML_SP_BASE_URL", ""), "/")
+	config.SAMLLoginRedirectURL = getEnv("SAML_LOGIN_REDIRECT_URL", "")
+	if config.SAMLBaseURL != "" {
+		if base, err := url.Parse(config.SAMLBaseURL); err != nil || (base.Scheme != "https" && base.Scheme != "http") || base.Host == "" || base.RawQuery != "" || base.Fragment != "" {
+			log.Fatalf("Invalid SAML_SP_BASE_URL: %s", config.SAMLBaseURL)
+		}
+		if config.SAMLLoginRedirectURL == "" {
+			log.Fatal("SAML_LOGIN_REDIRECT_URL environment variable is required with SAML_SP_BASE_URL")
+		}
+	}
+
 	return config
 }
 
+// loadIdentityProviders reads the identity providers named in
+// OIDC_PROVIDERS, each configured by OIDC_<NAME>_* variables. A provider
+// named github uses GitHub's OAuth API; the others are OpenID Connect
+// providers, with google defaulting to Google's issuer.
+func loadIdentityProviders() []oidc.Config {
+	var providers []oidc.Config
+	for _, name := range strings.Split(getEnv("OIDC_PROVIDERS", ""), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+
+		provider := oidc.Config{
+			Name:         name,
+			Kind:         oidc.KindOIDC,
+			Issuer:       getEnv(prefix+"ISSUER", ""),
+			ClientID:     getEnv(prefix+"CLIENT_ID", ""),
+			ClientSecret: getEnv(prefix+"CLIENT_SECRET", ""),
+			RedirectURL:  getEnv(prefix+"REDIRECT_URL", ""),
+			Scopes:       strings.Fields(getEnv(prefix+"SCOPES", "")),
+			APIURL:       getEnv(prefix+"API_URL", ""),
+		}
+		if name == "github" {
+			provider.Kind = oidc.KindGitHub
+		}
+		if name == "google" && provider.Issuer == "" {
+			provider.Issuer = oidc.GoogleIssuer
+		}
+		if provider.ClientSecret == "" {
+			log.Fatalf("%sCLIENT_SECRET environment variable is required", prefix)
+		}
+		providers = append(providers, provider)
+	}
+	return providers
+}
+
 // getEnv gets an environment variable or returns a default value
 func getEnv(key, defaultValue string) string {
 	value := os.Getenv(key)
@@ -0,0 +1,254 @@
+// Package audit sends audit events and security alerts to the audit service
+// through a durable local outbox
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/models"
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/repository"
+	auditpb "github.com/aashiq-04/session-management-system/backend/services/auth-service/proto/audit"
+)
+
+const (
+	// source identifies this service's events in the shared outbox table
+	source = "auth-service"
+
+	pollInterval = 5 * time.Second
+	batchSize    = 100
+	sendTimeout  = 5 * time.Second
+
+	// claimLease hides claimed events from other instances while they are being sent
+	claimLease = 30 * time.Second
+
+	// maxRejections is how many times the audit service may reject an event
+	// before it is parked as failed. Connection errors never park an event.
+	maxRejections = 10
+
+	maxRetryBackoff = 5 * time.Minute
+)
+
+// Outbox records audit events and security alerts in the database and relays
+// them to the audit service
+type Outbox struct {
+	repo   *repository.UserRepository
+	client auditpb.AuditServiceClient
+	wake   chan struct{}
+}
+
+// NewOutbox creates a new audit outbox
+func NewOutbox(db *sql.DB, client auditpb.AuditServiceClient) *Outbox {
+	return &Outbox{
+		repo:   repository.NewUserRepository(db),
+		client: client,
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+// Record stores an audit event and wakes the relay to send it right away
+func (o *Outbox) Record(entry *models.AuditLog) {
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+
+	if err := o.repo.EnqueueAuditEvent(source, entry); err != nil {
+		log.Printf("Failed to record audit event %s: %v", entry.EventType, err)
+		return
+	}
+
+	o.notify()
+}
+
+// RecordAlert stores a security alert and wakes the relay to send it right away
+func (o *Outbox) RecordAlert(alert *models.SecurityAlert) {
+	if alert.CreatedAt.IsZero() {
+		alert.CreatedAt = time.Now()
+	}
+
+	if err := o.repo.EnqueueSecurityAlert(source, alert); err != nil {
+		log.Printf("Failed to record security alert %s: %v", alert.AlertType, err)
+		return
+	}
+
+	o.notify()
+}
+
+// notify wakes the relay without waiting for it
+func (o *Outbox) notify() {
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run relays outbox events to the audit service until ctx is cancelled
+func (o *Outbox) Run(ctx context.Context) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		o.relay(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-o.wake:
+		}
+	}
+}
+
+// relay sends a batch of due events, stopping early if the audit service is unreachable
+func (o *Outbox) relay(ctx context.Context) {
+	events, err := o.repo.ClaimAuditEvents(source, batchSize, claimLease)
+	if err != nil {
+		log.Printf("Failed to claim audit events: %v", err)
+		return
+	}
+
+	for i := range events {
+		if ctx.Err() != nil {
+			return
+		}
+
+		event := &events[i]
+		var rejection string
+		var err error
+		if event.Kind == models.OutboxKindSecurityAlert {
+			rejection, err = o.sendAlert(ctx, &event.Alert)
+		} else {
+			rejection, err = o.send(ctx, &event.Event)
+		}
+		if err == nil && rejection == "" {
+			if err := o.repo.DeleteAuditEvent(event.ID); err != nil {
+				log.Printf("Failed to delete relayed audit event %s: %v", event.ID, err)
+			}
+			continue
+		}
+
+		attempts := event.Attempts + 1
+		next := time.Now().Add(backoff(attempts))
+
+		if err != nil {
+			// The audit service is down or unreachable; keep the event and try the rest later
+			log.Printf("Failed to send audit event %s (attempt %d): %v", event.ID, attempts, err)
+			if err := o.repo.MarkAuditEventFailed(event.ID, err.Error(), &next); err != nil {
+				log.Printf("Failed to record audit event attempt %s: %v", event.ID, err)
+			}
+			return
+		}
+
+		nextAttemptAt := &next
+		if attempts >= maxRejections {
+			nextAttemptAt = nil
+			log.Printf("Audit event %s (%s) rejected, giving up: %s", event.ID, describe(event), rejection)
+		} else {
+			log.Printf("Audit event %s (%s) rejected (attempt %d): %s", event.ID, describe(event), attempts, rejection)
+		}
+		if err := o.repo.MarkAuditEventFailed(event.ID, rejection, nextAttemptAt); err != nil {
+			log.Printf("Failed to record audit event attempt %s: %v", event.ID, err)
+		}
+	}
+}
+
+// send delivers one event, returning the audit service's message if it refused it
+func (o *Outbox) send(ctx context.Context, entry *models.AuditLog) (string, error) {
+	sendCtx, cancel := context.WithTimeout(ctx, sendTimeout)
+	defer cancel()
+
+	_, err := o.client.CreateAuditLog(sendCtx, &auditpb.CreateAuditLogRequest{
+		Id:              entry.ID,
+		UserId:          deref(entry.UserID),
+		SessionId:       deref(entry.SessionID),
+		DeviceId:        deref(entry.DeviceID),
+		EventType:       entry.EventType,
+		EventCategory:   entry.EventCategory,
+		Severity:        entry.Severity,
+		IpAddress:       deref(entry.IPAddress),
+		UserAgent:       deref(entry.UserAgent),
+		LocationCountry: deref(entry.LocationCountry),
+		LocationCity:    deref(entry.LocationCity),
+		Metadata:        deref(entry.Metadata),
+		Success:         entry.Success,
+		FailureReason:   deref(entry.FailureReason),
+		CreatedAt:       entry.CreatedAt.Format(time.RFC3339Nano),
+	})
+	return rejected(err)
+}
+
+// sendAlert delivers one security alert, returning the audit service's message
+// if it refused it
+func (o *Outbox) sendAlert(ctx context.Context, alert *models.SecurityAlert) (string, error) {
+	sendCtx, cancel := context.WithTimeout(ctx, sendTimeout)
+	defer cancel()
+
+	_, err := o.client.CreateSecurityAlert(sendCtx, &auditpb.CreateSecurityAlertRequest{
+		Id:              alert.ID,
+		UserId:          alert.UserID,
+		AlertType:       alert.AlertType,
+		Severity:        alert.Severity,
+		Description:     alert.Description,
+		Metadata:        deref(alert.Metadata),
+		IpAddress:       deref(alert.IPAddress),
+		LocationCountry: deref(alert.LocationCountry),
+		LocationCity:    deref(alert.LocationCity),
+		CreatedAt:       alert.CreatedAt.Format(time.RFC3339Nano),
+	})
+	return rejected(err)
+}
+
+// rejected splits a send error into the audit service refusing the event,
+// returned as its message, and a failure to reach it, returned as an error
+func rejected(err error) (string, error) {
+	if err == nil {
+		return "", nil
+	}
+	if retryable(err) {
+		return "", err
+	}
+	return err.Error(), nil
+}
+
+// retryable reports whether a failed send should be retried without counting
+// as a rejection: the audit service was unreachable, busy or timed out, rather
+// than refusing the event itself
+func retryable(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Canceled, codes.ResourceExhausted, codes.Aborted:
+		return true
+	}
+	return false
+}
+
+// backoff returns the delay before the next attempt after the given number of failures
+func backoff(attempts int) time.Duration {
+	delay := time.Second
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= maxRetryBackoff {
+			return maxRetryBackoff
+		}
+	}
+	return delay
+}
+
+// describe names an outbox event for the logs
+func describe(event *models.AuditOutboxEvent) string {
+	if event.Kind == models.OutboxKindSecurityAlert {
+		return event.Alert.AlertType + " alert"
+	}
+	return event.Event.EventType
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,223 @@
+package audit
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/models"
+	auditpb "github.com/aashiq-04/session-management-system/backend/services/auth-service/proto/audit"
+)
+
+// fakeAuditClient records what the relay sends, answering with err
+type fakeAuditClient struct {
+	auditpb.AuditServiceClient
+
+	err    error
+	logs   []*auditpb.CreateAuditLogRequest
+	alerts []*auditpb.CreateSecurityAlertRequest
+}
+
+func (c *fakeAuditClient) CreateAuditLog(ctx context.Context, req *auditpb.CreateAuditLogRequest, opts ...grpc.CallOption) (*auditpb.CreateAuditLogResponse, error) {
+	c.logs = append(c.logs, req)
+	if c.err != nil {
+		return nil, c.err
+	}
+	return &auditpb.CreateAuditLogResponse{Success: true, LogId: req.Id}, nil
+}
+
+func (c *fakeAuditClient) CreateSecurityAlert(ctx context.Context, req *auditpb.CreateSecurityAlertRequest, opts ...grpc.CallOption) (*auditpb.CreateSecurityAlertResponse, error) {
+	c.alerts = append(c.alerts, req)
+	if c.err != nil {
+		return nil, c.err
+	}
+	return &auditpb.CreateSecurityAlertResponse{Success: true, AlertId: req.Id}, nil
+}
+
+// newTestOutbox returns an outbox on a mock database, which fails the test on
+// any statement not expected of it
+func newTestOutbox(t *testing.T, client auditpb.AuditServiceClient) (*Outbox, sqlmock.Sqlmock) {
+	t.Helper()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+		db.Close()
+	})
+
+	return NewOutbox(db, client), mock
+}
+
+var testTime = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func testAlert() *models.SecurityAlert {
+	ip, country := "203.0.113.7", "FR"
+	metadata := `{"distance_km":950}`
+	return &models.SecurityAlert{
+		ID:              "6f1c1d8e-3b7a-4c7e-9d55-0a6f1e2b3c4d",
+		UserID:          "9b2d6a3e-1f4c-4e8a-b6d7-2c3e4f5a6b7c",
+		AlertType:       "impossible_travel",
+		Severity:        "high",
+		Description:     "Login from two countries within an hour",
+		Metadata:        &metadata,
+		IPAddress:       &ip,
+		LocationCountry: &country,
+		CreatedAt:       testTime,
+	}
+}
+
+// jsonOf matches an argument holding v encoded as JSON
+type jsonOf struct {
+	v any
+}
+
+func (m jsonOf) Match(arg driver.Value) bool {
+	want, err := json.Marshal(m.v)
+	if err != nil {
+		return false
+	}
+	got, ok := arg.([]byte)
+	return ok && string(got) == string(want)
+}
+
+// retryTime matches the time of an event's next attempt
+type retryTime struct{}
+
+func (retryTime) Match(arg driver.Value) bool {
+	next, ok := arg.(time.Time)
+	return ok && next.After(time.Now())
+}
+
+// claimedRows returns outbox rows as ClaimAuditEvents reads them
+func claimedRows(events ...models.AuditOutboxEvent) *sqlmock.Rows {
+	rows := sqlmock.NewRows([]string{"id", "kind", "event", "attempts", "created_at"})
+	for _, e := range events {
+		var event []byte
+		if e.Kind == models.OutboxKindSecurityAlert {
+			event, _ = json.Marshal(e.Alert)
+		} else {
+			event, _ = json.Marshal(e.Event)
+		}
+		rows.AddRow(e.ID, e.Kind, event, e.Attempts, e.CreatedAt)
+	}
+	return rows
+}
+
+func TestRecordAlert(t *testing.T) {
+	outbox, mock := newTestOutbox(t, nil)
+	alert := testAlert()
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO audit_outbox (id, source, kind, event, created_at)")).
+		WithArgs(alert.ID, "auth-service", models.OutboxKindSecurityAlert, jsonOf{alert}, testTime).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	outbox.RecordAlert(alert)
+
+	select {
+	case <-outbox.wake:
+	default:
+		t.Error("recording an alert didn't wake the relay")
+	}
+}
+
+// Audit events and alerts share the outbox, and each goes to its own RPC with
+// the ID and time it was recorded with, so a redelivery is idempotent
+func TestRelaySendsAlertsAndEvents(t *testing.T) {
+	client := &fakeAuditClient{}
+	outbox, mock := newTestOutbox(t, client)
+
+	userID := "9b2d6a3e-1f4c-4e8a-b6d7-2c3e4f5a6b7c"
+	alert := testAlert()
+	entry := models.AuditLog{
+		ID:            "1d2e3f4a-5b6c-4d7e-8f9a-0b1c2d3e4f5a",
+		UserID:        &userID,
+		EventType:     "login_success",
+		EventCategory: "authentication",
+		Severity:      "info",
+		Success:       true,
+		CreatedAt:     testTime,
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta("UPDATE audit_outbox")).
+		WithArgs(sqlmock.AnyArg(), "auth-service", sqlmock.AnyArg(), batchSize).
+		WillReturnRows(claimedRows(
+			models.AuditOutboxEvent{ID: entry.ID, Kind: models.OutboxKindAuditLog, Event: entry, CreatedAt: testTime},
+			models.AuditOutboxEvent{ID: alert.ID, Kind: models.OutboxKindSecurityAlert, Alert: *alert, CreatedAt: testTime.Add(time.Second)},
+		))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM audit_outbox")).WithArgs(entry.ID).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM audit_outbox")).WithArgs(alert.ID).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	outbox.relay(context.Background())
+
+	if len(client.logs) != 1 || client.logs[0].Id != entry.ID || client.logs[0].EventType != "login_success" {
+		t.Errorf("sent audit logs %v, want %s", client.logs, entry.ID)
+	}
+	if len(client.alerts) != 1 {
+		t.Fatalf("sent %d alerts, want 1", len(client.alerts))
+	}
+	want := &auditpb.CreateSecurityAlertRequest{
+		Id:              alert.ID,
+		UserId:          alert.UserID,
+		AlertType:       "impossible_travel",
+		Severity:        "high",
+		Description:     "Login from two countries within an hour",
+		Metadata:        `{"distance_km":950}`,
+		IpAddress:       "203.0.113.7",
+		LocationCountry: "FR",
+		CreatedAt:       "2026-03-01T12:00:00Z",
+	}
+	if got := client.alerts[0]; !proto.Equal(got, want) {
+		t.Errorf("sent alert %v, want %v", got, want)
+	}
+}
+
+func TestRelayKeepsUndeliveredAlert(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		attempts int
+		parked   bool // marked failed rather than retried
+	}{
+		{"audit service unreachable", status.Error(codes.Unavailable, "connection refused"), maxRejections - 1, false},
+		{"alert rejected", status.Error(codes.InvalidArgument, "Invalid security alert"), 0, false},
+		{"alert rejected too often", status.Error(codes.InvalidArgument, "Invalid security alert"), maxRejections - 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fakeAuditClient{err: tt.err}
+			outbox, mock := newTestOutbox(t, client)
+			alert := testAlert()
+
+			mock.ExpectQuery(regexp.QuoteMeta("UPDATE audit_outbox")).
+				WillReturnRows(claimedRows(models.AuditOutboxEvent{ID: alert.ID, Kind: models.OutboxKindSecurityAlert, Alert: *alert, Attempts: tt.attempts, CreatedAt: testTime}))
+
+			var nextAttemptAt driver.Value = retryTime{}
+			if tt.parked {
+				nextAttemptAt = nil
+			}
+			mock.ExpectExec(regexp.QuoteMeta("SET attempts = attempts + 1")).
+				WithArgs(tt.err.Error(), nextAttemptAt, alert.ID).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+
+			outbox.relay(context.Background())
+
+			if len(client.alerts) != 1 {
+				t.Errorf("sent %d alerts, want 1", len(client.alerts))
+			}
+		})
+	}
+}
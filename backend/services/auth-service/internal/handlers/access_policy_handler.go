@@ -0,0 +1,405 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/grpcerr"
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/identity"
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/models"
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/repository"
+	pb "github.com/aashiq-04/session-management-system/backend/services/auth-service/proto"
+)
+
+// Reasons reported in ErrorInfo when an access policy refuses a sign-in
+const (
+	reasonAccessPolicyViolation = "ACCESS_POLICY_VIOLATION"
+	reasonStepUpRequired        = "STEP_UP_REQUIRED"
+)
+
+// Outcomes of a policy violation, recorded with it
+const (
+	outcomeBlocked        = "blocked"
+	outcomeStepUp         = "step_up"          // the MFA code was asked for again
+	outcomeSignInRequired = "sign_in_required" // a refresh was refused until the user signs in again
+)
+
+// Stages at which policies are checked
+const (
+	stageLogin            = "login"
+	stageTokenRefresh     = "token_refresh"
+	stageAPIToken         = "api_token" // a call made with an API token
+	stageReauthentication = "reauthentication"
+)
+
+// checkSignInLocation returns the violation, if any, of user signing in from
+// ip in country under org's allowlists and the access policies that apply to
+// them. Policies that block win over those that step up.
+func (h *AuthHandler) checkSignInLocation(org *models.Organization, user *models.User, ip, country string) (*policyViolation, error) {
+	if violation := checkNetworkPolicy(org, ip, country); violation != nil {
+		return violation, nil
+	}
+
+	policies, err := h.repo.GetAccessPolicies(org.ID, user.ID)
+	if err != nil {
+		log.Printf("Failed to get access policies: %v", err)
+		return nil, grpcerr.Storage("Failed to check access policies", err)
+	}
+
+	var stepUp *policyViolation
+	for i := range policies {
+		policy := &policies[i]
+		rule := brokenAccessRule(policy, ip, country)
+		if rule == "" {
+			continue
+		}
+
+		violation := &policyViolation{
+			reason:        reasonAccessPolicyViolation,
+			failureReason: rule,
+			message:       "Signing in from here is not allowed by your organization",
+			policyID:      policy.ID,
+			policyName:    policy.Name,
+			action:        policy.Action,
+		}
+		if policy.Action != models.AccessPolicyStepUp {
+			return violation, nil
+		}
+		if stepUp == nil {
+			stepUp = violation
+		}
+	}
+
+	return stepUp, nil
+}
+
+// brokenAccessRule returns the rule of policy that signing in from ip in
+// country breaks, or "" if none. Missing values fail an allow list that is
+// set, and match no deny list.
+func brokenAccessRule(policy *models.AccessPolicy, ip, country string) string {
+	if rule := brokenNetworkRule(policy, ip); rule != "" {
+		return rule
+	}
+	if countryInList(policy.CountryDenylist, country) {
+		return "country_denied"
+	}
+	if len(policy.CountryAllowlist) > 0 && !countryInList(policy.CountryAllowlist, country) {
+		return "country_not_allowed"
+	}
+	return ""
+}
+
+// brokenNetworkRule returns the network rule of policy that ip breaks, or ""
+func brokenNetworkRule(policy *models.AccessPolicy, ip string) string {
+	if ipInNetworks(policy.IPDenylist, ip) {
+		return "ip_denied"
+	}
+	if len(policy.IPAllowlist) > 0 && !ipInNetworks(policy.IPAllowlist, ip) {
+		return "ip_not_allowed"
+	}
+	return ""
+}
+
+// recordPolicyViolation records a broken network or country rule as a
+// policy_violation audit event and a security alert for the user
+func (h *AuthHandler) recordPolicyViolation(user *models.User, sessionID *string, stage, ip, country string, violation *policyViolation, outcome string) {
+	metadata, _ := json.Marshal(map[string]interface{}{
+		"policy_id":   violation.policyID,
+		"policy_name": violation.policyName,
+		"rule":        violation.failureReason,
+		"action":      violation.action,
+		"stage":       stage,
+		"outcome":     outcome,
+	})
+	metadataStr := string(metadata)
+
+	severity := "warning"
+	alertSeverity := "medium"
+	if outcome != outcomeStepUp {
+		severity = "critical"
+		alertSeverity = "high"
+	}
+
+	h.createAuditLog(&models.AuditLog{
+		ID:              uuid.New().String(),
+		UserID:          &user.ID,
+		SessionID:       sessionID,
+		EventType:       "policy_violation",
+		EventCategory:   "security",
+		Severity:        severity,
+		IPAddress:       strPtr(ip),
+		LocationCountry: strPtr(country),
+		Metadata:        &metadataStr,
+		Success:         false,
+		FailureReason:   &violation.failureReason,
+		CreatedAt:       time.Now(),
+	})
+
+	attempt := "Sign-in"
+	switch stage {
+	case stageTokenRefresh:
+		attempt = "Token refresh"
+	case stageAPIToken:
+		attempt = "API token use"
+	case stageReauthentication:
+		attempt = "Reauthentication"
+	}
+
+	alert := &models.SecurityAlert{
+		ID:              uuid.New().String(),
+		UserID:          user.ID,
+		AlertType:       "policy_violation",
+		Severity:        alertSeverity,
+		Description:     fmt.Sprintf("%s broke access policy %q (%s)", attempt, violation.policyName, violation.failureReason),
+		Metadata:        &metadataStr,
+		IPAddress:       strPtr(ip),
+		LocationCountry: strPtr(country),
+		IsResolved:      false,
+		CreatedAt:       time.Now(),
+	}
+
+	h.audit.RecordAlert(alert)
+}
+
+// ListAccessPolicies lists the access policies of an organization, for users
+// with the organizations:manage permission in it
+func (h *AuthHandler) ListAccessPolicies(ctx context.Context, req *pb.ListAccessPoliciesRequest) (*pb.ListAccessPoliciesResponse, error) {
+	log.Printf("ListAccessPolicies request received for %s from %s", req.OrganizationId, identity.ActorFromContext(ctx))
+
+	org, err := h.getTenantOrganization(ctx, req.OrganizationId)
+	if err != nil {
+		return nil, err
+	}
+	if req.UserId != "" {
+		if _, err := uuid.Parse(req.UserId); err != nil {
+			return nil, grpcerr.InvalidArgument("Invalid user ID", grpcerr.Field("user_id", "must be a UUID"))
+		}
+	}
+
+	policies, err := h.repo.GetAccessPolicies(org.ID, req.UserId)
+	if err != nil {
+		log.Printf("Failed to list access policies: %v", err)
+		return nil, grpcerr.Storage("Failed to list access policies", err)
+	}
+
+	pbPolicies := make([]*pb.AccessPolicy, 0, len(policies))
+	for i := range policies {
+		pbPolicies = append(pbPolicies, accessPolicyToProto(&policies[i]))
+	}
+
+	return &pb.ListAccessPoliciesResponse{
+		Success:  true,
+		Message:  "Access policies retrieved",
+		Policies: pbPolicies,
+	}, nil
+}
+
+// CreateAccessPolicy restricts where the members of an organization, or one
+// member, may sign in from, for users with the organizations:manage
+// permission in it. It applies from their next sign-in or token refresh.
+func (h *AuthHandler) CreateAccessPolicy(ctx context.Context, req *pb.CreateAccessPolicyRequest) (*pb.CreateAccessPolicyResponse, error) {
+	actor := identity.ActorFromContext(ctx)
+	log.Printf("CreateAccessPolicy request received for %s from %s", req.OrganizationId, actor)
+
+	org, err := h.getTenantOrganization(ctx, req.OrganizationId)
+	if err != nil {
+		return nil, err
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" || len(name) > 255 {
+		return nil, grpcerr.InvalidArgument("Invalid policy name", grpcerr.Field("name", "must be 1 to 255 characters"))
+	}
+
+	action := req.Action
+	if action == "" {
+		action = models.AccessPolicyBlock
+	}
+	if action != models.AccessPolicyBlock && action != models.AccessPolicyStepUp {
+		return nil, grpcerr.InvalidArgument("Invalid action", grpcerr.Field("action", "must be block or step_up"))
+	}
+
+	policy := &models.AccessPolicy{
+		ID:             uuid.New().String(),
+		OrganizationID: org.ID,
+		Name:           name,
+		Action:         action,
+	}
+
+	if req.UserId != "" {
+		if _, err := uuid.Parse(req.UserId); err != nil {
+			return nil, grpcerr.InvalidArgument("Invalid user ID", grpcerr.Field("user_id", "must be a UUID"))
+		}
+		user, err := h.getTenantUser(ctx, req.UserId)
+		if err != nil {
+			return nil, err
+		}
+		if user.OrganizationID != org.ID {
+			return nil, grpcerr.NotFound("User not found", "user", req.UserId)
+		}
+		policy.UserID = &user.ID
+	}
+
+	if policy.IPAllowlist, err = normalizeNetworks("ip_allowlist", req.IpAllowlist); err != nil {
+		return nil, err
+	}
+	if policy.IPDenylist, err = normalizeNetworks("ip_denylist", req.IpDenylist); err != nil {
+		return nil, err
+	}
+	if policy.CountryAllowlist, err = normalizeCountries("country_allowlist", req.CountryAllowlist); err != nil {
+		return nil, err
+	}
+	if policy.CountryDenylist, err = normalizeCountries("country_denylist", req.CountryDenylist); err != nil {
+		return nil, err
+	}
+	if len(policy.IPAllowlist)+len(policy.IPDenylist)+len(policy.CountryAllowlist)+len(policy.CountryDenylist) == 0 {
+		return nil, grpcerr.InvalidArgument("Access policy has no rules",
+			grpcerr.Field("ip_allowlist", "at least one allow or deny list must be set"))
+	}
+
+	// Refuse a policy that would sign out the admin creating it
+	subject, hasSubject := identity.SubjectFromContext(ctx)
+	tenant, _ := identity.TenantFromContext(ctx)
+	appliesToCaller := hasSubject && tenant == org.ID && (policy.UserID == nil || *policy.UserID == subject)
+	if appliesToCaller && action == models.AccessPolicyBlock && req.IpAddress != "" && brokenNetworkRule(policy, req.IpAddress) != "" {
+		return nil, grpcerr.FailedPrecondition("The policy would block your own address", reasonPolicyExcludesCaller)
+	}
+	if hasSubject {
+		policy.CreatedBy = &subject
+	}
+
+	now := time.Now()
+	policy.CreatedAt = now
+	policy.UpdatedAt = now
+
+	if err := h.repo.CreateAccessPolicy(policy); err != nil {
+		log.Printf("Failed to create access policy: %v", err)
+		return nil, grpcerr.Storage("Failed to create access policy", err)
+	}
+
+	metadata, _ := json.Marshal(map[string]interface{}{
+		"policy_id":         policy.ID,
+		"organization_id":   org.ID,
+		"user_id":           policy.UserID,
+		"name":              policy.Name,
+		"ip_allowlist":      policy.IPAllowlist,
+		"ip_denylist":       policy.IPDenylist,
+		"country_allowlist": policy.CountryAllowlist,
+		"country_denylist":  policy.CountryDenylist,
+		"action":            policy.Action,
+		"created_by":        actor,
+	})
+	metadataStr := string(metadata)
+
+	h.createAuditLog(&models.AuditLog{
+		ID:            uuid.New().String(),
+		UserID:        policy.CreatedBy,
+		EventType:     "access_policy_created",
+		EventCategory: "security",
+		Severity:      "warning",
+		IPAddress:     strPtr(req.IpAddress),
+		Metadata:      &metadataStr,
+		Success:       true,
+		CreatedAt:     now,
+	})
+
+	return &pb.CreateAccessPolicyResponse{
+		Success: true,
+		Message: "Access policy created",
+		Policy:  accessPolicyToProto(policy),
+	}, nil
+}
+
+// DeleteAccessPolicy deletes an access policy, for users with the
+// organizations:manage permission in its organization
+func (h *AuthHandler) DeleteAccessPolicy(ctx context.Context, req *pb.DeleteAccessPolicyRequest) (*pb.DeleteAccessPolicyResponse, error) {
+	actor := identity.ActorFromContext(ctx)
+	log.Printf("DeleteAccessPolicy request received for %s from %s", req.PolicyId, actor)
+
+	org, err := h.getTenantOrganization(ctx, req.OrganizationId)
+	if err != nil {
+		return nil, err
+	}
+
+	notFound := grpcerr.NotFound("Access policy not found", "access_policy", req.PolicyId)
+	if _, err := uuid.Parse(req.PolicyId); err != nil {
+		return nil, notFound
+	}
+
+	policy, err := h.repo.GetAccessPolicy(req.PolicyId)
+	if errors.Is(err, repository.ErrAccessPolicyNotFound) {
+		return nil, notFound
+	}
+	if err != nil {
+		log.Printf("Failed to get access policy: %v", err)
+		return nil, grpcerr.Storage("Failed to get access policy", err)
+	}
+	if policy.OrganizationID != org.ID {
+		return nil, notFound
+	}
+
+	err = h.repo.DeleteAccessPolicy(policy.ID)
+	if errors.Is(err, repository.ErrAccessPolicyNotFound) {
+		return nil, notFound
+	}
+	if err != nil {
+		log.Printf("Failed to delete access policy: %v", err)
+		return nil, grpcerr.Storage("Failed to delete access policy", err)
+	}
+
+	metadata, _ := json.Marshal(map[string]interface{}{
+		"policy_id":       policy.ID,
+		"organization_id": org.ID,
+		"user_id":         policy.UserID,
+		"name":            policy.Name,
+		"deleted_by":      actor,
+	})
+	metadataStr := string(metadata)
+
+	var userID *string
+	if subject, ok := identity.SubjectFromContext(ctx); ok {
+		userID = &subject
+	}
+
+	h.createAuditLog(&models.AuditLog{
+		ID:            uuid.New().String(),
+		UserID:        userID,
+		EventType:     "access_policy_deleted",
+		EventCategory: "security",
+		Severity:      "warning",
+		IPAddress:     strPtr(req.IpAddress),
+		Metadata:      &metadataStr,
+		Success:       true,
+		CreatedAt:     time.Now(),
+	})
+
+	return &pb.DeleteAccessPolicyResponse{
+		Success: true,
+		Message: "Access policy deleted",
+	}, nil
+}
+
+// accessPolicyToProto converts an access policy for clients
+func accessPolicyToProto(policy *models.AccessPolicy) *pb.AccessPolicy {
+	return &pb.AccessPolicy{
+		Id:               policy.ID,
+		OrganizationId:   policy.OrganizationID,
+		UserId:           stringValue(policy.UserID),
+		Name:             policy.Name,
+		IpAllowlist:      policy.IPAllowlist,
+		IpDenylist:       policy.IPDenylist,
+		CountryAllowlist: policy.CountryAllowlist,
+		CountryDenylist:  policy.CountryDenylist,
+		Action:           policy.Action,
+		CreatedBy:        stringValue(policy.CreatedBy),
+		CreatedAt:        policy.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:        policy.UpdatedAt.Format(time.RFC3339),
+	}
+}
@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/grpcerr"
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/models"
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/repository"
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/utils"
+	pb "github.com/aashiq-04/session-management-system/backend/services/auth-service/proto"
+)
+
+// reasonDeletionNotScheduled is reported when there is no account deletion to cancel
+const reasonDeletionNotScheduled = "DELETION_NOT_SCHEDULED"
+
+// deletionBatchSize is the most scheduled deletions carried out per check
+const deletionBatchSize = 100
+
+// ExportUserData returns the user's account data for their data export.
+// Credentials are only counted: password hashes, MFA secrets, backup codes
+// and device trust tokens are never exported.
+func (h *AuthHandler) ExportUserData(ctx context.Context, req *pb.ExportUserDataRequest) (*pb.ExportUserDataResponse, error) {
+	log.Printf("ExportUserData request received for user: %s", req.UserId)
+
+	user, err := h.getUser(req.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	roles, permissions, err := h.getUserAuthorization(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	backupCodes, trustTokens, err := h.repo.CountUserCredentials(user.ID)
+	if err != nil {
+		log.Printf("Failed to count user credentials: %v", err)
+		return nil, grpcerr.Storage("Failed to export user data", err)
+	}
+
+	h.createAuditLog(&models.AuditLog{
+		ID:            uuid.New().String(),
+		UserID:        &user.ID,
+		EventType:     "personal_data_exported",
+		EventCategory: "security",
+		Severity:      "info",
+		IPAddress:     strPtr(req.IpAddress),
+		Success:       true,
+		CreatedAt:     time.Now(),
+	})
+
+	return &pb.ExportUserDataResponse{
+		Success:              true,
+		Message:              "User data exported",
+		Profile:              userProfileToProto(&models.UserWithRoles{User: *user, Roles: roles, Permissions: permissions}),
+		PasswordChangedAt:    user.PasswordChangedAt.Format(time.RFC3339),
+		BackupCodesRemaining: int32(backupCodes),
+		TrustedDeviceTokens:  int32(trustTokens),
+	}, nil
+}
+
+// RequestAccountDeletion schedules the deletion of the user's own account
+// once the grace period has passed. The user keeps signing in as usual until
+// then and can cancel. Asking again keeps the original schedule.
+func (h *AuthHandler) RequestAccountDeletion(ctx context.Context, req *pb.RequestAccountDeletionRequest) (*pb.RequestAccountDeletionResponse, error) {
+	log.Printf("RequestAccountDeletion request received for user: %s", req.UserId)
+
+	if req.Password == "" {
+		return nil, grpcerr.InvalidArgument("Password is required", grpcerr.Field("password", "is required"))
+	}
+
+	user, err := h.getUser(req.UserId)
+	if err != nil {
+		return nil, err
+	}
+	if user.DeletedAt != nil {
+		return nil, grpcerr.FailedPrecondition("Account is already deleted", reasonAccountDeleted)
+	}
+
+	if err := utils.ComparePassword(user.PasswordHash, req.Password); err != nil {
+		failureReason := "invalid password"
+		h.createAuditLog(&models.AuditLog{
+			ID:            uuid.New().String(),
+			UserID:        &user.ID,
+			EventType:     "account_deletion_requested",
+			EventCategory: "security",
+			Severity:      "warning",
+			IPAddress:     strPtr(req.IpAddress),
+			Success:       false,
+			FailureReason: &failureReason,
+			CreatedAt:     time.Now(),
+		})
+		return nil, grpcerr.Unauthenticated("Invalid password", reasonInvalidCredentials)
+	}
+
+	scheduledAt, err := h.repo.ScheduleAccountDeletion(user.ID, time.Now().Add(h.deletionGracePeriod))
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return nil, grpcerr.NotFound("User not found", "user", user.ID)
+	}
+	if errors.Is(err, repository.ErrUserDeleted) {
+		return nil, grpcerr.FailedPrecondition("Account is already deleted", reasonAccountDeleted)
+	}
+	if err != nil {
+		log.Printf("Failed to schedule account deletion: %v", err)
+		return nil, grpcerr.Storage("Failed to schedule account deletion", err)
+	}
+
+	metadata, _ := json.Marshal(map[string]string{
+		"deletion_scheduled_at": scheduledAt.Format(time.RFC3339),
+	})
+	metadataStr := string(metadata)
+
+	h.createAuditLog(&models.AuditLog{
+		ID:            uuid.New().String(),
+		UserID:        &user.ID,
+		EventType:     "account_deletion_requested",
+		EventCategory: "security",
+		Severity:      "warning",
+		IPAddress:     strPtr(req.IpAddress),
+		Metadata:      &metadataStr,
+		Success:       true,
+		CreatedAt:     time.Now(),
+	})
+
+	return &pb.RequestAccountDeletionResponse{
+		Success:             true,
+		Message:             "Account deletion scheduled",
+		DeletionScheduledAt: scheduledAt.Format(time.RFC3339),
+	}, nil
+}
+
+// CancelAccountDeletion cancels a pending deletion of the user's own account
+func (h *AuthHandler) CancelAccountDeletion(ctx context.Context, req *pb.CancelAccountDeletionRequest) (*pb.CancelAccountDeletionResponse, error) {
+	log.Printf("CancelAccountDeletion request received for user: %s", req.UserId)
+
+	user, err := h.getUser(req.UserId)
+	if err != nil {
+		return nil, err
+	}
+	if user.DeletedAt != nil {
+		return nil, grpcerr.FailedPrecondition("Account is already deleted", reasonAccountDeleted)
+	}
+
+	cancelled, err := h.repo.CancelAccountDeletion(user.ID)
+	if err != nil {
+		log.Printf("Failed to cancel account deletion: %v", err)
+		return nil, grpcerr.Storage("Failed to cancel account deletion", err)
+	}
+	if !cancelled {
+		return nil, grpcerr.FailedPrecondition("No account deletion is scheduled", reasonDeletionNotScheduled)
+	}
+
+	h.createAuditLog(&models.AuditLog{
+		ID:            uuid.New().String(),
+		UserID:        &user.ID,
+		EventType:     "account_deletion_cancelled",
+		EventCategory: "security",
+		Severity:      "info",
+		IPAddress:     strPtr(req.IpAddress),
+		Success:       true,
+		CreatedAt:     time.Now(),
+	})
+
+	return &pb.CancelAccountDeletionResponse{
+		Success: true,
+		Message: "Account deletion cancelled",
+	}, nil
+}
+
+// RunScheduledDeletions carries out due account deletions every interval
+// until ctx is cancelled
+func (h *AuthHandler) RunScheduledDeletions(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			h.DeleteDueAccounts(ctx)
+		}
+	}
+}
+
+// DeleteDueAccounts soft-deletes the accounts whose scheduled deletion is
+// due, erasing their personal data as an admin deletion does. Failures are
+// logged and retried on the next check.
+func (h *AuthHandler) DeleteDueAccounts(ctx context.Context) {
+	userIDs, err := h.repo.GetDueAccountDeletions(time.Now(), deletionBatchSize)
+	if err != nil {
+		log.Printf("Failed to get due account deletions: %v", err)
+		return
+	}
+
+	for _, userID := range userIDs {
+		if ctx.Err() != nil {
+			return
+		}
+
+		redacted, err := h.eraseAccount(ctx, userID, false, userID, "requested by user", "")
+		if err != nil {
+			log.Printf("Failed to carry out scheduled deletion of user %s: %v", userID, err)
+			continue
+		}
+		log.Printf("Deleted user %s as scheduled, redacted %d audit log entries", userID, redacted)
+	}
+}
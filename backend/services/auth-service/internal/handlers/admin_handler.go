@@ -0,0 +1,366 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/grpcerr"
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/identity"
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/models"
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/repository"
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/utils"
+	pb "github.com/aashiq-04/session-management-system/backend/services/auth-service/proto"
+	auditpb "github.com/aashiq-04/session-management-system/backend/services/auth-service/proto/audit"
+)
+
+// Reasons reported in ErrorInfo when an admin action is refused
+const (
+	reasonCannotDisableSelf     = "CANNOT_DISABLE_SELF"
+	reasonCannotDeleteSelf      = "CANNOT_DELETE_SELF"
+	reasonCannotImpersonateSelf = "CANNOT_IMPERSONATE_SELF"
+	reasonAccountDeleted        = "ACCOUNT_DELETED"
+)
+
+const (
+	// impersonationTTL is how long an impersonation session lasts; its
+	// access tokens can be refreshed until then
+	impersonationTTL = time.Hour
+
+	// anonymizeTimeout bounds the audit service's erasure of a user's
+	// audit logs, which rewrites every entry that holds personal data
+	anonymizeTimeout = 30 * time.Second
+
+	// anonymizeRetryDelay is suggested to clients when the erasure fails
+	anonymizeRetryDelay = 5 * time.Second
+)
+
+// ListUsers lists user accounts, for users with the users:read permission
+func (h *AuthHandler) ListUsers(ctx context.Context, req *pb.ListUsersRequest) (*pb.ListUsersResponse, error) {
+	log.Printf("ListUsers request received from %s", identity.ActorFromContext(ctx))
+
+	limit := int(req.Limit)
+	if limit <= 0 || limit > 100 {
+		limit = 50
+	}
+
+	// Admins only see their own organization's members; operators see all
+	tenant, _ := identity.TenantFromContext(ctx)
+	users, totalCount, err := h.repo.ListUsers(tenant, req.Query, limit, int(req.Offset))
+	if err != nil {
+		log.Printf("Failed to list users: %v", err)
+		return nil, grpcerr.Storage("Failed to list users", err)
+	}
+
+	pbUsers := make([]*pb.UserProfile, 0, len(users))
+	for i := range users {
+		pbUsers = append(pbUsers, userProfileToProto(&users[i]))
+	}
+
+	return &pb.ListUsersResponse{
+		Success:    true,
+		Message:    "Users retrieved successfully",
+		Users:      pbUsers,
+		TotalCount: int32(totalCount),
+	}, nil
+}
+
+// DisableUser deactivates an account and signs it out everywhere, for users
+// with the users:disable permission
+func (h *AuthHandler) DisableUser(ctx context.Context, req *pb.DisableUserRequest) (*pb.DisableUserResponse, error) {
+	actor := identity.ActorFromContext(ctx)
+	log.Printf("DisableUser request received for user %s from %s", req.TargetUserId, actor)
+
+	if req.TargetUserId == "" {
+		return nil, grpcerr.InvalidArgument("Target user is required", grpcerr.Field("target_user_id", "is required"))
+	}
+	if _, err := uuid.Parse(req.TargetUserId); err != nil {
+		return nil, grpcerr.NotFound("User not found", "user", req.TargetUserId)
+	}
+	if actor == req.TargetUserId {
+		return nil, grpcerr.FailedPrecondition("You cannot disable your own account", reasonCannotDisableSelf)
+	}
+	if _, err := h.getTenantUser(ctx, req.TargetUserId); err != nil {
+		return nil, err
+	}
+
+	revoked, err := h.repo.DisableUser(req.TargetUserId)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return nil, grpcerr.NotFound("User not found", "user", req.TargetUserId)
+	}
+	if err != nil {
+		log.Printf("Failed to disable user: %v", err)
+		return nil, grpcerr.Storage("Failed to disable user", err)
+	}
+
+	h.revokeDeviceTrustTokens(req.TargetUserId, "account_disabled")
+
+	metadata, _ := json.Marshal(map[string]interface{}{
+		"disabled_by":      actor,
+		"reason":           req.Reason,
+		"revoked_sessions": revoked,
+	})
+	metadataStr := string(metadata)
+
+	h.createAuditLog(&models.AuditLog{
+		ID:            uuid.New().String(),
+		UserID:        &req.TargetUserId,
+		EventType:     "account_disabled",
+		EventCategory: "security",
+		Severity:      "warning",
+		IPAddress:     strPtr(req.DisabledByIp),
+		Metadata:      &metadataStr,
+		Success:       true,
+		CreatedAt:     time.Now(),
+	})
+
+	return &pb.DisableUserResponse{
+		Success:         true,
+		Message:         fmt.Sprintf("User disabled, revoked %d session(s)", revoked),
+		RevokedSessions: int32(revoked),
+	}, nil
+}
+
+// ReactivateUser lets a disabled account sign in again, for users with the
+// users:disable permission
+func (h *AuthHandler) ReactivateUser(ctx context.Context, req *pb.ReactivateUserRequest) (*pb.ReactivateUserResponse, error) {
+	actor := identity.ActorFromContext(ctx)
+	log.Printf("ReactivateUser request received for user %s from %s", req.TargetUserId, actor)
+
+	if req.TargetUserId == "" {
+		return nil, grpcerr.InvalidArgument("Target user is required", grpcerr.Field("target_user_id", "is required"))
+	}
+	if _, err := uuid.Parse(req.TargetUserId); err != nil {
+		return nil, grpcerr.NotFound("User not found", "user", req.TargetUserId)
+	}
+	if _, err := h.getTenantUser(ctx, req.TargetUserId); err != nil {
+		return nil, err
+	}
+
+	err := h.repo.ReactivateUser(req.TargetUserId)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return nil, grpcerr.NotFound("User not found", "user", req.TargetUserId)
+	}
+	if errors.Is(err, repository.ErrUserDeleted) {
+		return nil, grpcerr.FailedPrecondition("Deleted accounts can't be reactivated", reasonAccountDeleted)
+	}
+	if err != nil {
+		log.Printf("Failed to reactivate user: %v", err)
+		return nil, grpcerr.Storage("Failed to reactivate user", err)
+	}
+
+	metadata, _ := json.Marshal(map[string]interface{}{
+		"reactivated_by": actor,
+		"reason":         req.Reason,
+	})
+	metadataStr := string(metadata)
+
+	h.createAuditLog(&models.AuditLog{
+		ID:            uuid.New().String(),
+		UserID:        &req.TargetUserId,
+		EventType:     "account_reactivated",
+		EventCategory: "security",
+		Severity:      "info",
+		IPAddress:     strPtr(req.ReactivatedByIp),
+		Metadata:      &metadataStr,
+		Success:       true,
+		CreatedAt:     time.Now(),
+	})
+
+	return &pb.ReactivateUserResponse{
+		Success: true,
+		Message: "User reactivated",
+	}, nil
+}
+
+// DeleteUser deletes an account and erases the user's personal data from the
+// audit trail, for users with the users:delete permission. A soft delete can
+// be followed by a hard delete.
+func (h *AuthHandler) DeleteUser(ctx context.Context, req *pb.DeleteUserRequest) (*pb.DeleteUserResponse, error) {
+	actor := identity.ActorFromContext(ctx)
+	log.Printf("DeleteUser request received for user %s from %s (hard: %v)", req.TargetUserId, actor, req.Hard)
+
+	if req.TargetUserId == "" {
+		return nil, grpcerr.InvalidArgument("Target user is required", grpcerr.Field("target_user_id", "is required"))
+	}
+	if _, err := uuid.Parse(req.TargetUserId); err != nil {
+		return nil, grpcerr.NotFound("User not found", "user", req.TargetUserId)
+	}
+	if actor == req.TargetUserId {
+		return nil, grpcerr.FailedPrecondition("You cannot delete your own account", reasonCannotDeleteSelf)
+	}
+
+	user, err := h.getTenantUser(ctx, req.TargetUserId)
+	if err != nil {
+		return nil, err
+	}
+	if user.DeletedAt != nil && !req.Hard {
+		return nil, grpcerr.FailedPrecondition("User is already deleted", reasonAccountDeleted)
+	}
+
+	redacted, err := h.eraseAccount(ctx, req.TargetUserId, req.Hard, actor, req.Reason, req.DeletedByIp)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.DeleteUserResponse{
+		Success:           true,
+		Message:           fmt.Sprintf("User deleted, redacted %d audit log entries", redacted),
+		RedactedAuditLogs: redacted,
+	}, nil
+}
+
+// eraseAccount erases a user's personal data from the audit trail, deletes
+// their account and records who did it, returning how many audit log entries
+// were redacted or a status error
+func (h *AuthHandler) eraseAccount(ctx context.Context, userID string, hard bool, deletedBy, reason, ipAddress string) (int32, error) {
+	// The audit trail is erased first: erasing again is harmless, so a failed
+	// deletion can simply be retried, and events the user's activity still
+	// produces are scrubbed from then on
+	anonymizeCtx, cancel := context.WithTimeout(ctx, anonymizeTimeout)
+	defer cancel()
+	anonymized, err := h.auditClient.AnonymizeUserAuditLogs(anonymizeCtx, &auditpb.AnonymizeUserAuditLogsRequest{
+		UserId:   userID,
+		ErasedBy: deletedBy,
+	})
+	if err != nil {
+		log.Printf("Failed to anonymize audit logs of user %s: %v", userID, err)
+		return 0, grpcerr.Unavailable("Failed to erase the user's audit logs", anonymizeRetryDelay)
+	}
+
+	err = h.repo.DeleteUser(userID, hard)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return 0, grpcerr.NotFound("User not found", "user", userID)
+	}
+	if errors.Is(err, repository.ErrUserDeleted) {
+		return 0, grpcerr.FailedPrecondition("User is already deleted", reasonAccountDeleted)
+	}
+	if err != nil {
+		log.Printf("Failed to delete user: %v", err)
+		return 0, grpcerr.Storage("Failed to delete user", err)
+	}
+
+	mode := "soft"
+	if hard {
+		mode = "hard"
+	}
+	metadata, _ := json.Marshal(map[string]interface{}{
+		"user_id":             userID,
+		"deleted_by":          deletedBy,
+		"mode":                mode,
+		"reason":              reason,
+		"redacted_audit_logs": anonymized.RedactedEntries,
+	})
+	metadataStr := string(metadata)
+
+	// Not recorded under the user, whose events no longer keep metadata
+	h.createAuditLog(&models.AuditLog{
+		ID:            uuid.New().String(),
+		EventType:     "account_deleted",
+		EventCategory: "security",
+		Severity:      "warning",
+		IPAddress:     strPtr(ipAddress),
+		Metadata:      &metadataStr,
+		Success:       true,
+		CreatedAt:     time.Now(),
+	})
+
+	return anonymized.RedactedEntries, nil
+}
+
+// ImpersonateUser opens a session as another user, for users with the
+// users:impersonate permission. The session is marked with the admin's ID,
+// lasts an hour and its tokens carry no roles.
+func (h *AuthHandler) ImpersonateUser(ctx context.Context, req *pb.ImpersonateUserRequest) (*pb.ImpersonateUserResponse, error) {
+	impersonator := identity.ActorFromContext(ctx)
+	log.Printf("ImpersonateUser request received for user %s from %s", req.TargetUserId, impersonator)
+
+	if violations := requiredFields(map[string]string{
+		"target_user_id": req.TargetUserId,
+		"reason":         req.Reason,
+	}); len(violations) > 0 {
+		return nil, grpcerr.InvalidArgument("Target user and reason are required", violations...)
+	}
+	if _, err := uuid.Parse(req.TargetUserId); err != nil {
+		return nil, grpcerr.NotFound("User not found", "user", req.TargetUserId)
+	}
+	if impersonator == req.TargetUserId {
+		return nil, grpcerr.FailedPrecondition("You cannot impersonate yourself", reasonCannotImpersonateSelf)
+	}
+
+	user, err := h.getTenantUser(ctx, req.TargetUserId)
+	if err != nil {
+		return nil, err
+	}
+	if !user.IsActive || user.DeletedAt != nil {
+		return nil, grpcerr.FailedPrecondition("Account is inactive", reasonAccountInactive)
+	}
+
+	accessToken, err := utils.GenerateImpersonationToken(user.ID, user.Email, user.OrganizationID, impersonator, h.jwtSecret)
+	if err != nil {
+		log.Printf("Failed to generate access token: %v", err)
+		return nil, grpcerr.Internal("Failed to generate authentication token")
+	}
+
+	refreshToken, err := utils.GenerateRefreshToken(user.ID, user.Email, h.jwtSecret)
+	if err != nil {
+		log.Printf("Failed to generate refresh token: %v", err)
+		return nil, grpcerr.Internal("Failed to generate refresh token")
+	}
+
+	ip := req.IpAddress
+	if ip == "" {
+		ip = getIPFromContext(ctx)
+	}
+
+	now := time.Now()
+	session := &models.Session{
+		ID:             uuid.New().String(),
+		UserID:         user.ID,
+		RefreshToken:   refreshToken,
+		IPAddress:      ip,
+		UserAgent:      strPtr(req.UserAgent),
+		IsActive:       true,
+		ExpiresAt:      now.Add(impersonationTTL),
+		CreatedAt:      now,
+		ImpersonatorID: &impersonator,
+	}
+	if err := h.repo.CreateSession(session); err != nil {
+		log.Printf("Failed to create impersonation session: %v", err)
+		return nil, grpcerr.Storage("Failed to create session", err)
+	}
+
+	metadata, _ := json.Marshal(map[string]interface{}{
+		"impersonator_id": impersonator,
+		"reason":          req.Reason,
+	})
+	metadataStr := string(metadata)
+
+	h.createAuditLog(&models.AuditLog{
+		ID:            uuid.New().String(),
+		UserID:        &user.ID,
+		SessionID:     &session.ID,
+		EventType:     "impersonation_started",
+		EventCategory: "security",
+		Severity:      "warning",
+		IPAddress:     &ip,
+		UserAgent:     strPtr(req.UserAgent),
+		Metadata:      &metadataStr,
+		Success:       true,
+		CreatedAt:     now,
+	})
+
+	return &pb.ImpersonateUserResponse{
+		Success:      true,
+		Message:      "Impersonation session started",
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		SessionId:    session.ID,
+		ExpiresAt:    session.ExpiresAt.Format(time.RFC3339),
+	}, nil
+}
@@ -0,0 +1,513 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/netip"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/grpcerr"
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/identity"
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/models"
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/oauthserver"
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/repository"
+	pb "github.com/aashiq-04/session-management-system/backend/services/auth-service/proto"
+)
+
+// API tokens start with a prefix naming their kind, so they are easy to
+// recognize in logs and by secret scanners
+const (
+	personalTokenPrefix = "sms_pat_"
+	serviceTokenPrefix  = "sms_key_"
+)
+
+// Scopes an API token may have besides the permissions of its user. Read
+// allows GraphQL queries and downloads, write allows mutations.
+const (
+	scopeRead  = "read"
+	scopeWrite = "write"
+)
+
+// Lifetime of API tokens, in days
+const (
+	defaultAPITokenDays = 90
+	maxAPITokenDays     = 365
+)
+
+// maxAPITokensPerOwner caps the live tokens of a user, or the API keys of
+// an organization
+const maxAPITokensPerOwner = 50
+
+// Reasons reported in ErrorInfo when an API token can't be made
+const (
+	reasonSignedInAdminRequired = "SIGNED_IN_ADMIN_REQUIRED" // API keys need an admin to act as
+	reasonTooManyAPITokens      = "TOO_MANY_API_TOKENS"
+)
+
+// ValidateAPIToken checks an API token the gateway was called with. Valid
+// tokens act as their user with the permissions both the token's scopes and
+// the user's current roles grant, and only from where the organization's
+// policies allow the user to sign in. Every use is audited with the token ID.
+func (h *AuthHandler) ValidateAPIToken(ctx context.Context, req *pb.ValidateAPITokenRequest) (*pb.ValidateAPITokenResponse, error) {
+	invalid := &pb.ValidateAPITokenResponse{
+		Valid:   false,
+		Message: "Invalid API token",
+	}
+	if !strings.HasPrefix(req.Token, personalTokenPrefix) && !strings.HasPrefix(req.Token, serviceTokenPrefix) {
+		return invalid, nil
+	}
+
+	token, err := h.repo.GetAPITokenByHash(oauthserver.HashSecret(req.Token))
+	if errors.Is(err, repository.ErrAPITokenNotFound) {
+		return invalid, nil
+	}
+	if err != nil {
+		log.Printf("Failed to get api token: %v", err)
+		return nil, grpcerr.Storage("Failed to validate API token", err)
+	}
+
+	failureReason := ""
+	switch {
+	case token.RevokedAt != nil:
+		failureReason = "token_revoked"
+	case time.Now().After(token.ExpiresAt):
+		failureReason = "token_expired"
+	}
+	if failureReason != "" {
+		h.recordAPITokenUse(token, req, false, failureReason)
+		return invalid, nil
+	}
+
+	user, err := h.getUser(token.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if !user.IsActive || user.DeletedAt != nil || user.OrganizationID != token.OrganizationID {
+		h.recordAPITokenUse(token, req, false, "user_inactive")
+		return invalid, nil
+	}
+
+	org, err := h.getOrganization(token.OrganizationID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Calls made with a token carry no location, so country allowlists
+	// refuse them. A token can't answer a step-up, so those policies block.
+	violation, err := h.checkSignInLocation(org, user, req.IpAddress, "")
+	if err != nil {
+		return nil, err
+	}
+	if violation != nil {
+		h.recordPolicyViolation(user, nil, stageAPIToken, req.IpAddress, "", violation, outcomeBlocked)
+		h.recordAPITokenUse(token, req, false, violation.failureReason)
+		return nil, grpcerr.PermissionDenied(violation.message, violation.reason)
+	}
+
+	// Roles may have changed since the token was made
+	roles, permissions, err := h.getUserAuthorization(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	granted := make([]string, 0, len(permissions))
+	for _, permission := range permissions {
+		if slices.Contains(token.Scopes, permission) {
+			granted = append(granted, permission)
+		}
+	}
+
+	if err := h.repo.UpdateAPITokenLastUsed(token.ID, clientAddress(req.IpAddress)); err != nil {
+		log.Printf("Failed to update api token last used: %v", err)
+	}
+	h.recordAPITokenUse(token, req, true, "")
+
+	return &pb.ValidateAPITokenResponse{
+		Valid:          true,
+		Message:        "API token is valid",
+		TokenId:        token.ID,
+		UserId:         user.ID,
+		Email:          user.Email,
+		OrganizationId: org.ID,
+		Roles:          roles,
+		Permissions:    granted,
+		Scopes:         token.Scopes,
+	}, nil
+}
+
+// ListAPITokens lists the user's personal access tokens
+func (h *AuthHandler) ListAPITokens(ctx context.Context, req *pb.ListAPITokensRequest) (*pb.ListAPITokensResponse, error) {
+	log.Printf("ListAPITokens request received for user: %s", req.UserId)
+
+	tokens, err := h.repo.ListPersonalAPITokens(req.UserId)
+	if err != nil {
+		log.Printf("Failed to list api tokens: %v", err)
+		return nil, grpcerr.Storage("Failed to list API tokens", err)
+	}
+
+	return &pb.ListAPITokensResponse{
+		Success: true,
+		Message: "API tokens retrieved",
+		Tokens:  apiTokensToProto(tokens),
+	}, nil
+}
+
+// CreateAPIToken makes a personal access token for the user. The token is
+// returned only here; just its hash is kept.
+func (h *AuthHandler) CreateAPIToken(ctx context.Context, req *pb.CreateAPITokenRequest) (*pb.CreateAPITokenResponse, error) {
+	log.Printf("CreateAPIToken request received for user: %s", req.UserId)
+
+	user, err := h.getUser(req.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := h.repo.ListPersonalAPITokens(user.ID)
+	if err != nil {
+		log.Printf("Failed to list api tokens: %v", err)
+		return nil, grpcerr.Storage("Failed to create API token", err)
+	}
+
+	token, secret, err := h.newAPIToken(models.APITokenPersonal, user.ID, user.OrganizationID, existing, req.Name, req.Scopes, req.ExpiresInDays)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := h.repo.CreateAPIToken(token); err != nil {
+		log.Printf("Failed to create api token: %v", err)
+		return nil, grpcerr.Storage("Failed to create API token", err)
+	}
+
+	h.recordAPITokenChange(token, &user.ID, req.IpAddress, "api_token_created")
+
+	return &pb.CreateAPITokenResponse{
+		Success: true,
+		Message: "API token created",
+		Token:   apiTokenToProto(token),
+		Secret:  secret,
+	}, nil
+}
+
+// RevokeAPIToken revokes one of the user's personal access tokens
+func (h *AuthHandler) RevokeAPIToken(ctx context.Context, req *pb.RevokeAPITokenRequest) (*pb.RevokeAPITokenResponse, error) {
+	log.Printf("RevokeAPIToken request received for user %s and token %s", req.UserId, req.TokenId)
+
+	token, err := h.revokeAPIToken(req.TokenId, func(token *models.APIToken) bool {
+		return token.Kind == models.APITokenPersonal && token.UserID == req.UserId
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	h.recordAPITokenChange(token, &req.UserId, req.IpAddress, "api_token_revoked")
+
+	return &pb.RevokeAPITokenResponse{
+		Success: true,
+		Message: "API token revoked",
+	}, nil
+}
+
+// ListAPIKeys lists the API keys of an organization, for users with the
+// organizations:manage permission in it
+func (h *AuthHandler) ListAPIKeys(ctx context.Context, req *pb.ListAPIKeysRequest) (*pb.ListAPITokensResponse, error) {
+	log.Printf("ListAPIKeys request received for %s from %s", req.OrganizationId, identity.ActorFromContext(ctx))
+
+	org, err := h.getTenantOrganization(ctx, req.OrganizationId)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := h.repo.ListServiceAPITokens(org.ID)
+	if err != nil {
+		log.Printf("Failed to list api keys: %v", err)
+		return nil, grpcerr.Storage("Failed to list API keys", err)
+	}
+
+	return &pb.ListAPITokensResponse{
+		Success: true,
+		Message: "API keys retrieved",
+		Tokens:  apiTokensToProto(keys),
+	}, nil
+}
+
+// CreateAPIKey makes an API key for an organization, for users with the
+// organizations:manage permission in it. The key acts as the admin who
+// makes it, so it stops working if they lose their account, and can't be
+// given scopes they don't hold.
+func (h *AuthHandler) CreateAPIKey(ctx context.Context, req *pb.CreateAPIKeyRequest) (*pb.CreateAPITokenResponse, error) {
+	actor := identity.ActorFromContext(ctx)
+	log.Printf("CreateAPIKey request received for %s from %s", req.OrganizationId, actor)
+
+	org, err := h.getTenantOrganization(ctx, req.OrganizationId)
+	if err != nil {
+		return nil, err
+	}
+
+	subject, ok := identity.SubjectFromContext(ctx)
+	if !ok {
+		return nil, grpcerr.FailedPrecondition("API keys act as the admin who makes them, so need a signed-in admin", reasonSignedInAdminRequired)
+	}
+
+	existing, err := h.repo.ListServiceAPITokens(org.ID)
+	if err != nil {
+		log.Printf("Failed to list api keys: %v", err)
+		return nil, grpcerr.Storage("Failed to create API key", err)
+	}
+
+	key, secret, err := h.newAPIToken(models.APITokenService, subject, org.ID, existing, req.Name, req.Scopes, req.ExpiresInDays)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := h.repo.CreateAPIToken(key); err != nil {
+		log.Printf("Failed to create api key: %v", err)
+		return nil, grpcerr.Storage("Failed to create API key", err)
+	}
+
+	h.recordAPITokenChange(key, &subject, req.IpAddress, "api_key_created")
+
+	return &pb.CreateAPITokenResponse{
+		Success: true,
+		Message: "API key created",
+		Token:   apiTokenToProto(key),
+		Secret:  secret,
+	}, nil
+}
+
+// RevokeAPIKey revokes one of an organization's API keys, for users with
+// the organizations:manage permission in it
+func (h *AuthHandler) RevokeAPIKey(ctx context.Context, req *pb.RevokeAPIKeyRequest) (*pb.RevokeAPITokenResponse, error) {
+	log.Printf("RevokeAPIKey request received for %s from %s", req.KeyId, identity.ActorFromContext(ctx))
+
+	org, err := h.getTenantOrganization(ctx, req.OrganizationId)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := h.revokeAPIToken(req.KeyId, func(token *models.APIToken) bool {
+		return token.Kind == models.APITokenService && token.OrganizationID == org.ID
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var userID *string
+	if subject, ok := identity.SubjectFromContext(ctx); ok {
+		userID = &subject
+	}
+	h.recordAPITokenChange(key, userID, req.IpAddress, "api_key_revoked")
+
+	return &pb.RevokeAPITokenResponse{
+		Success: true,
+		Message: "API key revoked",
+	}, nil
+}
+
+// newAPIToken checks the name, scopes and lifetime asked for a new token of
+// userID, and returns the token along with its secret. Scopes other than
+// read and write must be permissions the user holds.
+func (h *AuthHandler) newAPIToken(kind, userID, organizationID string, existing []models.APIToken, name string, scopes []string, expiresInDays int32) (*models.APIToken, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 255 {
+		return nil, "", grpcerr.InvalidArgument("Invalid token name", grpcerr.Field("name", "must be 1 to 255 characters"))
+	}
+
+	if expiresInDays == 0 {
+		expiresInDays = defaultAPITokenDays
+	}
+	if expiresInDays < 1 || expiresInDays > maxAPITokenDays {
+		return nil, "", grpcerr.InvalidArgument("Invalid token lifetime", grpcerr.Field("expires_in_days", "must be 1 to 365 days"))
+	}
+
+	now := time.Now()
+	live := 0
+	for _, token := range existing {
+		if token.RevokedAt == nil && now.Before(token.ExpiresAt) {
+			live++
+		}
+	}
+	if live >= maxAPITokensPerOwner {
+		return nil, "", grpcerr.FailedPrecondition("Too many API tokens; revoke unused ones first", reasonTooManyAPITokens)
+	}
+
+	_, permissions, err := h.getUserAuthorization(userID)
+	if err != nil {
+		return nil, "", err
+	}
+	granted := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		if scope != scopeRead && scope != scopeWrite && !slices.Contains(permissions, scope) {
+			return nil, "", grpcerr.InvalidArgument("Unsupported scope",
+				grpcerr.Field("scopes", "must be read, write or a permission you hold: "+scope))
+		}
+		if !slices.Contains(granted, scope) {
+			granted = append(granted, scope)
+		}
+	}
+	if !slices.Contains(granted, scopeRead) && !slices.Contains(granted, scopeWrite) {
+		return nil, "", grpcerr.InvalidArgument("Token needs the read or write scope", grpcerr.Field("scopes", "must include read or write"))
+	}
+
+	random, err := oauthserver.NewSecret()
+	if err != nil {
+		log.Printf("Failed to generate api token: %v", err)
+		return nil, "", grpcerr.Internal("Failed to generate API token")
+	}
+	prefix := personalTokenPrefix
+	if kind == models.APITokenService {
+		prefix = serviceTokenPrefix
+	}
+	secret := prefix + random
+
+	return &models.APIToken{
+		ID:             uuid.New().String(),
+		Kind:           kind,
+		UserID:         userID,
+		OrganizationID: organizationID,
+		Name:           name,
+		TokenPrefix:    secret[:len(prefix)+8],
+		TokenHash:      oauthserver.HashSecret(secret),
+		Scopes:         granted,
+		ExpiresAt:      now.AddDate(0, 0, int(expiresInDays)),
+		CreatedAt:      now,
+	}, secret, nil
+}
+
+// revokeAPIToken revokes a token that owned reports as the caller's, and
+// returns it. Others are reported as not found.
+func (h *AuthHandler) revokeAPIToken(tokenID string, owned func(*models.APIToken) bool) (*models.APIToken, error) {
+	notFound := grpcerr.NotFound("API token not found", "api_token", tokenID)
+	if _, err := uuid.Parse(tokenID); err != nil {
+		return nil, notFound
+	}
+
+	token, err := h.repo.GetAPIToken(tokenID)
+	if errors.Is(err, repository.ErrAPITokenNotFound) {
+		return nil, notFound
+	}
+	if err != nil {
+		log.Printf("Failed to get api token: %v", err)
+		return nil, grpcerr.Storage("Failed to get API token", err)
+	}
+	if !owned(token) {
+		return nil, notFound
+	}
+
+	err = h.repo.RevokeAPIToken(token.ID)
+	if errors.Is(err, repository.ErrAPITokenNotFound) {
+		return nil, grpcerr.NotFound("API token not found or already revoked", "api_token", tokenID)
+	}
+	if err != nil {
+		log.Printf("Failed to revoke api token: %v", err)
+		return nil, grpcerr.Storage("Failed to revoke API token", err)
+	}
+
+	return token, nil
+}
+
+// recordAPITokenUse records a call made with an API token as an
+// api_token_used audit event for its user
+func (h *AuthHandler) recordAPITokenUse(token *models.APIToken, req *pb.ValidateAPITokenRequest, success bool, failureReason string) {
+	metadata, _ := json.Marshal(map[string]interface{}{
+		"token_id": token.ID,
+		"kind":     token.Kind,
+		"name":     token.Name,
+		"prefix":   token.TokenPrefix,
+	})
+	metadataStr := string(metadata)
+
+	severity := "info"
+	if !success {
+		severity = "warning"
+	}
+
+	h.createAuditLog(&models.AuditLog{
+		ID:            uuid.New().String(),
+		UserID:        &token.UserID,
+		EventType:     "api_token_used",
+		EventCategory: "authentication",
+		Severity:      severity,
+		IPAddress:     strPtr(req.IpAddress),
+		UserAgent:     strPtr(req.UserAgent),
+		Metadata:      &metadataStr,
+		Success:       success,
+		FailureReason: strPtr(failureReason),
+		CreatedAt:     time.Now(),
+	})
+}
+
+// recordAPITokenChange records an API token being made or revoked
+func (h *AuthHandler) recordAPITokenChange(token *models.APIToken, userID *string, ip, eventType string) {
+	metadata, _ := json.Marshal(map[string]interface{}{
+		"token_id":        token.ID,
+		"kind":            token.Kind,
+		"name":            token.Name,
+		"prefix":          token.TokenPrefix,
+		"scopes":          token.Scopes,
+		"expires_at":      token.ExpiresAt.Format(time.RFC3339),
+		"organization_id": token.OrganizationID,
+	})
+	metadataStr := string(metadata)
+
+	h.createAuditLog(&models.AuditLog{
+		ID:            uuid.New().String(),
+		UserID:        userID,
+		EventType:     eventType,
+		EventCategory: "security",
+		Severity:      "warning",
+		IPAddress:     strPtr(ip),
+		Metadata:      &metadataStr,
+		Success:       true,
+		CreatedAt:     time.Now(),
+	})
+}
+
+// clientAddress returns the first address of a possibly forwarded list, or
+// nil if it isn't one
+func clientAddress(ip string) *string {
+	ip, _, _ = strings.Cut(ip, ",")
+	addr, err := netip.ParseAddr(strings.TrimSpace(ip))
+	if err != nil {
+		return nil
+	}
+	s := addr.Unmap().String()
+	return &s
+}
+
+// apiTokensToProto converts API tokens for clients of this service
+func apiTokensToProto(tokens []models.APIToken) []*pb.APIToken {
+	pbTokens := make([]*pb.APIToken, 0, len(tokens))
+	for i := range tokens {
+		pbTokens = append(pbTokens, apiTokenToProto(&tokens[i]))
+	}
+	return pbTokens
+}
+
+// apiTokenToProto converts an API token for clients of this service. The
+// hash is left out.
+func apiTokenToProto(token *models.APIToken) *pb.APIToken {
+	pbToken := &pb.APIToken{
+		Id:             token.ID,
+		Kind:           token.Kind,
+		UserId:         token.UserID,
+		OrganizationId: token.OrganizationID,
+		Name:           token.Name,
+		Prefix:         token.TokenPrefix,
+		Scopes:         token.Scopes,
+		ExpiresAt:      token.ExpiresAt.Format(time.RFC3339),
+		LastUsedIp:     stringValue(token.LastUsedIP),
+		CreatedAt:      token.CreatedAt.Format(time.RFC3339),
+	}
+	if token.LastUsedAt != nil {
+		pbToken.LastUsedAt = token.LastUsedAt.Format(time.RFC3339)
+	}
+	if token.RevokedAt != nil {
+		pbToken.RevokedAt = token.RevokedAt.Format(time.RFC3339)
+	}
+	return pbToken
+}
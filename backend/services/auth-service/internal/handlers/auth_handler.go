@@ -3,6 +3,7 @@ package handlers
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -10,14 +11,32 @@ import (
 	"net"
 	"encoding/json"
 	"net/http"
+	"sort"
+	"strings"
 	"github.com/google/uuid"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	pb "github.com/aashiq-04/session-management-system/backend/services/auth-service/proto"
+	auditpb "github.com/aashiq-04/session-management-system/backend/services/auth-service/proto/audit"
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/audit"
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/grpcerr"
 	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/models"
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/oidc"
 	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/repository"
 	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/utils"
 )
 
 
+// Reasons attached to authentication errors, for clients to branch on
+const (
+	reasonInvalidCredentials  = "INVALID_CREDENTIALS"
+	reasonAccountInactive     = "ACCOUNT_INACTIVE"
+	reasonInvalidMFACode      = "INVALID_MFA_CODE"
+	reasonMFANotEnabled       = "MFA_NOT_ENABLED"
+	reasonInvalidRefreshToken = "INVALID_REFRESH_TOKEN"
+	reasonSessionInactive     = "SESSION_INACTIVE"
+	reasonSessionExpired      = "SESSION_EXPIRED"
+)
+
 func strPtr(s string) *string {
 	if s == "" {
 		return nil
@@ -36,20 +55,47 @@ func floatPtr(f float64) *float64 {
 // AuthHandler implements the AuthService gRPC service
 type AuthHandler struct {
 	pb.UnimplementedAuthServiceServer
-	repo      *repository.UserRepository
-	jwtSecret string
+	repo        *repository.UserRepository
+	audit       *audit.Outbox
+	auditClient auditpb.AuditServiceClient // for erasing deleted users' audit logs
+	jwtSecret   string
+	mfaTrustTTL time.Duration // zero disables the trusted-device MFA bypass
+
+	deletionGracePeriod time.Duration // how long users can cancel deleting their account
+
+	identityProviders map[string]*oidc.Provider // by name
+
+	oauthServer *OAuthServerConfig // nil when this service isn't an OAuth server
+
+	saml *SAMLConfig // nil when SAML login is disabled
 }
 
 // NewAuthHandler creates a new auth handler
-func NewAuthHandler(db *sql.DB) *AuthHandler {
+func NewAuthHandler(db *sql.DB, auditOutbox *audit.Outbox, auditClient auditpb.AuditServiceClient, mfaTrustTTL, deletionGracePeriod time.Duration, identityProviders []*oidc.Provider, oauthServer *OAuthServerConfig, samlConfig *SAMLConfig) *AuthHandler {
 	jwtSecret := os.Getenv("JWT_SECRET")
 	if jwtSecret == "" {
 		log.Fatal("JWT_SECRET environment variable is not set")
 	}
 
+	providers := make(map[string]*oidc.Provider, len(identityProviders))
+	for _, provider := range identityProviders {
+		providers[provider.Name()] = provider
+	}
+
 	return &AuthHandler{
-		repo:      repository.NewUserRepository(db),
-		jwtSecret: jwtSecret,
+		repo:        repository.NewUserRepository(db),
+		audit:       auditOutbox,
+		auditClient: auditClient,
+		jwtSecret:   jwtSecret,
+		mfaTrustTTL: mfaTrustTTL,
+
+		deletionGracePeriod: deletionGracePeriod,
+
+		identityProviders: providers,
+
+		oauthServer: oauthServer,
+
+		saml: samlConfig,
 	}
 }
 
@@ -58,30 +104,29 @@ func (h *AuthHandler) Register(ctx context.Context, req *pb.RegisterRequest) (*p
 	log.Printf("Register request received for email: %s", req.Email)
 
 	// Validate input
-	if req.Email == "" || req.Password == "" || req.FullName == "" {
-		return &pb.RegisterResponse{
-			Success: false,
-			Message: "Email, password, and full name are required",
-		}, nil
+	if violations := requiredFields(map[string]string{
+		"email":     req.Email,
+		"password":  req.Password,
+		"full_name": req.FullName,
+	}); len(violations) > 0 {
+		return nil, grpcerr.InvalidArgument("Email, password, and full name are required", violations...)
 	}
 
 	// Check if user already exists
-	existingUser, _ := h.repo.GetUserByEmail(req.Email)
-	if existingUser != nil {
-		return &pb.RegisterResponse{
-			Success: false,
-			Message: "User with this email already exists",
-		}, nil
+	_, err := h.repo.GetUserByEmail(req.Email)
+	if err == nil {
+		return nil, grpcerr.AlreadyExists("User with this email already exists", "user", req.Email)
+	}
+	if !errors.Is(err, repository.ErrUserNotFound) {
+		log.Printf("Failed to look up user: %v", err)
+		return nil, grpcerr.Storage("Failed to create user account", err)
 	}
 
 	// Hash the password
 	hashedPassword, err := utils.HashPassword(req.Password)
 	if err != nil {
 		log.Printf("Failed to hash password: %v", err)
-		return &pb.RegisterResponse{
-			Success: false,
-			Message: "Failed to process password",
-		}, nil
+		return nil, grpcerr.Internal("Failed to process password")
 	}
 
 	// Create user model
@@ -101,10 +146,7 @@ func (h *AuthHandler) Register(ctx context.Context, req *pb.RegisterRequest) (*p
 	err = h.repo.CreateUser(user)
 	if err != nil {
 		log.Printf("Failed to create user: %v", err)
-		return &pb.RegisterResponse{
-			Success: false,
-			Message: "Failed to create user account",
-		}, nil
+		return nil, grpcerr.Storage("Failed to create user account", err)
 	}
 
 	// Create or get device
@@ -115,22 +157,18 @@ func (h *AuthHandler) Register(ctx context.Context, req *pb.RegisterRequest) (*p
 	}
 
 	// Generate JWT tokens
-	accessToken, err := utils.GenerateAccessToken(userID, req.Email, h.jwtSecret)
+	authTime := time.Now()
+	amr := []string{utils.AMRPassword}
+	accessToken, err := utils.GenerateAccessToken(userID, req.Email, user.OrganizationID, nil, nil, authTime, amr, h.jwtSecret)
 	if err != nil {
 		log.Printf("Failed to generate access token: %v", err)
-		return &pb.RegisterResponse{
-			Success: false,
-			Message: "Failed to generate authentication token",
-		}, nil
+		return nil, grpcerr.Internal("Failed to generate authentication token")
 	}
 
 	refreshToken, err := utils.GenerateRefreshToken(userID, req.Email, h.jwtSecret)
 	if err != nil {
 		log.Printf("Failed to generate refresh token: %v", err)
-		return &pb.RegisterResponse{
-			Success: false,
-			Message: "Failed to generate refresh token",
-		}, nil
+		return nil, grpcerr.Internal("Failed to generate refresh token")
 	}
 
 	// Create session
@@ -138,7 +176,7 @@ func (h *AuthHandler) Register(ctx context.Context, req *pb.RegisterRequest) (*p
 	session := &models.Session{
 		ID:           sessionID,
 		UserID:       userID,
-		DeviceID:     deviceID,
+		DeviceID:     &deviceID,
 		RefreshToken: refreshToken,
 		IPAddress:    req.DeviceInfo.IpAddress,
 		UserAgent:    &req.DeviceInfo.UserAgent,
@@ -149,6 +187,8 @@ func (h *AuthHandler) Register(ctx context.Context, req *pb.RegisterRequest) (*p
 		IsActive:     true,
 		ExpiresAt:    time.Now().Add(7 * 24 * time.Hour),
 		CreatedAt:    time.Now(),
+		AuthTime:     &authTime,
+		AMR:          amr,
 	}
 
 	err = h.repo.CreateSession(session)
@@ -190,32 +230,43 @@ func (h *AuthHandler) Login(ctx context.Context, req *pb.LoginRequest) (*pb.Logi
 	log.Printf("Login request received for email: %s", req.Email)
 
 	// Validate input
-	if req.Email == "" || req.Password == "" {
-		return &pb.LoginResponse{
-			Success: false,
-			Message: "Email and password are required",
-		}, nil
+	if violations := requiredFields(map[string]string{
+		"email":    req.Email,
+		"password": req.Password,
+	}); len(violations) > 0 {
+		return nil, grpcerr.InvalidArgument("Email and password are required", violations...)
+	}
+
+	// Ensure deviceInfo is not nil before using it below.
+	// If nil, create a minimal placeholder so later dereferences don't panic.
+	if req.DeviceInfo == nil {
+		req.DeviceInfo = &pb.DeviceInfo{}
+	}
+
+	// Fallback IP: prefer deviceInfo.IP, otherwise try ctx HTTP request
+	ip := req.DeviceInfo.IpAddress
+	if ip == "" {
+		ip = getIPFromContext(ctx)
+		req.DeviceInfo.IpAddress = ip
 	}
 
 	// Get user from database
 	user, err := h.repo.GetUserByEmail(req.Email)
-	if err != nil {
+	if errors.Is(err, repository.ErrUserNotFound) {
 		log.Printf("User not found: %s", req.Email)
 		h.createFailedLoginAuditLog(req.Email, req.DeviceInfo, "user_not_found")
-		return &pb.LoginResponse{
-			Success: false,
-			Message: "Invalid email or password",
-		}, nil
+		return nil, grpcerr.Unauthenticated("Invalid email or password", reasonInvalidCredentials)
+	}
+	if err != nil {
+		log.Printf("Failed to get user: %v", err)
+		return nil, grpcerr.Storage("Login failed", err)
 	}
 
 	// Check if user is active
 	if !user.IsActive {
 		log.Printf("User account is inactive: %s", req.Email)
 		h.createFailedLoginAuditLog(req.Email, req.DeviceInfo, "account_inactive")
-		return &pb.LoginResponse{
-			Success: false,
-			Message: "Account is inactive",
-		}, nil
+		return nil, grpcerr.PermissionDenied("Account is inactive", reasonAccountInactive)
 	}
 
 	// Verify password
@@ -223,16 +274,79 @@ func (h *AuthHandler) Login(ctx context.Context, req *pb.LoginRequest) (*pb.Logi
 	if err != nil {
 		log.Printf("Invalid password for user: %s", req.Email)
 		h.createFailedLoginAuditLog(req.Email, req.DeviceInfo, "invalid_password")
-		return &pb.LoginResponse{
-			Success: false,
-			Message: "Invalid email or password",
-		}, nil
+		return nil, grpcerr.Unauthenticated("Invalid email or password", reasonInvalidCredentials)
+	}
+
+	return h.signIn(user, &signInAttempt{
+		deviceInfo:       req.DeviceInfo,
+		mfaCode:          req.MfaCode,
+		deviceTrustToken: req.DeviceTrustToken,
+		rememberDevice:   req.RememberDevice,
+	})
+}
+
+// signInAttempt is what a client sent along with a user's credentials
+type signInAttempt struct {
+	deviceInfo       *pb.DeviceInfo
+	mfaCode          string
+	deviceTrustToken string
+	rememberDevice   bool
+	provider         string // identity provider of a federated login, empty for passwords
+	idpEntityID      string // entity ID of a SAML identity provider
+}
+
+// signIn finishes signing in a user whose credentials were verified: it
+// enforces the organization's policies, asks for or checks the MFA code,
+// tracks the device, looks for anomalies and opens the session
+func (h *AuthHandler) signIn(user *models.User, attempt *signInAttempt) (*pb.LoginResponse, error) {
+	// The organization's policies are enforced once the credentials are
+	// known to be right, so they can't be used to probe which accounts exist
+	org, err := h.getOrganization(user.OrganizationID)
+	if err != nil {
+		return nil, err
+	}
+	violation, err := h.checkSignInLocation(org, user, attempt.deviceInfo.IpAddress, attempt.deviceInfo.LocationCountry)
+	if err != nil {
+		return nil, err
+	}
+
+	// A step-up asks for the MFA code again, which users without MFA can't
+	// give, so they are blocked instead
+	stepUp := violation != nil && violation.action == models.AccessPolicyStepUp && user.MFAEnabled
+	if violation != nil {
+		outcome := outcomeBlocked
+		if stepUp {
+			outcome = outcomeStepUp
+		}
+		// The answer to a step-up repeats the login with the code; the
+		// violation was recorded when the code was asked for
+		if !stepUp || attempt.mfaCode == "" {
+			h.recordPolicyViolation(user, nil, stageLogin, attempt.deviceInfo.IpAddress, attempt.deviceInfo.LocationCountry, violation, outcome)
+		}
 	}
+	if violation == nil {
+		violation = checkMFAPolicy(org, user)
+	}
+	if violation != nil && !stepUp {
+		log.Printf("Login refused by organization policy for user %s: %s", user.ID, violation.failureReason)
+		h.createFailedLoginAuditLog(user.Email, attempt.deviceInfo, violation.failureReason)
+		return nil, grpcerr.PermissionDenied(violation.message, violation.reason)
+	}
+
+	// Compare with the previous login once, before this one's session
+	// exists; the result decides both the MFA bypass and the alerts
+	anomaly := h.detectTravelAnomaly(user.ID, attempt.deviceInfo)
+
+	// A device remembered with a trust token may skip the MFA code, unless
+	// an access policy asks for it again
+	mfaSkipped := !stepUp && user.MFAEnabled && attempt.mfaCode == "" &&
+		h.verifyDeviceTrustToken(user, attempt.deviceInfo, attempt.deviceTrustToken, anomaly)
 
 	// Check if MFA is enabled
-	if user.MFAEnabled {
-		// If MFA code is not provided, request it
-		if req.MfaCode == "" {
+	if user.MFAEnabled && !mfaSkipped {
+		// If MFA code is not provided, request it. This is a step of the
+		// login rather than a failure, so it is a response, not an error.
+		if attempt.mfaCode == "" {
 			return &pb.LoginResponse{
 				Success:     false,
 				Message:     "MFA code required",
@@ -243,67 +357,59 @@ func (h *AuthHandler) Login(ctx context.Context, req *pb.LoginRequest) (*pb.Logi
 		// Validate MFA code
 		if user.MFASecret == nil {
 			log.Printf("MFA secret not found for user: %s", user.ID)
-			return &pb.LoginResponse{
-				Success: false,
-				Message: "MFA configuration error",
-			}, nil
+			return nil, grpcerr.Internal("MFA configuration error")
 		}
 
-		valid := utils.ValidateMFACode(req.MfaCode, *user.MFASecret)
+		valid := utils.ValidateMFACode(attempt.mfaCode, *user.MFASecret)
 		if !valid {
 			log.Printf("Invalid MFA code for user: %s", user.ID)
-			h.createFailedLoginAuditLog(req.Email, req.DeviceInfo, "invalid_mfa_code")
-			return &pb.LoginResponse{
-				Success: false,
-				Message: "Invalid MFA code",
-			}, nil
+			h.createFailedLoginAuditLog(user.Email, attempt.deviceInfo, "invalid_mfa_code")
+			return nil, grpcerr.Unauthenticated("Invalid MFA code", reasonInvalidMFACode)
 		}
 	}
 
 	// Create or get device
-	deviceID,isNewDevice, err := h.handleDevice(req.DeviceInfo, user.ID)
+	deviceID,isNewDevice, err := h.handleDevice(attempt.deviceInfo, user.ID)
 	if err != nil {
 		log.Printf("Failed to handle device: %v", err)
 	}
-	
-	// Ensure deviceInfo is not nil before using it below.
-	// If nil, create a minimal placeholder so later dereferences don't panic.
-	if req.DeviceInfo == nil {
-		req.DeviceInfo = &pb.DeviceInfo{}
-	}
-
-	// Fallback IP: prefer deviceInfo.IP, otherwise try ctx HTTP request
-	ip := req.DeviceInfo.IpAddress
-	if ip == "" {
-		ip = getIPFromContext(ctx)
-		req.DeviceInfo.IpAddress = ip
-	}
 
 	// Debug log: make it explicit why NewDevice alert may fire
-	log.Printf("Device check: deviceID=%s isNewDevice=%v ip=%s user=%s", deviceID, isNewDevice, ip, req.Email)
+	log.Printf("Device check: deviceID=%s isNewDevice=%v ip=%s user=%s", deviceID, isNewDevice, attempt.deviceInfo.IpAddress, user.Email)
 
 
 	// Check for security anomalies
 	// isNewDevice = deviceID!=""&& err==nil
-	h.detectAndCreateAlerts(user.ID,req.DeviceInfo,isNewDevice)
+	h.detectAndCreateAlerts(user.ID,attempt.deviceInfo,isNewDevice,anomaly)
+
+	roles, permissions, err := h.getUserAuthorization(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Record how the user signed in, so sensitive operations can ask for a
+	// recent sign-in with a second factor. A trusted device skipping the MFA
+	// code doesn't count as one.
+	authTime := time.Now()
+	amr := []string{utils.AMRPassword}
+	if attempt.provider != "" {
+		amr = []string{utils.AMRFederated}
+	}
+	if user.MFAEnabled && !mfaSkipped {
+		amr = append(amr, utils.AMRMFA)
+	}
 
 	// Generate JWT tokens
-	accessToken, err := utils.GenerateAccessToken(user.ID, user.Email, h.jwtSecret)
+	accessToken, err := utils.GenerateAccessToken(user.ID, user.Email, user.OrganizationID, roles, permissions, authTime, amr, h.jwtSecret)
 	if err != nil {
 		log.Printf("Failed to generate access token: %v", err)
-		return &pb.LoginResponse{
-			Success: false,
-			Message: "Failed to generate authentication token",
-		}, nil
+		return nil, grpcerr.Internal("Failed to generate authentication token")
 	}
 
 	refreshToken, err := utils.GenerateRefreshToken(user.ID, user.Email, h.jwtSecret)
 	if err != nil {
 		log.Printf("Failed to generate refresh token: %v", err)
-		return &pb.LoginResponse{
-			Success: false,
-			Message: "Failed to generate refresh token",
-		}, nil
+		return nil, grpcerr.Internal("Failed to generate refresh token")
 	}
 
 	// Create session
@@ -311,17 +417,19 @@ func (h *AuthHandler) Login(ctx context.Context, req *pb.LoginRequest) (*pb.Logi
 	session := &models.Session{
 		ID:           sessionID,
 		UserID:       user.ID,
-		DeviceID:     deviceID,
+		DeviceID:     &deviceID,
 		RefreshToken: refreshToken,
-		IPAddress:    (req.DeviceInfo.IpAddress),
-		UserAgent:    &req.DeviceInfo.UserAgent,
-		LocationCountry: strPtr(req.DeviceInfo.LocationCountry),
-		LocationCity:    strPtr(req.DeviceInfo.LocationCity),
-		Latitude:        floatPtr(req.DeviceInfo.Latitude),
-		Longitude:       floatPtr(req.DeviceInfo.Longitude),
+		IPAddress:    (attempt.deviceInfo.IpAddress),
+		UserAgent:    &attempt.deviceInfo.UserAgent,
+		LocationCountry: strPtr(attempt.deviceInfo.LocationCountry),
+		LocationCity:    strPtr(attempt.deviceInfo.LocationCity),
+		Latitude:        floatPtr(attempt.deviceInfo.Latitude),
+		Longitude:       floatPtr(attempt.deviceInfo.Longitude),
 		IsActive:     true,
-		ExpiresAt:    time.Now().Add(7 * 24 * time.Hour),
+		ExpiresAt:    time.Now().Add(sessionLifetime(org)),
 		CreatedAt:    time.Now(),
+		AuthTime:     &authTime,
+		AMR:          amr,
 	}
 
 	err = h.repo.CreateSession(session)
@@ -329,6 +437,33 @@ func (h *AuthHandler) Login(ctx context.Context, req *pb.LoginRequest) (*pb.Logi
 		log.Printf("Failed to create session: %v", err)
 	}
 
+	// Remember the device only after the MFA code itself was verified
+	deviceTrustToken := ""
+	if attempt.rememberDevice && user.MFAEnabled && !mfaSkipped {
+		deviceTrustToken = h.issueDeviceTrustToken(user.ID, attempt.deviceInfo)
+	}
+
+	details := map[string]interface{}{}
+	if mfaSkipped {
+		details["mfa"] = "trusted_device"
+	}
+	if stepUp {
+		details["mfa"] = "step_up"
+		details["access_policy_id"] = violation.policyID
+	}
+	if attempt.provider != "" {
+		details["provider"] = attempt.provider
+	}
+	if attempt.idpEntityID != "" {
+		details["idp_entity_id"] = attempt.idpEntityID
+	}
+	var loginMetadata *string
+	if len(details) > 0 {
+		metadata, _ := json.Marshal(details)
+		metadataStr := string(metadata)
+		loginMetadata = &metadataStr
+	}
+
 	// Create audit log
 	userIDCopy := user.ID
 	h.createAuditLog(&models.AuditLog{
@@ -339,10 +474,11 @@ func (h *AuthHandler) Login(ctx context.Context, req *pb.LoginRequest) (*pb.Logi
 		EventType:     "user_login",
 		EventCategory: "authentication",
 		Severity:      "info",
-		IPAddress:     strPtr(req.DeviceInfo.IpAddress),
-		UserAgent:     &req.DeviceInfo.UserAgent,
-		LocationCountry: strPtr(req.DeviceInfo.LocationCountry),
-		LocationCity:    strPtr(req.DeviceInfo.LocationCity),
+		IPAddress:     strPtr(attempt.deviceInfo.IpAddress),
+		UserAgent:     &attempt.deviceInfo.UserAgent,
+		LocationCountry: strPtr(attempt.deviceInfo.LocationCountry),
+		LocationCity:    strPtr(attempt.deviceInfo.LocationCity),
+		Metadata:      loginMetadata,
 		Success:       true,
 		CreatedAt:     time.Now(),
 	})
@@ -350,12 +486,13 @@ func (h *AuthHandler) Login(ctx context.Context, req *pb.LoginRequest) (*pb.Logi
 	log.Printf("User logged in successfully: %s", user.ID)
 
 	return &pb.LoginResponse{
-		Success:      true,
-		Message:      "Login successful",
-		UserId:       user.ID,
-		AccessToken:  accessToken,
-		RefreshToken: refreshToken,
-		SessionId:    sessionID,
+		Success:          true,
+		Message:          "Login successful",
+		UserId:           user.ID,
+		AccessToken:      accessToken,
+		RefreshToken:     refreshToken,
+		SessionId:        sessionID,
+		DeviceTrustToken: deviceTrustToken,
 	}, nil
 }
 
@@ -370,10 +507,14 @@ func (h *AuthHandler) ValidateToken(ctx context.Context, req *pb.ValidateTokenRe
 	}
 
 	return &pb.ValidateTokenResponse{
-		Valid:   true,
-		UserId:  claims.UserID,
-		Email:   claims.Email,
-		Message: "Token is valid",
+		Valid:          true,
+		UserId:         claims.UserID,
+		Email:          claims.Email,
+		Message:        "Token is valid",
+		Roles:          claims.Roles,
+		Permissions:    claims.Permissions,
+		ImpersonatorId: claims.ImpersonatorID,
+		OrganizationId: claims.OrganizationID,
 	}, nil
 }
 
@@ -382,36 +523,107 @@ func (h *AuthHandler) RefreshToken(ctx context.Context, req *pb.RefreshTokenRequ
 	// Validate refresh token
 	claims, err := utils.ValidateToken(req.RefreshToken, h.jwtSecret)
 	if err != nil {
-		return &pb.RefreshTokenResponse{
-			Success: false,
-			Message: "Invalid refresh token",
-		}, nil
+		return nil, grpcerr.Unauthenticated("Invalid refresh token", reasonInvalidRefreshToken)
 	}
 
 	// Check if session exists and is active
 	session, err := h.repo.GetSessionByRefreshToken(req.RefreshToken)
+	if err != nil && !errors.Is(err, repository.ErrSessionNotFound) {
+		log.Printf("Failed to get session: %v", err)
+		return nil, grpcerr.Storage("Failed to refresh token", err)
+	}
 	if err != nil || !session.IsActive {
-		return &pb.RefreshTokenResponse{
-			Success: false,
-			Message: "Session not found or inactive",
-		}, nil
+		return nil, grpcerr.Unauthenticated("Session not found or inactive", reasonSessionInactive)
 	}
 
 	// Check if session is expired
 	if time.Now().After(session.ExpiresAt) {
-		return &pb.RefreshTokenResponse{
-			Success: false,
-			Message: "Session expired",
-		}, nil
+		return nil, grpcerr.Unauthenticated("Session expired", reasonSessionExpired)
 	}
 
-	// Generate new access token
-	newAccessToken, err := utils.GenerateAccessToken(claims.UserID, claims.Email, h.jwtSecret)
+	user, err := h.getUser(session.UserID)
 	if err != nil {
-		return &pb.RefreshTokenResponse{
-			Success: false,
-			Message: "Failed to generate new access token",
-		}, nil
+		return nil, err
+	}
+	org, err := h.getOrganization(user.OrganizationID)
+	if err != nil {
+		return nil, err
+	}
+
+	// The organization may have shortened sessions since this one began
+	if time.Now().After(session.CreatedAt.Add(sessionLifetime(org))) {
+		return nil, grpcerr.Unauthenticated("Session expired", reasonSessionExpired)
+	}
+
+	// The policy applies to every refresh, from wherever the token is used
+	ip := req.IpAddress
+	if ip == "" {
+		ip = session.IPAddress
+	}
+	country := ""
+	if session.LocationCountry != nil {
+		country = *session.LocationCountry
+	}
+	violation, err := h.checkSignInLocation(org, user, ip, country)
+	if err != nil {
+		return nil, err
+	}
+	if violation != nil {
+		// A refresh can't ask for the MFA code, so a step-up makes the user
+		// sign in again
+		outcome := outcomeBlocked
+		if violation.action == models.AccessPolicyStepUp {
+			outcome = outcomeSignInRequired
+		}
+		h.recordPolicyViolation(user, &session.ID, stageTokenRefresh, ip, country, violation, outcome)
+	}
+	if violation == nil && session.ImpersonatorID == nil {
+		violation = checkMFAPolicy(org, user)
+	}
+	if violation != nil {
+		log.Printf("Token refresh refused by organization policy for user %s: %s", user.ID, violation.failureReason)
+		h.createAuditLog(&models.AuditLog{
+			ID:              uuid.New().String(),
+			UserID:          &user.ID,
+			SessionID:       &session.ID,
+			EventType:       "token_refresh_failed",
+			EventCategory:   "authentication",
+			Severity:        "warning",
+			IPAddress:       strPtr(ip),
+			LocationCountry: strPtr(country),
+			Success:         false,
+			FailureReason:   &violation.failureReason,
+			CreatedAt:       time.Now(),
+		})
+		if violation.action == models.AccessPolicyStepUp {
+			return nil, grpcerr.Unauthenticated("Sign in again to continue from this location", reasonStepUpRequired)
+		}
+		return nil, grpcerr.PermissionDenied(violation.message, violation.reason)
+	}
+
+	var newAccessToken string
+	if session.ImpersonatorID != nil {
+		newAccessToken, err = utils.GenerateImpersonationToken(claims.UserID, claims.Email, user.OrganizationID, *session.ImpersonatorID, h.jwtSecret)
+	} else {
+		// Roles may have changed since the last token was issued
+		roles, permissions, err := h.getUserAuthorization(claims.UserID)
+		if err != nil {
+			return nil, err
+		}
+
+		// The new token keeps the time and methods of the sign-in, so
+		// refreshing doesn't make the authentication look recent
+		authTime := session.CreatedAt
+		if session.AuthTime != nil {
+			authTime = *session.AuthTime
+		}
+
+		// Generate new access token
+		newAccessToken, err = utils.GenerateAccessToken(claims.UserID, claims.Email, user.OrganizationID, roles, permissions, authTime, session.AMR, h.jwtSecret)
+	}
+	if err != nil {
+		log.Printf("Failed to generate access token: %v", err)
+		return nil, grpcerr.Internal("Failed to generate new access token")
 	}
 
 	return &pb.RefreshTokenResponse{
@@ -425,39 +637,30 @@ func (h *AuthHandler) RefreshToken(ctx context.Context, req *pb.RefreshTokenRequ
 // EnableMFA enables multi-factor authentication for a user
 func (h *AuthHandler) EnableMFA(ctx context.Context, req *pb.EnableMFARequest) (*pb.EnableMFAResponse, error) {
 	// Get user
-	user, err := h.repo.GetUserByID(req.UserId)
+	user, err := h.getUser(req.UserId)
 	if err != nil {
-		return &pb.EnableMFAResponse{
-			Success: false,
-			Message: "User not found",
-		}, nil
+		return nil, err
 	}
 
 	// Generate MFA secret
 	secret, qrCodeURL, err := utils.GenerateMFASecret(user.Email)
 	if err != nil {
-		return &pb.EnableMFAResponse{
-			Success: false,
-			Message: "Failed to generate MFA secret",
-		}, nil
+		log.Printf("Failed to generate MFA secret: %v", err)
+		return nil, grpcerr.Internal("Failed to generate MFA secret")
 	}
 
 	// Generate backup codes
 	backupCodes, err := utils.GenerateBackupCodes()
 	if err != nil {
-		return &pb.EnableMFAResponse{
-			Success: false,
-			Message: "Failed to generate backup codes",
-		}, nil
+		log.Printf("Failed to generate backup codes: %v", err)
+		return nil, grpcerr.Internal("Failed to generate backup codes")
 	}
 
 	// Enable MFA for user
 	err = h.repo.EnableMFA(user.ID, secret)
 	if err != nil {
-		return &pb.EnableMFAResponse{
-			Success: false,
-			Message: "Failed to enable MFA",
-		}, nil
+		log.Printf("Failed to enable MFA: %v", err)
+		return nil, grpcerr.Storage("Failed to enable MFA", err)
 	}
 
 	// Create audit log
@@ -483,28 +686,19 @@ func (h *AuthHandler) EnableMFA(ctx context.Context, req *pb.EnableMFARequest) (
 // VerifyMFA verifies an MFA code
 func (h *AuthHandler) VerifyMFA(ctx context.Context, req *pb.VerifyMFARequest) (*pb.VerifyMFAResponse, error) {
 	// Get user
-	user, err := h.repo.GetUserByID(req.UserId)
+	user, err := h.getUser(req.UserId)
 	if err != nil {
-		return &pb.VerifyMFAResponse{
-			Success: false,
-			Message: "User not found",
-		}, nil
+		return nil, err
 	}
 
 	if !user.MFAEnabled || user.MFASecret == nil {
-		return &pb.VerifyMFAResponse{
-			Success: false,
-			Message: "MFA not enabled",
-		}, nil
+		return nil, grpcerr.FailedPrecondition("MFA not enabled", reasonMFANotEnabled)
 	}
 
 	// Validate MFA code
 	valid := utils.ValidateMFACode(req.Code, *user.MFASecret)
 	if !valid {
-		return &pb.VerifyMFAResponse{
-			Success: false,
-			Message: "Invalid MFA code",
-		}, nil
+		return nil, grpcerr.InvalidArgument("Invalid MFA code", grpcerr.Field("code", "is not a valid MFA code"))
 	}
 
 	return &pb.VerifyMFAResponse{
@@ -515,29 +709,105 @@ func (h *AuthHandler) VerifyMFA(ctx context.Context, req *pb.VerifyMFARequest) (
 
 // GetUserProfile retrieves user profile information
 func (h *AuthHandler) GetUserProfile(ctx context.Context, req *pb.GetUserProfileRequest) (*pb.GetUserProfileResponse, error) {
-	user, err := h.repo.GetUserByID(req.UserId)
+	user, err := h.getUser(req.UserId)
 	if err != nil {
-		return &pb.GetUserProfileResponse{
-			Success: false,
-			Message: "User not found",
-		}, nil
+		return nil, err
+	}
+
+	roles, permissions, err := h.getUserAuthorization(user.ID)
+	if err != nil {
+		return nil, err
 	}
 
 	return &pb.GetUserProfileResponse{
 		Success: true,
 		Message: "User profile retrieved",
-		Profile: &pb.UserProfile{
-			Id:         user.ID,
-			Email:      user.Email,
-			FullName:   user.FullName,
-			IsActive:   user.IsActive,
-			MfaEnabled: user.MFAEnabled,
-			CreatedAt:  user.CreatedAt.Format(time.RFC3339),
-			UpdatedAt:  user.UpdatedAt.Format(time.RFC3339),
-		},
+		Profile: userProfileToProto(&models.UserWithRoles{User: *user, Roles: roles, Permissions: permissions}),
 	}, nil
 }
 
+// userProfileToProto converts a user to the profile returned to clients
+func userProfileToProto(user *models.UserWithRoles) *pb.UserProfile {
+	return &pb.UserProfile{
+		Id:          user.ID,
+		Email:       user.Email,
+		FullName:    user.FullName,
+		IsActive:    user.IsActive,
+		MfaEnabled:  user.MFAEnabled,
+		CreatedAt:   user.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:   user.UpdatedAt.Format(time.RFC3339),
+		Roles:       user.Roles,
+		Permissions: user.Permissions,
+		DeletedAt:   formatTime(user.DeletedAt),
+
+		DeletionScheduledAt: formatTime(user.DeletionScheduledAt),
+		OrganizationId:      user.OrganizationID,
+	}
+}
+
+// formatTime formats an optional timestamp for clients, empty when unset
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// stringValue returns an optional string for clients, empty when unset
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// getUser loads a user, returning a status error if that fails
+func (h *AuthHandler) getUser(userID string) (*models.User, error) {
+	user, err := h.repo.GetUserByID(userID)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return nil, grpcerr.NotFound("User not found", "user", userID)
+	}
+	if err != nil {
+		log.Printf("Failed to get user: %v", err)
+		return nil, grpcerr.Storage("Failed to get user", err)
+	}
+
+	return user, nil
+}
+
+// getUserAuthorization loads the roles and permissions of a user, returning
+// a status error if that fails
+func (h *AuthHandler) getUserAuthorization(userID string) ([]string, []string, error) {
+	roles, permissions, err := h.repo.GetUserAuthorization(userID)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return nil, nil, grpcerr.NotFound("User not found", "user", userID)
+	}
+	if err != nil {
+		log.Printf("Failed to get user roles: %v", err)
+		return nil, nil, grpcerr.Storage("Failed to get user roles", err)
+	}
+
+	return roles, permissions, nil
+}
+
+// requiredFields returns a violation for every empty field, in name order
+func requiredFields(fields map[string]string) []*errdetails.BadRequest_FieldViolation {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var violations []*errdetails.BadRequest_FieldViolation
+	for _, name := range names {
+		if strings.TrimSpace(fields[name]) == "" {
+			violations = append(violations, grpcerr.Field(name, "is required"))
+		}
+	}
+
+	return violations
+}
+
 // Helper function to handle device creation/retrieval
 func (h *AuthHandler) handleDevice(deviceInfo *pb.DeviceInfo, userID string) (string,bool, error) {
 	if deviceInfo == nil || deviceInfo.DeviceFingerprint == "" {
@@ -550,6 +820,18 @@ func (h *AuthHandler) handleDevice(deviceInfo *pb.DeviceInfo, userID string) (st
 		return "", false,err
 	}
 
+	if existingDevice != nil && existingDevice.RemovedAt != nil {
+		// The user removed this device earlier, so treat it as new again
+		existingDevice.DeviceName = &deviceInfo.DeviceName
+		existingDevice.DeviceType = &deviceInfo.DeviceType
+		existingDevice.OS = &deviceInfo.Os
+		existingDevice.Browser = &deviceInfo.Browser
+		if err := h.repo.RestoreDevice(existingDevice); err != nil {
+			return "", true, err
+		}
+		return existingDevice.ID, true, nil
+	}
+
 	if existingDevice != nil {
 		// Update last seen
 		h.repo.UpdateDeviceLastSeen(existingDevice.ID)
@@ -606,11 +888,7 @@ func getIPFromContext(ctx context.Context) string {
 
 // Helper function to create audit log
 func (h *AuthHandler) createAuditLog(log *models.AuditLog) {
-	err := h.repo.CreateAuditLog(log)
-	if err != nil {
-		log := fmt.Sprintf("Failed to create audit log: %v", err)
-		fmt.Println(log)
-	}
+	h.audit.Record(log)
 }
 
 // Helper function to create failed login audit log
@@ -630,8 +908,8 @@ func (h *AuthHandler) createFailedLoginAuditLog(email string, deviceInfo *pb.Dev
 	})
 }
 
-// Helper function to detect and create security alerts
-func (h *AuthHandler) detectAndCreateAlerts(userID string, deviceInfo *pb.DeviceInfo, isNewDevice bool) {
+// Helper function to create security alerts for a new device or a travel anomaly
+func (h *AuthHandler) detectAndCreateAlerts(userID string, deviceInfo *pb.DeviceInfo, isNewDevice bool, anomaly *utils.AnomalyDetection) {
 
     // If new device → immediate alert
     if isNewDevice {
@@ -650,51 +928,11 @@ func (h *AuthHandler) detectAndCreateAlerts(userID string, deviceInfo *pb.Device
             CreatedAt:       time.Now(),
         }
 
-        err := h.repo.CreateSecurityAlert(alert)
-        if err != nil {
-            log.Printf("Failed to create new device alert: %v", err)
-        } else {
-            log.Printf("Security alert created: new_device")
-        }
+        h.audit.RecordAlert(alert)
+        log.Printf("Security alert created: new_device")
         return
     }
 
-    // Fetch last login
-    lastTime, lastCountry, lastCity, lastLat, lastLon, err := h.repo.GetLastLoginLocation(userID)
-    if err != nil {
-        log.Printf("Failed to get last login location: %v", err)
-        return
-    }
-
-    // No previous location → cannot check travel
-    if lastTime == nil || lastCountry == nil || lastCity == nil || lastLat == nil || lastLon == nil {
-        log.Printf("No previous location data for travel detection")
-        return
-    }
-
-    // Missing current location
-    if deviceInfo.LocationCountry == "" || deviceInfo.LocationCity == "" ||
-        deviceInfo.Latitude == 0 || deviceInfo.Longitude == 0 {
-        log.Printf("Current location data incomplete, skipping travel detection")
-        return
-    }
-
-    currentLocation := utils.Location{
-        Country:   deviceInfo.LocationCountry,
-        City:      deviceInfo.LocationCity,
-        Latitude:  deviceInfo.Latitude,
-        Longitude: deviceInfo.Longitude,
-    }
-
-    previousLocation := &utils.Location{
-        Country:   *lastCountry,
-        City:      *lastCity,
-        Latitude:  *lastLat,
-        Longitude: *lastLon,
-    }
-
-    anomaly := utils.DetectAnomalies(currentLocation, previousLocation, lastTime, false)
-
     if anomaly == nil {
         return
     }
@@ -723,10 +961,237 @@ func (h *AuthHandler) detectAndCreateAlerts(userID string, deviceInfo *pb.Device
         CreatedAt:       time.Now(),
     }
 
-    err = h.repo.CreateSecurityAlert(alert)
-    if err != nil {
-        log.Printf("Failed to create security alert: %v", err)
-    } else {
-        log.Printf("Security alert created: %s - %s", alertType, anomaly.Description)
+    h.audit.RecordAlert(alert)
+    log.Printf("Security alert created: %s - %s", alertType, anomaly.Description)
+
+    // A high-risk login cancels every remembered device for the user
+    if isHighRiskAnomaly(anomaly) {
+        h.revokeDeviceTrustTokens(userID, alertType)
     }
 }
+
+// detectTravelAnomaly compares the login location with the previous login.
+// It returns nil when there is nothing to compare or nothing suspicious.
+func (h *AuthHandler) detectTravelAnomaly(userID string, deviceInfo *pb.DeviceInfo) *utils.AnomalyDetection {
+	// Fetch last login
+	lastTime, lastCountry, lastCity, lastLat, lastLon, err := h.repo.GetLastLoginLocation(userID)
+	if err != nil {
+		log.Printf("Failed to get last login location: %v", err)
+		return nil
+	}
+
+	// No previous location → cannot check travel
+	if lastTime == nil || lastCountry == nil || lastCity == nil || lastLat == nil || lastLon == nil {
+		log.Printf("No previous location data for travel detection")
+		return nil
+	}
+
+	// Missing current location
+	if deviceInfo.LocationCountry == "" || deviceInfo.LocationCity == "" ||
+		deviceInfo.Latitude == 0 || deviceInfo.Longitude == 0 {
+		log.Printf("Current location data incomplete, skipping travel detection")
+		return nil
+	}
+
+	currentLocation := utils.Location{
+		Country:   deviceInfo.LocationCountry,
+		City:      deviceInfo.LocationCity,
+		Latitude:  deviceInfo.Latitude,
+		Longitude: deviceInfo.Longitude,
+	}
+
+	previousLocation := &utils.Location{
+		Country:   *lastCountry,
+		City:      *lastCity,
+		Latitude:  *lastLat,
+		Longitude: *lastLon,
+	}
+
+	return utils.DetectAnomalies(currentLocation, previousLocation, lastTime, false)
+}
+
+// isHighRiskAnomaly reports whether an anomaly should cancel trusted-device MFA bypass
+func isHighRiskAnomaly(anomaly *utils.AnomalyDetection) bool {
+	return anomaly != nil && (anomaly.Severity == "high" || anomaly.Severity == "critical")
+}
+
+// verifyDeviceTrustToken checks whether a device trust token lets this login skip MFA.
+// The token must belong to the user, be bound to the device row behind the presented
+// fingerprint, postdate the last password change, and the device must still be trusted.
+// anomaly is the login's travel anomaly, if any.
+func (h *AuthHandler) verifyDeviceTrustToken(user *models.User, deviceInfo *pb.DeviceInfo, rawToken string, anomaly *utils.AnomalyDetection) bool {
+	if h.mfaTrustTTL <= 0 || rawToken == "" || deviceInfo == nil || deviceInfo.DeviceFingerprint == "" {
+		return false
+	}
+
+	token, err := h.repo.GetDeviceTrustToken(utils.HashDeviceTrustToken(rawToken))
+	if err != nil {
+		log.Printf("Failed to get device trust token: %v", err)
+		return false
+	}
+
+	now := time.Now()
+	if token == nil || token.UserID != user.ID || token.RevokedAt != nil ||
+		now.After(token.ExpiresAt) || token.CreatedAt.Before(user.PasswordChangedAt) {
+		return false
+	}
+
+	device, err := h.repo.GetDeviceByFingerprint(deviceInfo.DeviceFingerprint)
+	if err != nil || device == nil {
+		return false
+	}
+
+	if device.ID != token.DeviceID || device.RemovedAt != nil || !isDeviceTrusted(device, now) {
+		return false
+	}
+
+	// Never skip MFA for a login that itself looks high-risk
+	if isHighRiskAnomaly(anomaly) {
+		h.revokeDeviceTrustTokens(user.ID, "high_risk_login")
+		return false
+	}
+
+	if err := h.repo.UpdateDeviceTrustTokenLastUsed(token.ID); err != nil {
+		log.Printf("Failed to update device trust token: %v", err)
+	}
+
+	return true
+}
+
+// issueDeviceTrustToken issues a device trust token for a trusted device.
+// It returns an empty string when the device is not trusted or issuing fails.
+func (h *AuthHandler) issueDeviceTrustToken(userID string, deviceInfo *pb.DeviceInfo) string {
+	if h.mfaTrustTTL <= 0 || deviceInfo == nil || deviceInfo.DeviceFingerprint == "" {
+		return ""
+	}
+
+	device, err := h.repo.GetDeviceByFingerprint(deviceInfo.DeviceFingerprint)
+	if err != nil || device == nil {
+		return ""
+	}
+
+	now := time.Now()
+	if device.UserID != userID || device.RemovedAt != nil || !isDeviceTrusted(device, now) {
+		return ""
+	}
+
+	// The bypass never outlives the device's own trust
+	expiresAt := now.Add(h.mfaTrustTTL)
+	if device.TrustedUntil != nil && device.TrustedUntil.Before(expiresAt) {
+		expiresAt = *device.TrustedUntil
+	}
+
+	rawToken, tokenHash, err := utils.GenerateDeviceTrustToken()
+	if err != nil {
+		log.Printf("Failed to generate device trust token: %v", err)
+		return ""
+	}
+
+	err = h.repo.CreateDeviceTrustToken(&models.DeviceTrustToken{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		DeviceID:  device.ID,
+		TokenHash: tokenHash,
+		ExpiresAt: expiresAt,
+		CreatedAt: now,
+	})
+	if err != nil {
+		log.Printf("Failed to create device trust token: %v", err)
+		return ""
+	}
+
+	h.createAuditLog(&models.AuditLog{
+		ID:            uuid.New().String(),
+		UserID:        &userID,
+		DeviceID:      &device.ID,
+		EventType:     "device_remembered",
+		EventCategory: "security",
+		Severity:      "info",
+		Success:       true,
+		CreatedAt:     now,
+	})
+
+	return rawToken
+}
+
+// deviceTrustRevocationReasons are the reasons the session service gives for
+// revoking a device's trust tokens
+var deviceTrustRevocationReasons = map[string]bool{
+	"device_untrusted": true,
+	"device_removed":   true,
+}
+
+// RevokeDeviceTrust revokes the device trust tokens of one device, when the
+// session service untrusts or removes it, so trusting it again later doesn't
+// bring old tokens back
+func (h *AuthHandler) RevokeDeviceTrust(ctx context.Context, req *pb.RevokeDeviceTrustRequest) (*pb.RevokeDeviceTrustResponse, error) {
+	log.Printf("RevokeDeviceTrust request received for device: %s", req.DeviceId)
+
+	if _, err := uuid.Parse(req.UserId); err != nil {
+		return nil, grpcerr.InvalidArgument("Invalid user ID", grpcerr.Field("user_id", "must be a UUID"))
+	}
+	if _, err := uuid.Parse(req.DeviceId); err != nil {
+		return nil, grpcerr.InvalidArgument("Invalid device ID", grpcerr.Field("device_id", "must be a UUID"))
+	}
+	if !deviceTrustRevocationReasons[req.Reason] {
+		return nil, grpcerr.InvalidArgument("Reason must be device_untrusted or device_removed",
+			grpcerr.Field("reason", "must be device_untrusted or device_removed"))
+	}
+
+	count, err := h.repo.RevokeDeviceTrustTokens(req.UserId, req.DeviceId)
+	if err != nil {
+		log.Printf("Failed to revoke device trust tokens: %v", err)
+		return nil, grpcerr.Storage("Failed to revoke device trust tokens", err)
+	}
+
+	if count > 0 {
+		metadata := fmt.Sprintf(`{"reason":%q,"revoked_tokens":%d}`, req.Reason, count)
+		h.createAuditLog(&models.AuditLog{
+			ID:            uuid.New().String(),
+			UserID:        &req.UserId,
+			DeviceID:      &req.DeviceId,
+			EventType:     "device_trust_revoked",
+			EventCategory: "security",
+			Severity:      "warning",
+			Metadata:      &metadata,
+			Success:       true,
+			CreatedAt:     time.Now(),
+		})
+	}
+
+	return &pb.RevokeDeviceTrustResponse{
+		Success:      true,
+		Message:      fmt.Sprintf("%d device trust token(s) revoked", count),
+		RevokedCount: int32(count),
+	}, nil
+}
+
+// revokeDeviceTrustTokens cancels every remembered device for a user
+func (h *AuthHandler) revokeDeviceTrustTokens(userID string, reason string) {
+	count, err := h.repo.RevokeUserDeviceTrustTokens(userID)
+	if err != nil {
+		log.Printf("Failed to revoke device trust tokens: %v", err)
+		return
+	}
+
+	if count == 0 {
+		return
+	}
+
+	metadata := fmt.Sprintf(`{"reason":%q,"revoked_tokens":%d}`, reason, count)
+	h.createAuditLog(&models.AuditLog{
+		ID:            uuid.New().String(),
+		UserID:        &userID,
+		EventType:     "device_trust_revoked",
+		EventCategory: "security",
+		Severity:      "warning",
+		Metadata:      &metadata,
+		Success:       true,
+		CreatedAt:     time.Now(),
+	})
+}
+
+// isDeviceTrusted reports whether a device is trusted and its trust has not lapsed
+func isDeviceTrusted(device *models.Device, now time.Time) bool {
+	return device.IsTrusted && (device.TrustedUntil == nil || now.Before(*device.TrustedUntil))
+}
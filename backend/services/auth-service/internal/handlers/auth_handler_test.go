@@ -0,0 +1,368 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/audit"
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/models"
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/repository"
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/utils"
+	pb "github.com/aashiq-04/session-management-system/backend/services/auth-service/proto"
+)
+
+// securityAlert matches the event argument of an audit outbox insert by alert type
+type securityAlert string
+
+func (alertType securityAlert) Match(v driver.Value) bool {
+	alert, ok := v.([]byte)
+	return ok && bytes.Contains(alert, []byte(`"AlertType":"`+string(alertType)+`"`))
+}
+
+func expectSecurityAlert(mock sqlmock.Sqlmock, alertType string) {
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO audit_outbox (id, source, kind, event, created_at)")).
+		WithArgs(sqlmock.AnyArg(), "auth-service", models.OutboxKindSecurityAlert, securityAlert(alertType), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+// Login alerts go through the audit outbox, so the audit service stores them
+// and forwards them to the SIEM, rather than straight into security_alerts
+func TestLoginAlertsGoThroughOutbox(t *testing.T) {
+	deviceInfo := &pb.DeviceInfo{IpAddress: "203.0.113.7", LocationCountry: "FR", LocationCity: "Paris"}
+
+	tests := []struct {
+		name        string
+		isNewDevice bool
+		anomaly     *utils.AnomalyDetection
+		alertType   string // empty when no alert is raised
+	}{
+		{name: "new device", isNewDevice: true, alertType: "new_device"},
+		{
+			name:      "new country",
+			anomaly:   &utils.AnomalyDetection{NewCountry: true, Severity: "medium", Description: "Login from a new country"},
+			alertType: "new_country",
+		},
+		{name: "known device, no anomaly"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, mock := newPolicyTestHandler(t)
+			if tt.alertType != "" {
+				expectSecurityAlert(mock, tt.alertType)
+			}
+
+			h.detectAndCreateAlerts("user-1", deviceInfo, tt.isNewDevice, tt.anomaly)
+		})
+	}
+}
+
+// testTrustToken is the raw device trust token presented in tests
+const testTrustToken = "dGVzdC1kZXZpY2UtdHJ1c3QtdG9rZW4tMDAwMDAwMDA"
+
+var trustedDeviceInfo = &pb.DeviceInfo{DeviceFingerprint: "fingerprint-1", IpAddress: "203.0.113.7"}
+
+// newDeviceTrustTestHandler returns a handler remembering trusted devices for
+// 30 days, on a mock database
+func newDeviceTrustTestHandler(t *testing.T) (*AuthHandler, sqlmock.Sqlmock) {
+	t.Helper()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+		db.Close()
+	})
+
+	return &AuthHandler{
+		repo:        repository.NewUserRepository(db),
+		audit:       audit.NewOutbox(db, nil),
+		mfaTrustTTL: 30 * 24 * time.Hour,
+	}, mock
+}
+
+// trustUser returns user-1, who changed their password two days ago
+func trustUser() *models.User {
+	return &models.User{ID: "user-1", PasswordChangedAt: time.Now().Add(-48 * time.Hour)}
+}
+
+// trustedDevice returns user-1's device-1, trusted for another week
+func trustedDevice() *models.Device {
+	trustedUntil := time.Now().Add(7 * 24 * time.Hour)
+	return &models.Device{
+		ID:                "device-1",
+		UserID:            "user-1",
+		DeviceFingerprint: trustedDeviceInfo.DeviceFingerprint,
+		IsTrusted:         true,
+		TrustedUntil:      &trustedUntil,
+	}
+}
+
+// trustToken returns an unused token for user-1 on device-1, issued a day ago
+// and valid for another day
+func trustToken() *models.DeviceTrustToken {
+	return &models.DeviceTrustToken{
+		ID:        "token-1",
+		UserID:    "user-1",
+		DeviceID:  "device-1",
+		TokenHash: utils.HashDeviceTrustToken(testTrustToken),
+		ExpiresAt: time.Now().Add(24 * time.Hour),
+		CreatedAt: time.Now().Add(-24 * time.Hour),
+	}
+}
+
+// expectTrustToken expects rawToken to be looked up, finding token if not nil
+func expectTrustToken(mock sqlmock.Sqlmock, rawToken string, token *models.DeviceTrustToken) {
+	rows := sqlmock.NewRows([]string{"id", "user_id", "device_id", "token_hash", "expires_at", "last_used_at", "revoked_at", "created_at"})
+	if token != nil {
+		rows.AddRow(token.ID, token.UserID, token.DeviceID, token.TokenHash, token.ExpiresAt, token.LastUsedAt, token.RevokedAt, token.CreatedAt)
+	}
+	mock.ExpectQuery(regexp.QuoteMeta("FROM device_trust_tokens")).
+		WithArgs(utils.HashDeviceTrustToken(rawToken)).
+		WillReturnRows(rows)
+}
+
+// expectDevice expects the device with fingerprint to be looked up, finding
+// device if not nil
+func expectDevice(mock sqlmock.Sqlmock, fingerprint string, device *models.Device) {
+	rows := sqlmock.NewRows([]string{
+		"id", "user_id", "device_fingerprint", "device_name", "device_type", "os", "browser",
+		"is_trusted", "trusted_until", "removed_at", "first_seen_at", "last_seen_at", "created_at",
+	})
+	if device != nil {
+		rows.AddRow(device.ID, device.UserID, device.DeviceFingerprint, nil, nil, nil, nil,
+			device.IsTrusted, device.TrustedUntil, device.RemovedAt, time.Now(), time.Now(), time.Now())
+	}
+	mock.ExpectQuery(regexp.QuoteMeta("FROM devices")).
+		WithArgs(fingerprint).
+		WillReturnRows(rows)
+}
+
+// MFA is skipped only when every check on the token and the device passes.
+// Each case fails one check against a database that would let the login
+// through otherwise, so dropping any check makes its case skip MFA.
+func TestVerifyDeviceTrustToken(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	valid := func(*models.DeviceTrustToken) {}
+	trusted := func(*models.Device) {}
+
+	tests := []struct {
+		name     string
+		rawToken string
+		token    func(*models.DeviceTrustToken) // changes to a valid token; nil for an unknown one
+		device   func(*models.Device)           // changes to a trusted device; nil for an unknown one
+		anomaly  *utils.AnomalyDetection
+		wantSkip bool
+	}{
+		{name: "valid", token: valid, device: trusted, wantSkip: true},
+		{name: "medium-risk login", token: valid, device: trusted,
+			anomaly: &utils.AnomalyDetection{NewCountry: true, Severity: "medium"}, wantSkip: true},
+
+		{name: "unknown token", device: trusted},
+		{name: "altered token", rawToken: testTrustToken[:len(testTrustToken)-1] + "B", device: trusted},
+		{name: "expired", token: func(token *models.DeviceTrustToken) { token.ExpiresAt = past }, device: trusted},
+		{name: "revoked", token: func(token *models.DeviceTrustToken) { token.RevokedAt = &past }, device: trusted},
+		{name: "another user's token", token: func(token *models.DeviceTrustToken) { token.UserID = "user-2" }, device: trusted},
+		{name: "issued before a password change", token: func(token *models.DeviceTrustToken) {
+			token.CreatedAt = time.Now().Add(-72 * time.Hour)
+		}, device: trusted},
+
+		{name: "unknown device", token: valid},
+		{name: "another device's token", token: func(token *models.DeviceTrustToken) { token.DeviceID = "device-2" }, device: trusted},
+		{name: "device untrusted", token: valid, device: func(device *models.Device) { device.IsTrusted = false }},
+		{name: "device trust lapsed", token: valid, device: func(device *models.Device) { device.TrustedUntil = &past }},
+		{name: "device removed", token: valid, device: func(device *models.Device) { device.RemovedAt = &past }},
+
+		{name: "high-risk login", token: valid, device: trusted,
+			anomaly: &utils.AnomalyDetection{ImpossibleTravel: true, Severity: "critical"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { db.Close() })
+			h := &AuthHandler{repo: repository.NewUserRepository(db), audit: audit.NewOutbox(db, nil), mfaTrustTTL: 30 * 24 * time.Hour}
+
+			rawToken := testTrustToken
+			if tt.rawToken != "" {
+				rawToken = tt.rawToken
+			}
+
+			var token *models.DeviceTrustToken
+			if tt.token != nil {
+				token = trustToken()
+				tt.token(token)
+			}
+			expectTrustToken(mock, rawToken, token)
+
+			var device *models.Device
+			if tt.device != nil {
+				device = trustedDevice()
+				tt.device(device)
+			}
+			expectDevice(mock, trustedDeviceInfo.DeviceFingerprint, device)
+
+			// A high-risk login instead forgets every device the user trusted
+			if isHighRiskAnomaly(tt.anomaly) {
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE device_trust_tokens")).
+					WithArgs(sqlmock.AnyArg(), "user-1").
+					WillReturnResult(sqlmock.NewResult(0, 2))
+				expectAuditEvent(mock, "device_trust_revoked")
+			} else {
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE device_trust_tokens SET last_used_at = $1 WHERE id = $2")).
+					WithArgs(sqlmock.AnyArg(), "token-1").
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			}
+
+			if got := h.verifyDeviceTrustToken(trustUser(), trustedDeviceInfo, rawToken, tt.anomaly); got != tt.wantSkip {
+				t.Errorf("skip MFA = %v, want %v", got, tt.wantSkip)
+			}
+			if tt.wantSkip || isHighRiskAnomaly(tt.anomaly) {
+				if err := mock.ExpectationsWereMet(); err != nil {
+					t.Error(err)
+				}
+			}
+		})
+	}
+}
+
+// Without a token, a fingerprint or the feature, nothing is looked up
+func TestVerifyDeviceTrustTokenNeedsEverything(t *testing.T) {
+	tests := []struct {
+		name       string
+		ttl        time.Duration
+		deviceInfo *pb.DeviceInfo
+		rawToken   string
+	}{
+		{"disabled", 0, trustedDeviceInfo, testTrustToken},
+		{"no token", time.Hour, trustedDeviceInfo, ""},
+		{"no device", time.Hour, nil, testTrustToken},
+		{"no fingerprint", time.Hour, &pb.DeviceInfo{IpAddress: "203.0.113.7"}, testTrustToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, _ := newDeviceTrustTestHandler(t)
+			h.mfaTrustTTL = tt.ttl
+
+			if h.verifyDeviceTrustToken(trustUser(), tt.deviceInfo, tt.rawToken, nil) {
+				t.Error("skipped MFA")
+			}
+		})
+	}
+}
+
+// trustTokenHash matches the token_hash argument of a device trust token
+// insert, keeping it to compare with the raw token handed out
+type trustTokenHash struct {
+	hash *string
+}
+
+func (m trustTokenHash) Match(v driver.Value) bool {
+	hash, ok := v.(string)
+	*m.hash = hash
+	return ok && len(hash) == 64
+}
+
+// expiresAround matches a time within a second of want
+type expiresAround time.Time
+
+func (want expiresAround) Match(v driver.Value) bool {
+	got, ok := v.(time.Time)
+	diff := got.Sub(time.Time(want))
+	return ok && diff > -time.Second && diff < time.Second
+}
+
+func TestIssueDeviceTrustToken(t *testing.T) {
+	h, mock := newDeviceTrustTestHandler(t)
+	device := trustedDevice()
+	device.TrustedUntil = nil // trusted until untrusted
+	expectDevice(mock, trustedDeviceInfo.DeviceFingerprint, device)
+
+	var hash string
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO device_trust_tokens")).
+		WithArgs(sqlmock.AnyArg(), "user-1", "device-1", trustTokenHash{&hash}, expiresAround(time.Now().Add(h.mfaTrustTTL)), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectAuditEvent(mock, "device_remembered")
+
+	rawToken := h.issueDeviceTrustToken("user-1", trustedDeviceInfo)
+	if rawToken == "" {
+		t.Fatal("no token issued")
+	}
+	if utils.HashDeviceTrustToken(rawToken) != hash {
+		t.Error("the stored hash is not the hash of the issued token")
+	}
+}
+
+// A token never outlives the trust of its device
+func TestIssueDeviceTrustTokenExpiresWithDevice(t *testing.T) {
+	h, mock := newDeviceTrustTestHandler(t)
+	device := trustedDevice()
+	trustedUntil := time.Now().Add(2 * 24 * time.Hour)
+	device.TrustedUntil = &trustedUntil
+	expectDevice(mock, trustedDeviceInfo.DeviceFingerprint, device)
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO device_trust_tokens")).
+		WithArgs(sqlmock.AnyArg(), "user-1", "device-1", sqlmock.AnyArg(), trustedUntil, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectAuditEvent(mock, "device_remembered")
+
+	if h.issueDeviceTrustToken("user-1", trustedDeviceInfo) == "" {
+		t.Fatal("no token issued")
+	}
+}
+
+// A token is issued only for a device of the user that is still trusted. The
+// database would store one for any device, so dropping a check issues it.
+func TestIssueDeviceTrustTokenRefuses(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+
+	tests := []struct {
+		name   string
+		device func(*models.Device) // changes to a trusted device; nil for an unknown one
+	}{
+		{"unknown device", nil},
+		{"another user's device", func(device *models.Device) { device.UserID = "user-2" }},
+		{"untrusted device", func(device *models.Device) { device.IsTrusted = false }},
+		{"device trust lapsed", func(device *models.Device) { device.TrustedUntil = &past }},
+		{"removed device", func(device *models.Device) { device.RemovedAt = &past }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { db.Close() })
+			h := &AuthHandler{repo: repository.NewUserRepository(db), audit: audit.NewOutbox(db, nil), mfaTrustTTL: 30 * 24 * time.Hour}
+
+			var device *models.Device
+			if tt.device != nil {
+				device = trustedDevice()
+				tt.device(device)
+			}
+			expectDevice(mock, trustedDeviceInfo.DeviceFingerprint, device)
+			mock.ExpectExec(regexp.QuoteMeta("INSERT INTO device_trust_tokens")).WillReturnResult(sqlmock.NewResult(0, 1))
+			expectAuditEvent(mock, "device_remembered")
+
+			if rawToken := h.issueDeviceTrustToken("user-1", trustedDeviceInfo); rawToken != "" {
+				t.Errorf("issued %q", rawToken)
+			}
+		})
+	}
+
+	h, _ := newDeviceTrustTestHandler(t)
+	h.mfaTrustTTL = 0
+	if rawToken := h.issueDeviceTrustToken("user-1", trustedDeviceInfo); rawToken != "" {
+		t.Errorf("issued %q with the bypass disabled", rawToken)
+	}
+}
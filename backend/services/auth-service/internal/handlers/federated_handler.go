@@ -0,0 +1,378 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/grpcerr"
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/models"
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/oidc"
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/repository"
+	pb "github.com/aashiq-04/session-management-system/backend/services/auth-service/proto"
+)
+
+// Reasons reported in ErrorInfo when a federated login fails
+const (
+	reasonInvalidFederatedState = "INVALID_FEDERATED_STATE"
+	reasonFederatedLoginFailed  = "FEDERATED_LOGIN_FAILED"
+	reasonEmailNotVerified      = "EMAIL_NOT_VERIFIED"
+)
+
+// federatedLoginTTL is how long users have to come back from the identity
+// provider, and then to enter their MFA code
+const federatedLoginTTL = 10 * time.Minute
+
+// identityProviderRetryDelay is suggested to clients when a provider can't be reached
+const identityProviderRetryDelay = 5 * time.Second
+
+// federatedPasswordHash is stored for users created by a federated login. It
+// isn't a bcrypt hash, so no password matches it.
+const federatedPasswordHash = "!"
+
+// ListIdentityProviders returns the names of the configured identity providers
+func (h *AuthHandler) ListIdentityProviders(ctx context.Context, req *pb.ListIdentityProvidersRequest) (*pb.ListIdentityProvidersResponse, error) {
+	names := make([]string, 0, len(h.identityProviders))
+	for name := range h.identityProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return &pb.ListIdentityProvidersResponse{
+		Success:   true,
+		Message:   "Identity providers retrieved",
+		Providers: names,
+	}, nil
+}
+
+// StartFederatedLogin returns the provider URL to send the user to. The
+// state, nonce and PKCE verifier are kept until the user comes back; only a
+// hash of the state is stored, as it is all the client needs to finish.
+func (h *AuthHandler) StartFederatedLogin(ctx context.Context, req *pb.StartFederatedLoginRequest) (*pb.StartFederatedLoginResponse, error) {
+	provider, err := h.getIdentityProvider(req.Provider)
+	if err != nil {
+		return nil, err
+	}
+
+	authorizationURL, state, err := h.sendFederatedLogin(ctx, provider, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.StartFederatedLoginResponse{
+		Success:          true,
+		Message:          "Redirect the user to the identity provider",
+		AuthorizationUrl: authorizationURL,
+		State:            state,
+	}, nil
+}
+
+// sendFederatedLogin returns the URL that sends the user to a provider,
+// with the state that comes back with them. The state, nonce and PKCE
+// verifier are kept until then. Reauthentications ask the provider for a new
+// login.
+func (h *AuthHandler) sendFederatedLogin(ctx context.Context, provider *oidc.Provider, reauthentication bool) (string, string, error) {
+	state, nonce, verifier, err := oidc.NewLoginSecrets()
+	if err != nil {
+		log.Printf("Failed to generate federated login secrets: %v", err)
+		return "", "", grpcerr.Internal("Failed to start login")
+	}
+
+	buildURL := provider.AuthCodeURL
+	if reauthentication {
+		buildURL = provider.ReauthenticationURL
+	}
+	authorizationURL, err := buildURL(ctx, state, nonce, verifier)
+	if err != nil {
+		log.Printf("Failed to build authorization URL for %s: %v", provider.Name(), err)
+		return "", "", grpcerr.Unavailable("Identity provider is unavailable", identityProviderRetryDelay)
+	}
+
+	now := time.Now()
+	err = h.repo.SaveFederatedLoginState(&models.FederatedLoginState{
+		StateHash:        hashFederatedState(state),
+		Provider:         provider.Name(),
+		CodeVerifier:     verifier,
+		Nonce:            nonce,
+		Reauthentication: reauthentication,
+		ExpiresAt:        now.Add(federatedLoginTTL),
+		CreatedAt:        now,
+	})
+	if err != nil {
+		log.Printf("Failed to save federated login state: %v", err)
+		return "", "", grpcerr.Storage("Failed to start login", err)
+	}
+
+	return authorizationURL, state, nil
+}
+
+// CompleteFederatedLogin signs in the user the provider vouches for. The
+// provider account is linked to an existing user with the same verified
+// email, or to a new user. From there it is the same as a password login:
+// policies, MFA, device tracking, anomaly detection and the session. When
+// the user's MFA code is needed, the client sends it with the same state.
+// SAML logins finish here too, once the assertion consumer service has
+// accepted the identity provider's assertion.
+func (h *AuthHandler) CompleteFederatedLogin(ctx context.Context, req *pb.CompleteFederatedLoginRequest) (*pb.LoginResponse, error) {
+	log.Printf("CompleteFederatedLogin request received for provider: %s", req.Provider)
+
+	var provider *oidc.Provider
+	var samlConn *models.SAMLConnection
+	var err error
+	if strings.HasPrefix(req.Provider, samlProviderPrefix) {
+		samlConn, err = h.getSAMLConnection(req.Provider)
+	} else {
+		provider, err = h.getIdentityProvider(req.Provider)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if req.State == "" {
+		return nil, grpcerr.InvalidArgument("State is required", grpcerr.Field("state", "is required"))
+	}
+
+	if req.DeviceInfo == nil {
+		req.DeviceInfo = &pb.DeviceInfo{}
+	}
+	if req.DeviceInfo.IpAddress == "" {
+		req.DeviceInfo.IpAddress = getIPFromContext(ctx)
+	}
+
+	// Each state is used once, so a code or MFA answer can't be replayed
+	loginState, err := h.repo.ClaimFederatedLoginState(hashFederatedState(req.State), req.Provider)
+	if errors.Is(err, repository.ErrFederatedLoginStateNotFound) {
+		return nil, grpcerr.Unauthenticated("Login expired or was already used, please sign in again", reasonInvalidFederatedState)
+	}
+	if err != nil {
+		log.Printf("Failed to claim federated login state: %v", err)
+		return nil, grpcerr.Storage("Login failed", err)
+	}
+	// A reauthentication proves a signed-in user is there, so it doesn't
+	// open a session of its own
+	if loginState.Reauthentication {
+		return nil, grpcerr.Unauthenticated("Login expired or was already used, please sign in again", reasonInvalidFederatedState)
+	}
+
+	var user *models.User
+	if loginState.UserID != nil {
+		// The provider already vouched for the user, through the assertion
+		// consumer service or before asking for the MFA code
+		user, err = h.getUser(*loginState.UserID)
+	} else if samlConn != nil {
+		return nil, grpcerr.Unauthenticated("Login expired or was already used, please sign in again", reasonInvalidFederatedState)
+	} else {
+		if req.Code == "" {
+			return nil, grpcerr.InvalidArgument("Code is required", grpcerr.Field("code", "is required"))
+		}
+		user, err = h.resolveFederatedUser(ctx, provider, loginState, req.Code, req.DeviceInfo)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !user.IsActive {
+		log.Printf("User account is inactive: %s", user.Email)
+		h.createFailedLoginAuditLog(user.Email, req.DeviceInfo, "account_inactive")
+		return nil, grpcerr.PermissionDenied("Account is inactive", reasonAccountInactive)
+	}
+
+	attempt := &signInAttempt{
+		deviceInfo:       req.DeviceInfo,
+		mfaCode:          req.MfaCode,
+		deviceTrustToken: req.DeviceTrustToken,
+		rememberDevice:   req.RememberDevice,
+		provider:         req.Provider,
+	}
+	if samlConn != nil {
+		attempt.idpEntityID = samlConn.IdPEntityID
+	}
+	resp, err := h.signIn(user, attempt)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep the login open for the MFA code
+	if resp.MfaRequired {
+		loginState.UserID = &user.ID
+		loginState.ExpiresAt = time.Now().Add(federatedLoginTTL)
+		if err := h.repo.SaveFederatedLoginState(loginState); err != nil {
+			log.Printf("Failed to save federated login state: %v", err)
+			return nil, grpcerr.Storage("Login failed", err)
+		}
+	}
+
+	return resp, nil
+}
+
+// resolveFederatedUser redeems the code and returns the user the provider
+// account is linked to, linking it first if needed. Accounts are only linked
+// by email when the provider has verified it.
+func (h *AuthHandler) resolveFederatedUser(ctx context.Context, provider *oidc.Provider, loginState *models.FederatedLoginState, code string, deviceInfo *pb.DeviceInfo) (*models.User, error) {
+	account, err := provider.Exchange(ctx, code, loginState.CodeVerifier, loginState.Nonce)
+	if errors.Is(err, oidc.ErrProviderRejected) {
+		log.Printf("Federated login with %s rejected: %v", provider.Name(), err)
+		h.createFailedLoginAuditLog("", deviceInfo, "federated_login_rejected")
+		return nil, grpcerr.Unauthenticated("Sign-in with the identity provider failed", reasonFederatedLoginFailed)
+	}
+	if err != nil {
+		log.Printf("Failed to complete federated login with %s: %v", provider.Name(), err)
+		return nil, grpcerr.Unavailable("Identity provider is unavailable", identityProviderRetryDelay)
+	}
+
+	link, err := h.repo.GetFederatedIdentity(provider.Name(), account.Subject)
+	if err == nil {
+		if err := h.repo.UpdateFederatedIdentityLastLogin(link.ID); err != nil {
+			log.Printf("Failed to update federated identity: %v", err)
+		}
+		return h.getUser(link.UserID)
+	}
+	if !errors.Is(err, repository.ErrFederatedIdentityNotFound) {
+		log.Printf("Failed to get federated identity: %v", err)
+		return nil, grpcerr.Storage("Login failed", err)
+	}
+
+	if account.Email == "" || !account.EmailVerified {
+		log.Printf("Federated login with %s refused: email not verified", provider.Name())
+		h.createFailedLoginAuditLog(account.Email, deviceInfo, "email_not_verified")
+		return nil, grpcerr.PermissionDenied("Your email address isn't verified with the identity provider", reasonEmailNotVerified)
+	}
+
+	user, err := h.repo.GetUserByEmail(account.Email)
+	created := false
+	if errors.Is(err, repository.ErrUserNotFound) {
+		user, err = h.createFederatedUser(provider.Name(), account.Email, account.Name, "", deviceInfo)
+		created = true
+	}
+	if err != nil {
+		log.Printf("Failed to get user for federated login: %v", err)
+		return nil, grpcerr.Storage("Login failed", err)
+	}
+
+	return h.linkFederatedIdentity(provider.Name(), account.Subject, account.Email, user, created, deviceInfo)
+}
+
+// linkFederatedIdentity links a provider account to a user and returns the
+// user it ends up linked to. created tells whether the user was just
+// created for the account.
+func (h *AuthHandler) linkFederatedIdentity(providerName, subject, email string, user *models.User, created bool, deviceInfo *pb.DeviceInfo) (*models.User, error) {
+	now := time.Now()
+	err := h.repo.LinkFederatedIdentity(&models.FederatedIdentity{
+		ID:          uuid.New().String(),
+		UserID:      user.ID,
+		Provider:    providerName,
+		Subject:     subject,
+		Email:       &email,
+		CreatedAt:   now,
+		LastLoginAt: &now,
+	})
+	if errors.Is(err, repository.ErrFederatedIdentityExists) {
+		// Linked by a login that finished at the same time
+		link, err := h.repo.GetFederatedIdentity(providerName, subject)
+		if err != nil {
+			log.Printf("Failed to get federated identity: %v", err)
+			return nil, grpcerr.Storage("Login failed", err)
+		}
+		return h.getUser(link.UserID)
+	}
+	if err != nil {
+		log.Printf("Failed to link federated identity: %v", err)
+		return nil, grpcerr.Storage("Login failed", err)
+	}
+
+	// Linking gives the provider account access to an existing user, so it
+	// is worth a closer look than a new account
+	severity := "warning"
+	if created {
+		severity = "info"
+	}
+	metadata, _ := json.Marshal(map[string]interface{}{
+		"provider":    providerName,
+		"subject":     subject,
+		"new_account": created,
+	})
+	metadataStr := string(metadata)
+	h.createAuditLog(&models.AuditLog{
+		ID:              uuid.New().String(),
+		UserID:          &user.ID,
+		EventType:       "federated_identity_linked",
+		EventCategory:   "authentication",
+		Severity:        severity,
+		IPAddress:       strPtr(deviceInfo.IpAddress),
+		UserAgent:       strPtr(deviceInfo.UserAgent),
+		LocationCountry: strPtr(deviceInfo.LocationCountry),
+		LocationCity:    strPtr(deviceInfo.LocationCity),
+		Metadata:        &metadataStr,
+		Success:         true,
+		CreatedAt:       now,
+	})
+
+	return user, nil
+}
+
+// createFederatedUser creates a user for a provider account that matches no
+// user, in the given organization or the default one. They have no password
+// and sign in through the provider.
+func (h *AuthHandler) createFederatedUser(providerName, email, fullName, organizationID string, deviceInfo *pb.DeviceInfo) (*models.User, error) {
+	if fullName == "" {
+		fullName = email
+	}
+
+	now := time.Now()
+	user := &models.User{
+		ID:             uuid.New().String(),
+		Email:          email,
+		PasswordHash:   federatedPasswordHash,
+		FullName:       fullName,
+		IsActive:       true,
+		OrganizationID: organizationID,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	if err := h.repo.CreateUser(user); err != nil {
+		return nil, err
+	}
+
+	metadata, _ := json.Marshal(map[string]string{"provider": providerName})
+	metadataStr := string(metadata)
+	h.createAuditLog(&models.AuditLog{
+		ID:              uuid.New().String(),
+		UserID:          &user.ID,
+		EventType:       "user_registered",
+		EventCategory:   "authentication",
+		Severity:        "info",
+		IPAddress:       strPtr(deviceInfo.IpAddress),
+		UserAgent:       strPtr(deviceInfo.UserAgent),
+		LocationCountry: strPtr(deviceInfo.LocationCountry),
+		LocationCity:    strPtr(deviceInfo.LocationCity),
+		Metadata:        &metadataStr,
+		Success:         true,
+		CreatedAt:       now,
+	})
+
+	log.Printf("User registered through %s: %s", providerName, user.ID)
+
+	return user, nil
+}
+
+// getIdentityProvider returns a configured identity provider by name
+func (h *AuthHandler) getIdentityProvider(name string) (*oidc.Provider, error) {
+	provider, ok := h.identityProviders[name]
+	if !ok {
+		return nil, grpcerr.InvalidArgument("Unknown identity provider", grpcerr.Field("provider", "is not configured"))
+	}
+	return provider, nil
+}
+
+// hashFederatedState returns the hex-encoded SHA-256 hash of a login state
+func hashFederatedState(state string) string {
+	sum := sha256.Sum256([]byte(state))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/audit"
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/models"
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/oidc"
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/oidc/oidctest"
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/repository"
+	pb "github.com/aashiq-04/session-management-system/backend/services/auth-service/proto"
+)
+
+// auditEvent matches the event argument of an audit outbox insert by event type
+type auditEvent string
+
+func (eventType auditEvent) Match(v driver.Value) bool {
+	event, ok := v.([]byte)
+	return ok && bytes.Contains(event, []byte(`"EventType":"`+string(eventType)+`"`))
+}
+
+var userColumns = []string{
+	"id", "email", "password_hash", "full_name", "is_active", "mfa_enabled", "mfa_secret",
+	"organization_id", "password_changed_at", "created_at", "updated_at",
+	"deleted_at", "deletion_scheduled_at",
+}
+
+func userRow(id, email string) *sqlmock.Rows {
+	now := time.Now()
+	return sqlmock.NewRows(userColumns).
+		AddRow(id, email, "$2a$10$hash", "Alice", true, false, nil, "org-1", now, now, now, nil, nil)
+}
+
+// newFederatedTestHandler returns a handler signing in with a mock OIDC
+// provider named corp, backed by a mock database
+func newFederatedTestHandler(t *testing.T) (*AuthHandler, *oidc.Provider, *oidctest.Provider, sqlmock.Sqlmock) {
+	t.Helper()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+		db.Close()
+	})
+
+	idp := oidctest.NewProvider(t, "session-manager")
+	provider, err := oidc.NewProvider(oidc.Config{
+		Name:        "corp",
+		Kind:        oidc.KindOIDC,
+		Issuer:      idp.Issuer(),
+		ClientID:    idp.ClientID,
+		RedirectURL: "https://app.example.com/auth/callback",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := &AuthHandler{
+		repo:              repository.NewUserRepository(db),
+		audit:             audit.NewOutbox(db, nil),
+		identityProviders: map[string]*oidc.Provider{provider.Name(): provider},
+	}
+	return h, provider, idp, mock
+}
+
+func expectNoFederatedIdentity(mock sqlmock.Sqlmock, subject string) {
+	mock.ExpectQuery(regexp.QuoteMeta("FROM federated_identities")).
+		WithArgs("corp", subject).
+		WillReturnError(sql.ErrNoRows)
+}
+
+func expectAuditEvent(mock sqlmock.Sqlmock, eventType string) {
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO audit_outbox")).
+		WithArgs(sqlmock.AnyArg(), "auth-service", auditEvent(eventType), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+func expectLink(mock sqlmock.Sqlmock, userID interface{}, subject string) {
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO federated_identities")).
+		WithArgs(sqlmock.AnyArg(), userID, "corp", subject, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+func errorReason(err error) string {
+	for _, detail := range status.Convert(err).Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok {
+			return info.Reason
+		}
+	}
+	return ""
+}
+
+func TestResolveFederatedUser(t *testing.T) {
+	loginState := &models.FederatedLoginState{Provider: "corp", CodeVerifier: "verifier", Nonce: "nonce-1"}
+	deviceInfo := &pb.DeviceInfo{IpAddress: "203.0.113.7"}
+
+	t.Run("linked account", func(t *testing.T) {
+		h, provider, idp, mock := newFederatedTestHandler(t)
+		now := time.Now()
+		mock.ExpectQuery(regexp.QuoteMeta("FROM federated_identities")).
+			WithArgs("corp", "alice").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "provider", "subject", "email", "created_at", "last_login_at"}).
+				AddRow("link-1", "user-1", "corp", "alice", "alice@example.com", now, now))
+		mock.ExpectExec(regexp.QuoteMeta("UPDATE federated_identities SET last_login_at")).
+			WithArgs(sqlmock.AnyArg(), "link-1").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery(regexp.QuoteMeta("FROM users")).
+			WithArgs("user-1").
+			WillReturnRows(userRow("user-1", "alice@example.com"))
+
+		// The link counts even if the provider no longer vouches for the email
+		claims := idp.Claims("alice", "nonce-1")
+		claims["email_verified"] = false
+		user, err := h.resolveFederatedUser(context.Background(), provider, loginState, idp.IssueCode(idp.Sign(t, claims)), deviceInfo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.ID != "user-1" {
+			t.Errorf("signed in as %s, want user-1", user.ID)
+		}
+	})
+
+	for name, verified := range map[string]interface{}{"existing user": true, "existing user, email_verified as a string": "true"} {
+		t.Run(name, func(t *testing.T) {
+			h, provider, idp, mock := newFederatedTestHandler(t)
+			expectNoFederatedIdentity(mock, "alice")
+			mock.ExpectQuery(regexp.QuoteMeta("FROM users")).
+				WithArgs("alice@example.com").
+				WillReturnRows(userRow("user-1", "alice@example.com"))
+			expectLink(mock, "user-1", "alice")
+			expectAuditEvent(mock, "federated_identity_linked")
+
+			claims := idp.Claims("alice", "nonce-1")
+			claims["email_verified"] = verified
+			user, err := h.resolveFederatedUser(context.Background(), provider, loginState, idp.IssueCode(idp.Sign(t, claims)), deviceInfo)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if user.ID != "user-1" {
+				t.Errorf("signed in as %s, want the existing user-1", user.ID)
+			}
+		})
+	}
+
+	t.Run("new user", func(t *testing.T) {
+		h, provider, idp, mock := newFederatedTestHandler(t)
+		expectNoFederatedIdentity(mock, "bob")
+		mock.ExpectQuery(regexp.QuoteMeta("FROM users")).
+			WithArgs("bob@example.com").
+			WillReturnError(sql.ErrNoRows)
+		mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO users")).
+			WithArgs(sqlmock.AnyArg(), "bob@example.com", federatedPasswordHash, "Test User", true, sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows([]string{"organization_id"}).AddRow("org-default"))
+		expectAuditEvent(mock, "user_registered")
+		expectLink(mock, sqlmock.AnyArg(), "bob")
+		expectAuditEvent(mock, "federated_identity_linked")
+
+		user, err := h.resolveFederatedUser(context.Background(), provider, loginState, idp.IssueCode(idp.Sign(t, idp.Claims("bob", "nonce-1"))), deviceInfo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.Email != "bob@example.com" || user.OrganizationID != "org-default" || user.PasswordHash != federatedPasswordHash {
+			t.Errorf("unexpected new user %+v", user)
+		}
+	})
+
+	for name, verified := range map[string]interface{}{"email not verified": false, "email_verified false as a string": "false"} {
+		t.Run(name, func(t *testing.T) {
+			h, provider, idp, mock := newFederatedTestHandler(t)
+			expectNoFederatedIdentity(mock, "alice")
+			expectAuditEvent(mock, "login_failed")
+
+			claims := idp.Claims("alice", "nonce-1")
+			claims["email_verified"] = verified
+			_, err := h.resolveFederatedUser(context.Background(), provider, loginState, idp.IssueCode(idp.Sign(t, claims)), deviceInfo)
+			if status.Code(err) != codes.PermissionDenied || errorReason(err) != reasonEmailNotVerified {
+				t.Errorf("error = %v, want PermissionDenied with %s", err, reasonEmailNotVerified)
+			}
+		})
+	}
+
+	t.Run("token rejected", func(t *testing.T) {
+		h, provider, idp, mock := newFederatedTestHandler(t)
+		expectAuditEvent(mock, "login_failed")
+
+		_, err := h.resolveFederatedUser(context.Background(), provider, loginState, idp.IssueCode(idp.Sign(t, idp.Claims("alice", "another-nonce"))), deviceInfo)
+		if status.Code(err) != codes.Unauthenticated || errorReason(err) != reasonFederatedLoginFailed {
+			t.Errorf("error = %v, want Unauthenticated with %s", err, reasonFederatedLoginFailed)
+		}
+	})
+
+	t.Run("provider down", func(t *testing.T) {
+		h, provider, idp, _ := newFederatedTestHandler(t)
+		idp.Close()
+
+		_, err := h.resolveFederatedUser(context.Background(), provider, loginState, "code", deviceInfo)
+		if status.Code(err) != codes.Unavailable {
+			t.Errorf("error = %v, want Unavailable", err)
+		}
+	})
+}
@@ -0,0 +1,486 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/models"
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/oauthserver"
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/repository"
+)
+
+// maxTokenRequestBytes caps the body of a token request
+const maxTokenRequestBytes = 64 << 10
+
+// providerMetadata is the discovery document (OpenID Connect Discovery 1.0)
+type providerMetadata struct {
+	Issuer                                     string   `json:"issuer"`
+	AuthorizationEndpoint                      string   `json:"authorization_endpoint"`
+	TokenEndpoint                              string   `json:"token_endpoint"`
+	UserInfoEndpoint                           string   `json:"userinfo_endpoint"`
+	JWKSURI                                    string   `json:"jwks_uri"`
+	ScopesSupported                            []string `json:"scopes_supported"`
+	ResponseTypesSupported                     []string `json:"response_types_supported"`
+	GrantTypesSupported                        []string `json:"grant_types_supported"`
+	SubjectTypesSupported                      []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported           []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported          []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported              []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                            []string `json:"claims_supported"`
+	BackchannelLogoutSupported                 bool     `json:"backchannel_logout_supported"`
+	BackchannelLogoutSessionSupported          bool     `json:"backchannel_logout_session_supported"`
+	AuthorizationResponseISSParameterSupported bool     `json:"authorization_response_iss_parameter_supported"`
+}
+
+// tokenResponse is a successful token endpoint response
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	IDToken      string `json:"id_token"`
+	Scope        string `json:"scope"`
+}
+
+// oauthError is an error an endpoint returns to an app (RFC 6749 section 5.2)
+type oauthError struct {
+	status      int
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func (e *oauthError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Description)
+}
+
+// invalidGrant is returned for codes and refresh tokens that can't be used
+func invalidGrant(description string) *oauthError {
+	return &oauthError{status: http.StatusBadRequest, Code: "invalid_grant", Description: description}
+}
+
+// OAuthRoutes returns the OpenID Connect endpoints. They are served at the
+// root of the issuer URL.
+func (h *AuthHandler) OAuthRoutes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", h.handleDiscovery)
+	mux.HandleFunc("GET /jwks", h.handleJWKS)
+	mux.HandleFunc("GET /authorize", h.handleAuthorize)
+	mux.HandleFunc("POST /token", h.handleToken)
+	mux.HandleFunc("GET /userinfo", h.handleUserInfo)
+	mux.HandleFunc("POST /userinfo", h.handleUserInfo)
+	return mux
+}
+
+// handleDiscovery serves the provider's metadata
+func (h *AuthHandler) handleDiscovery(w http.ResponseWriter, r *http.Request) {
+	issuer := h.oauthServer.Tokens.Issuer()
+	writeJSON(w, http.StatusOK, &providerMetadata{
+		Issuer:                                     issuer,
+		AuthorizationEndpoint:                      issuer + "/authorize",
+		TokenEndpoint:                              issuer + "/token",
+		UserInfoEndpoint:                           issuer + "/userinfo",
+		JWKSURI:                                    issuer + "/jwks",
+		ScopesSupported:                            oauthserver.SupportedScopes,
+		ResponseTypesSupported:                     []string{"code"},
+		GrantTypesSupported:                        []string{"authorization_code", "refresh_token"},
+		SubjectTypesSupported:                      []string{"public"},
+		IDTokenSigningAlgValuesSupported:           []string{"RS256"},
+		TokenEndpointAuthMethodsSupported:          []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:              []string{"S256"},
+		ClaimsSupported:                            []string{"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "sid", "email", "name"},
+		BackchannelLogoutSupported:                 true,
+		BackchannelLogoutSessionSupported:          true,
+		AuthorizationResponseISSParameterSupported: true,
+	})
+}
+
+// handleJWKS serves the keys tokens are signed with
+func (h *AuthHandler) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	jwks, err := h.oauthServer.Tokens.JWKS()
+	if err != nil {
+		log.Printf("Failed to encode JWKS: %v", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	w.Write(jwks)
+}
+
+// handleAuthorize checks the client and redirect URI of an authorization
+// request and sends the browser on to the consent page with the request.
+// The consent page signs the user in if needed and answers the request
+// through AuthorizeOAuthClient.
+func (h *AuthHandler) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if _, err := h.getOAuthClientForRedirect(query.Get("client_id"), query.Get("redirect_uri")); err != nil {
+		// Without a trusted redirect URI, the error can only be shown here
+		http.Error(w, "Unknown client or redirect URI", http.StatusBadRequest)
+		return
+	}
+
+	consentURL, err := url.Parse(h.oauthServer.ConsentURL)
+	if err != nil {
+		log.Printf("Invalid OAuth consent URL: %v", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	consentURL.RawQuery = r.URL.RawQuery
+
+	http.Redirect(w, r, consentURL.String(), http.StatusFound)
+}
+
+// handleToken redeems authorization codes and refresh tokens
+func (h *AuthHandler) handleToken(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxTokenRequestBytes)
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, &oauthError{status: http.StatusBadRequest, Code: "invalid_request", Description: "Malformed request body"})
+		return
+	}
+
+	client, err := h.authenticateOAuthClient(r)
+	if err != nil {
+		if _, _, basic := r.BasicAuth(); basic {
+			w.Header().Set("WWW-Authenticate", `Basic realm="token"`)
+		}
+		writeOAuthError(w, err)
+		return
+	}
+
+	var response *tokenResponse
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		response, err = h.redeemAuthorizationCode(r, client)
+	case "refresh_token":
+		response, err = h.redeemOAuthRefreshToken(r, client)
+	default:
+		err = &oauthError{status: http.StatusBadRequest, Code: "unsupported_grant_type", Description: "Grant type must be authorization_code or refresh_token"}
+	}
+	if err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// authenticateOAuthClient identifies the client making a token request.
+// Confidential clients send their secret with HTTP Basic or in the form;
+// public clients send only their ID.
+func (h *AuthHandler) authenticateOAuthClient(r *http.Request) (*models.OAuthClient, error) {
+	clientID, secret, basic := r.BasicAuth()
+	if basic {
+		// Credentials are form-encoded before Basic encoding (RFC 6749 section 2.3.1)
+		id, idErr := url.QueryUnescape(clientID)
+		s, secretErr := url.QueryUnescape(secret)
+		if idErr != nil || secretErr != nil {
+			return nil, &oauthError{status: http.StatusUnauthorized, Code: "invalid_client", Description: "Malformed client credentials"}
+		}
+		clientID, secret = id, s
+	} else {
+		clientID = r.PostForm.Get("client_id")
+		secret = r.PostForm.Get("client_secret")
+	}
+
+	unauthenticated := &oauthError{status: http.StatusUnauthorized, Code: "invalid_client", Description: "Client authentication failed"}
+	if clientID == "" {
+		return nil, unauthenticated
+	}
+
+	client, err := h.repo.GetOAuthClient(clientID)
+	if errors.Is(err, repository.ErrOAuthClientNotFound) {
+		return nil, unauthenticated
+	}
+	if err != nil {
+		log.Printf("Failed to get oauth client: %v", err)
+		return nil, err
+	}
+
+	if client.SecretHash == nil {
+		if secret != "" {
+			return nil, unauthenticated
+		}
+		return client, nil
+	}
+	if secret == "" || !oauthserver.SecretMatches(secret, *client.SecretHash) {
+		return nil, unauthenticated
+	}
+
+	return client, nil
+}
+
+// redeemAuthorizationCode exchanges an authorization code for tokens. Each
+// code is redeemed once, by the client it was issued to.
+func (h *AuthHandler) redeemAuthorizationCode(r *http.Request, client *models.OAuthClient) (*tokenResponse, error) {
+	code, err := h.repo.ClaimAuthorizationCode(oauthserver.HashSecret(r.PostForm.Get("code")), uuid.New().String())
+	if errors.Is(err, repository.ErrAuthorizationCodeRedeemed) {
+		// The code leaked, so the tokens it was exchanged for may be in the wrong hands
+		h.revokeOAuthTokenFamily(code.UserID, code.SessionID, code.ClientID, stringValue(code.FamilyID), "authorization_code_replayed")
+		return nil, invalidGrant("The authorization code is invalid or expired")
+	}
+	if errors.Is(err, repository.ErrAuthorizationCodeNotFound) {
+		return nil, invalidGrant("The authorization code is invalid or expired")
+	}
+	if err != nil {
+		log.Printf("Failed to claim authorization code: %v", err)
+		return nil, err
+	}
+
+	if code.ClientID != client.ID || code.RedirectURI != r.PostForm.Get("redirect_uri") {
+		return nil, invalidGrant("The authorization code was issued to another client or redirect URI")
+	}
+	if code.CodeChallenge != nil && !oauthserver.VerifyCodeChallenge(r.PostForm.Get("code_verifier"), *code.CodeChallenge) {
+		return nil, invalidGrant("The code verifier doesn't match the code challenge")
+	}
+
+	response, err := h.issueOAuthTokens(client, code.UserID, code.SessionID, stringValue(code.FamilyID), code.Scopes, stringValue(code.Nonce))
+	if err != nil {
+		return nil, err
+	}
+
+	// The client is told when the session ends
+	if err := h.repo.AddOAuthClientSession(code.SessionID, client.ID); err != nil {
+		log.Printf("Failed to record oauth client session: %v", err)
+		return nil, err
+	}
+
+	return response, nil
+}
+
+// redeemOAuthRefreshToken exchanges a refresh token for new tokens. The
+// refresh token is replaced; a narrower scope may be asked for. Presenting
+// a replaced token again revokes every token descended from the same code.
+func (h *AuthHandler) redeemOAuthRefreshToken(r *http.Request, client *models.OAuthClient) (*tokenResponse, error) {
+	token, err := h.repo.ClaimOAuthRefreshToken(oauthserver.HashSecret(r.PostForm.Get("refresh_token")))
+	if errors.Is(err, repository.ErrOAuthRefreshTokenReused) {
+		// Either the app or whoever copied the token is using a stale one;
+		// there is no telling which, so neither keeps access
+		h.revokeOAuthTokenFamily(token.UserID, token.SessionID, token.ClientID, token.FamilyID, "refresh_token_reused")
+		return nil, invalidGrant("The refresh token is invalid or expired")
+	}
+	if errors.Is(err, repository.ErrOAuthRefreshTokenNotFound) {
+		return nil, invalidGrant("The refresh token is invalid or expired")
+	}
+	if err != nil {
+		log.Printf("Failed to claim oauth refresh token: %v", err)
+		return nil, err
+	}
+	if token.ClientID != client.ID {
+		return nil, invalidGrant("The refresh token was issued to another client")
+	}
+
+	scopes := token.Scopes
+	if scope := r.PostForm.Get("scope"); scope != "" {
+		scopes = oauthserver.ParseScopes(scope)
+		if !oauthserver.HasScope(scopes, oauthserver.ScopeOpenID) || !oauthserver.CoversScopes(token.Scopes, scopes) {
+			return nil, &oauthError{status: http.StatusBadRequest, Code: "invalid_scope", Description: "The scope must be within the original grant"}
+		}
+	}
+
+	return h.issueOAuthTokens(client, token.UserID, token.SessionID, token.FamilyID, scopes, "")
+}
+
+// revokeOAuthTokenFamily revokes the refresh tokens descended from one
+// authorization code after one of them, or the code, was presented twice
+func (h *AuthHandler) revokeOAuthTokenFamily(userID, sessionID, clientID, familyID, reason string) {
+	log.Printf("Revoking oauth token family %s of client %s: %s", familyID, clientID, reason)
+
+	if familyID != "" {
+		if err := h.repo.RevokeOAuthTokenFamily(familyID); err != nil {
+			log.Printf("Failed to revoke oauth token family: %v", err)
+		}
+	}
+
+	metadata, _ := json.Marshal(map[string]interface{}{
+		"client_id": clientID,
+		"family_id": familyID,
+	})
+	metadataStr := string(metadata)
+
+	h.createAuditLog(&models.AuditLog{
+		ID:            uuid.New().String(),
+		UserID:        &userID,
+		SessionID:     &sessionID,
+		EventType:     "oauth_tokens_revoked",
+		EventCategory: "security",
+		Severity:      "critical",
+		Metadata:      &metadataStr,
+		Success:       false,
+		FailureReason: &reason,
+		CreatedAt:     time.Now(),
+	})
+}
+
+// issueOAuthTokens signs an access token, an ID token and a refresh token in
+// the token family familyID for a user's session, which must still be live
+func (h *AuthHandler) issueOAuthTokens(client *models.OAuthClient, userID, sessionID, familyID string, scopes []string, nonce string) (*tokenResponse, error) {
+	session, user, err := h.getOAuthSessionUser(userID, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	scope := strings.Join(scopes, " ")
+	accessClaims := &oauthserver.AccessTokenClaims{
+		ClientID:  client.ID,
+		Scope:     scope,
+		SessionID: session.ID,
+	}
+	accessClaims.Subject = user.ID
+	accessToken, err := h.oauthServer.Tokens.SignAccessToken(accessClaims)
+	if err != nil {
+		return nil, err
+	}
+
+	authTime := session.CreatedAt
+	if session.AuthTime != nil {
+		authTime = *session.AuthTime
+	}
+	idClaims := &oauthserver.IDTokenClaims{
+		Nonce:     nonce,
+		AuthTime:  authTime.Unix(),
+		SessionID: session.ID,
+	}
+	idClaims.Subject = user.ID
+	if oauthserver.HasScope(scopes, oauthserver.ScopeEmail) {
+		idClaims.Email = user.Email
+	}
+	if oauthserver.HasScope(scopes, oauthserver.ScopeProfile) {
+		idClaims.Name = user.FullName
+	}
+	idToken, err := h.oauthServer.Tokens.SignIDToken(client.ID, idClaims)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := oauthserver.NewSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := h.repo.CreateOAuthRefreshToken(&models.OAuthRefreshToken{
+		TokenHash: oauthserver.HashSecret(refreshToken),
+		ClientID:  client.ID,
+		UserID:    user.ID,
+		SessionID: session.ID,
+		FamilyID:  familyID,
+		Scopes:    scopes,
+		ExpiresAt: session.ExpiresAt,
+		CreatedAt: time.Now(),
+	}); err != nil {
+		log.Printf("Failed to create oauth refresh token: %v", err)
+		return nil, err
+	}
+
+	return &tokenResponse{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(oauthserver.AccessTokenTTL.Seconds()),
+		RefreshToken: refreshToken,
+		IDToken:      idToken,
+		Scope:        scope,
+	}, nil
+}
+
+// handleUserInfo returns the claims of the user an access token was issued
+// for, as long as the session it belongs to is live
+func (h *AuthHandler) handleUserInfo(w http.ResponseWriter, r *http.Request) {
+	unauthorized := func(description string) {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="invalid_token", error_description=%q`, description))
+		writeOAuthError(w, &oauthError{status: http.StatusUnauthorized, Code: "invalid_token", Description: description})
+	}
+
+	rawToken, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || rawToken == "" {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="userinfo"`)
+		writeOAuthError(w, &oauthError{status: http.StatusUnauthorized, Code: "invalid_request", Description: "A bearer token is required"})
+		return
+	}
+
+	claims, err := h.oauthServer.Tokens.VerifyAccessToken(rawToken)
+	if err != nil {
+		unauthorized("The access token is invalid or expired")
+		return
+	}
+
+	_, user, err := h.getOAuthSessionUser(claims.Subject, claims.SessionID)
+	if err != nil {
+		var oauthErr *oauthError
+		if errors.As(err, &oauthErr) {
+			unauthorized("The session has ended")
+			return
+		}
+		writeOAuthError(w, err)
+		return
+	}
+
+	scopes := oauthserver.ParseScopes(claims.Scope)
+	info := map[string]interface{}{"sub": user.ID}
+	if oauthserver.HasScope(scopes, oauthserver.ScopeEmail) {
+		info["email"] = user.Email
+	}
+	if oauthserver.HasScope(scopes, oauthserver.ScopeProfile) {
+		info["name"] = user.FullName
+	}
+
+	writeJSON(w, http.StatusOK, info)
+}
+
+// getOAuthSessionUser loads a session apps hold tokens for and its user.
+// Once either has ended, an invalid_grant error is returned.
+func (h *AuthHandler) getOAuthSessionUser(userID, sessionID string) (*models.Session, *models.User, error) {
+	ended := invalidGrant("The session has ended")
+
+	session, err := h.repo.GetSession(sessionID)
+	if errors.Is(err, repository.ErrSessionNotFound) {
+		return nil, nil, ended
+	}
+	if err != nil {
+		log.Printf("Failed to get session: %v", err)
+		return nil, nil, err
+	}
+	if session.UserID != userID || !session.IsActive || time.Now().After(session.ExpiresAt) {
+		return nil, nil, ended
+	}
+
+	user, err := h.repo.GetUserByID(userID)
+	if errors.Is(err, repository.ErrUserNotFound) {
+		return nil, nil, ended
+	}
+	if err != nil {
+		log.Printf("Failed to get user: %v", err)
+		return nil, nil, err
+	}
+	if !user.IsActive || user.DeletedAt != nil {
+		return nil, nil, ended
+	}
+
+	return session, user, nil
+}
+
+// writeOAuthError writes an error response. Errors other than oauthError
+// are internal and not shown to the app.
+func writeOAuthError(w http.ResponseWriter, err error) {
+	var oauthErr *oauthError
+	if !errors.As(err, &oauthErr) {
+		oauthErr = &oauthError{status: http.StatusInternalServerError, Code: "server_error"}
+	}
+	writeJSON(w, oauthErr.status, oauthErr)
+}
+
+// writeJSON writes a JSON response that must not be cached
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Printf("Failed to write response: %v", err)
+	}
+}
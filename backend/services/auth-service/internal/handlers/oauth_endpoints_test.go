@@ -0,0 +1,745 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"database/sql/driver"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/lib/pq"
+
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/audit"
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/oauthserver"
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/repository"
+)
+
+const (
+	testOAuthIssuer  = "https://auth.example.com"
+	testConsentURL   = "https://app.example.com/oauth/consent"
+	testClientSecret = "s3cret+/="
+
+	// The example verifier and challenge from RFC 7636, appendix B
+	testCodeVerifier  = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	testCodeChallenge = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+)
+
+var (
+	testOAuthKeyOnce sync.Once
+	testOAuthKey     *rsa.PrivateKey
+)
+
+// oauthTestClient is a registered app. A public client has no secret.
+type oauthTestClient struct {
+	id          string
+	secret      string
+	redirectURI string
+}
+
+var (
+	confidentialClient = oauthTestClient{"client-1", testClientSecret, "https://app.example.com/callback"}
+	publicClient       = oauthTestClient{"client-2", "", "https://spa.example.com/callback"}
+)
+
+var oauthClientColumns = []string{
+	"id", "organization_id", "name", "secret_hash", "redirect_uris", "backchannel_logout_uri",
+	"scopes", "created_by", "created_at", "updated_at",
+}
+
+func expectOAuthClient(mock sqlmock.Sqlmock, client oauthTestClient) {
+	var secretHash driver.Value
+	if client.secret != "" {
+		secretHash = oauthserver.HashSecret(client.secret)
+	}
+	now := time.Now()
+	mock.ExpectQuery(regexp.QuoteMeta("FROM oauth_clients WHERE id = $1")).
+		WithArgs(client.id).
+		WillReturnRows(sqlmock.NewRows(oauthClientColumns).
+			AddRow(client.id, "org-1", "Example app", secretHash, "{"+client.redirectURI+"}", nil,
+				"{openid,email,profile}", "admin-1", now, now))
+}
+
+func expectNoOAuthClient(mock sqlmock.Sqlmock, clientID string) {
+	mock.ExpectQuery(regexp.QuoteMeta("FROM oauth_clients WHERE id = $1")).
+		WithArgs(clientID).
+		WillReturnRows(sqlmock.NewRows(oauthClientColumns))
+}
+
+var authorizationCodeColumns = []string{
+	"code_hash", "client_id", "user_id", "session_id", "redirect_uri", "scopes", "nonce",
+	"code_challenge", "expires_at", "created_at", "redeemed_at", "family_id",
+}
+
+// authorizationCode is a stored authorization code. codeChallenge is nil
+// when the app sent none.
+type authorizationCode struct {
+	clientID      string
+	redirectURI   string
+	codeChallenge driver.Value
+}
+
+func (c authorizationCode) rows(redeemedAt driver.Value) *sqlmock.Rows {
+	now := time.Now()
+	return sqlmock.NewRows(authorizationCodeColumns).
+		AddRow(oauthserver.HashSecret("code-1"), c.clientID, "user-1", "session-1", c.redirectURI,
+			"{openid,email}", "nonce-1", c.codeChallenge, now.Add(time.Minute), now, redeemedAt, "family-1")
+}
+
+// expectClaimAuthorizationCode expects code-1 to be redeemed for the first time
+func expectClaimAuthorizationCode(mock sqlmock.Sqlmock, code authorizationCode) {
+	mock.ExpectQuery(regexp.QuoteMeta("UPDATE oauth_authorization_codes")).
+		WithArgs(oauthserver.HashSecret("code-1"), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(code.rows(time.Now()))
+}
+
+var oauthRefreshTokenColumns = []string{
+	"token_hash", "client_id", "user_id", "session_id", "family_id", "scopes", "expires_at", "created_at", "used_at",
+}
+
+func refreshTokenRows(clientID string, usedAt driver.Value) *sqlmock.Rows {
+	now := time.Now()
+	return sqlmock.NewRows(oauthRefreshTokenColumns).
+		AddRow(oauthserver.HashSecret("refresh-1"), clientID, "user-1", "session-1", "family-1",
+			"{openid,email}", now.Add(time.Hour), now, usedAt)
+}
+
+var sessionColumns = []string{
+	"id", "user_id", "device_id", "refresh_token", "ip_address", "user_agent",
+	"location_country", "location_city", "latitude", "longitude",
+	"is_active", "expires_at", "created_at", "revoked_at", "impersonator_id", "auth_time", "amr",
+}
+
+// expectOAuthSession expects session-1 of user-1 to be loaded, and user-1 with
+// it while the session is active
+func expectOAuthSession(mock sqlmock.Sqlmock, active bool) {
+	now := time.Now()
+	mock.ExpectQuery(regexp.QuoteMeta("FROM sessions")).
+		WithArgs("session-1").
+		WillReturnRows(sqlmock.NewRows(sessionColumns).
+			AddRow("session-1", "user-1", "device-1", "refresh", "203.0.113.7", nil, nil, nil, nil, nil,
+				active, now.Add(time.Hour), now.Add(-time.Hour), nil, nil, now.Add(-time.Hour), "{pwd}"))
+	if active {
+		mock.ExpectQuery(regexp.QuoteMeta("FROM users")).
+			WithArgs("user-1").
+			WillReturnRows(userRow("user-1", "alice@example.com"))
+	}
+}
+
+// newHash matches the hash of a refresh token other than refresh-1
+type newHash struct{}
+
+func (newHash) Match(v driver.Value) bool {
+	hash, ok := v.(string)
+	return ok && len(hash) == 64 && hash != oauthserver.HashSecret("refresh-1")
+}
+
+// expectTokensIssued expects a refresh token in family-1 to be stored for the
+// session
+func expectTokensIssued(mock sqlmock.Sqlmock, clientID string, scopes ...string) {
+	expectOAuthSession(mock, true)
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO oauth_refresh_tokens")).
+		WithArgs(newHash{}, clientID, "user-1", "session-1", "family-1", pq.Array(scopes), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+func expectFamilyRevoked(mock sqlmock.Sqlmock) {
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM oauth_refresh_tokens WHERE family_id = $1")).
+		WithArgs("family-1").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	expectAuditEvent(mock, "oauth_tokens_revoked")
+}
+
+// newOAuthTestHandler returns a handler serving the OAuth server endpoints
+// with a mock database, which fails the test on any statement not expected
+// of it
+func newOAuthTestHandler(t *testing.T) (*AuthHandler, sqlmock.Sqlmock) {
+	t.Helper()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+		db.Close()
+	})
+
+	testOAuthKeyOnce.Do(func() {
+		testOAuthKey, _ = rsa.GenerateKey(rand.Reader, 2048)
+	})
+	keyFile := filepath.Join(t.TempDir(), "oauth-signing-key.pem")
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(testOAuthKey)})
+	if err := os.WriteFile(keyFile, keyPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	key, err := oauthserver.LoadSigningKey(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := &AuthHandler{
+		repo:  repository.NewUserRepository(db),
+		audit: audit.NewOutbox(db, nil),
+		oauthServer: &OAuthServerConfig{
+			Tokens:     oauthserver.NewTokens(testOAuthIssuer, key),
+			ConsentURL: testConsentURL,
+		},
+	}
+	return h, mock
+}
+
+// postToken posts a token request, authenticating the client in the form
+func postToken(t *testing.T, h *AuthHandler, client oauthTestClient, form url.Values) *httptest.ResponseRecorder {
+	t.Helper()
+
+	form.Set("client_id", client.id)
+	if client.secret != "" {
+		form.Set("client_secret", client.secret)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/token", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	h.OAuthRoutes().ServeHTTP(rec, req)
+	return rec
+}
+
+// checkOAuthError checks that a response is the given OAuth error
+func checkOAuthError(t *testing.T, rec *httptest.ResponseRecorder, status int, code string) {
+	t.Helper()
+
+	var body struct {
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("invalid error response %q: %v", rec.Body, err)
+	}
+	if rec.Code != status || body.Error != code {
+		t.Errorf("got %d %s, want %d %s", rec.Code, body.Error, status, code)
+	}
+}
+
+// checkTokenResponse checks the tokens issued to a client for user-1's
+// session-1 and returns them
+func checkTokenResponse(t *testing.T, h *AuthHandler, rec *httptest.ResponseRecorder, clientID, scope, nonce string) *tokenResponse {
+	t.Helper()
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+	if cache := rec.Header().Get("Cache-Control"); cache != "no-store" {
+		t.Errorf("Cache-Control = %q, want no-store", cache)
+	}
+	var resp tokenResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.TokenType != "Bearer" || resp.Scope != scope || resp.RefreshToken == "" {
+		t.Errorf("unexpected response %+v", resp)
+	}
+
+	access, err := h.oauthServer.Tokens.VerifyAccessToken(resp.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if access.Subject != "user-1" || access.SessionID != "session-1" || access.ClientID != clientID || access.Scope != scope {
+		t.Errorf("unexpected access token %+v", access)
+	}
+
+	id := &oauthserver.IDTokenClaims{}
+	if _, err := jwt.ParseWithClaims(resp.IDToken, id, func(*jwt.Token) (interface{}, error) {
+		return &testOAuthKey.PublicKey, nil
+	}, jwt.WithIssuer(testOAuthIssuer), jwt.WithAudience(clientID)); err != nil {
+		t.Fatal(err)
+	}
+	if id.Subject != "user-1" || id.SessionID != "session-1" || id.Nonce != nonce {
+		t.Errorf("unexpected ID token %+v", id)
+	}
+	// The email claim comes with the email scope only
+	if wantEmail := strings.Contains(scope, "email"); (id.Email == "alice@example.com") != wantEmail {
+		t.Errorf("ID token email = %q with scope %q", id.Email, scope)
+	}
+
+	return &resp
+}
+
+func TestTokenRedeemsAuthorizationCode(t *testing.T) {
+	tests := []struct {
+		name   string
+		client oauthTestClient
+		code   authorizationCode
+		form   url.Values
+		ok     bool
+	}{
+		{
+			name:   "S256 verifier",
+			client: publicClient,
+			code:   authorizationCode{publicClient.id, publicClient.redirectURI, testCodeChallenge},
+			form:   url.Values{"redirect_uri": {publicClient.redirectURI}, "code_verifier": {testCodeVerifier}},
+			ok:     true,
+		},
+		{
+			name:   "confidential client without PKCE",
+			client: confidentialClient,
+			code:   authorizationCode{confidentialClient.id, confidentialClient.redirectURI, nil},
+			form:   url.Values{"redirect_uri": {confidentialClient.redirectURI}},
+			ok:     true,
+		},
+		{
+			name:   "missing verifier",
+			client: publicClient,
+			code:   authorizationCode{publicClient.id, publicClient.redirectURI, testCodeChallenge},
+			form:   url.Values{"redirect_uri": {publicClient.redirectURI}},
+		},
+		{
+			// With the plain method, the verifier is the challenge itself
+			name:   "plain verifier",
+			client: publicClient,
+			code:   authorizationCode{publicClient.id, publicClient.redirectURI, testCodeChallenge},
+			form:   url.Values{"redirect_uri": {publicClient.redirectURI}, "code_verifier": {testCodeChallenge}},
+		},
+		{
+			name:   "wrong verifier",
+			client: publicClient,
+			code:   authorizationCode{publicClient.id, publicClient.redirectURI, testCodeChallenge},
+			form:   url.Values{"redirect_uri": {publicClient.redirectURI}, "code_verifier": {strings.Repeat("a", 43)}},
+		},
+		{
+			name:   "redirect URI with a trailing slash",
+			client: publicClient,
+			code:   authorizationCode{publicClient.id, publicClient.redirectURI, testCodeChallenge},
+			form:   url.Values{"redirect_uri": {publicClient.redirectURI + "/"}, "code_verifier": {testCodeVerifier}},
+		},
+		{
+			name:   "missing redirect URI",
+			client: publicClient,
+			code:   authorizationCode{publicClient.id, publicClient.redirectURI, testCodeChallenge},
+			form:   url.Values{"code_verifier": {testCodeVerifier}},
+		},
+		{
+			name:   "another client's code",
+			client: confidentialClient,
+			code:   authorizationCode{publicClient.id, confidentialClient.redirectURI, nil},
+			form:   url.Values{"redirect_uri": {confidentialClient.redirectURI}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, mock := newOAuthTestHandler(t)
+			expectOAuthClient(mock, tt.client)
+			expectClaimAuthorizationCode(mock, tt.code)
+			if tt.ok {
+				expectTokensIssued(mock, tt.client.id, "openid", "email")
+				mock.ExpectExec(regexp.QuoteMeta("INSERT INTO oauth_client_sessions")).
+					WithArgs("session-1", tt.client.id, sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			}
+
+			tt.form.Set("grant_type", "authorization_code")
+			tt.form.Set("code", "code-1")
+			rec := postToken(t, h, tt.client, tt.form)
+
+			if tt.ok {
+				checkTokenResponse(t, h, rec, tt.client.id, "openid email", "nonce-1")
+			} else {
+				checkOAuthError(t, rec, http.StatusBadRequest, "invalid_grant")
+			}
+		})
+	}
+}
+
+// A code presented again is refused, and the tokens it was exchanged for
+// the first time are revoked
+func TestTokenRejectsReplayedAuthorizationCode(t *testing.T) {
+	h, mock := newOAuthTestHandler(t)
+	code := authorizationCode{publicClient.id, publicClient.redirectURI, testCodeChallenge}
+
+	expectOAuthClient(mock, publicClient)
+	mock.ExpectQuery(regexp.QuoteMeta("UPDATE oauth_authorization_codes")).
+		WithArgs(oauthserver.HashSecret("code-1"), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows(authorizationCodeColumns))
+	mock.ExpectQuery(regexp.QuoteMeta("AND redeemed_at IS NOT NULL")).
+		WithArgs(oauthserver.HashSecret("code-1")).
+		WillReturnRows(code.rows(time.Now().Add(-time.Second)))
+	expectFamilyRevoked(mock)
+
+	rec := postToken(t, h, publicClient, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {"code-1"},
+		"redirect_uri":  {publicClient.redirectURI},
+		"code_verifier": {testCodeVerifier},
+	})
+
+	checkOAuthError(t, rec, http.StatusBadRequest, "invalid_grant")
+}
+
+func TestTokenRejectsUnknownAuthorizationCode(t *testing.T) {
+	h, mock := newOAuthTestHandler(t)
+
+	expectOAuthClient(mock, publicClient)
+	mock.ExpectQuery(regexp.QuoteMeta("UPDATE oauth_authorization_codes")).
+		WillReturnRows(sqlmock.NewRows(authorizationCodeColumns))
+	mock.ExpectQuery(regexp.QuoteMeta("AND redeemed_at IS NOT NULL")).
+		WillReturnRows(sqlmock.NewRows(authorizationCodeColumns))
+
+	rec := postToken(t, h, publicClient, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {"code-1"},
+		"redirect_uri":  {publicClient.redirectURI},
+		"code_verifier": {testCodeVerifier},
+	})
+
+	checkOAuthError(t, rec, http.StatusBadRequest, "invalid_grant")
+}
+
+// A refresh token is replaced by one in the same family, and can narrow the
+// scope but not widen it
+func TestTokenRotatesRefreshToken(t *testing.T) {
+	tests := []struct {
+		name      string
+		issuedTo  string
+		scope     string
+		wantScope string // empty when refused
+		wantError string
+	}{
+		{name: "same scope", issuedTo: publicClient.id, wantScope: "openid email"},
+		{name: "narrower scope", issuedTo: publicClient.id, scope: "openid", wantScope: "openid"},
+		{name: "wider scope", issuedTo: publicClient.id, scope: "openid email profile", wantError: "invalid_scope"},
+		{name: "without openid", issuedTo: publicClient.id, scope: "email", wantError: "invalid_scope"},
+		{name: "another client's token", issuedTo: confidentialClient.id, wantError: "invalid_grant"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, mock := newOAuthTestHandler(t)
+			expectOAuthClient(mock, publicClient)
+			mock.ExpectQuery(regexp.QuoteMeta("UPDATE oauth_refresh_tokens")).
+				WithArgs(oauthserver.HashSecret("refresh-1"), sqlmock.AnyArg()).
+				WillReturnRows(refreshTokenRows(tt.issuedTo, time.Now()))
+			if tt.wantError == "" {
+				expectTokensIssued(mock, publicClient.id, strings.Fields(tt.wantScope)...)
+			}
+
+			form := url.Values{"grant_type": {"refresh_token"}, "refresh_token": {"refresh-1"}}
+			if tt.scope != "" {
+				form.Set("scope", tt.scope)
+			}
+			rec := postToken(t, h, publicClient, form)
+
+			if tt.wantError != "" {
+				checkOAuthError(t, rec, http.StatusBadRequest, tt.wantError)
+				return
+			}
+			resp := checkTokenResponse(t, h, rec, publicClient.id, tt.wantScope, "")
+			if resp.RefreshToken == "refresh-1" {
+				t.Error("the refresh token wasn't replaced")
+			}
+		})
+	}
+}
+
+// A replaced refresh token presented again revokes its whole family, as
+// either the app or whoever copied the token holds a stale one
+func TestTokenRejectsReusedRefreshToken(t *testing.T) {
+	h, mock := newOAuthTestHandler(t)
+
+	expectOAuthClient(mock, publicClient)
+	mock.ExpectQuery(regexp.QuoteMeta("UPDATE oauth_refresh_tokens")).
+		WithArgs(oauthserver.HashSecret("refresh-1"), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows(oauthRefreshTokenColumns))
+	mock.ExpectQuery(regexp.QuoteMeta("AND used_at IS NOT NULL")).
+		WithArgs(oauthserver.HashSecret("refresh-1")).
+		WillReturnRows(refreshTokenRows(publicClient.id, time.Now().Add(-time.Minute)))
+	expectFamilyRevoked(mock)
+
+	rec := postToken(t, h, publicClient, url.Values{"grant_type": {"refresh_token"}, "refresh_token": {"refresh-1"}})
+
+	checkOAuthError(t, rec, http.StatusBadRequest, "invalid_grant")
+}
+
+func TestTokenAuthenticatesClient(t *testing.T) {
+	basic := func(id, secret string) func(*http.Request) {
+		return func(req *http.Request) { req.SetBasicAuth(id, secret) }
+	}
+
+	tests := []struct {
+		name   string
+		client *oauthTestClient // the client looked up, nil for none
+		found  bool
+		auth   func(*http.Request)
+		form   url.Values
+		ok     bool
+	}{
+		{
+			name:   "secret in Basic",
+			client: &confidentialClient, found: true,
+			auth: basic(url.QueryEscape(confidentialClient.id), url.QueryEscape(testClientSecret)),
+			ok:   true,
+		},
+		{
+			name:   "secret in form",
+			client: &confidentialClient, found: true,
+			form: url.Values{"client_id": {confidentialClient.id}, "client_secret": {testClientSecret}},
+			ok:   true,
+		},
+		{
+			name:   "public client",
+			client: &publicClient, found: true,
+			form: url.Values{"client_id": {publicClient.id}},
+			ok:   true,
+		},
+		{
+			// Basic credentials are form-encoded first, so + is a space
+			name:   "unescaped secret in Basic",
+			client: &confidentialClient, found: true,
+			auth: basic(confidentialClient.id, testClientSecret),
+		},
+		{
+			name:   "wrong secret in Basic",
+			client: &confidentialClient, found: true,
+			auth: basic(confidentialClient.id, "wrong"),
+		},
+		{
+			name:   "wrong secret in form",
+			client: &confidentialClient, found: true,
+			form: url.Values{"client_id": {confidentialClient.id}, "client_secret": {"wrong"}},
+		},
+		{
+			name:   "confidential client without its secret",
+			client: &confidentialClient, found: true,
+			form: url.Values{"client_id": {confidentialClient.id}},
+		},
+		{
+			name:   "public client with a secret",
+			client: &publicClient, found: true,
+			form: url.Values{"client_id": {publicClient.id}, "client_secret": {"anything"}},
+		},
+		{
+			name:   "unknown client",
+			client: &oauthTestClient{id: "client-9"},
+			form:   url.Values{"client_id": {"client-9"}},
+		},
+		{
+			name: "no client",
+			form: url.Values{},
+		},
+		{
+			name: "malformed Basic credentials",
+			auth: basic("client-%zz", "secret"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, mock := newOAuthTestHandler(t)
+			if tt.client != nil {
+				if tt.found {
+					expectOAuthClient(mock, *tt.client)
+				} else {
+					expectNoOAuthClient(mock, tt.client.id)
+				}
+			}
+
+			// An authenticated client gets as far as the grant type
+			form := tt.form
+			if form == nil {
+				form = url.Values{}
+			}
+			form.Set("grant_type", "password")
+			req := httptest.NewRequest(http.MethodPost, "/token", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			if tt.auth != nil {
+				tt.auth(req)
+			}
+			rec := httptest.NewRecorder()
+			h.OAuthRoutes().ServeHTTP(rec, req)
+
+			if tt.ok {
+				checkOAuthError(t, rec, http.StatusBadRequest, "unsupported_grant_type")
+				return
+			}
+			checkOAuthError(t, rec, http.StatusUnauthorized, "invalid_client")
+			challenge := rec.Header().Get("WWW-Authenticate")
+			if tt.auth != nil && challenge == "" {
+				t.Error("no WWW-Authenticate challenge for Basic credentials")
+			}
+			if tt.auth == nil && challenge != "" {
+				t.Errorf("WWW-Authenticate = %q for credentials in the form", challenge)
+			}
+		})
+	}
+}
+
+func TestUserInfoFiltersClaimsByScope(t *testing.T) {
+	tests := []struct {
+		scope string
+		want  map[string]interface{}
+	}{
+		{"openid", map[string]interface{}{"sub": "user-1"}},
+		{"openid email", map[string]interface{}{"sub": "user-1", "email": "alice@example.com"}},
+		{"openid profile", map[string]interface{}{"sub": "user-1", "name": "Alice"}},
+		{"openid email profile", map[string]interface{}{"sub": "user-1", "email": "alice@example.com", "name": "Alice"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.scope, func(t *testing.T) {
+			h, mock := newOAuthTestHandler(t)
+			expectOAuthSession(mock, true)
+
+			accessClaims := &oauthserver.AccessTokenClaims{ClientID: publicClient.id, Scope: tt.scope, SessionID: "session-1"}
+			accessClaims.Subject = "user-1"
+			accessToken, err := h.oauthServer.Tokens.SignAccessToken(accessClaims)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/userinfo", nil)
+			req.Header.Set("Authorization", "Bearer "+accessToken)
+			rec := httptest.NewRecorder()
+			h.OAuthRoutes().ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+			}
+			var got map[string]interface{}
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("claims = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUserInfoRejects(t *testing.T) {
+	tests := []struct {
+		name          string
+		authorization func(h *AuthHandler) string
+		sessionActive *bool // nil when the session isn't looked up
+		code          string
+	}{
+		{
+			name:          "no token",
+			authorization: func(*AuthHandler) string { return "" },
+			code:          "invalid_request",
+		},
+		{
+			name:          "Basic credentials",
+			authorization: func(*AuthHandler) string { return "Basic Y2xpZW50OnNlY3JldA==" },
+			code:          "invalid_request",
+		},
+		{
+			name: "ID token",
+			authorization: func(h *AuthHandler) string {
+				idClaims := &oauthserver.IDTokenClaims{SessionID: "session-1"}
+				idClaims.Subject = "user-1"
+				idToken, _ := h.oauthServer.Tokens.SignIDToken(publicClient.id, idClaims)
+				return "Bearer " + idToken
+			},
+			code: "invalid_token",
+		},
+		{
+			name: "ended session",
+			authorization: func(h *AuthHandler) string {
+				accessClaims := &oauthserver.AccessTokenClaims{ClientID: publicClient.id, Scope: "openid email", SessionID: "session-1"}
+				accessClaims.Subject = "user-1"
+				accessToken, _ := h.oauthServer.Tokens.SignAccessToken(accessClaims)
+				return "Bearer " + accessToken
+			},
+			sessionActive: new(bool),
+			code:          "invalid_token",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, mock := newOAuthTestHandler(t)
+			if tt.sessionActive != nil {
+				expectOAuthSession(mock, *tt.sessionActive)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/userinfo", nil)
+			if authorization := tt.authorization(h); authorization != "" {
+				req.Header.Set("Authorization", authorization)
+			}
+			rec := httptest.NewRecorder()
+			h.OAuthRoutes().ServeHTTP(rec, req)
+
+			checkOAuthError(t, rec, http.StatusUnauthorized, tt.code)
+			if rec.Header().Get("WWW-Authenticate") == "" {
+				t.Error("no WWW-Authenticate challenge")
+			}
+		})
+	}
+}
+
+// /authorize sends the browser on only for a redirect URI registered exactly
+func TestAuthorizeMatchesRedirectURIExactly(t *testing.T) {
+	tests := []struct {
+		name        string
+		redirectURI string
+		ok          bool
+	}{
+		{"exact", confidentialClient.redirectURI, true},
+		{"trailing slash", confidentialClient.redirectURI + "/", false},
+		{"extra query", confidentialClient.redirectURI + "?next=/admin", false},
+		{"longer path", confidentialClient.redirectURI + "/evil", false},
+		{"other case", strings.ToUpper(confidentialClient.redirectURI), false},
+		{"http", strings.Replace(confidentialClient.redirectURI, "https:", "http:", 1), false},
+		{"missing", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, mock := newOAuthTestHandler(t)
+			expectOAuthClient(mock, confidentialClient)
+
+			query := url.Values{
+				"client_id":     {confidentialClient.id},
+				"redirect_uri":  {tt.redirectURI},
+				"response_type": {"code"},
+				"scope":         {"openid"},
+				"state":         {"state-1"},
+			}.Encode()
+			rec := httptest.NewRecorder()
+			h.OAuthRoutes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/authorize?"+query, nil))
+
+			if !tt.ok {
+				if rec.Code != http.StatusBadRequest || rec.Header().Get("Location") != "" {
+					t.Errorf("status = %d, Location %q, want 400 without a redirect", rec.Code, rec.Header().Get("Location"))
+				}
+				return
+			}
+			if rec.Code != http.StatusFound {
+				t.Fatalf("status = %d, want 302", rec.Code)
+			}
+			if location := rec.Header().Get("Location"); location != testConsentURL+"?"+query {
+				t.Errorf("Location = %q, want the consent page with the request", location)
+			}
+		})
+	}
+}
+
+func TestAuthorizeRejectsUnknownClient(t *testing.T) {
+	h, mock := newOAuthTestHandler(t)
+	expectNoOAuthClient(mock, "client-9")
+
+	query := url.Values{"client_id": {"client-9"}, "redirect_uri": {confidentialClient.redirectURI}}.Encode()
+	rec := httptest.NewRecorder()
+	h.OAuthRoutes().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/authorize?"+query, nil))
+
+	if rec.Code != http.StatusBadRequest || rec.Header().Get("Location") != "" {
+		t.Errorf("status = %d, Location %q, want 400 without a redirect", rec.Code, rec.Header().Get("Location"))
+	}
+}
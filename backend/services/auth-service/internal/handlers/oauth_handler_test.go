@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"context"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "github.com/aashiq-04/session-management-system/backend/services/auth-service/proto"
+)
+
+// authorizeRequest returns a request from user-1's session-1 to sign in to
+// client with an S256 code challenge
+func authorizeRequest(client oauthTestClient) *pb.AuthorizeOAuthClientRequest {
+	return &pb.AuthorizeOAuthClientRequest{
+		UserId:              "user-1",
+		SessionId:           "session-1",
+		ClientId:            client.id,
+		RedirectUri:         client.redirectURI,
+		ResponseType:        "code",
+		Scope:               "openid email",
+		State:               "state-1",
+		Nonce:               "nonce-1",
+		CodeChallenge:       testCodeChallenge,
+		CodeChallengeMethod: "S256",
+	}
+}
+
+// An app the user already consented to gets a code bound to its S256
+// challenge
+func TestAuthorizeOAuthClientStoresCodeChallenge(t *testing.T) {
+	h, mock := newOAuthTestHandler(t)
+	now := time.Now()
+
+	expectOAuthClient(mock, publicClient)
+	mock.ExpectQuery(regexp.QuoteMeta("FROM users")).
+		WithArgs("user-1").
+		WillReturnRows(userRow("user-1", "alice@example.com"))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM sessions")).
+		WithArgs("session-1").
+		WillReturnRows(sqlmock.NewRows(sessionColumns).
+			AddRow("session-1", "user-1", "device-1", "refresh", "203.0.113.7", nil, nil, nil, nil, nil,
+				true, now.Add(time.Hour), now.Add(-time.Hour), nil, nil, now.Add(-time.Hour), "{pwd}"))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM oauth_consents")).
+		WithArgs("user-1", publicClient.id).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "client_id", "name", "scopes", "created_at", "updated_at"}).
+			AddRow("user-1", publicClient.id, "Example app", "{openid,email}", now, now))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM oauth_authorization_codes")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO oauth_authorization_codes")).
+		WithArgs(sqlmock.AnyArg(), publicClient.id, "user-1", "session-1", publicClient.redirectURI,
+			pq.Array([]string{"openid", "email"}), "nonce-1", testCodeChallenge, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectAuditEvent(mock, "oauth_authorization_granted")
+
+	resp, err := h.AuthorizeOAuthClient(context.Background(), authorizeRequest(publicClient))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !resp.Success {
+		t.Fatalf("request rejected: %s", resp.Message)
+	}
+	redirect, err := url.Parse(resp.RedirectUrl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := redirect.Query()
+	if !strings.HasPrefix(resp.RedirectUrl, publicClient.redirectURI+"?") || query.Get("code") == "" ||
+		query.Get("state") != "state-1" || query.Get("iss") != testOAuthIssuer {
+		t.Errorf("redirect = %s, want a code for %s", resp.RedirectUrl, publicClient.redirectURI)
+	}
+}
+
+// Requests that can't be answered with a code are sent back to the app
+// with an error, before the user is looked up
+func TestAuthorizeOAuthClientRejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		client oauthTestClient
+		change func(*pb.AuthorizeOAuthClientRequest)
+		error  string
+	}{
+		{
+			name:   "public client without a challenge",
+			client: publicClient,
+			change: func(req *pb.AuthorizeOAuthClientRequest) { req.CodeChallenge, req.CodeChallengeMethod = "", "" },
+			error:  "invalid_request",
+		},
+		{
+			name:   "plain challenge",
+			client: publicClient,
+			change: func(req *pb.AuthorizeOAuthClientRequest) {
+				req.CodeChallenge, req.CodeChallengeMethod = testCodeVerifier, "plain"
+			},
+			error: "invalid_request",
+		},
+		{
+			name:   "challenge without a method",
+			client: confidentialClient,
+			change: func(req *pb.AuthorizeOAuthClientRequest) { req.CodeChallengeMethod = "" },
+			error:  "invalid_request",
+		},
+		{
+			name:   "short S256 challenge",
+			client: publicClient,
+			change: func(req *pb.AuthorizeOAuthClientRequest) { req.CodeChallenge = testCodeChallenge[:42] },
+			error:  "invalid_request",
+		},
+		{
+			name:   "implicit flow",
+			client: publicClient,
+			change: func(req *pb.AuthorizeOAuthClientRequest) { req.ResponseType = "token" },
+			error:  "unsupported_response_type",
+		},
+		{
+			name:   "without openid",
+			client: publicClient,
+			change: func(req *pb.AuthorizeOAuthClientRequest) { req.Scope = "email" },
+			error:  "invalid_scope",
+		},
+		{
+			name:   "unregistered scope",
+			client: publicClient,
+			change: func(req *pb.AuthorizeOAuthClientRequest) { req.Scope = "openid admin" },
+			error:  "invalid_scope",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, mock := newOAuthTestHandler(t)
+			expectOAuthClient(mock, tt.client)
+
+			req := authorizeRequest(tt.client)
+			tt.change(req)
+			resp, err := h.AuthorizeOAuthClient(context.Background(), req)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if resp.Success {
+				t.Fatal("request authorized")
+			}
+			redirect, err := url.Parse(resp.RedirectUrl)
+			if err != nil {
+				t.Fatal(err)
+			}
+			query := redirect.Query()
+			if query.Get("error") != tt.error || query.Get("state") != "state-1" || query.Get("code") != "" {
+				t.Errorf("redirect = %s, want error %s", resp.RedirectUrl, tt.error)
+			}
+		})
+	}
+}
+
+// Without a registered redirect URI, an error can't be sent back to the app
+func TestAuthorizeOAuthClientRejectsUnregisteredRedirectURI(t *testing.T) {
+	h, mock := newOAuthTestHandler(t)
+	expectOAuthClient(mock, publicClient)
+
+	req := authorizeRequest(publicClient)
+	req.RedirectUri = publicClient.redirectURI + "/"
+	resp, err := h.AuthorizeOAuthClient(context.Background(), req)
+
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("got %v, %v, want InvalidArgument", resp, err)
+	}
+}
@@ -0,0 +1,336 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/grpcerr"
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/identity"
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/models"
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/repository"
+	pb "github.com/aashiq-04/session-management-system/backend/services/auth-service/proto"
+)
+
+// Reasons reported in ErrorInfo when an organization's policy refuses a
+// sign-in or a policy change
+const (
+	reasonMFARequired          = "MFA_REQUIRED_BY_ORGANIZATION"
+	reasonIPNotAllowed         = "IP_NOT_ALLOWED"
+	reasonCountryNotAllowed    = "COUNTRY_NOT_ALLOWED"
+	reasonPolicyExcludesCaller = "POLICY_EXCLUDES_CALLER"
+)
+
+// defaultSessionLifetime is how long a session lasts when the organization
+// doesn't shorten it; refresh tokens expire after the same time
+const defaultSessionLifetime = 7 * 24 * time.Hour
+
+// policyViolation is a sign-in an organization's policy refuses. Violations
+// of a network or country rule name the policy they broke.
+type policyViolation struct {
+	reason        string // for ErrorInfo
+	failureReason string // for the audit log
+	message       string
+	policyID      string // the organization's own ID for its allowlists
+	policyName    string
+	action        string // models.AccessPolicyBlock or models.AccessPolicyStepUp
+}
+
+// checkNetworkPolicy returns the violation, if any, of signing in from ip in
+// country under org's allowlists. Missing values fail a list that is set.
+func checkNetworkPolicy(org *models.Organization, ip, country string) *policyViolation {
+	if len(org.IPAllowlist) > 0 && !ipInNetworks(org.IPAllowlist, ip) {
+		return &policyViolation{
+			reason:        reasonIPNotAllowed,
+			failureReason: "ip_not_allowed",
+			message:       "Signing in from this network is not allowed by your organization",
+			policyID:      org.ID,
+			policyName:    "organization allowlist",
+			action:        models.AccessPolicyBlock,
+		}
+	}
+
+	if len(org.AllowedCountries) > 0 && !countryInList(org.AllowedCountries, country) {
+		return &policyViolation{
+			reason:        reasonCountryNotAllowed,
+			failureReason: "country_not_allowed",
+			message:       "Signing in from this country is not allowed by your organization",
+			policyID:      org.ID,
+			policyName:    "organization allowlist",
+			action:        models.AccessPolicyBlock,
+		}
+	}
+
+	return nil
+}
+
+// checkMFAPolicy returns the violation, if any, of user signing in without
+// MFA under org's policy
+func checkMFAPolicy(org *models.Organization, user *models.User) *policyViolation {
+	if !org.MFARequired || user.MFAEnabled {
+		return nil
+	}
+	return &policyViolation{
+		reason:        reasonMFARequired,
+		failureReason: "mfa_required",
+		message:       "Your organization requires multi-factor authentication",
+	}
+}
+
+// ipInNetworks reports whether ip lies in one of the networks. Only the
+// first address of a forwarded list counts.
+func ipInNetworks(networks []string, ip string) bool {
+	ip, _, _ = strings.Cut(ip, ",")
+	addr, err := netip.ParseAddr(strings.TrimSpace(ip))
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+
+	for _, network := range networks {
+		prefix, err := netip.ParsePrefix(network)
+		if err == nil && prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// countryInList reports whether country is one of countries, ignoring case
+func countryInList(countries []string, country string) bool {
+	country = strings.TrimSpace(country)
+	for _, listed := range countries {
+		if country != "" && strings.EqualFold(listed, country) {
+			return true
+		}
+	}
+	return false
+}
+
+// sessionLifetime is how long sessions of org's members last
+func sessionLifetime(org *models.Organization) time.Duration {
+	if org.SessionLifetimeSeconds == nil {
+		return defaultSessionLifetime
+	}
+	return time.Duration(*org.SessionLifetimeSeconds) * time.Second
+}
+
+// getOrganization loads an organization, returning a status error if that
+// fails
+func (h *AuthHandler) getOrganization(organizationID string) (*models.Organization, error) {
+	org, err := h.repo.GetOrganization(organizationID)
+	if errors.Is(err, repository.ErrOrganizationNotFound) {
+		return nil, grpcerr.NotFound("Organization not found", "organization", organizationID)
+	}
+	if err != nil {
+		log.Printf("Failed to get organization: %v", err)
+		return nil, grpcerr.Storage("Failed to get organization", err)
+	}
+
+	return org, nil
+}
+
+// getTenantOrganization loads an organization the caller may manage. Other
+// organizations are reported as not found, so their IDs can't be probed.
+func (h *AuthHandler) getTenantOrganization(ctx context.Context, organizationID string) (*models.Organization, error) {
+	if organizationID == "" {
+		return nil, grpcerr.InvalidArgument("Organization is required", grpcerr.Field("organization_id", "is required"))
+	}
+	if _, err := uuid.Parse(organizationID); err != nil || !identity.InTenant(ctx, organizationID) {
+		return nil, grpcerr.NotFound("Organization not found", "organization", organizationID)
+	}
+
+	return h.getOrganization(organizationID)
+}
+
+// getTenantUser loads a user the caller may administer. Members of other
+// organizations are reported as not found.
+func (h *AuthHandler) getTenantUser(ctx context.Context, userID string) (*models.User, error) {
+	user, err := h.getUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if !identity.InTenant(ctx, user.OrganizationID) {
+		return nil, grpcerr.NotFound("User not found", "user", userID)
+	}
+
+	return user, nil
+}
+
+// GetOrganization returns an organization and its sign-in policy, for users
+// with the organizations:manage permission in it
+func (h *AuthHandler) GetOrganization(ctx context.Context, req *pb.GetOrganizationRequest) (*pb.GetOrganizationResponse, error) {
+	log.Printf("GetOrganization request received for %s from %s", req.OrganizationId, identity.ActorFromContext(ctx))
+
+	org, err := h.getTenantOrganization(ctx, req.OrganizationId)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.GetOrganizationResponse{
+		Success:      true,
+		Message:      "Organization retrieved",
+		Organization: organizationToProto(org),
+	}, nil
+}
+
+// UpdateOrganizationPolicy replaces an organization's sign-in policy, for
+// users with the organizations:manage permission in it. The new policy
+// applies from members' next sign-in or token refresh.
+func (h *AuthHandler) UpdateOrganizationPolicy(ctx context.Context, req *pb.UpdateOrganizationPolicyRequest) (*pb.UpdateOrganizationPolicyResponse, error) {
+	actor := identity.ActorFromContext(ctx)
+	log.Printf("UpdateOrganizationPolicy request received for %s from %s", req.OrganizationId, actor)
+
+	org, err := h.getTenantOrganization(ctx, req.OrganizationId)
+	if err != nil {
+		return nil, err
+	}
+
+	maxLifetime := int32(defaultSessionLifetime / time.Second)
+	if req.SessionLifetimeSeconds < 0 || req.SessionLifetimeSeconds > maxLifetime {
+		return nil, grpcerr.InvalidArgument("Invalid session lifetime",
+			grpcerr.Field("session_lifetime_seconds", fmt.Sprintf("must be between 0 and %d", maxLifetime)))
+	}
+
+	countries, err := normalizeCountries("allowed_countries", req.AllowedCountries)
+	if err != nil {
+		return nil, err
+	}
+	networks, err := normalizeNetworks("ip_allowlist", req.IpAllowlist)
+	if err != nil {
+		return nil, err
+	}
+
+	// Refuse a policy that would sign out the admin changing it
+	if req.IpAddress != "" && len(networks) > 0 && !ipInNetworks(networks, req.IpAddress) {
+		return nil, grpcerr.FailedPrecondition("The IP allowlist doesn't include your own address", reasonPolicyExcludesCaller)
+	}
+
+	org.MFARequired = req.MfaRequired
+	org.SessionLifetimeSeconds = nil
+	if req.SessionLifetimeSeconds > 0 {
+		seconds := int(req.SessionLifetimeSeconds)
+		org.SessionLifetimeSeconds = &seconds
+	}
+	org.AllowedCountries = countries
+	org.IPAllowlist = networks
+
+	err = h.repo.UpdateOrganizationPolicy(org)
+	if errors.Is(err, repository.ErrOrganizationNotFound) {
+		return nil, grpcerr.NotFound("Organization not found", "organization", org.ID)
+	}
+	if err != nil {
+		log.Printf("Failed to update organization policy: %v", err)
+		return nil, grpcerr.Storage("Failed to update organization policy", err)
+	}
+
+	org, err = h.getOrganization(org.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata, _ := json.Marshal(map[string]interface{}{
+		"organization_id":          org.ID,
+		"updated_by":               actor,
+		"mfa_required":             org.MFARequired,
+		"session_lifetime_seconds": req.SessionLifetimeSeconds,
+		"allowed_countries":        org.AllowedCountries,
+		"ip_allowlist":             org.IPAllowlist,
+	})
+	metadataStr := string(metadata)
+
+	var userID *string
+	if subject, ok := identity.SubjectFromContext(ctx); ok {
+		userID = &subject
+	}
+
+	h.createAuditLog(&models.AuditLog{
+		ID:            uuid.New().String(),
+		UserID:        userID,
+		EventType:     "organization_policy_updated",
+		EventCategory: "security",
+		Severity:      "warning",
+		IPAddress:     strPtr(req.IpAddress),
+		Metadata:      &metadataStr,
+		Success:       true,
+		CreatedAt:     time.Now(),
+	})
+
+	return &pb.UpdateOrganizationPolicyResponse{
+		Success:      true,
+		Message:      "Organization policy updated",
+		Organization: organizationToProto(org),
+	}, nil
+}
+
+// normalizeCountries trims a country list from a request, returning an
+// InvalidArgument error naming field if it has empty entries
+func normalizeCountries(field string, values []string) ([]string, error) {
+	countries := make([]string, 0, len(values))
+	for _, country := range values {
+		country = strings.TrimSpace(country)
+		if country == "" {
+			return nil, grpcerr.InvalidArgument("Invalid country list",
+				grpcerr.Field(field, "must not contain empty entries"))
+		}
+		countries = append(countries, country)
+	}
+	return countries, nil
+}
+
+// normalizeNetworks parses a network list from a request into CIDRs,
+// returning an InvalidArgument error naming field if an entry isn't one
+func normalizeNetworks(field string, values []string) ([]string, error) {
+	networks := make([]string, 0, len(values))
+	for _, network := range values {
+		prefix, err := parseNetwork(network)
+		if err != nil {
+			return nil, grpcerr.InvalidArgument("Invalid network list",
+				grpcerr.Field(field, fmt.Sprintf("%q is not an IP address or CIDR", network)))
+		}
+		networks = append(networks, prefix.String())
+	}
+	return networks, nil
+}
+
+// parseNetwork parses a CIDR, or a single address as a network of one
+func parseNetwork(network string) (netip.Prefix, error) {
+	network = strings.TrimSpace(network)
+	if addr, err := netip.ParseAddr(network); err == nil {
+		addr = addr.Unmap()
+		return netip.PrefixFrom(addr, addr.BitLen()), nil
+	}
+
+	prefix, err := netip.ParsePrefix(network)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return prefix.Masked(), nil
+}
+
+// organizationToProto converts an organization for clients
+func organizationToProto(org *models.Organization) *pb.Organization {
+	var lifetime int32
+	if org.SessionLifetimeSeconds != nil {
+		lifetime = int32(*org.SessionLifetimeSeconds)
+	}
+
+	return &pb.Organization{
+		Id:                     org.ID,
+		Name:                   org.Name,
+		Slug:                   org.Slug,
+		MfaRequired:            org.MFARequired,
+		SessionLifetimeSeconds: lifetime,
+		AllowedCountries:       org.AllowedCountries,
+		IpAllowlist:            org.IPAllowlist,
+		CreatedAt:              org.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:              org.UpdatedAt.Format(time.RFC3339),
+	}
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/identity"
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/models"
+	pb "github.com/aashiq-04/session-management-system/backend/services/auth-service/proto"
+)
+
+// Policy says who may call each method. The gateway makes every call but
+// one, which the session service makes for devices it owns; signing in
+// happens before there is a user to vouch for, so only the account methods
+// need an identity token. Administering other users'
+// accounts or the organization needs a permission from the user's roles,
+// which reaches their own organization, or the ops certificate.
+var Policy = identity.Policy{
+	pb.AuthService_Register_FullMethodName:       {Callers: []string{identity.Gateway}},
+	pb.AuthService_Login_FullMethodName:          {Callers: []string{identity.Gateway}},
+	pb.AuthService_ValidateToken_FullMethodName:  {Callers: []string{identity.Gateway}},
+	pb.AuthService_RefreshToken_FullMethodName:   {Callers: []string{identity.Gateway}},
+	pb.AuthService_EnableMFA_FullMethodName:      {Callers: []string{identity.Gateway}, User: true},
+	pb.AuthService_VerifyMFA_FullMethodName:      {Callers: []string{identity.Gateway}, User: true},
+	pb.AuthService_GetUserProfile_FullMethodName: {Callers: []string{identity.Gateway}, User: true},
+	pb.AuthService_Reauthenticate_FullMethodName: {Callers: []string{identity.Gateway}, User: true},
+
+	pb.AuthService_StartFederatedReauthentication_FullMethodName: {Callers: []string{identity.Gateway}, User: true},
+
+	pb.AuthService_ListIdentityProviders_FullMethodName:  {Callers: []string{identity.Gateway}},
+	pb.AuthService_StartFederatedLogin_FullMethodName:    {Callers: []string{identity.Gateway}},
+	pb.AuthService_CompleteFederatedLogin_FullMethodName: {Callers: []string{identity.Gateway}},
+	pb.AuthService_StartSAMLLogin_FullMethodName:         {Callers: []string{identity.Gateway}},
+
+	// API tokens are checked before there is a user, and managed by them
+	pb.AuthService_ValidateAPIToken_FullMethodName: {Callers: []string{identity.Gateway}},
+	pb.AuthService_ListAPITokens_FullMethodName:    {Callers: []string{identity.Gateway}, User: true},
+	pb.AuthService_CreateAPIToken_FullMethodName:   {Callers: []string{identity.Gateway}, User: true},
+	pb.AuthService_RevokeAPIToken_FullMethodName:   {Callers: []string{identity.Gateway}, User: true},
+
+	pb.AuthService_ExportUserData_FullMethodName:         {Callers: []string{identity.Gateway}, User: true},
+	pb.AuthService_RequestAccountDeletion_FullMethodName: {Callers: []string{identity.Gateway}, User: true},
+	pb.AuthService_CancelAccountDeletion_FullMethodName:  {Callers: []string{identity.Gateway}, User: true},
+
+	// Apps are signed in to through the user's own session
+	pb.AuthService_AuthorizeOAuthClient_FullMethodName: {Callers: []string{identity.Gateway}, User: true},
+	pb.AuthService_ListOAuthConsents_FullMethodName:    {Callers: []string{identity.Gateway}, User: true},
+	pb.AuthService_RevokeOAuthConsent_FullMethodName:   {Callers: []string{identity.Gateway}, User: true},
+
+	pb.AuthService_ListUsers_FullMethodName:      {Callers: []string{identity.Gateway, identity.Ops}, Permission: identity.PermissionUsersRead},
+	pb.AuthService_DisableUser_FullMethodName:    {Callers: []string{identity.Gateway, identity.Ops}, Permission: identity.PermissionUsersDisable},
+	pb.AuthService_ReactivateUser_FullMethodName: {Callers: []string{identity.Gateway, identity.Ops}, Permission: identity.PermissionUsersDisable},
+	pb.AuthService_DeleteUser_FullMethodName:     {Callers: []string{identity.Gateway, identity.Ops}, Permission: identity.PermissionUsersDelete},
+
+	pb.AuthService_GetOrganization_FullMethodName:          {Callers: []string{identity.Gateway, identity.Ops}, Permission: identity.PermissionOrgsManage},
+	pb.AuthService_UpdateOrganizationPolicy_FullMethodName: {Callers: []string{identity.Gateway, identity.Ops}, Permission: identity.PermissionOrgsManage},
+	pb.AuthService_ListAccessPolicies_FullMethodName:       {Callers: []string{identity.Gateway, identity.Ops}, Permission: identity.PermissionOrgsManage},
+	pb.AuthService_CreateAccessPolicy_FullMethodName:       {Callers: []string{identity.Gateway, identity.Ops}, Permission: identity.PermissionOrgsManage},
+	pb.AuthService_DeleteAccessPolicy_FullMethodName:       {Callers: []string{identity.Gateway, identity.Ops}, Permission: identity.PermissionOrgsManage},
+	pb.AuthService_ListOAuthClients_FullMethodName:         {Callers: []string{identity.Gateway, identity.Ops}, Permission: identity.PermissionOrgsManage},
+	pb.AuthService_CreateOAuthClient_FullMethodName:        {Callers: []string{identity.Gateway, identity.Ops}, Permission: identity.PermissionOrgsManage},
+	pb.AuthService_DeleteOAuthClient_FullMethodName:        {Callers: []string{identity.Gateway, identity.Ops}, Permission: identity.PermissionOrgsManage},
+	pb.AuthService_GetSAMLConnection_FullMethodName:        {Callers: []string{identity.Gateway, identity.Ops}, Permission: identity.PermissionOrgsManage},
+	pb.AuthService_UpdateSAMLConnection_FullMethodName:     {Callers: []string{identity.Gateway, identity.Ops}, Permission: identity.PermissionOrgsManage},
+	pb.AuthService_ListAPIKeys_FullMethodName:              {Callers: []string{identity.Gateway, identity.Ops}, Permission: identity.PermissionOrgsManage},
+	pb.AuthService_RevokeAPIKey_FullMethodName:             {Callers: []string{identity.Gateway, identity.Ops}, Permission: identity.PermissionOrgsManage},
+
+	// Impersonation sessions are marked with the admin's ID, so only a
+	// signed-in admin may open one
+	pb.AuthService_ImpersonateUser_FullMethodName: {Callers: []string{identity.Gateway}, Permission: identity.PermissionUsersImpersonate},
+
+	// API keys act as the admin who makes them, so only a signed-in admin
+	// may make one
+	pb.AuthService_CreateAPIKey_FullMethodName: {Callers: []string{identity.Gateway}, Permission: identity.PermissionOrgsManage},
+
+	// Devices belong to the session service, which revokes their trust
+	// tokens here when they are untrusted or removed
+	pb.AuthService_RevokeDeviceTrust_FullMethodName: {Callers: []string{identity.SessionService}},
+}.WithReflection(identity.Ops)
+
+// RecordDenial records a refused call as an access_denied audit event. The
+// event belongs to the user the call was made for, if any.
+func (h *AuthHandler) RecordDenial(denial identity.Denial) {
+	metadata, _ := json.Marshal(map[string]string{
+		"method":        denial.Method,
+		"caller":        denial.Caller,
+		"resource_type": denial.ResourceType,
+		"resource_id":   denial.ResourceID,
+	})
+	metadataStr := string(metadata)
+
+	var userID *string
+	if denial.Subject != "" {
+		userID = &denial.Subject
+	}
+
+	h.createAuditLog(&models.AuditLog{
+		ID:            uuid.New().String(),
+		UserID:        userID,
+		EventType:     "access_denied",
+		EventCategory: "authorization",
+		Severity:      "warning",
+		Metadata:      &metadataStr,
+		Success:       false,
+		FailureReason: &denial.Reason,
+		CreatedAt:     time.Now(),
+	})
+}
@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/audit"
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/identity"
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/identity/identitytest"
+	pb "github.com/aashiq-04/session-management-system/backend/services/auth-service/proto"
+)
+
+// access says which of the test callers may call a method. Every call is for
+// user-1 of org-1.
+type access struct {
+	owner       bool // the gateway for user-1, whose roles grant no permissions
+	sameTenant  bool // the gateway for user-2 of org-1, whose roles grant every permission
+	otherTenant bool // the gateway for user-3 of org-2, whose roles grant every permission
+	ops         bool // the ops certificate, on no user's behalf
+	service     bool // the session service
+}
+
+var (
+	gatewayAccess    = access{owner: true, sameTenant: true, otherTenant: true}
+	userAccess       = access{owner: true}
+	permissionAccess = access{sameTenant: true, otherTenant: true, ops: true}
+	adminAccess      = access{sameTenant: true, otherTenant: true}
+)
+
+// The interceptor only checks who may call a method. Which users'
+// resources a permission reaches is up to the handler, which scopes them to
+// the user's organization, so permission holders of other organizations get
+// through here.
+var policyTests = map[string]access{
+	pb.AuthService_Register_FullMethodName:       gatewayAccess,
+	pb.AuthService_Login_FullMethodName:          gatewayAccess,
+	pb.AuthService_ValidateToken_FullMethodName:  gatewayAccess,
+	pb.AuthService_RefreshToken_FullMethodName:   gatewayAccess,
+	pb.AuthService_EnableMFA_FullMethodName:      userAccess,
+	pb.AuthService_VerifyMFA_FullMethodName:      userAccess,
+	pb.AuthService_GetUserProfile_FullMethodName: userAccess,
+	pb.AuthService_Reauthenticate_FullMethodName: userAccess,
+
+	pb.AuthService_StartFederatedReauthentication_FullMethodName: userAccess,
+
+	pb.AuthService_ListIdentityProviders_FullMethodName:  gatewayAccess,
+	pb.AuthService_StartFederatedLogin_FullMethodName:    gatewayAccess,
+	pb.AuthService_CompleteFederatedLogin_FullMethodName: gatewayAccess,
+	pb.AuthService_StartSAMLLogin_FullMethodName:         gatewayAccess,
+
+	pb.AuthService_ValidateAPIToken_FullMethodName: gatewayAccess,
+	pb.AuthService_ListAPITokens_FullMethodName:    userAccess,
+	pb.AuthService_CreateAPIToken_FullMethodName:   userAccess,
+	pb.AuthService_RevokeAPIToken_FullMethodName:   userAccess,
+
+	pb.AuthService_ExportUserData_FullMethodName:         userAccess,
+	pb.AuthService_RequestAccountDeletion_FullMethodName: userAccess,
+	pb.AuthService_CancelAccountDeletion_FullMethodName:  userAccess,
+
+	pb.AuthService_AuthorizeOAuthClient_FullMethodName: userAccess,
+	pb.AuthService_ListOAuthConsents_FullMethodName:    userAccess,
+	pb.AuthService_RevokeOAuthConsent_FullMethodName:   userAccess,
+
+	pb.AuthService_ListUsers_FullMethodName:      permissionAccess,
+	pb.AuthService_DisableUser_FullMethodName:    permissionAccess,
+	pb.AuthService_ReactivateUser_FullMethodName: permissionAccess,
+	pb.AuthService_DeleteUser_FullMethodName:     permissionAccess,
+
+	pb.AuthService_GetOrganization_FullMethodName:          permissionAccess,
+	pb.AuthService_UpdateOrganizationPolicy_FullMethodName: permissionAccess,
+	pb.AuthService_ListAccessPolicies_FullMethodName:       permissionAccess,
+	pb.AuthService_CreateAccessPolicy_FullMethodName:       permissionAccess,
+	pb.AuthService_DeleteAccessPolicy_FullMethodName:       permissionAccess,
+	pb.AuthService_ListOAuthClients_FullMethodName:         permissionAccess,
+	pb.AuthService_CreateOAuthClient_FullMethodName:        permissionAccess,
+	pb.AuthService_DeleteOAuthClient_FullMethodName:        permissionAccess,
+	pb.AuthService_GetSAMLConnection_FullMethodName:        permissionAccess,
+	pb.AuthService_UpdateSAMLConnection_FullMethodName:     permissionAccess,
+	pb.AuthService_ListAPIKeys_FullMethodName:              permissionAccess,
+	pb.AuthService_RevokeAPIKey_FullMethodName:             permissionAccess,
+
+	pb.AuthService_ImpersonateUser_FullMethodName: adminAccess,
+	pb.AuthService_CreateAPIKey_FullMethodName:    adminAccess,
+
+	pb.AuthService_RevokeDeviceTrust_FullMethodName: {service: true},
+}
+
+var allPermissions = []string{
+	identity.PermissionUsersRead, identity.PermissionUsersDisable, identity.PermissionUsersDelete,
+	identity.PermissionUsersImpersonate, identity.PermissionSessionsRead, identity.PermissionSessionsRevoke,
+	identity.PermissionAlertsRead, identity.PermissionAlertsResolve, identity.PermissionOrgsManage,
+}
+
+func TestPolicy(t *testing.T) {
+	gateway := identitytest.NewGateway(t, identity.AuthService)
+
+	type caller struct {
+		name string
+		ctx  context.Context
+		may  func(access) bool
+	}
+	callers := []caller{
+		{"owner", identitytest.Incoming(identity.Gateway, gateway.Token(t, "user-1", "org-1")),
+			func(a access) bool { return a.owner }},
+		{"same-tenant permission holder", identitytest.Incoming(identity.Gateway, gateway.Token(t, "user-2", "org-1", allPermissions...)),
+			func(a access) bool { return a.sameTenant }},
+		{"other-tenant permission holder", identitytest.Incoming(identity.Gateway, gateway.Token(t, "user-3", "org-2", allPermissions...)),
+			func(a access) bool { return a.otherTenant }},
+		{"ops", identitytest.Incoming(identity.Ops, ""),
+			func(a access) bool { return a.ops }},
+		{"session service", identitytest.Incoming(identity.SessionService, ""),
+			func(a access) bool { return a.service }},
+	}
+
+	for method := range Policy {
+		if _, ok := policyTests[method]; !ok && !strings.HasPrefix(method, "/grpc.reflection.") {
+			t.Errorf("no policy test for %s", method)
+		}
+	}
+
+	for method, want := range policyTests {
+		for _, c := range callers {
+			t.Run(method+"/"+c.name, func(t *testing.T) {
+				h, mock := newPolicyTestHandler(t)
+				interceptor := identity.NewAuthenticator(Policy, gateway.Verifier(), h.RecordDenial).UnaryInterceptor()
+
+				allowed := c.may(want)
+				if !allowed {
+					mock.ExpectExec(regexp.QuoteMeta("INSERT INTO audit_outbox")).
+						WithArgs(sqlmock.AnyArg(), "auth-service", auditEvent("access_denied"), sqlmock.AnyArg()).
+						WillReturnResult(sqlmock.NewResult(0, 1))
+				}
+
+				called := false
+				_, err := interceptor(c.ctx, requestFor(t, method, "user-1"), &grpc.UnaryServerInfo{FullMethod: method},
+					func(ctx context.Context, req interface{}) (interface{}, error) {
+						called = true
+						return nil, nil
+					})
+
+				if allowed && (err != nil || !called) {
+					t.Errorf("refused: %v", err)
+				}
+				if !allowed {
+					if code := status.Code(err); called || (code != codes.PermissionDenied && code != codes.Unauthenticated) {
+						t.Errorf("allowed: %v", err)
+					}
+				}
+			})
+		}
+	}
+}
+
+// newPolicyTestHandler returns a handler recording denials in a mock
+// database, which fails the test on any statement not expected of it
+func newPolicyTestHandler(t *testing.T) (*AuthHandler, sqlmock.Sqlmock) {
+	t.Helper()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+		db.Close()
+	})
+
+	return &AuthHandler{audit: audit.NewOutbox(db, nil)}, mock
+}
+
+// requestFor returns an empty request message of method, for userID if it
+// has a user_id field
+func requestFor(t *testing.T, method, userID string) interface{} {
+	t.Helper()
+
+	name := protoreflect.FullName(strings.ReplaceAll(strings.TrimPrefix(method, "/"), "/", "."))
+	descriptor, err := protoregistry.GlobalFiles.FindDescriptorByName(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	messageType, err := protoregistry.GlobalTypes.FindMessageByName(descriptor.(protoreflect.MethodDescriptor).Input().FullName())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	message := messageType.New()
+	if field := message.Descriptor().Fields().ByName("user_id"); field != nil {
+		message.Set(field, protoreflect.ValueOfString(userID))
+	}
+	return message.Interface()
+}
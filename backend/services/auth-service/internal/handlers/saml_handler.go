@@ -0,0 +1,663 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/grpcerr"
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/identity"
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/models"
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/repository"
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/saml"
+	pb "github.com/aashiq-04/session-management-system/backend/services/auth-service/proto"
+)
+
+// reasonSAMLDisabled is reported in ErrorInfo when SAML login isn't set up
+const reasonSAMLDisabled = "SAML_DISABLED"
+
+// samlProviderPrefix starts the provider name of SAML logins, which is
+// followed by the organization ID
+const samlProviderPrefix = "saml:"
+
+// maxSAMLFormBytes caps the body posted to the assertion consumer service
+const maxSAMLFormBytes = 512 << 10
+
+// Limits on the fields of a SAML connection, from the table's columns
+const (
+	maxSAMLEntityIDLength  = 1024
+	maxSAMLURLLength       = 2048
+	maxSAMLAttributeLength = 255
+	maxSAMLNameIDLength    = 255 // linked as the subject of a federated identity
+)
+
+// SAMLConfig configures this service as a SAML service provider. A nil
+// config leaves SAML login disabled.
+type SAMLConfig struct {
+	ServiceProvider  saml.ServiceProvider
+	MetadataURL      string
+	LoginRedirectURL string // the frontend page users are sent back to
+}
+
+// StartSAMLLogin returns the identity provider URL to send a member of an
+// organization to. The request ID and a hash of the relay state are kept
+// until the identity provider answers.
+func (h *AuthHandler) StartSAMLLogin(ctx context.Context, req *pb.StartSAMLLoginRequest) (*pb.StartSAMLLoginResponse, error) {
+	log.Printf("StartSAMLLogin request received for organization: %s", req.Organization)
+
+	if h.saml == nil {
+		return nil, grpcerr.FailedPrecondition("SAML login is not enabled", reasonSAMLDisabled)
+	}
+	if req.Organization == "" {
+		return nil, grpcerr.InvalidArgument("Organization is required", grpcerr.Field("organization", "is required"))
+	}
+
+	// Organizations without SAML look the same as unknown ones
+	notFound := grpcerr.NotFound("SAML login is not set up for this organization", "organization", req.Organization)
+	org, err := h.repo.GetOrganizationBySlug(req.Organization)
+	if errors.Is(err, repository.ErrOrganizationNotFound) {
+		return nil, notFound
+	}
+	if err != nil {
+		log.Printf("Failed to get organization: %v", err)
+		return nil, grpcerr.Storage("Failed to start login", err)
+	}
+	conn, err := h.repo.GetSAMLConnection(org.ID)
+	if errors.Is(err, repository.ErrSAMLConnectionNotFound) {
+		return nil, notFound
+	}
+	if err != nil {
+		log.Printf("Failed to get SAML connection: %v", err)
+		return nil, grpcerr.Storage("Failed to start login", err)
+	}
+	if !conn.Enabled {
+		return nil, notFound
+	}
+
+	redirectURL, relayState, err := h.sendSAMLRequest(conn, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.StartSAMLLoginResponse{
+		Success:     true,
+		Message:     "Redirect the user to the identity provider",
+		RedirectUrl: redirectURL,
+		Provider:    samlProviderName(org.ID),
+		State:       relayState,
+	}, nil
+}
+
+// sendSAMLRequest returns the URL of an authentication request to a
+// connection's identity provider, with its relay state. The request is kept
+// until the identity provider answers it. Reauthentications are made with
+// ForceAuthn.
+func (h *AuthHandler) sendSAMLRequest(conn *models.SAMLConnection, reauthentication bool) (string, string, error) {
+	idp, err := samlIdentityProvider(conn)
+	if err != nil {
+		log.Printf("Invalid SAML connection of %s: %v", conn.OrganizationID, err)
+		return "", "", grpcerr.Internal("Failed to start login")
+	}
+
+	requestID, err := saml.NewRequestID()
+	if err != nil {
+		log.Printf("Failed to generate SAML request ID: %v", err)
+		return "", "", grpcerr.Internal("Failed to start login")
+	}
+	relayState, err := saml.NewRelayState()
+	if err != nil {
+		log.Printf("Failed to generate SAML relay state: %v", err)
+		return "", "", grpcerr.Internal("Failed to start login")
+	}
+
+	now := time.Now()
+	buildURL := h.saml.ServiceProvider.AuthnRequestURL
+	if reauthentication {
+		buildURL = h.saml.ServiceProvider.ReauthnRequestURL
+	}
+	redirectURL, err := buildURL(idp, requestID, relayState, now)
+	if err != nil {
+		log.Printf("Failed to build SAML request for %s: %v", conn.OrganizationID, err)
+		return "", "", grpcerr.Internal("Failed to start login")
+	}
+
+	err = h.repo.CreateSAMLLoginRequest(&models.SAMLLoginRequest{
+		RequestID:        requestID,
+		OrganizationID:   conn.OrganizationID,
+		RelayStateHash:   hashFederatedState(relayState),
+		Reauthentication: reauthentication,
+		ExpiresAt:        now.Add(federatedLoginTTL),
+		CreatedAt:        now,
+	})
+	if err != nil {
+		log.Printf("Failed to save SAML login request: %v", err)
+		return "", "", grpcerr.Storage("Failed to start login", err)
+	}
+
+	return redirectURL, relayState, nil
+}
+
+// GetSAMLConnection returns an organization's SAML connection and what its
+// identity provider needs to know about this service, for users with the
+// organizations:manage permission in it
+func (h *AuthHandler) GetSAMLConnection(ctx context.Context, req *pb.GetSAMLConnectionRequest) (*pb.SAMLConnectionResponse, error) {
+	log.Printf("GetSAMLConnection request received for %s from %s", req.OrganizationId, identity.ActorFromContext(ctx))
+
+	if h.saml == nil {
+		return nil, grpcerr.FailedPrecondition("SAML login is not enabled", reasonSAMLDisabled)
+	}
+
+	org, err := h.getTenantOrganization(ctx, req.OrganizationId)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := h.repo.GetSAMLConnection(org.ID)
+	if errors.Is(err, repository.ErrSAMLConnectionNotFound) {
+		return h.samlConnectionResponse("No SAML connection", nil), nil
+	}
+	if err != nil {
+		log.Printf("Failed to get SAML connection: %v", err)
+		return nil, grpcerr.Storage("Failed to get SAML connection", err)
+	}
+
+	return h.samlConnectionResponse("SAML connection retrieved", conn), nil
+}
+
+// UpdateSAMLConnection connects an organization to its identity provider,
+// replacing the previous connection, for users with the
+// organizations:manage permission in it
+func (h *AuthHandler) UpdateSAMLConnection(ctx context.Context, req *pb.UpdateSAMLConnectionRequest) (*pb.SAMLConnectionResponse, error) {
+	actor := identity.ActorFromContext(ctx)
+	log.Printf("UpdateSAMLConnection request received for %s from %s", req.OrganizationId, actor)
+
+	if h.saml == nil {
+		return nil, grpcerr.FailedPrecondition("SAML login is not enabled", reasonSAMLDisabled)
+	}
+
+	org, err := h.getTenantOrganization(ctx, req.OrganizationId)
+	if err != nil {
+		return nil, err
+	}
+
+	conn := &models.SAMLConnection{
+		OrganizationID:  org.ID,
+		IdPEntityID:     strings.TrimSpace(req.IdpEntityId),
+		IdPSSOURL:       strings.TrimSpace(req.IdpSsoUrl),
+		EmailAttribute:  strPtr(strings.TrimSpace(req.EmailAttribute)),
+		NameAttribute:   strPtr(strings.TrimSpace(req.NameAttribute)),
+		JITProvisioning: req.JitProvisioning,
+		Enabled:         req.Enabled,
+	}
+
+	var violations []*errdetails.BadRequest_FieldViolation
+	if conn.IdPEntityID == "" {
+		violations = append(violations, grpcerr.Field("idp_entity_id", "is required"))
+	} else if len(conn.IdPEntityID) > maxSAMLEntityIDLength {
+		violations = append(violations, grpcerr.Field("idp_entity_id", fmt.Sprintf("must be at most %d characters", maxSAMLEntityIDLength)))
+	}
+	if ssoURL, err := url.Parse(conn.IdPSSOURL); err != nil || ssoURL.Scheme != "https" || ssoURL.Host == "" || ssoURL.Fragment != "" {
+		violations = append(violations, grpcerr.Field("idp_sso_url", "must be an absolute https URL"))
+	} else if len(conn.IdPSSOURL) > maxSAMLURLLength {
+		violations = append(violations, grpcerr.Field("idp_sso_url", fmt.Sprintf("must be at most %d characters", maxSAMLURLLength)))
+	}
+	cert, err := saml.ParseCertificate(req.IdpCertificate)
+	if err != nil {
+		violations = append(violations, grpcerr.Field("idp_certificate", err.Error()))
+	}
+	if len(req.EmailAttribute) > maxSAMLAttributeLength {
+		violations = append(violations, grpcerr.Field("email_attribute", fmt.Sprintf("must be at most %d characters", maxSAMLAttributeLength)))
+	}
+	if len(req.NameAttribute) > maxSAMLAttributeLength {
+		violations = append(violations, grpcerr.Field("name_attribute", fmt.Sprintf("must be at most %d characters", maxSAMLAttributeLength)))
+	}
+	if len(violations) > 0 {
+		return nil, grpcerr.InvalidArgument("Invalid SAML connection", violations...)
+	}
+	conn.IdPCertificate = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}))
+
+	now := time.Now()
+	conn.CreatedAt = now
+	conn.UpdatedAt = now
+	if subject, ok := identity.SubjectFromContext(ctx); ok {
+		conn.CreatedBy = &subject
+	}
+	if err := h.repo.SaveSAMLConnection(conn); err != nil {
+		log.Printf("Failed to save SAML connection: %v", err)
+		return nil, grpcerr.Storage("Failed to update SAML connection", err)
+	}
+
+	conn, err = h.repo.GetSAMLConnection(org.ID)
+	if err != nil {
+		log.Printf("Failed to get SAML connection: %v", err)
+		return nil, grpcerr.Storage("Failed to get SAML connection", err)
+	}
+
+	// Whoever controls the identity provider can sign in as the
+	// organization's members, so the certificate is recorded
+	fingerprint := sha256.Sum256(cert.Raw)
+	metadata, _ := json.Marshal(map[string]interface{}{
+		"organization_id":         org.ID,
+		"updated_by":              actor,
+		"idp_entity_id":           conn.IdPEntityID,
+		"idp_sso_url":             conn.IdPSSOURL,
+		"certificate_fingerprint": hex.EncodeToString(fingerprint[:]),
+		"jit_provisioning":        conn.JITProvisioning,
+		"enabled":                 conn.Enabled,
+	})
+	metadataStr := string(metadata)
+
+	var userID *string
+	if subject, ok := identity.SubjectFromContext(ctx); ok {
+		userID = &subject
+	}
+
+	h.createAuditLog(&models.AuditLog{
+		ID:            uuid.New().String(),
+		UserID:        userID,
+		EventType:     "saml_connection_updated",
+		EventCategory: "security",
+		Severity:      "warning",
+		Metadata:      &metadataStr,
+		Success:       true,
+		CreatedAt:     now,
+	})
+
+	return h.samlConnectionResponse("SAML connection updated", conn), nil
+}
+
+// SAMLRoutes returns the service provider's metadata and assertion
+// consumer service endpoints
+func (h *AuthHandler) SAMLRoutes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /saml/metadata", h.handleSAMLMetadata)
+	mux.HandleFunc("POST /saml/acs", h.handleSAMLAssertion)
+	return mux
+}
+
+// handleSAMLMetadata serves the service provider's metadata
+func (h *AuthHandler) handleSAMLMetadata(w http.ResponseWriter, r *http.Request) {
+	metadata, err := h.saml.ServiceProvider.Metadata()
+	if err != nil {
+		log.Printf("Failed to build SAML metadata: %v", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/samlmetadata+xml")
+	w.Write(metadata)
+}
+
+// handleSAMLAssertion is the assertion consumer service. It accepts the
+// identity provider's answer to a pending request and sends the user back
+// to the frontend, which finishes with CompleteFederatedLogin like any
+// federated login, or with Reauthenticate when told reauthentication=true.
+// Failures only tell the frontend that the login failed.
+func (h *AuthHandler) handleSAMLAssertion(w http.ResponseWriter, r *http.Request) {
+	deviceInfo := &pb.DeviceInfo{IpAddress: remoteIP(r), UserAgent: r.UserAgent()}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxSAMLFormBytes)
+	if err := r.ParseForm(); err != nil {
+		log.Printf("Invalid SAML form: %v", err)
+		h.redirectSAMLLogin(w, r, url.Values{"error": {"saml_login_failed"}})
+		return
+	}
+	relayState := r.PostForm.Get("RelayState")
+
+	user, conn, reauthentication, err := h.acceptSAMLResponse(r.PostForm.Get("SAMLResponse"), relayState, deviceInfo)
+	if err != nil {
+		log.Printf("SAML login failed: %v", err)
+		h.redirectSAMLLogin(w, r, url.Values{"error": {"saml_login_failed"}})
+		return
+	}
+
+	// The user finishes signing in, or reauthenticating, with the relay
+	// state, like the state of other federated logins
+	providerName := samlProviderName(conn.OrganizationID)
+	now := time.Now()
+	err = h.repo.SaveFederatedLoginState(&models.FederatedLoginState{
+		StateHash:        hashFederatedState(relayState),
+		Provider:         providerName,
+		UserID:           &user.ID,
+		Reauthentication: reauthentication,
+		ExpiresAt:        now.Add(federatedLoginTTL),
+		CreatedAt:        now,
+	})
+	if err != nil {
+		log.Printf("Failed to save federated login state: %v", err)
+		h.redirectSAMLLogin(w, r, url.Values{"error": {"saml_login_failed"}})
+		return
+	}
+
+	query := url.Values{"provider": {providerName}, "state": {relayState}}
+	if reauthentication {
+		query.Set("reauthentication", "true")
+	}
+	h.redirectSAMLLogin(w, r, query)
+}
+
+// acceptSAMLResponse validates a response against the request it answers
+// and returns the user it vouches for, with the connection it came through
+// and whether the request was for reauthenticating
+func (h *AuthHandler) acceptSAMLResponse(encoded, relayState string, deviceInfo *pb.DeviceInfo) (*models.User, *models.SAMLConnection, bool, error) {
+	if encoded == "" || relayState == "" {
+		h.createFailedSAMLLoginAuditLog(deviceInfo, "saml_response_missing", nil)
+		return nil, nil, false, errors.New("SAMLResponse and RelayState are required")
+	}
+
+	response, err := saml.DecodeResponse(encoded)
+	if err != nil {
+		h.createFailedSAMLLoginAuditLog(deviceInfo, "saml_response_malformed", nil)
+		return nil, nil, false, err
+	}
+
+	// Each request is answered once, so responses can't be replayed, and
+	// only by the browser that started the login
+	request, err := h.repo.ClaimSAMLLoginRequest(response.InResponseTo())
+	if errors.Is(err, repository.ErrSAMLLoginRequestNotFound) {
+		h.createFailedSAMLLoginAuditLog(deviceInfo, "saml_request_unknown", nil)
+		return nil, nil, false, fmt.Errorf("no pending request %q", response.InResponseTo())
+	}
+	if err != nil {
+		return nil, nil, false, err
+	}
+	if subtle.ConstantTimeCompare([]byte(hashFederatedState(relayState)), []byte(request.RelayStateHash)) != 1 {
+		h.createFailedSAMLLoginAuditLog(deviceInfo, "saml_relay_state_mismatch", nil)
+		return nil, nil, false, errors.New("relay state doesn't match the request")
+	}
+
+	conn, err := h.repo.GetSAMLConnection(request.OrganizationID)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	if !conn.Enabled {
+		h.createFailedSAMLLoginAuditLog(deviceInfo, "saml_connection_disabled", conn)
+		return nil, nil, false, errors.New("SAML connection is disabled")
+	}
+	idp, err := samlIdentityProvider(conn)
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	assertion, err := response.Validate(h.saml.ServiceProvider, idp, request.RequestID, time.Now())
+	if err != nil {
+		h.createFailedSAMLLoginAuditLog(deviceInfo, "saml_assertion_invalid", conn)
+		return nil, nil, false, err
+	}
+
+	var user *models.User
+	if request.Reauthentication {
+		user, err = h.reauthenticatedSAMLUser(conn, request, assertion, deviceInfo)
+	} else {
+		user, err = h.resolveSAMLUser(conn, assertion, deviceInfo)
+	}
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	metadata, _ := json.Marshal(map[string]string{
+		"organization_id": conn.OrganizationID,
+		"idp_entity_id":   conn.IdPEntityID,
+		"assertion_id":    assertion.ID,
+		"name_id":         assertion.NameID,
+		"session_index":   assertion.SessionIndex,
+	})
+	metadataStr := string(metadata)
+	h.createAuditLog(&models.AuditLog{
+		ID:            uuid.New().String(),
+		UserID:        &user.ID,
+		EventType:     "saml_assertion_accepted",
+		EventCategory: "authentication",
+		Severity:      "info",
+		IPAddress:     strPtr(deviceInfo.IpAddress),
+		UserAgent:     strPtr(deviceInfo.UserAgent),
+		Metadata:      &metadataStr,
+		Success:       true,
+		CreatedAt:     time.Now(),
+	})
+
+	return user, conn, request.Reauthentication, nil
+}
+
+// reauthenticatedSAMLUser returns the user an assertion answering a
+// reauthentication vouches for. The identity provider must have signed the
+// user in again, as ForceAuthn asked, and with an identity already linked to
+// them: reauthenticating links and provisions nobody.
+func (h *AuthHandler) reauthenticatedSAMLUser(conn *models.SAMLConnection, request *models.SAMLLoginRequest, assertion *saml.Assertion, deviceInfo *pb.DeviceInfo) (*models.User, error) {
+	if assertion.AuthnInstant.Before(request.CreatedAt.Add(-reauthenticationClockSkew)) {
+		h.createFailedSAMLLoginAuditLog(deviceInfo, "saml_authentication_not_fresh", conn)
+		return nil, fmt.Errorf("user signed in at %s, before reauthenticating", assertion.AuthnInstant.Format(time.RFC3339))
+	}
+
+	link, err := h.repo.GetFederatedIdentity(samlProviderName(conn.OrganizationID), assertion.NameID)
+	if errors.Is(err, repository.ErrFederatedIdentityNotFound) {
+		h.createFailedSAMLLoginAuditLog(deviceInfo, "saml_identity_not_linked", conn)
+		return nil, fmt.Errorf("NameID %q isn't linked to a user", assertion.NameID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return h.getUser(link.UserID)
+}
+
+// resolveSAMLUser returns the user an assertion vouches for. The NameID is
+// linked to a user once: to the organization's member with the asserted
+// email, or to a new member when the connection provisions users. Users of
+// other organizations are never linked, as the identity provider only
+// speaks for its own organization.
+func (h *AuthHandler) resolveSAMLUser(conn *models.SAMLConnection, assertion *saml.Assertion, deviceInfo *pb.DeviceInfo) (*models.User, error) {
+	providerName := samlProviderName(conn.OrganizationID)
+	if len(assertion.NameID) > maxSAMLNameIDLength {
+		h.createFailedSAMLLoginAuditLog(deviceInfo, "saml_name_id_too_long", conn)
+		return nil, errors.New("NameID is too long")
+	}
+
+	email := assertion.NameID
+	if conn.EmailAttribute != nil {
+		email = assertion.Attribute(*conn.EmailAttribute)
+	}
+	email = strings.TrimSpace(email)
+	fullName := ""
+	if conn.NameAttribute != nil {
+		fullName = strings.TrimSpace(assertion.Attribute(*conn.NameAttribute))
+	}
+
+	var user *models.User
+	created := false
+	link, err := h.repo.GetFederatedIdentity(providerName, assertion.NameID)
+	switch {
+	case err == nil:
+		if err := h.repo.UpdateFederatedIdentityLastLogin(link.ID); err != nil {
+			log.Printf("Failed to update federated identity: %v", err)
+		}
+		if user, err = h.getUser(link.UserID); err != nil {
+			return nil, err
+		}
+
+	case errors.Is(err, repository.ErrFederatedIdentityNotFound):
+		if !strings.Contains(email, "@") {
+			h.createFailedSAMLLoginAuditLog(deviceInfo, "saml_email_missing", conn)
+			return nil, errors.New("assertion carries no email address")
+		}
+
+		user, err = h.repo.GetUserByEmail(email)
+		if errors.Is(err, repository.ErrUserNotFound) {
+			if !conn.JITProvisioning {
+				h.createFailedSAMLLoginAuditLog(deviceInfo, "saml_user_not_provisioned", conn)
+				return nil, fmt.Errorf("no user for %s and provisioning is off", email)
+			}
+			user, err = h.createFederatedUser(providerName, email, fullName, conn.OrganizationID, deviceInfo)
+			created = true
+		}
+		if err != nil {
+			return nil, err
+		}
+		if user.OrganizationID != conn.OrganizationID {
+			h.createFailedSAMLLoginAuditLog(deviceInfo, "saml_user_outside_organization", conn)
+			return nil, fmt.Errorf("user %s isn't a member of %s", user.ID, conn.OrganizationID)
+		}
+
+		if user, err = h.linkFederatedIdentity(providerName, assertion.NameID, email, user, created, deviceInfo); err != nil {
+			return nil, err
+		}
+
+	default:
+		return nil, err
+	}
+
+	// Members moved to another organization no longer sign in through this one
+	if user.OrganizationID != conn.OrganizationID {
+		h.createFailedSAMLLoginAuditLog(deviceInfo, "saml_user_outside_organization", conn)
+		return nil, fmt.Errorf("user %s isn't a member of %s", user.ID, conn.OrganizationID)
+	}
+
+	// The identity provider is the source of truth for the mapped name
+	if fullName != "" && fullName != user.FullName && !created {
+		user.FullName = fullName
+		if err := h.repo.UpdateUser(user); err != nil {
+			log.Printf("Failed to update name from SAML assertion: %v", err)
+		}
+	}
+
+	return user, nil
+}
+
+// getSAMLConnection returns the enabled SAML connection a SAML provider
+// name refers to, for finishing a login
+func (h *AuthHandler) getSAMLConnection(providerName string) (*models.SAMLConnection, error) {
+	organizationID := strings.TrimPrefix(providerName, samlProviderPrefix)
+	if h.saml == nil {
+		return nil, grpcerr.FailedPrecondition("SAML login is not enabled", reasonSAMLDisabled)
+	}
+	if _, err := uuid.Parse(organizationID); err != nil {
+		return nil, grpcerr.InvalidArgument("Unknown identity provider", grpcerr.Field("provider", "is not configured"))
+	}
+
+	conn, err := h.repo.GetSAMLConnection(organizationID)
+	if errors.Is(err, repository.ErrSAMLConnectionNotFound) || err == nil && !conn.Enabled {
+		return nil, grpcerr.InvalidArgument("Unknown identity provider", grpcerr.Field("provider", "is not configured"))
+	}
+	if err != nil {
+		log.Printf("Failed to get SAML connection: %v", err)
+		return nil, grpcerr.Storage("Login failed", err)
+	}
+
+	return conn, nil
+}
+
+// redirectSAMLLogin sends the browser back to the frontend's login page
+func (h *AuthHandler) redirectSAMLLogin(w http.ResponseWriter, r *http.Request, query url.Values) {
+	redirectURL, err := url.Parse(h.saml.LoginRedirectURL)
+	if err != nil {
+		log.Printf("Invalid SAML login redirect URL: %v", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	values := redirectURL.Query()
+	for key, value := range query {
+		values[key] = value
+	}
+	redirectURL.RawQuery = values.Encode()
+
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, redirectURL.String(), http.StatusSeeOther)
+}
+
+// createFailedSAMLLoginAuditLog records a refused SAML response, tagged with
+// the identity provider once it is known
+func (h *AuthHandler) createFailedSAMLLoginAuditLog(deviceInfo *pb.DeviceInfo, reason string, conn *models.SAMLConnection) {
+	var metadataStr *string
+	if conn != nil {
+		metadata, _ := json.Marshal(map[string]string{
+			"organization_id": conn.OrganizationID,
+			"idp_entity_id":   conn.IdPEntityID,
+		})
+		s := string(metadata)
+		metadataStr = &s
+	}
+
+	h.createAuditLog(&models.AuditLog{
+		ID:            uuid.New().String(),
+		EventType:     "login_failed",
+		EventCategory: "authentication",
+		Severity:      "warning",
+		IPAddress:     strPtr(deviceInfo.IpAddress),
+		UserAgent:     strPtr(deviceInfo.UserAgent),
+		Metadata:      metadataStr,
+		Success:       false,
+		FailureReason: &reason,
+		CreatedAt:     time.Now(),
+	})
+}
+
+// samlConnectionResponse builds a SAMLConnectionResponse; conn may be nil
+func (h *AuthHandler) samlConnectionResponse(message string, conn *models.SAMLConnection) *pb.SAMLConnectionResponse {
+	resp := &pb.SAMLConnectionResponse{
+		Success:       true,
+		Message:       message,
+		SpEntityId:    h.saml.ServiceProvider.EntityID,
+		SpAcsUrl:      h.saml.ServiceProvider.ACSURL,
+		SpMetadataUrl: h.saml.MetadataURL,
+	}
+	if conn != nil {
+		resp.Connection = samlConnectionToProto(conn)
+	}
+	return resp
+}
+
+// samlIdentityProvider returns the identity provider of a connection
+func samlIdentityProvider(conn *models.SAMLConnection) (saml.IdentityProvider, error) {
+	cert, err := saml.ParseCertificate(conn.IdPCertificate)
+	if err != nil {
+		return saml.IdentityProvider{}, err
+	}
+	return saml.IdentityProvider{
+		EntityID:    conn.IdPEntityID,
+		SSOURL:      conn.IdPSSOURL,
+		Certificate: cert,
+	}, nil
+}
+
+// samlProviderName returns the provider name of an organization's SAML logins
+func samlProviderName(organizationID string) string {
+	return samlProviderPrefix + organizationID
+}
+
+// remoteIP returns the address a request came from
+func remoteIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
+
+func samlConnectionToProto(conn *models.SAMLConnection) *pb.SAMLConnection {
+	return &pb.SAMLConnection{
+		OrganizationId:  conn.OrganizationID,
+		IdpEntityId:     conn.IdPEntityID,
+		IdpSsoUrl:       conn.IdPSSOURL,
+		IdpCertificate:  conn.IdPCertificate,
+		EmailAttribute:  stringValue(conn.EmailAttribute),
+		NameAttribute:   stringValue(conn.NameAttribute),
+		JitProvisioning: conn.JITProvisioning,
+		Enabled:         conn.Enabled,
+		CreatedBy:       stringValue(conn.CreatedBy),
+		CreatedAt:       conn.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:       conn.UpdatedAt.Format(time.RFC3339),
+	}
+}
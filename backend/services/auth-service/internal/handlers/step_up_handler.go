@@ -0,0 +1,293 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/grpcerr"
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/models"
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/oidc"
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/repository"
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/utils"
+	pb "github.com/aashiq-04/session-management-system/backend/services/auth-service/proto"
+)
+
+// Reasons reported in ErrorInfo when a user can't reauthenticate
+const (
+	reasonMFACodeRequired       = "MFA_CODE_REQUIRED"
+	reasonPasswordNotSet        = "PASSWORD_NOT_SET"        // users of a federated login use StartFederatedReauthentication instead
+	reasonFederatedUserMismatch = "FEDERATED_USER_MISMATCH" // the provider vouched for someone else
+)
+
+// reauthenticationClockSkew is how far an identity provider's clock may be
+// off when it says the user signed in again
+const reauthenticationClockSkew = time.Minute
+
+// Reauthenticate has a signed-in user prove who they are again, with their
+// password and their MFA code if MFA is enabled, before a sensitive
+// operation. Users of a federated login sign in again with their identity
+// provider instead of giving a password, starting with
+// StartFederatedReauthentication. The access token it returns says the user
+// authenticated just now and expires after utils.ReauthenticatedTokenTTL;
+// the session and its refresh token are left as they are.
+func (h *AuthHandler) Reauthenticate(ctx context.Context, req *pb.ReauthenticateRequest) (*pb.ReauthenticateResponse, error) {
+	log.Printf("Reauthenticate request received for user: %s", req.UserId)
+
+	if req.Password == "" && req.Provider == "" {
+		return nil, grpcerr.InvalidArgument("Password is required", grpcerr.Field("password", "is required"))
+	}
+
+	ip := req.IpAddress
+	if ip == "" {
+		ip = getIPFromContext(ctx)
+	}
+
+	user, err := h.getUser(req.UserId)
+	if err != nil {
+		return nil, err
+	}
+	if !user.IsActive || user.DeletedAt != nil {
+		return nil, grpcerr.PermissionDenied("Account is inactive", reasonAccountInactive)
+	}
+
+	var amr []string
+	var loginState *models.FederatedLoginState
+	if req.Provider != "" {
+		if loginState, err = h.claimFederatedReauthentication(ctx, user, req, ip); err != nil {
+			return nil, err
+		}
+		amr = []string{utils.AMRFederated}
+	} else {
+		if user.PasswordHash == federatedPasswordHash {
+			return nil, grpcerr.FailedPrecondition("Sign in again with your identity provider to continue", reasonPasswordNotSet)
+		}
+		if err := utils.ComparePassword(user.PasswordHash, req.Password); err != nil {
+			h.recordReauthentication(user, req, ip, nil, "invalid_password")
+			return nil, grpcerr.Unauthenticated("Invalid password", reasonInvalidCredentials)
+		}
+		amr = []string{utils.AMRPassword}
+	}
+
+	if user.MFAEnabled {
+		// Asking for the code is a step of reauthenticating, but the
+		// password was right, so the client only has to send both again.
+		// A federated login is kept open for the code, like at sign-in.
+		if req.MfaCode == "" {
+			if loginState != nil {
+				loginState.UserID = &user.ID
+				loginState.ExpiresAt = time.Now().Add(federatedLoginTTL)
+				if err := h.repo.SaveFederatedLoginState(loginState); err != nil {
+					log.Printf("Failed to save federated login state: %v", err)
+					return nil, grpcerr.Storage("Failed to reauthenticate", err)
+				}
+			}
+			return nil, grpcerr.Unauthenticated("MFA code required", reasonMFACodeRequired)
+		}
+		if user.MFASecret == nil {
+			log.Printf("MFA secret not found for user: %s", user.ID)
+			return nil, grpcerr.Internal("MFA configuration error")
+		}
+		if !utils.ValidateMFACode(req.MfaCode, *user.MFASecret) {
+			h.recordReauthentication(user, req, ip, nil, "invalid_mfa_code")
+			return nil, grpcerr.Unauthenticated("Invalid MFA code", reasonInvalidMFACode)
+		}
+		amr = append(amr, utils.AMRMFA)
+	}
+
+	// The policies that apply to signing in apply here too. A step-up is
+	// already met by the MFA code, which users without MFA can't give.
+	org, err := h.getOrganization(user.OrganizationID)
+	if err != nil {
+		return nil, err
+	}
+	violation, err := h.checkSignInLocation(org, user, ip, "")
+	if err != nil {
+		return nil, err
+	}
+	if violation != nil && (violation.action != models.AccessPolicyStepUp || !user.MFAEnabled) {
+		h.recordPolicyViolation(user, nil, stageReauthentication, ip, "", violation, outcomeBlocked)
+		h.recordReauthentication(user, req, ip, nil, violation.failureReason)
+		return nil, grpcerr.PermissionDenied(violation.message, violation.reason)
+	}
+
+	roles, permissions, err := h.getUserAuthorization(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	expiresAt := time.Now().Add(utils.ReauthenticatedTokenTTL)
+	accessToken, err := utils.GenerateReauthenticatedToken(user.ID, user.Email, user.OrganizationID, roles, permissions, amr, h.jwtSecret)
+	if err != nil {
+		log.Printf("Failed to generate access token: %v", err)
+		return nil, grpcerr.Internal("Failed to generate authentication token")
+	}
+
+	h.recordReauthentication(user, req, ip, amr, "")
+
+	return &pb.ReauthenticateResponse{
+		Success:     true,
+		Message:     "Reauthenticated",
+		AccessToken: accessToken,
+		ExpiresAt:   expiresAt.Format(time.RFC3339),
+		Amr:         amr,
+	}, nil
+}
+
+// StartFederatedReauthentication returns the URL that sends a signed-in
+// user of a federated login back to their identity provider, which is asked
+// to have them sign in again even with a session there. They come back with
+// a state that only Reauthenticate accepts.
+func (h *AuthHandler) StartFederatedReauthentication(ctx context.Context, req *pb.StartFederatedReauthenticationRequest) (*pb.StartFederatedReauthenticationResponse, error) {
+	log.Printf("StartFederatedReauthentication request received for user: %s", req.UserId)
+
+	user, err := h.getUser(req.UserId)
+	if err != nil {
+		return nil, err
+	}
+	if !user.IsActive || user.DeletedAt != nil {
+		return nil, grpcerr.PermissionDenied("Account is inactive", reasonAccountInactive)
+	}
+
+	var authorizationURL, state string
+	if strings.HasPrefix(req.Provider, samlProviderPrefix) {
+		conn, err := h.getSAMLConnection(req.Provider)
+		if err != nil {
+			return nil, err
+		}
+		// Only the user's own organization's identity provider speaks for them
+		if conn.OrganizationID != user.OrganizationID {
+			return nil, grpcerr.InvalidArgument("Unknown identity provider", grpcerr.Field("provider", "is not configured"))
+		}
+		authorizationURL, state, err = h.sendSAMLRequest(conn, true)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		provider, err := h.getIdentityProvider(req.Provider)
+		if err != nil {
+			return nil, err
+		}
+		authorizationURL, state, err = h.sendFederatedLogin(ctx, provider, true)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &pb.StartFederatedReauthenticationResponse{
+		Success:          true,
+		Message:          "Redirect the user to the identity provider",
+		AuthorizationUrl: authorizationURL,
+		State:            state,
+	}, nil
+}
+
+// claimFederatedReauthentication finishes the login a user started with
+// StartFederatedReauthentication and returns its state. The provider must
+// vouch for the user themselves, through an identity already linked to
+// them, and must have signed them in again.
+func (h *AuthHandler) claimFederatedReauthentication(ctx context.Context, user *models.User, req *pb.ReauthenticateRequest, ip string) (*models.FederatedLoginState, error) {
+	var provider *oidc.Provider
+	var err error
+	if strings.HasPrefix(req.Provider, samlProviderPrefix) {
+		_, err = h.getSAMLConnection(req.Provider)
+	} else {
+		provider, err = h.getIdentityProvider(req.Provider)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if req.State == "" {
+		return nil, grpcerr.InvalidArgument("State is required", grpcerr.Field("state", "is required"))
+	}
+
+	// Each state is used once, and only for reauthenticating
+	expired := grpcerr.Unauthenticated("Reauthentication expired or was already used, please start again", reasonInvalidFederatedState)
+	loginState, err := h.repo.ClaimFederatedLoginState(hashFederatedState(req.State), req.Provider)
+	if errors.Is(err, repository.ErrFederatedLoginStateNotFound) {
+		return nil, expired
+	}
+	if err != nil {
+		log.Printf("Failed to claim federated login state: %v", err)
+		return nil, grpcerr.Storage("Failed to reauthenticate", err)
+	}
+	if !loginState.Reauthentication {
+		return nil, expired
+	}
+
+	// The assertion consumer service, or an earlier request that was asked
+	// for the MFA code, already found who the provider vouched for
+	userID := ""
+	switch {
+	case loginState.UserID != nil:
+		userID = *loginState.UserID
+	case provider == nil:
+		return nil, expired
+	default:
+		if req.Code == "" {
+			return nil, grpcerr.InvalidArgument("Code is required", grpcerr.Field("code", "is required"))
+		}
+		account, err := provider.ExchangeReauthentication(ctx, req.Code, loginState.CodeVerifier, loginState.Nonce, loginState.CreatedAt)
+		if errors.Is(err, oidc.ErrProviderRejected) {
+			log.Printf("Reauthentication with %s rejected: %v", provider.Name(), err)
+			h.recordReauthentication(user, req, ip, nil, "federated_login_rejected")
+			return nil, grpcerr.Unauthenticated("Sign-in with the identity provider failed", reasonFederatedLoginFailed)
+		}
+		if err != nil {
+			log.Printf("Failed to reauthenticate with %s: %v", provider.Name(), err)
+			return nil, grpcerr.Unavailable("Identity provider is unavailable", identityProviderRetryDelay)
+		}
+
+		link, err := h.repo.GetFederatedIdentity(provider.Name(), account.Subject)
+		if err != nil && !errors.Is(err, repository.ErrFederatedIdentityNotFound) {
+			log.Printf("Failed to get federated identity: %v", err)
+			return nil, grpcerr.Storage("Failed to reauthenticate", err)
+		}
+		if link != nil {
+			userID = link.UserID
+		}
+	}
+
+	if userID != user.ID {
+		h.recordReauthentication(user, req, ip, nil, "federated_user_mismatch")
+		return nil, grpcerr.Unauthenticated("Sign in with the identity linked to your account", reasonFederatedUserMismatch)
+	}
+	return loginState, nil
+}
+
+// recordReauthentication audits an attempt to reauthenticate. An empty
+// failureReason records a success with the methods the user proved.
+func (h *AuthHandler) recordReauthentication(user *models.User, req *pb.ReauthenticateRequest, ip string, amr []string, failureReason string) {
+	entry := &models.AuditLog{
+		ID:            uuid.New().String(),
+		UserID:        &user.ID,
+		EventType:     "user_reauthenticated",
+		EventCategory: "authentication",
+		Severity:      "info",
+		IPAddress:     strPtr(ip),
+		UserAgent:     strPtr(req.UserAgent),
+		Success:       true,
+		CreatedAt:     time.Now(),
+	}
+	if failureReason != "" {
+		entry.EventType = "reauthentication_failed"
+		entry.Severity = "warning"
+		entry.Success = false
+		entry.FailureReason = &failureReason
+	} else {
+		values := map[string]interface{}{"amr": amr}
+		if req.Provider != "" {
+			values["provider"] = req.Provider
+		}
+		metadata, _ := json.Marshal(values)
+		metadataStr := string(metadata)
+		entry.Metadata = &metadataStr
+	}
+
+	h.createAuditLog(entry)
+}
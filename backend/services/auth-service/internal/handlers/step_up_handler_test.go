@@ -0,0 +1,405 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/pquerna/otp/totp"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/models"
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/oidc/oidctest"
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/saml"
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/utils"
+	pb "github.com/aashiq-04/session-management-system/backend/services/auth-service/proto"
+)
+
+const testJWTSecret = "test-jwt-secret"
+
+// reauthUser is the user reauthenticating in these tests
+type reauthUser struct {
+	passwordHash string
+	mfaSecret    *string
+}
+
+func (u reauthUser) row() *sqlmock.Rows {
+	now := time.Now()
+	return sqlmock.NewRows(userColumns).
+		AddRow("user-1", "alice@example.com", u.passwordHash, "Alice", true, u.mfaSecret != nil, u.mfaSecret,
+			"org-1", now, now, now, nil, nil)
+}
+
+func expectUser(mock sqlmock.Sqlmock, user reauthUser) {
+	mock.ExpectQuery(regexp.QuoteMeta("FROM users")).
+		WithArgs("user-1").
+		WillReturnRows(user.row())
+}
+
+var loginStateColumns = []string{
+	"state_hash", "provider", "code_verifier", "nonce", "user_id", "reauthentication", "expires_at", "created_at",
+}
+
+// expectClaimLoginState hands out the pending login of state
+func expectClaimLoginState(mock sqlmock.Sqlmock, state, provider string, userID interface{}, reauthentication bool, createdAt time.Time) {
+	mock.ExpectQuery(regexp.QuoteMeta("DELETE FROM federated_login_states")).
+		WithArgs(hashFederatedState(state), provider, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows(loginStateColumns).
+			AddRow(hashFederatedState(state), provider, "verifier-1", "nonce-1", userID, reauthentication,
+				createdAt.Add(federatedLoginTTL), createdAt))
+}
+
+func expectLinkedIdentity(mock sqlmock.Sqlmock, subject, userID string) {
+	mock.ExpectQuery(regexp.QuoteMeta("FROM federated_identities")).
+		WithArgs("corp", subject).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "provider", "subject", "email", "created_at", "last_login_at"}).
+			AddRow("link-1", userID, "corp", subject, subject+"@example.com", time.Now(), nil))
+}
+
+// expectReauthenticated expects the checks after the user proved who they
+// are: the organization's policies, none of which apply, their roles and
+// the audit event
+func expectReauthenticated(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery(regexp.QuoteMeta("FROM organizations")).
+		WithArgs("org-1").
+		WillReturnRows(sqlmock.NewRows([]string{
+			"id", "name", "slug", "mfa_required", "session_lifetime_seconds",
+			"allowed_countries", "ip_allowlist", "created_at", "updated_at",
+		}).AddRow("org-1", "Acme", "acme", false, 3600, "{}", "{}", time.Now(), time.Now()))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM access_policies")).
+		WithArgs("org-1", "user-1").
+		WillReturnRows(sqlmock.NewRows([]string{
+			"id", "organization_id", "user_id", "name", "ip_allowlist", "ip_denylist",
+			"country_allowlist", "country_denylist", "action", "created_by", "created_at", "updated_at",
+		}))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM users u")).
+		WithArgs("user-1").
+		WillReturnRows(sqlmock.NewRows([]string{"roles", "permissions"}).AddRow("{user}", "{}"))
+	expectAuditEvent(mock, "user_reauthenticated")
+}
+
+// checkReauthenticatedToken checks the access token says the user
+// authenticated just now with amr
+func checkReauthenticatedToken(t *testing.T, resp *pb.ReauthenticateResponse, amr ...string) {
+	t.Helper()
+
+	claims, err := utils.ValidateToken(resp.AccessToken, testJWTSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.UserID != "user-1" {
+		t.Errorf("token is for %q, want user-1", claims.UserID)
+	}
+	if time.Since(time.Unix(claims.AuthTime, 0)) > time.Minute {
+		t.Errorf("auth_time %d isn't recent", claims.AuthTime)
+	}
+	if !slices.Equal(claims.AMR, amr) || !slices.Equal(resp.Amr, amr) {
+		t.Errorf("amr = %v in the token and %v in the response, want %v", claims.AMR, resp.Amr, amr)
+	}
+}
+
+func newStepUpTestHandler(t *testing.T) (*AuthHandler, *oidctest.Provider, sqlmock.Sqlmock) {
+	t.Helper()
+
+	h, _, idp, mock := newFederatedTestHandler(t)
+	h.jwtSecret = testJWTSecret
+	return h, idp, mock
+}
+
+func TestReauthenticateWithPassword(t *testing.T) {
+	hash, err := utils.HashPassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := "JBSWY3DPEHPK3PXP"
+
+	t.Run("without MFA", func(t *testing.T) {
+		h, _, mock := newStepUpTestHandler(t)
+		expectUser(mock, reauthUser{passwordHash: hash})
+		expectReauthenticated(mock)
+
+		resp, err := h.Reauthenticate(context.Background(), &pb.ReauthenticateRequest{UserId: "user-1", Password: "correct horse"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkReauthenticatedToken(t, resp, utils.AMRPassword)
+	})
+
+	t.Run("with MFA", func(t *testing.T) {
+		h, _, mock := newStepUpTestHandler(t)
+		expectUser(mock, reauthUser{passwordHash: hash, mfaSecret: &secret})
+		expectReauthenticated(mock)
+
+		code, err := totp.GenerateCode(secret, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := h.Reauthenticate(context.Background(), &pb.ReauthenticateRequest{UserId: "user-1", Password: "correct horse", MfaCode: code})
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkReauthenticatedToken(t, resp, utils.AMRPassword, utils.AMRMFA)
+	})
+
+	t.Run("MFA code missing", func(t *testing.T) {
+		h, _, mock := newStepUpTestHandler(t)
+		expectUser(mock, reauthUser{passwordHash: hash, mfaSecret: &secret})
+
+		_, err := h.Reauthenticate(context.Background(), &pb.ReauthenticateRequest{UserId: "user-1", Password: "correct horse"})
+		if reason := errorReason(err); reason != reasonMFACodeRequired {
+			t.Errorf("reason = %q, want %s", reason, reasonMFACodeRequired)
+		}
+	})
+
+	t.Run("wrong password", func(t *testing.T) {
+		h, _, mock := newStepUpTestHandler(t)
+		expectUser(mock, reauthUser{passwordHash: hash})
+		expectAuditEvent(mock, "reauthentication_failed")
+
+		_, err := h.Reauthenticate(context.Background(), &pb.ReauthenticateRequest{UserId: "user-1", Password: "wrong"})
+		if reason := errorReason(err); reason != reasonInvalidCredentials {
+			t.Errorf("reason = %q, want %s", reason, reasonInvalidCredentials)
+		}
+	})
+
+	t.Run("user of a federated login", func(t *testing.T) {
+		h, _, mock := newStepUpTestHandler(t)
+		expectUser(mock, reauthUser{passwordHash: federatedPasswordHash})
+
+		_, err := h.Reauthenticate(context.Background(), &pb.ReauthenticateRequest{UserId: "user-1", Password: "anything"})
+		if reason := errorReason(err); reason != reasonPasswordNotSet {
+			t.Errorf("reason = %q, want %s", reason, reasonPasswordNotSet)
+		}
+	})
+}
+
+func TestStartFederatedReauthentication(t *testing.T) {
+	h, idp, mock := newStepUpTestHandler(t)
+	expectUser(mock, reauthUser{passwordHash: federatedPasswordHash})
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM federated_login_states")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO federated_login_states")).
+		WithArgs(sqlmock.AnyArg(), "corp", sqlmock.AnyArg(), sqlmock.AnyArg(), nil, true, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	resp, err := h.StartFederatedReauthentication(context.Background(), &pb.StartFederatedReauthenticationRequest{UserId: "user-1", Provider: "corp"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(resp.AuthorizationUrl, idp.URL+"/authorize?") {
+		t.Errorf("authorization URL %s isn't the provider's", resp.AuthorizationUrl)
+	}
+	authURL, err := url.Parse(resp.AuthorizationUrl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if authURL.Query().Get("prompt") != "login" || authURL.Query().Get("state") != resp.State {
+		t.Errorf("authorization URL %s doesn't ask for a new login with the state", resp.AuthorizationUrl)
+	}
+}
+
+func TestStartFederatedReauthenticationRejectsAnotherOrganizationsSAML(t *testing.T) {
+	h, _, mock := newStepUpTestHandler(t)
+	h.saml = &SAMLConfig{}
+	expectUser(mock, reauthUser{passwordHash: federatedPasswordHash})
+	mock.ExpectQuery(regexp.QuoteMeta("FROM saml_connections")).
+		WillReturnRows(sqlmock.NewRows([]string{
+			"organization_id", "idp_entity_id", "idp_sso_url", "idp_certificate",
+			"email_attribute", "name_attribute", "jit_provisioning", "enabled", "created_by", "created_at", "updated_at",
+		}).AddRow("00000000-0000-0000-0000-000000000002", "https://idp.example.com", "https://idp.example.com/sso", "cert",
+			nil, nil, false, true, nil, time.Now(), time.Now()))
+
+	_, err := h.StartFederatedReauthentication(context.Background(), &pb.StartFederatedReauthenticationRequest{
+		UserId:   "user-1",
+		Provider: samlProviderName("00000000-0000-0000-0000-000000000002"),
+	})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("err = %v, want InvalidArgument", err)
+	}
+}
+
+func TestReauthenticateWithIdentityProvider(t *testing.T) {
+	freshLogin := func(idp *oidctest.Provider, subject string, authTime time.Time) string {
+		claims := idp.Claims(subject, "nonce-1")
+		claims["auth_time"] = authTime.Unix()
+		return idp.IssueCode(idp.Sign(t, claims))
+	}
+
+	t.Run("signed in again", func(t *testing.T) {
+		h, idp, mock := newStepUpTestHandler(t)
+		started := time.Now().Add(-time.Minute)
+		expectUser(mock, reauthUser{passwordHash: federatedPasswordHash})
+		expectClaimLoginState(mock, "state-1", "corp", nil, true, started)
+		expectLinkedIdentity(mock, "alice", "user-1")
+		expectReauthenticated(mock)
+
+		resp, err := h.Reauthenticate(context.Background(), &pb.ReauthenticateRequest{
+			UserId: "user-1", Provider: "corp", State: "state-1", Code: freshLogin(idp, "alice", time.Now()),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkReauthenticatedToken(t, resp, utils.AMRFederated)
+	})
+
+	t.Run("signed in before the reauthentication started", func(t *testing.T) {
+		h, idp, mock := newStepUpTestHandler(t)
+		started := time.Now().Add(-time.Minute)
+		expectUser(mock, reauthUser{passwordHash: federatedPasswordHash})
+		expectClaimLoginState(mock, "state-1", "corp", nil, true, started)
+		expectAuditEvent(mock, "reauthentication_failed")
+
+		_, err := h.Reauthenticate(context.Background(), &pb.ReauthenticateRequest{
+			UserId: "user-1", Provider: "corp", State: "state-1", Code: freshLogin(idp, "alice", started.Add(-time.Hour)),
+		})
+		if reason := errorReason(err); reason != reasonFederatedLoginFailed {
+			t.Errorf("reason = %q, want %s", reason, reasonFederatedLoginFailed)
+		}
+	})
+
+	t.Run("identity of another user", func(t *testing.T) {
+		h, idp, mock := newStepUpTestHandler(t)
+		expectUser(mock, reauthUser{passwordHash: federatedPasswordHash})
+		expectClaimLoginState(mock, "state-1", "corp", nil, true, time.Now())
+		expectLinkedIdentity(mock, "mallory", "user-2")
+		expectAuditEvent(mock, "reauthentication_failed")
+
+		_, err := h.Reauthenticate(context.Background(), &pb.ReauthenticateRequest{
+			UserId: "user-1", Provider: "corp", State: "state-1", Code: freshLogin(idp, "mallory", time.Now()),
+		})
+		if reason := errorReason(err); reason != reasonFederatedUserMismatch {
+			t.Errorf("reason = %q, want %s", reason, reasonFederatedUserMismatch)
+		}
+	})
+
+	t.Run("unlinked identity", func(t *testing.T) {
+		h, idp, mock := newStepUpTestHandler(t)
+		expectUser(mock, reauthUser{passwordHash: federatedPasswordHash})
+		expectClaimLoginState(mock, "state-1", "corp", nil, true, time.Now())
+		expectNoFederatedIdentity(mock, "stranger")
+		expectAuditEvent(mock, "reauthentication_failed")
+
+		_, err := h.Reauthenticate(context.Background(), &pb.ReauthenticateRequest{
+			UserId: "user-1", Provider: "corp", State: "state-1", Code: freshLogin(idp, "stranger", time.Now()),
+		})
+		if reason := errorReason(err); reason != reasonFederatedUserMismatch {
+			t.Errorf("reason = %q, want %s", reason, reasonFederatedUserMismatch)
+		}
+	})
+
+	t.Run("state of a login", func(t *testing.T) {
+		h, idp, mock := newStepUpTestHandler(t)
+		expectUser(mock, reauthUser{passwordHash: federatedPasswordHash})
+		expectClaimLoginState(mock, "state-1", "corp", nil, false, time.Now())
+
+		_, err := h.Reauthenticate(context.Background(), &pb.ReauthenticateRequest{
+			UserId: "user-1", Provider: "corp", State: "state-1", Code: freshLogin(idp, "alice", time.Now()),
+		})
+		if reason := errorReason(err); reason != reasonInvalidFederatedState {
+			t.Errorf("reason = %q, want %s", reason, reasonInvalidFederatedState)
+		}
+	})
+
+	t.Run("MFA code asked for", func(t *testing.T) {
+		h, idp, mock := newStepUpTestHandler(t)
+		secret := "JBSWY3DPEHPK3PXP"
+		expectUser(mock, reauthUser{passwordHash: federatedPasswordHash, mfaSecret: &secret})
+		expectClaimLoginState(mock, "state-1", "corp", nil, true, time.Now())
+		expectLinkedIdentity(mock, "alice", "user-1")
+		// Kept open for the code, for this user only
+		mock.ExpectExec(regexp.QuoteMeta("DELETE FROM federated_login_states")).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(regexp.QuoteMeta("INSERT INTO federated_login_states")).
+			WithArgs(hashFederatedState("state-1"), "corp", sqlmock.AnyArg(), sqlmock.AnyArg(), "user-1", true, sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		_, err := h.Reauthenticate(context.Background(), &pb.ReauthenticateRequest{
+			UserId: "user-1", Provider: "corp", State: "state-1", Code: freshLogin(idp, "alice", time.Now()),
+		})
+		if reason := errorReason(err); reason != reasonMFACodeRequired {
+			t.Fatalf("reason = %q, want %s", reason, reasonMFACodeRequired)
+		}
+
+		// The code finishes it without going back to the provider
+		expectUser(mock, reauthUser{passwordHash: federatedPasswordHash, mfaSecret: &secret})
+		expectClaimLoginState(mock, "state-1", "corp", "user-1", true, time.Now())
+		expectReauthenticated(mock)
+
+		code, err := totp.GenerateCode(secret, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := h.Reauthenticate(context.Background(), &pb.ReauthenticateRequest{
+			UserId: "user-1", Provider: "corp", State: "state-1", MfaCode: code,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkReauthenticatedToken(t, resp, utils.AMRFederated, utils.AMRMFA)
+	})
+}
+
+// A reauthentication doesn't open a session
+func TestCompleteFederatedLoginRejectsReauthentication(t *testing.T) {
+	h, _, mock := newStepUpTestHandler(t)
+	expectClaimLoginState(mock, "state-1", "corp", "user-1", true, time.Now())
+
+	_, err := h.CompleteFederatedLogin(context.Background(), &pb.CompleteFederatedLoginRequest{Provider: "corp", State: "state-1"})
+	if reason := errorReason(err); reason != reasonInvalidFederatedState {
+		t.Errorf("reason = %q, want %s", reason, reasonInvalidFederatedState)
+	}
+}
+
+func TestReauthenticatedSAMLUser(t *testing.T) {
+	conn := &models.SAMLConnection{OrganizationID: "org-1", IdPEntityID: "https://idp.example.com"}
+	request := &models.SAMLLoginRequest{RequestID: "_req1", OrganizationID: "org-1", Reauthentication: true, CreatedAt: time.Now().Add(-time.Minute)}
+	deviceInfo := &pb.DeviceInfo{IpAddress: "203.0.113.7"}
+
+	t.Run("signed in again", func(t *testing.T) {
+		h, _, mock := newStepUpTestHandler(t)
+		mock.ExpectQuery(regexp.QuoteMeta("FROM federated_identities")).
+			WithArgs(samlProviderName("org-1"), "alice@example.com").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "provider", "subject", "email", "created_at", "last_login_at"}).
+				AddRow("link-1", "user-1", samlProviderName("org-1"), "alice@example.com", nil, time.Now(), nil))
+		expectUser(mock, reauthUser{passwordHash: federatedPasswordHash})
+
+		user, err := h.reauthenticatedSAMLUser(conn, request, &saml.Assertion{NameID: "alice@example.com", AuthnInstant: time.Now()}, deviceInfo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.ID != "user-1" {
+			t.Errorf("user = %s, want user-1", user.ID)
+		}
+	})
+
+	t.Run("session at the identity provider", func(t *testing.T) {
+		h, _, mock := newStepUpTestHandler(t)
+		expectAuditEvent(mock, "login_failed")
+
+		_, err := h.reauthenticatedSAMLUser(conn, request, &saml.Assertion{NameID: "alice@example.com", AuthnInstant: request.CreatedAt.Add(-time.Hour)}, deviceInfo)
+		if err == nil {
+			t.Error("assertion from an older sign-in was accepted")
+		}
+	})
+
+	t.Run("not linked", func(t *testing.T) {
+		h, _, mock := newStepUpTestHandler(t)
+		mock.ExpectQuery(regexp.QuoteMeta("FROM federated_identities")).
+			WithArgs(samlProviderName("org-1"), "new@example.com").
+			WillReturnError(sql.ErrNoRows)
+		expectAuditEvent(mock, "login_failed")
+
+		_, err := h.reauthenticatedSAMLUser(conn, request, &saml.Assertion{NameID: "new@example.com", AuthnInstant: time.Now()}, deviceInfo)
+		if err == nil {
+			t.Error("unlinked NameID was accepted")
+		}
+	})
+}
@@ -6,37 +6,89 @@ import (
 
 // User represents a user in the system
 type User struct {
-	ID           string    `db:"id"`
-	Email        string    `db:"email"`
-	PasswordHash string    `db:"password_hash"`
-	FullName     string    `db:"full_name"`
-	IsActive     bool      `db:"is_active"`
-	MFAEnabled   bool      `db:"mfa_enabled"`
-	MFASecret    *string   `db:"mfa_secret"` // pointer to handle NULL
-	CreatedAt    time.Time `db:"created_at"`
-	UpdatedAt    time.Time `db:"updated_at"`
+	ID                  string     `db:"id"`
+	Email               string     `db:"email"`
+	PasswordHash        string     `db:"password_hash"`
+	FullName            string     `db:"full_name"`
+	IsActive            bool       `db:"is_active"`
+	MFAEnabled          bool       `db:"mfa_enabled"`
+	MFASecret           *string    `db:"mfa_secret"` // pointer to handle NULL
+	OrganizationID      string     `db:"organization_id"`
+	PasswordChangedAt   time.Time  `db:"password_changed_at"`
+	CreatedAt           time.Time  `db:"created_at"`
+	UpdatedAt           time.Time  `db:"updated_at"`
+	DeletedAt           *time.Time `db:"deleted_at"`            // set once the account is soft-deleted
+	DeletionScheduledAt *time.Time `db:"deletion_scheduled_at"` // set while a deletion the user asked for is pending
+}
+
+// UserWithRoles is a user together with the roles granted to them and the
+// permissions those roles carry
+type UserWithRoles struct {
+	User
+	Roles       []string `db:"roles"`
+	Permissions []string `db:"permissions"`
+}
+
+// Organization is a tenant that users belong to. Its policy governs how its
+// members sign in.
+type Organization struct {
+	ID                     string    `db:"id"`
+	Name                   string    `db:"name"`
+	Slug                   string    `db:"slug"`
+	MFARequired            bool      `db:"mfa_required"`
+	SessionLifetimeSeconds *int      `db:"session_lifetime_seconds"` // nil uses the default
+	AllowedCountries       []string  `db:"allowed_countries"`        // empty allows any
+	IPAllowlist            []string  `db:"ip_allowlist"`             // CIDRs; empty allows any
+	CreatedAt              time.Time `db:"created_at"`
+	UpdatedAt              time.Time `db:"updated_at"`
+}
+
+// Actions taken when a sign-in breaks an access policy
+const (
+	AccessPolicyBlock  = "block"
+	AccessPolicyStepUp = "step_up" // ask for the MFA code again
+)
+
+// AccessPolicy restricts where the members of an organization, or a single
+// member, may sign in from. Deny lists win over allow lists; empty lists
+// don't restrict.
+type AccessPolicy struct {
+	ID               string    `db:"id"`
+	OrganizationID   string    `db:"organization_id"`
+	UserID           *string   `db:"user_id"` // nil applies to every member
+	Name             string    `db:"name"`
+	IPAllowlist      []string  `db:"ip_allowlist"` // CIDRs
+	IPDenylist       []string  `db:"ip_denylist"`  // CIDRs
+	CountryAllowlist []string  `db:"country_allowlist"`
+	CountryDenylist  []string  `db:"country_denylist"`
+	Action           string    `db:"action"`
+	CreatedBy        *string   `db:"created_by"`
+	CreatedAt        time.Time `db:"created_at"`
+	UpdatedAt        time.Time `db:"updated_at"`
 }
 
 // Device represents a device that has accessed the system
 type Device struct {
-	ID                string    `db:"id"`
-	UserID            string    `db:"user_id"`
-	DeviceFingerprint string    `db:"device_fingerprint"`
-	DeviceName        *string   `db:"device_name"`
-	DeviceType        *string   `db:"device_type"`
-	OS                *string   `db:"os"`
-	Browser           *string   `db:"browser"`
-	IsTrusted         bool      `db:"is_trusted"`
-	FirstSeenAt       time.Time `db:"first_seen_at"`
-	LastSeenAt        time.Time `db:"last_seen_at"`
-	CreatedAt         time.Time `db:"created_at"`
+	ID                string     `db:"id"`
+	UserID            string     `db:"user_id"`
+	DeviceFingerprint string     `db:"device_fingerprint"`
+	DeviceName        *string    `db:"device_name"`
+	DeviceType        *string    `db:"device_type"`
+	OS                *string    `db:"os"`
+	Browser           *string    `db:"browser"`
+	IsTrusted         bool       `db:"is_trusted"`
+	TrustedUntil      *time.Time `db:"trusted_until"` // nil means trust does not expire
+	RemovedAt         *time.Time `db:"removed_at"`
+	FirstSeenAt       time.Time  `db:"first_seen_at"`
+	LastSeenAt        time.Time  `db:"last_seen_at"`
+	CreatedAt         time.Time  `db:"created_at"`
 }
 
 // Session represents an active user session
 type Session struct {
 	ID              string     `db:"id"`
 	UserID          string     `db:"user_id"`
-	DeviceID        string     `db:"device_id"`
+	DeviceID        *string    `db:"device_id"` // nil for impersonation sessions
 	RefreshToken    string     `db:"refresh_token"`
 	IPAddress       string     `db:"ip_address"`
 	UserAgent       *string    `db:"user_agent"`
@@ -48,6 +100,9 @@ type Session struct {
 	ExpiresAt       time.Time  `db:"expires_at"`
 	CreatedAt       time.Time  `db:"created_at"`
 	RevokedAt       *time.Time `db:"revoked_at"`
+	ImpersonatorID  *string    `db:"impersonator_id"` // the admin who opened the session as the user
+	AuthTime        *time.Time `db:"auth_time"`       // when the user signed in; nil for older sessions
+	AMR             []string   `db:"amr"`             // how the user signed in
 }
 
 // AuditLog represents a security event in the system
@@ -69,6 +124,23 @@ type AuditLog struct {
 	CreatedAt       time.Time  `db:"created_at"`
 }
 
+// Outbox event kinds
+const (
+	OutboxKindAuditLog      = "audit_log"
+	OutboxKindSecurityAlert = "security_alert"
+)
+
+// AuditOutboxEvent is an audit event or security alert waiting in the outbox
+// to be sent to the audit service
+type AuditOutboxEvent struct {
+	ID        string        `db:"id"`
+	Kind      string        `db:"kind"`
+	Event     AuditLog      `db:"event"` // JSON encoded, for an audit_log
+	Alert     SecurityAlert `db:"event"` // JSON encoded, for a security_alert
+	Attempts  int           `db:"attempts"`
+	CreatedAt time.Time     `db:"created_at"`
+}
+
 // MFABackupCode represents a backup code for MFA recovery
 type MFABackupCode struct {
 	ID        string     `db:"id"`
@@ -93,4 +165,154 @@ type SecurityAlert struct {
 	IsResolved      bool       `db:"is_resolved"`
 	ResolvedAt      *time.Time `db:"resolved_at"`
 	CreatedAt       time.Time  `db:"created_at"`
-}
\ No newline at end of file
+}
+// DeviceTrustToken lets a trusted device skip the MFA code at login
+type DeviceTrustToken struct {
+	ID         string     `db:"id"`
+	UserID     string     `db:"user_id"`
+	DeviceID   string     `db:"device_id"`
+	TokenHash  string     `db:"token_hash"`
+	ExpiresAt  time.Time  `db:"expires_at"`
+	LastUsedAt *time.Time `db:"last_used_at"`
+	RevokedAt  *time.Time `db:"revoked_at"`
+	CreatedAt  time.Time  `db:"created_at"`
+}
+
+// FederatedIdentity links an account at an identity provider to a user
+type FederatedIdentity struct {
+	ID          string     `db:"id"`
+	UserID      string     `db:"user_id"`
+	Provider    string     `db:"provider"`
+	Subject     string     `db:"subject"` // the provider's stable ID of the user
+	Email       *string    `db:"email"`
+	CreatedAt   time.Time  `db:"created_at"`
+	LastLoginAt *time.Time `db:"last_login_at"`
+}
+
+// FederatedLoginState is a login sent to an identity provider and not
+// finished yet
+type FederatedLoginState struct {
+	StateHash        string    `db:"state_hash"`
+	Provider         string    `db:"provider"`
+	CodeVerifier     string    `db:"code_verifier"`
+	Nonce            string    `db:"nonce"`
+	UserID           *string   `db:"user_id"`          // set once the provider vouched for the user
+	Reauthentication bool      `db:"reauthentication"` // a signed-in user signing in again, for Reauthenticate only
+	ExpiresAt        time.Time `db:"expires_at"`
+	CreatedAt        time.Time `db:"created_at"`
+}
+
+// OAuthClient is an app that signs its users in through this system
+type OAuthClient struct {
+	ID                   string    `db:"id"` // the client_id
+	OrganizationID       string    `db:"organization_id"`
+	Name                 string    `db:"name"`
+	SecretHash           *string   `db:"secret_hash"` // nil for public clients
+	RedirectURIs         []string  `db:"redirect_uris"`
+	BackchannelLogoutURI *string   `db:"backchannel_logout_uri"`
+	Scopes               []string  `db:"scopes"`
+	CreatedBy            *string   `db:"created_by"`
+	CreatedAt            time.Time `db:"created_at"`
+	UpdatedAt            time.Time `db:"updated_at"`
+}
+
+// OAuthConsent is what a user agreed to share with an app
+type OAuthConsent struct {
+	UserID     string    `db:"user_id"`
+	ClientID   string    `db:"client_id"`
+	ClientName string    `db:"client_name"`
+	Scopes     []string  `db:"scopes"`
+	CreatedAt  time.Time `db:"created_at"`
+	UpdatedAt  time.Time `db:"updated_at"`
+}
+
+// OAuthAuthorizationCode is a code handed to an app and not redeemed yet
+type OAuthAuthorizationCode struct {
+	CodeHash      string     `db:"code_hash"`
+	ClientID      string     `db:"client_id"`
+	UserID        string     `db:"user_id"`
+	SessionID     string     `db:"session_id"`
+	RedirectURI   string     `db:"redirect_uri"`
+	Scopes        []string   `db:"scopes"`
+	Nonce         *string    `db:"nonce"`
+	CodeChallenge *string    `db:"code_challenge"` // S256
+	ExpiresAt     time.Time  `db:"expires_at"`
+	CreatedAt     time.Time  `db:"created_at"`
+	RedeemedAt    *time.Time `db:"redeemed_at"`
+	FamilyID      *string    `db:"family_id"` // the refresh tokens issued for the code
+}
+
+// OAuthRefreshToken is a refresh token held by an app
+type OAuthRefreshToken struct {
+	TokenHash string     `db:"token_hash"`
+	ClientID  string     `db:"client_id"`
+	UserID    string     `db:"user_id"`
+	SessionID string     `db:"session_id"`
+	FamilyID  string     `db:"family_id"` // shared by the tokens descended from one authorization code
+	Scopes    []string   `db:"scopes"`
+	ExpiresAt time.Time  `db:"expires_at"`
+	CreatedAt time.Time  `db:"created_at"`
+	UsedAt    *time.Time `db:"used_at"`
+}
+
+// BackchannelLogout is a logout notification waiting to be sent to an app
+type BackchannelLogout struct {
+	ID        string    `db:"id"`
+	ClientID  string    `db:"client_id"`
+	LogoutURI string    `db:"backchannel_logout_uri"`
+	SessionID string    `db:"session_id"`
+	UserID    string    `db:"user_id"`
+	Attempts  int       `db:"attempts"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+// SAMLConnection is the SAML identity provider an organization's members
+// sign in with
+type SAMLConnection struct {
+	OrganizationID  string    `db:"organization_id"`
+	IdPEntityID     string    `db:"idp_entity_id"`
+	IdPSSOURL       string    `db:"idp_sso_url"`
+	IdPCertificate  string    `db:"idp_certificate"` // PEM
+	EmailAttribute  *string   `db:"email_attribute"` // nil takes the email from the NameID
+	NameAttribute   *string   `db:"name_attribute"`
+	JITProvisioning bool      `db:"jit_provisioning"`
+	Enabled         bool      `db:"enabled"`
+	CreatedBy       *string   `db:"created_by"`
+	CreatedAt       time.Time `db:"created_at"`
+	UpdatedAt       time.Time `db:"updated_at"`
+}
+
+// SAMLLoginRequest is an authentication request sent to an identity
+// provider and not answered yet
+type SAMLLoginRequest struct {
+	RequestID        string    `db:"request_id"`
+	OrganizationID   string    `db:"organization_id"`
+	RelayStateHash   string    `db:"relay_state_hash"`
+	Reauthentication bool      `db:"reauthentication"` // made with ForceAuthn, for Reauthenticate
+	ExpiresAt        time.Time `db:"expires_at"`
+	CreatedAt        time.Time `db:"created_at"`
+}
+
+// Kinds of API token
+const (
+	APITokenPersonal = "personal" // made by a user for themselves
+	APITokenService  = "service"  // made by an admin for their organization
+)
+
+// APIToken is a long-lived token scripts and CI jobs call the gateway with.
+// It acts as its user, with no more than its scopes allow.
+type APIToken struct {
+	ID             string     `db:"id"`
+	Kind           string     `db:"kind"`
+	UserID         string     `db:"user_id"` // for API keys, the admin who made it
+	OrganizationID string     `db:"organization_id"`
+	Name           string     `db:"name"`
+	TokenPrefix    string     `db:"token_prefix"`
+	TokenHash      string     `db:"token_hash"`
+	Scopes         []string   `db:"scopes"`
+	ExpiresAt      time.Time  `db:"expires_at"`
+	LastUsedAt     *time.Time `db:"last_used_at"`
+	LastUsedIP     *string    `db:"last_used_ip"`
+	RevokedAt      *time.Time `db:"revoked_at"`
+	CreatedAt      time.Time  `db:"created_at"`
+}
@@ -0,0 +1,110 @@
+// Package oauthserver lets this service act as an OAuth 2.0 authorization
+// server and OpenID Connect provider for other apps: it signs and verifies
+// the tokens handed to them, checks PKCE and tells them when a session they
+// signed in with ends. The endpoints themselves are served by the handlers.
+package oauthserver
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+)
+
+// minKeyBits is the smallest RSA key accepted for signing
+const minKeyBits = 2048
+
+// SigningKey is the RSA key tokens are signed with
+type SigningKey struct {
+	private *rsa.PrivateKey
+	keyID   string
+}
+
+// jsonWebKey is the public half of the signing key as published in the JWKS
+type jsonWebKey struct {
+	KeyType   string `json:"kty"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+	N         string `json:"n"`
+	E         string `json:"e"`
+}
+
+// LoadSigningKey reads an RSA private key from a PEM file, in PKCS #8 or
+// PKCS #1 form
+func LoadSigningKey(file string) (*SigningKey, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing key: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in %s", file)
+	}
+
+	var private *rsa.PrivateKey
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		rsaKey, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("%s is not an RSA private key", file)
+		}
+		private = rsaKey
+	} else if private, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+		return nil, fmt.Errorf("failed to parse signing key: %w", err)
+	}
+
+	if private.N.BitLen() < minKeyBits {
+		return nil, fmt.Errorf("%s is shorter than %d bits", file, minKeyBits)
+	}
+
+	key := &SigningKey{private: private}
+	key.keyID = key.thumbprint()
+	return key, nil
+}
+
+// KeyID returns the key's ID, its JWK thumbprint (RFC 7638)
+func (k *SigningKey) KeyID() string {
+	return k.keyID
+}
+
+// JWKS returns the JSON Web Key Set apps verify tokens with
+func (k *SigningKey) JWKS() ([]byte, error) {
+	return json.Marshal(struct {
+		Keys []jsonWebKey `json:"keys"`
+	}{
+		Keys: []jsonWebKey{{
+			KeyType:   "RSA",
+			Use:       "sig",
+			Algorithm: "RS256",
+			KeyID:     k.keyID,
+			N:         encodeBigInt(k.private.N),
+			E:         encodeBigInt(big.NewInt(int64(k.private.E))),
+		}},
+	})
+}
+
+// thumbprint hashes the required members of the public key in lexical order
+func (k *SigningKey) thumbprint() string {
+	members, _ := json.Marshal(struct {
+		E       string `json:"e"`
+		KeyType string `json:"kty"`
+		N       string `json:"n"`
+	}{
+		E:       encodeBigInt(big.NewInt(int64(k.private.E))),
+		KeyType: "RSA",
+		N:       encodeBigInt(k.private.N),
+	})
+	sum := sha256.Sum256(members)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// encodeBigInt encodes an unsigned integer as base64url
+func encodeBigInt(n *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(n.Bytes())
+}
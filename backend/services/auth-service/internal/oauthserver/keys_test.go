@@ -0,0 +1,146 @@
+package oauthserver
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+var (
+	testRSAKeyOnce sync.Once
+	testRSAKey     *rsa.PrivateKey
+)
+
+// rsaKey returns an RSA key shared by the tests, generated once
+func rsaKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+
+	testRSAKeyOnce.Do(func() {
+		testRSAKey, _ = rsa.GenerateKey(rand.Reader, 2048)
+	})
+	if testRSAKey == nil {
+		t.Fatal("failed to generate RSA key")
+	}
+	return testRSAKey
+}
+
+// writePEM writes a PEM block to a file in a temporary directory
+func writePEM(t *testing.T, blockType string, der []byte) string {
+	t.Helper()
+
+	file := filepath.Join(t.TempDir(), "key.pem")
+	if err := os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+// testSigningKey loads the shared RSA key as a signing key
+func testSigningKey(t *testing.T) *SigningKey {
+	t.Helper()
+
+	key, err := LoadSigningKey(writePEM(t, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey(t))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestLoadSigningKey(t *testing.T) {
+	private := rsaKey(t)
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, file := range map[string]string{
+		"PKCS #1": writePEM(t, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(private)),
+		"PKCS #8": writePEM(t, "PRIVATE KEY", pkcs8),
+	} {
+		t.Run(name, func(t *testing.T) {
+			key, err := LoadSigningKey(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !key.private.Equal(private) {
+				t.Error("loaded another key")
+			}
+		})
+	}
+}
+
+func TestLoadSigningKeyRejects(t *testing.T) {
+	short, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	notPEM := filepath.Join(t.TempDir(), "key.txt")
+	if err := os.WriteFile(notPEM, []byte("not a key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		file string
+		want string
+	}{
+		{"missing file", filepath.Join(t.TempDir(), "missing.pem"), "failed to read signing key"},
+		{"not PEM", notPEM, "no PEM data found"},
+		{"not a key", writePEM(t, "PRIVATE KEY", []byte("garbage")), "failed to parse signing key"},
+		{"short key", writePEM(t, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(short)), "shorter than 2048 bits"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadSigningKey(tt.file)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	key := testSigningKey(t)
+
+	raw, err := key.JWKS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(raw, &jwks); err != nil {
+		t.Fatal(err)
+	}
+	if len(jwks.Keys) != 1 {
+		t.Fatalf("JWKS has %d keys, want 1", len(jwks.Keys))
+	}
+
+	jwk := jwks.Keys[0]
+	if jwk.KeyType != "RSA" || jwk.Use != "sig" || jwk.Algorithm != "RS256" || jwk.KeyID != key.KeyID() {
+		t.Errorf("unexpected key %+v", jwk)
+	}
+	n, _ := base64.RawURLEncoding.DecodeString(jwk.N)
+	e, _ := base64.RawURLEncoding.DecodeString(jwk.E)
+	public := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	if !public.Equal(&key.private.PublicKey) {
+		t.Error("JWKS holds another public key")
+	}
+
+	// RFC 7638: the thumbprint hashes e, kty and n in that order, without whitespace
+	sum := sha256.Sum256([]byte(`{"e":"` + jwk.E + `","kty":"RSA","n":"` + jwk.N + `"}`))
+	if want := base64.RawURLEncoding.EncodeToString(sum[:]); key.KeyID() != want {
+		t.Errorf("key ID = %s, want thumbprint %s", key.KeyID(), want)
+	}
+}
@@ -0,0 +1,152 @@
+package oauthserver
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/models"
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/repository"
+)
+
+const (
+	logoutPollInterval = 5 * time.Second
+	logoutBatchSize    = 50
+	logoutSendTimeout  = 5 * time.Second
+
+	// logoutClaimLease hides claimed notifications from other instances
+	// while they are being sent
+	logoutClaimLease = 30 * time.Second
+
+	// maxLogoutAttempts is how many times a notification is tried before it
+	// is parked as failed
+	maxLogoutAttempts = 10
+
+	maxLogoutBackoff = 5 * time.Minute
+)
+
+// LogoutNotifier sends back-channel logout tokens to the apps signed in
+// through a session once it ends. Database triggers on sessions queue the
+// notifications, so sessions revoked by any service are covered.
+type LogoutNotifier struct {
+	repo   *repository.UserRepository
+	tokens *Tokens
+	client *http.Client
+}
+
+// NewLogoutNotifier creates a new back-channel logout notifier
+func NewLogoutNotifier(db *sql.DB, tokens *Tokens) *LogoutNotifier {
+	return &LogoutNotifier{
+		repo:   repository.NewUserRepository(db),
+		tokens: tokens,
+		client: &http.Client{
+			Timeout: logoutSendTimeout,
+			// A logout URI is registered exactly; redirects aren't followed
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// Run sends queued logout notifications until ctx is cancelled
+func (n *LogoutNotifier) Run(ctx context.Context) {
+	ticker := time.NewTicker(logoutPollInterval)
+	defer ticker.Stop()
+
+	for {
+		n.notify(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// notify sends a batch of due notifications
+func (n *LogoutNotifier) notify(ctx context.Context) {
+	logouts, err := n.repo.ClaimBackchannelLogouts(logoutBatchSize, logoutClaimLease)
+	if err != nil {
+		log.Printf("Failed to claim backchannel logouts: %v", err)
+		return
+	}
+
+	for i := range logouts {
+		if ctx.Err() != nil {
+			return
+		}
+
+		logout := &logouts[i]
+		err := n.send(ctx, logout)
+		if err == nil {
+			if err := n.repo.DeleteBackchannelLogout(logout.ID); err != nil {
+				log.Printf("Failed to delete sent backchannel logout %s: %v", logout.ID, err)
+			}
+			continue
+		}
+
+		attempts := logout.Attempts + 1
+		next := time.Now().Add(backoff(attempts))
+		nextAttemptAt := &next
+		if attempts >= maxLogoutAttempts {
+			nextAttemptAt = nil
+			log.Printf("Backchannel logout of session %s to client %s failed, giving up: %v", logout.SessionID, logout.ClientID, err)
+		} else {
+			log.Printf("Backchannel logout of session %s to client %s failed (attempt %d): %v", logout.SessionID, logout.ClientID, attempts, err)
+		}
+		if err := n.repo.MarkBackchannelLogoutFailed(logout.ID, err.Error(), nextAttemptAt); err != nil {
+			log.Printf("Failed to record backchannel logout attempt %s: %v", logout.ID, err)
+		}
+	}
+}
+
+// send posts a logout token to the client's back-channel logout URI
+func (n *LogoutNotifier) send(ctx context.Context, logout *models.BackchannelLogout) error {
+	token, err := n.tokens.SignLogoutToken(logout.ClientID, logout.UserID, logout.SessionID)
+	if err != nil {
+		return err
+	}
+
+	sendCtx, cancel := context.WithTimeout(ctx, logoutSendTimeout)
+	defer cancel()
+
+	form := url.Values{"logout_token": {token}}
+	req, err := http.NewRequestWithContext(sendCtx, http.MethodPost, logout.LogoutURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to build logout request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach client: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("client returned status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// backoff returns the delay before the next attempt after the given number of failures
+func backoff(attempts int) time.Duration {
+	delay := time.Second
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= maxLogoutBackoff {
+			return maxLogoutBackoff
+		}
+	}
+	return delay
+}
@@ -0,0 +1,167 @@
+package oauthserver
+
+import (
+	"context"
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/models"
+)
+
+// newTestNotifier returns a notifier on a mock database, which fails the test
+// on any statement not expected of it
+func newTestNotifier(t *testing.T) (*LogoutNotifier, sqlmock.Sqlmock) {
+	t.Helper()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+		db.Close()
+	})
+
+	return NewLogoutNotifier(db, NewTokens(testIssuer, testSigningKey(t))), mock
+}
+
+// logoutReceiver is a client's back-channel logout endpoint, answering with
+// status and recording the logout tokens it gets
+type logoutReceiver struct {
+	status int
+
+	mu     sync.Mutex
+	tokens []string
+}
+
+func (r *logoutReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost || req.Header.Get("Content-Type") != "application/x-www-form-urlencoded" {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	r.mu.Lock()
+	r.tokens = append(r.tokens, req.PostFormValue("logout_token"))
+	r.mu.Unlock()
+	w.WriteHeader(r.status)
+}
+
+func testLogout(uri string) *models.BackchannelLogout {
+	return &models.BackchannelLogout{
+		ID:        "6f1c1d8e-3b7a-4c7e-9d55-0a6f1e2b3c4d",
+		ClientID:  "client-1",
+		LogoutURI: uri,
+		SessionID: "session-1",
+		UserID:    "user-1",
+		CreatedAt: time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC),
+	}
+}
+
+func TestSendLogoutToken(t *testing.T) {
+	notifier, _ := newTestNotifier(t)
+	receiver := &logoutReceiver{status: http.StatusOK}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	if err := notifier.send(context.Background(), testLogout(server.URL)); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(receiver.tokens) != 1 {
+		t.Fatalf("client got %d logout tokens, want 1", len(receiver.tokens))
+	}
+	claims := verifyLogoutToken(t, notifier.tokens.key, receiver.tokens[0])
+	if claims.Issuer != testIssuer || claims.Subject != "user-1" || claims.SessionID != "session-1" ||
+		len(claims.Audience) != 1 || claims.Audience[0] != "client-1" {
+		t.Errorf("unexpected claims %+v", claims)
+	}
+}
+
+func TestSendLogoutTokenFails(t *testing.T) {
+	redirected := &logoutReceiver{status: http.StatusOK}
+	redirectTarget := httptest.NewServer(redirected)
+	defer redirectTarget.Close()
+
+	tests := []struct {
+		name    string
+		handler http.Handler
+	}{
+		{"client error", &logoutReceiver{status: http.StatusBadRequest}},
+		{"server error", &logoutReceiver{status: http.StatusInternalServerError}},
+		{"redirect", http.RedirectHandler(redirectTarget.URL, http.StatusTemporaryRedirect)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			notifier, _ := newTestNotifier(t)
+			server := httptest.NewServer(tt.handler)
+			defer server.Close()
+
+			if err := notifier.send(context.Background(), testLogout(server.URL)); err == nil {
+				t.Error("send succeeded")
+			}
+		})
+	}
+
+	if len(redirected.tokens) != 0 {
+		t.Error("the logout token followed a redirect")
+	}
+}
+
+// retryTime matches the time of a notification's next attempt
+type retryTime struct{}
+
+func (retryTime) Match(arg driver.Value) bool {
+	next, ok := arg.(time.Time)
+	return ok && next.After(time.Now())
+}
+
+func TestNotify(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		attempts int
+		sent     bool
+		parked   bool // marked failed rather than retried
+	}{
+		{"delivered", http.StatusOK, 0, true, false},
+		{"rejected", http.StatusServiceUnavailable, 0, false, false},
+		{"rejected too often", http.StatusServiceUnavailable, maxLogoutAttempts - 1, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			notifier, mock := newTestNotifier(t)
+			server := httptest.NewServer(&logoutReceiver{status: tt.status})
+			defer server.Close()
+			logout := testLogout(server.URL)
+
+			mock.ExpectQuery(regexp.QuoteMeta("UPDATE backchannel_logout_outbox")).
+				WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), logoutBatchSize).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "client_id", "backchannel_logout_uri", "session_id", "user_id", "attempts", "created_at"}).
+					AddRow(logout.ID, logout.ClientID, logout.LogoutURI, logout.SessionID, logout.UserID, tt.attempts, logout.CreatedAt))
+
+			if tt.sent {
+				mock.ExpectExec(regexp.QuoteMeta("DELETE FROM backchannel_logout_outbox WHERE id = $1")).
+					WithArgs(logout.ID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			} else {
+				var nextAttemptAt driver.Value = retryTime{}
+				if tt.parked {
+					nextAttemptAt = nil
+				}
+				mock.ExpectExec(regexp.QuoteMeta("SET attempts = attempts + 1")).
+					WithArgs("client returned status 503", nextAttemptAt, logout.ID).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			}
+
+			notifier.notify(context.Background())
+		})
+	}
+}
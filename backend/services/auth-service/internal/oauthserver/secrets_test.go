@@ -0,0 +1,63 @@
+package oauthserver
+
+import (
+	"strings"
+	"testing"
+)
+
+// The example verifier and challenge from RFC 7636, appendix B
+const (
+	testVerifier  = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	testChallenge = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+)
+
+func TestVerifyCodeChallenge(t *testing.T) {
+	tests := []struct {
+		name      string
+		verifier  string
+		challenge string
+		want      bool
+	}{
+		{"S256", testVerifier, testChallenge, true},
+		{"missing verifier", "", testChallenge, false},
+		// A plain challenge is the verifier itself, which S256 never matches
+		{"plain", testVerifier, testVerifier, false},
+		{"wrong verifier", strings.Repeat("a", 43), testChallenge, false},
+		{"missing challenge", testVerifier, "", false},
+		{"short verifier", testVerifier[:42], testChallenge, false},
+		{"long verifier", strings.Repeat("a", 129), testChallenge, false},
+		{"reserved character", testVerifier[:42] + "+", testChallenge, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := VerifyCodeChallenge(tt.verifier, tt.challenge); got != tt.want {
+				t.Errorf("VerifyCodeChallenge(%q, %q) = %v, want %v", tt.verifier, tt.challenge, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSecretMatches(t *testing.T) {
+	secret, err := NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret == other {
+		t.Fatal("NewSecret returned the same secret twice")
+	}
+
+	hash := HashSecret(secret)
+	if !SecretMatches(secret, hash) {
+		t.Error("secret doesn't match its own hash")
+	}
+	if SecretMatches(other, hash) {
+		t.Error("another secret matches the hash")
+	}
+	if SecretMatches(hash, hash) {
+		t.Error("the hash matches itself")
+	}
+}
@@ -0,0 +1,194 @@
+package oauthserver
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// Scopes apps may ask for
+const (
+	ScopeOpenID  = "openid"  // required; gets an ID token
+	ScopeEmail   = "email"   // adds the user's email
+	ScopeProfile = "profile" // adds the user's name
+)
+
+// SupportedScopes are all the scopes this server knows
+var SupportedScopes = []string{ScopeOpenID, ScopeEmail, ScopeProfile}
+
+// Token lifetimes. Access and ID tokens match the service's own access
+// tokens; refresh tokens last as long as the session.
+const (
+	AccessTokenTTL = 15 * time.Minute
+	IDTokenTTL     = 15 * time.Minute
+	logoutTokenTTL = 2 * time.Minute
+)
+
+// Token types set in the typ header, so one kind of token can't be passed
+// off as another
+const (
+	typeAccessToken = "at+jwt"
+	typeLogoutToken = "logout+jwt"
+)
+
+// backchannelLogoutEvent marks a logout token (OpenID Connect Back-Channel
+// Logout 1.0)
+const backchannelLogoutEvent = "http://schemas.openid.net/event/backchannel-logout"
+
+// IDTokenClaims are the claims of an ID token. SessionID is the sessions row
+// the user signed in with.
+type IDTokenClaims struct {
+	Nonce     string `json:"nonce,omitempty"`
+	AuthTime  int64  `json:"auth_time"`
+	SessionID string `json:"sid"`
+	Email     string `json:"email,omitempty"`
+	Name      string `json:"name,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// AccessTokenClaims are the claims of an access token (RFC 9068)
+type AccessTokenClaims struct {
+	ClientID  string `json:"client_id"`
+	Scope     string `json:"scope"`
+	SessionID string `json:"sid"`
+	jwt.RegisteredClaims
+}
+
+// logoutTokenClaims are the claims of a back-channel logout token
+type logoutTokenClaims struct {
+	SessionID string              `json:"sid"`
+	Events    map[string]struct{} `json:"events"`
+	jwt.RegisteredClaims
+}
+
+// Tokens signs the tokens handed to apps
+type Tokens struct {
+	issuer string
+	key    *SigningKey
+}
+
+// NewTokens returns a signer for tokens from issuer
+func NewTokens(issuer string, key *SigningKey) *Tokens {
+	return &Tokens{issuer: strings.TrimSuffix(issuer, "/"), key: key}
+}
+
+// Issuer returns the issuer identifier, the base URL of the endpoints
+func (t *Tokens) Issuer() string {
+	return t.issuer
+}
+
+// JWKS returns the key set the tokens can be verified with
+func (t *Tokens) JWKS() ([]byte, error) {
+	return t.key.JWKS()
+}
+
+// SignIDToken signs an ID token for a client. The issuer, audience and
+// times are filled in.
+func (t *Tokens) SignIDToken(clientID string, claims *IDTokenClaims) (string, error) {
+	now := time.Now()
+	claims.Issuer = t.issuer
+	claims.Audience = jwt.ClaimStrings{clientID}
+	claims.IssuedAt = jwt.NewNumericDate(now)
+	claims.ExpiresAt = jwt.NewNumericDate(now.Add(IDTokenTTL))
+	return t.sign(claims, "JWT")
+}
+
+// SignAccessToken signs an access token for a client. The issuer, audience,
+// times and ID are filled in.
+func (t *Tokens) SignAccessToken(claims *AccessTokenClaims) (string, error) {
+	now := time.Now()
+	claims.Issuer = t.issuer
+	claims.Audience = jwt.ClaimStrings{claims.ClientID}
+	claims.IssuedAt = jwt.NewNumericDate(now)
+	claims.ExpiresAt = jwt.NewNumericDate(now.Add(AccessTokenTTL))
+	claims.ID = uuid.New().String()
+	return t.sign(claims, typeAccessToken)
+}
+
+// VerifyAccessToken validates an access token this server issued
+func (t *Tokens) VerifyAccessToken(rawToken string) (*AccessTokenClaims, error) {
+	claims := &AccessTokenClaims{}
+	token, err := jwt.ParseWithClaims(rawToken, claims, func(token *jwt.Token) (interface{}, error) {
+		if typ, _ := token.Header["typ"].(string); typ != typeAccessToken {
+			return nil, fmt.Errorf("not an access token")
+		}
+		return &t.key.private.PublicKey, nil
+	},
+		jwt.WithValidMethods([]string{"RS256"}),
+		jwt.WithIssuer(t.issuer),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil || !token.Valid {
+		return nil, fmt.Errorf("invalid access token: %w", err)
+	}
+	if claims.Subject == "" || claims.SessionID == "" {
+		return nil, fmt.Errorf("access token has no subject or session")
+	}
+
+	return claims, nil
+}
+
+// SignLogoutToken signs a back-channel logout token telling a client that
+// the user's session ended
+func (t *Tokens) SignLogoutToken(clientID, userID, sessionID string) (string, error) {
+	now := time.Now()
+	return t.sign(&logoutTokenClaims{
+		SessionID: sessionID,
+		Events:    map[string]struct{}{backchannelLogoutEvent: {}},
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    t.issuer,
+			Subject:   userID,
+			Audience:  jwt.ClaimStrings{clientID},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(logoutTokenTTL)),
+			ID:        uuid.New().String(),
+		},
+	}, typeLogoutToken)
+}
+
+// sign signs claims with RS256 under the key's ID
+func (t *Tokens) sign(claims jwt.Claims, tokenType string) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = t.key.keyID
+	token.Header["typ"] = tokenType
+
+	signed, err := token.SignedString(t.key.private)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign token: %w", err)
+	}
+	return signed, nil
+}
+
+// ParseScopes splits a scope parameter, dropping repeats
+func ParseScopes(scope string) []string {
+	var scopes []string
+	for _, s := range strings.Fields(scope) {
+		if !HasScope(scopes, s) {
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes
+}
+
+// HasScope reports whether scopes holds scope
+func HasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// CoversScopes reports whether granted holds every scope in requested
+func CoversScopes(granted, requested []string) bool {
+	for _, s := range requested {
+		if !HasScope(granted, s) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,217 @@
+package oauthserver
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testIssuer = "https://auth.example.com"
+
+func TestAccessTokenRoundTrip(t *testing.T) {
+	tokens := NewTokens(testIssuer+"/", testSigningKey(t))
+
+	raw, err := tokens.SignAccessToken(&AccessTokenClaims{
+		ClientID:         "client-1",
+		Scope:            "openid email",
+		SessionID:        "session-1",
+		RegisteredClaims: jwt.RegisteredClaims{Subject: "user-1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := tokens.VerifyAccessToken(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Issuer != testIssuer || claims.Subject != "user-1" || claims.SessionID != "session-1" ||
+		claims.ClientID != "client-1" || claims.Scope != "openid email" {
+		t.Errorf("unexpected claims %+v", claims)
+	}
+	if !reflect.DeepEqual([]string(claims.Audience), []string{"client-1"}) {
+		t.Errorf("audience = %v, want client-1", claims.Audience)
+	}
+	if claims.ID == "" {
+		t.Error("access token has no ID")
+	}
+	if ttl := claims.ExpiresAt.Sub(claims.IssuedAt.Time); ttl != AccessTokenTTL {
+		t.Errorf("access token lasts %v, want %v", ttl, AccessTokenTTL)
+	}
+}
+
+func TestVerifyAccessTokenRejects(t *testing.T) {
+	key := testSigningKey(t)
+	tokens := NewTokens(testIssuer, key)
+
+	otherPrivate, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey := &SigningKey{private: otherPrivate}
+	otherKey.keyID = otherKey.thumbprint()
+
+	// accessClaims returns valid access token claims
+	accessClaims := func() *AccessTokenClaims {
+		now := time.Now()
+		return &AccessTokenClaims{
+			ClientID:  "client-1",
+			Scope:     "openid",
+			SessionID: "session-1",
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer:    testIssuer,
+				Subject:   "user-1",
+				Audience:  jwt.ClaimStrings{"client-1"},
+				IssuedAt:  jwt.NewNumericDate(now),
+				ExpiresAt: jwt.NewNumericDate(now.Add(AccessTokenTTL)),
+			},
+		}
+	}
+	sign := func(signer *Tokens, claims jwt.Claims, tokenType string) string {
+		raw, err := signer.sign(claims, tokenType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return raw
+	}
+
+	idToken, err := tokens.SignIDToken("client-1", &IDTokenClaims{
+		SessionID:        "session-1",
+		RegisteredClaims: jwt.RegisteredClaims{Subject: "user-1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	logoutToken, err := tokens.SignLogoutToken("client-1", "user-1", "session-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired := accessClaims()
+	expired.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+	noExpiry := accessClaims()
+	noExpiry.ExpiresAt = nil
+	noSession := accessClaims()
+	noSession.SessionID = ""
+	noSubject := accessClaims()
+	noSubject.Subject = ""
+	otherIssuer := accessClaims()
+	otherIssuer.Issuer = "https://evil.example.com"
+	hmac, err := jwt.NewWithClaims(jwt.SigningMethodHS256, accessClaims()).SignedString([]byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"ID token", idToken},
+		{"logout token", logoutToken},
+		{"untyped", sign(tokens, accessClaims(), "JWT")},
+		{"other issuer", sign(tokens, otherIssuer, typeAccessToken)},
+		{"other key", sign(NewTokens(testIssuer, otherKey), accessClaims(), typeAccessToken)},
+		{"HS256", hmac},
+		{"expired", sign(tokens, expired, typeAccessToken)},
+		{"no expiry", sign(tokens, noExpiry, typeAccessToken)},
+		{"no session", sign(tokens, noSession, typeAccessToken)},
+		{"no subject", sign(tokens, noSubject, typeAccessToken)},
+		{"garbage", "not.a.token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if claims, err := tokens.VerifyAccessToken(tt.token); err == nil {
+				t.Errorf("accepted %+v", claims)
+			}
+		})
+	}
+}
+
+func TestSignLogoutToken(t *testing.T) {
+	key := testSigningKey(t)
+	tokens := NewTokens(testIssuer, key)
+
+	raw, err := tokens.SignLogoutToken("client-1", "user-1", "session-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := verifyLogoutToken(t, key, raw)
+
+	if claims.Issuer != testIssuer || claims.Subject != "user-1" || claims.SessionID != "session-1" || claims.ID == "" {
+		t.Errorf("unexpected claims %+v", claims)
+	}
+	if !reflect.DeepEqual([]string(claims.Audience), []string{"client-1"}) {
+		t.Errorf("audience = %v, want client-1", claims.Audience)
+	}
+	if ttl := claims.ExpiresAt.Sub(claims.IssuedAt.Time); ttl != logoutTokenTTL {
+		t.Errorf("logout token lasts %v, want %v", ttl, logoutTokenTTL)
+	}
+}
+
+// logoutTokenPayload is a logout token as a client reads it
+type logoutTokenPayload struct {
+	logoutTokenClaims
+	Nonce *string `json:"nonce"`
+}
+
+// verifyLogoutToken checks a logout token the way a client must (OpenID
+// Connect Back-Channel Logout 1.0, section 2.6) and returns its claims
+func verifyLogoutToken(t *testing.T, key *SigningKey, raw string) *logoutTokenPayload {
+	t.Helper()
+
+	claims := &logoutTokenPayload{}
+	token, err := jwt.ParseWithClaims(raw, claims, func(token *jwt.Token) (interface{}, error) {
+		return &key.private.PublicKey, nil
+	}, jwt.WithValidMethods([]string{"RS256"}), jwt.WithExpirationRequired())
+	if err != nil {
+		t.Fatalf("invalid logout token: %v", err)
+	}
+
+	if typ := token.Header["typ"]; typ != typeLogoutToken {
+		t.Errorf("typ = %v, want %s", typ, typeLogoutToken)
+	}
+	if kid := token.Header["kid"]; kid != key.KeyID() {
+		t.Errorf("kid = %v, want %s", kid, key.KeyID())
+	}
+	if _, ok := claims.Events[backchannelLogoutEvent]; !ok || len(claims.Events) != 1 {
+		t.Errorf("events = %v, want only %s", claims.Events, backchannelLogoutEvent)
+	}
+	if claims.Nonce != nil {
+		t.Error("logout token has a nonce")
+	}
+	return claims
+}
+
+func TestScopes(t *testing.T) {
+	scopes := ParseScopes("  openid email\topenid profile ")
+	if want := []string{"openid", "email", "profile"}; !reflect.DeepEqual(scopes, want) {
+		t.Errorf("ParseScopes = %q, want %q", scopes, want)
+	}
+	if ParseScopes("") != nil {
+		t.Error("an empty scope parameter has scopes")
+	}
+
+	if !HasScope(scopes, ScopeEmail) || HasScope(scopes, "emai") {
+		t.Error("HasScope doesn't match whole scopes")
+	}
+
+	tests := []struct {
+		granted   []string
+		requested []string
+		want      bool
+	}{
+		{[]string{"openid", "email"}, []string{"openid"}, true},
+		{[]string{"openid", "email"}, []string{"email", "openid"}, true},
+		{[]string{"openid", "email"}, nil, true},
+		{[]string{"openid"}, []string{"openid", "email"}, false},
+		{nil, []string{"openid"}, false},
+	}
+	for _, tt := range tests {
+		if got := CoversScopes(tt.granted, tt.requested); got != tt.want {
+			t.Errorf("CoversScopes(%q, %q) = %v, want %v", tt.granted, tt.requested, got, tt.want)
+		}
+	}
+}
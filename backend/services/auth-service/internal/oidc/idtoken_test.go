@@ -0,0 +1,192 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/oidc/oidctest"
+)
+
+func TestVerifyIDTokenRejects(t *testing.T) {
+	mock := oidctest.NewProvider(t, testClientID)
+	kid, key := mock.SigningKey()
+
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		token func(claims jwt.MapClaims) string
+	}{
+		{"wrong issuer", func(claims jwt.MapClaims) string {
+			claims["iss"] = "https://attacker.example.com"
+			return mock.Sign(t, claims)
+		}},
+		{"wrong audience", func(claims jwt.MapClaims) string {
+			claims["aud"] = "another-client"
+			return mock.Sign(t, claims)
+		}},
+		{"several audiences without azp", func(claims jwt.MapClaims) string {
+			claims["aud"] = []string{testClientID, "another-client"}
+			return mock.Sign(t, claims)
+		}},
+		{"several audiences issued to another party", func(claims jwt.MapClaims) string {
+			claims["aud"] = []string{testClientID, "another-client"}
+			claims["azp"] = "another-client"
+			return mock.Sign(t, claims)
+		}},
+		{"expired", func(claims jwt.MapClaims) string {
+			claims["iat"] = time.Now().Add(-time.Hour).Unix()
+			claims["exp"] = time.Now().Add(-2 * clockSkew).Unix()
+			return mock.Sign(t, claims)
+		}},
+		{"no expiry", func(claims jwt.MapClaims) string {
+			delete(claims, "exp")
+			return mock.Sign(t, claims)
+		}},
+		{"issued in the future", func(claims jwt.MapClaims) string {
+			claims["iat"] = time.Now().Add(2 * clockSkew).Unix()
+			return mock.Sign(t, claims)
+		}},
+		{"nonce mismatch", func(claims jwt.MapClaims) string {
+			claims["nonce"] = "another-nonce"
+			return mock.Sign(t, claims)
+		}},
+		{"no nonce", func(claims jwt.MapClaims) string {
+			delete(claims, "nonce")
+			return mock.Sign(t, claims)
+		}},
+		{"no subject", func(claims jwt.MapClaims) string {
+			delete(claims, "sub")
+			return mock.Sign(t, claims)
+		}},
+		{"HS256 keyed with the client secret", func(claims jwt.MapClaims) string {
+			return oidctest.SignToken(t, jwt.SigningMethodHS256, []byte("client-secret"), kid, claims)
+		}},
+		{"alg none", func(claims jwt.MapClaims) string {
+			return oidctest.SignToken(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, kid, claims)
+		}},
+		{"signed by another key under the published key ID", func(claims jwt.MapClaims) string {
+			return oidctest.SignToken(t, jwt.SigningMethodES256, otherKey, kid, claims)
+		}},
+		{"unknown key ID", func(claims jwt.MapClaims) string {
+			return oidctest.SignToken(t, jwt.SigningMethodRS256, key, "key-unknown", claims)
+		}},
+		{"encryption key ID", func(claims jwt.MapClaims) string {
+			return oidctest.SignToken(t, jwt.SigningMethodRS256, key, "enc", claims)
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := newTestProvider(t, mock)
+
+			code := mock.IssueCode(tt.token(mock.Claims("alice", "nonce-1")))
+			identity, err := provider.Exchange(context.Background(), code, "verifier", "nonce-1")
+			if !errors.Is(err, ErrProviderRejected) {
+				t.Errorf("Exchange = %+v, %v; want ErrProviderRejected", identity, err)
+			}
+		})
+	}
+}
+
+func TestVerifyIDTokenAcceptsAuthorizedParty(t *testing.T) {
+	mock := oidctest.NewProvider(t, testClientID)
+	provider := newTestProvider(t, mock)
+
+	claims := mock.Claims("alice", "nonce-1")
+	claims["aud"] = []string{testClientID, "another-client"}
+	claims["azp"] = testClientID
+
+	if _, err := provider.Exchange(context.Background(), mock.IssueCode(mock.Sign(t, claims)), "verifier", "nonce-1"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestVerifyIDTokenEmailVerified(t *testing.T) {
+	mock := oidctest.NewProvider(t, testClientID)
+	provider := newTestProvider(t, mock)
+
+	tests := []struct {
+		name  string
+		value interface{}
+		want  bool
+	}{
+		{"true", true, true},
+		{"false", false, false},
+		{"string true", "true", true},
+		{"string false", "false", false},
+		{"other string", "yes", false},
+		{"missing", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := mock.Claims("alice", "nonce-1")
+			if tt.value == nil {
+				delete(claims, "email_verified")
+			} else {
+				claims["email_verified"] = tt.value
+			}
+
+			identity, err := provider.Exchange(context.Background(), mock.IssueCode(mock.Sign(t, claims)), "verifier", "nonce-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if identity.EmailVerified != tt.want {
+				t.Errorf("EmailVerified = %v, want %v", identity.EmailVerified, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	mock := oidctest.NewProvider(t, testClientID)
+	provider := newTestProvider(t, mock)
+	ctx := context.Background()
+
+	exchange := func() error {
+		_, err := provider.Exchange(ctx, mock.IssueCode(mock.Sign(t, mock.Claims("alice", "nonce-1"))), "verifier", "nonce-1")
+		return err
+	}
+
+	if err := exchange(); err != nil {
+		t.Fatal(err)
+	}
+	if err := exchange(); err != nil {
+		t.Fatal(err)
+	}
+	if n := mock.KeySetRequests(); n != 1 {
+		t.Fatalf("key set fetched %d times for two tokens signed by the same key, want 1", n)
+	}
+
+	// A key ID that isn't cached only refetches the set once the refresh
+	// interval has passed, so forged key IDs can't hammer the provider
+	mock.RotateKey(t)
+	if err := exchange(); !errors.Is(err, ErrProviderRejected) {
+		t.Fatalf("token signed by a new key verified before the key set could be refreshed: %v", err)
+	}
+	if n := mock.KeySetRequests(); n != 1 {
+		t.Fatalf("key set fetched %d times within the refresh interval, want 1", n)
+	}
+
+	provider.keys.mu.Lock()
+	provider.keys.fetchedAt = time.Now().Add(-keyRefreshInterval)
+	provider.keys.mu.Unlock()
+
+	if err := exchange(); err != nil {
+		t.Fatalf("token signed by the rotated key: %v", err)
+	}
+	if n := mock.KeySetRequests(); n != 2 {
+		t.Errorf("key set fetched %d times, want 2", n)
+	}
+}
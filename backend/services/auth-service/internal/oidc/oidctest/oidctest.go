@@ -0,0 +1,226 @@
+// Package oidctest runs a mock OpenID Connect provider for tests: discovery,
+// a key set that can be rotated, and a token endpoint that hands out
+// whatever ID token the test registered for a code.
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Provider is a mock OpenID Connect provider. Its issuer is the server URL.
+type Provider struct {
+	*httptest.Server
+	ClientID string
+
+	mu              sync.Mutex
+	discoveryIssuer string
+	keys            map[string]*rsa.PrivateKey // published in the key set, by key ID
+	signingKeyID    string
+	nextKeyID       int
+	codes           map[string]string // ID token by authorization code
+	tokenRequests   []url.Values
+	keySetRequests  int
+}
+
+// NewProvider starts a provider for a client, with one signing key
+func NewProvider(t testing.TB, clientID string) *Provider {
+	t.Helper()
+
+	p := &Provider{
+		ClientID: clientID,
+		keys:     make(map[string]*rsa.PrivateKey),
+		codes:    make(map[string]string),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", p.serveDiscovery)
+	mux.HandleFunc("/jwks", p.serveKeySet)
+	mux.HandleFunc("/token", p.serveToken)
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+
+	p.RotateKey(t)
+	return p
+}
+
+// Issuer returns the provider's issuer identifier
+func (p *Provider) Issuer() string {
+	return p.URL
+}
+
+// SetDiscoveryIssuer makes the discovery document name another issuer
+func (p *Provider) SetDiscoveryIssuer(issuer string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.discoveryIssuer = issuer
+}
+
+// RotateKey replaces the published keys with a new one, used for signing
+// from now on, and returns its key ID
+func (p *Provider) RotateKey(t testing.TB) string {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.nextKeyID++
+	kid := fmt.Sprintf("key-%d", p.nextKeyID)
+	p.keys = map[string]*rsa.PrivateKey{kid: key}
+	p.signingKeyID = kid
+	return kid
+}
+
+// SigningKey returns the current signing key and its ID
+func (p *Provider) SigningKey() (string, *rsa.PrivateKey) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.signingKeyID, p.keys[p.signingKeyID]
+}
+
+// Claims returns the claims of a valid ID token for nonce
+func (p *Provider) Claims(subject, nonce string) jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":            p.Issuer(),
+		"aud":            p.ClientID,
+		"sub":            subject,
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"nonce":          nonce,
+		"email":          subject + "@example.com",
+		"email_verified": true,
+		"name":           "Test User",
+	}
+}
+
+// Sign signs claims with the current key using RS256
+func (p *Provider) Sign(t testing.TB, claims jwt.MapClaims) string {
+	t.Helper()
+	kid, key := p.SigningKey()
+	return SignToken(t, jwt.SigningMethodRS256, key, kid, claims)
+}
+
+// SignToken signs claims with any method and key, naming kid in the header
+// when it isn't empty
+func SignToken(t testing.TB, method jwt.SigningMethod, key interface{}, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+// IssueCode returns an authorization code the token endpoint redeems for idToken
+func (p *Provider) IssueCode(idToken string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	code := fmt.Sprintf("code-%d", len(p.codes)+1)
+	p.codes[code] = idToken
+	return code
+}
+
+// TokenRequests returns the forms posted to the token endpoint so far
+func (p *Provider) TokenRequests() []url.Values {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]url.Values(nil), p.tokenRequests...)
+}
+
+// KeySetRequests returns how many times the key set was fetched
+func (p *Provider) KeySetRequests() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.keySetRequests
+}
+
+func (p *Provider) serveDiscovery(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	issuer := p.discoveryIssuer
+	p.mu.Unlock()
+	if issuer == "" {
+		issuer = p.Issuer()
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"issuer":                 issuer,
+		"authorization_endpoint": p.URL + "/authorize",
+		"token_endpoint":         p.URL + "/token",
+		"jwks_uri":               p.URL + "/jwks",
+	})
+}
+
+func (p *Provider) serveKeySet(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.keySetRequests++
+
+	keys := []map[string]string{
+		// Encryption keys must not be used to verify tokens
+		{"kty": "RSA", "kid": "enc", "use": "enc", "n": "AQAB", "e": "AQAB"},
+	}
+	for kid, key := range p.keys {
+		keys = append(keys, map[string]string{
+			"kty": "RSA",
+			"kid": kid,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		})
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"keys": keys})
+}
+
+func (p *Provider) serveToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.ParseForm() != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	p.mu.Lock()
+	p.tokenRequests = append(p.tokenRequests, r.PostForm)
+	idToken, ok := p.codes[r.PostForm.Get("code")]
+	delete(p.codes, r.PostForm.Get("code"))
+	p.mu.Unlock()
+
+	if r.PostForm.Get("client_id") != p.ClientID || !ok {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"access_token": "access-token",
+		"token_type":   "Bearer",
+		"id_token":     idToken,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
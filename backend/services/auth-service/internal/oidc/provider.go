@@ -0,0 +1,330 @@
+// Package oidc signs users in with external identity providers: OpenID
+// Connect providers such as Google or a company's own, and GitHub, which
+// only speaks OAuth 2.0. It runs the authorization code flow with PKCE and
+// validates what the provider returns; it keeps no state between the two
+// legs, which is up to the caller.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kinds of provider
+const (
+	KindOIDC   = "oidc"
+	KindGitHub = "github"
+)
+
+// GoogleIssuer is the issuer of Google accounts, used when a provider named
+// google has none configured
+const GoogleIssuer = "https://accounts.google.com"
+
+// GitHub's OAuth endpoints and API
+const (
+	githubAuthURL  = "https://github.com/login/oauth/authorize"
+	githubTokenURL = "https://github.com/login/oauth/access_token"
+	githubAPIURL   = "https://api.github.com"
+)
+
+// httpTimeout bounds every request to a provider
+const httpTimeout = 10 * time.Second
+
+// ErrProviderRejected is returned when the provider refuses the code or
+// returns something that doesn't validate
+var ErrProviderRejected = errors.New("identity provider response rejected")
+
+// Config configures a provider
+type Config struct {
+	Name         string // used in URLs and stored with linked identities
+	Kind         string // KindOIDC or KindGitHub
+	Issuer       string // OIDC only; its discovery document names the endpoints
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string // defaults to openid email profile, or read:user user:email for GitHub
+	APIURL       string   // GitHub only; overrides the API URL
+}
+
+// Identity is a user as vouched for by a provider
+type Identity struct {
+	Subject       string // stable ID of the user at the provider
+	Email         string
+	EmailVerified bool
+	Name          string
+	AuthTime      time.Time // when the user signed in at the provider; zero when it doesn't say, as GitHub doesn't
+}
+
+// Provider is a configured identity provider
+type Provider struct {
+	config Config
+	client *http.Client
+
+	mu        sync.Mutex
+	discovery *discoveryDocument
+	keys      *keySet
+}
+
+// discoveryDocument holds the parts of an OIDC discovery document used here
+type discoveryDocument struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// NewProvider returns a provider for a configuration. Discovery happens on
+// first use, so a provider that is down doesn't stop the service starting.
+func NewProvider(config Config) (*Provider, error) {
+	if config.Name == "" || config.ClientID == "" || config.RedirectURL == "" {
+		return nil, fmt.Errorf("provider %q needs a name, client ID and redirect URL", config.Name)
+	}
+
+	switch config.Kind {
+	case KindOIDC:
+		if config.Issuer == "" {
+			return nil, fmt.Errorf("provider %q needs an issuer", config.Name)
+		}
+		if len(config.Scopes) == 0 {
+			config.Scopes = []string{"openid", "email", "profile"}
+		}
+	case KindGitHub:
+		if config.APIURL == "" {
+			config.APIURL = githubAPIURL
+		}
+		if len(config.Scopes) == 0 {
+			config.Scopes = []string{"read:user", "user:email"}
+		}
+	default:
+		return nil, fmt.Errorf("provider %q has unknown kind %q", config.Name, config.Kind)
+	}
+
+	return &Provider{
+		config: config,
+		client: &http.Client{Timeout: httpTimeout},
+	}, nil
+}
+
+// Name returns the provider's name
+func (p *Provider) Name() string {
+	return p.config.Name
+}
+
+// NewLoginSecrets returns a random state, nonce and PKCE code verifier for
+// one login
+func NewLoginSecrets() (state, nonce, verifier string, err error) {
+	values := make([]string, 3)
+	for i := range values {
+		randomBytes := make([]byte, 32)
+		if _, err := rand.Read(randomBytes); err != nil {
+			return "", "", "", fmt.Errorf("failed to generate random bytes: %w", err)
+		}
+		values[i] = base64.RawURLEncoding.EncodeToString(randomBytes)
+	}
+	return values[0], values[1], values[2], nil
+}
+
+// AuthCodeURL returns where to send the user to sign in. The code challenge
+// is derived from verifier with S256.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	return p.authCodeURL(ctx, state, nonce, verifier, false)
+}
+
+// ReauthenticationURL is AuthCodeURL for a user who has to sign in again,
+// even with a session at the provider. OIDC providers are asked for a new
+// login and to say when it happened in the ID token's auth_time; GitHub
+// has no such parameters and signs in as usual.
+func (p *Provider) ReauthenticationURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	return p.authCodeURL(ctx, state, nonce, verifier, true)
+}
+
+func (p *Provider) authCodeURL(ctx context.Context, state, nonce, verifier string, reauthenticate bool) (string, error) {
+	endpoint := githubAuthURL
+	if p.config.Kind == KindOIDC {
+		doc, err := p.discover(ctx)
+		if err != nil {
+			return "", err
+		}
+		endpoint = doc.AuthorizationEndpoint
+	}
+
+	challenge := sha256.Sum256([]byte(verifier))
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.config.ClientID},
+		"redirect_uri":          {p.config.RedirectURL},
+		"scope":                 {strings.Join(p.config.Scopes, " ")},
+		"state":                 {state},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	if p.config.Kind == KindOIDC {
+		query.Set("nonce", nonce)
+		if reauthenticate {
+			query.Set("prompt", "login")
+			query.Set("max_age", "0")
+		}
+	}
+
+	separator := "?"
+	if strings.Contains(endpoint, "?") {
+		separator = "&"
+	}
+	return endpoint + separator + query.Encode(), nil
+}
+
+// Exchange redeems an authorization code and returns the identity the
+// provider vouches for. For OIDC providers the ID token must be signed by
+// the issuer, be meant for this client, be current and carry nonce.
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (*Identity, error) {
+	tokenURL := githubTokenURL
+	if p.config.Kind == KindOIDC {
+		doc, err := p.discover(ctx)
+		if err != nil {
+			return nil, err
+		}
+		tokenURL = doc.TokenEndpoint
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.config.RedirectURL},
+		"client_id":     {p.config.ClientID},
+		"client_secret": {p.config.ClientSecret},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	var tokens struct {
+		AccessToken      string `json:"access_token"`
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := p.doJSON(req, &tokens); err != nil {
+		return nil, err
+	}
+	// GitHub reports a bad code with a 200 and an error field
+	if tokens.Error != "" {
+		return nil, fmt.Errorf("%w: %s %s", ErrProviderRejected, tokens.Error, tokens.ErrorDescription)
+	}
+
+	if p.config.Kind == KindGitHub {
+		if tokens.AccessToken == "" {
+			return nil, fmt.Errorf("%w: no access token", ErrProviderRejected)
+		}
+		return p.githubIdentity(ctx, tokens.AccessToken)
+	}
+
+	if tokens.IDToken == "" {
+		return nil, fmt.Errorf("%w: no ID token", ErrProviderRejected)
+	}
+	return p.verifyIDToken(ctx, tokens.IDToken, nonce)
+}
+
+// ExchangeReauthentication is Exchange for a login sent with
+// ReauthenticationURL at since. OIDC providers must say in auth_time that
+// the user signed in after that, rather than from an older session; GitHub
+// can't say, so its logins are taken as they are.
+func (p *Provider) ExchangeReauthentication(ctx context.Context, code, verifier, nonce string, since time.Time) (*Identity, error) {
+	identity, err := p.Exchange(ctx, code, verifier, nonce)
+	if err != nil {
+		return nil, err
+	}
+	if p.config.Kind == KindOIDC {
+		if identity.AuthTime.IsZero() {
+			return nil, fmt.Errorf("%w: ID token has no auth_time", ErrProviderRejected)
+		}
+		if identity.AuthTime.Before(since.Add(-clockSkew)) {
+			return nil, fmt.Errorf("%w: user signed in at %s, before reauthenticating", ErrProviderRejected, identity.AuthTime.Format(time.RFC3339))
+		}
+	}
+	return identity, nil
+}
+
+// discover fetches and caches the issuer's discovery document
+func (p *Provider) discover(ctx context.Context) (*discoveryDocument, error) {
+	p.mu.Lock()
+	doc := p.discovery
+	p.mu.Unlock()
+	if doc != nil {
+		return doc, nil
+	}
+
+	discoveryURL := strings.TrimSuffix(p.config.Issuer, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, discoveryURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build discovery request: %w", err)
+	}
+
+	doc = &discoveryDocument{}
+	if err := p.doJSON(req, doc); err != nil {
+		return nil, fmt.Errorf("failed to discover %s: %w", p.config.Issuer, err)
+	}
+	// The issuer must be exactly the one configured, so ID tokens from
+	// another issuer at the same host aren't accepted
+	if doc.Issuer != p.config.Issuer {
+		return nil, fmt.Errorf("discovery document of %s names issuer %q", p.config.Issuer, doc.Issuer)
+	}
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.JWKSURI == "" {
+		return nil, fmt.Errorf("discovery document of %s is missing endpoints", p.config.Issuer)
+	}
+
+	p.mu.Lock()
+	p.discovery = doc
+	p.keys = newKeySet(p.client, doc.JWKSURI)
+	p.mu.Unlock()
+
+	return doc, nil
+}
+
+// doJSON sends a request and decodes a JSON response, failing on error
+// statuses other than the OAuth error responses of the token endpoint
+func (p *Provider) doJSON(req *http.Request, v interface{}) error {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach identity provider: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("failed to read identity provider response: %w", err)
+	}
+	if resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusUnauthorized {
+		return fmt.Errorf("%w: status %d: %s", ErrProviderRejected, resp.StatusCode, truncate(string(body), 200))
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("identity provider returned status %d", resp.StatusCode)
+	}
+
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("failed to decode identity provider response: %w", err)
+	}
+	return nil
+}
+
+// truncate shortens s to at most n bytes for error messages
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
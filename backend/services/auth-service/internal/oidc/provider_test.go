@@ -0,0 +1,200 @@
+package oidc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/oidc/oidctest"
+)
+
+const testClientID = "session-manager"
+
+func newTestProvider(t *testing.T, mock *oidctest.Provider) *Provider {
+	t.Helper()
+
+	provider, err := NewProvider(Config{
+		Name:         "corp",
+		Kind:         KindOIDC,
+		Issuer:       mock.Issuer(),
+		ClientID:     testClientID,
+		ClientSecret: "client-secret",
+		RedirectURL:  "https://app.example.com/auth/callback",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return provider
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	mock := oidctest.NewProvider(t, testClientID)
+	provider := newTestProvider(t, mock)
+
+	raw, err := provider.AuthCodeURL(context.Background(), "state-1", "nonce-1", "verifier-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	authURL, err := url.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(raw, mock.URL+"/authorize?") {
+		t.Errorf("authorization URL %s doesn't use the discovered endpoint", raw)
+	}
+	challenge := sha256.Sum256([]byte("verifier-1"))
+	want := map[string]string{
+		"response_type":         "code",
+		"client_id":             testClientID,
+		"redirect_uri":          "https://app.example.com/auth/callback",
+		"scope":                 "openid email profile",
+		"state":                 "state-1",
+		"nonce":                 "nonce-1",
+		"code_challenge":        base64.RawURLEncoding.EncodeToString(challenge[:]),
+		"code_challenge_method": "S256",
+	}
+	for name, value := range want {
+		if got := authURL.Query().Get(name); got != value {
+			t.Errorf("%s = %q, want %q", name, got, value)
+		}
+	}
+}
+
+func TestReauthenticationURL(t *testing.T) {
+	mock := oidctest.NewProvider(t, testClientID)
+	provider := newTestProvider(t, mock)
+
+	raw, err := provider.ReauthenticationURL(context.Background(), "state-1", "nonce-1", "verifier-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	authURL, err := url.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query := authURL.Query()
+	if query.Get("prompt") != "login" || query.Get("max_age") != "0" {
+		t.Errorf("reauthentication URL %s doesn't ask for a new login", raw)
+	}
+	if query.Get("state") != "state-1" || query.Get("nonce") != "nonce-1" || query.Get("code_challenge_method") != "S256" {
+		t.Errorf("reauthentication URL %s lacks the login parameters", raw)
+	}
+
+	raw, err = provider.AuthCodeURL(context.Background(), "state-1", "nonce-1", "verifier-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(raw, "prompt=") || strings.Contains(raw, "max_age=") {
+		t.Errorf("authorization URL %s asks for a new login", raw)
+	}
+}
+
+func TestDiscoveryRejectsAnotherIssuer(t *testing.T) {
+	mock := oidctest.NewProvider(t, testClientID)
+	mock.SetDiscoveryIssuer("https://attacker.example.com")
+	provider := newTestProvider(t, mock)
+
+	if _, err := provider.AuthCodeURL(context.Background(), "state", "nonce", "verifier"); err == nil {
+		t.Error("discovery document naming another issuer was accepted")
+	}
+	if _, err := provider.Exchange(context.Background(), "code", "verifier", "nonce"); err == nil {
+		t.Error("exchange went ahead with a discovery document naming another issuer")
+	}
+}
+
+func TestExchange(t *testing.T) {
+	mock := oidctest.NewProvider(t, testClientID)
+	provider := newTestProvider(t, mock)
+
+	code := mock.IssueCode(mock.Sign(t, mock.Claims("alice", "nonce-1")))
+	identity, err := provider.Exchange(context.Background(), code, "verifier-1", "nonce-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Identity{Subject: "alice", Email: "alice@example.com", EmailVerified: true, Name: "Test User"}
+	if *identity != want {
+		t.Errorf("identity = %+v, want %+v", *identity, want)
+	}
+
+	requests := mock.TokenRequests()
+	if len(requests) != 1 {
+		t.Fatalf("token endpoint got %d requests, want 1", len(requests))
+	}
+	form := requests[0]
+	if form.Get("grant_type") != "authorization_code" || form.Get("code") != code ||
+		form.Get("code_verifier") != "verifier-1" || form.Get("client_secret") != "client-secret" {
+		t.Errorf("unexpected token request %v", form)
+	}
+}
+
+func TestExchangeAuthTime(t *testing.T) {
+	mock := oidctest.NewProvider(t, testClientID)
+	provider := newTestProvider(t, mock)
+
+	authTime := time.Now().Add(-time.Minute).Truncate(time.Second)
+	claims := mock.Claims("alice", "nonce-1")
+	claims["auth_time"] = authTime.Unix()
+	identity, err := provider.Exchange(context.Background(), mock.IssueCode(mock.Sign(t, claims)), "verifier-1", "nonce-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !identity.AuthTime.Equal(authTime) {
+		t.Errorf("auth time = %v, want %v", identity.AuthTime, authTime)
+	}
+}
+
+func TestExchangeReauthentication(t *testing.T) {
+	since := time.Now().Add(-time.Minute)
+	tests := []struct {
+		name     string
+		authTime interface{}
+		ok       bool
+	}{
+		{"signed in after the start", since.Add(10 * time.Second).Unix(), true},
+		{"clock skew", since.Add(-30 * time.Second).Unix(), true},
+		{"older session", since.Add(-time.Hour).Unix(), false},
+		{"no auth_time", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := oidctest.NewProvider(t, testClientID)
+			provider := newTestProvider(t, mock)
+
+			claims := mock.Claims("alice", "nonce-1")
+			if tt.authTime != nil {
+				claims["auth_time"] = tt.authTime
+			}
+			identity, err := provider.ExchangeReauthentication(context.Background(), mock.IssueCode(mock.Sign(t, claims)), "verifier-1", "nonce-1", since)
+			if !tt.ok {
+				if !errors.Is(err, ErrProviderRejected) {
+					t.Errorf("err = %v, want ErrProviderRejected", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if identity.Subject != "alice" {
+				t.Errorf("subject = %q, want alice", identity.Subject)
+			}
+		})
+	}
+}
+
+func TestExchangeRejectsUnknownCode(t *testing.T) {
+	mock := oidctest.NewProvider(t, testClientID)
+	provider := newTestProvider(t, mock)
+
+	_, err := provider.Exchange(context.Background(), "never-issued", "verifier", "nonce")
+	if !errors.Is(err, ErrProviderRejected) {
+		t.Errorf("Exchange error = %v, want ErrProviderRejected", err)
+	}
+}
@@ -0,0 +1,122 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/models"
+)
+
+// ErrAccessPolicyNotFound is returned when an access policy doesn't exist
+var ErrAccessPolicyNotFound = errors.New("access policy not found")
+
+// accessPolicyColumns are the columns scanned by scanAccessPolicy
+const accessPolicyColumns = `
+	id, organization_id, user_id, name, ip_allowlist::text[], ip_denylist::text[],
+	country_allowlist, country_denylist, action, created_by, created_at, updated_at
+`
+
+// rowScanner is satisfied by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// GetAccessPolicies returns the access policies of an organization, oldest
+// first. With userID set, only the policies that apply to that member: the
+// organization-wide ones and their own.
+func (r *UserRepository) GetAccessPolicies(organizationID, userID string) ([]models.AccessPolicy, error) {
+	query := `SELECT ` + accessPolicyColumns + ` FROM access_policies WHERE organization_id = $1`
+	args := []interface{}{organizationID}
+	if userID != "" {
+		query += ` AND (user_id IS NULL OR user_id = $2)`
+		args = append(args, userID)
+	}
+	query += ` ORDER BY created_at, id`
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query access policies: %w", err)
+	}
+	defer rows.Close()
+
+	var policies []models.AccessPolicy
+	for rows.Next() {
+		policy, err := scanAccessPolicy(rows)
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, *policy)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read access policies: %w", err)
+	}
+
+	return policies, nil
+}
+
+// GetAccessPolicy retrieves an access policy by its ID
+func (r *UserRepository) GetAccessPolicy(policyID string) (*models.AccessPolicy, error) {
+	policy, err := scanAccessPolicy(r.db.QueryRow(`SELECT `+accessPolicyColumns+` FROM access_policies WHERE id = $1`, policyID))
+	if err == sql.ErrNoRows {
+		return nil, ErrAccessPolicyNotFound
+	}
+	return policy, err
+}
+
+// CreateAccessPolicy creates an access policy
+func (r *UserRepository) CreateAccessPolicy(policy *models.AccessPolicy) error {
+	_, err := r.db.Exec(`
+		INSERT INTO access_policies (id, organization_id, user_id, name, ip_allowlist, ip_denylist,
+		                             country_allowlist, country_denylist, action, created_by, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5::cidr[], $6::cidr[], $7, $8, $9, $10, $11, $12)
+	`, policy.ID, policy.OrganizationID, policy.UserID, policy.Name,
+		pq.Array(policy.IPAllowlist), pq.Array(policy.IPDenylist),
+		pq.Array(policy.CountryAllowlist), pq.Array(policy.CountryDenylist),
+		policy.Action, policy.CreatedBy, policy.CreatedAt, policy.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create access policy: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteAccessPolicy deletes an access policy
+func (r *UserRepository) DeleteAccessPolicy(policyID string) error {
+	result, err := r.db.Exec(`DELETE FROM access_policies WHERE id = $1`, policyID)
+	if err != nil {
+		return fmt.Errorf("failed to delete access policy: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrAccessPolicyNotFound
+	}
+
+	return nil
+}
+
+// scanAccessPolicy scans a row of accessPolicyColumns. It passes
+// sql.ErrNoRows through unwrapped.
+func scanAccessPolicy(row rowScanner) (*models.AccessPolicy, error) {
+	policy := &models.AccessPolicy{}
+	err := row.Scan(
+		&policy.ID, &policy.OrganizationID, &policy.UserID, &policy.Name,
+		pq.Array(&policy.IPAllowlist), pq.Array(&policy.IPDenylist),
+		pq.Array(&policy.CountryAllowlist), pq.Array(&policy.CountryDenylist),
+		&policy.Action, &policy.CreatedBy, &policy.CreatedAt, &policy.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan access policy: %w", err)
+	}
+
+	return policy, nil
+}
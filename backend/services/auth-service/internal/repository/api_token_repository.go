@@ -0,0 +1,150 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/models"
+)
+
+// ErrAPITokenNotFound is returned when an API token doesn't exist, or is
+// already revoked when revoking it
+var ErrAPITokenNotFound = errors.New("api token not found")
+
+// apiTokenColumns are the columns scanned by scanAPIToken
+const apiTokenColumns = `
+	id, kind, user_id, organization_id, name, token_prefix, token_hash, scopes,
+	expires_at, last_used_at, last_used_ip, revoked_at, created_at
+`
+
+// CreateAPIToken stores a newly made API token
+func (r *UserRepository) CreateAPIToken(token *models.APIToken) error {
+	_, err := r.db.Exec(`
+		INSERT INTO api_tokens (id, kind, user_id, organization_id, name, token_prefix,
+		                        token_hash, scopes, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	`, token.ID, token.Kind, token.UserID, token.OrganizationID, token.Name, token.TokenPrefix,
+		token.TokenHash, pq.Array(token.Scopes), token.ExpiresAt, token.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create api token: %w", err)
+	}
+
+	return nil
+}
+
+// GetAPIToken retrieves an API token by ID
+func (r *UserRepository) GetAPIToken(tokenID string) (*models.APIToken, error) {
+	token, err := scanAPIToken(r.db.QueryRow(`SELECT `+apiTokenColumns+` FROM api_tokens WHERE id = $1`, tokenID))
+	if err == sql.ErrNoRows {
+		return nil, ErrAPITokenNotFound
+	}
+	return token, err
+}
+
+// GetAPITokenByHash retrieves an API token by its hash, whether or not it
+// is still valid
+func (r *UserRepository) GetAPITokenByHash(tokenHash string) (*models.APIToken, error) {
+	token, err := scanAPIToken(r.db.QueryRow(`SELECT `+apiTokenColumns+` FROM api_tokens WHERE token_hash = $1`, tokenHash))
+	if err == sql.ErrNoRows {
+		return nil, ErrAPITokenNotFound
+	}
+	return token, err
+}
+
+// ListPersonalAPITokens returns a user's personal access tokens, newest first
+func (r *UserRepository) ListPersonalAPITokens(userID string) ([]models.APIToken, error) {
+	return r.listAPITokens(`
+		SELECT `+apiTokenColumns+` FROM api_tokens
+		WHERE user_id = $1 AND kind = 'personal'
+		ORDER BY created_at DESC, id
+	`, userID)
+}
+
+// ListServiceAPITokens returns the API keys of an organization, newest first
+func (r *UserRepository) ListServiceAPITokens(organizationID string) ([]models.APIToken, error) {
+	return r.listAPITokens(`
+		SELECT `+apiTokenColumns+` FROM api_tokens
+		WHERE organization_id = $1 AND kind = 'service'
+		ORDER BY created_at DESC, id
+	`, organizationID)
+}
+
+func (r *UserRepository) listAPITokens(query string, args ...interface{}) ([]models.APIToken, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query api tokens: %w", err)
+	}
+	defer rows.Close()
+
+	var tokens []models.APIToken
+	for rows.Next() {
+		token, err := scanAPIToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, *token)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read api tokens: %w", err)
+	}
+
+	return tokens, nil
+}
+
+// RevokeAPIToken revokes an API token that isn't revoked yet
+func (r *UserRepository) RevokeAPIToken(tokenID string) error {
+	result, err := r.db.Exec(`
+		UPDATE api_tokens SET revoked_at = $1
+		WHERE id = $2 AND revoked_at IS NULL
+	`, time.Now(), tokenID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke api token: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrAPITokenNotFound
+	}
+
+	return nil
+}
+
+// UpdateAPITokenLastUsed records when and from where an API token was last
+// used. A nil ip keeps the last known address.
+func (r *UserRepository) UpdateAPITokenLastUsed(tokenID string, ip *string) error {
+	_, err := r.db.Exec(`
+		UPDATE api_tokens SET last_used_at = $1, last_used_ip = COALESCE($2, last_used_ip)
+		WHERE id = $3
+	`, time.Now(), ip, tokenID)
+	if err != nil {
+		return fmt.Errorf("failed to update api token last used: %w", err)
+	}
+
+	return nil
+}
+
+// scanAPIToken scans a row of apiTokenColumns. It passes sql.ErrNoRows
+// through unwrapped.
+func scanAPIToken(row rowScanner) (*models.APIToken, error) {
+	token := &models.APIToken{}
+	err := row.Scan(
+		&token.ID, &token.Kind, &token.UserID, &token.OrganizationID, &token.Name, &token.TokenPrefix,
+		&token.TokenHash, pq.Array(&token.Scopes), &token.ExpiresAt, &token.LastUsedAt, &token.LastUsedIP,
+		&token.RevokedAt, &token.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan api token: %w", err)
+	}
+
+	return token, nil
+}
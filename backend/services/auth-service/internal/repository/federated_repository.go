@@ -0,0 +1,111 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/models"
+)
+
+// Errors returned for federated logins
+var (
+	ErrFederatedLoginStateNotFound = errors.New("federated login state not found")
+	ErrFederatedIdentityNotFound   = errors.New("federated identity not found")
+	ErrFederatedIdentityExists     = errors.New("federated identity already linked")
+)
+
+// SaveFederatedLoginState stores a pending federated login, replacing one
+// with the same state, and drops expired ones
+func (r *UserRepository) SaveFederatedLoginState(state *models.FederatedLoginState) error {
+	if _, err := r.db.Exec(`DELETE FROM federated_login_states WHERE expires_at < $1`, time.Now()); err != nil {
+		return fmt.Errorf("failed to delete expired federated login states: %w", err)
+	}
+
+	_, err := r.db.Exec(`
+		INSERT INTO federated_login_states (state_hash, provider, code_verifier, nonce, user_id, reauthentication, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (state_hash) DO UPDATE
+		SET user_id = EXCLUDED.user_id, expires_at = EXCLUDED.expires_at
+	`, state.StateHash, state.Provider, state.CodeVerifier, state.Nonce, state.UserID, state.Reauthentication, state.ExpiresAt, state.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save federated login state: %w", err)
+	}
+
+	return nil
+}
+
+// ClaimFederatedLoginState removes and returns an unexpired pending login of
+// a provider, so each state is used once
+func (r *UserRepository) ClaimFederatedLoginState(stateHash, provider string) (*models.FederatedLoginState, error) {
+	state := &models.FederatedLoginState{}
+	err := r.db.QueryRow(`
+		DELETE FROM federated_login_states
+		WHERE state_hash = $1 AND provider = $2 AND expires_at > $3
+		RETURNING state_hash, provider, code_verifier, nonce, user_id, reauthentication, expires_at, created_at
+	`, stateHash, provider, time.Now()).Scan(
+		&state.StateHash, &state.Provider, &state.CodeVerifier, &state.Nonce,
+		&state.UserID, &state.Reauthentication, &state.ExpiresAt, &state.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrFederatedLoginStateNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim federated login state: %w", err)
+	}
+
+	return state, nil
+}
+
+// GetFederatedIdentity retrieves the link of a provider account
+func (r *UserRepository) GetFederatedIdentity(provider, subject string) (*models.FederatedIdentity, error) {
+	identity := &models.FederatedIdentity{}
+	err := r.db.QueryRow(`
+		SELECT id, user_id, provider, subject, email, created_at, last_login_at
+		FROM federated_identities
+		WHERE provider = $1 AND subject = $2
+	`, provider, subject).Scan(
+		&identity.ID, &identity.UserID, &identity.Provider, &identity.Subject,
+		&identity.Email, &identity.CreatedAt, &identity.LastLoginAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrFederatedIdentityNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get federated identity: %w", err)
+	}
+
+	return identity, nil
+}
+
+// LinkFederatedIdentity links a provider account to a user
+func (r *UserRepository) LinkFederatedIdentity(identity *models.FederatedIdentity) error {
+	result, err := r.db.Exec(`
+		INSERT INTO federated_identities (id, user_id, provider, subject, email, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (provider, subject) DO NOTHING
+	`, identity.ID, identity.UserID, identity.Provider, identity.Subject, identity.Email, identity.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to link federated identity: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrFederatedIdentityExists
+	}
+
+	return nil
+}
+
+// UpdateFederatedIdentityLastLogin records a sign-in through a provider account
+func (r *UserRepository) UpdateFederatedIdentityLastLogin(identityID string) error {
+	_, err := r.db.Exec(`UPDATE federated_identities SET last_login_at = $1 WHERE id = $2`, time.Now(), identityID)
+	if err != nil {
+		return fmt.Errorf("failed to update federated identity: %w", err)
+	}
+	return nil
+}
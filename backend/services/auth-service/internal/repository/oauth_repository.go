@@ -0,0 +1,471 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/models"
+)
+
+// Errors returned for the OAuth authorization server
+var (
+	ErrOAuthClientNotFound       = errors.New("oauth client not found")
+	ErrOAuthConsentNotFound      = errors.New("oauth consent not found")
+	ErrAuthorizationCodeNotFound = errors.New("authorization code not found")
+	ErrAuthorizationCodeRedeemed = errors.New("authorization code already redeemed")
+	ErrOAuthRefreshTokenNotFound = errors.New("oauth refresh token not found")
+	ErrOAuthRefreshTokenReused   = errors.New("oauth refresh token already used")
+)
+
+// redeemedCodeRetention is how long authorization codes are kept after they
+// expire, so a code replayed after it was redeemed is still recognized
+const redeemedCodeRetention = 24 * time.Hour
+
+// authorizationCodeColumns are the columns scanned by scanAuthorizationCode
+const authorizationCodeColumns = `
+	code_hash, client_id, user_id, session_id, redirect_uri, scopes,
+	nonce, code_challenge, expires_at, created_at, redeemed_at, family_id
+`
+
+// oauthRefreshTokenColumns are the columns scanned by scanOAuthRefreshToken
+const oauthRefreshTokenColumns = `
+	token_hash, client_id, user_id, session_id, family_id, scopes, expires_at, created_at, used_at
+`
+
+// oauthClientColumns are the columns scanned by scanOAuthClient
+const oauthClientColumns = `
+	id, organization_id, name, secret_hash, redirect_uris, backchannel_logout_uri,
+	scopes, created_by, created_at, updated_at
+`
+
+// GetOAuthClient retrieves an OAuth client by its client ID
+func (r *UserRepository) GetOAuthClient(clientID string) (*models.OAuthClient, error) {
+	client, err := scanOAuthClient(r.db.QueryRow(`SELECT `+oauthClientColumns+` FROM oauth_clients WHERE id = $1`, clientID))
+	if err == sql.ErrNoRows {
+		return nil, ErrOAuthClientNotFound
+	}
+	return client, err
+}
+
+// ListOAuthClients returns the OAuth clients of an organization, oldest first
+func (r *UserRepository) ListOAuthClients(organizationID string) ([]models.OAuthClient, error) {
+	rows, err := r.db.Query(`
+		SELECT `+oauthClientColumns+` FROM oauth_clients
+		WHERE organization_id = $1
+		ORDER BY created_at, id
+	`, organizationID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query oauth clients: %w", err)
+	}
+	defer rows.Close()
+
+	var clients []models.OAuthClient
+	for rows.Next() {
+		client, err := scanOAuthClient(rows)
+		if err != nil {
+			return nil, err
+		}
+		clients = append(clients, *client)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read oauth clients: %w", err)
+	}
+
+	return clients, nil
+}
+
+// CreateOAuthClient registers an OAuth client
+func (r *UserRepository) CreateOAuthClient(client *models.OAuthClient) error {
+	_, err := r.db.Exec(`
+		INSERT INTO oauth_clients (id, organization_id, name, secret_hash, redirect_uris,
+		                           backchannel_logout_uri, scopes, created_by, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	`, client.ID, client.OrganizationID, client.Name, client.SecretHash, pq.Array(client.RedirectURIs),
+		client.BackchannelLogoutURI, pq.Array(client.Scopes), client.CreatedBy, client.CreatedAt, client.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create oauth client: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteOAuthClient deletes an OAuth client with its codes, tokens and
+// consents
+func (r *UserRepository) DeleteOAuthClient(clientID string) error {
+	result, err := r.db.Exec(`DELETE FROM oauth_clients WHERE id = $1`, clientID)
+	if err != nil {
+		return fmt.Errorf("failed to delete oauth client: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrOAuthClientNotFound
+	}
+
+	return nil
+}
+
+// GetOAuthConsent retrieves what a user agreed to share with a client
+func (r *UserRepository) GetOAuthConsent(userID, clientID string) (*models.OAuthConsent, error) {
+	consent := &models.OAuthConsent{}
+	err := r.db.QueryRow(`
+		SELECT oc.user_id, oc.client_id, c.name, oc.scopes, oc.created_at, oc.updated_at
+		FROM oauth_consents oc
+		JOIN oauth_clients c ON c.id = oc.client_id
+		WHERE oc.user_id = $1 AND oc.client_id = $2
+	`, userID, clientID).Scan(
+		&consent.UserID, &consent.ClientID, &consent.ClientName, pq.Array(&consent.Scopes),
+		&consent.CreatedAt, &consent.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrOAuthConsentNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get oauth consent: %w", err)
+	}
+
+	return consent, nil
+}
+
+// ListOAuthConsents returns the clients a user agreed to share data with,
+// most recent first
+func (r *UserRepository) ListOAuthConsents(userID string) ([]models.OAuthConsent, error) {
+	rows, err := r.db.Query(`
+		SELECT oc.user_id, oc.client_id, c.name, oc.scopes, oc.created_at, oc.updated_at
+		FROM oauth_consents oc
+		JOIN oauth_clients c ON c.id = oc.client_id
+		WHERE oc.user_id = $1
+		ORDER BY oc.updated_at DESC
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query oauth consents: %w", err)
+	}
+	defer rows.Close()
+
+	var consents []models.OAuthConsent
+	for rows.Next() {
+		var consent models.OAuthConsent
+		if err := rows.Scan(
+			&consent.UserID, &consent.ClientID, &consent.ClientName, pq.Array(&consent.Scopes),
+			&consent.CreatedAt, &consent.UpdatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan oauth consent: %w", err)
+		}
+		consents = append(consents, consent)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read oauth consents: %w", err)
+	}
+
+	return consents, nil
+}
+
+// SaveOAuthConsent records the scopes a user agreed to share with a client,
+// replacing what they agreed to before
+func (r *UserRepository) SaveOAuthConsent(consent *models.OAuthConsent) error {
+	_, err := r.db.Exec(`
+		INSERT INTO oauth_consents (user_id, client_id, scopes, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (user_id, client_id) DO UPDATE
+		SET scopes = EXCLUDED.scopes
+	`, consent.UserID, consent.ClientID, pq.Array(consent.Scopes), consent.CreatedAt, consent.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save oauth consent: %w", err)
+	}
+
+	return nil
+}
+
+// RevokeOAuthConsent withdraws a user's consent to a client along with the
+// refresh tokens it holds for them
+func (r *UserRepository) RevokeOAuthConsent(userID, clientID string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`DELETE FROM oauth_consents WHERE user_id = $1 AND client_id = $2`, userID, clientID)
+	if err != nil {
+		return fmt.Errorf("failed to delete oauth consent: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrOAuthConsentNotFound
+	}
+
+	if _, err := tx.Exec(`DELETE FROM oauth_refresh_tokens WHERE user_id = $1 AND client_id = $2`, userID, clientID); err != nil {
+		return fmt.Errorf("failed to delete oauth refresh tokens: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// CreateAuthorizationCode stores an authorization code and drops codes that
+// expired long ago
+func (r *UserRepository) CreateAuthorizationCode(code *models.OAuthAuthorizationCode) error {
+	if _, err := r.db.Exec(`DELETE FROM oauth_authorization_codes WHERE expires_at < $1`, time.Now().Add(-redeemedCodeRetention)); err != nil {
+		return fmt.Errorf("failed to delete expired authorization codes: %w", err)
+	}
+
+	_, err := r.db.Exec(`
+		INSERT INTO oauth_authorization_codes (code_hash, client_id, user_id, session_id, redirect_uri,
+		                                       scopes, nonce, code_challenge, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	`, code.CodeHash, code.ClientID, code.UserID, code.SessionID, code.RedirectURI,
+		pq.Array(code.Scopes), code.Nonce, code.CodeChallenge, code.ExpiresAt, code.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create authorization code: %w", err)
+	}
+
+	return nil
+}
+
+// ClaimAuthorizationCode marks an unexpired authorization code as redeemed
+// into the token family familyID and returns it, so each code is redeemed
+// once. A code that was already redeemed is returned with
+// ErrAuthorizationCodeRedeemed, its FamilyID naming the tokens issued for it.
+func (r *UserRepository) ClaimAuthorizationCode(codeHash, familyID string) (*models.OAuthAuthorizationCode, error) {
+	now := time.Now()
+	code, err := scanAuthorizationCode(r.db.QueryRow(`
+		UPDATE oauth_authorization_codes
+		SET redeemed_at = $2, family_id = $3
+		WHERE code_hash = $1 AND redeemed_at IS NULL AND expires_at > $2
+		RETURNING `+authorizationCodeColumns,
+		codeHash, now, familyID,
+	))
+	if err == nil {
+		return code, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to claim authorization code: %w", err)
+	}
+
+	code, err = scanAuthorizationCode(r.db.QueryRow(`
+		SELECT `+authorizationCodeColumns+`
+		FROM oauth_authorization_codes
+		WHERE code_hash = $1 AND redeemed_at IS NOT NULL
+	`, codeHash))
+	if err == sql.ErrNoRows {
+		return nil, ErrAuthorizationCodeNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get authorization code: %w", err)
+	}
+
+	return code, ErrAuthorizationCodeRedeemed
+}
+
+// scanAuthorizationCode reads a row of authorizationCodeColumns
+func scanAuthorizationCode(row *sql.Row) (*models.OAuthAuthorizationCode, error) {
+	code := &models.OAuthAuthorizationCode{}
+	err := row.Scan(
+		&code.CodeHash, &code.ClientID, &code.UserID, &code.SessionID, &code.RedirectURI,
+		pq.Array(&code.Scopes), &code.Nonce, &code.CodeChallenge, &code.ExpiresAt, &code.CreatedAt,
+		&code.RedeemedAt, &code.FamilyID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return code, nil
+}
+
+// CreateOAuthRefreshToken stores a refresh token issued to a client
+func (r *UserRepository) CreateOAuthRefreshToken(token *models.OAuthRefreshToken) error {
+	_, err := r.db.Exec(`
+		INSERT INTO oauth_refresh_tokens (token_hash, client_id, user_id, session_id, family_id, scopes, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`, token.TokenHash, token.ClientID, token.UserID, token.SessionID, token.FamilyID, pq.Array(token.Scopes), token.ExpiresAt, token.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create oauth refresh token: %w", err)
+	}
+
+	return nil
+}
+
+// ClaimOAuthRefreshToken marks an unexpired refresh token as used and returns
+// it, so each is used once and replaced. A token that was already used is
+// returned with ErrOAuthRefreshTokenReused.
+func (r *UserRepository) ClaimOAuthRefreshToken(tokenHash string) (*models.OAuthRefreshToken, error) {
+	now := time.Now()
+	token, err := scanOAuthRefreshToken(r.db.QueryRow(`
+		UPDATE oauth_refresh_tokens
+		SET used_at = $2
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > $2
+		RETURNING `+oauthRefreshTokenColumns,
+		tokenHash, now,
+	))
+	if err == nil {
+		return token, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to claim oauth refresh token: %w", err)
+	}
+
+	token, err = scanOAuthRefreshToken(r.db.QueryRow(`
+		SELECT `+oauthRefreshTokenColumns+`
+		FROM oauth_refresh_tokens
+		WHERE token_hash = $1 AND used_at IS NOT NULL
+	`, tokenHash))
+	if err == sql.ErrNoRows {
+		return nil, ErrOAuthRefreshTokenNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get oauth refresh token: %w", err)
+	}
+
+	return token, ErrOAuthRefreshTokenReused
+}
+
+// scanOAuthRefreshToken reads a row of oauthRefreshTokenColumns
+func scanOAuthRefreshToken(row *sql.Row) (*models.OAuthRefreshToken, error) {
+	token := &models.OAuthRefreshToken{}
+	err := row.Scan(
+		&token.TokenHash, &token.ClientID, &token.UserID, &token.SessionID, &token.FamilyID,
+		pq.Array(&token.Scopes), &token.ExpiresAt, &token.CreatedAt, &token.UsedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// RevokeOAuthTokenFamily deletes every refresh token descended from one
+// authorization code
+func (r *UserRepository) RevokeOAuthTokenFamily(familyID string) error {
+	_, err := r.db.Exec(`DELETE FROM oauth_refresh_tokens WHERE family_id = $1`, familyID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke oauth token family: %w", err)
+	}
+
+	return nil
+}
+
+// AddOAuthClientSession records that a client signed in through a session,
+// so it is told when the session ends
+func (r *UserRepository) AddOAuthClientSession(sessionID, clientID string) error {
+	_, err := r.db.Exec(`
+		INSERT INTO oauth_client_sessions (session_id, client_id, created_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (session_id, client_id) DO NOTHING
+	`, sessionID, clientID, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to record oauth client session: %w", err)
+	}
+
+	return nil
+}
+
+// ClaimBackchannelLogouts claims a batch of due logout notifications, hiding
+// them from other instances for the lease
+func (r *UserRepository) ClaimBackchannelLogouts(limit int, lease time.Duration) ([]models.BackchannelLogout, error) {
+	query := `
+		WITH claimed AS (
+			UPDATE backchannel_logout_outbox
+			SET next_attempt_at = $1
+			WHERE id IN (
+				SELECT id FROM backchannel_logout_outbox
+				WHERE status = 'pending' AND next_attempt_at <= $2
+				ORDER BY created_at
+				LIMIT $3
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING id, client_id, session_id, user_id, attempts, created_at
+		)
+		SELECT claimed.id, claimed.client_id, c.backchannel_logout_uri, claimed.session_id,
+		       claimed.user_id, claimed.attempts, claimed.created_at
+		FROM claimed
+		JOIN oauth_clients c ON c.id = claimed.client_id
+		WHERE c.backchannel_logout_uri IS NOT NULL
+	`
+
+	now := time.Now()
+	rows, err := r.db.Query(query, now.Add(lease), now, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim backchannel logouts: %w", err)
+	}
+	defer rows.Close()
+
+	var logouts []models.BackchannelLogout
+	for rows.Next() {
+		var l models.BackchannelLogout
+		if err := rows.Scan(&l.ID, &l.ClientID, &l.LogoutURI, &l.SessionID, &l.UserID, &l.Attempts, &l.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan backchannel logout: %w", err)
+		}
+		logouts = append(logouts, l)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read backchannel logouts: %w", err)
+	}
+
+	// RETURNING gives no ordering guarantee
+	sort.Slice(logouts, func(i, j int) bool {
+		return logouts[i].CreatedAt.Before(logouts[j].CreatedAt)
+	})
+
+	return logouts, nil
+}
+
+// DeleteBackchannelLogout removes a logout notification once the client has it
+func (r *UserRepository) DeleteBackchannelLogout(logoutID string) error {
+	_, err := r.db.Exec(`DELETE FROM backchannel_logout_outbox WHERE id = $1`, logoutID)
+	if err != nil {
+		return fmt.Errorf("failed to delete backchannel logout: %w", err)
+	}
+
+	return nil
+}
+
+// MarkBackchannelLogoutFailed records a failed delivery. A nil nextAttemptAt
+// gives up on the notification.
+func (r *UserRepository) MarkBackchannelLogoutFailed(logoutID string, lastError string, nextAttemptAt *time.Time) error {
+	query := `
+		UPDATE backchannel_logout_outbox
+		SET attempts = attempts + 1,
+		    last_error = $1,
+		    status = CASE WHEN $2::timestamptz IS NULL THEN 'failed' ELSE 'pending' END,
+		    next_attempt_at = COALESCE($2, next_attempt_at)
+		WHERE id = $3
+	`
+
+	_, err := r.db.Exec(query, lastError, nextAttemptAt, logoutID)
+	if err != nil {
+		return fmt.Errorf("failed to mark backchannel logout as failed: %w", err)
+	}
+
+	return nil
+}
+
+// scanOAuthClient scans a row of oauthClientColumns. It passes sql.ErrNoRows
+// through unwrapped.
+func scanOAuthClient(row rowScanner) (*models.OAuthClient, error) {
+	client := &models.OAuthClient{}
+	err := row.Scan(
+		&client.ID, &client.OrganizationID, &client.Name, &client.SecretHash,
+		pq.Array(&client.RedirectURIs), &client.BackchannelLogoutURI, pq.Array(&client.Scopes),
+		&client.CreatedBy, &client.CreatedAt, &client.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan oauth client: %w", err)
+	}
+
+	return client, nil
+}
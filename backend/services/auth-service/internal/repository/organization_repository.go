@@ -0,0 +1,160 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/models"
+)
+
+// Errors returned for organization lookups and changes
+var (
+	ErrOrganizationNotFound = errors.New("organization not found")
+	ErrOrganizationExists   = errors.New("organization already exists")
+)
+
+// organizationColumns are the columns scanned by scanOrganization
+const organizationColumns = `
+	id, name, slug, mfa_required, session_lifetime_seconds,
+	allowed_countries, ip_allowlist::text[], created_at, updated_at
+`
+
+// GetOrganization retrieves an organization by its ID
+func (r *UserRepository) GetOrganization(organizationID string) (*models.Organization, error) {
+	return scanOrganization(r.db.QueryRow(`SELECT `+organizationColumns+` FROM organizations WHERE id = $1`, organizationID))
+}
+
+// GetOrganizationBySlug retrieves an organization by its slug
+func (r *UserRepository) GetOrganizationBySlug(slug string) (*models.Organization, error) {
+	return scanOrganization(r.db.QueryRow(`SELECT `+organizationColumns+` FROM organizations WHERE slug = $1`, slug))
+}
+
+// CreateOrganization creates an organization with the default policy
+func (r *UserRepository) CreateOrganization(org *models.Organization) error {
+	result, err := r.db.Exec(`
+		INSERT INTO organizations (id, name, slug, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (slug) DO NOTHING
+	`, org.ID, org.Name, org.Slug, org.CreatedAt, org.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create organization: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrOrganizationExists
+	}
+
+	return nil
+}
+
+// UpdateOrganizationPolicy replaces the sign-in policy of an organization
+func (r *UserRepository) UpdateOrganizationPolicy(org *models.Organization) error {
+	result, err := r.db.Exec(`
+		UPDATE organizations
+		SET mfa_required = $1, session_lifetime_seconds = $2,
+		    allowed_countries = $3, ip_allowlist = $4::cidr[]
+		WHERE id = $5
+	`, org.MFARequired, org.SessionLifetimeSeconds,
+		pq.Array(org.AllowedCountries), pq.Array(org.IPAllowlist), org.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update organization policy: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return ErrOrganizationNotFound
+	}
+
+	return nil
+}
+
+// MoveUserToOrganization makes a user a member of another organization,
+// taking their devices and sessions along, and revokes their active sessions
+// so they sign in again under the new organization's policy. Access policies
+// set for them by the old organization are dropped. It returns how many
+// sessions were revoked. Security alerts and audit logs stay with the
+// organization they were raised in.
+func (r *UserRepository) MoveUserToOrganization(userID, organizationID string) (int64, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	result, err := tx.Exec(`
+		UPDATE users SET organization_id = $1, updated_at = $2
+		WHERE id = $3 AND deleted_at IS NULL
+	`, organizationID, now, userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to move user: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return 0, missingUserError(tx, userID)
+	}
+
+	if _, err := tx.Exec(`UPDATE devices SET organization_id = $1 WHERE user_id = $2`, organizationID, userID); err != nil {
+		return 0, fmt.Errorf("failed to move user's devices: %w", err)
+	}
+
+	if _, err := tx.Exec(`DELETE FROM access_policies WHERE user_id = $1`, userID); err != nil {
+		return 0, fmt.Errorf("failed to delete user's access policies: %w", err)
+	}
+
+	result, err = tx.Exec(`
+		UPDATE sessions
+		SET is_active = false, revoked_at = $1
+		WHERE user_id = $2 AND is_active = true
+	`, now, userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+
+	revoked, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if _, err := tx.Exec(`UPDATE sessions SET organization_id = $1 WHERE user_id = $2`, organizationID, userID); err != nil {
+		return 0, fmt.Errorf("failed to move user's sessions: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return revoked, nil
+}
+
+// scanOrganization scans a row of organizationColumns
+func scanOrganization(row *sql.Row) (*models.Organization, error) {
+	org := &models.Organization{}
+	err := row.Scan(
+		&org.ID, &org.Name, &org.Slug, &org.MFARequired, &org.SessionLifetimeSeconds,
+		pq.Array(&org.AllowedCountries), pq.Array(&org.IPAllowlist), &org.CreatedAt, &org.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrOrganizationNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get organization: %w", err)
+	}
+
+	return org, nil
+}
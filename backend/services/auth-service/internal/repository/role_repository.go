@@ -0,0 +1,144 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/models"
+)
+
+// ErrRoleNotFound is returned when granting a role that doesn't exist
+var ErrRoleNotFound = errors.New("role not found")
+
+// userRolesColumns are the roles and permissions of user u, sorted by name
+const userRolesColumns = `
+	ARRAY(SELECT ur.role_name FROM user_roles ur
+	      WHERE ur.user_id = u.id ORDER BY ur.role_name),
+	ARRAY(SELECT DISTINCT rp.permission FROM user_roles ur
+	      JOIN role_permissions rp ON rp.role_name = ur.role_name
+	      WHERE ur.user_id = u.id ORDER BY rp.permission)
+`
+
+// GetUserAuthorization returns the roles granted to a user and the
+// permissions they carry
+func (r *UserRepository) GetUserAuthorization(userID string) ([]string, []string, error) {
+	query := `SELECT ` + userRolesColumns + ` FROM users u WHERE u.id = $1`
+
+	var roles, permissions []string
+	err := r.db.QueryRow(query, userID).Scan(pq.Array(&roles), pq.Array(&permissions))
+	if err == sql.ErrNoRows {
+		return nil, nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get user roles: %w", err)
+	}
+
+	return roles, permissions, nil
+}
+
+// ListUsers returns a page of users whose email or full name contains query,
+// newest first, and the total number of matches. A non-empty organizationID
+// only lists that organization's members.
+func (r *UserRepository) ListUsers(organizationID, query string, limit, offset int) ([]models.UserWithRoles, int, error) {
+	var conditions []string
+	args := []interface{}{}
+	if organizationID != "" {
+		args = append(args, organizationID)
+		conditions = append(conditions, fmt.Sprintf("u.organization_id = $%d", len(args)))
+	}
+	if query != "" {
+		args = append(args, "%"+escapeLike(query)+"%")
+		conditions = append(conditions, fmt.Sprintf("(u.email ILIKE $%d OR u.full_name ILIKE $%d)", len(args), len(args)))
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var totalCount int
+	err := r.db.QueryRow(`SELECT COUNT(*) FROM users u`+where, args...).Scan(&totalCount)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get count: %w", err)
+	}
+
+	listQuery := `
+		SELECT u.id, u.email, u.full_name, u.is_active, u.mfa_enabled, u.organization_id,
+		       u.created_at, u.updated_at, u.deleted_at, u.deletion_scheduled_at,` + userRolesColumns + `
+		FROM users u` + where +
+		fmt.Sprintf(" ORDER BY u.created_at DESC, u.id LIMIT $%d OFFSET $%d", len(args)+1, len(args)+2)
+	args = append(args, limit, offset)
+
+	rows, err := r.db.Query(listQuery, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to query users: %w", err)
+	}
+	defer rows.Close()
+
+	var users []models.UserWithRoles
+	for rows.Next() {
+		var u models.UserWithRoles
+		err := rows.Scan(
+			&u.ID, &u.Email, &u.FullName, &u.IsActive, &u.MFAEnabled, &u.OrganizationID,
+			&u.CreatedAt, &u.UpdatedAt, &u.DeletedAt, &u.DeletionScheduledAt,
+			pq.Array(&u.Roles), pq.Array(&u.Permissions),
+		)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to scan user: %w", err)
+		}
+		users = append(users, u)
+	}
+
+	return users, totalCount, rows.Err()
+}
+
+// GrantRole grants a role to a user. Granting a role the user already holds
+// does nothing.
+func (r *UserRepository) GrantRole(userID, role, grantedBy string) error {
+	var exists bool
+	err := r.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM roles WHERE name = $1)`, role).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("failed to look up role: %w", err)
+	}
+	if !exists {
+		return ErrRoleNotFound
+	}
+
+	query := `
+		INSERT INTO user_roles (user_id, role_name, granted_by, granted_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id, role_name) DO NOTHING
+	`
+
+	_, err = r.db.Exec(query, userID, role, grantedBy, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to grant role: %w", err)
+	}
+
+	return nil
+}
+
+// RevokeRole takes a role away from a user, reporting whether they held it
+func (r *UserRepository) RevokeRole(userID, role string) (bool, error) {
+	result, err := r.db.Exec(`DELETE FROM user_roles WHERE user_id = $1 AND role_name = $2`, userID, role)
+	if err != nil {
+		return false, fmt.Errorf("failed to revoke role: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// escapeLike escapes the LIKE wildcards in s
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
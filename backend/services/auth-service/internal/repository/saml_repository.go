@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/models"
+)
+
+// Errors returned for SAML logins
+var (
+	ErrSAMLConnectionNotFound   = errors.New("SAML connection not found")
+	ErrSAMLLoginRequestNotFound = errors.New("SAML login request not found")
+)
+
+// GetSAMLConnection retrieves the SAML connection of an organization
+func (r *UserRepository) GetSAMLConnection(organizationID string) (*models.SAMLConnection, error) {
+	conn := &models.SAMLConnection{}
+	err := r.db.QueryRow(`
+		SELECT organization_id, idp_entity_id, idp_sso_url, idp_certificate, email_attribute,
+		       name_attribute, jit_provisioning, enabled, created_by, created_at, updated_at
+		FROM saml_connections
+		WHERE organization_id = $1
+	`, organizationID).Scan(
+		&conn.OrganizationID, &conn.IdPEntityID, &conn.IdPSSOURL, &conn.IdPCertificate, &conn.EmailAttribute,
+		&conn.NameAttribute, &conn.JITProvisioning, &conn.Enabled, &conn.CreatedBy, &conn.CreatedAt, &conn.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrSAMLConnectionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get SAML connection: %w", err)
+	}
+
+	return conn, nil
+}
+
+// SaveSAMLConnection creates or replaces the SAML connection of an organization
+func (r *UserRepository) SaveSAMLConnection(conn *models.SAMLConnection) error {
+	_, err := r.db.Exec(`
+		INSERT INTO saml_connections (
+			organization_id, idp_entity_id, idp_sso_url, idp_certificate, email_attribute,
+			name_attribute, jit_provisioning, enabled, created_by, created_at, updated_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		ON CONFLICT (organization_id) DO UPDATE
+		SET idp_entity_id = EXCLUDED.idp_entity_id, idp_sso_url = EXCLUDED.idp_sso_url,
+		    idp_certificate = EXCLUDED.idp_certificate, email_attribute = EXCLUDED.email_attribute,
+		    name_attribute = EXCLUDED.name_attribute, jit_provisioning = EXCLUDED.jit_provisioning,
+		    enabled = EXCLUDED.enabled
+	`, conn.OrganizationID, conn.IdPEntityID, conn.IdPSSOURL, conn.IdPCertificate, conn.EmailAttribute,
+		conn.NameAttribute, conn.JITProvisioning, conn.Enabled, conn.CreatedBy, conn.CreatedAt, conn.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save SAML connection: %w", err)
+	}
+
+	return nil
+}
+
+// CreateSAMLLoginRequest stores an authentication request sent to an
+// identity provider, and drops expired ones
+func (r *UserRepository) CreateSAMLLoginRequest(request *models.SAMLLoginRequest) error {
+	if _, err := r.db.Exec(`DELETE FROM saml_login_requests WHERE expires_at < $1`, time.Now()); err != nil {
+		return fmt.Errorf("failed to delete expired SAML login requests: %w", err)
+	}
+
+	_, err := r.db.Exec(`
+		INSERT INTO saml_login_requests (request_id, organization_id, relay_state_hash, reauthentication, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, request.RequestID, request.OrganizationID, request.RelayStateHash, request.Reauthentication, request.ExpiresAt, request.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create SAML login request: %w", err)
+	}
+
+	return nil
+}
+
+// ClaimSAMLLoginRequest removes and returns an unexpired authentication
+// request, so each is answered once
+func (r *UserRepository) ClaimSAMLLoginRequest(requestID string) (*models.SAMLLoginRequest, error) {
+	request := &models.SAMLLoginRequest{}
+	err := r.db.QueryRow(`
+		DELETE FROM saml_login_requests
+		WHERE request_id = $1 AND expires_at > $2
+		RETURNING request_id, organization_id, relay_state_hash, reauthentication, expires_at, created_at
+	`, requestID, time.Now()).Scan(
+		&request.RequestID, &request.OrganizationID, &request.RelayStateHash,
+		&request.Reauthentication, &request.ExpiresAt, &request.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrSAMLLoginRequestNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim SAML login request: %w", err)
+	}
+
+	return request, nil
+}
@@ -2,12 +2,25 @@ package repository
 
 import (
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
 	"time"
 
+	"github.com/lib/pq"
+
 	"github.com/aashiq-04/session-management-system/backend/services/auth-service/internal/models"
 )
 
+// Errors returned when a lookup matches nothing
+var (
+	ErrUserNotFound    = errors.New("user not found")
+	ErrSessionNotFound = errors.New("session not found")
+)
+
+// ErrUserDeleted is returned when changing an account that was soft-deleted
+var ErrUserDeleted = errors.New("user deleted")
 
 // UserRepository handles database operations for users
 type UserRepository struct {
@@ -19,15 +32,15 @@ func NewUserRepository(db *sql.DB) *UserRepository {
 	return &UserRepository{db: db}
 }
 
-// CreateUser inserts a new user into the database
+// CreateUser inserts a new user into the database. Users join the default
+// organization, which is filled in on the user.
 func (r *UserRepository) CreateUser(user *models.User) error {
 	query := `
 		INSERT INTO users (id, email, password_hash, full_name, is_active, created_at, updated_at)
 		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING organization_id
 	`
-	
-	_, err := r.db.Exec(
-		query,
+	args := []interface{}{
 		user.ID,
 		user.Email,
 		user.PasswordHash,
@@ -35,7 +48,19 @@ func (r *UserRepository) CreateUser(user *models.User) error {
 		user.IsActive,
 		user.CreatedAt,
 		user.UpdatedAt,
-	)
+	}
+	
+	// Users join the default organization unless one is given
+	if user.OrganizationID != "" {
+		query = `
+			INSERT INTO users (id, email, password_hash, full_name, is_active, created_at, updated_at, organization_id)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			RETURNING organization_id
+		`
+		args = append(args, user.OrganizationID)
+	}
+	
+	err := r.db.QueryRow(query, args...).Scan(&user.OrganizationID)
 	
 	if err != nil {
 		return fmt.Errorf("failed to create user: %w", err)
@@ -47,7 +72,9 @@ func (r *UserRepository) CreateUser(user *models.User) error {
 // GetUserByEmail retrieves a user by their email address
 func (r *UserRepository) GetUserByEmail(email string) (*models.User, error) {
 	query := `
-		SELECT id, email, password_hash, full_name, is_active, mfa_enabled, mfa_secret, created_at, updated_at
+		SELECT id, email, password_hash, full_name, is_active, mfa_enabled, mfa_secret,
+		       organization_id, password_changed_at, created_at, updated_at,
+		       deleted_at, deletion_scheduled_at
 		FROM users
 		WHERE email = $1
 	`
@@ -61,12 +88,16 @@ func (r *UserRepository) GetUserByEmail(email string) (*models.User, error) {
 		&user.IsActive,
 		&user.MFAEnabled,
 		&user.MFASecret,
+		&user.OrganizationID,
+		&user.PasswordChangedAt,
 		&user.CreatedAt,
 		&user.UpdatedAt,
+		&user.DeletedAt,
+		&user.DeletionScheduledAt,
 	)
 	
 	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("user not found")
+		return nil, ErrUserNotFound
 	}
 	
 	if err != nil {
@@ -79,7 +110,9 @@ func (r *UserRepository) GetUserByEmail(email string) (*models.User, error) {
 // GetUserByID retrieves a user by their ID
 func (r *UserRepository) GetUserByID(userID string) (*models.User, error) {
 	query := `
-		SELECT id, email, password_hash, full_name, is_active, mfa_enabled, mfa_secret, created_at, updated_at
+		SELECT id, email, password_hash, full_name, is_active, mfa_enabled, mfa_secret,
+		       organization_id, password_changed_at, created_at, updated_at,
+		       deleted_at, deletion_scheduled_at
 		FROM users
 		WHERE id = $1
 	`
@@ -93,12 +126,16 @@ func (r *UserRepository) GetUserByID(userID string) (*models.User, error) {
 		&user.IsActive,
 		&user.MFAEnabled,
 		&user.MFASecret,
+		&user.OrganizationID,
+		&user.PasswordChangedAt,
 		&user.CreatedAt,
 		&user.UpdatedAt,
+		&user.DeletedAt,
+		&user.DeletionScheduledAt,
 	)
 	
 	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("user not found")
+		return nil, ErrUserNotFound
 	}
 	
 	if err != nil {
@@ -151,6 +188,248 @@ func (r *UserRepository) EnableMFA(userID string, secret string) error {
 	return nil
 }
 
+// DisableUser deactivates a user and revokes all of their active sessions,
+// returning how many were revoked
+func (r *UserRepository) DisableUser(userID string) (int64, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	result, err := tx.Exec(`UPDATE users SET is_active = false, updated_at = $1 WHERE id = $2`, now, userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to disable user: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return 0, ErrUserNotFound
+	}
+
+	result, err = tx.Exec(`
+		UPDATE sessions
+		SET is_active = false, revoked_at = $1
+		WHERE user_id = $2 AND is_active = true
+	`, now, userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+
+	revoked, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return revoked, nil
+}
+
+// ReactivateUser lets a disabled user sign in again. Soft-deleted accounts
+// can't be reactivated.
+func (r *UserRepository) ReactivateUser(userID string) error {
+	result, err := r.db.Exec(`
+		UPDATE users SET is_active = true, updated_at = $1
+		WHERE id = $2 AND deleted_at IS NULL
+	`, time.Now(), userID)
+	if err != nil {
+		return fmt.Errorf("failed to reactivate user: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return missingUserError(r.db, userID)
+	}
+
+	return nil
+}
+
+// userOwnedTables hold a user's personal data, in an order that deletes
+// referencing rows first. Security alerts stay with the account; the audit
+// service anonymizes them.
+var userOwnedTables = []string{
+	"oauth_authorization_codes",
+	"oauth_refresh_tokens",
+	"oauth_consents",
+	"sessions",
+	"device_trust_tokens",
+	"devices",
+	"mfa_backup_codes",
+	"user_roles",
+	"notification_deliveries",
+	"notification_preferences",
+	"webhook_subscriptions",
+	"access_policies",
+	"federated_login_states",
+	"federated_identities",
+	"api_tokens",
+}
+
+// DeleteUser deletes an account. A hard delete removes the row and, through
+// its foreign keys, everything the user owns. A soft delete keeps the row so
+// its ID still resolves, but replaces the email and name, makes the password
+// unusable and removes everything else the user owns.
+func (r *UserRepository) DeleteUser(userID string, hard bool) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var result sql.Result
+	if hard {
+		result, err = tx.Exec(`DELETE FROM users WHERE id = $1`, userID)
+	} else {
+		now := time.Now()
+		result, err = tx.Exec(`
+			UPDATE users
+			SET email = 'deleted-' || id || '@deleted.invalid', full_name = 'Deleted user',
+			    password_hash = '!', is_active = false, mfa_enabled = false, mfa_secret = NULL,
+			    deleted_at = $1, deletion_scheduled_at = NULL, updated_at = $1
+			WHERE id = $2 AND deleted_at IS NULL
+		`, now, userID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return missingUserError(tx, userID)
+	}
+
+	if !hard {
+		for _, table := range userOwnedTables {
+			if _, err := tx.Exec(`DELETE FROM `+table+` WHERE user_id = $1`, userID); err != nil {
+				return fmt.Errorf("failed to delete user's %s: %w", table, err)
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// ScheduleAccountDeletion schedules the deletion of an account at a time,
+// keeping an earlier schedule if there is one, and returns when the account
+// will be deleted
+func (r *UserRepository) ScheduleAccountDeletion(userID string, at time.Time) (time.Time, error) {
+	var scheduledAt time.Time
+	err := r.db.QueryRow(`
+		UPDATE users
+		SET deletion_scheduled_at = COALESCE(deletion_scheduled_at, $1), updated_at = $2
+		WHERE id = $3 AND deleted_at IS NULL
+		RETURNING deletion_scheduled_at
+	`, at, time.Now(), userID).Scan(&scheduledAt)
+	if err == sql.ErrNoRows {
+		return time.Time{}, missingUserError(r.db, userID)
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to schedule account deletion: %w", err)
+	}
+
+	return scheduledAt, nil
+}
+
+// CancelAccountDeletion clears a pending deletion of an account, reporting
+// whether one was pending
+func (r *UserRepository) CancelAccountDeletion(userID string) (bool, error) {
+	result, err := r.db.Exec(`
+		UPDATE users
+		SET deletion_scheduled_at = NULL, updated_at = $1
+		WHERE id = $2 AND deleted_at IS NULL AND deletion_scheduled_at IS NOT NULL
+	`, time.Now(), userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to cancel account deletion: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// GetDueAccountDeletions returns up to limit accounts whose scheduled
+// deletion is due, oldest first
+func (r *UserRepository) GetDueAccountDeletions(now time.Time, limit int) ([]string, error) {
+	rows, err := r.db.Query(`
+		SELECT id
+		FROM users
+		WHERE deletion_scheduled_at <= $1 AND deleted_at IS NULL
+		ORDER BY deletion_scheduled_at
+		LIMIT $2
+	`, now, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query due account deletions: %w", err)
+	}
+	defer rows.Close()
+
+	var userIDs []string
+	for rows.Next() {
+		var userID string
+		if err := rows.Scan(&userID); err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		userIDs = append(userIDs, userID)
+	}
+
+	return userIDs, rows.Err()
+}
+
+// CountUserCredentials returns how many unused MFA backup codes and active
+// device trust tokens a user has
+func (r *UserRepository) CountUserCredentials(userID string) (int, int, error) {
+	var backupCodes, trustTokens int
+	err := r.db.QueryRow(`
+		SELECT (SELECT COUNT(*) FROM mfa_backup_codes WHERE user_id = $1 AND NOT is_used),
+		       (SELECT COUNT(*) FROM device_trust_tokens
+		        WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > $2)
+	`, userID, time.Now()).Scan(&backupCodes, &trustTokens)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to count user credentials: %w", err)
+	}
+
+	return backupCodes, trustTokens, nil
+}
+
+// missingUserError explains why an update matched no user: it doesn't exist,
+// or it was soft-deleted
+func missingUserError(q interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}, userID string) error {
+	var deleted bool
+	err := q.QueryRow(`SELECT deleted_at IS NOT NULL FROM users WHERE id = $1`, userID).Scan(&deleted)
+	if err == sql.ErrNoRows {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+	if deleted {
+		return ErrUserDeleted
+	}
+
+	return ErrUserNotFound
+}
+
 // CreateDevice inserts a new device into the database
 func (r *UserRepository) CreateDevice(device *models.Device) error {
 	query := `
@@ -185,7 +464,7 @@ func (r *UserRepository) CreateDevice(device *models.Device) error {
 func (r *UserRepository) GetDeviceByFingerprint(fingerprint string) (*models.Device, error) {
 	query := `
 		SELECT id, user_id, device_fingerprint, device_name, device_type, os, browser,
-		       is_trusted, first_seen_at, last_seen_at, created_at
+		       is_trusted, trusted_until, removed_at, first_seen_at, last_seen_at, created_at
 		FROM devices
 		WHERE device_fingerprint = $1
 	`
@@ -200,6 +479,8 @@ func (r *UserRepository) GetDeviceByFingerprint(fingerprint string) (*models.Dev
 		&device.OS,
 		&device.Browser,
 		&device.IsTrusted,
+		&device.TrustedUntil,
+		&device.RemovedAt,
 		&device.FirstSeenAt,
 		&device.LastSeenAt,
 		&device.CreatedAt,
@@ -223,13 +504,40 @@ func (r *UserRepository) UpdateDeviceLastSeen(deviceID string) error {
 	return err
 }
 
+// RestoreDevice brings back a device the user previously removed. The device
+// starts over untrusted, with its details refreshed from the current login.
+func (r *UserRepository) RestoreDevice(device *models.Device) error {
+	query := `
+		UPDATE devices
+		SET removed_at = NULL, is_trusted = false, trusted_until = NULL,
+		    device_name = $1, device_type = $2, os = $3, browser = $4, last_seen_at = $5
+		WHERE id = $6
+	`
+
+	_, err := r.db.Exec(
+		query,
+		device.DeviceName,
+		device.DeviceType,
+		device.OS,
+		device.Browser,
+		time.Now(),
+		device.ID,
+	)
+
+	if err != nil {
+		return fmt.Errorf("failed to restore device: %w", err)
+	}
+
+	return nil
+}
+
 // CreateSession creates a new session
 func (r *UserRepository) CreateSession(session *models.Session) error {
 	query := `
 		INSERT INTO sessions (id, user_id, device_id, refresh_token, ip_address, user_agent,
 		                      location_country, location_city, latitude, longitude,
-		                      is_active, expires_at, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		                      is_active, expires_at, created_at, impersonator_id, auth_time, amr)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
 	`
 	
 	_, err := r.db.Exec(
@@ -247,6 +555,9 @@ func (r *UserRepository) CreateSession(session *models.Session) error {
 		session.IsActive,
 		session.ExpiresAt,
 		session.CreatedAt,
+		session.ImpersonatorID,
+		session.AuthTime,
+		pq.Array(session.AMR),
 	)
 	
 	if err != nil {
@@ -261,7 +572,7 @@ func (r *UserRepository) GetSessionByRefreshToken(refreshToken string) (*models.
 	query := `
 		SELECT id, user_id, device_id, refresh_token, ip_address, user_agent,
 		       location_country, location_city, latitude, longitude,
-		       is_active, expires_at, created_at, revoked_at
+		       is_active, expires_at, created_at, revoked_at, impersonator_id, auth_time, amr
 		FROM sessions
 		WHERE refresh_token = $1
 	`
@@ -282,10 +593,13 @@ func (r *UserRepository) GetSessionByRefreshToken(refreshToken string) (*models.
 		&session.ExpiresAt,
 		&session.CreatedAt,
 		&session.RevokedAt,
+		&session.ImpersonatorID,
+		&session.AuthTime,
+		pq.Array(&session.AMR),
 	)
 	
 	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("session not found")
+		return nil, ErrSessionNotFound
 	}
 	
 	if err != nil {
@@ -295,69 +609,266 @@ func (r *UserRepository) GetSessionByRefreshToken(refreshToken string) (*models.
 	return session, nil
 }
 
-// CreateAuditLog creates an audit log entry
-func (r *UserRepository) CreateAuditLog(log *models.AuditLog) error {
+// GetSession retrieves a session by its ID
+func (r *UserRepository) GetSession(sessionID string) (*models.Session, error) {
 	query := `
-		INSERT INTO audit_logs (id, user_id, session_id, device_id, event_type, event_category,
-		                        severity, ip_address, user_agent, location_country, location_city,
-		                        metadata, success, failure_reason, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+		SELECT id, user_id, device_id, refresh_token, ip_address, user_agent,
+		       location_country, location_city, latitude, longitude,
+		       is_active, expires_at, created_at, revoked_at, impersonator_id, auth_time, amr
+		FROM sessions
+		WHERE id = $1
 	`
-	
+
+	session := &models.Session{}
+	err := r.db.QueryRow(query, sessionID).Scan(
+		&session.ID,
+		&session.UserID,
+		&session.DeviceID,
+		&session.RefreshToken,
+		&session.IPAddress,
+		&session.UserAgent,
+		&session.LocationCountry,
+		&session.LocationCity,
+		&session.Latitude,
+		&session.Longitude,
+		&session.IsActive,
+		&session.ExpiresAt,
+		&session.CreatedAt,
+		&session.RevokedAt,
+		&session.ImpersonatorID,
+		&session.AuthTime,
+		pq.Array(&session.AMR),
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+
+	return session, nil
+}
+
+// CreateDeviceTrustToken stores a newly issued device trust token
+func (r *UserRepository) CreateDeviceTrustToken(token *models.DeviceTrustToken) error {
+	query := `
+		INSERT INTO device_trust_tokens (id, user_id, device_id, token_hash, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+
 	_, err := r.db.Exec(
 		query,
-		log.ID,
-		log.UserID,
-		log.SessionID,
-		log.DeviceID,
-		log.EventType,
-		log.EventCategory,
-		log.Severity,
-		log.IPAddress,
-		log.UserAgent,
-		log.LocationCountry,
-		log.LocationCity,
-		log.Metadata,
-		log.Success,
-		log.FailureReason,
-		log.CreatedAt,
+		token.ID,
+		token.UserID,
+		token.DeviceID,
+		token.TokenHash,
+		token.ExpiresAt,
+		token.CreatedAt,
 	)
-	
+
 	if err != nil {
-		return fmt.Errorf("failed to create audit log: %w", err)
+		return fmt.Errorf("failed to create device trust token: %w", err)
 	}
-	
+
 	return nil
 }
 
-// CreateSecurityAlert creates a security alert
-func (r *UserRepository) CreateSecurityAlert(alert *models.SecurityAlert) error {
+// GetDeviceTrustToken retrieves a device trust token by its hash
+func (r *UserRepository) GetDeviceTrustToken(tokenHash string) (*models.DeviceTrustToken, error) {
 	query := `
-		INSERT INTO security_alerts (id, user_id, alert_type, severity, description,
-		                             metadata, ip_address, location_country, location_city,
-		                             is_resolved, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		SELECT id, user_id, device_id, token_hash, expires_at, last_used_at, revoked_at, created_at
+		FROM device_trust_tokens
+		WHERE token_hash = $1
 	`
-	
-	_, err := r.db.Exec(
-		query,
-		alert.ID,
-		alert.UserID,
-		alert.AlertType,
-		alert.Severity,
-		alert.Description,
-		alert.Metadata,
-		alert.IPAddress,
-		alert.LocationCountry,
-		alert.LocationCity,
-		alert.IsResolved,
-		alert.CreatedAt,
+
+	token := &models.DeviceTrustToken{}
+	err := r.db.QueryRow(query, tokenHash).Scan(
+		&token.ID,
+		&token.UserID,
+		&token.DeviceID,
+		&token.TokenHash,
+		&token.ExpiresAt,
+		&token.LastUsedAt,
+		&token.RevokedAt,
+		&token.CreatedAt,
 	)
-	
+
+	if err == sql.ErrNoRows {
+		return nil, nil // Token not found, but not an error
+	}
+
 	if err != nil {
-		return fmt.Errorf("failed to create security alert: %w", err)
+		return nil, fmt.Errorf("failed to get device trust token: %w", err)
 	}
-	
+
+	return token, nil
+}
+
+// UpdateDeviceTrustTokenLastUsed updates the last used timestamp for a device trust token
+func (r *UserRepository) UpdateDeviceTrustTokenLastUsed(tokenID string) error {
+	query := `UPDATE device_trust_tokens SET last_used_at = $1 WHERE id = $2`
+	_, err := r.db.Exec(query, time.Now(), tokenID)
+	return err
+}
+
+// RevokeUserDeviceTrustTokens revokes every outstanding device trust token for a user
+func (r *UserRepository) RevokeUserDeviceTrustTokens(userID string) (int64, error) {
+	query := `
+		UPDATE device_trust_tokens
+		SET revoked_at = $1
+		WHERE user_id = $2 AND revoked_at IS NULL
+	`
+
+	result, err := r.db.Exec(query, time.Now(), userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to revoke device trust tokens: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return rowsAffected, nil
+}
+
+// RevokeDeviceTrustTokens revokes the outstanding device trust tokens a user holds for a device
+func (r *UserRepository) RevokeDeviceTrustTokens(userID, deviceID string) (int64, error) {
+	query := `
+		UPDATE device_trust_tokens
+		SET revoked_at = $1
+		WHERE user_id = $2 AND device_id = $3 AND revoked_at IS NULL
+	`
+
+	result, err := r.db.Exec(query, time.Now(), userID, deviceID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to revoke device trust tokens: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return rowsAffected, nil
+}
+
+// EnqueueAuditEvent stores an audit event in the outbox until it reaches the audit service
+func (r *UserRepository) EnqueueAuditEvent(source string, log *models.AuditLog) error {
+	event, err := json.Marshal(log)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit event: %w", err)
+	}
+
+	query := `
+		INSERT INTO audit_outbox (id, source, event, created_at)
+		VALUES ($1, $2, $3, $4)
+	`
+
+	_, err = r.db.Exec(query, log.ID, source, event, log.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to enqueue audit event: %w", err)
+	}
+
+	return nil
+}
+
+// EnqueueSecurityAlert stores a security alert in the outbox until it reaches the audit service
+func (r *UserRepository) EnqueueSecurityAlert(source string, alert *models.SecurityAlert) error {
+	event, err := json.Marshal(alert)
+	if err != nil {
+		return fmt.Errorf("failed to encode security alert: %w", err)
+	}
+
+	query := `
+		INSERT INTO audit_outbox (id, source, kind, event, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+
+	_, err = r.db.Exec(query, alert.ID, source, models.OutboxKindSecurityAlert, event, alert.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to enqueue security alert: %w", err)
+	}
+
+	return nil
+}
+
+// ClaimAuditEvents returns this source's pending outbox events whose next attempt
+// is due, oldest first, and pushes their next attempt out by lease so another
+// instance won't send them at the same time
+func (r *UserRepository) ClaimAuditEvents(source string, limit int, lease time.Duration) ([]models.AuditOutboxEvent, error) {
+	query := `
+		UPDATE audit_outbox
+		SET next_attempt_at = $1
+		WHERE id IN (
+			SELECT id FROM audit_outbox
+			WHERE source = $2 AND status = 'pending' AND next_attempt_at <= $3
+			ORDER BY created_at
+			LIMIT $4
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, kind, event, attempts, created_at
+	`
+
+	now := time.Now()
+	rows, err := r.db.Query(query, now.Add(lease), source, now, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim audit events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []models.AuditOutboxEvent
+	for rows.Next() {
+		var e models.AuditOutboxEvent
+		var event []byte
+		if err := rows.Scan(&e.ID, &e.Kind, &event, &e.Attempts, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan audit event: %w", err)
+		}
+		decoded := any(&e.Event)
+		if e.Kind == models.OutboxKindSecurityAlert {
+			decoded = &e.Alert
+		}
+		if err := json.Unmarshal(event, decoded); err != nil {
+			return nil, fmt.Errorf("failed to decode %s %s: %w", e.Kind, e.ID, err)
+		}
+		events = append(events, e)
+	}
+
+	// RETURNING gives no ordering guarantee
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].CreatedAt.Before(events[j].CreatedAt)
+	})
+
+	return events, nil
+}
+
+// DeleteAuditEvent removes an event from the outbox once the audit service has it
+func (r *UserRepository) DeleteAuditEvent(eventID string) error {
+	_, err := r.db.Exec(`DELETE FROM audit_outbox WHERE id = $1`, eventID)
+	if err != nil {
+		return fmt.Errorf("failed to delete audit event: %w", err)
+	}
+
+	return nil
+}
+
+// MarkAuditEventFailed records a failed attempt to send an outbox event. The
+// event is retried at nextAttemptAt, or parked as failed when nextAttemptAt is nil
+func (r *UserRepository) MarkAuditEventFailed(eventID string, lastError string, nextAttemptAt *time.Time) error {
+	query := `
+		UPDATE audit_outbox
+		SET attempts = attempts + 1,
+		    last_error = $1,
+		    status = CASE WHEN $2::timestamptz IS NULL THEN 'failed' ELSE 'pending' END,
+		    next_attempt_at = COALESCE($2, next_attempt_at)
+		WHERE id = $3
+	`
+
+	_, err := r.db.Exec(query, lastError, nextAttemptAt, eventID)
+	if err != nil {
+		return fmt.Errorf("failed to mark audit event as failed: %w", err)
+	}
+
 	return nil
 }
 
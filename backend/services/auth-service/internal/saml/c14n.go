@@ -0,0 +1,141 @@
+package saml
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+)
+
+// canonicalizer writes the exclusive canonical form of an element
+// (Exclusive XML Canonicalization 1.0, without comments)
+type canonicalizer struct {
+	buf       bytes.Buffer
+	skip      *element // left out with its subtree, for the enveloped signature transform
+	inclusive []string // prefixes of the InclusiveNamespaces PrefixList
+}
+
+// canonicalize returns the exclusive canonical form of e, leaving out skip.
+// inclusive holds the prefixes handled as by inclusive canonicalization.
+func canonicalize(e *element, skip *element, inclusive []string) []byte {
+	c := &canonicalizer{skip: skip, inclusive: inclusive}
+	c.element(e, map[string]string{})
+	return c.buf.Bytes()
+}
+
+// element writes e. rendered holds the namespace declarations in effect
+// from the output ancestors of e.
+func (c *canonicalizer) element(e *element, rendered map[string]string) {
+	// Only the namespaces the element and its attributes visibly use are
+	// declared, where an output ancestor hasn't already
+	prefixes := []string{e.prefix}
+	for _, a := range e.attrs {
+		if a.prefix != "" {
+			prefixes = append(prefixes, a.prefix)
+		}
+	}
+	for _, prefix := range c.inclusive {
+		if prefix == "#default" {
+			prefix = ""
+		}
+		prefixes = append(prefixes, prefix)
+	}
+
+	var decls []nsDecl
+	inScope := rendered
+	for _, prefix := range prefixes {
+		if prefix == "xml" || hasDecl(decls, prefix) {
+			continue
+		}
+		uri, ok := e.lookupNamespace(prefix)
+		if !ok {
+			continue
+		}
+		previous, wasRendered := rendered[prefix]
+		if wasRendered && previous == uri || !wasRendered && uri == "" {
+			continue
+		}
+		decls = append(decls, nsDecl{prefix: prefix, uri: uri})
+	}
+	if len(decls) > 0 {
+		inScope = make(map[string]string, len(rendered)+len(decls))
+		for prefix, uri := range rendered {
+			inScope[prefix] = uri
+		}
+		for _, decl := range decls {
+			inScope[decl.prefix] = decl.uri
+		}
+	}
+	sort.Slice(decls, func(i, j int) bool { return decls[i].prefix < decls[j].prefix })
+
+	attrs := append([]attribute(nil), e.attrs...)
+	sort.Slice(attrs, func(i, j int) bool {
+		if attrs[i].space != attrs[j].space {
+			return attrs[i].space < attrs[j].space
+		}
+		return attrs[i].name < attrs[j].name
+	})
+
+	c.buf.WriteByte('<')
+	c.buf.WriteString(qualifiedName(e.prefix, e.name))
+	for _, decl := range decls {
+		if decl.prefix == "" {
+			c.buf.WriteString(` xmlns="`)
+		} else {
+			c.buf.WriteString(` xmlns:` + decl.prefix + `="`)
+		}
+		c.buf.WriteString(escapeAttr(decl.uri))
+		c.buf.WriteByte('"')
+	}
+	for _, a := range attrs {
+		c.buf.WriteString(" " + qualifiedName(a.prefix, a.name) + `="`)
+		c.buf.WriteString(escapeAttr(a.value))
+		c.buf.WriteByte('"')
+	}
+	c.buf.WriteByte('>')
+
+	for _, child := range e.children {
+		switch n := child.(type) {
+		case *element:
+			if n != c.skip {
+				c.element(n, inScope)
+			}
+		case charData:
+			c.buf.WriteString(escapeText(string(n)))
+		}
+	}
+
+	c.buf.WriteString("</" + qualifiedName(e.prefix, e.name) + ">")
+}
+
+// hasDecl reports whether decls already declares prefix
+func hasDecl(decls []nsDecl, prefix string) bool {
+	for _, decl := range decls {
+		if decl.prefix == prefix {
+			return true
+		}
+	}
+	return false
+}
+
+// qualifiedName joins a prefix and a local name
+func qualifiedName(prefix, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + ":" + name
+}
+
+var (
+	attrEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", `"`, "&quot;", "\t", "&#x9;", "\n", "&#xA;", "\r", "&#xD;")
+	textEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\r", "&#xD;")
+)
+
+// escapeAttr escapes an attribute value as canonical XML does
+func escapeAttr(s string) string {
+	return attrEscaper.Replace(s)
+}
+
+// escapeText escapes text as canonical XML does
+func escapeText(s string) string {
+	return textEscaper.Replace(s)
+}
@@ -0,0 +1,144 @@
+package saml
+
+import (
+	"testing"
+)
+
+// Known answers from the W3C Canonical XML 1.0 examples (sections 3.3 and
+// 3.4, without their DTD, which parseDocument refuses) and the Exclusive
+// XML Canonicalization 1.0 example of section 2.2, as exclusive
+// canonicalization renders them
+func TestCanonicalizeKnownAnswers(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		path      []string // child element names leading to the canonicalized element
+		inclusive []string
+		want      string
+	}{
+		{
+			name: "start and end tags",
+			input: `<doc>
+   <e1   />
+   <e2   ></e2>
+   <e3   name = "elem3"   id="elem3"   />
+   <e4   name="elem4"   id="elem4"   ></e4>
+   <e5 a:attr="out" b:attr="sorted" attr2="all" attr="I'm"
+      xmlns:b="http://www.ietf.org"
+      xmlns:a="http://www.w3.org"
+      xmlns="http://example.org"/>
+   <e6 xmlns="" xmlns:a="http://www.w3.org">
+      <e7 xmlns="http://www.ietf.org">
+         <e8 xmlns="" xmlns:a="http://www.w3.org">
+            <e9 xmlns="" xmlns:a="http://www.ietf.org"/>
+         </e8>
+      </e7>
+   </e6>
+</doc>`,
+			want: `<doc>
+   <e1></e1>
+   <e2></e2>
+   <e3 id="elem3" name="elem3"></e3>
+   <e4 id="elem4" name="elem4"></e4>
+   <e5 xmlns="http://example.org" xmlns:a="http://www.w3.org" xmlns:b="http://www.ietf.org" attr="I'm" attr2="all" b:attr="sorted" a:attr="out"></e5>
+   <e6>
+      <e7 xmlns="http://www.ietf.org">
+         <e8 xmlns="">
+            <e9></e9>
+         </e8>
+      </e7>
+   </e6>
+</doc>`,
+		},
+		{
+			name: "character modifications and character references",
+			input: `<doc>
+   <text>First line&#x0d;&#10;Second line</text>
+   <value>&#x32;</value>
+   <compute><![CDATA[value>"0" && value<"10" ?"valid":"error"]]></compute>
+   <compute expr='value>"0" &amp;&amp; value&lt;"10" ?"valid":"error"'>valid</compute>
+   <norm attr=' &apos;   &#x20;&#13;&#xa;&#9;   &apos; '/>
+   <normNames attr='   A   &#x20;&#13;&#xa;&#9;   B   '/>
+   <normId id=' &apos;   &#x20;&#13;&#xa;&#9;   &apos; '/>
+</doc>`,
+			want: `<doc>
+   <text>First line&#xD;
+Second line</text>
+   <value>2</value>
+   <compute>value&gt;"0" &amp;&amp; value&lt;"10" ?"valid":"error"</compute>
+   <compute expr="value>&quot;0&quot; &amp;&amp; value&lt;&quot;10&quot; ?&quot;valid&quot;:&quot;error&quot;">valid</compute>
+   <norm attr=" '    &#xD;&#xA;&#x9;   ' "></norm>
+   <normNames attr="   A    &#xD;&#xA;&#x9;   B   "></normNames>
+   <normId id=" '    &#xD;&#xA;&#x9;   ' "></normId>
+</doc>`,
+		},
+		{
+			name: "document subset leaves out unused ancestor namespaces and xml attributes",
+			input: `<n2:pdu xmlns:n1="http://example.com"
+           xmlns:n2="http://foo.example"
+           xml:lang="fr"
+           xml:space="retain">
+   <n1:elem2 xmlns:n1="http://example.net" xml:lang="en">
+       <n3:stuff xmlns:n3="ftp://example.org"/>
+   </n1:elem2>
+</n2:pdu>`,
+			path: []string{"elem2"},
+			want: `<n1:elem2 xmlns:n1="http://example.net" xml:lang="en">
+       <n3:stuff xmlns:n3="ftp://example.org"></n3:stuff>
+   </n1:elem2>`,
+		},
+		{
+			name: "inclusive prefixes are declared although unused",
+			input: `<n2:pdu xmlns:n1="http://example.com"
+           xmlns:n2="http://foo.example"
+           xml:lang="fr"
+           xml:space="retain">
+   <n1:elem2 xmlns:n1="http://example.net" xml:lang="en">
+       <n3:stuff xmlns:n3="ftp://example.org"/>
+   </n1:elem2>
+</n2:pdu>`,
+			path:      []string{"elem2"},
+			inclusive: []string{"n2", "undeclared"},
+			want: `<n1:elem2 xmlns:n1="http://example.net" xmlns:n2="http://foo.example" xml:lang="en">
+       <n3:stuff xmlns:n3="ftp://example.org"></n3:stuff>
+   </n1:elem2>`,
+		},
+		{
+			name:      "inclusive default namespace",
+			input:     `<root xmlns="urn:default"><p:child xmlns:p="urn:p"/></root>`,
+			path:      []string{"child"},
+			inclusive: []string{"#default"},
+			want:      `<p:child xmlns="urn:default" xmlns:p="urn:p"></p:child>`,
+		},
+		{
+			name:  "comments are left out",
+			input: `<NameID>user@example.com<!-- comment -->.evil.example</NameID>`,
+			want:  `<NameID>user@example.com.evil.example</NameID>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := parseDocument([]byte(tt.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, name := range tt.path {
+				var next *element
+				for _, child := range e.children {
+					if c, ok := child.(*element); ok && c.name == name {
+						next = c
+					}
+				}
+				if next == nil {
+					t.Fatalf("no %s element", name)
+				}
+				e = next
+			}
+
+			if got := string(canonicalize(e, nil, tt.inclusive)); got != tt.want {
+				t.Errorf("canonical form:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
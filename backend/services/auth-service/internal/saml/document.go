@@ -0,0 +1,213 @@
+// Package saml is the service provider side of SAML 2.0 Web Browser SSO:
+// it sends authentication requests over the HTTP-Redirect binding and
+// validates the signed assertions identity providers post back. Signatures
+// are checked against the identity provider's configured certificate only,
+// and data is read from the very element whose signature was checked.
+package saml
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// maxDepth caps how deeply elements may nest in a document
+const maxDepth = 64
+
+// xmlNamespace is bound to the xml prefix without being declared
+const xmlNamespace = "http://www.w3.org/XML/1998/namespace"
+
+// element is an element of a parsed document. Names keep the prefix they
+// were written with, which canonicalization needs, and the namespace the
+// prefix resolves to.
+type element struct {
+	prefix   string
+	name     string
+	space    string
+	attrs    []attribute
+	nsDecls  []nsDecl      // declared on this element
+	children []interface{} // *element or charData
+	parent   *element
+}
+
+// attribute is an attribute other than a namespace declaration
+type attribute struct {
+	prefix string
+	name   string
+	space  string // empty for unprefixed attributes
+	value  string
+}
+
+// nsDecl binds a prefix, or the default namespace when empty, to a URI
+type nsDecl struct {
+	prefix string
+	uri    string
+}
+
+// charData is the text between elements
+type charData string
+
+// parseDocument parses a document into its root element. Documents with a
+// DTD are refused, so entities can't be expanded; comments are dropped.
+func parseDocument(data []byte) (*element, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.Strict = true
+
+	var root, current *element
+	depth := 0
+	for {
+		token, err := decoder.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("malformed XML: %w", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if current == nil && root != nil {
+				return nil, errors.New("more than one root element")
+			}
+			depth++
+			if depth > maxDepth {
+				return nil, errors.New("elements nested too deeply")
+			}
+
+			e := &element{prefix: t.Name.Space, name: t.Name.Local, parent: current}
+			for _, a := range t.Attr {
+				switch {
+				case a.Name.Space == "" && a.Name.Local == "xmlns":
+					e.nsDecls = append(e.nsDecls, nsDecl{uri: a.Value})
+				case a.Name.Space == "xmlns":
+					e.nsDecls = append(e.nsDecls, nsDecl{prefix: a.Name.Local, uri: a.Value})
+				default:
+					e.attrs = append(e.attrs, attribute{prefix: a.Name.Space, name: a.Name.Local, value: a.Value})
+				}
+			}
+			if err := e.resolveNames(); err != nil {
+				return nil, err
+			}
+
+			if current == nil {
+				root = e
+			} else {
+				current.children = append(current.children, e)
+			}
+			current = e
+
+		case xml.EndElement:
+			if current == nil || t.Name.Space != current.prefix || t.Name.Local != current.name {
+				return nil, errors.New("mismatched end element")
+			}
+			current = current.parent
+			depth--
+
+		case xml.CharData:
+			if current != nil {
+				current.children = append(current.children, charData(t))
+			} else if len(bytes.TrimSpace(t)) > 0 {
+				return nil, errors.New("text outside the root element")
+			}
+
+		case xml.Directive:
+			return nil, errors.New("DTDs are not allowed")
+
+		case xml.ProcInst:
+			if current != nil || t.Target != "xml" {
+				return nil, errors.New("processing instructions are not allowed")
+			}
+		}
+	}
+
+	if root == nil || current != nil {
+		return nil, errors.New("incomplete document")
+	}
+	return root, nil
+}
+
+// resolveNames resolves the prefixes of the element and its attributes
+func (e *element) resolveNames() error {
+	space, ok := e.lookupNamespace(e.prefix)
+	if !ok {
+		return fmt.Errorf("undeclared namespace prefix %q", e.prefix)
+	}
+	e.space = space
+
+	for i := range e.attrs {
+		a := &e.attrs[i]
+		if a.prefix == "" {
+			continue
+		}
+		if a.space, ok = e.lookupNamespace(a.prefix); !ok || a.space == "" {
+			return fmt.Errorf("undeclared namespace prefix %q", a.prefix)
+		}
+	}
+	return nil
+}
+
+// lookupNamespace returns the URI a prefix is bound to where the element
+// is. The default namespace is "" unless declared.
+func (e *element) lookupNamespace(prefix string) (string, bool) {
+	if prefix == "xml" {
+		return xmlNamespace, true
+	}
+	for n := e; n != nil; n = n.parent {
+		for _, decl := range n.nsDecls {
+			if decl.prefix == prefix {
+				return decl.uri, true
+			}
+		}
+	}
+	return "", prefix == ""
+}
+
+// is reports whether the element has the given namespace and name
+func (e *element) is(space, name string) bool {
+	return e.space == space && e.name == name
+}
+
+// attr returns the value of an unprefixed attribute, or ""
+func (e *element) attr(name string) string {
+	for _, a := range e.attrs {
+		if a.prefix == "" && a.name == name {
+			return a.value
+		}
+	}
+	return ""
+}
+
+// childElements returns the child elements with the given namespace and name
+func (e *element) childElements(space, name string) []*element {
+	var matches []*element
+	for _, child := range e.children {
+		if c, ok := child.(*element); ok && c.is(space, name) {
+			matches = append(matches, c)
+		}
+	}
+	return matches
+}
+
+// child returns the first child element with the given namespace and name
+func (e *element) child(space, name string) *element {
+	for _, child := range e.children {
+		if c, ok := child.(*element); ok && c.is(space, name) {
+			return c
+		}
+	}
+	return nil
+}
+
+// text returns the element's own text, trimmed
+func (e *element) text() string {
+	var b strings.Builder
+	for _, child := range e.children {
+		if text, ok := child.(charData); ok {
+			b.WriteString(string(text))
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
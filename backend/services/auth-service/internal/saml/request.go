@@ -0,0 +1,150 @@
+package saml
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// NewRequestID returns a random ID for an authentication request. IDs
+// must not start with a digit, hence the underscore.
+func NewRequestID() (string, error) {
+	return randomToken("_")
+}
+
+// NewRelayState returns a random relay state, which binds a login to the
+// browser that started it
+func NewRelayState() (string, error) {
+	return randomToken("")
+}
+
+func randomToken(prefix string) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return prefix + hex.EncodeToString(b), nil
+}
+
+type authnRequest struct {
+	XMLName                     xml.Name     `xml:"urn:oasis:names:tc:SAML:2.0:protocol AuthnRequest"`
+	ID                          string       `xml:"ID,attr"`
+	Version                     string       `xml:"Version,attr"`
+	IssueInstant                string       `xml:"IssueInstant,attr"`
+	Destination                 string       `xml:"Destination,attr"`
+	ProtocolBinding             string       `xml:"ProtocolBinding,attr"`
+	AssertionConsumerServiceURL string       `xml:"AssertionConsumerServiceURL,attr"`
+	ForceAuthn                  bool         `xml:"ForceAuthn,attr,omitempty"`
+	Issuer                      issuer       `xml:"urn:oasis:names:tc:SAML:2.0:assertion Issuer"`
+	NameIDPolicy                nameIDPolicy `xml:"NameIDPolicy"`
+}
+
+type issuer struct {
+	Value string `xml:",chardata"`
+}
+
+type nameIDPolicy struct {
+	AllowCreate bool `xml:"AllowCreate,attr"`
+}
+
+// AuthnRequestURL returns the URL that sends the browser to the identity
+// provider with an authentication request, over the HTTP-Redirect binding.
+// Requests are not signed.
+func (sp ServiceProvider) AuthnRequestURL(idp IdentityProvider, requestID, relayState string, now time.Time) (string, error) {
+	return sp.authnRequestURL(idp, requestID, relayState, now, false)
+}
+
+// ReauthnRequestURL is AuthnRequestURL for a user who has to sign in
+// again: ForceAuthn has the identity provider authenticate them even with
+// a session there.
+func (sp ServiceProvider) ReauthnRequestURL(idp IdentityProvider, requestID, relayState string, now time.Time) (string, error) {
+	return sp.authnRequestURL(idp, requestID, relayState, now, true)
+}
+
+func (sp ServiceProvider) authnRequestURL(idp IdentityProvider, requestID, relayState string, now time.Time, forceAuthn bool) (string, error) {
+	request, err := xml.Marshal(authnRequest{
+		ID:                          requestID,
+		Version:                     "2.0",
+		IssueInstant:                now.UTC().Format(time.RFC3339),
+		Destination:                 idp.SSOURL,
+		ProtocolBinding:             bindingPOST,
+		AssertionConsumerServiceURL: sp.ACSURL,
+		Issuer:                      issuer{Value: sp.EntityID},
+		NameIDPolicy:                nameIDPolicy{AllowCreate: true},
+		ForceAuthn:                  forceAuthn,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	var deflated bytes.Buffer
+	w, err := flate.NewWriter(&deflated, flate.BestCompression)
+	if err != nil {
+		return "", err
+	}
+	if _, err := w.Write(request); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(idp.SSOURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid SSO URL: %w", err)
+	}
+	query := u.Query()
+	query.Set("SAMLRequest", base64.StdEncoding.EncodeToString(deflated.Bytes()))
+	query.Set("RelayState", relayState)
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+type entityDescriptor struct {
+	XMLName         xml.Name        `xml:"urn:oasis:names:tc:SAML:2.0:metadata EntityDescriptor"`
+	EntityID        string          `xml:"entityID,attr"`
+	SPSSODescriptor spSSODescriptor `xml:"SPSSODescriptor"`
+}
+
+type spSSODescriptor struct {
+	AuthnRequestsSigned        bool                     `xml:"AuthnRequestsSigned,attr"`
+	WantAssertionsSigned       bool                     `xml:"WantAssertionsSigned,attr"`
+	ProtocolSupportEnumeration string                   `xml:"protocolSupportEnumeration,attr"`
+	NameIDFormats              []string                 `xml:"NameIDFormat"`
+	AssertionConsumerService   assertionConsumerService `xml:"AssertionConsumerService"`
+}
+
+type assertionConsumerService struct {
+	Binding   string `xml:"Binding,attr"`
+	Location  string `xml:"Location,attr"`
+	Index     int    `xml:"index,attr"`
+	IsDefault bool   `xml:"isDefault,attr"`
+}
+
+// Metadata returns the service provider's metadata, for identity providers
+// to import
+func (sp ServiceProvider) Metadata() ([]byte, error) {
+	metadata, err := xml.MarshalIndent(entityDescriptor{
+		EntityID: sp.EntityID,
+		SPSSODescriptor: spSSODescriptor{
+			WantAssertionsSigned:       true,
+			ProtocolSupportEnumeration: nsProtocol,
+			NameIDFormats:              []string{NameIDFormatEmail, NameIDFormatPersistent},
+			AssertionConsumerService: assertionConsumerService{
+				Binding:   bindingPOST,
+				Location:  sp.ACSURL,
+				IsDefault: true,
+			},
+		},
+	}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), metadata...), nil
+}
@@ -0,0 +1,77 @@
+package saml
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/base64"
+	"io"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// decodeAuthnRequest returns the request and relay state of a redirect URL
+func decodeAuthnRequest(t *testing.T, raw string) (string, string) {
+	t.Helper()
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deflated, err := base64.StdEncoding.DecodeString(u.Query().Get("SAMLRequest"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	request, err := io.ReadAll(flate.NewReader(bytes.NewReader(deflated)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(request), u.Query().Get("RelayState")
+}
+
+func TestAuthnRequestURL(t *testing.T) {
+	idp := IdentityProvider{EntityID: testIdPEntityID, SSOURL: "https://idp.example.com/sso?tenant=acme"}
+
+	tests := []struct {
+		name       string
+		build      func(IdentityProvider, string, string) (string, error)
+		forceAuthn bool
+	}{
+		{"login", func(idp IdentityProvider, requestID, relayState string) (string, error) {
+			return testSP.AuthnRequestURL(idp, requestID, relayState, testNow)
+		}, false},
+		{"reauthentication", func(idp IdentityProvider, requestID, relayState string) (string, error) {
+			return testSP.ReauthnRequestURL(idp, requestID, relayState, testNow)
+		}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw, err := tt.build(idp, testRequestID, "relay-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			u, _ := url.Parse(raw)
+			if u.Query().Get("tenant") != "acme" {
+				t.Errorf("URL %s drops the SSO URL's query", raw)
+			}
+
+			request, relayState := decodeAuthnRequest(t, raw)
+			if relayState != "relay-1" {
+				t.Errorf("relay state = %q, want relay-1", relayState)
+			}
+			for _, want := range []string{
+				`ID="` + testRequestID + `"`,
+				`Destination="https://idp.example.com/sso?tenant=acme"`,
+				`AssertionConsumerServiceURL="` + testSP.ACSURL + `"`,
+				testSP.EntityID,
+			} {
+				if !strings.Contains(request, want) {
+					t.Errorf("request %s lacks %s", request, want)
+				}
+			}
+			if got := strings.Contains(request, `ForceAuthn="true"`); got != tt.forceAuthn {
+				t.Errorf("request %s: ForceAuthn set = %v, want %v", request, got, tt.forceAuthn)
+			}
+		})
+	}
+}
@@ -0,0 +1,302 @@
+package saml
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// SAML namespaces, statuses and formats
+const (
+	nsProtocol  = "urn:oasis:names:tc:SAML:2.0:protocol"
+	nsAssertion = "urn:oasis:names:tc:SAML:2.0:assertion"
+
+	statusSuccess = "urn:oasis:names:tc:SAML:2.0:status:Success"
+
+	bindingPOST = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"
+
+	confirmationBearer = "urn:oasis:names:tc:SAML:2.0:cm:bearer"
+
+	NameIDFormatEmail      = "urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress"
+	NameIDFormatPersistent = "urn:oasis:names:tc:SAML:2.0:nameid-format:persistent"
+	NameIDFormatTransient  = "urn:oasis:names:tc:SAML:2.0:nameid-format:transient"
+)
+
+// clockSkew is how far the identity provider's clock may drift from ours
+const clockSkew = 2 * time.Minute
+
+// maxResponseSize caps the size of an encoded response
+const maxResponseSize = 256 << 10
+
+// ServiceProvider identifies this service to identity providers
+type ServiceProvider struct {
+	EntityID string
+	ACSURL   string // where identity providers post responses
+}
+
+// IdentityProvider is an identity provider a tenant has connected
+type IdentityProvider struct {
+	EntityID    string
+	SSOURL      string
+	Certificate *x509.Certificate
+}
+
+// Assertion holds what a validated assertion says about the user
+type Assertion struct {
+	ID           string
+	NameID       string
+	NameIDFormat string
+	SessionIndex string
+	AuthnInstant time.Time // when the user signed in at the identity provider
+	Attributes   map[string][]string
+}
+
+// Attribute returns the first value of an attribute, or ""
+func (a *Assertion) Attribute(name string) string {
+	if values := a.Attributes[name]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// Response is a response posted to the assertion consumer service, not
+// yet validated
+type Response struct {
+	root *element
+}
+
+// DecodeResponse decodes the SAMLResponse form value of the HTTP-POST
+// binding
+func DecodeResponse(encoded string) (*Response, error) {
+	if len(encoded) > maxResponseSize {
+		return nil, errors.New("response too large")
+	}
+	data, err := decodeBase64(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("malformed response encoding: %w", err)
+	}
+	root, err := parseDocument(data)
+	if err != nil {
+		return nil, err
+	}
+	if !root.is(nsProtocol, "Response") {
+		return nil, errors.New("not a SAML response")
+	}
+	return &Response{root: root}, nil
+}
+
+// InResponseTo returns the ID of the request the response claims to answer.
+// It is unverified until the response has been validated.
+func (r *Response) InResponseTo() string {
+	return r.root.attr("InResponseTo")
+}
+
+// Validate checks the response answers requestID and carries exactly one
+// assertion signed by the identity provider for this service provider,
+// and returns that assertion. Unsolicited and encrypted assertions are
+// refused.
+func (r *Response) Validate(sp ServiceProvider, idp IdentityProvider, requestID string, now time.Time) (*Assertion, error) {
+	root := r.root
+	if root.attr("Version") != "2.0" {
+		return nil, errors.New("unsupported SAML version")
+	}
+	if requestID == "" || root.attr("InResponseTo") != requestID {
+		return nil, errors.New("response doesn't answer the login request")
+	}
+	if destination := root.attr("Destination"); destination != "" && destination != sp.ACSURL {
+		return nil, errors.New("response is for another destination")
+	}
+	if issuer := root.child(nsAssertion, "Issuer"); issuer != nil && issuer.text() != idp.EntityID {
+		return nil, errors.New("response is from another issuer")
+	}
+
+	status := root.child(nsProtocol, "Status")
+	if status == nil {
+		return nil, errors.New("response has no status")
+	}
+	if code := status.child(nsProtocol, "StatusCode"); code == nil || code.attr("Value") != statusSuccess {
+		message := ""
+		if m := status.child(nsProtocol, "StatusMessage"); m != nil {
+			message = m.text()
+		}
+		return nil, fmt.Errorf("identity provider reported failure: %s", message)
+	}
+
+	if len(root.childElements(nsAssertion, "EncryptedAssertion")) > 0 {
+		return nil, errors.New("encrypted assertions are not supported")
+	}
+	assertions := root.childElements(nsAssertion, "Assertion")
+	if len(assertions) != 1 {
+		return nil, errors.New("expected exactly one assertion")
+	}
+	assertion := assertions[0]
+
+	// Everything below is read from the assertion whose signature was checked
+	if err := verifySignature(assertion, idp.Certificate); err != nil {
+		return nil, fmt.Errorf("invalid assertion signature: %w", err)
+	}
+	if assertion.attr("Version") != "2.0" {
+		return nil, errors.New("unsupported assertion version")
+	}
+	if issuer := assertion.child(nsAssertion, "Issuer"); issuer == nil || issuer.text() != idp.EntityID {
+		return nil, errors.New("assertion is from another issuer")
+	}
+
+	subject := assertion.child(nsAssertion, "Subject")
+	if subject == nil {
+		return nil, errors.New("assertion has no subject")
+	}
+	if err := checkSubjectConfirmation(subject, sp, requestID, now); err != nil {
+		return nil, err
+	}
+	if err := checkConditions(assertion.child(nsAssertion, "Conditions"), sp, now); err != nil {
+		return nil, err
+	}
+
+	authn := assertion.child(nsAssertion, "AuthnStatement")
+	if authn == nil {
+		return nil, errors.New("assertion has no authentication statement")
+	}
+	if notOnOrAfter := authn.attr("SessionNotOnOrAfter"); notOnOrAfter != "" {
+		expires, err := parseTime(notOnOrAfter)
+		if err != nil || !now.Before(expires.Add(clockSkew)) {
+			return nil, errors.New("identity provider session has expired")
+		}
+	}
+
+	authnInstant, err := parseTime(authn.attr("AuthnInstant"))
+	if err != nil {
+		return nil, errors.New("authentication statement has no valid instant")
+	}
+
+	nameID := subject.child(nsAssertion, "NameID")
+	if nameID == nil || nameID.text() == "" {
+		return nil, errors.New("assertion has no name identifier")
+	}
+	format := nameID.attr("Format")
+	if format == NameIDFormatTransient {
+		return nil, errors.New("transient name identifiers are not supported")
+	}
+
+	result := &Assertion{
+		ID:           assertion.attr("ID"),
+		NameID:       nameID.text(),
+		NameIDFormat: format,
+		SessionIndex: authn.attr("SessionIndex"),
+		AuthnInstant: authnInstant,
+		Attributes:   make(map[string][]string),
+	}
+	for _, statement := range assertion.childElements(nsAssertion, "AttributeStatement") {
+		for _, attribute := range statement.childElements(nsAssertion, "Attribute") {
+			name := attribute.attr("Name")
+			for _, value := range attribute.childElements(nsAssertion, "AttributeValue") {
+				result.Attributes[name] = append(result.Attributes[name], value.text())
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// checkSubjectConfirmation checks the subject can be confirmed as the
+// bearer of an assertion sent to this service provider for requestID
+func checkSubjectConfirmation(subject *element, sp ServiceProvider, requestID string, now time.Time) error {
+	for _, confirmation := range subject.childElements(nsAssertion, "SubjectConfirmation") {
+		if confirmation.attr("Method") != confirmationBearer {
+			continue
+		}
+		data := confirmation.child(nsAssertion, "SubjectConfirmationData")
+		if data == nil {
+			continue
+		}
+		if data.attr("Recipient") != sp.ACSURL || data.attr("InResponseTo") != requestID {
+			continue
+		}
+		notOnOrAfter, err := parseTime(data.attr("NotOnOrAfter"))
+		if err != nil || !now.Before(notOnOrAfter.Add(clockSkew)) {
+			continue
+		}
+		if notBefore := data.attr("NotBefore"); notBefore != "" {
+			if t, err := parseTime(notBefore); err != nil || now.Add(clockSkew).Before(t) {
+				continue
+			}
+		}
+		return nil
+	}
+	return errors.New("assertion has no valid bearer subject confirmation")
+}
+
+// checkConditions checks the assertion is within its validity period and
+// this service provider is in every audience restriction
+func checkConditions(conditions *element, sp ServiceProvider, now time.Time) error {
+	if conditions == nil {
+		return errors.New("assertion has no conditions")
+	}
+	if notBefore := conditions.attr("NotBefore"); notBefore != "" {
+		t, err := parseTime(notBefore)
+		if err != nil || now.Add(clockSkew).Before(t) {
+			return errors.New("assertion is not yet valid")
+		}
+	}
+	if notOnOrAfter := conditions.attr("NotOnOrAfter"); notOnOrAfter != "" {
+		t, err := parseTime(notOnOrAfter)
+		if err != nil || !now.Before(t.Add(clockSkew)) {
+			return errors.New("assertion has expired")
+		}
+	}
+
+	restrictions := conditions.childElements(nsAssertion, "AudienceRestriction")
+	if len(restrictions) == 0 {
+		return errors.New("assertion has no audience restriction")
+	}
+	for _, restriction := range restrictions {
+		found := false
+		for _, audience := range restriction.childElements(nsAssertion, "Audience") {
+			if audience.text() == sp.EntityID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return errors.New("assertion is for another audience")
+		}
+	}
+	return nil
+}
+
+// parseTime parses a SAML timestamp
+func parseTime(value string) (time.Time, error) {
+	return time.Parse(time.RFC3339Nano, value)
+}
+
+// ParseCertificate parses an identity provider's signing certificate, given
+// as PEM or as the bare base64 found in metadata. Only RSA keys are
+// supported.
+func ParseCertificate(value string) (*x509.Certificate, error) {
+	var der []byte
+	if block, _ := pem.Decode([]byte(value)); block != nil {
+		if block.Type != "CERTIFICATE" {
+			return nil, fmt.Errorf("expected a certificate, got %s", block.Type)
+		}
+		der = block.Bytes
+	} else {
+		var err error
+		if der, err = base64.StdEncoding.DecodeString(strings.Join(strings.Fields(value), "")); err != nil {
+			return nil, errors.New("certificate is neither PEM nor base64")
+		}
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("malformed certificate: %w", err)
+	}
+	if _, ok := cert.PublicKey.(*rsa.PublicKey); !ok {
+		return nil, errors.New("only RSA certificates are supported")
+	}
+	return cert, nil
+}
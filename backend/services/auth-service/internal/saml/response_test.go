@@ -0,0 +1,216 @@
+package saml
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	testSP = ServiceProvider{
+		EntityID: "https://sp.example.com/saml/metadata",
+		ACSURL:   "https://sp.example.com/saml/acs",
+	}
+	testNow = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+)
+
+const (
+	testIdPEntityID = "https://idp.example.com"
+	testRequestID   = "_req1"
+)
+
+// assertionFields fill the assertion template
+type assertionFields struct {
+	ID                  string
+	Issuer              string
+	NameID              string
+	NameIDFormat        string
+	Recipient           string
+	InResponseTo        string
+	ConfirmationExpires time.Time
+	NotBefore           time.Time
+	NotOnOrAfter        time.Time
+	Audience            string
+	SessionNotOnOrAfter time.Time
+}
+
+func defaultAssertionFields() assertionFields {
+	return assertionFields{
+		ID:                  "_a1",
+		Issuer:              testIdPEntityID,
+		NameID:              "alice@example.com",
+		NameIDFormat:        NameIDFormatEmail,
+		Recipient:           testSP.ACSURL,
+		InResponseTo:        testRequestID,
+		ConfirmationExpires: testNow.Add(5 * time.Minute),
+		NotBefore:           testNow.Add(-time.Minute),
+		NotOnOrAfter:        testNow.Add(5 * time.Minute),
+		Audience:            testSP.EntityID,
+		SessionNotOnOrAfter: testNow.Add(8 * time.Hour),
+	}
+}
+
+// testAssertion renders an unsigned assertion
+func testAssertion(f assertionFields) string {
+	return fmt.Sprintf(`<saml:Assertion xmlns:saml="%s" xmlns:xs="http://www.w3.org/2001/XMLSchema" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" ID="%s" Version="2.0" IssueInstant="%s">`+
+		`<saml:Issuer>%s</saml:Issuer>`+
+		`<saml:Subject>`+
+		`<saml:NameID Format="%s">%s</saml:NameID>`+
+		`<saml:SubjectConfirmation Method="%s">`+
+		`<saml:SubjectConfirmationData InResponseTo="%s" NotOnOrAfter="%s" Recipient="%s"/>`+
+		`</saml:SubjectConfirmation>`+
+		`</saml:Subject>`+
+		`<saml:Conditions NotBefore="%s" NotOnOrAfter="%s">`+
+		`<saml:AudienceRestriction><saml:Audience>%s</saml:Audience></saml:AudienceRestriction>`+
+		`</saml:Conditions>`+
+		`<saml:AuthnStatement AuthnInstant="%s" SessionIndex="_session1" SessionNotOnOrAfter="%s"/>`+
+		`<saml:AttributeStatement>`+
+		`<saml:Attribute Name="email"><saml:AttributeValue xsi:type="xs:string">alice@example.com</saml:AttributeValue></saml:Attribute>`+
+		`<saml:Attribute Name="groups"><saml:AttributeValue>admins</saml:AttributeValue><saml:AttributeValue>staff</saml:AttributeValue></saml:Attribute>`+
+		`</saml:AttributeStatement>`+
+		`</saml:Assertion>`,
+		nsAssertion, f.ID, formatTime(testNow),
+		f.Issuer,
+		f.NameIDFormat, f.NameID,
+		confirmationBearer,
+		f.InResponseTo, formatTime(f.ConfirmationExpires), f.Recipient,
+		formatTime(f.NotBefore), formatTime(f.NotOnOrAfter),
+		f.Audience,
+		formatTime(testNow), formatTime(f.SessionNotOnOrAfter))
+}
+
+// testResponse wraps assertions in a successful response to testRequestID
+func testResponse(assertions ...string) string {
+	return fmt.Sprintf(`<samlp:Response xmlns:samlp="%s" xmlns:saml="%s" ID="_r1" Version="2.0" IssueInstant="%s" InResponseTo="%s" Destination="%s">`+
+		`<saml:Issuer>%s</saml:Issuer>`+
+		`<samlp:Status><samlp:StatusCode Value="%s"/></samlp:Status>`+
+		`%s`+
+		`</samlp:Response>`,
+		nsProtocol, nsAssertion, formatTime(testNow), testRequestID, testSP.ACSURL,
+		testIdPEntityID,
+		statusSuccess,
+		strings.Join(assertions, ""))
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+func validateFixture(t *testing.T, document string, signer *testSigner) (*Assertion, error) {
+	t.Helper()
+
+	response, err := DecodeResponse(base64.StdEncoding.EncodeToString([]byte(document)))
+	if err != nil {
+		return nil, err
+	}
+	idp := IdentityProvider{EntityID: testIdPEntityID, SSOURL: "https://idp.example.com/sso", Certificate: signer.cert}
+	return response.Validate(testSP, idp, testRequestID, testNow)
+}
+
+func TestValidate(t *testing.T) {
+	signer := newTestSigner(t)
+
+	assertion, err := validateFixture(t, testResponse(signer.sign(t, testAssertion(defaultAssertionFields()), signOptions{})), signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if assertion.ID != "_a1" || assertion.NameID != "alice@example.com" || assertion.NameIDFormat != NameIDFormatEmail ||
+		assertion.SessionIndex != "_session1" || !assertion.AuthnInstant.Equal(testNow) {
+		t.Errorf("unexpected assertion %+v", assertion)
+	}
+	if assertion.Attribute("email") != "alice@example.com" || strings.Join(assertion.Attributes["groups"], ",") != "admins,staff" {
+		t.Errorf("unexpected attributes %v", assertion.Attributes)
+	}
+}
+
+// A comment splitting the NameID is left out of the signed form, so it must
+// not cut the NameID short either
+func TestValidateCommentInjection(t *testing.T) {
+	signer := newTestSigner(t)
+
+	fields := defaultAssertionFields()
+	fields.NameID = "alice@example.com.evil.example"
+	signed := signer.sign(t, testAssertion(fields), signOptions{})
+	injected := strings.Replace(signed, "alice@example.com.evil.example", "alice@example.com<!---->.evil.example", 1)
+
+	assertion, err := validateFixture(t, testResponse(injected), signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assertion.NameID != "alice@example.com.evil.example" {
+		t.Errorf("NameID = %q, want the whole signed value", assertion.NameID)
+	}
+}
+
+func TestValidateRejects(t *testing.T) {
+	signer := newTestSigner(t)
+	sign := func(change func(*assertionFields)) string {
+		fields := defaultAssertionFields()
+		if change != nil {
+			change(&fields)
+		}
+		return signer.sign(t, testAssertion(fields), signOptions{})
+	}
+	signed := sign(nil)
+
+	evilFields := defaultAssertionFields()
+	evilFields.NameID = "admin@example.com"
+	evil := testAssertion(evilFields)
+
+	tests := []struct {
+		name     string
+		document string
+	}{
+		{"unsigned", testResponse(evil)},
+		{"signed assertion next to an unsigned one", testResponse(signed, strings.Replace(evil, `ID="_a1"`, `ID="_a2"`, 1))},
+		{"unsigned assertion before a signed one", testResponse(strings.Replace(evil, `ID="_a1"`, `ID="_a2"`, 1), signed)},
+		{"signed assertion wrapped in an unsigned one with the same ID", testResponse(strings.Replace(evil,
+			"</saml:Subject>", "</saml:Subject><saml:Advice>"+signed+"</saml:Advice>", 1))},
+		{"signature of a wrapped assertion copied into an unsigned one", testResponse(strings.Replace(
+			strings.Replace(evil, `ID="_a1"`, `ID="_evil"`, 1),
+			"</saml:Issuer>", "</saml:Issuer>"+signatureOf(signed)+"<saml:Advice>"+signed+"</saml:Advice>", 1))},
+		{"signed assertion hidden in the response extensions", strings.Replace(testResponse(evil),
+			"<samlp:Status>", "<samlp:Extensions>"+signed+"</samlp:Extensions><samlp:Status>", 1)},
+		{"signature moved below the Subject", testResponse(strings.Replace(
+			strings.Replace(signed, signatureOf(signed), "", 1),
+			"</saml:Subject>", signatureOf(signed)+"</saml:Subject>", 1))},
+		{"SHA-1", testResponse(signer.sign(t, testAssertion(defaultAssertionFields()), signOptions{signatureMethod: algRSASHA1, digestMethod: algDigestSHA1}))},
+		{"expired", testResponse(sign(func(f *assertionFields) { f.NotOnOrAfter = testNow.Add(-clockSkew - time.Second) }))},
+		{"not yet valid", testResponse(sign(func(f *assertionFields) { f.NotBefore = testNow.Add(clockSkew + time.Minute) }))},
+		{"expired subject confirmation", testResponse(sign(func(f *assertionFields) { f.ConfirmationExpires = testNow.Add(-clockSkew - time.Second) }))},
+		{"expired identity provider session", testResponse(sign(func(f *assertionFields) { f.SessionNotOnOrAfter = testNow.Add(-clockSkew - time.Second) }))},
+		{"wrong audience", testResponse(sign(func(f *assertionFields) { f.Audience = "https://other-sp.example.com" }))},
+		{"wrong recipient", testResponse(sign(func(f *assertionFields) { f.Recipient = "https://other-sp.example.com/acs" }))},
+		{"answers another request", testResponse(sign(func(f *assertionFields) { f.InResponseTo = "_req2" }))},
+		{"issued by another identity provider", testResponse(sign(func(f *assertionFields) { f.Issuer = "https://other-idp.example.com" }))},
+		{"transient NameID", testResponse(sign(func(f *assertionFields) { f.NameIDFormat = NameIDFormatTransient }))},
+		{"response answers another request", strings.Replace(testResponse(signed), `InResponseTo="`+testRequestID+`" Destination`, `InResponseTo="_req2" Destination`, 1)},
+		{"response for another destination", strings.Replace(testResponse(signed), `Destination="`+testSP.ACSURL+`"`, `Destination="https://other-sp.example.com/acs"`, 1)},
+		{"failed status", strings.Replace(testResponse(signed), statusSuccess, "urn:oasis:names:tc:SAML:2.0:status:Requester", 1)},
+		{"DTD", `<!DOCTYPE r [<!ENTITY e "alice@example.com">]>` + testResponse(signed)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if assertion, err := validateFixture(t, tt.document, signer); err == nil {
+				t.Errorf("response accepted with NameID %q", assertion.NameID)
+			}
+		})
+	}
+}
+
+func TestValidateAllowsClockSkew(t *testing.T) {
+	signer := newTestSigner(t)
+
+	fields := defaultAssertionFields()
+	fields.NotBefore = testNow.Add(clockSkew - time.Second)
+	fields.NotOnOrAfter = testNow.Add(-clockSkew + time.Second)
+	fields.ConfirmationExpires = testNow.Add(-clockSkew + time.Second)
+
+	if _, err := validateFixture(t, testResponse(signer.sign(t, testAssertion(fields), signOptions{})), signer); err != nil {
+		t.Error(err)
+	}
+}
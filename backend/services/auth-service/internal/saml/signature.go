@@ -0,0 +1,166 @@
+package saml
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	// Registers the hashes signatures may use
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+)
+
+// XML Signature namespaces and algorithms. SHA-1 is not accepted.
+const (
+	nsDSig = "http://www.w3.org/2000/09/xmldsig#"
+
+	algExcC14N      = "http://www.w3.org/2001/10/xml-exc-c14n#"
+	algEnveloped    = "http://www.w3.org/2000/09/xmldsig#enveloped-signature"
+	algRSASHA256    = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"
+	algRSASHA512    = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha512"
+	algDigestSHA256 = "http://www.w3.org/2001/04/xmlenc#sha256"
+	algDigestSHA512 = "http://www.w3.org/2001/04/xmlenc#sha512"
+)
+
+var (
+	signatureHashes = map[string]crypto.Hash{algRSASHA256: crypto.SHA256, algRSASHA512: crypto.SHA512}
+	digestHashes    = map[string]crypto.Hash{algDigestSHA256: crypto.SHA256, algDigestSHA512: crypto.SHA512}
+)
+
+// verifySignature checks the enveloped signature of e with the public key
+// of cert. The signature must be a direct child of e and its one reference
+// must be to e itself, so it covers everything read from e afterwards.
+func verifySignature(e *element, cert *x509.Certificate) error {
+	publicKey, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return errors.New("certificate doesn't hold an RSA key")
+	}
+
+	signatures := e.childElements(nsDSig, "Signature")
+	if len(signatures) != 1 {
+		return errors.New("expected exactly one signature")
+	}
+	signature := signatures[0]
+
+	signedInfo := signature.child(nsDSig, "SignedInfo")
+	if signedInfo == nil {
+		return errors.New("signature has no SignedInfo")
+	}
+
+	c14nMethod := signedInfo.child(nsDSig, "CanonicalizationMethod")
+	if c14nMethod == nil || c14nMethod.attr("Algorithm") != algExcC14N {
+		return errors.New("unsupported canonicalization method")
+	}
+
+	signatureMethod := signedInfo.child(nsDSig, "SignatureMethod")
+	if signatureMethod == nil {
+		return errors.New("signature has no SignatureMethod")
+	}
+	signatureHash, ok := signatureHashes[signatureMethod.attr("Algorithm")]
+	if !ok {
+		return fmt.Errorf("unsupported signature method %q", signatureMethod.attr("Algorithm"))
+	}
+
+	references := signedInfo.childElements(nsDSig, "Reference")
+	if len(references) != 1 {
+		return errors.New("expected exactly one reference")
+	}
+	reference := references[0]
+	id := e.attr("ID")
+	if id == "" || reference.attr("URI") != "#"+id {
+		return errors.New("signature doesn't reference the signed element")
+	}
+
+	inclusive, err := referenceTransforms(reference)
+	if err != nil {
+		return err
+	}
+
+	digestMethod := reference.child(nsDSig, "DigestMethod")
+	if digestMethod == nil {
+		return errors.New("reference has no DigestMethod")
+	}
+	digestHash, ok := digestHashes[digestMethod.attr("Algorithm")]
+	if !ok {
+		return fmt.Errorf("unsupported digest method %q", digestMethod.attr("Algorithm"))
+	}
+	digestValue := reference.child(nsDSig, "DigestValue")
+	if digestValue == nil {
+		return errors.New("reference has no DigestValue")
+	}
+	expectedDigest, err := decodeBase64(digestValue.text())
+	if err != nil {
+		return fmt.Errorf("malformed digest: %w", err)
+	}
+
+	digest := digestHash.New()
+	digest.Write(canonicalize(e, signature, inclusive))
+	if !bytes.Equal(digest.Sum(nil), expectedDigest) {
+		return errors.New("digest doesn't match the signed element")
+	}
+
+	signatureValue := signature.child(nsDSig, "SignatureValue")
+	if signatureValue == nil {
+		return errors.New("signature has no SignatureValue")
+	}
+	signatureBytes, err := decodeBase64(signatureValue.text())
+	if err != nil {
+		return fmt.Errorf("malformed signature value: %w", err)
+	}
+
+	hashed := signatureHash.New()
+	hashed.Write(canonicalize(signedInfo, nil, inclusivePrefixes(c14nMethod)))
+	if err := rsa.VerifyPKCS1v15(publicKey, signatureHash, hashed.Sum(nil), signatureBytes); err != nil {
+		return errors.New("signature doesn't verify with the identity provider's certificate")
+	}
+
+	return nil
+}
+
+// referenceTransforms checks that a reference is transformed by removing
+// the enveloped signature and exclusive canonicalization, and returns the
+// canonicalization's inclusive prefixes
+func referenceTransforms(reference *element) ([]string, error) {
+	transforms := reference.child(nsDSig, "Transforms")
+	if transforms == nil {
+		return nil, errors.New("reference has no transforms")
+	}
+
+	var inclusive []string
+	enveloped, canonical := false, false
+	for _, transform := range transforms.childElements(nsDSig, "Transform") {
+		switch transform.attr("Algorithm") {
+		case algEnveloped:
+			enveloped = true
+		case algExcC14N:
+			canonical = true
+			inclusive = inclusivePrefixes(transform)
+		default:
+			return nil, fmt.Errorf("unsupported transform %q", transform.attr("Algorithm"))
+		}
+	}
+	if !enveloped || !canonical {
+		return nil, errors.New("reference must use the enveloped signature and exclusive canonicalization transforms")
+	}
+
+	return inclusive, nil
+}
+
+// inclusivePrefixes returns the PrefixList of an exclusive canonicalization
+// method or transform
+func inclusivePrefixes(method *element) []string {
+	if list := method.child(algExcC14N, "InclusiveNamespaces"); list != nil {
+		return strings.Fields(list.attr("PrefixList"))
+	}
+	return nil
+}
+
+// decodeBase64 decodes base64 that may be wrapped over several lines
+func decodeBase64(s string) ([]byte, error) {
+	return base64.StdEncoding.DecodeString(strings.Join(strings.Fields(s), ""))
+}
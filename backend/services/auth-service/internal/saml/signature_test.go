@@ -0,0 +1,236 @@
+package saml
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	// Only for signing the SHA-1 fixtures, which must be refused
+	_ "crypto/sha1"
+)
+
+const (
+	algRSASHA1    = "http://www.w3.org/2000/09/xmldsig#rsa-sha1"
+	algDigestSHA1 = "http://www.w3.org/2000/09/xmldsig#sha1"
+)
+
+var testHashes = map[string]crypto.Hash{
+	algRSASHA1:      crypto.SHA1,
+	algRSASHA256:    crypto.SHA256,
+	algRSASHA512:    crypto.SHA512,
+	algDigestSHA1:   crypto.SHA1,
+	algDigestSHA256: crypto.SHA256,
+	algDigestSHA512: crypto.SHA512,
+}
+
+// testSigner is an identity provider signing key and its certificate
+type testSigner struct {
+	key  *rsa.PrivateKey
+	cert *x509.Certificate
+}
+
+func newTestSigner(t *testing.T) *testSigner {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "idp.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testSigner{key: key, cert: cert}
+}
+
+// signOptions change how a fixture is signed; zero values sign it properly
+type signOptions struct {
+	signatureMethod string
+	digestMethod    string
+	referenceURI    string   // defaults to "#" and the element's ID
+	inclusive       []string // InclusiveNamespaces of the reference transform
+}
+
+// sign returns element, a standalone XML element with an ID and an Issuer
+// child, with an enveloped signature inserted right after the Issuer
+func (s *testSigner) sign(t *testing.T, element string, opts signOptions) string {
+	t.Helper()
+
+	if opts.signatureMethod == "" {
+		opts.signatureMethod = algRSASHA256
+	}
+	if opts.digestMethod == "" {
+		opts.digestMethod = algDigestSHA256
+	}
+
+	root, err := parseDocument([]byte(element))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.referenceURI == "" {
+		opts.referenceURI = "#" + root.attr("ID")
+	}
+
+	digest := testHashes[opts.digestMethod].New()
+	digest.Write(canonicalize(root, nil, opts.inclusive))
+
+	inclusiveNamespaces := ""
+	if len(opts.inclusive) > 0 {
+		inclusiveNamespaces = fmt.Sprintf(`<ec:InclusiveNamespaces xmlns:ec="%s" PrefixList="%s"/>`, algExcC14N, strings.Join(opts.inclusive, " "))
+	}
+	signature := fmt.Sprintf(`<ds:Signature xmlns:ds="%s"><ds:SignedInfo>`+
+		`<ds:CanonicalizationMethod Algorithm="%s"/>`+
+		`<ds:SignatureMethod Algorithm="%s"/>`+
+		`<ds:Reference URI="%s"><ds:Transforms>`+
+		`<ds:Transform Algorithm="%s"/>`+
+		`<ds:Transform Algorithm="%s">%s</ds:Transform>`+
+		`</ds:Transforms>`+
+		`<ds:DigestMethod Algorithm="%s"/>`+
+		`<ds:DigestValue>%s</ds:DigestValue>`+
+		`</ds:Reference></ds:SignedInfo>`+
+		`<ds:SignatureValue>SIGNATURE_VALUE</ds:SignatureValue></ds:Signature>`,
+		nsDSig, algExcC14N, opts.signatureMethod, opts.referenceURI, algEnveloped, algExcC14N, inclusiveNamespaces,
+		opts.digestMethod, base64.StdEncoding.EncodeToString(digest.Sum(nil)))
+
+	issuerEnd := strings.Index(element, "</saml:Issuer>") + len("</saml:Issuer>")
+	signed := element[:issuerEnd] + signature + element[issuerEnd:]
+
+	// SignedInfo is canonicalized where it ends up, so sign it in place
+	root, err = parseDocument([]byte(signed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	signedInfo := root.child(nsDSig, "Signature").child(nsDSig, "SignedInfo")
+	hash := testHashes[opts.signatureMethod]
+	hashed := hash.New()
+	hashed.Write(canonicalize(signedInfo, nil, nil))
+	value, err := rsa.SignPKCS1v15(rand.Reader, s.key, hash, hashed.Sum(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return strings.Replace(signed, "SIGNATURE_VALUE", base64.StdEncoding.EncodeToString(value), 1)
+}
+
+// testElement is a minimal signable element
+const testElement = `<saml:Assertion xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" ID="_a1" Version="2.0">` +
+	`<saml:Issuer>https://idp.example.com</saml:Issuer>` +
+	`<saml:Subject><saml:NameID>alice@example.com</saml:NameID></saml:Subject>` +
+	`</saml:Assertion>`
+
+func verifyFixture(t *testing.T, document string, cert *x509.Certificate) error {
+	t.Helper()
+
+	root, err := parseDocument([]byte(document))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return verifySignature(root, cert)
+}
+
+func TestVerifySignature(t *testing.T) {
+	signer := newTestSigner(t)
+
+	tests := []struct {
+		name string
+		opts signOptions
+	}{
+		{"rsa-sha256", signOptions{}},
+		{"rsa-sha512", signOptions{signatureMethod: algRSASHA512, digestMethod: algDigestSHA512}},
+		{"inclusive namespaces", signOptions{inclusive: []string{"saml", "xs"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := verifyFixture(t, signer.sign(t, testElement, tt.opts), signer.cert); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestVerifySignatureRejects(t *testing.T) {
+	signer := newTestSigner(t)
+	otherSigner := newTestSigner(t)
+	signed := signer.sign(t, testElement, signOptions{})
+
+	tests := []struct {
+		name     string
+		document string
+	}{
+		{"SHA-1 signature", signer.sign(t, testElement, signOptions{signatureMethod: algRSASHA1})},
+		{"SHA-1 digest", signer.sign(t, testElement, signOptions{digestMethod: algDigestSHA1})},
+		{"reference to another ID", signer.sign(t, testElement, signOptions{referenceURI: "#_other"})},
+		{"reference to the whole document", signer.sign(t, testElement, signOptions{referenceURI: "#"})},
+		{"signed by another key", otherSigner.sign(t, testElement, signOptions{})},
+		{"unsigned", testElement},
+		{"content changed after signing", strings.Replace(signed, "alice@example.com", "mallory@example.com", 1)},
+		{"ID changed after signing", strings.Replace(signed, `ID="_a1"`, `ID="_a2"`, 1)},
+		{"ID removed", strings.Replace(strings.Replace(signed, `ID="_a1"`, "", 1), `URI="#_a1"`, `URI=""`, 1)},
+		{"signature value changed", strings.Replace(signed, "<ds:SignatureValue>", "<ds:SignatureValue>AAAA", 1)},
+		{"signature not a direct child", strings.Replace(
+			strings.Replace(signed, signatureOf(signed), "", 1),
+			"<saml:Subject>", "<saml:Subject>"+signatureOf(signed), 1)},
+		{"two signatures", strings.Replace(signed, "<saml:Subject>", signatureOf(signed)+"<saml:Subject>", 1)},
+		{"enveloped transform missing", strings.Replace(signed, `<ds:Transform Algorithm="`+algEnveloped+`"/>`, "", 1)},
+		{"inclusive canonicalization", strings.Replace(signed, `<ds:CanonicalizationMethod Algorithm="`+algExcC14N+`"/>`,
+			`<ds:CanonicalizationMethod Algorithm="http://www.w3.org/TR/2001/REC-xml-c14n-20010315"/>`, 1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := verifyFixture(t, tt.document, signer.cert); err == nil {
+				t.Error("signature verified")
+			}
+		})
+	}
+}
+
+// The namespace an inclusive prefix names is covered by the signature even
+// though nothing in the element uses it, e.g. for QNames in attribute values
+func TestVerifySignatureCoversInclusiveNamespaces(t *testing.T) {
+	signer := newTestSigner(t)
+	element := strings.Replace(testElement, `ID="_a1"`, `xmlns:xs="http://www.w3.org/2001/XMLSchema" ID="_a1"`, 1)
+
+	signed := signer.sign(t, element, signOptions{inclusive: []string{"xs"}})
+	if err := verifyFixture(t, signed, signer.cert); err != nil {
+		t.Fatal(err)
+	}
+
+	rebound := strings.Replace(signed, `xmlns:xs="http://www.w3.org/2001/XMLSchema"`, `xmlns:xs="urn:attacker"`, 1)
+	if err := verifyFixture(t, rebound, signer.cert); err == nil {
+		t.Error("signature verified with an inclusive prefix bound to another namespace")
+	}
+
+	// Without the prefix list, the unused declaration isn't signed
+	signed = signer.sign(t, element, signOptions{})
+	rebound = strings.Replace(signed, `xmlns:xs="http://www.w3.org/2001/XMLSchema"`, `xmlns:xs="urn:attacker"`, 1)
+	if err := verifyFixture(t, rebound, signer.cert); err != nil {
+		t.Errorf("unused namespace declaration is signed: %v", err)
+	}
+}
+
+// signatureOf returns the Signature element of a signed fixture
+func signatureOf(document string) string {
+	start := strings.Index(document, "<ds:Signature ")
+	end := strings.Index(document, "</ds:Signature>") + len("</ds:Signature>")
+	return document[start:end]
+}
@@ -0,0 +1,27 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+)
+
+// GenerateDeviceTrustToken generates a random device trust token and its hash.
+// Only the hash is stored; the token itself is handed to the client once.
+func GenerateDeviceTrustToken() (string, string, error) {
+	randomBytes := make([]byte, 32)
+	if _, err := rand.Read(randomBytes); err != nil {
+		return "", "", fmt.Errorf("failed to generate random bytes: %w", err)
+	}
+
+	token := base64.RawURLEncoding.EncodeToString(randomBytes)
+	return token, HashDeviceTrustToken(token), nil
+}
+
+// HashDeviceTrustToken returns the hex-encoded SHA-256 hash of a device trust token
+func HashDeviceTrustToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
@@ -15,8 +16,12 @@ import (
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/reflection"
 
+	"github.com/aashiq-04/session-management-system/backend/services/session-service/internal/audit"
 	"github.com/aashiq-04/session-management-system/backend/services/session-service/internal/handlers"
+	"github.com/aashiq-04/session-management-system/backend/services/session-service/internal/identity"
 	pb "github.com/aashiq-04/session-management-system/backend/services/session-service/proto"
+	auditpb "github.com/aashiq-04/session-management-system/backend/services/session-service/proto/audit"
+	authpb "github.com/aashiq-04/session-management-system/backend/services/session-service/proto/auth"
 )
 
 func main() {
@@ -35,11 +40,53 @@ func main() {
 
 	log.Println("Successfully connected to database")
 
-	// Create gRPC server
-	grpcServer := grpc.NewServer()
+	// Calls between services are authenticated with mTLS, and calls made on
+	// behalf of a user carry an identity token signed by the gateway
+	serverCreds, err := identity.ServerCredentials(config.TLSCertFile, config.TLSKeyFile, config.TLSCAFile)
+	if err != nil {
+		log.Fatalf("Failed to load TLS credentials: %v", err)
+	}
+	clientCreds, err := identity.ClientCredentials(config.TLSCertFile, config.TLSKeyFile, config.TLSCAFile)
+	if err != nil {
+		log.Fatalf("Failed to load TLS credentials: %v", err)
+	}
+	identityKey, err := identity.LoadPublicKey(config.IdentityPublicKeyFile)
+	if err != nil {
+		log.Fatalf("Failed to load identity public key: %v", err)
+	}
+
+	// Audit events are kept in a local outbox and relayed to the audit service,
+	// so they survive the audit service being down
+	auditConn, err := grpc.Dial(config.AuditServiceURL, grpc.WithTransportCredentials(clientCreds))
+	if err != nil {
+		log.Fatalf("Failed to connect to audit service: %v", err)
+	}
+	defer auditConn.Close()
+
+	auditCtx, stopAudit := context.WithCancel(context.Background())
+	defer stopAudit()
+	auditOutbox := audit.NewOutbox(db, auditpb.NewAuditServiceClient(auditConn))
+	go auditOutbox.Run(auditCtx)
+
+	// Device trust tokens belong to the auth service, which revokes them when
+	// a device is untrusted or removed
+	authConn, err := grpc.Dial(config.AuthServiceURL, grpc.WithTransportCredentials(clientCreds))
+	if err != nil {
+		log.Fatalf("Failed to connect to auth service: %v", err)
+	}
+	defer authConn.Close()
+
+	sessionHandler := handlers.NewSessionHandler(db, auditOutbox, authpb.NewAuthServiceClient(authConn), config.DeviceTrustTTL)
+
+	// Create gRPC server; refused calls are recorded as audit events
+	authenticator := identity.NewAuthenticator(handlers.Policy, identity.NewVerifier(identityKey, identity.SessionService), sessionHandler.RecordDenial)
+	grpcServer := grpc.NewServer(
+		grpc.Creds(serverCreds),
+		grpc.UnaryInterceptor(authenticator.UnaryInterceptor()),
+		grpc.StreamInterceptor(authenticator.StreamInterceptor()),
+	)
 
 	// Register session service
-	sessionHandler := handlers.NewSessionHandler(db)
 	pb.RegisterSessionServiceServer(grpcServer, sessionHandler)
 
 	// Enable reflection for grpcurl/grpc-ui
@@ -61,6 +108,7 @@ func main() {
 
 		log.Println("Shutting down Session Service...")
 		grpcServer.GracefulStop()
+		stopAudit()
 		log.Println("Session Service stopped")
 	}()
 
@@ -79,6 +127,12 @@ type Config struct {
 	DBName         string
 	GRPCPort       string
 	AuthServiceURL string
+	AuditServiceURL string
+	TLSCertFile     string
+	TLSKeyFile      string
+	TLSCAFile       string
+	IdentityPublicKeyFile string
+	DeviceTrustTTL time.Duration
 }
 
 // loadConfig loads configuration from environment variables
@@ -91,7 +145,27 @@ func loadConfig() Config {
 		DBName:         getEnv("DB_NAME", "session_management"),
 		GRPCPort:       getEnv("GRPC_PORT", "50052"),
 		AuthServiceURL: getEnv("AUTH_SERVICE_URL", "localhost:50051"),
+		AuditServiceURL: getEnv("AUDIT_SERVICE_URL", "localhost:50053"),
+		TLSCertFile:     getEnv("TLS_CERT_FILE", ""),
+		TLSKeyFile:      getEnv("TLS_KEY_FILE", ""),
+		TLSCAFile:       getEnv("TLS_CA_FILE", ""),
+		IdentityPublicKeyFile: getEnv("IDENTITY_PUBLIC_KEY_FILE", ""),
+	}
+
+	// Certificates and keys are made by scripts/dev-certs.sh in development
+	if config.TLSCertFile == "" || config.TLSKeyFile == "" || config.TLSCAFile == "" {
+		log.Fatal("TLS_CERT_FILE, TLS_KEY_FILE and TLS_CA_FILE environment variables are required")
+	}
+	if config.IdentityPublicKeyFile == "" {
+		log.Fatal("IDENTITY_PUBLIC_KEY_FILE environment variable is required")
+	}
+
+	// Device trust expiry is optional; empty or "0" keeps trust until revoked
+	trustTTL, err := time.ParseDuration(getEnv("DEVICE_TRUST_TTL", "0"))
+	if err != nil {
+		log.Fatalf("Invalid DEVICE_TRUST_TTL: %v", err)
 	}
+	config.DeviceTrustTTL = trustTTL
 
 	return config
 }
@@ -0,0 +1,75 @@
+package authz
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/aashiq-04/session-management-system/backend/services/session-service/internal/identity"
+	"github.com/aashiq-04/session-management-system/backend/services/session-service/internal/identity/identitytest"
+)
+
+// The resource belongs to user-1 of org-1
+func TestRequireOwner(t *testing.T) {
+	gateway := identitytest.NewGateway(t, identity.SessionService)
+	const permission = identity.PermissionSessionsRevoke
+
+	callers := map[string]context.Context{
+		"owner":                          gateway.Authenticate(t, identity.Gateway, gateway.Token(t, "user-1", "org-1")),
+		"same-tenant permission holder":  gateway.Authenticate(t, identity.Gateway, gateway.Token(t, "user-2", "org-1", permission)),
+		"other-tenant permission holder": gateway.Authenticate(t, identity.Gateway, gateway.Token(t, "user-3", "org-2", permission)),
+		"same-tenant user":               gateway.Authenticate(t, identity.Gateway, gateway.Token(t, "user-4", "org-1")),
+		"ops":                            gateway.Authenticate(t, identity.Ops, ""),
+		"service":                        gateway.Authenticate(t, identity.AuthService, ""),
+	}
+
+	tests := []struct {
+		caller     string
+		permission string
+		allowed    bool
+	}{
+		{"owner", permission, true},
+		{"owner", "", true},
+		{"same-tenant permission holder", permission, true},
+		{"same-tenant permission holder", "", false},
+		{"other-tenant permission holder", permission, false},
+		{"same-tenant user", permission, false},
+		{"ops", permission, true},
+		{"ops", "", true},
+		{"service", permission, false},
+	}
+
+	for _, tt := range tests {
+		name := tt.caller + " with no permission"
+		if tt.permission != "" {
+			name = tt.caller + " with " + tt.permission
+		}
+		t.Run(name, func(t *testing.T) {
+			var denials []identity.Denial
+			a := New(func(denial identity.Denial) { denials = append(denials, denial) })
+
+			err := a.RequireOwner(callers[tt.caller], "session", "session-1", "user-1", "org-1", tt.permission)
+			if tt.allowed {
+				if err != nil || len(denials) != 0 {
+					t.Errorf("RequireOwner = %v with denials %+v, want allowed", err, denials)
+				}
+				return
+			}
+
+			if status.Code(err) != codes.PermissionDenied {
+				t.Errorf("RequireOwner = %v, want PermissionDenied", err)
+			}
+			if len(denials) != 1 {
+				t.Fatalf("recorded %d denials, want 1", len(denials))
+			}
+			subject, _ := identity.SubjectFromContext(callers[tt.caller])
+			want := identity.Denial{Subject: subject, Reason: ReasonNotOwner, ResourceType: "session", ResourceID: "session-1"}
+			want.Caller, _ = identity.CallerFromContext(callers[tt.caller])
+			if denials[0] != want {
+				t.Errorf("recorded %+v, want %+v", denials[0], want)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net"
+
+	"github.com/google/uuid"
+
+	"github.com/aashiq-04/session-management-system/backend/services/session-service/internal/grpcerr"
+	"github.com/aashiq-04/session-management-system/backend/services/session-service/internal/identity"
+	"github.com/aashiq-04/session-management-system/backend/services/session-service/internal/models"
+	pb "github.com/aashiq-04/session-management-system/backend/services/session-service/proto"
+)
+
+// SearchSessions searches the sessions of all users, for users with the
+// sessions:read permission. They only see their own organization's
+// sessions; operators see all.
+func (h *SessionHandler) SearchSessions(ctx context.Context, req *pb.SearchSessionsRequest) (*pb.SearchSessionsResponse, error) {
+	log.Printf("SearchSessions request received from %s", identity.ActorFromContext(ctx))
+
+	if req.UserId != "" {
+		if _, err := uuid.Parse(req.UserId); err != nil {
+			return nil, grpcerr.InvalidArgument("Invalid user ID", grpcerr.Field("user_id", "must be a UUID"))
+		}
+	}
+	if req.IpAddress != "" && net.ParseIP(req.IpAddress) == nil {
+		if _, _, err := net.ParseCIDR(req.IpAddress); err != nil {
+			return nil, grpcerr.InvalidArgument("Invalid IP address", grpcerr.Field("ip_address", "must be an IP address or CIDR range"))
+		}
+	}
+
+	limit := int(req.Limit)
+	if limit <= 0 || limit > 100 {
+		limit = 50
+	}
+
+	tenant, _ := identity.TenantFromContext(ctx)
+	filter := models.SessionFilter{
+		OrganizationID: tenant,
+		UserID:         req.UserId,
+		IPAddress:      req.IpAddress,
+		ActiveOnly:     req.ActiveOnly,
+	}
+
+	sessions, totalCount, err := h.repo.SearchSessions(filter, limit, int(req.Offset))
+	if err != nil {
+		log.Printf("Failed to search sessions: %v", err)
+		return nil, grpcerr.Storage("Failed to search sessions", err)
+	}
+
+	pbSessions := make([]*pb.Session, 0, len(sessions))
+	for i := range sessions {
+		pbSessions = append(pbSessions, sessionToProto(&sessions[i]))
+	}
+
+	return &pb.SearchSessionsResponse{
+		Success:    true,
+		Message:    "Sessions retrieved successfully",
+		Sessions:   pbSessions,
+		TotalCount: int32(totalCount),
+	}, nil
+}
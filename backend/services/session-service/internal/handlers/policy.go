@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/aashiq-04/session-management-system/backend/services/session-service/internal/identity"
+	"github.com/aashiq-04/session-management-system/backend/services/session-service/internal/models"
+	pb "github.com/aashiq-04/session-management-system/backend/services/session-service/proto"
+)
+
+// userRule lets the gateway call a method on behalf of the user in its
+// identity token, and operators call it for any user
+var userRule = identity.Rule{Callers: []string{identity.Gateway, identity.Ops}, User: true}
+
+// Policy says who may call each method. Every session method acts on one
+// user's sessions or devices, so all of them need an identity token;
+// searching across users also needs the sessions:read permission.
+var Policy = identity.Policy{
+	pb.SessionService_GetUserSessions_FullMethodName:   userRule,
+	pb.SessionService_GetSessionDetails_FullMethodName: userRule,
+	pb.SessionService_RevokeSession_FullMethodName:     userRule,
+	pb.SessionService_RevokeAllSessions_FullMethodName: userRule,
+	pb.SessionService_GetUserDevices_FullMethodName:    userRule,
+	pb.SessionService_TrustDevice_FullMethodName:       userRule,
+	pb.SessionService_UntrustDevice_FullMethodName:     userRule,
+	pb.SessionService_RenameDevice_FullMethodName:      userRule,
+	pb.SessionService_RemoveDevice_FullMethodName:      userRule,
+	pb.SessionService_GetSessionStats_FullMethodName:   userRule,
+	pb.SessionService_ExportUserData_FullMethodName:    userRule,
+
+	pb.SessionService_SearchSessions_FullMethodName: {Callers: []string{identity.Gateway, identity.Ops}, Permission: identity.PermissionSessionsRead},
+}.WithReflection(identity.Ops)
+
+// RecordDenial records a refused call as an access_denied audit event. The
+// event belongs to the user the call was made for, if any.
+func (h *SessionHandler) RecordDenial(denial identity.Denial) {
+	metadata, _ := json.Marshal(map[string]string{
+		"method":        denial.Method,
+		"caller":        denial.Caller,
+		"resource_type": denial.ResourceType,
+		"resource_id":   denial.ResourceID,
+	})
+	metadataStr := string(metadata)
+
+	var userID *string
+	if denial.Subject != "" {
+		userID = &denial.Subject
+	}
+
+	h.createAuditLog(&models.AuditLog{
+		ID:            uuid.New().String(),
+		UserID:        userID,
+		EventType:     "access_denied",
+		EventCategory: "authorization",
+		Severity:      "warning",
+		Metadata:      &metadataStr,
+		Success:       false,
+		FailureReason: &denial.Reason,
+		CreatedAt:     time.Now(),
+	})
+}
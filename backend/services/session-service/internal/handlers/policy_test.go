@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+
+	"github.com/aashiq-04/session-management-system/backend/services/session-service/internal/audit"
+	"github.com/aashiq-04/session-management-system/backend/services/session-service/internal/identity"
+	"github.com/aashiq-04/session-management-system/backend/services/session-service/internal/identity/identitytest"
+	pb "github.com/aashiq-04/session-management-system/backend/services/session-service/proto"
+)
+
+// access says which of the test callers may call a method. Every call is for
+// user-1 of org-1.
+type access struct {
+	owner       bool // the gateway for user-1, whose roles grant no permissions
+	sameTenant  bool // the gateway for user-2 of org-1, whose roles grant every permission
+	otherTenant bool // the gateway for user-3 of org-2, whose roles grant every permission
+	ops         bool // the ops certificate, on no user's behalf
+	service     bool // the auth service
+}
+
+var (
+	userAccess       = access{owner: true, ops: true}
+	permissionAccess = access{sameTenant: true, otherTenant: true, ops: true}
+)
+
+// The interceptor only checks who may call a method. Which users'
+// resources a permission reaches is up to the handler, through
+// authz.RequireOwner for single resources, so permission holders of other
+// organizations get through here.
+var policyTests = map[string]access{
+	pb.SessionService_GetUserSessions_FullMethodName:   userAccess,
+	pb.SessionService_GetSessionDetails_FullMethodName: userAccess,
+	pb.SessionService_RevokeSession_FullMethodName:     userAccess,
+	pb.SessionService_RevokeAllSessions_FullMethodName: userAccess,
+	pb.SessionService_GetUserDevices_FullMethodName:    userAccess,
+	pb.SessionService_TrustDevice_FullMethodName:       userAccess,
+	pb.SessionService_UntrustDevice_FullMethodName:     userAccess,
+	pb.SessionService_RenameDevice_FullMethodName:      userAccess,
+	pb.SessionService_RemoveDevice_FullMethodName:      userAccess,
+	pb.SessionService_GetSessionStats_FullMethodName:   userAccess,
+	pb.SessionService_ExportUserData_FullMethodName:    userAccess,
+
+	pb.SessionService_SearchSessions_FullMethodName: permissionAccess,
+}
+
+var allPermissions = []string{
+	identity.PermissionUsersRead, identity.PermissionUsersDisable, identity.PermissionUsersDelete,
+	identity.PermissionUsersImpersonate, identity.PermissionSessionsRead, identity.PermissionSessionsRevoke,
+	identity.PermissionAlertsRead, identity.PermissionAlertsResolve, identity.PermissionOrgsManage,
+}
+
+// auditEvent matches the event argument of an audit outbox insert by event type
+type auditEvent string
+
+func (eventType auditEvent) Match(v driver.Value) bool {
+	event, ok := v.([]byte)
+	return ok && bytes.Contains(event, []byte(`"EventType":"`+string(eventType)+`"`))
+}
+
+func TestPolicy(t *testing.T) {
+	gateway := identitytest.NewGateway(t, identity.SessionService)
+
+	type caller struct {
+		name string
+		ctx  context.Context
+		may  func(access) bool
+	}
+	callers := []caller{
+		{"owner", identitytest.Incoming(identity.Gateway, gateway.Token(t, "user-1", "org-1")),
+			func(a access) bool { return a.owner }},
+		{"same-tenant permission holder", identitytest.Incoming(identity.Gateway, gateway.Token(t, "user-2", "org-1", allPermissions...)),
+			func(a access) bool { return a.sameTenant }},
+		{"other-tenant permission holder", identitytest.Incoming(identity.Gateway, gateway.Token(t, "user-3", "org-2", allPermissions...)),
+			func(a access) bool { return a.otherTenant }},
+		{"ops", identitytest.Incoming(identity.Ops, ""),
+			func(a access) bool { return a.ops }},
+		{"auth service", identitytest.Incoming(identity.AuthService, ""),
+			func(a access) bool { return a.service }},
+	}
+
+	for method := range Policy {
+		if _, ok := policyTests[method]; !ok && !strings.HasPrefix(method, "/grpc.reflection.") {
+			t.Errorf("no policy test for %s", method)
+		}
+	}
+
+	for method, want := range policyTests {
+		for _, c := range callers {
+			t.Run(method+"/"+c.name, func(t *testing.T) {
+				h, mock := newPolicyTestHandler(t)
+				interceptor := identity.NewAuthenticator(Policy, gateway.Verifier(), h.RecordDenial).UnaryInterceptor()
+
+				allowed := c.may(want)
+				if !allowed {
+					mock.ExpectExec(regexp.QuoteMeta("INSERT INTO audit_outbox")).
+						WithArgs(sqlmock.AnyArg(), "session-service", auditEvent("access_denied"), sqlmock.AnyArg()).
+						WillReturnResult(sqlmock.NewResult(0, 1))
+				}
+
+				called := false
+				_, err := interceptor(c.ctx, requestFor(t, method, "user-1"), &grpc.UnaryServerInfo{FullMethod: method},
+					func(ctx context.Context, req interface{}) (interface{}, error) {
+						called = true
+						return nil, nil
+					})
+
+				if allowed && (err != nil || !called) {
+					t.Errorf("refused: %v", err)
+				}
+				if !allowed {
+					if code := status.Code(err); called || (code != codes.PermissionDenied && code != codes.Unauthenticated) {
+						t.Errorf("allowed: %v", err)
+					}
+				}
+			})
+		}
+	}
+}
+
+// newPolicyTestHandler returns a handler recording denials in a mock
+// database, which fails the test on any statement not expected of it
+func newPolicyTestHandler(t *testing.T) (*SessionHandler, sqlmock.Sqlmock) {
+	t.Helper()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+		db.Close()
+	})
+
+	return &SessionHandler{audit: audit.NewOutbox(db, nil)}, mock
+}
+
+// requestFor returns an empty request message of method, for userID if it
+// has a user_id field
+func requestFor(t *testing.T, method, userID string) interface{} {
+	t.Helper()
+
+	name := protoreflect.FullName(strings.ReplaceAll(strings.TrimPrefix(method, "/"), "/", "."))
+	descriptor, err := protoregistry.GlobalFiles.FindDescriptorByName(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	messageType, err := protoregistry.GlobalTypes.FindMessageByName(descriptor.(protoreflect.MethodDescriptor).Input().FullName())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	message := messageType.New()
+	if field := message.Descriptor().Fields().ByName("user_id"); field != nil {
+		message.Set(field, protoreflect.ValueOfString(userID))
+	}
+	return message.Interface()
+}
@@ -3,27 +3,53 @@ package handlers
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	pb "github.com/aashiq-04/session-management-system/backend/services/session-service/proto"
+	"github.com/aashiq-04/session-management-system/backend/services/session-service/internal/audit"
+	"github.com/aashiq-04/session-management-system/backend/services/session-service/internal/authz"
+	"github.com/aashiq-04/session-management-system/backend/services/session-service/internal/grpcerr"
+	"github.com/aashiq-04/session-management-system/backend/services/session-service/internal/identity"
 	"github.com/aashiq-04/session-management-system/backend/services/session-service/internal/models"
 	"github.com/aashiq-04/session-management-system/backend/services/session-service/internal/repository"
+	authpb "github.com/aashiq-04/session-management-system/backend/services/session-service/proto/auth"
+)
+
+const (
+	// revokeDeviceTrustTimeout bounds the auth service's revocation of a
+	// device's trust tokens
+	revokeDeviceTrustTimeout = 10 * time.Second
+
+	// revokeDeviceTrustRetryDelay is suggested to clients when the revocation fails
+	revokeDeviceTrustRetryDelay = 5 * time.Second
 )
 
 // SessionHandler implements the SessionService gRPC service
 type SessionHandler struct {
 	pb.UnimplementedSessionServiceServer
-	repo *repository.SessionRepository
+	repo           *repository.SessionRepository
+	audit          *audit.Outbox
+	authz          *authz.Authorizer
+	authClient     authpb.AuthServiceClient // for revoking device trust tokens, which the auth service owns
+	deviceTrustTTL time.Duration            // zero means device trust does not expire
 }
 
 // NewSessionHandler creates a new session handler
-func NewSessionHandler(db *sql.DB) *SessionHandler {
-	return &SessionHandler{
-		repo: repository.NewSessionRepository(db),
+func NewSessionHandler(db *sql.DB, auditOutbox *audit.Outbox, authClient authpb.AuthServiceClient, deviceTrustTTL time.Duration) *SessionHandler {
+	h := &SessionHandler{
+		repo:           repository.NewSessionRepository(db),
+		audit:          auditOutbox,
+		authClient:     authClient,
+		deviceTrustTTL: deviceTrustTTL,
 	}
+	h.authz = authz.New(h.RecordDenial)
+	return h
 }
 
 // GetUserSessions retrieves all sessions for a user
@@ -34,10 +60,7 @@ func (h *SessionHandler) GetUserSessions(ctx context.Context, req *pb.GetUserSes
     sessions, err := h.repo.GetUserSessions(req.UserId, req.IncludeInactive)
     if err != nil {
         log.Printf("Failed to get user sessions: %v", err)
-        return &pb.GetUserSessionsResponse{
-            Success: false,
-            Message: "Failed to retrieve sessions",
-        }, nil
+        return nil, grpcerr.Storage("Failed to retrieve sessions", err)
     }
 
     pbSessions := make([]*pb.Session, 0, len(sessions))
@@ -51,63 +74,7 @@ func (h *SessionHandler) GetUserSessions(ctx context.Context, req *pb.GetUserSes
             activeCount++
         }
 
-        // Device name fallback
-        deviceName := "Unknown Device"
-        if s.DeviceName != nil && *s.DeviceName != "" {
-            deviceName = *s.DeviceName
-        }
-
-        // Device type fallback
-        deviceType := "unknown"
-        if s.DeviceType != nil && *s.DeviceType != "" {
-            deviceType = *s.DeviceType
-        }
-
-        // -------- SAFE LOCATION MERGE ----------
-        var finalLocationCountry string
-        var finalLocationCity string
-
-        if s.LocationCountry != nil {
-            finalLocationCountry = *s.LocationCountry
-        } else {
-            finalLocationCountry = ""
-        }
-
-        if s.LocationCity != nil && *s.LocationCity != "" && s.LocationCountry != nil {
-            finalLocationCity = fmt.Sprintf("%s, %s", *s.LocationCity, *s.LocationCountry)
-        } else if s.LocationCountry != nil {
-            finalLocationCity = *s.LocationCountry
-        } else {
-            finalLocationCity = ""
-        }
-
-        // Last seen logic
-        lastSeen := s.CreatedAt
-        if s.RevokedAt != nil {
-            lastSeen = *s.RevokedAt
-        }
-
-        pbSessions = append(pbSessions, &pb.Session{
-            Id:              s.ID,
-            UserId:          s.UserID,
-            DeviceId:        s.DeviceID,
-            DeviceName:      deviceName,
-            DeviceType:      deviceType,
-            IpAddress:       s.IPAddress,
-            UserAgent:       getStringValue(s.UserAgent),
-
-            // Location safely mapped
-            LocationCountry: finalLocationCountry,
-            LocationCity:    finalLocationCity,
-            Latitude:        getFloat64Value(s.Latitude),
-            Longitude:       getFloat64Value(s.Longitude),
-
-            IsActive:        isActive,
-            CreatedAt:       s.CreatedAt.Format(time.RFC3339),
-            LastSeenAt:      lastSeen.Format(time.RFC3339),
-            ExpiresAt:       s.ExpiresAt.Format(time.RFC3339),
-            IsCurrent:       false,
-        })
+        pbSessions = append(pbSessions, sessionToProto(&s))
     }
 
     return &pb.GetUserSessionsResponse{
@@ -123,21 +90,9 @@ func (h *SessionHandler) GetUserSessions(ctx context.Context, req *pb.GetUserSes
 func (h *SessionHandler) GetSessionDetails(ctx context.Context, req *pb.GetSessionDetailsRequest) (*pb.GetSessionDetailsResponse, error) {
 	log.Printf("GetSessionDetails request received for session: %s", req.SessionId)
 
-	session, err := h.repo.GetSessionByID(req.SessionId)
+	session, err := h.getOwnedSession(ctx, req.SessionId, identity.PermissionSessionsRead)
 	if err != nil {
-		log.Printf("Failed to get session details: %v", err)
-		return &pb.GetSessionDetailsResponse{
-			Success: false,
-			Message: "Session not found",
-		}, nil
-	}
-
-	// Verify user owns this session
-	if session.UserID != req.UserId {
-		return &pb.GetSessionDetailsResponse{
-			Success: false,
-			Message: "Unauthorized",
-		}, nil
+		return nil, err
 	}
 
 	// Check if session is active
@@ -156,7 +111,7 @@ func (h *SessionHandler) GetSessionDetails(ctx context.Context, req *pb.GetSessi
 	pbSession := &pb.Session{
 		Id:              session.ID,
 		UserId:          session.UserID,
-		DeviceId:        session.DeviceID,
+		DeviceId:        getStringValue(session.DeviceID),
 		DeviceName:      deviceName,
 		DeviceType:      deviceType,
 		IpAddress:       session.IPAddress,
@@ -168,6 +123,7 @@ func (h *SessionHandler) GetSessionDetails(ctx context.Context, req *pb.GetSessi
 		IsActive:        isActive,
 		CreatedAt:       session.CreatedAt.Format(time.RFC3339),
 		ExpiresAt:       session.ExpiresAt.Format(time.RFC3339),
+		ImpersonatorId:  getStringValue(session.ImpersonatorID),
 	}
 
 	return &pb.GetSessionDetailsResponse{
@@ -182,41 +138,41 @@ func (h *SessionHandler) RevokeSession(ctx context.Context, req *pb.RevokeSessio
 	log.Printf("RevokeSession request received for session: %s", req.SessionId)
 
 	// Get session to verify ownership
-	session, err := h.repo.GetSessionByID(req.SessionId)
+	session, err := h.getOwnedSession(ctx, req.SessionId, identity.PermissionSessionsRevoke)
 	if err != nil {
-		return &pb.RevokeSessionResponse{
-			Success: false,
-			Message: "Session not found",
-		}, nil
-	}
-
-	// Verify user owns this session
-	if session.UserID != req.UserId {
-		return &pb.RevokeSessionResponse{
-			Success: false,
-			Message: "Unauthorized",
-		}, nil
+		return nil, err
 	}
 
 	// Revoke the session
 	err = h.repo.RevokeSession(req.SessionId)
+	if errors.Is(err, repository.ErrSessionNotFound) {
+		return nil, grpcerr.NotFound("Session not found", "session", req.SessionId)
+	}
 	if err != nil {
 		log.Printf("Failed to revoke session: %v", err)
-		return &pb.RevokeSessionResponse{
-			Success: false,
-			Message: "Failed to revoke session",
-		}, nil
+		return nil, grpcerr.Storage("Failed to revoke session", err)
+	}
+
+	// Create audit log. The event belongs to the session's owner; a session
+	// revoked by someone else, e.g. a security analyst, records who and why.
+	var metadata *string
+	severity := "info"
+	if actor := identity.ActorFromContext(ctx); actor != session.UserID {
+		encoded, _ := json.Marshal(map[string]string{"revoked_by": actor, "reason": req.Reason})
+		metadataStr := string(encoded)
+		metadata = &metadataStr
+		severity = "warning"
 	}
 
-	// Create audit log
 	h.createAuditLog(&models.AuditLog{
 		ID:            uuid.New().String(),
-		UserID:        &req.UserId,
+		UserID:        &session.UserID,
 		SessionID:     &req.SessionId,
 		EventType:     "session_revoked",
 		EventCategory: "session_management",
-		Severity:      "info",
+		Severity:      severity,
 		IPAddress:     &req.RevokedByIp,
+		Metadata:      metadata,
 		Success:       true,
 		CreatedAt:     time.Now(),
 	})
@@ -234,10 +190,7 @@ func (h *SessionHandler) RevokeAllSessions(ctx context.Context, req *pb.RevokeAl
 	count, err := h.repo.RevokeAllSessions(req.UserId, req.ExceptSessionId)
 	if err != nil {
 		log.Printf("Failed to revoke all sessions: %v", err)
-		return &pb.RevokeAllSessionsResponse{
-			Success: false,
-			Message: "Failed to revoke sessions",
-		}, nil
+		return nil, grpcerr.Storage("Failed to revoke sessions", err)
 	}
 
 	// Create audit log
@@ -263,42 +216,22 @@ func (h *SessionHandler) RevokeAllSessions(ctx context.Context, req *pb.RevokeAl
 func (h *SessionHandler) GetUserDevices(ctx context.Context, req *pb.GetUserDevicesRequest) (*pb.GetUserDevicesResponse, error) {
 	log.Printf("GetUserDevices request received for user: %s", req.UserId)
 
-	devices, err := h.repo.GetUserDevices(req.UserId)
+	devices, err := h.repo.GetUserDevices(req.UserId, false)
 	if err != nil {
 		log.Printf("Failed to get user devices: %v", err)
-		return &pb.GetUserDevicesResponse{
-			Success: false,
-			Message: "Failed to retrieve devices",
-		}, nil
+		return nil, grpcerr.Storage("Failed to retrieve devices", err)
 	}
 
 	// Convert to protobuf format
 	pbDevices := make([]*pb.Device, 0, len(devices))
 	trustedCount := 0
 
-	for _, d := range devices {
-		if d.IsTrusted {
+	for i := range devices {
+		pbDevice := deviceToProto(&devices[i])
+		if pbDevice.IsTrusted {
 			trustedCount++
 		}
 
-		deviceName := "Unknown Device"
-		if d.DeviceName != nil && *d.DeviceName != "" {
-			deviceName = *d.DeviceName
-		}
-
-		pbDevice := &pb.Device{
-			Id:                d.ID,
-			UserId:            d.UserID,
-			DeviceFingerprint: d.DeviceFingerprint,
-			DeviceName:        deviceName,
-			DeviceType:        getStringValue(d.DeviceType),
-			Os:                getStringValue(d.OS),
-			Browser:           getStringValue(d.Browser),
-			IsTrusted:         d.IsTrusted,
-			FirstSeenAt:       d.FirstSeenAt.Format(time.RFC3339),
-			LastSeenAt:        d.LastSeenAt.Format(time.RFC3339),
-		}
-
 		pbDevices = append(pbDevices, pbDevice)
 	}
 
@@ -315,13 +248,23 @@ func (h *SessionHandler) GetUserDevices(ctx context.Context, req *pb.GetUserDevi
 func (h *SessionHandler) TrustDevice(ctx context.Context, req *pb.TrustDeviceRequest) (*pb.TrustDeviceResponse, error) {
 	log.Printf("TrustDevice request received for device: %s", req.DeviceId)
 
-	err := h.repo.TrustDevice(req.DeviceId)
+	if _, err := h.getOwnedDevice(ctx, req.DeviceId); err != nil {
+		return nil, err
+	}
+
+	var trustedUntil *time.Time
+	if h.deviceTrustTTL > 0 {
+		expiry := time.Now().Add(h.deviceTrustTTL)
+		trustedUntil = &expiry
+	}
+
+	err := h.repo.TrustDevice(req.DeviceId, trustedUntil)
+	if errors.Is(err, repository.ErrDeviceNotFound) {
+		return nil, grpcerr.NotFound("Device not found", "device", req.DeviceId)
+	}
 	if err != nil {
 		log.Printf("Failed to trust device: %v", err)
-		return &pb.TrustDeviceResponse{
-			Success: false,
-			Message: "Failed to trust device",
-		}, nil
+		return nil, grpcerr.Storage("Failed to trust device", err)
 	}
 
 	// Create audit log
@@ -336,12 +279,185 @@ func (h *SessionHandler) TrustDevice(ctx context.Context, req *pb.TrustDeviceReq
 		CreatedAt:     time.Now(),
 	})
 
+	trustedUntilStr := ""
+	if trustedUntil != nil {
+		trustedUntilStr = trustedUntil.Format(time.RFC3339)
+	}
+
 	return &pb.TrustDeviceResponse{
+		Success:      true,
+		Message:      "Device trusted successfully",
+		TrustedUntil: trustedUntilStr,
+	}, nil
+}
+
+// UntrustDevice removes trust from a device
+func (h *SessionHandler) UntrustDevice(ctx context.Context, req *pb.UntrustDeviceRequest) (*pb.UntrustDeviceResponse, error) {
+	log.Printf("UntrustDevice request received for device: %s", req.DeviceId)
+
+	// Get device to verify ownership
+	device, err := h.getOwnedDevice(ctx, req.DeviceId)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := h.revokeDeviceTrust(ctx, device, "device_untrusted"); err != nil {
+		return nil, err
+	}
+
+	err = h.repo.UntrustDevice(req.DeviceId)
+	if err != nil {
+		log.Printf("Failed to untrust device: %v", err)
+		return nil, grpcerr.Storage("Failed to untrust device", err)
+	}
+
+	// Create audit log
+	h.createAuditLog(&models.AuditLog{
+		ID:            uuid.New().String(),
+		UserID:        &req.UserId,
+		DeviceID:      &req.DeviceId,
+		EventType:     "device_untrusted",
+		EventCategory: "security",
+		Severity:      "info",
+		Success:       true,
+		CreatedAt:     time.Now(),
+	})
+
+	return &pb.UntrustDeviceResponse{
+		Success: true,
+		Message: "Device untrusted successfully",
+	}, nil
+}
+
+// RenameDevice changes the display name of a device
+func (h *SessionHandler) RenameDevice(ctx context.Context, req *pb.RenameDeviceRequest) (*pb.RenameDeviceResponse, error) {
+	log.Printf("RenameDevice request received for device: %s", req.DeviceId)
+
+	name := strings.TrimSpace(req.DeviceName)
+	if name == "" || len(name) > 255 {
+		return nil, grpcerr.InvalidArgument("Device name must be between 1 and 255 characters",
+			grpcerr.Field("device_name", "must be between 1 and 255 characters"))
+	}
+
+	// Get device to verify ownership
+	device, err := h.getOwnedDevice(ctx, req.DeviceId)
+	if err != nil {
+		return nil, err
+	}
+
+	err = h.repo.RenameDevice(req.DeviceId, name)
+	if err != nil {
+		log.Printf("Failed to rename device: %v", err)
+		return nil, grpcerr.Storage("Failed to rename device", err)
+	}
+
+	// Create audit log
+	metadata, _ := json.Marshal(map[string]string{
+		"previous_name": getStringValue(device.DeviceName),
+		"new_name":      name,
+	})
+	metadataStr := string(metadata)
+	h.createAuditLog(&models.AuditLog{
+		ID:            uuid.New().String(),
+		UserID:        &req.UserId,
+		DeviceID:      &req.DeviceId,
+		EventType:     "device_renamed",
+		EventCategory: "security",
+		Severity:      "info",
+		Metadata:      &metadataStr,
+		Success:       true,
+		CreatedAt:     time.Now(),
+	})
+
+	return &pb.RenameDeviceResponse{
 		Success: true,
-		Message: "Device trusted successfully",
+		Message: "Device renamed successfully",
+	}, nil
+}
+
+// RemoveDevice forgets a device and revokes every session on it
+func (h *SessionHandler) RemoveDevice(ctx context.Context, req *pb.RemoveDeviceRequest) (*pb.RemoveDeviceResponse, error) {
+	log.Printf("RemoveDevice request received for device: %s", req.DeviceId)
+
+	// Get device to verify ownership
+	device, err := h.getOwnedDevice(ctx, req.DeviceId)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := h.revokeDeviceTrust(ctx, device, "device_removed"); err != nil {
+		return nil, err
+	}
+
+	sessionIDs, err := h.repo.RemoveDevice(req.DeviceId)
+	if err != nil {
+		log.Printf("Failed to remove device: %v", err)
+		return nil, grpcerr.Storage("Failed to remove device", err)
+	}
+
+	// Create an audit log for every session revoked with the device
+	reasonMetadata := `{"reason":"device_removed"}`
+	for _, sessionID := range sessionIDs {
+		h.createAuditLog(&models.AuditLog{
+			ID:            uuid.New().String(),
+			UserID:        &req.UserId,
+			SessionID:     &sessionID,
+			DeviceID:      &req.DeviceId,
+			EventType:     "session_revoked",
+			EventCategory: "session_management",
+			Severity:      "info",
+			IPAddress:     &req.RevokedByIp,
+			Metadata:      &reasonMetadata,
+			Success:       true,
+			CreatedAt:     time.Now(),
+		})
+	}
+
+	metadata, _ := json.Marshal(map[string]interface{}{
+		"device_name":      getStringValue(device.DeviceName),
+		"revoked_sessions": len(sessionIDs),
+	})
+	metadataStr := string(metadata)
+	h.createAuditLog(&models.AuditLog{
+		ID:            uuid.New().String(),
+		UserID:        &req.UserId,
+		DeviceID:      &req.DeviceId,
+		EventType:     "device_removed",
+		EventCategory: "security",
+		Severity:      "warning",
+		IPAddress:     &req.RevokedByIp,
+		Metadata:      &metadataStr,
+		Success:       true,
+		CreatedAt:     time.Now(),
+	})
+
+	return &pb.RemoveDeviceResponse{
+		Success:      true,
+		Message:      fmt.Sprintf("Device removed and %d session(s) revoked", len(sessionIDs)),
+		RevokedCount: int32(len(sessionIDs)),
 	}, nil
 }
 
+// revokeDeviceTrust has the auth service revoke the device trust tokens of a
+// device before it is untrusted or removed. Revoking first means a failure
+// leaves the device as it was, and the request can simply be retried.
+func (h *SessionHandler) revokeDeviceTrust(ctx context.Context, device *models.Device, reason string) error {
+	revokeCtx, cancel := context.WithTimeout(ctx, revokeDeviceTrustTimeout)
+	defer cancel()
+
+	_, err := h.authClient.RevokeDeviceTrust(revokeCtx, &authpb.RevokeDeviceTrustRequest{
+		UserId:   device.UserID,
+		DeviceId: device.ID,
+		Reason:   reason,
+	})
+	if err != nil {
+		log.Printf("Failed to revoke trust tokens of device %s: %v", device.ID, err)
+		return grpcerr.Unavailable("Failed to revoke the device's trust", revokeDeviceTrustRetryDelay)
+	}
+
+	return nil
+}
+
 // GetSessionStats retrieves session statistics for a user
 func (h *SessionHandler) GetSessionStats(ctx context.Context, req *pb.GetSessionStatsRequest) (*pb.GetSessionStatsResponse, error) {
 	log.Printf("GetSessionStats request received for user: %s", req.UserId)
@@ -349,10 +465,7 @@ func (h *SessionHandler) GetSessionStats(ctx context.Context, req *pb.GetSession
 	stats, err := h.repo.GetSessionStats(req.UserId)
 	if err != nil {
 		log.Printf("Failed to get session stats: %v", err)
-		return &pb.GetSessionStatsResponse{
-			Success: false,
-			Message: "Failed to retrieve statistics",
-		}, nil
+		return nil, grpcerr.Storage("Failed to retrieve statistics", err)
 	}
 
 	lastLogin := ""
@@ -378,6 +491,176 @@ func (h *SessionHandler) GetSessionStats(ctx context.Context, req *pb.GetSession
 	}, nil
 }
 
+// ExportUserData returns a user's sessions and devices, including revoked
+// sessions and removed devices, for their data export
+func (h *SessionHandler) ExportUserData(ctx context.Context, req *pb.ExportUserDataRequest) (*pb.ExportUserDataResponse, error) {
+	log.Printf("ExportUserData request received for user: %s", req.UserId)
+
+	sessions, err := h.repo.GetUserSessions(req.UserId, true)
+	if err != nil {
+		log.Printf("Failed to get user sessions: %v", err)
+		return nil, grpcerr.Storage("Failed to retrieve sessions", err)
+	}
+	pbSessions := make([]*pb.Session, 0, len(sessions))
+	for i := range sessions {
+		pbSessions = append(pbSessions, sessionToProto(&sessions[i]))
+	}
+
+	devices, err := h.repo.GetUserDevices(req.UserId, true)
+	if err != nil {
+		log.Printf("Failed to get user devices: %v", err)
+		return nil, grpcerr.Storage("Failed to retrieve devices", err)
+	}
+	pbDevices := make([]*pb.Device, 0, len(devices))
+	for i := range devices {
+		pbDevices = append(pbDevices, deviceToProto(&devices[i]))
+	}
+
+	return &pb.ExportUserDataResponse{
+		Success:  true,
+		Message:  "User data exported successfully",
+		Sessions: pbSessions,
+		Devices:  pbDevices,
+	}, nil
+}
+
+// sessionToProto converts a session for listing, filling in display
+// fallbacks for missing device and location details
+func sessionToProto(s *models.SessionWithDevice) *pb.Session {
+	// Device name fallback
+	deviceName := "Unknown Device"
+	if s.DeviceName != nil && *s.DeviceName != "" {
+		deviceName = *s.DeviceName
+	}
+
+	// Device type fallback
+	deviceType := "unknown"
+	if s.DeviceType != nil && *s.DeviceType != "" {
+		deviceType = *s.DeviceType
+	}
+
+	// -------- SAFE LOCATION MERGE ----------
+	var finalLocationCountry string
+	var finalLocationCity string
+
+	if s.LocationCountry != nil {
+		finalLocationCountry = *s.LocationCountry
+	} else {
+		finalLocationCountry = ""
+	}
+
+	if s.LocationCity != nil && *s.LocationCity != "" && s.LocationCountry != nil {
+		finalLocationCity = fmt.Sprintf("%s, %s", *s.LocationCity, *s.LocationCountry)
+	} else if s.LocationCountry != nil {
+		finalLocationCity = *s.LocationCountry
+	} else {
+		finalLocationCity = ""
+	}
+
+	// Last seen logic
+	lastSeen := s.CreatedAt
+	if s.RevokedAt != nil {
+		lastSeen = *s.RevokedAt
+	}
+
+	return &pb.Session{
+		Id:              s.ID,
+		UserId:          s.UserID,
+		DeviceId:        getStringValue(s.DeviceID),
+		DeviceName:      deviceName,
+		DeviceType:      deviceType,
+		IpAddress:       s.IPAddress,
+		UserAgent:       getStringValue(s.UserAgent),
+
+		// Location safely mapped
+		LocationCountry: finalLocationCountry,
+		LocationCity:    finalLocationCity,
+		Latitude:        getFloat64Value(s.Latitude),
+		Longitude:       getFloat64Value(s.Longitude),
+
+		IsActive:        s.IsActive && time.Now().Before(s.ExpiresAt),
+		CreatedAt:       s.CreatedAt.Format(time.RFC3339),
+		LastSeenAt:      lastSeen.Format(time.RFC3339),
+		ExpiresAt:       s.ExpiresAt.Format(time.RFC3339),
+		IsCurrent:       false,
+		ImpersonatorId:  getStringValue(s.ImpersonatorID),
+	}
+}
+
+// deviceToProto converts a device to its protobuf form. Trust lapses once
+// trusted_until has passed.
+func deviceToProto(d *models.Device) *pb.Device {
+	isTrusted := d.IsTrusted && (d.TrustedUntil == nil || time.Now().Before(*d.TrustedUntil))
+
+	trustedUntil := ""
+	if isTrusted && d.TrustedUntil != nil {
+		trustedUntil = d.TrustedUntil.Format(time.RFC3339)
+	}
+
+	removedAt := ""
+	if d.RemovedAt != nil {
+		removedAt = d.RemovedAt.Format(time.RFC3339)
+	}
+
+	deviceName := "Unknown Device"
+	if d.DeviceName != nil && *d.DeviceName != "" {
+		deviceName = *d.DeviceName
+	}
+
+	return &pb.Device{
+		Id:                d.ID,
+		UserId:            d.UserID,
+		DeviceFingerprint: d.DeviceFingerprint,
+		DeviceName:        deviceName,
+		DeviceType:        getStringValue(d.DeviceType),
+		Os:                getStringValue(d.OS),
+		Browser:           getStringValue(d.Browser),
+		IsTrusted:         isTrusted,
+		FirstSeenAt:       d.FirstSeenAt.Format(time.RFC3339),
+		LastSeenAt:        d.LastSeenAt.Format(time.RFC3339),
+		TrustedUntil:      trustedUntil,
+		RemovedAt:         removedAt,
+	}
+}
+
+// getOwnedSession loads a session, returning a status error unless it
+// exists and the caller owns it or holds permission
+func (h *SessionHandler) getOwnedSession(ctx context.Context, sessionID, permission string) (*models.SessionWithDevice, error) {
+	session, err := h.repo.GetSessionByID(sessionID)
+	if errors.Is(err, repository.ErrSessionNotFound) {
+		return nil, grpcerr.NotFound("Session not found", "session", sessionID)
+	}
+	if err != nil {
+		log.Printf("Failed to get session: %v", err)
+		return nil, grpcerr.Storage("Failed to get session", err)
+	}
+
+	if err := h.authz.RequireOwner(ctx, "session", sessionID, session.UserID, session.OrganizationID, permission); err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+// getOwnedDevice loads a device, returning a status error unless it exists
+// and the caller may act on it
+func (h *SessionHandler) getOwnedDevice(ctx context.Context, deviceID string) (*models.Device, error) {
+	device, err := h.repo.GetDeviceByID(deviceID)
+	if errors.Is(err, repository.ErrDeviceNotFound) {
+		return nil, grpcerr.NotFound("Device not found", "device", deviceID)
+	}
+	if err != nil {
+		log.Printf("Failed to get device: %v", err)
+		return nil, grpcerr.Storage("Failed to get device", err)
+	}
+
+	if err := h.authz.RequireOwner(ctx, "device", deviceID, device.UserID, device.OrganizationID, ""); err != nil {
+		return nil, err
+	}
+
+	return device, nil
+}
+
 // Helper function to get string value from pointer
 func getStringValue(s *string) string {
 	if s == nil {
@@ -396,9 +679,5 @@ func getFloat64Value(f *float64) float64 {
 
 // Helper function to create audit log
 func (h *SessionHandler) createAuditLog(log *models.AuditLog) {
-	err := h.repo.CreateAuditLog(log)
-	if err != nil {
-		logMsg := fmt.Sprintf("Failed to create audit log: %v", err)
-		fmt.Println(logMsg)
-	}
+	h.audit.Record(log)
 }
\ No newline at end of file
@@ -0,0 +1,108 @@
+// Package identity authenticates gRPC callers. The calling service is
+// identified by the common name of its mTLS client certificate, and the end
+// user on whose behalf it calls, along with their organization, by a
+// short-lived token the gateway signs and sends in the request metadata.
+package identity
+
+import (
+	"context"
+	"crypto/x509"
+	"slices"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// Callers, named by the common name of their client certificate
+const (
+	Gateway        = "gateway"
+	AuthService    = "auth-service"
+	SessionService = "session-service"
+	AuditService   = "audit-service"
+	// Ops is the certificate operators use with grpcurl
+	Ops = "ops"
+)
+
+// Permissions granted by roles, as named in the permissions table
+const (
+	PermissionUsersRead        = "users:read"
+	PermissionUsersDisable     = "users:disable"
+	PermissionUsersDelete      = "users:delete"
+	PermissionUsersImpersonate = "users:impersonate"
+	PermissionSessionsRead     = "sessions:read"
+	PermissionSessionsRevoke   = "sessions:revoke"
+	PermissionAlertsRead       = "alerts:read"
+	PermissionAlertsResolve    = "alerts:resolve"
+	PermissionOrgsManage       = "organizations:manage"
+)
+
+// TokenHeader is the metadata key carrying the identity token
+const TokenHeader = "x-identity-token"
+
+type contextKey int
+
+const (
+	callerKey contextKey = iota
+	subjectKey
+	tenantKey
+	permissionsKey
+)
+
+// CallerFromContext returns the authenticated calling service
+func CallerFromContext(ctx context.Context) (string, bool) {
+	caller, ok := ctx.Value(callerKey).(string)
+	return caller, ok
+}
+
+// SubjectFromContext returns the authenticated end user, if the method
+// requires one
+func SubjectFromContext(ctx context.Context) (string, bool) {
+	subject, ok := ctx.Value(subjectKey).(string)
+	return subject, ok
+}
+
+// TenantFromContext returns the organization of the authenticated end user.
+// Callers acting on no user's behalf, such as operators, have none.
+func TenantFromContext(ctx context.Context) (string, bool) {
+	tenant, ok := ctx.Value(tenantKey).(string)
+	return tenant, ok
+}
+
+// InTenant reports whether the caller may see resources of organizationID:
+// end users only see their own organization's, other callers every one
+func InTenant(ctx context.Context, organizationID string) bool {
+	tenant, ok := TenantFromContext(ctx)
+	return !ok || tenant == organizationID
+}
+
+// ActorFromContext names who is acting, for the audit log: the end user if
+// there is one, otherwise the calling service
+func ActorFromContext(ctx context.Context) string {
+	if subject, ok := SubjectFromContext(ctx); ok {
+		return subject
+	}
+	caller, _ := CallerFromContext(ctx)
+	return caller
+}
+
+// HasPermission reports whether the gateway's identity token grants the
+// end user permission
+func HasPermission(ctx context.Context, permission string) bool {
+	permissions, _ := ctx.Value(permissionsKey).([]string)
+	return slices.Contains(permissions, permission)
+}
+
+// peerCertificate returns the verified client certificate of the caller
+func peerCertificate(ctx context.Context) (*x509.Certificate, bool) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil, false
+	}
+
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(tlsInfo.State.VerifiedChains) == 0 || len(tlsInfo.State.VerifiedChains[0]) == 0 {
+		return nil, false
+	}
+
+	return tlsInfo.State.VerifiedChains[0][0], true
+}
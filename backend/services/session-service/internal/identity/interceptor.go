@@ -0,0 +1,214 @@
+package identity
+
+import (
+	"context"
+	"log"
+	"slices"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/aashiq-04/session-management-system/backend/services/session-service/internal/grpcerr"
+)
+
+// Reasons reported in ErrorInfo when a call is refused
+const (
+	reasonNoClientCertificate = "NO_CLIENT_CERTIFICATE"
+	reasonCallerNotAllowed    = "CALLER_NOT_ALLOWED"
+	reasonMissingToken        = "IDENTITY_TOKEN_MISSING"
+	reasonInvalidToken        = "IDENTITY_TOKEN_INVALID"
+	reasonSubjectMismatch     = "SUBJECT_MISMATCH"
+	reasonMissingPermission   = "PERMISSION_MISSING"
+)
+
+// reflectionMethods are the server reflection streams used by grpcurl
+var reflectionMethods = []string{
+	"/grpc.reflection.v1.ServerReflection/ServerReflectionInfo",
+	"/grpc.reflection.v1alpha.ServerReflection/ServerReflectionInfo",
+}
+
+// Rule says who may call a method
+type Rule struct {
+	// Callers are the services allowed to call the method
+	Callers []string
+	// User requires the gateway to send an identity token, and requests that
+	// carry a user ID to be for the token's subject. Other callers act as
+	// themselves, e.g. operators with the ops certificate.
+	User bool
+	// Permission is required of the user in the gateway's identity token.
+	// Such methods act across users, so the user ID of requests isn't checked
+	// against the token. Other callers are trusted as with User.
+	Permission string
+}
+
+// Policy maps full method names, e.g. "/auth.AuthService/Login", to rules.
+// Methods without a rule can't be called at all.
+type Policy map[string]Rule
+
+// WithReflection allows callers to use server reflection
+func (p Policy) WithReflection(callers ...string) Policy {
+	for _, method := range reflectionMethods {
+		p[method] = Rule{Callers: callers}
+	}
+	return p
+}
+
+// userScoped is implemented by requests made on behalf of a user
+type userScoped interface {
+	GetUserId() string
+}
+
+// Denial describes a refused call
+type Denial struct {
+	Method       string
+	Caller       string
+	Subject      string
+	Reason       string
+	ResourceType string
+	ResourceID   string
+}
+
+// DenialRecorder records refused calls in the audit log
+type DenialRecorder func(Denial)
+
+// Authenticator enforces a policy on every call
+type Authenticator struct {
+	policy   Policy
+	verifier *Verifier
+	record   DenialRecorder
+}
+
+// NewAuthenticator creates an authenticator checking identity tokens with
+// verifier and passing every refused call to record
+func NewAuthenticator(policy Policy, verifier *Verifier, record DenialRecorder) *Authenticator {
+	return &Authenticator{policy: policy, verifier: verifier, record: record}
+}
+
+// UnaryInterceptor authenticates unary calls
+func (a *Authenticator) UnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := a.authenticate(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		if err := a.checkSubject(ctx, info.FullMethod, req); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamInterceptor authenticates streaming calls. The user ID of each
+// received message is checked as it arrives.
+func (a *Authenticator) StreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := a.authenticate(stream.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &authenticatedStream{ServerStream: stream, ctx: ctx, method: info.FullMethod, auth: a})
+	}
+}
+
+// authenticate identifies the caller and, if the method requires one, the
+// user, returning a context carrying both
+func (a *Authenticator) authenticate(ctx context.Context, method string) (context.Context, error) {
+	cert, ok := peerCertificate(ctx)
+	if !ok {
+		a.deny(Denial{Method: method, Reason: reasonNoClientCertificate})
+		return ctx, grpcerr.Unauthenticated("Client certificate required", reasonNoClientCertificate)
+	}
+	caller := cert.Subject.CommonName
+
+	rule, ok := a.policy[method]
+	if !ok || !slices.Contains(rule.Callers, caller) {
+		a.deny(Denial{Method: method, Caller: caller, Reason: reasonCallerNotAllowed})
+		return ctx, grpcerr.PermissionDenied("Caller is not allowed to call this method", reasonCallerNotAllowed)
+	}
+	ctx = context.WithValue(ctx, callerKey, caller)
+
+	if (!rule.User && rule.Permission == "") || caller != Gateway {
+		return ctx, nil
+	}
+
+	tokens := metadata.ValueFromIncomingContext(ctx, TokenHeader)
+	if len(tokens) != 1 {
+		a.deny(Denial{Method: method, Caller: caller, Reason: reasonMissingToken})
+		return ctx, grpcerr.Unauthenticated("Identity token required", reasonMissingToken)
+	}
+
+	claims, err := a.verifier.Verify(tokens[0])
+	if err != nil {
+		log.Printf("Invalid identity token for %s: %v", method, err)
+		a.deny(Denial{Method: method, Caller: caller, Reason: reasonInvalidToken})
+		return ctx, grpcerr.Unauthenticated("Invalid identity token", reasonInvalidToken)
+	}
+
+	if rule.Permission != "" && !slices.Contains(claims.Permissions, rule.Permission) {
+		a.deny(Denial{
+			Method:       method,
+			Caller:       caller,
+			Subject:      claims.Subject,
+			Reason:       reasonMissingPermission,
+			ResourceType: "permission",
+			ResourceID:   rule.Permission,
+		})
+		return ctx, grpcerr.PermissionDenied("Missing permission "+rule.Permission, reasonMissingPermission)
+	}
+
+	ctx = context.WithValue(ctx, subjectKey, claims.Subject)
+	ctx = context.WithValue(ctx, tenantKey, claims.Organization)
+	return context.WithValue(ctx, permissionsKey, claims.Permissions), nil
+}
+
+// checkSubject refuses requests for a user other than the authenticated one,
+// unless the method acts across users
+func (a *Authenticator) checkSubject(ctx context.Context, method string, req interface{}) error {
+	subject, ok := SubjectFromContext(ctx)
+	if !ok || a.policy[method].Permission != "" {
+		return nil
+	}
+
+	scoped, ok := req.(userScoped)
+	if !ok || scoped.GetUserId() == subject {
+		return nil
+	}
+
+	caller, _ := CallerFromContext(ctx)
+	a.deny(Denial{
+		Method:       method,
+		Caller:       caller,
+		Subject:      subject,
+		Reason:       reasonSubjectMismatch,
+		ResourceType: "user",
+		ResourceID:   scoped.GetUserId(),
+	})
+	return grpcerr.PermissionDenied("Request is for a different user", reasonSubjectMismatch)
+}
+
+func (a *Authenticator) deny(denial Denial) {
+	log.Printf("Refused %s from %q for user %q: %s", denial.Method, denial.Caller, denial.Subject, denial.Reason)
+	if a.record != nil {
+		a.record(denial)
+	}
+}
+
+// authenticatedStream carries the authenticated context and checks each
+// received message
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx    context.Context
+	method string
+	auth   *Authenticator
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *authenticatedStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	return s.auth.checkSubject(s.ctx, s.method, m)
+}
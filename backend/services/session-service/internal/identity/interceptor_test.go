@@ -0,0 +1,312 @@
+package identity_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/aashiq-04/session-management-system/backend/services/session-service/internal/identity"
+	"github.com/aashiq-04/session-management-system/backend/services/session-service/internal/identity/identitytest"
+)
+
+// audience is the service the interceptor runs in
+const audience = identity.SessionService
+
+// Methods of the test policy
+const (
+	userMethod       = "/test.Service/GetUser"
+	permissionMethod = "/test.Service/ListUsers"
+	serviceMethod    = "/test.Service/Record"
+)
+
+var testPolicy = identity.Policy{
+	userMethod:       {Callers: []string{identity.Gateway, identity.Ops}, User: true},
+	permissionMethod: {Callers: []string{identity.Gateway, identity.Ops}, Permission: identity.PermissionUsersRead},
+	serviceMethod:    {Callers: []string{identity.AuthService}},
+}
+
+// userRequest is a request on behalf of a user
+type userRequest struct {
+	userID string
+}
+
+func (r *userRequest) GetUserId() string { return r.userID }
+
+func newKey(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// validClaims returns the claims the gateway sends for user-1 of org-1
+func validClaims() *identity.Claims {
+	now := time.Now()
+	return &identity.Claims{
+		Organization: "org-1",
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    identity.Gateway,
+			Subject:   "user-1",
+			Audience:  jwt.ClaimStrings{audience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+		},
+	}
+}
+
+func sign(t *testing.T, key ed25519.PrivateKey, claims *identity.Claims) string {
+	t.Helper()
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims).SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// call runs a call through the unary interceptor, returning the context the
+// handler saw, if it was called, and the denials recorded
+func call(t *testing.T, verifier *identity.Verifier, ctx context.Context, method string, req interface{}) (context.Context, []identity.Denial, error) {
+	t.Helper()
+
+	var denials []identity.Denial
+	interceptor := identity.NewAuthenticator(testPolicy, verifier, func(denial identity.Denial) {
+		denials = append(denials, denial)
+	}).UnaryInterceptor()
+
+	var handlerCtx context.Context
+	_, err := interceptor(ctx, req, &grpc.UnaryServerInfo{FullMethod: method},
+		func(ctx context.Context, req interface{}) (interface{}, error) {
+			handlerCtx = ctx
+			return nil, nil
+		})
+	return handlerCtx, denials, err
+}
+
+func errorReason(err error) string {
+	for _, detail := range status.Convert(err).Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok {
+			return info.Reason
+		}
+	}
+	return ""
+}
+
+func TestInterceptorRefuses(t *testing.T) {
+	key := newKey(t)
+	verifier := identity.NewVerifier(key.Public().(ed25519.PublicKey), audience)
+
+	// token signs validClaims changed by change with key
+	token := func(key ed25519.PrivateKey, change func(*identity.Claims)) string {
+		claims := validClaims()
+		change(claims)
+		return sign(t, key, claims)
+	}
+	twoTokens := metadata.NewIncomingContext(identitytest.Incoming(identity.Gateway, ""),
+		metadata.Pairs(identity.TokenHeader, token(key, func(*identity.Claims) {}), identity.TokenHeader, token(key, func(*identity.Claims) {})))
+	unsigned, err := jwt.NewWithClaims(jwt.SigningMethodNone, validClaims()).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hmac, err := jwt.NewWithClaims(jwt.SigningMethodHS256, validClaims()).SignedString([]byte(key.Public().(ed25519.PublicKey)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		method string
+		code   codes.Code
+		reason string
+	}{
+		{"no client certificate", context.Background(), userMethod, codes.Unauthenticated, "NO_CLIENT_CERTIFICATE"},
+		{"caller not allowed", identitytest.Incoming(identity.AuditService, ""), userMethod, codes.PermissionDenied, "CALLER_NOT_ALLOWED"},
+		{"method without a rule", identitytest.Incoming(identity.Ops, ""), "/test.Service/Unknown", codes.PermissionDenied, "CALLER_NOT_ALLOWED"},
+
+		{"missing token", identitytest.Incoming(identity.Gateway, ""), userMethod, codes.Unauthenticated, "IDENTITY_TOKEN_MISSING"},
+		{"two tokens", twoTokens, userMethod, codes.Unauthenticated, "IDENTITY_TOKEN_MISSING"},
+		{"missing token for a permission", identitytest.Incoming(identity.Gateway, ""), permissionMethod, codes.Unauthenticated, "IDENTITY_TOKEN_MISSING"},
+
+		{"malformed token", identitytest.Incoming(identity.Gateway, "not-a-token"), userMethod, codes.Unauthenticated, "IDENTITY_TOKEN_INVALID"},
+		{"expired token", identitytest.Incoming(identity.Gateway, token(key, func(claims *identity.Claims) {
+			claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+		})), userMethod, codes.Unauthenticated, "IDENTITY_TOKEN_INVALID"},
+		{"token without expiry", identitytest.Incoming(identity.Gateway, token(key, func(claims *identity.Claims) {
+			claims.ExpiresAt = nil
+		})), userMethod, codes.Unauthenticated, "IDENTITY_TOKEN_INVALID"},
+		{"token for another service", identitytest.Incoming(identity.Gateway, token(key, func(claims *identity.Claims) {
+			claims.Audience = jwt.ClaimStrings{"another-service"}
+		})), userMethod, codes.Unauthenticated, "IDENTITY_TOKEN_INVALID"},
+		{"token from another issuer", identitytest.Incoming(identity.Gateway, token(key, func(claims *identity.Claims) {
+			claims.Issuer = identity.Ops
+		})), userMethod, codes.Unauthenticated, "IDENTITY_TOKEN_INVALID"},
+		{"untrusted key", identitytest.Incoming(identity.Gateway, token(newKey(t), func(*identity.Claims) {})),
+			userMethod, codes.Unauthenticated, "IDENTITY_TOKEN_INVALID"},
+		{"unsigned token", identitytest.Incoming(identity.Gateway, unsigned), userMethod, codes.Unauthenticated, "IDENTITY_TOKEN_INVALID"},
+		{"HMAC with the public key", identitytest.Incoming(identity.Gateway, hmac), userMethod, codes.Unauthenticated, "IDENTITY_TOKEN_INVALID"},
+		{"token without subject", identitytest.Incoming(identity.Gateway, token(key, func(claims *identity.Claims) {
+			claims.Subject = ""
+		})), userMethod, codes.Unauthenticated, "IDENTITY_TOKEN_INVALID"},
+		{"token without organization", identitytest.Incoming(identity.Gateway, token(key, func(claims *identity.Claims) {
+			claims.Organization = ""
+		})), userMethod, codes.Unauthenticated, "IDENTITY_TOKEN_INVALID"},
+
+		{"missing permission", identitytest.Incoming(identity.Gateway, token(key, func(claims *identity.Claims) {
+			claims.Permissions = []string{identity.PermissionSessionsRead}
+		})), permissionMethod, codes.PermissionDenied, "PERMISSION_MISSING"},
+		{"request for another user", identitytest.Incoming(identity.Gateway, token(key, func(claims *identity.Claims) {
+			claims.Subject = "user-2"
+		})), userMethod, codes.PermissionDenied, "SUBJECT_MISMATCH"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handlerCtx, denials, err := call(t, verifier, tt.ctx, tt.method, &userRequest{userID: "user-1"})
+
+			if handlerCtx != nil {
+				t.Fatal("handler called")
+			}
+			if status.Code(err) != tt.code || errorReason(err) != tt.reason {
+				t.Errorf("got %v (%s), want %v (%s)", status.Code(err), errorReason(err), tt.code, tt.reason)
+			}
+			if len(denials) != 1 || denials[0].Reason != tt.reason || denials[0].Method != tt.method {
+				t.Errorf("recorded %+v, want one %s denial of %s", denials, tt.reason, tt.method)
+			}
+		})
+	}
+}
+
+func TestInterceptorAllows(t *testing.T) {
+	key := newKey(t)
+	verifier := identity.NewVerifier(key.Public().(ed25519.PublicKey), audience)
+
+	// Clocks may be a few seconds apart
+	skewed := validClaims()
+	skewed.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-2 * time.Second))
+	permitted := validClaims()
+	permitted.Permissions = []string{identity.PermissionUsersRead}
+	permitted.Subject = "admin-1"
+
+	tests := []struct {
+		name        string
+		ctx         context.Context
+		method      string
+		caller      string
+		subject     string // empty when the call is on no user's behalf
+		tenant      string
+		permissions []string
+	}{
+		{"user", identitytest.Incoming(identity.Gateway, sign(t, key, validClaims())), userMethod,
+			identity.Gateway, "user-1", "org-1", nil},
+		{"expired within leeway", identitytest.Incoming(identity.Gateway, sign(t, key, skewed)), userMethod,
+			identity.Gateway, "user-1", "org-1", nil},
+		// Permission holders act across users, so the request's user isn't theirs
+		{"permission holder", identitytest.Incoming(identity.Gateway, sign(t, key, permitted)), permissionMethod,
+			identity.Gateway, "admin-1", "org-1", []string{identity.PermissionUsersRead}},
+		// Other callers act as themselves and need no token
+		{"ops", identitytest.Incoming(identity.Ops, ""), userMethod, identity.Ops, "", "", nil},
+		{"service", identitytest.Incoming(identity.AuthService, ""), serviceMethod, identity.AuthService, "", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, denials, err := call(t, verifier, tt.ctx, tt.method, &userRequest{userID: "user-1"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(denials) != 0 {
+				t.Errorf("recorded %+v", denials)
+			}
+
+			if caller, _ := identity.CallerFromContext(ctx); caller != tt.caller {
+				t.Errorf("caller = %q, want %q", caller, tt.caller)
+			}
+			subject, ok := identity.SubjectFromContext(ctx)
+			if subject != tt.subject || ok != (tt.subject != "") {
+				t.Errorf("subject = %q, %v; want %q", subject, ok, tt.subject)
+			}
+			if tenant, _ := identity.TenantFromContext(ctx); tenant != tt.tenant {
+				t.Errorf("tenant = %q, want %q", tenant, tt.tenant)
+			}
+			for _, permission := range tt.permissions {
+				if !identity.HasPermission(ctx, permission) {
+					t.Errorf("missing permission %s", permission)
+				}
+			}
+		})
+	}
+}
+
+// testStream is a server stream receiving requests for userIDs in turn
+type testStream struct {
+	grpc.ServerStream
+	ctx     context.Context
+	userIDs []string
+}
+
+func (s *testStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *testStream) RecvMsg(m interface{}) error {
+	m.(*userRequest).userID, s.userIDs = s.userIDs[0], s.userIDs[1:]
+	return nil
+}
+
+// Every message of a stream must be for the authenticated user
+func TestStreamInterceptorChecksEveryMessage(t *testing.T) {
+	key := newKey(t)
+	verifier := identity.NewVerifier(key.Public().(ed25519.PublicKey), audience)
+
+	var denials []identity.Denial
+	interceptor := identity.NewAuthenticator(testPolicy, verifier, func(denial identity.Denial) {
+		denials = append(denials, denial)
+	}).StreamInterceptor()
+
+	stream := &testStream{
+		ctx:     identitytest.Incoming(identity.Gateway, sign(t, key, validClaims())),
+		userIDs: []string{"user-1", "user-2"},
+	}
+	err := interceptor(nil, stream, &grpc.StreamServerInfo{FullMethod: userMethod}, func(srv interface{}, stream grpc.ServerStream) error {
+		if subject, _ := identity.SubjectFromContext(stream.Context()); subject != "user-1" {
+			t.Errorf("subject = %q, want user-1", subject)
+		}
+		if err := stream.RecvMsg(&userRequest{}); err != nil {
+			t.Errorf("first message refused: %v", err)
+		}
+		return stream.RecvMsg(&userRequest{})
+	})
+
+	if errorReason(err) != "SUBJECT_MISMATCH" {
+		t.Errorf("got %v, want SUBJECT_MISMATCH", err)
+	}
+	if len(denials) != 1 || denials[0].ResourceID != "user-2" {
+		t.Errorf("recorded %+v, want a denial for user-2", denials)
+	}
+}
+
+// A stream is refused before the handler runs
+func TestStreamInterceptorRefuses(t *testing.T) {
+	verifier := identity.NewVerifier(newKey(t).Public().(ed25519.PublicKey), audience)
+	interceptor := identity.NewAuthenticator(testPolicy, verifier, nil).StreamInterceptor()
+
+	stream := &testStream{ctx: identitytest.Incoming(identity.Gateway, sign(t, newKey(t), validClaims()))}
+	err := interceptor(nil, stream, &grpc.StreamServerInfo{FullMethod: userMethod}, func(interface{}, grpc.ServerStream) error {
+		t.Error("handler called")
+		return nil
+	})
+	if errorReason(err) != "IDENTITY_TOKEN_INVALID" {
+		t.Errorf("got %v, want IDENTITY_TOKEN_INVALID", err)
+	}
+}
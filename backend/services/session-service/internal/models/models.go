@@ -8,7 +8,8 @@ import (
 type Session struct {
 	ID              string     `db:"id"`
 	UserID          string     `db:"user_id"`
-	DeviceID        string     `db:"device_id"`
+	OrganizationID  string     `db:"organization_id"`
+	DeviceID        *string    `db:"device_id"` // nil for impersonation sessions
 	RefreshToken    string     `db:"refresh_token"`
 	IPAddress       string     `db:"ip_address"`
 	UserAgent       *string    `db:"user_agent"`
@@ -20,21 +21,25 @@ type Session struct {
 	ExpiresAt       time.Time  `db:"expires_at"`
 	CreatedAt       time.Time  `db:"created_at"`
 	RevokedAt       *time.Time `db:"revoked_at"`
+	ImpersonatorID  *string    `db:"impersonator_id"` // the admin who opened the session as the user
 }
 
 // Device represents a device that has accessed the system
 type Device struct {
-	ID                string    `db:"id"`
-	UserID            string    `db:"user_id"`
-	DeviceFingerprint string    `db:"device_fingerprint"`
-	DeviceName        *string   `db:"device_name"`
-	DeviceType        *string   `db:"device_type"`
-	OS                *string   `db:"os"`
-	Browser           *string   `db:"browser"`
-	IsTrusted         bool      `db:"is_trusted"`
-	FirstSeenAt       time.Time `db:"first_seen_at"`
-	LastSeenAt        time.Time `db:"last_seen_at"`
-	CreatedAt         time.Time `db:"created_at"`
+	ID                string     `db:"id"`
+	UserID            string     `db:"user_id"`
+	OrganizationID    string     `db:"organization_id"`
+	DeviceFingerprint string     `db:"device_fingerprint"`
+	DeviceName        *string    `db:"device_name"`
+	DeviceType        *string    `db:"device_type"`
+	OS                *string    `db:"os"`
+	Browser           *string    `db:"browser"`
+	IsTrusted         bool       `db:"is_trusted"`
+	TrustedUntil      *time.Time `db:"trusted_until"` // nil means trust does not expire
+	RemovedAt         *time.Time `db:"removed_at"`
+	FirstSeenAt       time.Time  `db:"first_seen_at"`
+	LastSeenAt        time.Time  `db:"last_seen_at"`
+	CreatedAt         time.Time  `db:"created_at"`
 }
 
 // SessionWithDevice combines session and device information
@@ -46,6 +51,15 @@ type SessionWithDevice struct {
 	Browser    *string `db:"browser"`
 }
 
+// SessionFilter narrows a search over all users' sessions. Empty fields
+// match everything.
+type SessionFilter struct {
+	OrganizationID string
+	UserID         string
+	IPAddress      string // an address or a CIDR range
+	ActiveOnly     bool
+}
+
 // AuditLog represents a security event in the system
 type AuditLog struct {
 	ID              string     `db:"id"`
@@ -65,6 +79,14 @@ type AuditLog struct {
 	CreatedAt       time.Time  `db:"created_at"`
 }
 
+// AuditOutboxEvent is an audit event waiting in the outbox to be sent to the audit service
+type AuditOutboxEvent struct {
+	ID        string    `db:"id"`
+	Event     AuditLog  `db:"event"` // JSON encoded
+	Attempts  int       `db:"attempts"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
 // SessionStats represents session statistics
 type SessionStats struct {
 	TotalSessions    int
@@ -2,13 +2,23 @@ package repository
 
 import (
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/aashiq-04/session-management-system/backend/services/session-service/internal/models"
 	// "github.com/google/uuid"
 )
 
+// Errors returned when a lookup or update matches nothing
+var (
+	ErrSessionNotFound = errors.New("session not found")
+	ErrDeviceNotFound  = errors.New("device not found")
+)
+
 // SessionRepository handles database operations for sessions
 type SessionRepository struct {
 	db *sql.DB
@@ -23,9 +33,9 @@ func NewSessionRepository(db *sql.DB) *SessionRepository {
 func (r *SessionRepository) GetUserSessions(userID string, includeInactive bool) ([]models.SessionWithDevice, error) {
 	query := `
 		SELECT 
-			s.id, s.user_id, s.device_id, s.refresh_token, s.ip_address, 
+			s.id, s.user_id, s.organization_id, s.device_id, s.refresh_token, s.ip_address, 
 			s.user_agent, s.location_country, s.location_city, s.latitude, s.longitude,
-			s.is_active, s.expires_at, s.created_at, s.revoked_at,
+			s.is_active, s.expires_at, s.created_at, s.revoked_at, s.impersonator_id,
 			d.device_name, d.device_type, d.os, d.browser
 		FROM sessions s
 		LEFT JOIN devices d ON s.device_id = d.id
@@ -48,9 +58,9 @@ func (r *SessionRepository) GetUserSessions(userID string, includeInactive bool)
 	for rows.Next() {
 		var s models.SessionWithDevice
 		err := rows.Scan(
-			&s.ID, &s.UserID, &s.DeviceID, &s.RefreshToken, &s.IPAddress,
+			&s.ID, &s.UserID, &s.OrganizationID, &s.DeviceID, &s.RefreshToken, &s.IPAddress,
 			&s.UserAgent, &s.LocationCountry, &s.LocationCity, &s.Latitude, &s.Longitude,
-			&s.IsActive, &s.ExpiresAt, &s.CreatedAt, &s.RevokedAt,
+			&s.IsActive, &s.ExpiresAt, &s.CreatedAt, &s.RevokedAt, &s.ImpersonatorID,
 			&s.DeviceName, &s.DeviceType, &s.OS, &s.Browser,
 		)
 		if err != nil {
@@ -62,13 +72,81 @@ func (r *SessionRepository) GetUserSessions(userID string, includeInactive bool)
 	return sessions, nil
 }
 
+// SearchSessions returns a page of sessions of any user matching filter,
+// newest first, and the total number of matches
+func (r *SessionRepository) SearchSessions(filter models.SessionFilter, limit, offset int) ([]models.SessionWithDevice, int, error) {
+	var conditions []string
+	var args []interface{}
+
+	if filter.OrganizationID != "" {
+		args = append(args, filter.OrganizationID)
+		conditions = append(conditions, fmt.Sprintf("s.organization_id = $%d", len(args)))
+	}
+	if filter.UserID != "" {
+		args = append(args, filter.UserID)
+		conditions = append(conditions, fmt.Sprintf("s.user_id = $%d", len(args)))
+	}
+	if filter.IPAddress != "" {
+		args = append(args, filter.IPAddress)
+		conditions = append(conditions, fmt.Sprintf("s.ip_address <<= $%d::inet", len(args)))
+	}
+	if filter.ActiveOnly {
+		conditions = append(conditions, "s.is_active = true AND s.expires_at > NOW()")
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var totalCount int
+	err := r.db.QueryRow(`SELECT COUNT(*) FROM sessions s`+where, args...).Scan(&totalCount)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get count: %w", err)
+	}
+
+	query := `
+		SELECT
+			s.id, s.user_id, s.organization_id, s.device_id, s.refresh_token, s.ip_address,
+			s.user_agent, s.location_country, s.location_city, s.latitude, s.longitude,
+			s.is_active, s.expires_at, s.created_at, s.revoked_at, s.impersonator_id,
+			d.device_name, d.device_type, d.os, d.browser
+		FROM sessions s
+		LEFT JOIN devices d ON s.device_id = d.id
+	` + where + fmt.Sprintf(" ORDER BY s.created_at DESC LIMIT $%d OFFSET $%d", len(args)+1, len(args)+2)
+	args = append(args, limit, offset)
+
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to query sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []models.SessionWithDevice
+	for rows.Next() {
+		var s models.SessionWithDevice
+		err := rows.Scan(
+			&s.ID, &s.UserID, &s.OrganizationID, &s.DeviceID, &s.RefreshToken, &s.IPAddress,
+			&s.UserAgent, &s.LocationCountry, &s.LocationCity, &s.Latitude, &s.Longitude,
+			&s.IsActive, &s.ExpiresAt, &s.CreatedAt, &s.RevokedAt, &s.ImpersonatorID,
+			&s.DeviceName, &s.DeviceType, &s.OS, &s.Browser,
+		)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to scan session: %w", err)
+		}
+		sessions = append(sessions, s)
+	}
+
+	return sessions, totalCount, nil
+}
+
 // GetSessionByID retrieves a specific session
 func (r *SessionRepository) GetSessionByID(sessionID string) (*models.SessionWithDevice, error) {
 	query := `
 		SELECT 
-			s.id, s.user_id, s.device_id, s.refresh_token, s.ip_address, 
+			s.id, s.user_id, s.organization_id, s.device_id, s.refresh_token, s.ip_address, 
 			s.user_agent, s.location_country, s.location_city, s.latitude, s.longitude,
-			s.is_active, s.expires_at, s.created_at, s.revoked_at,
+			s.is_active, s.expires_at, s.created_at, s.revoked_at, s.impersonator_id,
 			d.device_name, d.device_type, d.os, d.browser
 		FROM sessions s
 		LEFT JOIN devices d ON s.device_id = d.id
@@ -77,14 +155,14 @@ func (r *SessionRepository) GetSessionByID(sessionID string) (*models.SessionWit
 	
 	var s models.SessionWithDevice
 	err := r.db.QueryRow(query, sessionID).Scan(
-		&s.ID, &s.UserID, &s.DeviceID, &s.RefreshToken, &s.IPAddress,
+		&s.ID, &s.UserID, &s.OrganizationID, &s.DeviceID, &s.RefreshToken, &s.IPAddress,
 		&s.UserAgent, &s.LocationCountry, &s.LocationCity, &s.Latitude, &s.Longitude,
-		&s.IsActive, &s.ExpiresAt, &s.CreatedAt, &s.RevokedAt,
+		&s.IsActive, &s.ExpiresAt, &s.CreatedAt, &s.RevokedAt, &s.ImpersonatorID,
 		&s.DeviceName, &s.DeviceType, &s.OS, &s.Browser,
 	)
 	
 	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("session not found")
+		return nil, ErrSessionNotFound
 	}
 	
 	if err != nil {
@@ -113,7 +191,7 @@ func (r *SessionRepository) RevokeSession(sessionID string) error {
 	}
 	
 	if rowsAffected == 0 {
-		return fmt.Errorf("session not found")
+		return ErrSessionNotFound
 	}
 	
 	return nil
@@ -153,17 +231,18 @@ func (r *SessionRepository) RevokeAllSessions(userID string, exceptSessionID str
 	return rowsAffected, nil
 }
 
-// GetUserDevices retrieves all devices for a user
-func (r *SessionRepository) GetUserDevices(userID string) ([]models.Device, error) {
+// GetUserDevices retrieves all devices for a user, and optionally the ones
+// they removed
+func (r *SessionRepository) GetUserDevices(userID string, includeRemoved bool) ([]models.Device, error) {
 	query := `
-		SELECT id, user_id, device_fingerprint, device_name, device_type, 
-		       os, browser, is_trusted, first_seen_at, last_seen_at, created_at
+		SELECT id, user_id, organization_id, device_fingerprint, device_name, device_type, 
+		       os, browser, is_trusted, trusted_until, removed_at, first_seen_at, last_seen_at, created_at
 		FROM devices
-		WHERE user_id = $1
+		WHERE user_id = $1 AND ($2 OR removed_at IS NULL)
 		ORDER BY last_seen_at DESC
 	`
 	
-	rows, err := r.db.Query(query, userID)
+	rows, err := r.db.Query(query, userID, includeRemoved)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query devices: %w", err)
 	}
@@ -173,8 +252,8 @@ func (r *SessionRepository) GetUserDevices(userID string) ([]models.Device, erro
 	for rows.Next() {
 		var d models.Device
 		err := rows.Scan(
-			&d.ID, &d.UserID, &d.DeviceFingerprint, &d.DeviceName, &d.DeviceType,
-			&d.OS, &d.Browser, &d.IsTrusted, &d.FirstSeenAt, &d.LastSeenAt, &d.CreatedAt,
+			&d.ID, &d.UserID, &d.OrganizationID, &d.DeviceFingerprint, &d.DeviceName, &d.DeviceType,
+			&d.OS, &d.Browser, &d.IsTrusted, &d.TrustedUntil, &d.RemovedAt, &d.FirstSeenAt, &d.LastSeenAt, &d.CreatedAt,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan device: %w", err)
@@ -185,11 +264,39 @@ func (r *SessionRepository) GetUserDevices(userID string) ([]models.Device, erro
 	return devices, nil
 }
 
-// TrustDevice marks a device as trusted
-func (r *SessionRepository) TrustDevice(deviceID string) error {
-	query := `UPDATE devices SET is_trusted = true WHERE id = $1`
+// GetDeviceByID retrieves a device that has not been removed
+func (r *SessionRepository) GetDeviceByID(deviceID string) (*models.Device, error) {
+	query := `
+		SELECT id, user_id, organization_id, device_fingerprint, device_name, device_type,
+		       os, browser, is_trusted, trusted_until, removed_at,
+		       first_seen_at, last_seen_at, created_at
+		FROM devices
+		WHERE id = $1 AND removed_at IS NULL
+	`
+
+	var d models.Device
+	err := r.db.QueryRow(query, deviceID).Scan(
+		&d.ID, &d.UserID, &d.OrganizationID, &d.DeviceFingerprint, &d.DeviceName, &d.DeviceType,
+		&d.OS, &d.Browser, &d.IsTrusted, &d.TrustedUntil, &d.RemovedAt,
+		&d.FirstSeenAt, &d.LastSeenAt, &d.CreatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, ErrDeviceNotFound
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device: %w", err)
+	}
+
+	return &d, nil
+}
+
+// TrustDevice marks a device as trusted until the given time (nil means no expiry)
+func (r *SessionRepository) TrustDevice(deviceID string, trustedUntil *time.Time) error {
+	query := `UPDATE devices SET is_trusted = true, trusted_until = $1 WHERE id = $2 AND removed_at IS NULL`
 	
-	result, err := r.db.Exec(query, deviceID)
+	result, err := r.db.Exec(query, trustedUntil, deviceID)
 	if err != nil {
 		return fmt.Errorf("failed to trust device: %w", err)
 	}
@@ -200,12 +307,112 @@ func (r *SessionRepository) TrustDevice(deviceID string) error {
 	}
 	
 	if rowsAffected == 0 {
-		return fmt.Errorf("device not found")
+		return ErrDeviceNotFound
 	}
 	
 	return nil
 }
 
+// UntrustDevice removes trust from a device. Its device trust tokens are
+// revoked by the auth service, which owns them.
+func (r *SessionRepository) UntrustDevice(deviceID string) error {
+	query := `UPDATE devices SET is_trusted = false, trusted_until = NULL WHERE id = $1 AND removed_at IS NULL`
+
+	result, err := r.db.Exec(query, deviceID)
+	if err != nil {
+		return fmt.Errorf("failed to untrust device: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrDeviceNotFound
+	}
+
+	return nil
+}
+
+// RenameDevice updates the display name of a device
+func (r *SessionRepository) RenameDevice(deviceID string, name string) error {
+	query := `UPDATE devices SET device_name = $1 WHERE id = $2 AND removed_at IS NULL`
+
+	result, err := r.db.Exec(query, name, deviceID)
+	if err != nil {
+		return fmt.Errorf("failed to rename device: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrDeviceNotFound
+	}
+
+	return nil
+}
+
+// RemoveDevice revokes every active session on a device and marks the device
+// as removed. It returns the IDs of the sessions that were revoked.
+func (r *SessionRepository) RemoveDevice(deviceID string) ([]string, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+
+	rows, err := tx.Query(`
+		UPDATE sessions
+		SET is_active = false, revoked_at = $1
+		WHERE device_id = $2 AND is_active = true
+		RETURNING id
+	`, now, deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to revoke device sessions: %w", err)
+	}
+
+	var sessionIDs []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan session id: %w", err)
+		}
+		sessionIDs = append(sessionIDs, id)
+	}
+	rows.Close()
+
+	result, err := tx.Exec(`
+		UPDATE devices
+		SET is_trusted = false, trusted_until = NULL, removed_at = $1
+		WHERE id = $2 AND removed_at IS NULL
+	`, now, deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to remove device: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return nil, ErrDeviceNotFound
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return sessionIDs, nil
+}
+
 // GetSessionStats retrieves session statistics for a user
 func (r *SessionRepository) GetSessionStats(userID string) (*models.SessionStats, error) {
 	stats := &models.SessionStats{}
@@ -227,9 +434,9 @@ func (r *SessionRepository) GetSessionStats(userID string) (*models.SessionStats
 	query = `
 		SELECT 
 			COUNT(*) as total,
-			COUNT(CASE WHEN is_trusted = true THEN 1 END) as trusted
+			COUNT(CASE WHEN is_trusted = true AND (trusted_until IS NULL OR trusted_until > NOW()) THEN 1 END) as trusted
 		FROM devices
-		WHERE user_id = $1
+		WHERE user_id = $1 AND removed_at IS NULL
 	`
 	err = r.db.QueryRow(query, userID).Scan(&stats.TotalDevices, &stats.TrustedDevices)
 	if err != nil {
@@ -282,37 +489,97 @@ func (r *SessionRepository) GetSessionStats(userID string) (*models.SessionStats
 	return stats, nil
 }
 
-// CreateAuditLog creates an audit log entry
-func (r *SessionRepository) CreateAuditLog(log *models.AuditLog) error {
+// EnqueueAuditEvent stores an audit event in the outbox until it reaches the audit service
+func (r *SessionRepository) EnqueueAuditEvent(source string, log *models.AuditLog) error {
+	event, err := json.Marshal(log)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit event: %w", err)
+	}
+
 	query := `
-		INSERT INTO audit_logs (id, user_id, session_id, device_id, event_type, event_category,
-		                        severity, ip_address, user_agent, location_country, location_city,
-		                        metadata, success, failure_reason, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+		INSERT INTO audit_outbox (id, source, event, created_at)
+		VALUES ($1, $2, $3, $4)
 	`
-	
-	_, err := r.db.Exec(
-		query,
-		log.ID,
-		log.UserID,
-		log.SessionID,
-		log.DeviceID,
-		log.EventType,
-		log.EventCategory,
-		log.Severity,
-		log.IPAddress,
-		log.UserAgent,
-		log.LocationCountry,
-		log.LocationCity,
-		log.Metadata,
-		log.Success,
-		log.FailureReason,
-		log.CreatedAt,
-	)
-	
+
+	_, err = r.db.Exec(query, log.ID, source, event, log.CreatedAt)
 	if err != nil {
-		return fmt.Errorf("failed to create audit log: %w", err)
+		return fmt.Errorf("failed to enqueue audit event: %w", err)
 	}
-	
+
+	return nil
+}
+
+// ClaimAuditEvents returns this source's pending outbox events whose next attempt
+// is due, oldest first, and pushes their next attempt out by lease so another
+// instance won't send them at the same time
+func (r *SessionRepository) ClaimAuditEvents(source string, limit int, lease time.Duration) ([]models.AuditOutboxEvent, error) {
+	query := `
+		UPDATE audit_outbox
+		SET next_attempt_at = $1
+		WHERE id IN (
+			SELECT id FROM audit_outbox
+			WHERE source = $2 AND status = 'pending' AND next_attempt_at <= $3
+			ORDER BY created_at
+			LIMIT $4
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, event, attempts, created_at
+	`
+
+	now := time.Now()
+	rows, err := r.db.Query(query, now.Add(lease), source, now, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim audit events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []models.AuditOutboxEvent
+	for rows.Next() {
+		var e models.AuditOutboxEvent
+		var event []byte
+		if err := rows.Scan(&e.ID, &event, &e.Attempts, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan audit event: %w", err)
+		}
+		if err := json.Unmarshal(event, &e.Event); err != nil {
+			return nil, fmt.Errorf("failed to decode audit event %s: %w", e.ID, err)
+		}
+		events = append(events, e)
+	}
+
+	// RETURNING gives no ordering guarantee
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].CreatedAt.Before(events[j].CreatedAt)
+	})
+
+	return events, nil
+}
+
+// DeleteAuditEvent removes an event from the outbox once the audit service has it
+func (r *SessionRepository) DeleteAuditEvent(eventID string) error {
+	_, err := r.db.Exec(`DELETE FROM audit_outbox WHERE id = $1`, eventID)
+	if err != nil {
+		return fmt.Errorf("failed to delete audit event: %w", err)
+	}
+
 	return nil
-}
\ No newline at end of file
+}
+
+// MarkAuditEventFailed records a failed attempt to send an outbox event. The
+// event is retried at nextAttemptAt, or parked as failed when nextAttemptAt is nil
+func (r *SessionRepository) MarkAuditEventFailed(eventID string, lastError string, nextAttemptAt *time.Time) error {
+	query := `
+		UPDATE audit_outbox
+		SET attempts = attempts + 1,
+		    last_error = $1,
+		    status = CASE WHEN $2::timestamptz IS NULL THEN 'failed' ELSE 'pending' END,
+		    next_attempt_at = COALESCE($2, next_attempt_at)
+		WHERE id = $3
+	`
+
+	_, err := r.db.Exec(query, lastError, nextAttemptAt, eventID)
+	if err != nil {
+		return fmt.Errorf("failed to mark audit event as failed: %w", err)
+	}
+
+	return nil
+}
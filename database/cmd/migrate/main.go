@@ -0,0 +1,186 @@
+// Command migrate applies, reverts and reports the versioned schema migrations
+//
+// Usage:
+//
+//	migrate up [version]        apply pending migrations, up to version if given
+//	migrate down [steps|all]    revert the latest migration, or that many
+//	migrate status              list migrations and whether they are applied
+//	migrate baseline <version>  mark migrations up to version as applied
+//	                            without running them, for databases made by
+//	                            the old init.sql
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/joho/godotenv"
+	_ "github.com/lib/pq"
+
+	"github.com/aashiq-04/session-management-system/database/migrate"
+	"github.com/aashiq-04/session-management-system/database/migrations"
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "Usage: migrate up [version] | down [steps|all] | status | baseline <version>")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	godotenv.Load()
+
+	loaded, err := migrate.Load(migrations.FS)
+	if err != nil {
+		log.Fatalf("Failed to load migrations: %v", err)
+	}
+
+	db, err := connectDatabase()
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	migrator := migrate.New(db, loaded)
+	command, arg := flag.Arg(0), flag.Arg(1)
+
+	switch command {
+	case "up":
+		var target int64
+		if arg != "" {
+			if target, err = strconv.ParseInt(arg, 10, 64); err != nil {
+				log.Fatalf("Invalid version: %v", err)
+			}
+		}
+
+		applied, err := migrator.Up(ctx, target)
+		for _, m := range applied {
+			log.Printf("Applied %04d_%s", m.Version, m.Name)
+		}
+		if errors.Is(err, migrate.ErrNoHistory) {
+			log.Fatalf("%v: if the schema matches 0001_initial_schema, run `migrate baseline 1`", err)
+		}
+		if err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		if len(applied) == 0 {
+			log.Println("Schema is up to date")
+		}
+
+	case "down":
+		steps := 1
+		switch arg {
+		case "":
+		case "all":
+			steps = len(loaded)
+		default:
+			if steps, err = strconv.Atoi(arg); err != nil || steps < 1 {
+				log.Fatalf("Invalid steps: %q", arg)
+			}
+		}
+
+		reverted, err := migrator.Down(ctx, steps)
+		for _, m := range reverted {
+			log.Printf("Reverted %04d_%s", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		if len(reverted) == 0 {
+			log.Println("No migrations to revert")
+		}
+
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			log.Fatalf("Failed to get migration status: %v", err)
+		}
+		printStatus(statuses)
+
+	case "baseline":
+		version, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil {
+			log.Fatalf("Invalid version: %q", arg)
+		}
+		if err := migrator.Baseline(ctx, version); err != nil {
+			log.Fatalf("Baseline failed: %v", err)
+		}
+		log.Printf("Baselined at %04d", version)
+
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+// printStatus prints one line per migration
+func printStatus(statuses []migrate.Status) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+	for _, s := range statuses {
+		state, appliedAt := "pending", ""
+		if s.Applied {
+			state, appliedAt = "applied", s.AppliedAt.Format(time.RFC3339)
+			if s.ChecksumMismatch {
+				state = "applied (changed since)"
+			}
+		}
+		fmt.Fprintf(w, "%04d\t%s\t%s\t%s\n", s.Version, s.Name, state, appliedAt)
+	}
+	w.Flush()
+}
+
+// connectDatabase opens the database, retrying while it starts up
+func connectDatabase() (*sql.DB, error) {
+	db, err := sql.Open("postgres", fmt.Sprintf(
+		"host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
+		getEnv("DB_HOST", "localhost"),
+		getEnv("DB_PORT", "5432"),
+		getEnv("DB_USER", "admin"),
+		getEnv("DB_PASSWORD", "admin123"),
+		getEnv("DB_NAME", "session_management"),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	maxRetries := 5
+	for i := 0; i < maxRetries; i++ {
+		err = db.Ping()
+		if err == nil {
+			return db, nil
+		}
+
+		log.Printf("Failed to ping database (attempt %d/%d): %v", i+1, maxRetries, err)
+		time.Sleep(2 * time.Second)
+	}
+	db.Close()
+
+	return nil, fmt.Errorf("failed to connect to database after %d attempts", maxRetries)
+}
+
+// getEnv gets an environment variable or returns a default value
+func getEnv(key, defaultValue string) string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
@@ -0,0 +1,9 @@
+module github.com/aashiq-04/session-management-system/database
+
+go 1.24.0
+
+require (
+	github.com/DATA-DOG/go-sqlmock v1.5.2
+	github.com/joho/godotenv v1.5.1
+	github.com/lib/pq v1.10.9
+)
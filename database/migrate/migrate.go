@@ -0,0 +1,443 @@
+// Package migrate applies and reverts versioned schema migrations, recording
+// them in schema_migrations
+package migrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// lockKey is the advisory lock held while migrating, so concurrent runs
+// (e.g. several replicas starting at once) apply each migration only once
+const lockKey int64 = 0x736d735f6d6967 // "sms_mig"
+
+// noTransaction marks a migration that can't run inside a transaction, e.g.
+// one using CREATE INDEX CONCURRENTLY. It must be the first line of the file.
+const noTransaction = "-- migrate:no-transaction"
+
+var fileName = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// ErrNoHistory is returned by Up when the database already has tables but no
+// migration history, e.g. one created by the old init.sql. Baseline it first.
+var ErrNoHistory = errors.New("database has tables but no migration history; run baseline first")
+
+// Migration is one schema version
+type Migration struct {
+	Version       int64
+	Name          string
+	Up            string
+	Down          string
+	Checksum      string // SHA-256 of the up file
+	NoTransaction bool
+}
+
+// Status describes a migration and whether it is applied
+type Status struct {
+	Migration
+	Applied          bool
+	AppliedAt        time.Time
+	ChecksumMismatch bool // Applied, but the file has changed since
+}
+
+// execer is a *sql.Conn or *sql.Tx
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// applied is a row of schema_migrations
+type applied struct {
+	version   int64
+	name      string
+	checksum  string
+	appliedAt time.Time
+}
+
+// Load reads the migrations in fsys, sorted by version. Every version needs
+// both an up and a down file.
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".sql") {
+			continue
+		}
+
+		match := fileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name %q", entry.Name())
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid migration version in %q", entry.Name())
+		}
+
+		content, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", entry.Name(), err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, m.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			sum := sha256.Sum256(content)
+			m.Up = string(content)
+			m.Checksum = hex.EncodeToString(sum[:])
+			m.NoTransaction = strings.HasPrefix(m.Up, noTransaction)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+// Migrator runs migrations against a database
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+// New creates a migrator for migrations, as returned by Load
+func New(db *sql.DB, migrations []Migration) *Migrator {
+	return &Migrator{db: db, migrations: migrations}
+}
+
+// Up applies pending migrations in order, up to and including target, or all
+// of them if target is 0. It returns the migrations it applied.
+func (m *Migrator) Up(ctx context.Context, target int64) ([]Migration, error) {
+	var done []Migration
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		history, err := m.history(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if err := m.validate(history); err != nil {
+			return err
+		}
+
+		if len(history) == 0 {
+			var hasTables bool
+			err := conn.QueryRowContext(ctx, `
+				SELECT EXISTS (
+					SELECT 1 FROM information_schema.tables
+					WHERE table_schema = current_schema() AND table_name <> 'schema_migrations'
+				)
+			`).Scan(&hasTables)
+			if err != nil {
+				return fmt.Errorf("failed to check for existing tables: %w", err)
+			}
+			if hasTables {
+				return ErrNoHistory
+			}
+		}
+
+		latest := latestVersion(history)
+		for _, migration := range m.migrations {
+			if target != 0 && migration.Version > target {
+				break
+			}
+			if _, ok := history[migration.Version]; ok {
+				continue
+			}
+			if migration.Version < latest {
+				return fmt.Errorf("migration %d_%s is pending but newer migration %d is already applied",
+					migration.Version, migration.Name, latest)
+			}
+
+			if err := m.apply(ctx, conn, migration, true); err != nil {
+				return err
+			}
+			done = append(done, migration)
+		}
+
+		return nil
+	})
+
+	return done, err
+}
+
+// Down reverts the latest steps applied migrations, newest first. It returns
+// the migrations it reverted.
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var done []Migration
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		history, err := m.history(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if err := m.validate(history); err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+			migration := m.migrations[i]
+			if _, ok := history[migration.Version]; !ok {
+				continue
+			}
+
+			if err := m.apply(ctx, conn, migration, false); err != nil {
+				return err
+			}
+			done = append(done, migration)
+		}
+
+		return nil
+	})
+
+	return done, err
+}
+
+// Baseline records every migration up to and including version as applied
+// without running it, for databases whose schema was created some other way.
+// The database must not have any migration history yet.
+func (m *Migrator) Baseline(ctx context.Context, version int64) error {
+	return m.withLock(ctx, func(conn *sql.Conn) error {
+		history, err := m.history(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if len(history) > 0 {
+			return errors.New("database already has migration history")
+		}
+
+		known := false
+		for _, migration := range m.migrations {
+			known = known || migration.Version == version
+		}
+		if !known {
+			return fmt.Errorf("unknown migration version %d", version)
+		}
+
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("failed to begin transaction: %w", err)
+		}
+		defer tx.Rollback()
+
+		for _, migration := range m.migrations {
+			if migration.Version > version {
+				break
+			}
+			if err := m.record(ctx, tx, migration, 0); err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit baseline: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// Status lists every known migration and whether it is applied. Unlike Up and
+// Down it doesn't fail on changed files; it reports them instead.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	var statuses []Status
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		history, err := m.history(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			status := Status{Migration: migration}
+			if row, ok := history[migration.Version]; ok {
+				status.Applied = true
+				status.AppliedAt = row.appliedAt
+				status.ChecksumMismatch = row.checksum != migration.Checksum
+			}
+			statuses = append(statuses, status)
+		}
+
+		return nil
+	})
+
+	return statuses, err
+}
+
+// withLock runs fn on a dedicated connection holding the migration advisory
+// lock, creating schema_migrations first if needed. Session-level advisory
+// locks belong to one connection, so everything must run on conn.
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, lockKey); err != nil {
+		return fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, lockKey)
+
+	_, err = conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version BIGINT PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			checksum VARCHAR(64) NOT NULL,
+			duration_ms INTEGER NOT NULL DEFAULT 0,
+			applied_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	return fn(conn)
+}
+
+// history returns the applied migrations by version
+func (m *Migrator) history(ctx context.Context, conn *sql.Conn) (map[int64]applied, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT version, name, checksum, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get migration history: %w", err)
+	}
+	defer rows.Close()
+
+	history := make(map[int64]applied)
+	for rows.Next() {
+		var row applied
+		if err := rows.Scan(&row.version, &row.name, &row.checksum, &row.appliedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan migration history: %w", err)
+		}
+		history[row.version] = row
+	}
+
+	return history, rows.Err()
+}
+
+// validate checks that every applied migration is known and unchanged
+func (m *Migrator) validate(history map[int64]applied) error {
+	known := make(map[int64]Migration, len(m.migrations))
+	for _, migration := range m.migrations {
+		known[migration.Version] = migration
+	}
+
+	versions := make([]int64, 0, len(history))
+	for version := range history {
+		versions = append(versions, version)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+
+	for _, version := range versions {
+		row := history[version]
+		migration, ok := known[version]
+		if !ok {
+			return fmt.Errorf("applied migration %d_%s is unknown to this build", version, row.name)
+		}
+		if row.checksum != migration.Checksum {
+			return fmt.Errorf("checksum mismatch for applied migration %d_%s: the file was changed after it was applied",
+				version, migration.Name)
+		}
+	}
+
+	return nil
+}
+
+// apply runs one migration up or down and updates schema_migrations to match,
+// in a single transaction unless the migration opts out
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, migration Migration, up bool) error {
+	script, action := migration.Down, "revert"
+	if up {
+		script, action = migration.Up, "apply"
+	}
+	started := time.Now()
+
+	if migration.NoTransaction {
+		if _, err := conn.ExecContext(ctx, script); err != nil {
+			return fmt.Errorf("failed to %s migration %d_%s: %w", action, migration.Version, migration.Name, err)
+		}
+		if up {
+			return m.record(ctx, conn, migration, time.Since(started))
+		}
+		return m.forget(ctx, conn, migration)
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return fmt.Errorf("failed to %s migration %d_%s: %w", action, migration.Version, migration.Name, err)
+	}
+	if up {
+		err = m.record(ctx, tx, migration, time.Since(started))
+	} else {
+		err = m.forget(ctx, tx, migration)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit migration %d_%s: %w", migration.Version, migration.Name, err)
+	}
+
+	return nil
+}
+
+// record marks a migration as applied
+func (m *Migrator) record(ctx context.Context, conn execer, migration Migration, duration time.Duration) error {
+	_, err := conn.ExecContext(ctx,
+		`INSERT INTO schema_migrations (version, name, checksum, duration_ms) VALUES ($1, $2, $3, $4)`,
+		migration.Version, migration.Name, migration.Checksum, duration.Milliseconds())
+	if err != nil {
+		return fmt.Errorf("failed to record migration %d_%s: %w", migration.Version, migration.Name, err)
+	}
+
+	return nil
+}
+
+// forget marks a migration as no longer applied
+func (m *Migrator) forget(ctx context.Context, conn execer, migration Migration) error {
+	_, err := conn.ExecContext(ctx, `DELETE FROM schema_migrations WHERE version = $1`, migration.Version)
+	if err != nil {
+		return fmt.Errorf("failed to forget migration %d_%s: %w", migration.Version, migration.Name, err)
+	}
+
+	return nil
+}
+
+// latestVersion returns the highest applied version, or 0
+func latestVersion(history map[int64]applied) int64 {
+	var latest int64
+	for version := range history {
+		if version > latest {
+			latest = version
+		}
+	}
+	return latest
+}
@@ -0,0 +1,451 @@
+package migrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"github.com/aashiq-04/session-management-system/database/migrations"
+)
+
+// testFS holds three migrations, the last of which runs outside a transaction.
+// Versions aren't zero-padded, so file name order differs from version order.
+var testFS = fstest.MapFS{
+	"1_users.up.sql":            {Data: []byte("CREATE TABLE users (id INT);")},
+	"1_users.down.sql":          {Data: []byte("DROP TABLE users;")},
+	"2_sessions.up.sql":         {Data: []byte("CREATE TABLE sessions (id INT);")},
+	"2_sessions.down.sql":       {Data: []byte("DROP TABLE sessions;")},
+	"10_session_index.up.sql":   {Data: []byte(noTransaction + "\nCREATE INDEX CONCURRENTLY sessions_id ON sessions (id);")},
+	"10_session_index.down.sql": {Data: []byte("DROP INDEX CONCURRENTLY sessions_id;")},
+	"README.md":                 {Data: []byte("not a migration")},
+	"drafts/3_draft.up.sql":     {Data: []byte("not loaded")},
+}
+
+func loadTestMigrations(t *testing.T) []Migration {
+	t.Helper()
+
+	loaded, err := Load(testFS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loaded
+}
+
+func TestLoad(t *testing.T) {
+	loaded := loadTestMigrations(t)
+
+	want := []struct {
+		version       int64
+		name          string
+		noTransaction bool
+	}{
+		{1, "users", false},
+		{2, "sessions", false},
+		{10, "session_index", true},
+	}
+	if len(loaded) != len(want) {
+		t.Fatalf("loaded %d migrations, want %d", len(loaded), len(want))
+	}
+	for i, w := range want {
+		m := loaded[i]
+		if m.Version != w.version || m.Name != w.name || m.NoTransaction != w.noTransaction {
+			t.Errorf("migration %d = %d_%s (no transaction %v), want %d_%s (no transaction %v)",
+				i, m.Version, m.Name, m.NoTransaction, w.version, w.name, w.noTransaction)
+		}
+	}
+
+	up := testFS["2_sessions.up.sql"].Data
+	sum := sha256.Sum256(up)
+	if m := loaded[1]; m.Up != string(up) || m.Down != "DROP TABLE sessions;" || m.Checksum != hex.EncodeToString(sum[:]) {
+		t.Errorf("got %+v", m)
+	}
+}
+
+func TestLoadRejects(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []string
+		err   string
+	}{
+		{"dash in name", []string{"1-users.up.sql", "1-users.down.sql"}, "invalid migration file name"},
+		{"upper case", []string{"1_Users.up.sql", "1_Users.down.sql"}, "invalid migration file name"},
+		{"no version", []string{"users.up.sql", "users.down.sql"}, "invalid migration file name"},
+		{"no direction", []string{"1_users.sql"}, "invalid migration file name"},
+		{"version 0", []string{"0_users.up.sql", "0_users.down.sql"}, "invalid migration version"},
+		{"version overflow", []string{"99999999999999999999_users.up.sql"}, "invalid migration version"},
+		{"duplicate version", []string{"1_users.up.sql", "1_users.down.sql", "01_accounts.up.sql", "01_accounts.down.sql"}, "has two names"},
+		{"no down", []string{"1_users.up.sql"}, "needs both an up and a down file"},
+		{"no up", []string{"1_users.down.sql"}, "needs both an up and a down file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fsys := fstest.MapFS{}
+			for _, file := range tt.files {
+				fsys[file] = &fstest.MapFile{Data: []byte("SELECT 1;")}
+			}
+			if _, err := Load(fsys); err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got %v, want an error containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+// The embedded migrations must always load
+func TestLoadEmbedded(t *testing.T) {
+	loaded, err := Load(migrations.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, m := range loaded {
+		if m.Version != int64(i+1) {
+			t.Errorf("migration %d_%s, want version %d; versions must have no gaps", m.Version, m.Name, i+1)
+		}
+	}
+}
+
+// newTestMigrator returns a migrator for the test migrations on a mock
+// database, which fails the test on any statement not expected of it
+func newTestMigrator(t *testing.T) (*Migrator, []Migration, sqlmock.Sqlmock) {
+	t.Helper()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+		db.Close()
+	})
+
+	loaded := loadTestMigrations(t)
+	return New(db, loaded), loaded, mock
+}
+
+// expectLock expects the advisory lock to be taken and schema_migrations created
+func expectLock(mock sqlmock.Sqlmock) {
+	mock.ExpectExec(regexp.QuoteMeta("SELECT pg_advisory_lock($1)")).
+		WithArgs(lockKey).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta("CREATE TABLE IF NOT EXISTS schema_migrations")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+}
+
+// expectUnlock expects the advisory lock to be released
+func expectUnlock(mock sqlmock.Sqlmock) {
+	mock.ExpectExec(regexp.QuoteMeta("SELECT pg_advisory_unlock($1)")).
+		WithArgs(lockKey).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+}
+
+// expectHistory returns migrations as the applied ones
+func expectHistory(mock sqlmock.Sqlmock, applied ...Migration) {
+	rows := sqlmock.NewRows([]string{"version", "name", "checksum", "applied_at"})
+	for _, m := range applied {
+		rows.AddRow(m.Version, m.Name, m.Checksum, time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	}
+	mock.ExpectQuery(regexp.QuoteMeta("FROM schema_migrations")).WillReturnRows(rows)
+}
+
+// expectTables answers whether the database has tables other than schema_migrations
+func expectTables(mock sqlmock.Sqlmock, exist bool) {
+	mock.ExpectQuery(regexp.QuoteMeta("FROM information_schema.tables")).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(exist))
+}
+
+func expectRecord(mock sqlmock.Sqlmock, m Migration) {
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO schema_migrations")).
+		WithArgs(m.Version, m.Name, m.Checksum, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+func expectForget(mock sqlmock.Sqlmock, m Migration) {
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM schema_migrations WHERE version = $1")).
+		WithArgs(m.Version).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+// expectApply expects m to be applied or reverted, in a transaction unless it
+// opts out
+func expectApply(mock sqlmock.Sqlmock, m Migration, up bool) {
+	script := m.Down
+	if up {
+		script = m.Up
+	}
+
+	if !m.NoTransaction {
+		mock.ExpectBegin()
+	}
+	mock.ExpectExec(regexp.QuoteMeta(script)).WithoutArgs().WillReturnResult(sqlmock.NewResult(0, 0))
+	if up {
+		expectRecord(mock, m)
+	} else {
+		expectForget(mock, m)
+	}
+	if !m.NoTransaction {
+		mock.ExpectCommit()
+	}
+}
+
+func checkVersions(t *testing.T, got []Migration, want ...int64) {
+	t.Helper()
+
+	versions := make([]int64, len(got))
+	for i, m := range got {
+		versions[i] = m.Version
+	}
+	if len(versions) != len(want) {
+		t.Fatalf("got migrations %v, want %v", versions, want)
+	}
+	for i := range want {
+		if versions[i] != want[i] {
+			t.Fatalf("got migrations %v, want %v", versions, want)
+		}
+	}
+}
+
+func TestUp(t *testing.T) {
+	migrator, loaded, mock := newTestMigrator(t)
+	expectLock(mock)
+	expectHistory(mock)
+	expectTables(mock, false)
+	for _, m := range loaded {
+		expectApply(mock, m, true)
+	}
+	expectUnlock(mock)
+
+	done, err := migrator.Up(context.Background(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkVersions(t, done, 1, 2, 10)
+}
+
+func TestUpToTarget(t *testing.T) {
+	migrator, loaded, mock := newTestMigrator(t)
+	expectLock(mock)
+	expectHistory(mock, loaded[0])
+	expectApply(mock, loaded[1], true)
+	expectUnlock(mock)
+
+	done, err := migrator.Up(context.Background(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkVersions(t, done, 2)
+}
+
+func TestUpNothingPending(t *testing.T) {
+	migrator, loaded, mock := newTestMigrator(t)
+	expectLock(mock)
+	expectHistory(mock, loaded...)
+	expectUnlock(mock)
+
+	done, err := migrator.Up(context.Background(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkVersions(t, done)
+}
+
+// Up refuses to touch a database whose history doesn't match the files,
+// and releases the lock either way
+func TestUpRejects(t *testing.T) {
+	loaded := loadTestMigrations(t)
+	changed := loaded[0]
+	changed.Checksum = strings.Repeat("0", 64)
+
+	tests := []struct {
+		name    string
+		history []Migration
+		err     string
+	}{
+		{"changed checksum", []Migration{changed}, "checksum mismatch for applied migration 1_users"},
+		{"unknown migration", []Migration{loaded[0], {Version: 3, Name: "removed", Checksum: "abc"}}, "applied migration 3_removed is unknown"},
+		{"pending before applied", []Migration{loaded[0], loaded[2]}, "migration 2_sessions is pending but newer migration 10 is already applied"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			migrator, _, mock := newTestMigrator(t)
+			expectLock(mock)
+			expectHistory(mock, tt.history...)
+			expectUnlock(mock)
+
+			done, err := migrator.Up(context.Background(), 0)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got %v, want an error containing %q", err, tt.err)
+			}
+			checkVersions(t, done)
+		})
+	}
+}
+
+func TestUpWithoutHistory(t *testing.T) {
+	migrator, _, mock := newTestMigrator(t)
+	expectLock(mock)
+	expectHistory(mock)
+	expectTables(mock, true)
+	expectUnlock(mock)
+
+	if _, err := migrator.Up(context.Background(), 0); !errors.Is(err, ErrNoHistory) {
+		t.Errorf("got %v, want ErrNoHistory", err)
+	}
+}
+
+// A failing migration is rolled back and stops the run, keeping what was
+// applied before it
+func TestUpStopsAtFailedMigration(t *testing.T) {
+	migrator, loaded, mock := newTestMigrator(t)
+	expectLock(mock)
+	expectHistory(mock)
+	expectTables(mock, false)
+	expectApply(mock, loaded[0], true)
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(loaded[1].Up)).WillReturnError(errors.New(`relation "sessions" already exists`))
+	mock.ExpectRollback()
+	expectUnlock(mock)
+
+	done, err := migrator.Up(context.Background(), 0)
+	if err == nil || !strings.Contains(err.Error(), "failed to apply migration 2_sessions") {
+		t.Errorf("got %v, want the failed migration", err)
+	}
+	checkVersions(t, done, 1)
+}
+
+func TestDown(t *testing.T) {
+	migrator, loaded, mock := newTestMigrator(t)
+	expectLock(mock)
+	expectHistory(mock, loaded...)
+	expectApply(mock, loaded[2], false)
+	expectApply(mock, loaded[1], false)
+	expectUnlock(mock)
+
+	done, err := migrator.Down(context.Background(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkVersions(t, done, 10, 2)
+}
+
+// Down stops at the first migration rather than failing when asked for more
+func TestDownPastFirst(t *testing.T) {
+	migrator, loaded, mock := newTestMigrator(t)
+	expectLock(mock)
+	expectHistory(mock, loaded[0])
+	expectApply(mock, loaded[0], false)
+	expectUnlock(mock)
+
+	done, err := migrator.Down(context.Background(), 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkVersions(t, done, 1)
+}
+
+func TestDownRejectsChangedMigration(t *testing.T) {
+	migrator, loaded, mock := newTestMigrator(t)
+	changed := loaded[1]
+	changed.Checksum = strings.Repeat("0", 64)
+	expectLock(mock)
+	expectHistory(mock, loaded[0], changed)
+	expectUnlock(mock)
+
+	if _, err := migrator.Down(context.Background(), 1); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("got %v, want a checksum mismatch", err)
+	}
+}
+
+func TestBaseline(t *testing.T) {
+	migrator, loaded, mock := newTestMigrator(t)
+	expectLock(mock)
+	expectHistory(mock)
+	mock.ExpectBegin()
+	expectRecord(mock, loaded[0])
+	expectRecord(mock, loaded[1])
+	mock.ExpectCommit()
+	expectUnlock(mock)
+
+	if err := migrator.Baseline(context.Background(), 2); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBaselineRejects(t *testing.T) {
+	loaded := loadTestMigrations(t)
+
+	tests := []struct {
+		name    string
+		version int64
+		history []Migration
+		err     string
+	}{
+		{"existing history", 2, []Migration{loaded[0]}, "already has migration history"},
+		{"unknown version", 3, nil, "unknown migration version 3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			migrator, _, mock := newTestMigrator(t)
+			expectLock(mock)
+			expectHistory(mock, tt.history...)
+			expectUnlock(mock)
+
+			if err := migrator.Baseline(context.Background(), tt.version); err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("got %v, want an error containing %q", err, tt.err)
+			}
+		})
+	}
+}
+
+// Status reports a changed migration rather than failing on it
+func TestStatus(t *testing.T) {
+	migrator, loaded, mock := newTestMigrator(t)
+	changed := loaded[1]
+	changed.Checksum = strings.Repeat("0", 64)
+	expectLock(mock)
+	expectHistory(mock, loaded[0], changed)
+	expectUnlock(mock)
+
+	statuses, err := migrator.Status(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		applied, mismatch bool
+	}{
+		{true, false},
+		{true, true},
+		{false, false},
+	}
+	if len(statuses) != len(want) {
+		t.Fatalf("got %d statuses, want %d", len(statuses), len(want))
+	}
+	for i, w := range want {
+		s := statuses[i]
+		if s.Version != loaded[i].Version || s.Applied != w.applied || s.ChecksumMismatch != w.mismatch {
+			t.Errorf("status of %d_%s = applied %v, mismatch %v; want %v, %v",
+				s.Version, s.Name, s.Applied, s.ChecksumMismatch, w.applied, w.mismatch)
+		}
+	}
+}
+
+// Nothing runs without the lock
+func TestLockFailure(t *testing.T) {
+	migrator, _, mock := newTestMigrator(t)
+	mock.ExpectExec(regexp.QuoteMeta("SELECT pg_advisory_lock($1)")).
+		WithArgs(lockKey).
+		WillReturnError(errors.New("connection reset by peer"))
+
+	if _, err := migrator.Up(context.Background(), 0); err == nil || !strings.Contains(err.Error(), "failed to acquire migration lock") {
+		t.Errorf("got %v, want a lock failure", err)
+	}
+}
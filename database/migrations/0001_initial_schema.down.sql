@@ -0,0 +1,12 @@
+-- Drops everything created by 0001_initial_schema
+
+DROP TABLE IF EXISTS mfa_backup_codes;
+DROP TABLE IF EXISTS security_alerts;
+DROP TABLE IF EXISTS audit_logs;
+DROP TABLE IF EXISTS sessions;
+DROP TABLE IF EXISTS devices;
+DROP TABLE IF EXISTS users;
+
+DROP FUNCTION IF EXISTS update_updated_at_column();
+
+DROP EXTENSION IF EXISTS "uuid-ossp";
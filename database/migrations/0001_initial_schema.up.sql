@@ -1,4 +1,4 @@
--- Database initialization script for Session Management System
+-- Initial schema for Session Management System, as shipped in the former database/init.sql
 
 -- Enable UUID extension
 CREATE EXTENSION IF NOT EXISTS "uuid-ossp";
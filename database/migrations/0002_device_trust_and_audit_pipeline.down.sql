@@ -0,0 +1,72 @@
+-- Reverts 0002_device_trust_and_audit_pipeline. Audit log entries are copied
+-- back into an unpartitioned table without their chain; references to users,
+-- sessions and devices deleted since are cleared. Trusted devices, pending
+-- notifications and webhook deliveries, and queued audit events are lost.
+
+DROP TRIGGER IF EXISTS update_users_password_changed_at ON users;
+DROP FUNCTION IF EXISTS update_password_changed_at_column();
+
+DROP TABLE IF EXISTS audit_outbox;
+DROP TABLE IF EXISTS webhook_deliveries;
+DROP TABLE IF EXISTS audit_event_outbox;
+DROP TABLE IF EXISTS webhook_subscriptions;
+DROP TABLE IF EXISTS notification_deliveries;
+DROP TABLE IF EXISTS notification_preferences;
+DROP TABLE IF EXISTS device_trust_tokens;
+
+ALTER TABLE audit_logs RENAME TO audit_logs_chained;
+ALTER TABLE audit_logs_chained RENAME CONSTRAINT audit_logs_pkey TO audit_logs_chained_pkey;
+DROP INDEX IF EXISTS idx_audit_logs_created_at;
+
+-- Audit logs table: comprehensive security event logging
+CREATE TABLE audit_logs (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    session_id UUID REFERENCES sessions(id) ON DELETE SET NULL,
+    device_id UUID REFERENCES devices(id) ON DELETE SET NULL,
+    event_type VARCHAR(50) NOT NULL, -- login, logout, mfa_enable, session_revoke, etc.
+    event_category VARCHAR(50) NOT NULL, -- authentication, authorization, session_management, security
+    severity VARCHAR(20) NOT NULL, -- info, warning, critical
+    ip_address INET,
+    user_agent TEXT,
+    location_country VARCHAR(100),
+    location_city VARCHAR(100),
+    metadata JSONB, -- flexible field for additional event data
+    success BOOLEAN NOT NULL,
+    failure_reason TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO audit_logs (id, user_id, session_id, device_id, event_type, event_category,
+                        severity, ip_address, user_agent, location_country, location_city,
+                        metadata, success, failure_reason, created_at)
+SELECT a.id, u.id, s.id, d.id, a.event_type, a.event_category,
+       a.severity, a.ip_address, a.user_agent, a.location_country, a.location_city,
+       a.metadata, a.success, a.failure_reason, a.created_at
+FROM audit_logs_chained a
+LEFT JOIN users u ON u.id = a.user_id
+LEFT JOIN sessions s ON s.id = a.session_id
+LEFT JOIN devices d ON d.id = a.device_id
+ORDER BY a.sequence;
+
+-- Dropping the tables doesn't fire the append-only row triggers, and
+-- partitions made by the audit service go with their parent
+DROP TABLE audit_logs_chained;
+DROP TABLE IF EXISTS audit_chain_checkpoints;
+DROP TABLE IF EXISTS audit_chain_head;
+DROP TABLE IF EXISTS audit_log_tombstones;
+
+DROP FUNCTION IF EXISTS prevent_append_only_change();
+DROP FUNCTION IF EXISTS enqueue_audit_event();
+
+CREATE INDEX idx_audit_logs_user_id ON audit_logs(user_id);
+CREATE INDEX idx_audit_logs_event_type ON audit_logs(event_type);
+CREATE INDEX idx_audit_logs_created_at ON audit_logs(created_at);
+
+DROP INDEX IF EXISTS idx_security_alerts_created_at;
+ALTER TABLE security_alerts DROP COLUMN IF EXISTS notified_at;
+ALTER TABLE devices DROP COLUMN IF EXISTS removed_at;
+ALTER TABLE devices DROP COLUMN IF EXISTS trusted_until;
+ALTER TABLE users DROP COLUMN IF EXISTS password_changed_at;
+
+DROP EXTENSION IF EXISTS pg_trgm;
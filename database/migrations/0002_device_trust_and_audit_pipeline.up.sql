@@ -0,0 +1,359 @@
+-- Trusted devices, security alert notifications, outbound webhooks, the
+-- audit outbox, and an append-only, hash-chained audit trail partitioned by
+-- month. Existing audit log entries are copied into the chain in the order
+-- they were written, hashed the way the audit service hashes new entries.
+
+-- The chain hashes created_at in UTC
+SET LOCAL TimeZone = 'UTC';
+
+CREATE EXTENSION IF NOT EXISTS pg_trgm; -- substring search over audit logs
+
+ALTER TABLE users ADD COLUMN password_changed_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP;
+
+ALTER TABLE devices
+    ADD COLUMN trusted_until TIMESTAMP WITH TIME ZONE, -- NULL means trust does not expire
+    ADD COLUMN removed_at TIMESTAMP WITH TIME ZONE; -- set when the user forgets the device
+
+-- Existing alerts count as notified, so nobody is sent a backlog of old ones
+ALTER TABLE security_alerts ADD COLUMN notified_at TIMESTAMP WITH TIME ZONE; -- set once notification deliveries have been queued
+UPDATE security_alerts SET notified_at = CURRENT_TIMESTAMP;
+
+-- The existing audit log is copied into the partitioned table below, then dropped
+ALTER TABLE audit_logs RENAME TO audit_logs_unchained;
+ALTER TABLE audit_logs_unchained RENAME CONSTRAINT audit_logs_pkey TO audit_logs_unchained_pkey;
+DROP INDEX idx_audit_logs_user_id;
+DROP INDEX idx_audit_logs_event_type;
+DROP INDEX idx_audit_logs_created_at;
+
+-- Audit logs table: comprehensive security event logging
+-- Rows are append-only and hash-chained, so the IDs below are kept as plain
+-- values rather than foreign keys that would rewrite them on delete.
+-- Partitioned by month on created_at: the audit service creates partitions
+-- ahead of time and expires old ones, and the default partition catches rows
+-- outside every partition. Unique constraints must include created_at.
+CREATE TABLE audit_logs (
+    id UUID NOT NULL DEFAULT uuid_generate_v4(),
+    user_id UUID,
+    session_id UUID,
+    device_id UUID,
+    event_type VARCHAR(50) NOT NULL, -- login, logout, mfa_enable, session_revoke, etc.
+    event_category VARCHAR(50) NOT NULL, -- authentication, authorization, session_management, security
+    severity VARCHAR(20) NOT NULL, -- info, warning, critical
+    ip_address INET,
+    user_agent TEXT,
+    location_country VARCHAR(100),
+    location_city VARCHAR(100),
+    metadata JSONB, -- flexible field for additional event data
+    success BOOLEAN NOT NULL,
+    failure_reason TEXT,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    sequence BIGINT NOT NULL, -- position in the hash chain, starting at 1; unique since writers serialize on audit_chain_head
+    prev_hash VARCHAR(64) NOT NULL, -- entry_hash of the previous entry
+    entry_hash VARCHAR(64) NOT NULL, -- SHA-256 of prev_hash and this entry's canonical contents
+    PRIMARY KEY (id, created_at),
+    UNIQUE (sequence, created_at)
+) PARTITION BY RANGE (created_at);
+
+CREATE TABLE audit_logs_default PARTITION OF audit_logs DEFAULT;
+
+-- Audit log tombstones: the hash of every entry dropped by retention whose
+-- successor lives in another partition, so the remaining chain still verifies
+CREATE TABLE audit_log_tombstones (
+    sequence BIGINT PRIMARY KEY,
+    entry_hash VARCHAR(64) NOT NULL,
+    partition_name VARCHAR(63) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Audit chain head table: a single row holding the latest chain position,
+-- locked by every audit log insert so the chain stays linear
+CREATE TABLE audit_chain_head (
+    id BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+    sequence BIGINT NOT NULL,
+    entry_hash VARCHAR(64) NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO audit_chain_head (sequence, entry_hash) VALUES
+(0, '0000000000000000000000000000000000000000000000000000000000000000');
+
+-- Audit chain checkpoints table: periodic Ed25519 signatures over the chain head
+CREATE TABLE audit_chain_checkpoints (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    sequence BIGINT NOT NULL,
+    entry_hash VARCHAR(64) NOT NULL,
+    key_id VARCHAR(16) NOT NULL, -- identifies the signing key, for rotation
+    signature TEXT NOT NULL, -- base64 signature over sequence, entry_hash and created_at
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- A partition for this month and every month the existing entries were
+-- written in, so they don't land in the default partition and block creating
+-- those partitions later
+DO $$
+DECLARE
+    month TIMESTAMP WITH TIME ZONE;
+BEGIN
+    FOR month IN
+        SELECT date_trunc('month', CURRENT_TIMESTAMP)
+        UNION
+        SELECT date_trunc('month', created_at)
+        FROM audit_logs_unchained
+        WHERE created_at IS NOT NULL
+    LOOP
+        EXECUTE format(
+            'CREATE TABLE %I PARTITION OF audit_logs FOR VALUES FROM (%L) TO (%L)',
+            to_char(month, '"audit_logs_y"YYYY"m"MM'), month, month + interval '1 month'
+        );
+    END LOOP;
+END;
+$$;
+
+-- Encodes a string as a JSON value exactly as Go's encoding/json does, which
+-- also escapes <, >, &, U+2028 and U+2029; NULL becomes null
+CREATE FUNCTION pg_temp.audit_log_json(value TEXT)
+RETURNS TEXT AS $$
+    SELECT CASE WHEN value IS NULL THEN 'null' ELSE
+        replace(replace(replace(replace(replace(to_json(value)::text,
+            '<', '\u003c'), '>', '\u003e'), '&', '\u0026'),
+            U&'\2028', '\u2028'), U&'\2029', '\u2029')
+    END;
+$$ language 'sql' IMMUTABLE;
+
+CREATE FUNCTION pg_temp.audit_log_sha256(value TEXT)
+RETURNS TEXT AS $$
+    SELECT encode(sha256(convert_to(value, 'UTF8')), 'hex');
+$$ language 'sql' IMMUTABLE;
+
+-- Chain the existing entries oldest first. The hashes follow AuditLogHash and
+-- PersonalDataHash in the audit service: the same fields, in the same order,
+-- formatted the way they are read back. Entries without a created_at get the
+-- time of the migration.
+DO $$
+DECLARE
+    entry RECORD;
+    seq BIGINT := 0;
+    prev TEXT := '0000000000000000000000000000000000000000000000000000000000000000';
+    hash TEXT;
+    personal_data TEXT;
+BEGIN
+    FOR entry IN
+        SELECT *, COALESCE(created_at, CURRENT_TIMESTAMP) AS chained_at
+        FROM audit_logs_unchained
+        ORDER BY COALESCE(created_at, CURRENT_TIMESTAMP), id
+    LOOP
+        seq := seq + 1;
+
+        personal_data := pg_temp.audit_log_sha256(
+            '{"ip_address":' || pg_temp.audit_log_json(abbrev(entry.ip_address)) ||
+            ',"user_agent":' || pg_temp.audit_log_json(entry.user_agent) ||
+            ',"location_city":' || pg_temp.audit_log_json(entry.location_city) ||
+            ',"metadata":' || pg_temp.audit_log_json(entry.metadata::text) ||
+            '}'
+        );
+
+        hash := pg_temp.audit_log_sha256(
+            '{"sequence":' || seq ||
+            ',"prev_hash":' || pg_temp.audit_log_json(prev) ||
+            ',"id":' || pg_temp.audit_log_json(entry.id::text) ||
+            ',"user_id":' || pg_temp.audit_log_json(entry.user_id::text) ||
+            ',"session_id":' || pg_temp.audit_log_json(entry.session_id::text) ||
+            ',"device_id":' || pg_temp.audit_log_json(entry.device_id::text) ||
+            ',"event_type":' || pg_temp.audit_log_json(entry.event_type) ||
+            ',"event_category":' || pg_temp.audit_log_json(entry.event_category) ||
+            ',"severity":' || pg_temp.audit_log_json(entry.severity) ||
+            ',"location_country":' || pg_temp.audit_log_json(entry.location_country) ||
+            ',"success":' || CASE WHEN entry.success THEN 'true' ELSE 'false' END ||
+            ',"failure_reason":' || pg_temp.audit_log_json(entry.failure_reason) ||
+            ',"created_at":' || pg_temp.audit_log_json(to_char(entry.chained_at, 'YYYY-MM-DD"T"HH24:MI:SS.US"Z"')) ||
+            ',"personal_data":' || pg_temp.audit_log_json(personal_data) ||
+            '}'
+        );
+
+        INSERT INTO audit_logs (id, user_id, session_id, device_id, event_type, event_category,
+                                severity, ip_address, user_agent, location_country, location_city,
+                                metadata, success, failure_reason, created_at,
+                                sequence, prev_hash, entry_hash)
+        VALUES (entry.id, entry.user_id, entry.session_id, entry.device_id, entry.event_type, entry.event_category,
+                entry.severity, entry.ip_address, entry.user_agent, entry.location_country, entry.location_city,
+                entry.metadata, entry.success, entry.failure_reason, entry.chained_at,
+                seq, prev, hash);
+
+        prev := hash;
+    END LOOP;
+
+    UPDATE audit_chain_head SET sequence = seq, entry_hash = prev, updated_at = CURRENT_TIMESTAMP;
+END;
+$$;
+
+DROP FUNCTION pg_temp.audit_log_sha256(TEXT);
+DROP FUNCTION pg_temp.audit_log_json(TEXT);
+DROP TABLE audit_logs_unchained;
+
+-- Device trust tokens table: server-issued tokens that let a trusted device skip TOTP
+CREATE TABLE device_trust_tokens (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    device_id UUID NOT NULL REFERENCES devices(id) ON DELETE CASCADE,
+    token_hash VARCHAR(64) UNIQUE NOT NULL, -- SHA-256 of the token, never the token itself
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    last_used_at TIMESTAMP WITH TIME ZONE,
+    revoked_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Notification preferences table: per-user channels for security alert notifications
+CREATE TABLE notification_preferences (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    email_enabled BOOLEAN DEFAULT true,
+    webhook_enabled BOOLEAN DEFAULT false,
+    webhook_url TEXT,
+    webhook_secret VARCHAR(255), -- used to sign webhook payloads with HMAC-SHA256
+    min_severity VARCHAR(20), -- low, medium, high, critical; NULL falls back to the service default
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Notification deliveries table: one row per alert and channel, doubles as the retry queue
+CREATE TABLE notification_deliveries (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    alert_id UUID NOT NULL REFERENCES security_alerts(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    channel VARCHAR(20) NOT NULL, -- email, webhook, log
+    recipient TEXT,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending', -- pending, sent, failed
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    next_attempt_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    sent_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Webhook subscriptions table: outbound webhooks for audit events
+CREATE TABLE webhook_subscriptions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE, -- NULL for system-wide subscriptions that see every user's events
+    url TEXT NOT NULL,
+    secret VARCHAR(255) NOT NULL, -- used to sign payloads with HMAC-SHA256
+    event_types TEXT[] NOT NULL DEFAULT '{}', -- empty matches every event type
+    event_categories TEXT[] NOT NULL DEFAULT '{}', -- empty matches every category
+    min_severity VARCHAR(20), -- info, warning, critical; NULL matches every severity
+    description TEXT,
+    is_active BOOLEAN DEFAULT true,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Audit event outbox table: filled by a trigger on audit_logs, drained by the audit service webhook dispatcher
+CREATE TABLE audit_event_outbox (
+    id BIGSERIAL PRIMARY KEY,
+    audit_log_id UUID NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Webhook deliveries table: one row per event and subscription, doubles as the retry queue
+CREATE TABLE webhook_deliveries (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    subscription_id UUID NOT NULL REFERENCES webhook_subscriptions(id) ON DELETE CASCADE,
+    audit_log_id UUID NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending', -- pending, delivered, dead
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    response_status INTEGER,
+    next_attempt_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    delivered_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Audit outbox table: audit events written by the auth and session services,
+-- waiting to be sent to the audit service, which owns audit_logs
+CREATE TABLE audit_outbox (
+    id UUID PRIMARY KEY, -- becomes the audit log ID, so redelivery is idempotent
+    source VARCHAR(50) NOT NULL, -- service that recorded the event
+    event JSONB NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending', -- pending, failed
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    next_attempt_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Audit log listings page by (created_at, id) descending, so the indexes end in both
+CREATE INDEX idx_audit_logs_user_id_created_at ON audit_logs(user_id, created_at DESC, id DESC);
+CREATE INDEX idx_audit_logs_event_type_created_at ON audit_logs(event_type, created_at DESC, id DESC);
+CREATE INDEX idx_audit_logs_created_at ON audit_logs(created_at DESC, id DESC);
+CREATE INDEX idx_audit_logs_session_id ON audit_logs(session_id);
+CREATE INDEX idx_audit_logs_device_id ON audit_logs(device_id);
+-- Audit log search: metadata containment and key existence, and ILIKE substring matches
+CREATE INDEX idx_audit_logs_metadata ON audit_logs USING GIN (metadata);
+CREATE INDEX idx_audit_logs_failure_reason_trgm ON audit_logs USING GIN (failure_reason gin_trgm_ops);
+CREATE INDEX idx_audit_logs_user_agent_trgm ON audit_logs USING GIN (user_agent gin_trgm_ops);
+CREATE INDEX idx_audit_logs_event_type_trgm ON audit_logs USING GIN (event_type gin_trgm_ops);
+CREATE INDEX idx_security_alerts_created_at ON security_alerts(created_at);
+CREATE INDEX idx_device_trust_tokens_user_id ON device_trust_tokens(user_id);
+CREATE INDEX idx_device_trust_tokens_device_id ON device_trust_tokens(device_id);
+CREATE INDEX idx_security_alerts_notified_at ON security_alerts(notified_at) WHERE notified_at IS NULL;
+CREATE INDEX idx_notification_deliveries_alert_id ON notification_deliveries(alert_id);
+CREATE INDEX idx_notification_deliveries_pending ON notification_deliveries(next_attempt_at) WHERE status = 'pending';
+CREATE INDEX idx_webhook_subscriptions_user_id ON webhook_subscriptions(user_id);
+CREATE INDEX idx_webhook_deliveries_subscription_id ON webhook_deliveries(subscription_id, created_at);
+CREATE INDEX idx_webhook_deliveries_pending ON webhook_deliveries(next_attempt_at) WHERE status = 'pending';
+CREATE INDEX idx_audit_outbox_pending ON audit_outbox(source, next_attempt_at) WHERE status = 'pending';
+CREATE INDEX idx_audit_chain_checkpoints_sequence ON audit_chain_checkpoints(sequence);
+
+CREATE TRIGGER update_notification_preferences_updated_at BEFORE UPDATE ON notification_preferences
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+CREATE TRIGGER update_webhook_subscriptions_updated_at BEFORE UPDATE ON webhook_subscriptions
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+-- Function to queue every new audit event for webhook delivery, in the same transaction as the insert
+CREATE OR REPLACE FUNCTION enqueue_audit_event()
+RETURNS TRIGGER AS $$
+BEGIN
+    INSERT INTO audit_event_outbox (audit_log_id) VALUES (NEW.id);
+    RETURN NEW;
+END;
+$$ language 'plpgsql';
+
+-- Trigger to feed the webhook outbox whichever service wrote the audit log
+CREATE TRIGGER enqueue_audit_logs_event AFTER INSERT ON audit_logs
+    FOR EACH ROW EXECUTE FUNCTION enqueue_audit_event();
+
+-- Function to reject changes to append-only tables
+CREATE OR REPLACE FUNCTION prevent_append_only_change()
+RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION '% is append-only', TG_TABLE_NAME;
+END;
+$$ language 'plpgsql';
+
+-- Triggers to keep the audit trail append-only; tampering that bypasses them
+-- is still caught by VerifyAuditChain. Retention detaches whole partitions,
+-- which doesn't fire them.
+CREATE TRIGGER prevent_audit_logs_change BEFORE UPDATE OR DELETE ON audit_logs
+    FOR EACH ROW EXECUTE FUNCTION prevent_append_only_change();
+
+CREATE TRIGGER prevent_audit_logs_truncate BEFORE TRUNCATE ON audit_logs
+    FOR EACH STATEMENT EXECUTE FUNCTION prevent_append_only_change();
+
+CREATE TRIGGER prevent_audit_chain_checkpoints_change BEFORE UPDATE OR DELETE ON audit_chain_checkpoints
+    FOR EACH ROW EXECUTE FUNCTION prevent_append_only_change();
+
+CREATE TRIGGER prevent_audit_log_tombstones_change BEFORE UPDATE OR DELETE ON audit_log_tombstones
+    FOR EACH ROW EXECUTE FUNCTION prevent_append_only_change();
+
+-- Function to record when a password changes, whichever code path changed it
+CREATE OR REPLACE FUNCTION update_password_changed_at_column()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF NEW.password_hash IS DISTINCT FROM OLD.password_hash THEN
+        NEW.password_changed_at = CURRENT_TIMESTAMP;
+    END IF;
+    RETURN NEW;
+END;
+$$ language 'plpgsql';
+
+-- Trigger to invalidate device trust tokens issued before a password change
+CREATE TRIGGER update_users_password_changed_at BEFORE UPDATE ON users
+    FOR EACH ROW EXECUTE FUNCTION update_password_changed_at_column();
@@ -0,0 +1,6 @@
+-- Drops everything created by 0003_roles_and_permissions
+
+DROP TABLE IF EXISTS user_roles;
+DROP TABLE IF EXISTS role_permissions;
+DROP TABLE IF EXISTS roles;
+DROP TABLE IF EXISTS permissions;
@@ -0,0 +1,55 @@
+-- Role-based access control. Users hold roles, roles grant permissions, and
+-- the permissions of a user's roles are carried in their access token.
+
+-- Permissions table: actions that can be granted, named resource:action
+CREATE TABLE permissions (
+    name VARCHAR(100) PRIMARY KEY,
+    description TEXT NOT NULL
+);
+
+-- Roles table: named sets of permissions
+CREATE TABLE roles (
+    name VARCHAR(50) PRIMARY KEY,
+    description TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Role permissions table: the permissions each role grants
+CREATE TABLE role_permissions (
+    role_name VARCHAR(50) NOT NULL REFERENCES roles(name) ON DELETE CASCADE,
+    permission VARCHAR(100) NOT NULL REFERENCES permissions(name) ON DELETE CASCADE,
+    PRIMARY KEY (role_name, permission)
+);
+
+-- User roles table: the roles granted to each user
+CREATE TABLE user_roles (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role_name VARCHAR(50) NOT NULL REFERENCES roles(name) ON DELETE CASCADE,
+    granted_by VARCHAR(255), -- user ID of the granting admin, or the operator
+    granted_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, role_name)
+);
+
+CREATE INDEX idx_user_roles_role_name ON user_roles(role_name);
+
+INSERT INTO permissions (name, description) VALUES
+('users:read', 'List and search all user accounts'),
+('users:disable', 'Disable user accounts'),
+('sessions:read', 'Search sessions across all users'),
+('sessions:revoke', 'Revoke any user''s sessions'),
+('alerts:read', 'List security alerts across all users'),
+('alerts:resolve', 'Resolve any user''s security alerts');
+
+INSERT INTO roles (name, description) VALUES
+('admin', 'Full administrative access'),
+('security_analyst', 'Investigates and responds to security incidents');
+
+INSERT INTO role_permissions (role_name, permission)
+SELECT 'admin', name FROM permissions;
+
+INSERT INTO role_permissions (role_name, permission) VALUES
+('security_analyst', 'users:read'),
+('security_analyst', 'sessions:read'),
+('security_analyst', 'sessions:revoke'),
+('security_analyst', 'alerts:read'),
+('security_analyst', 'alerts:resolve');
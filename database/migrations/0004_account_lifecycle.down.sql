@@ -0,0 +1,21 @@
+-- Reverts 0004_account_lifecycle. Impersonation sessions have no device and
+-- are dropped; redacted audit log entries stay redacted but will no longer
+-- verify.
+
+DELETE FROM permissions WHERE name IN ('users:delete', 'users:impersonate');
+UPDATE permissions SET description = 'Disable user accounts' WHERE name = 'users:disable';
+
+DROP TRIGGER prevent_audit_logs_change ON audit_logs;
+CREATE TRIGGER prevent_audit_logs_change BEFORE UPDATE OR DELETE ON audit_logs
+    FOR EACH ROW EXECUTE FUNCTION prevent_append_only_change();
+DROP FUNCTION IF EXISTS prevent_audit_log_change();
+
+DROP TABLE IF EXISTS audit_log_redactions;
+DROP TABLE IF EXISTS audit_log_erasures;
+
+DROP INDEX IF EXISTS idx_sessions_impersonator_id;
+DELETE FROM sessions WHERE device_id IS NULL;
+ALTER TABLE sessions DROP COLUMN IF EXISTS impersonator_id;
+ALTER TABLE sessions ALTER COLUMN device_id SET NOT NULL;
+
+ALTER TABLE users DROP COLUMN IF EXISTS deleted_at;
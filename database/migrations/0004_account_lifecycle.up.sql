@@ -0,0 +1,76 @@
+-- Account lifecycle: reactivating, deleting and impersonating accounts, and
+-- erasing a deleted user's personal data from the audit trail.
+
+-- Soft-deleted accounts keep their row, so their ID still resolves, but lose
+-- their personal data and can't sign in again
+ALTER TABLE users ADD COLUMN deleted_at TIMESTAMP WITH TIME ZONE;
+
+-- Impersonation sessions belong to the impersonated user but are opened by an
+-- admin, so they have no device of the user's. The impersonator is kept as a
+-- plain value so the marker outlives their account.
+ALTER TABLE sessions ALTER COLUMN device_id DROP NOT NULL;
+ALTER TABLE sessions ADD COLUMN impersonator_id UUID;
+
+CREATE INDEX idx_sessions_impersonator_id ON sessions(impersonator_id) WHERE impersonator_id IS NOT NULL;
+
+-- Audit log erasures: users whose personal data is scrubbed from the audit
+-- trail. Events for them that arrive later are scrubbed before they're chained.
+CREATE TABLE audit_log_erasures (
+    user_id UUID PRIMARY KEY,
+    erased_by VARCHAR(255) NOT NULL, -- user ID of the admin, or the calling service
+    erased_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Audit log redactions: the hash of each chained entry's contents after its
+-- personal data was scrubbed. entry_hash still covers the original contents,
+-- so the chain links are unchanged and VerifyAuditChain accepts a scrubbed
+-- entry when its contents match the redaction.
+CREATE TABLE audit_log_redactions (
+    sequence BIGINT PRIMARY KEY,
+    audit_log_id UUID NOT NULL,
+    redacted_hash VARCHAR(64) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TRIGGER prevent_audit_log_redactions_change BEFORE UPDATE OR DELETE ON audit_log_redactions
+    FOR EACH ROW EXECUTE FUNCTION prevent_append_only_change();
+
+-- Function to keep audit_logs append-only except for redaction, which the
+-- audit service turns on for its transaction with SET LOCAL audit.redacting.
+-- A redaction may only clear the columns holding personal data.
+CREATE OR REPLACE FUNCTION prevent_audit_log_change()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'UPDATE'
+       AND current_setting('audit.redacting', true) = 'on'
+       AND NEW.ip_address IS NULL
+       AND NEW.user_agent IS NULL
+       AND NEW.location_country IS NULL
+       AND NEW.location_city IS NULL
+       AND NEW.metadata IS NULL
+       AND (NEW.id, NEW.user_id, NEW.session_id, NEW.device_id, NEW.event_type,
+            NEW.event_category, NEW.severity, NEW.success, NEW.failure_reason,
+            NEW.created_at, NEW.sequence, NEW.prev_hash, NEW.entry_hash)
+           IS NOT DISTINCT FROM
+           (OLD.id, OLD.user_id, OLD.session_id, OLD.device_id, OLD.event_type,
+            OLD.event_category, OLD.severity, OLD.success, OLD.failure_reason,
+            OLD.created_at, OLD.sequence, OLD.prev_hash, OLD.entry_hash) THEN
+        RETURN NEW;
+    END IF;
+    RAISE EXCEPTION '% is append-only', TG_TABLE_NAME;
+END;
+$$ language 'plpgsql';
+
+DROP TRIGGER prevent_audit_logs_change ON audit_logs;
+CREATE TRIGGER prevent_audit_logs_change BEFORE UPDATE OR DELETE ON audit_logs
+    FOR EACH ROW EXECUTE FUNCTION prevent_audit_log_change();
+
+UPDATE permissions SET description = 'Disable and reactivate user accounts' WHERE name = 'users:disable';
+
+INSERT INTO permissions (name, description) VALUES
+('users:delete', 'Delete user accounts and erase their personal data'),
+('users:impersonate', 'Sign in as another user');
+
+INSERT INTO role_permissions (role_name, permission) VALUES
+('admin', 'users:delete'),
+('admin', 'users:impersonate');
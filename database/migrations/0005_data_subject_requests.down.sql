@@ -0,0 +1,30 @@
+-- Reverts 0005_data_subject_requests. Pending self-service deletions are
+-- dropped; pseudonymized audit log entries stay as they are.
+
+CREATE OR REPLACE FUNCTION prevent_audit_log_change()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'UPDATE'
+       AND current_setting('audit.redacting', true) = 'on'
+       AND NEW.ip_address IS NULL
+       AND NEW.user_agent IS NULL
+       AND NEW.location_country IS NULL
+       AND NEW.location_city IS NULL
+       AND NEW.metadata IS NULL
+       AND (NEW.id, NEW.user_id, NEW.session_id, NEW.device_id, NEW.event_type,
+            NEW.event_category, NEW.severity, NEW.success, NEW.failure_reason,
+            NEW.created_at, NEW.sequence, NEW.prev_hash, NEW.entry_hash)
+           IS NOT DISTINCT FROM
+           (OLD.id, OLD.user_id, OLD.session_id, OLD.device_id, OLD.event_type,
+            OLD.event_category, OLD.severity, OLD.success, OLD.failure_reason,
+            OLD.created_at, OLD.sequence, OLD.prev_hash, OLD.entry_hash) THEN
+        RETURN NEW;
+    END IF;
+    RAISE EXCEPTION '% is append-only', TG_TABLE_NAME;
+END;
+$$ language 'plpgsql';
+
+DROP FUNCTION IF EXISTS pseudonymize_ip(INET);
+
+DROP INDEX IF EXISTS idx_users_deletion_scheduled_at;
+ALTER TABLE users DROP COLUMN IF EXISTS deletion_scheduled_at;
@@ -0,0 +1,44 @@
+-- Data subject requests: users scheduling the deletion of their own account,
+-- and pseudonymizing rather than clearing their IP addresses and locations
+-- in the audit trail.
+
+-- Accounts whose owner asked for deletion are deleted once this passes, unless
+-- they cancel first
+ALTER TABLE users ADD COLUMN deletion_scheduled_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX idx_users_deletion_scheduled_at ON users(deletion_scheduled_at)
+    WHERE deletion_scheduled_at IS NOT NULL AND deleted_at IS NULL;
+
+-- Function to pseudonymize an IP address by keeping only its network: the
+-- first 24 bits of an IPv4 address or 48 bits of an IPv6 one. The audit
+-- service computes the same.
+CREATE OR REPLACE FUNCTION pseudonymize_ip(ip INET)
+RETURNS INET AS $$
+    SELECT host(network(set_masklen(ip, CASE family(ip) WHEN 4 THEN 24 ELSE 48 END)))::inet
+$$ LANGUAGE sql IMMUTABLE;
+
+-- A redaction now pseudonymizes the IP address and keeps the country, and
+-- still clears the user agent, city and metadata. Entries cleared entirely
+-- under 0004 stay valid.
+CREATE OR REPLACE FUNCTION prevent_audit_log_change()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'UPDATE'
+       AND current_setting('audit.redacting', true) = 'on'
+       AND (NEW.ip_address IS NULL OR NEW.ip_address = pseudonymize_ip(OLD.ip_address))
+       AND (NEW.location_country IS NULL OR NEW.location_country = OLD.location_country)
+       AND NEW.user_agent IS NULL
+       AND NEW.location_city IS NULL
+       AND NEW.metadata IS NULL
+       AND (NEW.id, NEW.user_id, NEW.session_id, NEW.device_id, NEW.event_type,
+            NEW.event_category, NEW.severity, NEW.success, NEW.failure_reason,
+            NEW.created_at, NEW.sequence, NEW.prev_hash, NEW.entry_hash)
+           IS NOT DISTINCT FROM
+           (OLD.id, OLD.user_id, OLD.session_id, OLD.device_id, OLD.event_type,
+            OLD.event_category, OLD.severity, OLD.success, OLD.failure_reason,
+            OLD.created_at, OLD.sequence, OLD.prev_hash, OLD.entry_hash) THEN
+        RETURN NEW;
+    END IF;
+    RAISE EXCEPTION '% is append-only', TG_TABLE_NAME;
+END;
+$$ language 'plpgsql';
@@ -0,0 +1,43 @@
+-- Reverts 0006_organizations. Every user goes back into one pool, and the
+-- organizations and their policies are dropped.
+
+DELETE FROM permissions WHERE name = 'organizations:manage';
+
+CREATE OR REPLACE FUNCTION prevent_audit_log_change()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'UPDATE'
+       AND current_setting('audit.redacting', true) = 'on'
+       AND (NEW.ip_address IS NULL OR NEW.ip_address = pseudonymize_ip(OLD.ip_address))
+       AND (NEW.location_country IS NULL OR NEW.location_country = OLD.location_country)
+       AND NEW.user_agent IS NULL
+       AND NEW.location_city IS NULL
+       AND NEW.metadata IS NULL
+       AND (NEW.id, NEW.user_id, NEW.session_id, NEW.device_id, NEW.event_type,
+            NEW.event_category, NEW.severity, NEW.success, NEW.failure_reason,
+            NEW.created_at, NEW.sequence, NEW.prev_hash, NEW.entry_hash)
+           IS NOT DISTINCT FROM
+           (OLD.id, OLD.user_id, OLD.session_id, OLD.device_id, OLD.event_type,
+            OLD.event_category, OLD.severity, OLD.success, OLD.failure_reason,
+            OLD.created_at, OLD.sequence, OLD.prev_hash, OLD.entry_hash) THEN
+        RETURN NEW;
+    END IF;
+    RAISE EXCEPTION '% is append-only', TG_TABLE_NAME;
+END;
+$$ language 'plpgsql';
+
+DROP TRIGGER IF EXISTS assign_audit_logs_organization_id ON audit_logs;
+DROP TRIGGER IF EXISTS assign_security_alerts_organization_id ON security_alerts;
+DROP TRIGGER IF EXISTS assign_sessions_organization_id ON sessions;
+DROP TRIGGER IF EXISTS assign_devices_organization_id ON devices;
+DROP FUNCTION IF EXISTS assign_organization_id();
+
+-- Dropping a column doesn't rewrite the rows, so the append-only trigger on
+-- audit_logs doesn't fire
+ALTER TABLE audit_logs DROP COLUMN IF EXISTS organization_id;
+ALTER TABLE security_alerts DROP COLUMN IF EXISTS organization_id;
+ALTER TABLE sessions DROP COLUMN IF EXISTS organization_id;
+ALTER TABLE devices DROP COLUMN IF EXISTS organization_id;
+ALTER TABLE users DROP COLUMN IF EXISTS organization_id;
+
+DROP TABLE IF EXISTS organizations;
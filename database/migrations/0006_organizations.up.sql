@@ -0,0 +1,110 @@
+-- Organizations: every user belongs to one tenant, whose policy governs how
+-- its members sign in, and whose admins only see their own members.
+
+-- Organizations table: tenants and their sign-in policy
+CREATE TABLE organizations (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    name VARCHAR(255) NOT NULL,
+    slug VARCHAR(63) UNIQUE NOT NULL,
+    mfa_required BOOLEAN NOT NULL DEFAULT false, -- members must have MFA enabled to sign in
+    session_lifetime_seconds INTEGER CHECK (session_lifetime_seconds > 0), -- NULL uses the 7 day default
+    allowed_countries TEXT[] NOT NULL DEFAULT '{}', -- sign-in countries; empty allows any
+    ip_allowlist CIDR[] NOT NULL DEFAULT '{}', -- sign-in networks; empty allows any
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TRIGGER update_organizations_updated_at BEFORE UPDATE ON organizations
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+-- Existing users, and users who register, join the default organization
+INSERT INTO organizations (id, name, slug) VALUES
+('00000000-0000-0000-0000-000000000001', 'Default', 'default');
+
+-- A constant default fills existing rows without rewriting them, which also
+-- keeps the append-only trigger on audit_logs out of the way. Only users keep
+-- it; the other tables take the organization of the row's user on insert.
+ALTER TABLE users ADD COLUMN organization_id UUID NOT NULL
+    DEFAULT '00000000-0000-0000-0000-000000000001' REFERENCES organizations(id);
+
+ALTER TABLE devices ADD COLUMN organization_id UUID NOT NULL
+    DEFAULT '00000000-0000-0000-0000-000000000001' REFERENCES organizations(id);
+ALTER TABLE devices ALTER COLUMN organization_id DROP DEFAULT;
+
+ALTER TABLE sessions ADD COLUMN organization_id UUID NOT NULL
+    DEFAULT '00000000-0000-0000-0000-000000000001' REFERENCES organizations(id);
+ALTER TABLE sessions ALTER COLUMN organization_id DROP DEFAULT;
+
+ALTER TABLE security_alerts ADD COLUMN organization_id UUID NOT NULL
+    DEFAULT '00000000-0000-0000-0000-000000000001' REFERENCES organizations(id);
+ALTER TABLE security_alerts ALTER COLUMN organization_id DROP DEFAULT;
+
+-- Audit log entries keep a plain value like their other IDs, and have none
+-- when they belong to no user. The entry hash doesn't cover it, so entries
+-- chained before organizations existed still verify; the append-only trigger
+-- keeps it from changing instead.
+ALTER TABLE audit_logs ADD COLUMN organization_id UUID
+    DEFAULT '00000000-0000-0000-0000-000000000001';
+ALTER TABLE audit_logs ALTER COLUMN organization_id DROP DEFAULT;
+
+CREATE INDEX idx_users_organization_id ON users(organization_id);
+CREATE INDEX idx_sessions_organization_id ON sessions(organization_id);
+CREATE INDEX idx_devices_organization_id ON devices(organization_id);
+CREATE INDEX idx_security_alerts_organization_id ON security_alerts(organization_id, created_at);
+CREATE INDEX idx_audit_logs_organization_id_created_at ON audit_logs(organization_id, created_at DESC, id DESC);
+
+-- Function to give a new row the organization of its user, so no writer can
+-- file a row under another tenant by leaving it out
+CREATE OR REPLACE FUNCTION assign_organization_id()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF NEW.organization_id IS NULL AND NEW.user_id IS NOT NULL THEN
+        SELECT organization_id INTO NEW.organization_id FROM users WHERE id = NEW.user_id;
+    END IF;
+    RETURN NEW;
+END;
+$$ language 'plpgsql';
+
+CREATE TRIGGER assign_devices_organization_id BEFORE INSERT ON devices
+    FOR EACH ROW EXECUTE FUNCTION assign_organization_id();
+
+CREATE TRIGGER assign_sessions_organization_id BEFORE INSERT ON sessions
+    FOR EACH ROW EXECUTE FUNCTION assign_organization_id();
+
+CREATE TRIGGER assign_security_alerts_organization_id BEFORE INSERT ON security_alerts
+    FOR EACH ROW EXECUTE FUNCTION assign_organization_id();
+
+CREATE TRIGGER assign_audit_logs_organization_id BEFORE INSERT ON audit_logs
+    FOR EACH ROW EXECUTE FUNCTION assign_organization_id();
+
+-- A redaction must also leave the organization alone
+CREATE OR REPLACE FUNCTION prevent_audit_log_change()
+RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'UPDATE'
+       AND current_setting('audit.redacting', true) = 'on'
+       AND (NEW.ip_address IS NULL OR NEW.ip_address = pseudonymize_ip(OLD.ip_address))
+       AND (NEW.location_country IS NULL OR NEW.location_country = OLD.location_country)
+       AND NEW.user_agent IS NULL
+       AND NEW.location_city IS NULL
+       AND NEW.metadata IS NULL
+       AND (NEW.id, NEW.user_id, NEW.session_id, NEW.device_id, NEW.event_type,
+            NEW.event_category, NEW.severity, NEW.success, NEW.failure_reason,
+            NEW.created_at, NEW.sequence, NEW.prev_hash, NEW.entry_hash,
+            NEW.organization_id)
+           IS NOT DISTINCT FROM
+           (OLD.id, OLD.user_id, OLD.session_id, OLD.device_id, OLD.event_type,
+            OLD.event_category, OLD.severity, OLD.success, OLD.failure_reason,
+            OLD.created_at, OLD.sequence, OLD.prev_hash, OLD.entry_hash,
+            OLD.organization_id) THEN
+        RETURN NEW;
+    END IF;
+    RAISE EXCEPTION '% is append-only', TG_TABLE_NAME;
+END;
+$$ language 'plpgsql';
+
+INSERT INTO permissions (name, description) VALUES
+('organizations:manage', 'Change the sign-in policy of the organization');
+
+INSERT INTO role_permissions (role_name, permission) VALUES
+('admin', 'organizations:manage');
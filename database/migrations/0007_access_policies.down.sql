@@ -0,0 +1,4 @@
+-- Reverts 0007_access_policies. Members sign in under their organization's
+-- allowlists alone.
+
+DROP TABLE IF EXISTS access_policies;
@@ -0,0 +1,27 @@
+-- Access policies: network and country rules on where an organization's
+-- members, or single members, may sign in from.
+
+-- Access policies table: a policy with no user applies to every member of
+-- its organization. Deny lists win over allow lists, and an allow list that
+-- is set must match. A broken rule blocks the sign-in, or asks for the MFA
+-- code again (step_up).
+CREATE TABLE access_policies (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    ip_allowlist CIDR[] NOT NULL DEFAULT '{}',
+    ip_denylist CIDR[] NOT NULL DEFAULT '{}',
+    country_allowlist TEXT[] NOT NULL DEFAULT '{}',
+    country_denylist TEXT[] NOT NULL DEFAULT '{}',
+    action VARCHAR(20) NOT NULL DEFAULT 'block' CHECK (action IN ('block', 'step_up')),
+    created_by UUID, -- NULL when created by an operator
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_access_policies_organization_id ON access_policies(organization_id);
+CREATE INDEX idx_access_policies_user_id ON access_policies(user_id) WHERE user_id IS NOT NULL;
+
+CREATE TRIGGER update_access_policies_updated_at BEFORE UPDATE ON access_policies
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
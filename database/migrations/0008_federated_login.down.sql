@@ -0,0 +1,5 @@
+-- Reverts 0008_federated_login. Users who only ever signed in with a
+-- provider are left without a way to sign in.
+
+DROP TABLE IF EXISTS federated_login_states;
+DROP TABLE IF EXISTS federated_identities;
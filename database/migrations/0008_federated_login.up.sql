@@ -0,0 +1,32 @@
+-- Federated login: signing in with an external identity provider (Google,
+-- GitHub or any OpenID Connect provider) linked to the user's account.
+
+-- Federated identities table: provider accounts linked to users. A user is
+-- found by the provider's stable subject, never by email, once linked.
+CREATE TABLE federated_identities (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    provider VARCHAR(63) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    email VARCHAR(255), -- as the provider reported it when linking
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    last_login_at TIMESTAMP WITH TIME ZONE,
+    UNIQUE (provider, subject)
+);
+
+CREATE INDEX idx_federated_identities_user_id ON federated_identities(user_id);
+
+-- Federated login states table: logins sent to a provider and not finished
+-- yet. A state is used once; it is kept after the provider vouched for the
+-- user only while their MFA code is awaited.
+CREATE TABLE federated_login_states (
+    state_hash VARCHAR(64) PRIMARY KEY, -- SHA-256 of the state parameter
+    provider VARCHAR(63) NOT NULL,
+    code_verifier VARCHAR(128) NOT NULL, -- PKCE
+    nonce VARCHAR(128) NOT NULL,
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE, -- set once the provider vouched for the user
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_federated_login_states_expires_at ON federated_login_states(expires_at);
@@ -0,0 +1,13 @@
+-- Reverts 0009_oauth_provider. Apps signed in through this system lose their
+-- tokens and registrations, and pending logout notifications are dropped.
+
+DROP TRIGGER IF EXISTS enqueue_deleted_sessions_backchannel_logout ON sessions;
+DROP TRIGGER IF EXISTS enqueue_revoked_sessions_backchannel_logout ON sessions;
+DROP FUNCTION IF EXISTS enqueue_backchannel_logout();
+
+DROP TABLE IF EXISTS backchannel_logout_outbox;
+DROP TABLE IF EXISTS oauth_client_sessions;
+DROP TABLE IF EXISTS oauth_refresh_tokens;
+DROP TABLE IF EXISTS oauth_authorization_codes;
+DROP TABLE IF EXISTS oauth_consents;
+DROP TABLE IF EXISTS oauth_clients;
@@ -0,0 +1,125 @@
+-- OAuth 2.0 authorization server and OpenID Connect provider: internal apps
+-- sign their users in through this system, so its sessions, devices and
+-- anomaly detection cover them too.
+
+-- OAuth clients table: apps registered by an organization. Public clients
+-- (single-page and mobile apps) have no secret and must use PKCE.
+CREATE TABLE oauth_clients (
+    id VARCHAR(64) PRIMARY KEY, -- the client_id apps send
+    organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    secret_hash VARCHAR(64), -- SHA-256 of the client secret; NULL for public clients
+    redirect_uris TEXT[] NOT NULL,
+    backchannel_logout_uri TEXT, -- notified when a session the app signed in with ends
+    scopes TEXT[] NOT NULL, -- the scopes the app may ask for
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_oauth_clients_organization_id ON oauth_clients(organization_id);
+
+CREATE TRIGGER update_oauth_clients_updated_at BEFORE UPDATE ON oauth_clients
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+-- OAuth consents table: the scopes a user agreed to share with an app. Apps
+-- asking for no more than that don't ask again.
+CREATE TABLE oauth_consents (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    client_id VARCHAR(64) NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+    scopes TEXT[] NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, client_id)
+);
+
+CREATE INDEX idx_oauth_consents_client_id ON oauth_consents(client_id);
+
+CREATE TRIGGER update_oauth_consents_updated_at BEFORE UPDATE ON oauth_consents
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+-- OAuth authorization codes table: codes handed to apps and not redeemed
+-- yet. Each is used once and belongs to the session it was issued in.
+CREATE TABLE oauth_authorization_codes (
+    code_hash VARCHAR(64) PRIMARY KEY, -- SHA-256 of the code
+    client_id VARCHAR(64) NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    session_id UUID NOT NULL REFERENCES sessions(id) ON DELETE CASCADE,
+    redirect_uri TEXT NOT NULL,
+    scopes TEXT[] NOT NULL,
+    nonce VARCHAR(255),
+    code_challenge VARCHAR(128), -- PKCE, S256 only
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_oauth_authorization_codes_expires_at ON oauth_authorization_codes(expires_at);
+
+-- OAuth refresh tokens table: refresh tokens held by apps. They are rotated
+-- on use and end with the session they were issued in.
+CREATE TABLE oauth_refresh_tokens (
+    token_hash VARCHAR(64) PRIMARY KEY, -- SHA-256 of the token
+    client_id VARCHAR(64) NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    session_id UUID NOT NULL REFERENCES sessions(id) ON DELETE CASCADE,
+    scopes TEXT[] NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_oauth_refresh_tokens_session_id ON oauth_refresh_tokens(session_id);
+CREATE INDEX idx_oauth_refresh_tokens_user_client ON oauth_refresh_tokens(user_id, client_id);
+
+-- OAuth client sessions table: the apps signed in through each session,
+-- told when it ends
+CREATE TABLE oauth_client_sessions (
+    session_id UUID NOT NULL REFERENCES sessions(id) ON DELETE CASCADE,
+    client_id VARCHAR(64) NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (session_id, client_id)
+);
+
+CREATE INDEX idx_oauth_client_sessions_client_id ON oauth_client_sessions(client_id);
+
+-- Back-channel logout outbox table: logout notifications waiting to be sent
+-- to apps, filled by triggers on sessions and drained by the auth service.
+-- The session and user aren't foreign keys, as they may be deleted by then.
+CREATE TABLE backchannel_logout_outbox (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    client_id VARCHAR(64) NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+    session_id UUID NOT NULL,
+    user_id UUID NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending', -- pending, failed
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    next_attempt_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_backchannel_logout_outbox_pending ON backchannel_logout_outbox(next_attempt_at) WHERE status = 'pending';
+
+-- Function to queue a logout notification for every app signed in through an
+-- ending session, in the same transaction as the change
+CREATE OR REPLACE FUNCTION enqueue_backchannel_logout()
+RETURNS TRIGGER AS $$
+BEGIN
+    INSERT INTO backchannel_logout_outbox (client_id, session_id, user_id)
+    SELECT cs.client_id, OLD.id, OLD.user_id
+    FROM oauth_client_sessions cs
+    JOIN oauth_clients c ON c.id = cs.client_id
+    WHERE cs.session_id = OLD.id AND c.backchannel_logout_uri IS NOT NULL;
+
+    IF TG_OP = 'DELETE' THEN
+        RETURN OLD;
+    END IF;
+    RETURN NEW;
+END;
+$$ language 'plpgsql';
+
+-- Triggers to notify apps whichever service revoked or deleted the session.
+-- Deletes are caught before they cascade to the session's apps.
+CREATE TRIGGER enqueue_revoked_sessions_backchannel_logout AFTER UPDATE OF is_active ON sessions
+    FOR EACH ROW WHEN (OLD.is_active AND NOT NEW.is_active) EXECUTE FUNCTION enqueue_backchannel_logout();
+
+CREATE TRIGGER enqueue_deleted_sessions_backchannel_logout BEFORE DELETE ON sessions
+    FOR EACH ROW WHEN (OLD.is_active) EXECUTE FUNCTION enqueue_backchannel_logout();
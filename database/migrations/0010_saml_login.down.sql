@@ -0,0 +1,5 @@
+-- Reverts 0010_saml_login. Users who only ever signed in over SAML are left
+-- without a way to sign in.
+
+DROP TABLE IF EXISTS saml_login_requests;
+DROP TABLE IF EXISTS saml_connections;
@@ -0,0 +1,34 @@
+-- SAML 2.0 login: enterprise organizations sign their members in with their
+-- own identity provider, with this system as the service provider.
+
+-- SAML connections table: the identity provider an organization's members
+-- sign in with. Assertions must be signed with the certificate's key.
+CREATE TABLE saml_connections (
+    organization_id UUID PRIMARY KEY REFERENCES organizations(id) ON DELETE CASCADE,
+    idp_entity_id VARCHAR(1024) NOT NULL,
+    idp_sso_url VARCHAR(2048) NOT NULL, -- HTTP-Redirect binding
+    idp_certificate TEXT NOT NULL, -- PEM
+    email_attribute VARCHAR(255), -- NULL takes the email from the NameID
+    name_attribute VARCHAR(255), -- NULL leaves names as they are
+    jit_provisioning BOOLEAN NOT NULL DEFAULT false, -- create users the identity provider vouches for
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TRIGGER update_saml_connections_updated_at BEFORE UPDATE ON saml_connections
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+-- SAML login requests table: authentication requests sent to an identity
+-- provider and not answered yet. Only answers to these are accepted, each
+-- once, from the browser holding the relay state.
+CREATE TABLE saml_login_requests (
+    request_id VARCHAR(64) PRIMARY KEY,
+    organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    relay_state_hash VARCHAR(64) NOT NULL, -- SHA-256 of the RelayState
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_saml_login_requests_expires_at ON saml_login_requests(expires_at);
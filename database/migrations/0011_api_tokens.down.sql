@@ -0,0 +1,4 @@
+-- Reverts 0011_api_tokens. Scripts and CI jobs using API tokens can no
+-- longer call the gateway.
+
+DROP TABLE IF EXISTS api_tokens;
@@ -0,0 +1,25 @@
+-- API tokens: long-lived credentials for scripts and CI jobs calling the
+-- gateway, in place of a user's short-lived access token.
+
+-- API tokens table: personal access tokens, which users make for
+-- themselves, and service API keys, which admins make for their
+-- organization. Either acts as its user, who for an API key is the admin
+-- who made it, with no more than its scopes and the user's roles allow.
+CREATE TABLE api_tokens (
+    id UUID PRIMARY KEY,
+    kind VARCHAR(16) NOT NULL CHECK (kind IN ('personal', 'service')),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    organization_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    token_prefix VARCHAR(32) NOT NULL, -- the start of the token, shown to tell tokens apart
+    token_hash VARCHAR(64) NOT NULL UNIQUE, -- SHA-256 of the token
+    scopes TEXT[] NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    last_used_at TIMESTAMP WITH TIME ZONE,
+    last_used_ip INET,
+    revoked_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_api_tokens_user_id ON api_tokens(user_id);
+CREATE INDEX idx_api_tokens_organization_id ON api_tokens(organization_id) WHERE kind = 'service';
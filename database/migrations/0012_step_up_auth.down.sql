@@ -0,0 +1,4 @@
+-- Reverts 0012_step_up_auth. Sessions forget when and how the user signed in.
+
+ALTER TABLE sessions DROP COLUMN IF EXISTS amr;
+ALTER TABLE sessions DROP COLUMN IF EXISTS auth_time;
@@ -0,0 +1,8 @@
+-- Step-up authentication: access tokens say when and how the user last proved
+-- who they are, so sensitive operations can ask for a recent sign-in.
+
+-- A refreshed access token keeps the authentication of the sign-in that opened
+-- the session rather than the time of the refresh. Sessions opened before this
+-- migration have no auth_time and count as authenticated when they were created.
+ALTER TABLE sessions ADD COLUMN auth_time TIMESTAMP WITH TIME ZONE;
+ALTER TABLE sessions ADD COLUMN amr TEXT[] NOT NULL DEFAULT '{}'; -- authentication methods, e.g. pwd, mfa, fed
@@ -0,0 +1,4 @@
+-- Reverts 0013_audit_log_personal_data. Redactions recorded since no longer
+-- verify.
+
+ALTER TABLE audit_log_redactions RENAME COLUMN personal_data_hash TO redacted_hash;
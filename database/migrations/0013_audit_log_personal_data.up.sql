@@ -0,0 +1,6 @@
+-- Audit log personal data commitments: each entry hash commits to the
+-- personal data an erasure scrubs as a hash of its own, and a redaction
+-- records that hash from before the entry was scrubbed. A scrubbed entry then
+-- verifies only if nothing but its personal data changed, which an unsigned
+-- hash of the scrubbed contents couldn't show.
+ALTER TABLE audit_log_redactions RENAME COLUMN redacted_hash TO personal_data_hash;
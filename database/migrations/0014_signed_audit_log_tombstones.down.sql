@@ -0,0 +1,6 @@
+-- Reverts 0014_signed_audit_log_tombstones. Tombstones keep only the last
+-- entry of each run.
+
+ALTER TABLE audit_log_tombstones DROP COLUMN IF EXISTS signature;
+ALTER TABLE audit_log_tombstones DROP COLUMN IF EXISTS key_id;
+ALTER TABLE audit_log_tombstones DROP COLUMN IF EXISTS first_sequence;
@@ -0,0 +1,9 @@
+-- Tombstones cover a whole run of consecutive entries dropped by retention
+-- and are signed with the checkpoint key, so a gap in the chain only verifies
+-- where the audit service expired a partition. Tombstones recorded before
+-- this aren't signed and no longer bridge their gaps.
+
+ALTER TABLE audit_log_tombstones
+    ADD COLUMN first_sequence BIGINT, -- first entry of the run ending at sequence
+    ADD COLUMN key_id VARCHAR(16), -- identifies the signing key, for rotation
+    ADD COLUMN signature TEXT; -- base64 signature over the run, entry_hash and partition_name
@@ -0,0 +1,7 @@
+-- Reverts 0015_federated_reauthentication. Pending reauthentications are
+-- dropped rather than left to finish as logins.
+
+DELETE FROM saml_login_requests WHERE reauthentication;
+DELETE FROM federated_login_states WHERE reauthentication;
+ALTER TABLE saml_login_requests DROP COLUMN IF EXISTS reauthentication;
+ALTER TABLE federated_login_states DROP COLUMN IF EXISTS reauthentication;
@@ -0,0 +1,7 @@
+-- Users of a federated login reauthenticate by signing in again with their
+-- identity provider. Those logins are marked so that one can't stand in for
+-- the other: a reauthentication doesn't open a session, and a login the
+-- identity provider may have answered from its own session doesn't prove
+-- the user is there.
+ALTER TABLE federated_login_states ADD COLUMN reauthentication BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE saml_login_requests ADD COLUMN reauthentication BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,15 @@
+-- Reverts 0016_security_alert_outbox. Alerts still waiting in the outbox are
+-- written to security_alerts, where they went before, rather than lost.
+
+INSERT INTO security_alerts (id, user_id, alert_type, severity, description,
+                             metadata, ip_address, location_country, location_city,
+                             is_resolved, created_at)
+SELECT (event->>'ID')::uuid, (event->>'UserID')::uuid, event->>'AlertType', event->>'Severity',
+       event->>'Description', (event->>'Metadata')::jsonb, (event->>'IPAddress')::inet,
+       event->>'LocationCountry', event->>'LocationCity', FALSE, (event->>'CreatedAt')::timestamptz
+FROM audit_outbox
+WHERE kind = 'security_alert'
+ON CONFLICT (id) DO NOTHING;
+
+DELETE FROM audit_outbox WHERE kind = 'security_alert';
+ALTER TABLE audit_outbox DROP COLUMN IF EXISTS kind;
@@ -0,0 +1,4 @@
+-- Security alerts raised by the auth service go through the audit outbox like
+-- its audit events, so the audit service stores them and forwards them to
+-- the SIEM. kind says which of the two an outbox row's event holds.
+ALTER TABLE audit_outbox ADD COLUMN kind VARCHAR(20) NOT NULL DEFAULT 'audit_log'; -- audit_log, security_alert
@@ -0,0 +1,11 @@
+-- Reverts 0017_oauth_token_families. Used codes and refresh tokens are
+-- deleted, as they were when used before.
+
+DELETE FROM oauth_refresh_tokens WHERE used_at IS NOT NULL;
+DELETE FROM oauth_authorization_codes WHERE redeemed_at IS NOT NULL;
+
+DROP INDEX IF EXISTS idx_oauth_refresh_tokens_family_id;
+ALTER TABLE oauth_refresh_tokens DROP COLUMN IF EXISTS used_at;
+ALTER TABLE oauth_refresh_tokens DROP COLUMN IF EXISTS family_id;
+ALTER TABLE oauth_authorization_codes DROP COLUMN IF EXISTS family_id;
+ALTER TABLE oauth_authorization_codes DROP COLUMN IF EXISTS redeemed_at;
@@ -0,0 +1,14 @@
+-- Authorization codes and refresh tokens are marked as used rather than
+-- deleted, so presenting one a second time can be told apart from presenting
+-- one that never existed. The refresh tokens descended from one code form a
+-- family: a replayed code or a reused refresh token means one of them leaked,
+-- and the whole family is revoked (RFC 9700 sections 2.1.1 and 4.14).
+ALTER TABLE oauth_authorization_codes ADD COLUMN redeemed_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE oauth_authorization_codes ADD COLUMN family_id UUID; -- set when redeemed
+
+-- Existing refresh tokens each start a family of their own
+ALTER TABLE oauth_refresh_tokens ADD COLUMN family_id UUID NOT NULL DEFAULT uuid_generate_v4();
+ALTER TABLE oauth_refresh_tokens ALTER COLUMN family_id DROP DEFAULT;
+ALTER TABLE oauth_refresh_tokens ADD COLUMN used_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX idx_oauth_refresh_tokens_family_id ON oauth_refresh_tokens(family_id);
@@ -0,0 +1,14 @@
+// Package migrations embeds the versioned schema migrations.
+//
+// Each version has two files: NNNN_name.up.sql applies it and
+// NNNN_name.down.sql reverts it. Applied files must never be edited; add a new
+// version instead, since the runner refuses to continue when the checksum of
+// an applied migration no longer matches.
+package migrations
+
+import "embed"
+
+// FS holds the migration files
+//
+//go:embed *.sql
+var FS embed.FS
@@ -5,6 +5,7 @@ import { useQuery, useMutation } from '@apollo/client';
 import DashboardLayout from '@/components/DashboardLayout';
 import { GET_DEVICES } from '@/lib/graphql/queries';
 import { TRUST_DEVICE } from '@/lib/graphql/mutations';
+import { withRecentAuth } from '@/lib/reauth';
 import {
   FaDesktop,
   FaMobileAlt,
@@ -33,7 +34,7 @@ export default function DevicesPage() {
 
     setTrustingDevice(deviceId);
     try {
-      await trustDeviceMutation({ variables: { deviceId } });
+      await withRecentAuth((context) => trustDeviceMutation({ variables: { deviceId }, context }));
       refetch();
     } catch (error) {
       console.error('Failed to trust device:', error);
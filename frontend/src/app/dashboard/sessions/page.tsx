@@ -5,6 +5,7 @@ import { useQuery, useMutation } from '@apollo/client';
 import DashboardLayout from '@/components/DashboardLayout';
 import { GET_SESSIONS } from '@/lib/graphql/queries';
 import { REVOKE_SESSION, REVOKE_ALL_SESSIONS } from '@/lib/graphql/mutations';
+import { withRecentAuth } from '@/lib/reauth';
 import {
   FaDesktop,
   FaMobileAlt,
@@ -54,7 +55,7 @@ export default function SessionsPage() {
     }
 
     try {
-      await revokeAllSessions({ variables: { exceptCurrent: true } });
+      await withRecentAuth((context) => revokeAllSessions({ variables: { exceptCurrent: true }, context }));
       refetch();
       alert('All other sessions have been revoked');
     } catch (error) {
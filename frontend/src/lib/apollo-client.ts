@@ -11,10 +11,11 @@ const authLink = setContext((_, { headers }) => {
   const token = Cookies.get('accessToken');
   
   // Return the headers to the context so httpLink can read them
+  // A request may bring its own token, such as the one from reauthenticate
   return {
     headers: {
-      ...headers,
       authorization: token ? `Bearer ${token}` : '',
+      ...headers,
     }
   };
 });
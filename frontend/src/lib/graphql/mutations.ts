@@ -59,6 +59,16 @@ export const VERIFY_MFA = gql`
   }
 `;
 
+export const REAUTHENTICATE = gql`
+  mutation Reauthenticate($password: String!, $mfaCode: String) {
+    reauthenticate(password: $password, mfaCode: $mfaCode) {
+      success
+      accessToken
+      expiresAt
+    }
+  }
+`;
+
 // Session Mutations
 export const REVOKE_SESSION = gql`
   mutation RevokeSession($sessionId: ID!) {
@@ -97,38 +97,33 @@ export const GET_DEVICES = gql`
 
 // Audit Queries
 export const GET_AUDIT_LOGS = gql`
-  query GetAuditLogs(
-    $limit: Int
-    $offset: Int
-    $eventCategory: String
-    $severity: String
-    $successOnly: Boolean
-  ) {
-    auditLogs(
-      limit: $limit
-      offset: $offset
-      eventCategory: $eventCategory
-      severity: $severity
-      successOnly: $successOnly
-    ) {
+  query GetAuditLogs($first: Int, $after: String, $filter: AuditLogFilter) {
+    auditLogs(first: $first, after: $after, filter: $filter) {
       success
       message
-      logs {
-        id
-        userId
-        sessionId
-        deviceId
-        eventType
-        eventCategory
-        severity
-        ipAddress
-        userAgent
-        locationCountry
-        locationCity
-        metadata
-        success
-        failureReason
-        createdAt
+      edges {
+        cursor
+        node {
+          id
+          userId
+          sessionId
+          deviceId
+          eventType
+          eventCategory
+          severity
+          ipAddress
+          userAgent
+          locationCountry
+          locationCity
+          metadata
+          success
+          failureReason
+          createdAt
+        }
+      }
+      pageInfo {
+        hasNextPage
+        endCursor
       }
       totalCount
     }
@@ -0,0 +1,54 @@
+import { ApolloError } from '@apollo/client';
+import client from './apollo-client';
+import { REAUTHENTICATE } from './graphql/mutations';
+
+type RequestContext = { headers: Record<string, string> };
+
+// hasReason reports whether the gateway refused a request with reason
+const hasReason = (error: unknown, reason: string): boolean =>
+  error instanceof ApolloError &&
+  error.graphQLErrors.some((e) => e.extensions?.reason === reason);
+
+// reauthenticate asks for the password, and the MFA code when the account
+// has MFA, and returns the short-lived access token for sensitive mutations
+const reauthenticate = async (): Promise<string> => {
+  const password = window.prompt('Confirm your password to continue');
+  if (!password) {
+    throw new Error('Reauthentication cancelled');
+  }
+
+  let mfaCode: string | undefined;
+  for (;;) {
+    try {
+      const { data } = await client.mutate({
+        mutation: REAUTHENTICATE,
+        variables: { password, mfaCode },
+      });
+      return data.reauthenticate.accessToken;
+    } catch (error) {
+      if (mfaCode !== undefined || !hasReason(error, 'MFA_CODE_REQUIRED')) {
+        throw error;
+      }
+      mfaCode = window.prompt('Enter your MFA code') || undefined;
+      if (!mfaCode) {
+        throw new Error('Reauthentication cancelled');
+      }
+    }
+  }
+};
+
+// withRecentAuth runs a mutation marked with @requiresRecentAuth. When the
+// sign-in is too old, it reauthenticates and runs it once more with the
+// token that returns; later requests keep using the session's token.
+export const withRecentAuth = async <T>(run: (context?: RequestContext) => Promise<T>): Promise<T> => {
+  try {
+    return await run();
+  } catch (error) {
+    if (!hasReason(error, 'REAUTHENTICATION_REQUIRED')) {
+      throw error;
+    }
+  }
+
+  const accessToken = await reauthenticate();
+  return run({ headers: { authorization: `Bearer ${accessToken}` } });
+};
@@ -0,0 +1,58 @@
+#!/usr/bin/env bash
+# Generates a local development CA, an mTLS certificate for each service and
+# the Ed25519 key pair the gateway signs identity tokens with, and the RSA key
+# the auth service signs OpenID Connect tokens with.
+#
+# Usage: scripts/dev-certs.sh [output-dir]   (default: ./certs)
+#
+# The CA is reused if it already exists, so services keep trusting each other
+# when the leaf certificates are regenerated. Never use these in production.
+set -euo pipefail
+
+DIR="${1:-certs}"
+DAYS=825
+NAMES=(gateway auth-service session-service audit-service ops)
+
+mkdir -p "$DIR"
+cd "$DIR"
+
+if [[ ! -f ca.key || ! -f ca.crt ]]; then
+	echo "Creating development CA"
+	openssl ecparam -name prime256v1 -genkey -noout -out ca.key
+	openssl req -x509 -new -key ca.key -sha256 -days 3650 \
+		-subj "/O=Session Management System/CN=Session Management System Dev CA" \
+		-out ca.crt
+fi
+
+for name in "${NAMES[@]}"; do
+	echo "Issuing certificate for $name"
+	openssl ecparam -name prime256v1 -genkey -noout -out "$name.key"
+	openssl req -new -key "$name.key" -subj "/O=Session Management System/CN=$name" -out "$name.csr"
+
+	# The common name identifies the caller; the SANs let it serve under its
+	# compose hostname and on localhost
+	cat > "$name.ext" <<EXT
+basicConstraints = CA:FALSE
+keyUsage = critical, digitalSignature
+extendedKeyUsage = serverAuth, clientAuth
+subjectAltName = DNS:$name, DNS:localhost, IP:127.0.0.1
+EXT
+	openssl x509 -req -in "$name.csr" -CA ca.crt -CAkey ca.key -CAcreateserial \
+		-days "$DAYS" -sha256 -extfile "$name.ext" -out "$name.crt" 2>/dev/null
+	rm "$name.csr" "$name.ext"
+done
+rm -f ca.srl
+
+if [[ ! -f identity.key ]]; then
+	echo "Creating identity token signing key"
+	openssl genpkey -algorithm ed25519 -out identity.key
+fi
+openssl pkey -in identity.key -pubout -out identity.pub
+
+if [[ ! -f oauth-signing.key ]]; then
+	echo "Creating OpenID Connect token signing key"
+	openssl genpkey -algorithm RSA -pkeyopt rsa_keygen_bits:2048 -out oauth-signing.key 2>/dev/null
+fi
+
+chmod 600 ./*.key
+echo "Wrote certificates and keys to $DIR"